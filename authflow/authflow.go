@@ -0,0 +1,255 @@
+package authflow
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// RequirementRequired executions have to be completed, unless their step does not apply to the user.
+	RequirementRequired = "required"
+	// RequirementOptional executions are offered to the user, but the user may continue with the executions after them.
+	RequirementOptional = "optional"
+	// RequirementAlternative executions that follow each other form a group, completing one of them completes the group.
+	RequirementAlternative = "alternative"
+	// RequirementConditional executions are required if their condition holds and skipped otherwise.
+	RequirementConditional = "conditional"
+)
+
+var Requirements = []string{
+	RequirementRequired,
+	RequirementOptional,
+	RequirementAlternative,
+	RequirementConditional,
+}
+
+// Execution is either a single step or a sub flow of an authentication flow.
+type Execution struct {
+	Step string      `json:"step,omitempty"`
+	Flow []Execution `json:"flow,omitempty"`
+
+	Requirement string `json:"requirement"`
+	// Condition names the condition of a conditional execution, a leading "!" negates it.
+	Condition string `json:"condition,omitempty"`
+}
+
+// State is the progress of a single login.
+type State interface {
+	IsCompleted(step string) bool
+	// IsIdentified is false until it is known which user signs in, steps are not asked whether they apply before.
+	IsIdentified() bool
+	// NeedsToRun reports whether the step applies to the user, e.g. a totp step does not apply without a totp.
+	NeedsToRun(step string) (bool, error)
+	Condition(name string) (bool, error)
+}
+
+type Result struct {
+	// Steps are the steps the user can continue with, the first one is the suggested one.
+	Steps []string
+	// Complete is set once all executions are satisfied, Steps then only contains pending optional steps.
+	Complete bool
+}
+
+// ValidationOptions lists what the executions of a flow may reference.
+type ValidationOptions struct {
+	Steps      []string
+	Conditions []string
+}
+
+// Validate checks that all executions of the flow are well-formed and only reference known steps and conditions.
+func Validate(flow []Execution, options ValidationOptions) error {
+	if len(flow) == 0 {
+		return errors.New("the flow has no executions")
+	}
+
+	for i, execution := range flow {
+		err := validateExecution(execution, options)
+		if err != nil {
+			return fmt.Errorf("execution %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func validateExecution(execution Execution, options ValidationOptions) error {
+	if !slices.Contains(Requirements, execution.Requirement) {
+		return fmt.Errorf("unknown requirement '%s'", execution.Requirement)
+	}
+
+	if execution.Requirement == RequirementConditional {
+		if !slices.Contains(options.Conditions, strings.TrimPrefix(execution.Condition, "!")) {
+			return fmt.Errorf("unknown condition '%s'", execution.Condition)
+		}
+	} else if execution.Condition != "" {
+		return errors.New("only conditional executions can have a condition")
+	}
+
+	if (execution.Step == "") == (len(execution.Flow) == 0) {
+		return errors.New("an execution needs either a step or a sub flow")
+	}
+
+	if execution.Step != "" {
+		if !slices.Contains(options.Steps, execution.Step) {
+			return fmt.Errorf("unknown step '%s'", execution.Step)
+		}
+		return nil
+	}
+
+	return Validate(execution.Flow, options)
+}
+
+// Evaluate finds the steps a login can continue with.
+func Evaluate(flow []Execution, state State) (Result, error) {
+	status, steps, err := evaluateFlow(flow, state)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Steps:    steps,
+		Complete: status != statusPending,
+	}, nil
+}
+
+type status int
+
+const (
+	statusPending status = iota
+	statusCompleted
+	// statusSkipped means that nothing of the execution applies to the user.
+	statusSkipped
+)
+
+func evaluateFlow(flow []Execution, state State) (status, []string, error) {
+	var offered []string
+
+	for i := 0; i < len(flow); {
+		execution := flow[i]
+
+		if execution.Requirement == RequirementAlternative {
+			end := i
+			for end < len(flow) && flow[end].Requirement == RequirementAlternative {
+				end++
+			}
+
+			status, steps, err := evaluateAlternatives(flow[i:end], state)
+			if err != nil {
+				return statusPending, nil, err
+			}
+			offered = append(offered, steps...)
+			if status == statusPending {
+				return statusPending, offered, nil
+			}
+
+			i = end
+			continue
+		}
+
+		if execution.Requirement == RequirementConditional {
+			holds, err := evaluateCondition(execution.Condition, state)
+			if err != nil {
+				return statusPending, nil, err
+			}
+			if !holds {
+				i++
+				continue
+			}
+		}
+
+		status, steps, err := evaluateExecution(execution, state)
+		if err != nil {
+			return statusPending, nil, err
+		}
+
+		if status == statusPending {
+			if execution.Requirement != RequirementOptional {
+				return statusPending, append(offered, steps...), nil
+			}
+			// an optional execution is skipped once the user continued after it
+			if !hasProgress(flow[i+1:], state) {
+				offered = append(offered, steps...)
+			}
+		} else {
+			offered = append(offered, steps...)
+		}
+
+		i++
+	}
+
+	if hasProgress(flow, state) {
+		return statusCompleted, offered, nil
+	}
+	return statusSkipped, offered, nil
+}
+
+func evaluateAlternatives(alternatives []Execution, state State) (status, []string, error) {
+	var pending []string
+	for _, alternative := range alternatives {
+		status, steps, err := evaluateExecution(alternative, state)
+		if err != nil {
+			return statusPending, nil, err
+		}
+
+		switch status {
+		case statusCompleted:
+			return statusCompleted, steps, nil
+		case statusPending:
+			// once the user started with an alternative they have to finish it
+			if hasProgress([]Execution{alternative}, state) {
+				return statusPending, steps, nil
+			}
+			pending = append(pending, steps...)
+		}
+	}
+
+	if len(pending) > 0 {
+		return statusPending, pending, nil
+	}
+	return statusSkipped, nil, nil
+}
+
+func evaluateExecution(execution Execution, state State) (status, []string, error) {
+	if execution.Step == "" {
+		return evaluateFlow(execution.Flow, state)
+	}
+
+	if state.IsCompleted(execution.Step) {
+		return statusCompleted, nil, nil
+	}
+	if !state.IsIdentified() {
+		return statusPending, []string{execution.Step}, nil
+	}
+
+	needsToRun, err := state.NeedsToRun(execution.Step)
+	if err != nil {
+		return statusPending, nil, err
+	}
+	if !needsToRun {
+		return statusSkipped, nil, nil
+	}
+	return statusPending, []string{execution.Step}, nil
+}
+
+func evaluateCondition(condition string, state State) (bool, error) {
+	name, negated := strings.CutPrefix(condition, "!")
+	holds, err := state.Condition(name)
+	if err != nil {
+		return false, err
+	}
+	return holds != negated, nil
+}
+
+func hasProgress(flow []Execution, state State) bool {
+	for _, execution := range flow {
+		if execution.Step != "" && state.IsCompleted(execution.Step) {
+			return true
+		}
+		if hasProgress(execution.Flow, state) {
+			return true
+		}
+	}
+	return false
+}
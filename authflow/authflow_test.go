@@ -0,0 +1,214 @@
+package authflow
+
+import (
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+)
+
+type testState struct {
+	completed  []string
+	identified bool
+	notNeeded  []string
+	conditions map[string]bool
+}
+
+func (s *testState) IsCompleted(step string) bool {
+	return slices.Contains(s.completed, step)
+}
+
+func (s *testState) IsIdentified() bool {
+	return s.identified
+}
+
+func (s *testState) NeedsToRun(step string) (bool, error) {
+	return !slices.Contains(s.notNeeded, step), nil
+}
+
+func (s *testState) Condition(name string) (bool, error) {
+	return s.conditions[name], nil
+}
+
+// passkeyOrPasswordAndTotp is "passkey OR (password AND totp)".
+var passkeyOrPasswordAndTotp = []Execution{
+	{Step: "passkey", Requirement: RequirementAlternative},
+	{Requirement: RequirementAlternative, Flow: []Execution{
+		{Step: "password", Requirement: RequirementRequired},
+		{Step: "totp", Requirement: RequirementRequired},
+	}},
+}
+
+func TestEvaluate_OffersAllAlternativesBeforeIdentification(t *testing.T) {
+	// arrange
+	state := &testState{}
+
+	// act
+	result, err := Evaluate(passkeyOrPasswordAndTotp, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, result.Complete)
+	assert.Equal(t, []string{"passkey", "password"}, result.Steps)
+}
+
+func TestEvaluate_ContinuesStartedAlternative(t *testing.T) {
+	// arrange
+	state := &testState{completed: []string{"password"}, identified: true}
+
+	// act
+	result, err := Evaluate(passkeyOrPasswordAndTotp, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, result.Complete)
+	assert.Equal(t, []string{"totp"}, result.Steps)
+}
+
+func TestEvaluate_CompletedAlternativeCompletesGroup(t *testing.T) {
+	// arrange
+	state := &testState{completed: []string{"passkey"}, identified: true}
+
+	// act
+	result, err := Evaluate(passkeyOrPasswordAndTotp, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, result.Complete)
+	assert.Empty(t, result.Steps)
+}
+
+// passwordAndSecondFactor is "password AND (totp OR passkey)", the second factor is skipped if the user has none.
+var passwordAndSecondFactor = []Execution{
+	{Step: "password", Requirement: RequirementAlternative},
+	{Requirement: RequirementRequired, Flow: []Execution{
+		{Step: "totp", Requirement: RequirementAlternative},
+		{Step: "passkey", Requirement: RequirementAlternative},
+	}},
+}
+
+func TestEvaluate_OffersApplyingSecondFactors(t *testing.T) {
+	// arrange
+	state := &testState{completed: []string{"password"}, identified: true}
+
+	// act
+	result, err := Evaluate(passwordAndSecondFactor, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, result.Complete)
+	assert.Equal(t, []string{"totp", "passkey"}, result.Steps)
+}
+
+func TestEvaluate_OneSecondFactorIsEnough(t *testing.T) {
+	// arrange
+	state := &testState{completed: []string{"password", "passkey"}, identified: true}
+
+	// act
+	result, err := Evaluate(passwordAndSecondFactor, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, result.Complete)
+}
+
+func TestEvaluate_SkipsSecondFactorWithoutAny(t *testing.T) {
+	// arrange
+	state := &testState{completed: []string{"password"}, identified: true, notNeeded: []string{"totp", "passkey"}}
+
+	// act
+	result, err := Evaluate(passwordAndSecondFactor, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, result.Complete)
+	assert.Empty(t, result.Steps)
+}
+
+func TestEvaluate_SkipsStepsThatDoNotApply(t *testing.T) {
+	// arrange
+	state := &testState{completed: []string{"password"}, identified: true, notNeeded: []string{"totp"}}
+
+	// act
+	result, err := Evaluate(passkeyOrPasswordAndTotp, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, result.Complete)
+}
+
+func TestEvaluate_OffersOptionalStepWithFollowingStep(t *testing.T) {
+	// arrange
+	flow := []Execution{
+		{Step: "password", Requirement: RequirementRequired},
+		{Step: "passkey_onboarding", Requirement: RequirementOptional},
+		{Step: "device", Requirement: RequirementRequired},
+	}
+	state := &testState{completed: []string{"password"}, identified: true}
+
+	// act
+	result, err := Evaluate(flow, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"passkey_onboarding", "device"}, result.Steps)
+}
+
+func TestEvaluate_SkipsOptionalStepOnceUserContinued(t *testing.T) {
+	// arrange
+	flow := []Execution{
+		{Step: "password", Requirement: RequirementRequired},
+		{Step: "passkey_onboarding", Requirement: RequirementOptional},
+		{Step: "device", Requirement: RequirementRequired},
+	}
+	state := &testState{completed: []string{"password", "device"}, identified: true}
+
+	// act
+	result, err := Evaluate(flow, state)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, result.Complete)
+	assert.Empty(t, result.Steps)
+}
+
+func TestEvaluate_Conditional(t *testing.T) {
+	// arrange
+	flow := []Execution{
+		{Step: "password", Requirement: RequirementRequired},
+		{Step: "totp", Requirement: RequirementConditional, Condition: "!trusted"},
+	}
+
+	// act
+	trusted, err1 := Evaluate(flow, &testState{completed: []string{"password"}, identified: true, conditions: map[string]bool{"trusted": true}})
+	untrusted, err2 := Evaluate(flow, &testState{completed: []string{"password"}, identified: true})
+
+	// assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.True(t, trusted.Complete)
+	assert.Equal(t, []string{"totp"}, untrusted.Steps)
+}
+
+func TestValidate(t *testing.T) {
+	// arrange
+	options := ValidationOptions{
+		Steps:      []string{"passkey", "password", "totp"},
+		Conditions: []string{"trusted"},
+	}
+
+	// act
+	valid := Validate(passkeyOrPasswordAndTotp, options)
+	unknownStep := Validate([]Execution{{Step: "sms", Requirement: RequirementRequired}}, options)
+	unknownRequirement := Validate([]Execution{{Step: "totp", Requirement: "sometimes"}}, options)
+	missingCondition := Validate([]Execution{{Step: "totp", Requirement: RequirementConditional}}, options)
+	stepAndFlow := Validate([]Execution{{Step: "totp", Requirement: RequirementRequired, Flow: passkeyOrPasswordAndTotp}}, options)
+	empty := Validate(nil, options)
+
+	// assert
+	assert.NoError(t, valid)
+	assert.Error(t, unknownStep)
+	assert.Error(t, unknownRequirement)
+	assert.Error(t, missingCondition)
+	assert.Error(t, stepAndFlow)
+	assert.Error(t, empty)
+}
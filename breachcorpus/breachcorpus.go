@@ -0,0 +1,266 @@
+package breachcorpus
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The corpus file contains one record per breached password hash, sorted by hash, followed by a footer.
+// A record holds the hash without its first two bytes and the breach count. The footer holds the index of the
+// first record of every two byte hash prefix, so a lookup only has to binary search the records of one prefix.
+
+const (
+	HashSize = sha1.Size
+	// RangePrefixLength is the length of the hex encoded hash prefix of the HIBP range format.
+	RangePrefixLength = 5
+
+	bucketCount    = 1 << 16
+	bucketBytes    = 2
+	recordHashSize = HashSize - bucketBytes
+	recordSize     = recordHashSize + 4
+	indexSize      = (bucketCount + 1) * 4
+	magic          = "HOLVITB1"
+	magicSize      = 8
+	footerSize     = indexSize + magicSize
+)
+
+var ErrInvalidCorpus = errors.New("invalid breach corpus")
+
+// Builder writes a corpus file from hashes added in ascending order.
+type Builder struct {
+	w        *bufio.Writer
+	counts   [bucketCount]uint32
+	last     [HashSize]byte
+	records  uint64
+	finished bool
+}
+
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Len returns the number of hashes added so far.
+func (b *Builder) Len() uint64 {
+	return b.records
+}
+
+// Add appends a hash with its breach count, hashes have to be added in strictly ascending order.
+func (b *Builder) Add(hash [HashSize]byte, count int) error {
+	if b.finished {
+		return errors.New("the corpus is already finished")
+	}
+	if b.records > 0 && bytes.Compare(hash[:], b.last[:]) <= 0 {
+		return fmt.Errorf("hash %X is not in ascending order", hash)
+	}
+	if b.records == math.MaxUint32 {
+		return errors.New("the corpus can not contain more hashes")
+	}
+	if count < 0 {
+		return fmt.Errorf("negative count for hash %X", hash)
+	}
+
+	var record [recordSize]byte
+	copy(record[:recordHashSize], hash[bucketBytes:])
+	binary.BigEndian.PutUint32(record[recordHashSize:], uint32(min(count, math.MaxUint32)))
+
+	if _, err := b.w.Write(record[:]); err != nil {
+		return err
+	}
+
+	b.counts[binary.BigEndian.Uint16(hash[:bucketBytes])]++
+	b.last = hash
+	b.records++
+	return nil
+}
+
+// AddLines adds all lines of the reader in the format HASH:COUNT.
+// When prefix is not empty the lines are in the HIBP range format, they only contain the hash without the prefix.
+func (b *Builder) AddLines(r io.Reader, prefix string) error {
+	if prefix != "" && len(prefix) != RangePrefixLength {
+		return fmt.Errorf("the range prefix '%s' has to be %d characters long", prefix, RangePrefixLength)
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, count, err := parseLine(prefix + line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		if err := b.Add(hash, count); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseLine(line string) ([HashSize]byte, int, error) {
+	var hash [HashSize]byte
+
+	hexHash, countText, found := strings.Cut(line, ":")
+	if len(hexHash) != hex.EncodedLen(HashSize) {
+		return hash, 0, fmt.Errorf("'%s' is not a sha1 hash", hexHash)
+	}
+	if _, err := hex.Decode(hash[:], []byte(hexHash)); err != nil {
+		return hash, 0, fmt.Errorf("'%s' is not a sha1 hash", hexHash)
+	}
+
+	// some corpora only contain the hashes, every hash has been seen at least once
+	if !found {
+		return hash, 1, nil
+	}
+
+	count, err := strconv.Atoi(countText)
+	if err != nil || count < 0 {
+		return hash, 0, fmt.Errorf("'%s' is not a valid count", countText)
+	}
+
+	return hash, count, nil
+}
+
+// Finish writes the footer, no hashes can be added afterward.
+func (b *Builder) Finish() error {
+	if b.finished {
+		return errors.New("the corpus is already finished")
+	}
+	b.finished = true
+
+	var footer [footerSize]byte
+	var start uint32
+	for i, count := range b.counts {
+		binary.BigEndian.PutUint32(footer[i*4:], start)
+		start += count
+	}
+	binary.BigEndian.PutUint32(footer[bucketCount*4:], start)
+	copy(footer[indexSize:], magic)
+
+	if _, err := b.w.Write(footer[:]); err != nil {
+		return err
+	}
+	return b.w.Flush()
+}
+
+// Corpus looks up breach counts in a corpus file without loading the records into memory.
+// It is safe for concurrent use.
+type Corpus struct {
+	r      io.ReaderAt
+	closer io.Closer
+	index  [bucketCount + 1]uint32
+}
+
+// Open opens the corpus file at the path, it has to be closed by the caller.
+func Open(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	corpus, err := NewCorpus(file, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	corpus.closer = file
+	return corpus, nil
+}
+
+// NewCorpus reads the footer of a corpus with the given size.
+func NewCorpus(r io.ReaderAt, size int64) (*Corpus, error) {
+	if size < footerSize {
+		return nil, ErrInvalidCorpus
+	}
+
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, err
+	}
+	if string(footer[indexSize:]) != magic {
+		return nil, ErrInvalidCorpus
+	}
+
+	corpus := &Corpus{
+		r: r,
+	}
+	for i := range corpus.index {
+		corpus.index[i] = binary.BigEndian.Uint32(footer[i*4:])
+		if i > 0 && corpus.index[i] < corpus.index[i-1] {
+			return nil, ErrInvalidCorpus
+		}
+	}
+
+	if int64(corpus.index[bucketCount])*recordSize+footerSize != size {
+		return nil, ErrInvalidCorpus
+	}
+
+	return corpus, nil
+}
+
+// Len returns the number of hashes in the corpus.
+func (c *Corpus) Len() uint64 {
+	return uint64(c.index[bucketCount])
+}
+
+// Count returns how often the password has been seen in breaches, it is 0 if the password is not in the corpus.
+func (c *Corpus) Count(password string) (int, error) {
+	return c.CountHash(sha1.Sum([]byte(password)))
+}
+
+func (c *Corpus) CountHash(hash [HashSize]byte) (int, error) {
+	bucket := int(binary.BigEndian.Uint16(hash[:bucketBytes]))
+	low := int64(c.index[bucket])
+	high := int64(c.index[bucket+1])
+
+	var record [recordSize]byte
+	for low < high {
+		middle := low + (high-low)/2
+		if _, err := c.r.ReadAt(record[:], middle*recordSize); err != nil {
+			return 0, err
+		}
+
+		switch bytes.Compare(record[:recordHashSize], hash[bucketBytes:]) {
+		case 0:
+			return int(binary.BigEndian.Uint32(record[recordHashSize:])), nil
+		case -1:
+			low = middle + 1
+		default:
+			high = middle
+		}
+	}
+
+	return 0, nil
+}
+
+func (c *Corpus) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
@@ -0,0 +1,167 @@
+package breachcorpus
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func hashLines(counts map[string]int) string {
+	lines := make([]string, 0, len(counts))
+	for password, count := range counts {
+		lines = append(lines, fmt.Sprintf("%X:%d", sha1.Sum([]byte(password)), count))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\r\n")
+}
+
+func buildCorpus(t *testing.T, lines string) *Corpus {
+	var buffer bytes.Buffer
+	builder := NewBuilder(&buffer)
+	assert.NoError(t, builder.AddLines(strings.NewReader(lines), ""))
+	assert.NoError(t, builder.Finish())
+
+	corpus, err := NewCorpus(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.NoError(t, err)
+	return corpus
+}
+
+func TestCorpus_CountsBreachedPasswords(t *testing.T) {
+	// arrange
+	corpus := buildCorpus(t, hashLines(map[string]int{
+		"password":  9545824,
+		"123456":    37359195,
+		"hunter2":   28542,
+		"letmein":   1,
+		"qwertyuio": 75,
+	}))
+
+	// act
+	count, err := corpus.Count("hunter2")
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, 28542, count)
+	assert.Equal(t, uint64(5), corpus.Len())
+}
+
+func TestCorpus_ReturnsZeroForUnknownPasswords(t *testing.T) {
+	// arrange
+	corpus := buildCorpus(t, hashLines(map[string]int{
+		"password": 9545824,
+		"123456":   37359195,
+	}))
+
+	// act
+	count, err := corpus.Count("correct horse battery staple")
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestCorpus_FindsEveryHashOfALargeCorpus(t *testing.T) {
+	// arrange
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		counts[fmt.Sprintf("password%d", i)] = i + 1
+	}
+	corpus := buildCorpus(t, hashLines(counts))
+
+	// act & assert
+	for password, expected := range counts {
+		count, err := corpus.Count(password)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, count)
+	}
+}
+
+func TestCorpus_CountsHashesOfTheFirstAndLastPrefix(t *testing.T) {
+	// arrange
+	first := [HashSize]byte{}
+	last := [HashSize]byte{}
+	for i := range last {
+		last[i] = 0xFF
+	}
+	corpus := buildCorpus(t, fmt.Sprintf("%X:3\n%X:7", first, last))
+
+	// act
+	firstCount, firstErr := corpus.CountHash(first)
+	lastCount, lastErr := corpus.CountHash(last)
+
+	// assert
+	assert.NoError(t, firstErr)
+	assert.NoError(t, lastErr)
+	assert.Equal(t, 3, firstCount)
+	assert.Equal(t, 7, lastCount)
+}
+
+func TestBuilder_AcceptsRangeFormat(t *testing.T) {
+	// arrange
+	hash := fmt.Sprintf("%X", sha1.Sum([]byte("password")))
+	var buffer bytes.Buffer
+	builder := NewBuilder(&buffer)
+
+	// act
+	err := builder.AddLines(strings.NewReader(hash[RangePrefixLength:]+":42\n"), hash[:RangePrefixLength])
+	assert.NoError(t, err)
+	assert.NoError(t, builder.Finish())
+
+	// assert
+	corpus, err := NewCorpus(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.NoError(t, err)
+	count, err := corpus.Count("password")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, count)
+}
+
+func TestBuilder_AcceptsHashesWithoutCount(t *testing.T) {
+	// arrange
+	lines := strings.ToLower(fmt.Sprintf("%X", sha1.Sum([]byte("password"))))
+
+	// act
+	corpus := buildCorpus(t, lines)
+
+	// assert
+	count, err := corpus.Count("password")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestBuilder_RejectsUnsortedHashes(t *testing.T) {
+	// arrange
+	builder := NewBuilder(&bytes.Buffer{})
+	lines := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n0000000000000000000000000000000000000000:1"
+
+	// act
+	err := builder.AddLines(strings.NewReader(lines), "")
+
+	// assert
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestBuilder_RejectsInvalidLines(t *testing.T) {
+	// arrange
+	builder := NewBuilder(&bytes.Buffer{})
+
+	// act
+	err := builder.AddLines(strings.NewReader("not a hash:1"), "")
+
+	// assert
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestNewCorpus_RejectsInvalidFiles(t *testing.T) {
+	// arrange
+	data := bytes.Repeat([]byte{0}, footerSize+recordSize)
+
+	// act
+	_, err := NewCorpus(bytes.NewReader(data), int64(len(data)))
+
+	// assert
+	assert.ErrorIs(t, err, ErrInvalidCorpus)
+}
@@ -0,0 +1,173 @@
+package broker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"holvit/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProviderMetadata is the part of the discovery document of an upstream provider the broker needs.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type AuthorizationParams struct {
+	ClientId     string
+	RedirectUri  string
+	Scopes       []string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+type TokenRequest struct {
+	ClientId     string
+	ClientSecret string
+	Code         string
+	RedirectUri  string
+	CodeVerifier string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+}
+
+// Discover fetches the discovery document of the issuer and makes sure it belongs to the issuer.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*ProviderMetadata, error) {
+	discoveryUrl := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	var metadata ProviderMetadata
+	err := getJson(ctx, client, discoveryUrl, "", &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover issuer %s: %w", issuer, err)
+	}
+
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document of %s belongs to issuer %s", issuer, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, fmt.Errorf("discovery document of %s is incomplete", issuer)
+	}
+
+	return &metadata, nil
+}
+
+// NewCodeVerifier creates a random PKCE code verifier.
+// 33 bytes encode to 44 characters without padding, which only uses characters allowed by RFC 7636.
+func NewCodeVerifier() string {
+	return utils.GenerateRandomStringBase64(33)
+}
+
+// CodeChallenge derives the S256 PKCE code challenge of a code verifier.
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthorizationUrl builds the url the user is sent to for signing in at the upstream provider.
+func AuthorizationUrl(metadata *ProviderMetadata, params AuthorizationParams) (string, error) {
+	authorizationUrl, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := authorizationUrl.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", params.ClientId)
+	query.Set("redirect_uri", params.RedirectUri)
+	query.Set("scope", strings.Join(params.Scopes, " "))
+	query.Set("state", params.State)
+	query.Set("nonce", params.Nonce)
+	query.Set("code_challenge", CodeChallenge(params.CodeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authorizationUrl.RawQuery = query.Encode()
+
+	return authorizationUrl.String(), nil
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint of the upstream provider.
+func ExchangeCode(ctx context.Context, client *http.Client, metadata *ProviderMetadata, request TokenRequest) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", request.Code)
+	form.Set("redirect_uri", request.RedirectUri)
+	form.Set("code_verifier", request.CodeVerifier)
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpRequest.Header.Set("Accept", "application/json")
+	httpRequest.SetBasicAuth(url.QueryEscape(request.ClientId), url.QueryEscape(request.ClientSecret))
+
+	response, err := client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.PanicOnErr(response.Body.Close)
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("token endpoint returned %d: %s", response.StatusCode, string(body))
+	}
+
+	var tokenResponse TokenResponse
+	err = json.NewDecoder(response.Body).Decode(&tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResponse.IdToken == "" {
+		return nil, errors.New("token response does not contain an id token")
+	}
+
+	return &tokenResponse, nil
+}
+
+// FetchUserInfo requests the claims of the user from the userinfo endpoint of the upstream provider.
+func FetchUserInfo(ctx context.Context, client *http.Client, metadata *ProviderMetadata, accessToken string) (Claims, error) {
+	var claims Claims
+	err := getJson(ctx, client, metadata.UserInfoEndpoint, accessToken, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch userinfo: %w", err)
+	}
+	return claims, nil
+}
+
+func getJson(ctx context.Context, client *http.Client, url string, accessToken string, target interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer utils.PanicOnErr(response.Body.Close)
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
@@ -0,0 +1,291 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+
+	receivedForm     url.Values
+	receivedUser     string
+	receivedPassword string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	provider := &mockProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, ProviderMetadata{
+			Issuer:                provider.server.URL,
+			AuthorizationEndpoint: provider.server.URL + "/authorize",
+			TokenEndpoint:         provider.server.URL + "/token",
+			UserInfoEndpoint:      provider.server.URL + "/userinfo",
+			JwksUri:               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, Jwks{Keys: []Jwk{{
+			Kty: "RSA",
+			Kid: "test",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		provider.receivedForm = r.PostForm
+		provider.receivedUser, provider.receivedPassword, _ = r.BasicAuth()
+		writeJson(w, TokenResponse{
+			AccessToken: "access",
+			TokenType:   "Bearer",
+			IdToken:     provider.sign(t, provider.claims),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJson(w, map[string]interface{}{
+			"sub":   "upstream-user",
+			"email": "user@example.com",
+		})
+	})
+
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (p *mockProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(p.key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func (p *mockProvider) validClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   p.server.URL,
+		"sub":   "upstream-user",
+		"aud":   "holvit",
+		"exp":   now.Add(time.Minute).Unix(),
+		"iat":   now.Unix(),
+		"nonce": "nonce",
+	}
+}
+
+func Test_Discover(t *testing.T) {
+	// arrange
+	provider := newMockProvider(t)
+
+	// act
+	metadata, err := Discover(context.Background(), provider.server.Client(), provider.server.URL)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, provider.server.URL+"/token", metadata.TokenEndpoint)
+}
+
+func Test_Discover_IssuerMismatch(t *testing.T) {
+	// arrange
+	provider := newMockProvider(t)
+
+	// act
+	_, err := Discover(context.Background(), provider.server.Client(), provider.server.URL+"/")
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_AuthorizationUrl(t *testing.T) {
+	// arrange
+	metadata := &ProviderMetadata{AuthorizationEndpoint: "https://upstream.example.com/authorize?prompt=login"}
+
+	// act
+	authorizationUrl, err := AuthorizationUrl(metadata, AuthorizationParams{
+		ClientId:     "holvit",
+		RedirectUri:  "https://holvit.example.com/callback",
+		Scopes:       []string{"openid", "email"},
+		State:        "state",
+		Nonce:        "nonce",
+		CodeVerifier: "verifier",
+	})
+
+	// assert
+	assert.NoError(t, err)
+	parsed, err := url.Parse(authorizationUrl)
+	assert.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, "login", query.Get("prompt"))
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "openid email", query.Get("scope"))
+	assert.Equal(t, CodeChallenge("verifier"), query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+}
+
+func Test_CodeChallenge(t *testing.T) {
+	// arrange
+	// the example of https://datatracker.ietf.org/doc/html/rfc7636#appendix-B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	// act
+	challenge := CodeChallenge(verifier)
+
+	// assert
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", challenge)
+}
+
+func Test_NewCodeVerifier(t *testing.T) {
+	// act
+	verifier := NewCodeVerifier()
+
+	// assert
+	assert.Len(t, verifier, 44)
+	assert.NotContains(t, verifier, "=")
+}
+
+func Test_ExchangeCode_And_VerifyIdToken(t *testing.T) {
+	// arrange
+	provider := newMockProvider(t)
+	now := time.Now()
+	provider.claims = provider.validClaims(now)
+	client := provider.server.Client()
+	ctx := context.Background()
+	metadata, err := Discover(ctx, client, provider.server.URL)
+	assert.NoError(t, err)
+
+	// act
+	tokenResponse, err := ExchangeCode(ctx, client, metadata, TokenRequest{
+		ClientId:     "holvit",
+		ClientSecret: "secret",
+		Code:         "code",
+		RedirectUri:  "https://holvit.example.com/callback",
+		CodeVerifier: "verifier",
+	})
+	assert.NoError(t, err)
+	jwks, err := FetchJwks(ctx, client, metadata)
+	assert.NoError(t, err)
+	claims, err := VerifyIdToken(tokenResponse.IdToken, jwks, IdTokenExpectations{
+		Issuer:   provider.server.URL,
+		ClientId: "holvit",
+		Nonce:    "nonce",
+		Now:      now,
+	})
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "upstream-user", claims.String("sub"))
+	assert.Equal(t, "holvit", provider.receivedUser)
+	assert.Equal(t, "secret", provider.receivedPassword)
+	assert.Equal(t, "code", provider.receivedForm.Get("code"))
+	assert.Equal(t, "verifier", provider.receivedForm.Get("code_verifier"))
+}
+
+func Test_VerifyIdToken_Invalid(t *testing.T) {
+	provider := newMockProvider(t)
+	now := time.Now()
+	jwks := &Jwks{Keys: []Jwk{{
+		Kty: "RSA",
+		Kid: "test",
+		N:   base64.RawURLEncoding.EncodeToString(provider.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(provider.key.E)).Bytes()),
+	}}}
+	expectations := IdTokenExpectations{
+		Issuer:   provider.server.URL,
+		ClientId: "holvit",
+		Nonce:    "nonce",
+		Now:      now,
+	}
+
+	tests := map[string]func(claims jwt.MapClaims){
+		"wrong issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		"wrong audience": func(claims jwt.MapClaims) { claims["aud"] = "other" },
+		"expired":        func(claims jwt.MapClaims) { claims["exp"] = now.Add(-time.Minute).Unix() },
+		"missing exp":    func(claims jwt.MapClaims) { delete(claims, "exp") },
+		"wrong nonce":    func(claims jwt.MapClaims) { claims["nonce"] = "other" },
+		"wrong azp":      func(claims jwt.MapClaims) { claims["azp"] = "other" },
+		"missing sub":    func(claims jwt.MapClaims) { delete(claims, "sub") },
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			// arrange
+			claims := provider.validClaims(now)
+			modify(claims)
+			idToken := provider.sign(t, claims)
+
+			// act
+			_, err := VerifyIdToken(idToken, jwks, expectations)
+
+			// assert
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_VerifyIdToken_WrongKey(t *testing.T) {
+	// arrange
+	provider := newMockProvider(t)
+	other := newMockProvider(t)
+	now := time.Now()
+	idToken := other.sign(t, provider.validClaims(now))
+	jwks := &Jwks{Keys: []Jwk{{
+		Kty: "RSA",
+		Kid: "test",
+		N:   base64.RawURLEncoding.EncodeToString(provider.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(provider.key.E)).Bytes()),
+	}}}
+
+	// act
+	_, err := VerifyIdToken(idToken, jwks, IdTokenExpectations{
+		Issuer:   provider.server.URL,
+		ClientId: "holvit",
+		Nonce:    "nonce",
+		Now:      now,
+	})
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_FetchUserInfo(t *testing.T) {
+	// arrange
+	provider := newMockProvider(t)
+	ctx := context.Background()
+	metadata, err := Discover(ctx, provider.server.Client(), provider.server.URL)
+	assert.NoError(t, err)
+
+	// act
+	claims, err := FetchUserInfo(ctx, provider.server.Client(), metadata, "access")
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.com", claims.String("email"))
+}
@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"fmt"
+	"maps"
+)
+
+const (
+	AttributeUsername = "username"
+	AttributeEmail    = "email"
+)
+
+// DefaultClaimMappings maps the attributes of a user to the standard claims of OpenID Connect.
+var DefaultClaimMappings = map[string]string{
+	AttributeUsername: "preferred_username",
+	AttributeEmail:    "email",
+}
+
+// Attributes are the attributes of a user taken from the claims of an upstream provider.
+type Attributes struct {
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+// Merge adds the claims of other that are not present in c, the claims of c take precedence.
+func (c Claims) Merge(other Claims) Claims {
+	result := maps.Clone(other)
+	if result == nil {
+		result = Claims{}
+	}
+	maps.Copy(result, c)
+	return result
+}
+
+func (c Claims) String(name string) string {
+	switch value := c[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Bool reads a boolean claim, some providers send booleans as strings.
+func (c Claims) Bool(name string) bool {
+	switch value := c[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
+
+// MapClaims maps the claims of an upstream provider to the attributes of a user.
+// The mappings map attribute names to claim names, attributes without a mapping use DefaultClaimMappings.
+// A user without a username claim is named after the subject.
+func MapClaims(mappings map[string]string, claims Claims) Attributes {
+	claimName := func(attribute string) string {
+		if name, ok := mappings[attribute]; ok && name != "" {
+			return name
+		}
+		return DefaultClaimMappings[attribute]
+	}
+
+	attributes := Attributes{
+		Subject:       claims.String("sub"),
+		Username:      claims.String(claimName(AttributeUsername)),
+		Email:         claims.String(claimName(AttributeEmail)),
+		EmailVerified: claims.Bool("email_verified"),
+	}
+
+	if attributes.Username == "" {
+		attributes.Username = attributes.Subject
+	}
+
+	return attributes
+}
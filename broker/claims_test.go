@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_MapClaims_Defaults(t *testing.T) {
+	// arrange
+	claims := Claims{
+		"sub":                "123",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+	}
+
+	// act
+	attributes := MapClaims(nil, claims)
+
+	// assert
+	assert.Equal(t, Attributes{
+		Subject:       "123",
+		Username:      "alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+	}, attributes)
+}
+
+func Test_MapClaims_CustomMapping(t *testing.T) {
+	// arrange
+	claims := Claims{
+		"sub":            "123",
+		"login":          "alice",
+		"mail":           "alice@example.com",
+		"email_verified": "true",
+	}
+	mappings := map[string]string{
+		AttributeUsername: "login",
+		AttributeEmail:    "mail",
+	}
+
+	// act
+	attributes := MapClaims(mappings, claims)
+
+	// assert
+	assert.Equal(t, "alice", attributes.Username)
+	assert.Equal(t, "alice@example.com", attributes.Email)
+	assert.True(t, attributes.EmailVerified)
+}
+
+func Test_MapClaims_UsernameFallsBackToSubject(t *testing.T) {
+	// arrange
+	claims := Claims{
+		"sub": "123",
+	}
+
+	// act
+	attributes := MapClaims(nil, claims)
+
+	// assert
+	assert.Equal(t, "123", attributes.Username)
+	assert.Equal(t, "", attributes.Email)
+	assert.False(t, attributes.EmailVerified)
+}
+
+func Test_Claims_Merge(t *testing.T) {
+	// arrange
+	idTokenClaims := Claims{"sub": "123", "email": "id@example.com"}
+	userInfoClaims := Claims{"sub": "123", "email": "userinfo@example.com", "name": "Alice"}
+
+	// act
+	merged := idTokenClaims.Merge(userInfoClaims)
+
+	// assert
+	assert.Equal(t, "id@example.com", merged.String("email"))
+	assert.Equal(t, "Alice", merged.String("name"))
+}
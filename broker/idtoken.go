@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Claims are the claims of an id token or userinfo response of an upstream provider.
+type Claims map[string]interface{}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+type IdTokenExpectations struct {
+	Issuer   string
+	ClientId string
+	Nonce    string
+	Now      time.Time
+}
+
+// FetchJwks downloads the signing keys of the upstream provider.
+func FetchJwks(ctx context.Context, client *http.Client, metadata *ProviderMetadata) (*Jwks, error) {
+	var jwks Jwks
+	err := getJson(ctx, client, metadata.JwksUri, "", &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch jwks: %w", err)
+	}
+	return &jwks, nil
+}
+
+// PublicKey converts the key to a public key usable for signature verification.
+func (k Jwk) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (j *Jwks) findKey(kid string) (crypto.PublicKey, error) {
+	for _, key := range j.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		// providers with a single key do not always set a key id
+		if kid == "" || key.Kid == kid {
+			return key.PublicKey()
+		}
+	}
+	return nil, fmt.Errorf("no signing key with id '%s'", kid)
+}
+
+// VerifyIdToken checks the signature and the claims of an id token as described in
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+func VerifyIdToken(idToken string, jwks *Jwks, expectations IdTokenExpectations) (Claims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(expectations.Issuer),
+		jwt.WithAudience(expectations.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return expectations.Now }),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return jwks.findKey(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if nonce, _ := claims["nonce"].(string); nonce != expectations.Nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	// an id token with multiple audiences has to be issued to the client it is meant for
+	if azp, ok := claims["azp"].(string); ok && azp != expectations.ClientId {
+		return nil, errors.New("invalid id token: authorized party mismatch")
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, errors.New("invalid id token: missing subject")
+	}
+
+	return Claims(claims), nil
+}
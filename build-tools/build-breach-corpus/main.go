@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"holvit/breachcorpus"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Builds the breach corpus used by the breached password rule of the password policy.
+// The input is either a single file with lines in the format HASH:COUNT sorted by hash,
+// or a directory of files in the HIBP range format, named after the hash prefix (e.g. 21BD1.txt).
+func main() {
+	var input string
+	var outputFile string
+
+	flag.StringVar(&input, "i", "", "input file or directory of range files")
+	flag.StringVar(&outputFile, "o", "", "output file")
+	flag.Parse()
+
+	if input == "" {
+		panic("missing input (-i)")
+	}
+
+	if outputFile == "" {
+		panic("missing output file (-o)")
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		panic(err)
+	}
+
+	// write to a temporary file first, a running server must never see a partially written corpus
+	tempFile := outputFile + ".tmp"
+	output, err := os.Create(tempFile)
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tempFile)
+
+	builder := breachcorpus.NewBuilder(output)
+
+	if info.IsDir() {
+		err = addRangeFiles(builder, input)
+	} else {
+		err = addFile(builder, input, "")
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	err = builder.Finish()
+	if err != nil {
+		panic(err)
+	}
+
+	err = output.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.Rename(tempFile, outputFile)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("wrote %d hashes to %s\n", builder.Len(), outputFile)
+}
+
+func addRangeFiles(builder *breachcorpus.Builder, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var prefixes []string
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		prefix := strings.ToUpper(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if len(prefix) != breachcorpus.RangePrefixLength {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+		files[prefix] = filepath.Join(dir, entry.Name())
+	}
+
+	if len(prefixes) == 0 {
+		return fmt.Errorf("no range files found in %s", dir)
+	}
+
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		err := addFile(builder, files[prefix], prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFile(builder *breachcorpus.Builder, path string, prefix string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = builder.AddLines(file, prefix)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
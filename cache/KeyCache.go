@@ -2,6 +2,7 @@ package cache
 
 import (
 	"crypto/ed25519"
+	"crypto/rsa"
 	"github.com/google/uuid"
 	"sync"
 )
@@ -9,16 +10,21 @@ import (
 type KeyCache interface {
 	Set(realmID uuid.UUID, key ed25519.PrivateKey)
 	Get(realmID uuid.UUID) (ed25519.PrivateKey, bool)
+	// SetRsa stores the RSA key of a realm, it is used to sign SAML responses.
+	SetRsa(realmID uuid.UUID, key *rsa.PrivateKey)
+	GetRsa(realmID uuid.UUID) (*rsa.PrivateKey, bool)
 }
 
 type InMemoryKeyCache struct {
-	mu    sync.RWMutex
-	cache map[uuid.UUID]ed25519.PrivateKey
+	mu       sync.RWMutex
+	cache    map[uuid.UUID]ed25519.PrivateKey
+	rsaCache map[uuid.UUID]*rsa.PrivateKey
 }
 
 func NewInMemoryKeyCache() *InMemoryKeyCache {
 	return &InMemoryKeyCache{
-		cache: make(map[uuid.UUID]ed25519.PrivateKey),
+		cache:    make(map[uuid.UUID]ed25519.PrivateKey),
+		rsaCache: make(map[uuid.UUID]*rsa.PrivateKey),
 	}
 }
 
@@ -34,3 +40,16 @@ func (kc *InMemoryKeyCache) Get(realmID uuid.UUID) (ed25519.PrivateKey, bool) {
 	key, found := kc.cache[realmID]
 	return key, found
 }
+
+func (kc *InMemoryKeyCache) SetRsa(realmID uuid.UUID, key *rsa.PrivateKey) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.rsaCache[realmID] = key
+}
+
+func (kc *InMemoryKeyCache) GetRsa(realmID uuid.UUID) (*rsa.PrivateKey, bool) {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+	key, found := kc.rsaCache[realmID]
+	return key, found
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/realmexport"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/services"
+	"holvit/userimport"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runCommand runs a command instead of the server and returns the exit code, e.g. `holvit -c config.yml import-users -realm demo users.jsonl`.
+func runCommand(dp *ioc.DependencyProvider, args []string) int {
+	switch args[0] {
+	case "import-users":
+		return importUsersCommand(dp, args[1:])
+	case "export-realm":
+		return exportRealmCommand(dp, args[1:])
+	case "import-realm":
+		return importRealmCommand(dp, args[1:])
+	case "reconcile-realms":
+		return reconcileRealmsCommand(dp, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s', available commands: import-users, export-realm, import-realm, reconcile-realms\n", args[0])
+		return 2
+	}
+}
+
+func importUsersCommand(dp *ioc.DependencyProvider, args []string) int {
+	flags := flag.NewFlagSet("import-users", flag.ExitOnError)
+	realmName := flags.String("realm", "", "name of the realm the users are imported into")
+	format := flags.String("format", userimport.FormatJsonLines, "format of the import file, jsonl or csv")
+	_ = flags.Parse(args)
+
+	if *realmName == "" || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import-users -realm <name> [-format jsonl|csv] <file>")
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	reader, err := userimport.NewReader(file, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	exitCode := 0
+	requestContext.RunWithScope(dp, context.Background(), func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+
+		realmRepository := ioc.Get[repos.RealmRepository](scope)
+		realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+			Name: h.Some(*realmName),
+		}).SingleOrNone().Get()
+		if !ok {
+			fmt.Fprintf(os.Stderr, "realm '%s' not found\n", *realmName)
+			exitCode = 1
+			return
+		}
+
+		userImportService := ioc.Get[services.UserImportService](scope)
+		response, err := userImportService.ImportUsers(ctx, services.ImportUsersRequest{
+			RealmId: realm.Id,
+			Reader:  reader,
+		})
+
+		for _, rowError := range response.Errors {
+			fmt.Fprintf(os.Stderr, "row %d (%s): %s\n", rowError.Row, rowError.Username, rowError.Message)
+		}
+		fmt.Printf("created %d, skipped %d, failed %d users\n", response.Created, response.Skipped, response.Failed)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "the import was aborted: %v\n", err)
+			exitCode = 1
+		} else if response.Failed > 0 {
+			exitCode = 1
+		}
+	})
+
+	return exitCode
+}
+
+func exportRealmCommand(dp *ioc.DependencyProvider, args []string) int {
+	flags := flag.NewFlagSet("export-realm", flag.ExitOnError)
+	realmName := flags.String("realm", "", "name of the exported realm")
+	includeUsers := flags.Bool("users", false, "include the users and their password hashes")
+	output := flags.String("o", "", "file the realm is written to, defaults to stdout")
+	_ = flags.Parse(args)
+
+	if *realmName == "" || flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: export-realm -realm <name> [-users] [-o <file>]")
+		return 2
+	}
+
+	var document h.Opt[realmexport.Document]
+	requestContext.RunWithScope(dp, context.Background(), func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+
+		realmRepository := ioc.Get[repos.RealmRepository](scope)
+		realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+			Name: h.Some(*realmName),
+		}).SingleOrNone().Get()
+		if !ok {
+			return
+		}
+
+		realmExportService := ioc.Get[services.RealmExportService](scope)
+		document = h.Some(realmExportService.ExportRealm(ctx, realm.Id, *includeUsers))
+	})
+
+	exported, ok := document.Get()
+	if !ok {
+		fmt.Fprintf(os.Stderr, "realm '%s' not found\n", *realmName)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(exported); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func importRealmCommand(dp *ioc.DependencyProvider, args []string) int {
+	flags := flag.NewFlagSet("import-realm", flag.ExitOnError)
+	policy := flags.String("policy", realmexport.PolicyCreate, "how existing objects are handled, one of "+strings.Join(realmexport.Policies, ", "))
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: import-realm [-policy %s] <file>\n", strings.Join(realmexport.Policies, "|"))
+		return 2
+	}
+
+	content, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var document realmexport.Document
+	if err := json.Unmarshal(content, &document); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid realm document: %v\n", err)
+		return 1
+	}
+
+	exitCode := 0
+	requestContext.RunWithScope(dp, context.Background(), func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+
+		// the service marks the transaction as failed on errors, nothing is committed then
+		realmExportService := ioc.Get[services.RealmExportService](scope)
+		result := realmExportService.ImportRealm(ctx, services.ImportRealmRequest{
+			Document: document,
+			Policy:   *policy,
+		})
+		if result.IsErr() {
+			fmt.Fprintf(os.Stderr, "the import failed: %v\n", result.UnwrapErr())
+			exitCode = 1
+			return
+		}
+
+		response := result.Unwrap()
+		fmt.Printf("imported realm '%s' (%s)\n", document.Realm.Name, response.RealmId)
+
+		clientIds := make([]string, 0, len(response.ClientSecrets))
+		for clientId := range response.ClientSecrets {
+			clientIds = append(clientIds, clientId)
+		}
+		sort.Strings(clientIds)
+		for _, clientId := range clientIds {
+			fmt.Printf("generated secret of client '%s': %s\n", clientId, response.ClientSecrets[clientId])
+		}
+	})
+
+	return exitCode
+}
+
+func reconcileRealmsCommand(dp *ioc.DependencyProvider, args []string) int {
+	flags := flag.NewFlagSet("reconcile-realms", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only print the changes without applying them")
+	_ = flags.Parse(args)
+
+	realmConfigService := ioc.Get[services.RealmConfigService](dp)
+	realmsResult := realmConfigService.LoadDeclaredRealms()
+	if realmsResult.IsErr() {
+		fmt.Fprintf(os.Stderr, "invalid realm declarations: %v\n", realmsResult.UnwrapErr())
+		return 1
+	}
+
+	realms := realmsResult.Unwrap()
+	if len(realms) == 0 {
+		fmt.Fprintln(os.Stderr, "no realms are declared, set Realms.ConfigPath in the config")
+		return 1
+	}
+
+	exitCode := 0
+	requestContext.RunWithScope(dp, context.Background(), func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+
+		result := ioc.Get[services.RealmConfigService](scope).ReconcileRealms(ctx, services.ReconcileRealmsRequest{
+			Realms: realms,
+			DryRun: *dryRun,
+		})
+		if result.IsErr() {
+			fmt.Fprintf(os.Stderr, "the reconciliation failed: %v\n", result.UnwrapErr())
+			exitCode = 1
+			return
+		}
+
+		response := result.Unwrap()
+		if len(response.Changes) == 0 {
+			fmt.Println("the realms match their declarations")
+			return
+		}
+
+		for _, change := range response.Changes {
+			fmt.Println(change.String())
+		}
+
+		for _, secret := range response.ClientSecrets {
+			fmt.Printf("generated secret of client '%s' in realm '%s': %s\n", secret.ClientId, secret.Realm, secret.Secret)
+		}
+	})
+
+	return exitCode
+}
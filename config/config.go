@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/viper"
 	"holvit/constants"
 	"holvit/utils"
+	"net/netip"
 	"time"
 )
 
@@ -36,6 +37,79 @@ type HolvitConfig struct {
 		Skew   uint
 	}
 
+	Tokens struct {
+		AccessTokenLifetime  time.Duration
+		IdTokenLifetime      time.Duration
+		RefreshTokenLifetime time.Duration
+	}
+
+	Saml struct {
+		AssertionLifetime time.Duration
+		// RequestMaxAge limits how old a signed AuthnRequest can be, it includes the time the user needs to sign in.
+		RequestMaxAge time.Duration
+	}
+
+	Ciba struct {
+		RequestExpiry time.Duration
+		PollInterval  time.Duration
+	}
+
+	Broker struct {
+		RequestTimeout time.Duration
+	}
+
+	Ldap struct {
+		Timeout time.Duration
+	}
+
+	Webauthn struct {
+		Timeout time.Duration
+	}
+
+	EmailLogin struct {
+		Expiry      time.Duration
+		MaxAttempts int
+		// ResendInterval is the time between two codes or links, both for the same login and for the same email.
+		ResendInterval time.Duration
+	}
+
+	Registration struct {
+		Expiry      time.Duration
+		MaxAttempts int
+	}
+
+	PasswordReset struct {
+		Expiry time.Duration
+	}
+
+	DeviceVerification struct {
+		Expiry         time.Duration
+		MaxAttempts    int
+		ResendInterval time.Duration
+	}
+
+	EmailVerification struct {
+		LinkExpiry     time.Duration
+		ResendInterval time.Duration
+	}
+
+	BruteForce struct {
+		// FailureResetInterval is how long failed attempts are counted after the last one.
+		FailureResetInterval time.Duration
+	}
+
+	BreachedPasswords struct {
+		// CorpusPath is the breach corpus built with build-tools/build-breach-corpus, breached passwords are not checked without it.
+		CorpusPath string
+	}
+
+	Realms struct {
+		// ConfigPath is a yaml file or a directory of yaml files declaring realms, see the realmconfig package.
+		ConfigPath string
+		// ReconcileOnStartup applies the declared realms on every start, otherwise only on the first start of an empty database.
+		ReconcileOnStartup bool
+	}
+
 	Server struct {
 		Host            string
 		Port            int
@@ -43,6 +117,13 @@ type HolvitConfig struct {
 		ReadTimeout     time.Duration
 		ShutdownTimeout time.Duration
 		MaxReadBytes    int64
+		// MaxImportBytes is the limit of the request body of user imports, they are usually much bigger than other requests.
+		MaxImportBytes int64
+		// ImportTimeout replaces the read and write timeouts for user imports.
+		ImportTimeout time.Duration
+		// TrustedProxies are the addresses or CIDR ranges of the reverse proxies in front of the server.
+		// The X-Forwarded-For and X-Real-Ip headers are ignored unless the request comes from one of them.
+		TrustedProxies []string
 	}
 
 	UseMailServer bool
@@ -76,6 +157,7 @@ type HolvitConfig struct {
 	Crons struct {
 		JobScheduler   string
 		SessionCleanup string
+		LdapSync       string
 	}
 }
 
@@ -115,6 +197,28 @@ func (c *HolvitConfig) getHashSettings() utils.HashSettings {
 	}
 }
 
+var trustedProxies []netip.Prefix
+
+func (c *HolvitConfig) GetTrustedProxies() []netip.Prefix {
+	return trustedProxies
+}
+
+func (c *HolvitConfig) parseTrustedProxies() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(c.Server.TrustedProxies))
+	for _, proxy := range c.Server.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				panic(fmt.Errorf("trusted proxy '%s' is neither an address nor a CIDR range", proxy))
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
 func (c *HolvitConfig) GetSymmetricEncryptionKey() []byte {
 	return utils.GenerateSymmetricKeyFromText(C.Secret)
 }
@@ -128,11 +232,13 @@ func Init() {
 	readConfigValues()
 	validateConfig()
 	hasher = C.getHashSettings().MakeHasher()
+	trustedProxies = C.parseTrustedProxies()
 }
 
 func readFlags() {
 	flag.StringVar(&configFilePath, "config", "./config.yml", "config file path")
 	flag.StringVar(&configFilePath, "c", "./config.yml", "config file path (shorthand)")
+	flag.Parse()
 }
 
 func setDefaultConfigValues() {
@@ -162,6 +268,42 @@ func setDefaultConfigValues() {
 
 	C.AdminUserName = "admin"
 
+	C.Tokens.AccessTokenLifetime = time.Hour
+	C.Tokens.IdTokenLifetime = time.Hour
+	C.Tokens.RefreshTokenLifetime = time.Hour
+
+	C.Saml.AssertionLifetime = 5 * time.Minute
+	C.Saml.RequestMaxAge = 10 * time.Minute
+
+	C.Ciba.RequestExpiry = 5 * time.Minute
+	C.Ciba.PollInterval = 5 * time.Second
+
+	C.Broker.RequestTimeout = 10 * time.Second
+
+	C.Ldap.Timeout = 10 * time.Second
+
+	C.Webauthn.Timeout = 5 * time.Minute
+
+	C.EmailLogin.Expiry = 10 * time.Minute
+	C.EmailLogin.MaxAttempts = 5
+	C.EmailLogin.ResendInterval = time.Minute
+
+	C.Registration.Expiry = 30 * time.Minute
+	C.Registration.MaxAttempts = 5
+
+	C.PasswordReset.Expiry = time.Hour
+
+	C.DeviceVerification.Expiry = 15 * time.Minute
+	C.DeviceVerification.MaxAttempts = 5
+	C.DeviceVerification.ResendInterval = time.Minute
+
+	C.EmailVerification.LinkExpiry = 24 * time.Hour
+	C.EmailVerification.ResendInterval = time.Minute
+
+	C.BruteForce.FailureResetInterval = 12 * time.Hour
+
+	C.Realms.ReconcileOnStartup = true
+
 	C.Server.Host = "0.0.0.0"
 	C.Server.Port = 8080
 
@@ -171,6 +313,8 @@ func setDefaultConfigValues() {
 	C.Server.ShutdownTimeout = 15 * time.Second
 
 	C.Server.MaxReadBytes = 1048576
+	C.Server.MaxImportBytes = 1024 * 1048576
+	C.Server.ImportTimeout = time.Hour
 
 	C.Database.Host = "localhost"
 	C.Database.Port = 5432
@@ -184,6 +328,7 @@ func setDefaultConfigValues() {
 	C.Redis.Protocol = 3
 
 	C.Crons.JobScheduler = "* * * * *"
+	C.Crons.LdapSync = "*/15 * * * *"
 }
 
 func readConfigValues() {
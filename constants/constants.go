@@ -11,11 +11,18 @@ func SessionCookieName(realmName string) string {
 
 const CredentialTypePassword = "password"
 const CredentialTypeTotp = "totp"
+const CredentialTypeWebauthn = "webauthn"
+const CredentialTypeRecoveryCodes = "recovery_codes"
 
 const QueuedJobSendMail = "send_mail"
 
 const ClaimMapperUserInfo = "user_info"
 const ClaimMapperRoles = "roles"
+const ClaimMapperGroups = "groups"
+
+const ClaimsTargetIdToken = "id_token"
+const ClaimsTargetUserInfo = "userinfo"
+const ClaimsTargetSaml = "saml"
 
 const UserInfoPropertyId = "id"
 const UserInfoPropertyEmail = "email"
@@ -32,23 +39,107 @@ const AuthorizationResponseTypeCode = "code"
 
 const TokenGrantTypeAuthorizationCode = "authorization_code"
 const TokenGrantTypeRefreshToken = "refresh_token"
+const TokenGrantTypeCiba = "urn:openid:params:grant-type:ciba"
+const TokenGrantTypeClientCredentials = "client_credentials"
+
+// ClientAccessTokenType is the jwt typ header of access tokens issued to a client itself, claim mappers cannot set headers.
+const ClientAccessTokenType = "client+at+jwt"
+
+const TokenEndpointAuthMethodNone = "none"
+const TokenEndpointAuthMethodClientSecretBasic = "client_secret_basic"
+const TokenEndpointAuthMethodClientSecretPost = "client_secret_post"
 
 const CodeChallengeMethodS256 = "S256"
 
+const ClientProtocolOidc = "openid-connect"
+const ClientProtocolSaml = "saml"
+
 const FrontendModeAuthenticate = "authenticate"
 const FrontendModeAuthorize = "authorize"
+const FrontendModeCiba = "ciba"
+const FrontendModeResetPassword = "reset_password"
+const FrontendModeEmailVerified = "email_verified"
+
+const CibaTokenDeliveryModePoll = "poll"
+
+const CibaStatusPending = "pending"
+const CibaStatusApproved = "approved"
+const CibaStatusDenied = "denied"
 
 const AuthenticateStepVerifyPassword = "verify_password"
 const AuthenticateStepVerifyEmail = "verify_email"
 const AuthenticateStepResetPassword = "reset_password"
 const AuthenticateStepTotpOnboarding = "totp_onboarding"
 const AuthenticateStepVerifyTotp = "verify_totp"
+const AuthenticateStepVerifyRecoveryCode = "verify_recovery_code"
+const AuthenticateStepVerifyEmailLogin = "verify_email_login"
+const AuthenticateStepVerifyRegistration = "verify_registration"
+const AuthenticateStepBrokerLogin = "broker_login"
+
+// AuthenticateStepApprovalPending is reported instead of a next step when a registration has to be approved by an admin.
+const AuthenticateStepApprovalPending = "approval_pending"
+const AuthenticateStepWebauthnOnboarding = "webauthn_onboarding"
+const AuthenticateStepVerifyWebauthn = "verify_webauthn"
 const AuthenticateStepVerifyDevice = "verify_device"
 const AuthenticateStepSubmit = "submit"
 
+// IdentificationSteps find out which user signs in, a login starts with one of them.
+var IdentificationSteps = []string{
+	AuthenticateStepVerifyPassword,
+	AuthenticateStepVerifyWebauthn,
+	AuthenticateStepVerifyEmailLogin,
+	AuthenticateStepVerifyRegistration,
+	AuthenticateStepBrokerLogin,
+}
+
+// AuthenticationFlowSteps are the steps an authentication flow can be built from.
+var AuthenticationFlowSteps = []string{
+	AuthenticateStepVerifyPassword,
+	AuthenticateStepVerifyWebauthn,
+	AuthenticateStepVerifyEmailLogin,
+	AuthenticateStepVerifyRegistration,
+	AuthenticateStepBrokerLogin,
+	AuthenticateStepVerifyEmail,
+	AuthenticateStepResetPassword,
+	AuthenticateStepTotpOnboarding,
+	AuthenticateStepVerifyTotp,
+	AuthenticateStepVerifyRecoveryCode,
+	AuthenticateStepWebauthnOnboarding,
+	AuthenticateStepVerifyDevice,
+}
+
+const AuthenticationFlowConditionUserHasTotp = "user_has_totp"
+const AuthenticationFlowConditionUserHasWebauthn = "user_has_webauthn"
+const AuthenticationFlowConditionKnownDevice = "known_device"
+const AuthenticationFlowConditionRememberMe = "remember_me"
+
+var AuthenticationFlowConditions = []string{
+	AuthenticationFlowConditionUserHasTotp,
+	AuthenticationFlowConditionUserHasWebauthn,
+	AuthenticationFlowConditionKnownDevice,
+	AuthenticationFlowConditionRememberMe,
+}
+
 const TotpSecretLength = 32
+const RecoveryCodeCount = 10
+
+const EmailLoginModeDisabled = "disabled"
+const EmailLoginModeCode = "code"
+const EmailLoginModeMagicLink = "magic_link"
+
+var EmailLoginModes = []string{EmailLoginModeDisabled, EmailLoginModeCode, EmailLoginModeMagicLink}
+
+const EmailLoginCodeLength = 6
+const DeviceVerificationCodeLength = 6
+
+const SecurityEventTemporaryLockout = "temporary_lockout"
+const SecurityEventPermanentLockout = "permanent_lockout"
+const SecurityEventIpLockout = "ip_lockout"
+const SecurityEventLockoutCleared = "lockout_cleared"
 
 const MasterRealmName = "admin"
+const AdminClientId = "holvit_admin"
 const SuperUserRoleName = "superuser"
+const ScimRoleName = "scim"
 
 const SqlErrorCodeRealmsDoNotMatch = "VV001"
@@ -0,0 +1,20 @@
+package crons
+
+import (
+	"context"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/services"
+)
+
+func LdapSync() {
+	requestContext.RunWithScope(ioc.RootScope, context.Background(), func(ctx context.Context) {
+		logging.Logger.Debug("Syncing ldap providers...")
+		scope := middlewares.GetScope(ctx)
+
+		ldapFederationService := ioc.Get[services.LdapFederationService](scope)
+		ldapFederationService.SyncAll(ctx)
+	})
+}
@@ -16,5 +16,8 @@ func SessionCleanup() {
 
 		sessionRepository := ioc.Get[repos.SessionRepository](scope)
 		sessionRepository.DeleteOldSessions(ctx)
+
+		passwordResetTokenRepository := ioc.Get[repos.PasswordResetTokenRepository](scope)
+		passwordResetTokenRepository.DeleteOldPasswordResetTokens(ctx)
 	})
 }
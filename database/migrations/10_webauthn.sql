@@ -0,0 +1,12 @@
+-- +migrate Up
+alter table "realms"
+    add column "require_webauthn" bool not null default false;
+
+create unique index "idx_unique_webauthn_credential_id" on "credentials" (("details" ->> 'credentialId'))
+    where type = 'webauthn';
+
+-- +migrate Down
+drop index "idx_unique_webauthn_credential_id";
+
+alter table "realms"
+    drop column "require_webauthn";
@@ -0,0 +1,6 @@
+-- +migrate Up
+create unique index "idx_only_one_recovery_codes_per_user" on "credentials" ("user_id", "type")
+    where type = 'recovery_codes';
+
+-- +migrate Down
+drop index "idx_only_one_recovery_codes_per_user";
@@ -0,0 +1,8 @@
+-- +migrate Up
+alter table "realms"
+    add column "email_login_mode" text not null default 'disabled'
+        constraint "chk_realm_email_login_mode" check ("email_login_mode" in ('disabled', 'code', 'magic_link'));
+
+-- +migrate Down
+alter table "realms"
+    drop column "email_login_mode";
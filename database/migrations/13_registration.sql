@@ -0,0 +1,17 @@
+-- +migrate Up
+alter table "realms"
+    add column "enable_registration" bool not null default false,
+    add column "registration_requires_approval" bool not null default false,
+    add column "default_role_ids" uuid[] not null default '{}';
+
+alter table "users"
+    add column "approval_pending" bool not null default false;
+
+-- +migrate Down
+alter table "users"
+    drop column "approval_pending";
+
+alter table "realms"
+    drop column "default_role_ids",
+    drop column "registration_requires_approval",
+    drop column "enable_registration";
@@ -0,0 +1,25 @@
+-- +migrate Up
+create table "password_reset_tokens"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "user_id"          uuid      not null,
+    "hashed_token"     text      not null,
+    "valid_until"      timestamp not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "password_reset_tokens"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_password_reset_token" on "password_reset_tokens" ("hashed_token");
+
+alter table "password_reset_tokens"
+    add constraint "fk_password_reset_tokens_users" foreign key ("user_id") references "users" on delete cascade;
+
+-- +migrate Down
+drop table "password_reset_tokens" cascade;
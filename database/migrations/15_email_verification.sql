@@ -0,0 +1,7 @@
+-- +migrate Up
+alter table "realms"
+    add column "require_email_verification" bool not null default false;
+
+-- +migrate Down
+alter table "realms"
+    drop column "require_email_verification";
@@ -0,0 +1,39 @@
+-- +migrate Up
+create table "authentication_flows"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "realm_id"         uuid      not null,
+    "name"             text      not null,
+    "executions"       jsonb     not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "authentication_flows"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_authentication_flow_name_per_realm" on "authentication_flows" ("name", "realm_id");
+
+alter table "authentication_flows"
+    add constraint "fk_authentication_flows_realms" foreign key ("realm_id") references "realms" on delete cascade;
+
+alter table "realms"
+    add column "authentication_flow_id" uuid null;
+alter table "realms"
+    add constraint "fk_realms_authentication_flows" foreign key ("authentication_flow_id") references "authentication_flows" on delete set null;
+
+alter table "clients"
+    add column "authentication_flow_id" uuid null;
+alter table "clients"
+    add constraint "fk_clients_authentication_flows" foreign key ("authentication_flow_id") references "authentication_flows" on delete set null;
+
+-- +migrate Down
+alter table "clients"
+    drop column "authentication_flow_id";
+alter table "realms"
+    drop column "authentication_flow_id";
+drop table "authentication_flows" cascade;
@@ -0,0 +1,44 @@
+-- +migrate Up
+alter table "realms"
+    add column "brute_force_protection" bool not null default true,
+    add column "brute_force_max_failures" int not null default 5,
+    add column "brute_force_ip_max_failures" int not null default 50,
+    add column "brute_force_lockout_seconds" int not null default 900,
+    add column "brute_force_max_delay_seconds" int not null default 30,
+    add column "brute_force_permanent_lockout_after" int null;
+
+create table "security_events"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "realm_id"         uuid      not null,
+    "user_id"          uuid      null,
+    "type"             text      not null,
+    "ip_address"       text      not null,
+    "details"          text      not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "security_events"
+    for each row
+execute function update_audit_timestamp();
+
+create index "idx_security_events_realm_created_at" on "security_events" ("realm_id", "audit_created_at");
+
+alter table "security_events"
+    add constraint "fk_security_events_realms" foreign key ("realm_id") references "realms" on delete cascade;
+alter table "security_events"
+    add constraint "fk_security_events_users" foreign key ("user_id") references "users" on delete set null;
+
+-- +migrate Down
+drop table "security_events" cascade;
+alter table "realms"
+    drop column "brute_force_protection",
+    drop column "brute_force_max_failures",
+    drop column "brute_force_ip_max_failures",
+    drop column "brute_force_lockout_seconds",
+    drop column "brute_force_max_delay_seconds",
+    drop column "brute_force_permanent_lockout_after";
@@ -0,0 +1,21 @@
+-- +migrate Up
+alter table "realms"
+    add column "password_policy" jsonb not null default '{"minLength": 8, "forbidUsername": true, "forbidEmail": true}';
+
+alter table "password_history"
+    drop constraint "fk_password_history_users";
+alter table "password_history"
+    add constraint "fk_password_history_users" foreign key ("user_id") references "users" on delete cascade;
+
+create index "idx_password_history_user_id" on "password_history" ("user_id", "created_at");
+
+-- +migrate Down
+drop index "idx_password_history_user_id";
+
+alter table "password_history"
+    drop constraint "fk_password_history_users";
+alter table "password_history"
+    add constraint "fk_password_history_users" foreign key ("user_id") references "users";
+
+alter table "realms"
+    drop column "password_policy";
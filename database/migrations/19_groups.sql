@@ -0,0 +1,119 @@
+-- +migrate Up
+create table "groups"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "realm_id"         uuid      not null,
+    "parent_id"        uuid      null,
+    "name"             text      not null,
+    "display_name"     text      not null,
+    "description"      text      not null,
+    "path"             text      not null,
+    "roles_cache"      uuid[]    not null default array[]::uuid[],
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "groups"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_group_path_per_realm" on "groups" ("realm_id", "path");
+create index "idx_groups_parent_id" on "groups" ("parent_id");
+
+alter table "groups"
+    add constraint "fk_groups_realms" foreign key ("realm_id") references "realms" on delete cascade;
+alter table "groups"
+    add constraint "fk_groups_parent" foreign key ("parent_id") references "groups" on delete cascade;
+
+create table "group_members"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "group_id"         uuid      not null,
+    "user_id"          uuid      not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "group_members"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_group_members" on "group_members" ("group_id", "user_id");
+create index "idx_group_members_user_id" on "group_members" ("user_id");
+
+alter table "group_members"
+    add constraint "fk_group_members_groups" foreign key ("group_id") references "groups" on delete cascade;
+alter table "group_members"
+    add constraint "fk_group_members_users" foreign key ("user_id") references "users" on delete cascade;
+
+create table "group_roles"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "group_id"         uuid      not null,
+    "role_id"          uuid      not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "group_roles"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_group_roles" on "group_roles" ("group_id", "role_id");
+
+alter table "group_roles"
+    add constraint "fk_group_roles_groups" foreign key ("group_id") references "groups" on delete cascade;
+alter table "group_roles"
+    add constraint "fk_group_roles_roles" foreign key ("role_id") references "roles" on delete cascade;
+
+-- +migrate StatementBegin
+create or replace function check_group_members_realm_ids() returns trigger as $$
+begin
+    if (select u.realm_id from users u where u.id = new.user_id) != (select g.realm_id from groups g where g.id = new.group_id) then
+        raise exception 'Realm ids do not match up'
+            using errcode = 'VV001';
+    end if;
+
+    return new;
+end;
+$$ language plpgsql;
+-- +migrate StatementEnd
+
+create trigger trg_group_members_check_realm_ids_match
+    before insert or update on group_members
+    for each row
+execute function check_group_members_realm_ids();
+
+-- +migrate StatementBegin
+create or replace function check_group_roles_realm_ids() returns trigger as $$
+begin
+    if (select r.realm_id from roles r where r.id = new.role_id) != (select g.realm_id from groups g where g.id = new.group_id) then
+        raise exception 'Realm ids do not match up'
+            using errcode = 'VV001';
+    end if;
+
+    return new;
+end;
+$$ language plpgsql;
+-- +migrate StatementEnd
+
+create trigger trg_group_roles_check_realm_ids_match
+    before insert or update on group_roles
+    for each row
+execute function check_group_roles_realm_ids();
+
+-- +migrate Down
+drop table "group_roles" cascade;
+drop table "group_members" cascade;
+drop table "groups" cascade;
+drop function check_group_roles_realm_ids();
+drop function check_group_members_realm_ids();
@@ -0,0 +1,7 @@
+-- +migrate Up
+alter table "refresh_tokens"
+    add column "claims_request" jsonb null;
+
+-- +migrate Down
+alter table "refresh_tokens"
+    drop column "claims_request";
@@ -0,0 +1,84 @@
+-- +migrate Up
+alter table "clients"
+    add column "grant_types" text[] not null default array ['authorization_code', 'refresh_token']::text[];
+alter table "clients"
+    add column "token_endpoint_auth_method" text not null default 'client_secret_basic';
+alter table "clients"
+    add column "jwks" jsonb null;
+alter table "clients"
+    add column "hashed_registration_access_token" text null;
+
+update "clients"
+set "token_endpoint_auth_method" = 'none'
+where "hashed_client_secret" is null;
+
+create unique index "idx_unique_registration_access_token" on "clients" ("hashed_registration_access_token");
+
+alter table "grants"
+    drop constraint "fk_grants_clients";
+alter table "grants"
+    add constraint "fk_grants_clients" foreign key ("client_id") references "clients" on delete cascade;
+
+alter table "refresh_tokens"
+    drop constraint "fk_refresh_tokens_clients";
+alter table "refresh_tokens"
+    add constraint "fk_refresh_tokens_clients" foreign key ("client_id") references "clients" on delete cascade;
+
+alter table "roles"
+    drop constraint "fk_roles_clients";
+alter table "roles"
+    add constraint "fk_roles_clients" foreign key ("client_id") references "clients" on delete cascade;
+
+create table "initial_access_tokens"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "realm_id"         uuid      not null,
+    "hashed_token"     text      not null,
+    "description"      text      not null,
+    "expires_at"       timestamp null,
+    "max_uses"         integer   null,
+    "use_count"        integer   not null default 0,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "initial_access_tokens"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_initial_access_token" on "initial_access_tokens" ("hashed_token");
+
+alter table "initial_access_tokens"
+    add constraint "fk_initial_access_tokens_realms" foreign key ("realm_id") references "realms" on delete cascade;
+
+-- +migrate Down
+drop table "initial_access_tokens" cascade;
+
+alter table "roles"
+    drop constraint "fk_roles_clients";
+alter table "roles"
+    add constraint "fk_roles_clients" foreign key ("client_id") references "clients";
+
+alter table "refresh_tokens"
+    drop constraint "fk_refresh_tokens_clients";
+alter table "refresh_tokens"
+    add constraint "fk_refresh_tokens_clients" foreign key ("client_id") references "clients";
+
+alter table "grants"
+    drop constraint "fk_grants_clients";
+alter table "grants"
+    add constraint "fk_grants_clients" foreign key ("client_id") references "clients";
+
+drop index "idx_unique_registration_access_token";
+
+alter table "clients"
+    drop column "hashed_registration_access_token";
+alter table "clients"
+    drop column "jwks";
+alter table "clients"
+    drop column "token_endpoint_auth_method";
+alter table "clients"
+    drop column "grant_types";
@@ -0,0 +1,47 @@
+-- +migrate Up
+alter table "clients"
+    add column "response_types" text[] not null default array ['code']::text[];
+alter table "clients"
+    add column "default_scopes" text[] not null default array []::text[];
+alter table "clients"
+    add column "optional_scopes" text[] not null default array []::text[];
+alter table "clients"
+    add column "pkce_required" bool not null default false;
+alter table "clients"
+    add column "consent_required" bool not null default true;
+alter table "clients"
+    add column "access_token_lifetime_seconds" int null;
+alter table "clients"
+    add column "id_token_lifetime_seconds" int null;
+alter table "clients"
+    add column "refresh_token_lifetime_seconds" int null;
+alter table "clients"
+    add column "front_channel_logout_uri" text null;
+alter table "clients"
+    add column "back_channel_logout_uri" text null;
+alter table "clients"
+    add column "web_origins" text[] not null default array []::text[];
+
+-- +migrate Down
+alter table "clients"
+    drop column "web_origins";
+alter table "clients"
+    drop column "back_channel_logout_uri";
+alter table "clients"
+    drop column "front_channel_logout_uri";
+alter table "clients"
+    drop column "refresh_token_lifetime_seconds";
+alter table "clients"
+    drop column "id_token_lifetime_seconds";
+alter table "clients"
+    drop column "access_token_lifetime_seconds";
+alter table "clients"
+    drop column "consent_required";
+alter table "clients"
+    drop column "pkce_required";
+alter table "clients"
+    drop column "optional_scopes";
+alter table "clients"
+    drop column "default_scopes";
+alter table "clients"
+    drop column "response_types";
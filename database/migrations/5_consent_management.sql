@@ -0,0 +1,13 @@
+-- +migrate Up
+alter table "grants"
+    add column "granted_at" timestamp not null default now();
+
+alter table "realms"
+    add column "consent_expiry_seconds" int null;
+
+-- +migrate Down
+alter table "realms"
+    drop column "consent_expiry_seconds";
+
+alter table "grants"
+    drop column "granted_at";
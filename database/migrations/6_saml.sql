@@ -0,0 +1,30 @@
+-- +migrate Up
+alter table "clients"
+    add column "protocol" text not null default 'openid-connect';
+alter table "clients"
+    add column "saml_name_id_format" text null;
+alter table "clients"
+    add column "saml_signature_algorithm" text null;
+alter table "clients"
+    add column "saml_require_signed_requests" bool not null default false;
+alter table "clients"
+    add column "saml_signing_certificate" text null;
+
+-- most service providers only verify RSA signatures, the ed25519 key stays in use for tokens
+alter table "realms"
+    add column "encrypted_rsa_private_key" bytea null;
+
+-- +migrate Down
+alter table "realms"
+    drop column "encrypted_rsa_private_key";
+
+alter table "clients"
+    drop column "saml_signing_certificate";
+alter table "clients"
+    drop column "saml_require_signed_requests";
+alter table "clients"
+    drop column "saml_signature_algorithm";
+alter table "clients"
+    drop column "saml_name_id_format";
+alter table "clients"
+    drop column "protocol";
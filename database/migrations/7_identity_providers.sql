@@ -0,0 +1,58 @@
+-- +migrate Up
+create table "identity_providers"
+(
+    "id"                      uuid      not null default gen_random_uuid(),
+    "audit_created_at"        timestamp not null default now(),
+    "audit_updated_at"        timestamp not null default now(),
+    "realm_id"                uuid      not null,
+    "alias"                   text      not null,
+    "display_name"            text      not null,
+    "issuer"                  text      not null,
+    "client_id"               text      not null,
+    "encrypted_client_secret" bytea     not null,
+    "scopes"                  text[]    not null,
+    "claim_mappings"          jsonb     not null default '{}'::jsonb,
+    "trust_email"             bool      not null default false,
+    "enabled"                 bool      not null default true,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "identity_providers"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_identity_provider_alias_per_realm" on "identity_providers" ("alias", "realm_id");
+
+alter table "identity_providers"
+    add constraint "fk_identity_providers_realms" foreign key ("realm_id") references "realms" on delete cascade;
+
+create table "federated_identities"
+(
+    "id"                   uuid      not null default gen_random_uuid(),
+    "audit_created_at"     timestamp not null default now(),
+    "audit_updated_at"     timestamp not null default now(),
+    "user_id"              uuid      not null,
+    "identity_provider_id" uuid      not null,
+    "subject"              text      not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "federated_identities"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_subject_per_identity_provider" on "federated_identities" ("subject", "identity_provider_id");
+create unique index "idx_unique_identity_provider_per_user" on "federated_identities" ("identity_provider_id", "user_id");
+
+alter table "federated_identities"
+    add constraint "fk_federated_identities_users" foreign key ("user_id") references "users" on delete cascade;
+alter table "federated_identities"
+    add constraint "fk_federated_identities_identity_providers" foreign key ("identity_provider_id") references "identity_providers" on delete cascade;
+
+-- +migrate Down
+drop table "federated_identities" cascade;
+drop table "identity_providers" cascade;
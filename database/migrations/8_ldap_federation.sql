@@ -0,0 +1,64 @@
+-- +migrate Up
+create table "ldap_providers"
+(
+    "id"                      uuid      not null default gen_random_uuid(),
+    "audit_created_at"        timestamp not null default now(),
+    "audit_updated_at"        timestamp not null default now(),
+    "realm_id"                uuid      not null,
+    "display_name"            text      not null,
+    "url"                     text      not null,
+    "start_tls"               bool      not null default false,
+    "bind_dn"                 text      null,
+    "encrypted_bind_password" bytea     null,
+    "user_base_dn"            text      not null,
+    "user_filter"             text      not null,
+    "user_dn_template"        text      not null,
+    "username_attribute"      text      not null,
+    "email_attribute"         text      not null,
+    "group_base_dn"           text      null,
+    "group_filter"            text      not null,
+    "group_name_attribute"    text      not null,
+    "group_member_attribute"  text      not null,
+    "enabled"                 bool      not null default true,
+    "last_synced_at"          timestamp null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "ldap_providers"
+    for each row
+execute function update_audit_timestamp();
+
+alter table "ldap_providers"
+    add constraint "fk_ldap_providers_realms" foreign key ("realm_id") references "realms" on delete cascade;
+
+alter table "users"
+    add column "ldap_provider_id" uuid null;
+alter table "users"
+    add column "ldap_dn" text null;
+
+alter table "users"
+    add constraint "fk_users_ldap_providers" foreign key ("ldap_provider_id") references "ldap_providers" on delete set null;
+
+-- roles created by the sync for directory groups, roles that existed before are never managed by it
+alter table "roles"
+    add column "ldap_provider_id" uuid null;
+
+alter table "roles"
+    add constraint "fk_roles_ldap_providers" foreign key ("ldap_provider_id") references "ldap_providers" on delete set null;
+
+-- +migrate Down
+alter table "roles"
+    drop constraint "fk_roles_ldap_providers";
+alter table "roles"
+    drop column "ldap_provider_id";
+
+alter table "users"
+    drop constraint "fk_users_ldap_providers";
+alter table "users"
+    drop column "ldap_dn";
+alter table "users"
+    drop column "ldap_provider_id";
+
+drop table "ldap_providers" cascade;
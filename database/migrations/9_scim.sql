@@ -0,0 +1,101 @@
+-- +migrate Up
+alter table "users"
+    add column "enabled" bool not null default true;
+
+create table "client_roles"
+(
+    "id"               uuid      not null default gen_random_uuid(),
+    "audit_created_at" timestamp not null default now(),
+    "audit_updated_at" timestamp not null default now(),
+    "client_id"        uuid      not null,
+    "role_id"          uuid      not null,
+    primary key ("id")
+);
+
+create trigger "set_audit_updated_at"
+    before update
+    on "client_roles"
+    for each row
+execute function update_audit_timestamp();
+
+create unique index "idx_unique_client_roles" on "client_roles" ("client_id", "role_id");
+
+alter table "client_roles"
+    add constraint "fk_client_roles_clients" foreign key ("client_id") references "clients" on delete cascade;
+alter table "client_roles"
+    add constraint "fk_client_roles_roles" foreign key ("role_id") references "roles" on delete cascade;
+
+insert into "roles" ("realm_id", "display_name", "name", "description", "internal")
+select "id", 'SCIM Provisioning', 'scim', 'Allows clients to provision users and groups via SCIM', true
+from "realms"
+on conflict do nothing;
+
+alter table "credentials"
+    drop constraint "fk_credentials_users";
+alter table "credentials"
+    add constraint "fk_credentials_users" foreign key ("user_id") references "users" on delete cascade;
+
+alter table "password_history"
+    drop constraint "fk_password_history_users";
+alter table "password_history"
+    add constraint "fk_password_history_users" foreign key ("user_id") references "users" on delete cascade;
+
+alter table "grants"
+    drop constraint "fk_grants_users";
+alter table "grants"
+    add constraint "fk_grants_users" foreign key ("user_id") references "users" on delete cascade;
+
+alter table "user_devices"
+    drop constraint "fk_user_devices_users";
+alter table "user_devices"
+    add constraint "fk_user_devices_users" foreign key ("user_id") references "users" on delete cascade;
+
+alter table "sessions"
+    drop constraint "fk_sessions_users";
+alter table "sessions"
+    add constraint "fk_sessions_users" foreign key ("user_id") references "users" on delete cascade;
+
+alter table "refresh_tokens"
+    drop constraint "fk_refresh_tokens_users";
+alter table "refresh_tokens"
+    add constraint "fk_refresh_tokens_users" foreign key ("user_id") references "users" on delete cascade;
+
+-- +migrate Down
+alter table "refresh_tokens"
+    drop constraint "fk_refresh_tokens_users";
+alter table "refresh_tokens"
+    add constraint "fk_refresh_tokens_users" foreign key ("user_id") references "users";
+
+alter table "sessions"
+    drop constraint "fk_sessions_users";
+alter table "sessions"
+    add constraint "fk_sessions_users" foreign key ("user_id") references "users";
+
+alter table "user_devices"
+    drop constraint "fk_user_devices_users";
+alter table "user_devices"
+    add constraint "fk_user_devices_users" foreign key ("user_id") references "users";
+
+alter table "grants"
+    drop constraint "fk_grants_users";
+alter table "grants"
+    add constraint "fk_grants_users" foreign key ("user_id") references "users";
+
+alter table "password_history"
+    drop constraint "fk_password_history_users";
+alter table "password_history"
+    add constraint "fk_password_history_users" foreign key ("user_id") references "users";
+
+alter table "credentials"
+    drop constraint "fk_credentials_users";
+alter table "credentials"
+    add constraint "fk_credentials_users" foreign key ("user_id") references "users";
+
+delete from "roles"
+where "name" = 'scim'
+  and "internal";
+
+drop table "client_roles" cascade;
+
+alter table "users"
+    drop column "enabled";
@@ -0,0 +1,229 @@
+package federation
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LdapConfig describes how to reach a directory and where its users and groups live.
+type LdapConfig struct {
+	Url      string
+	StartTls bool
+	Timeout  time.Duration
+
+	// BindDn and BindPassword are used for searching the directory, an anonymous bind is used when they are empty.
+	BindDn       string
+	BindPassword string
+
+	UserBaseDn string
+	UserFilter string
+	// UserDnTemplate builds the dn of a user from its username, e.g. "uid={username},ou=people,dc=example,dc=org".
+	UserDnTemplate    string
+	UsernameAttribute string
+	EmailAttribute    string
+
+	// GroupBaseDn is optional, group memberships are not synced when it is empty.
+	GroupBaseDn          string
+	GroupFilter          string
+	GroupNameAttribute   string
+	GroupMemberAttribute string
+}
+
+type LdapUser struct {
+	Dn       string
+	Username string
+	Email    string
+}
+
+type LdapGroup struct {
+	Dn        string
+	Name      string
+	MemberDns []string
+}
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// UserDn fills the username into the user dn template, the username is escaped so it cannot change the dn.
+func (c LdapConfig) UserDn(username string) string {
+	return strings.ReplaceAll(c.UserDnTemplate, "{username}", escapeDnValue(username))
+}
+
+// escapeDnValue escapes an attribute value for use in a dn as described in https://datatracker.ietf.org/doc/html/rfc4514#section-2.4
+func escapeDnValue(value string) string {
+	var builder strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`"+,;<>\`, r):
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case r == 0:
+			builder.WriteString(`\00`)
+		case (r == ' ' || r == '#') && i == 0:
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case r == ' ' && i == len(value)-1:
+			builder.WriteString(`\ `)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func (c LdapConfig) dial() (*ldap.Conn, error) {
+	parsed, err := url.Parse(c.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.DialURL(c.Url, ldap.DialWithDialer(&net.Dialer{Timeout: c.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Timeout > 0 {
+		conn.SetTimeout(c.Timeout)
+	}
+
+	if c.StartTls {
+		err = conn.StartTLS(&tls.Config{ServerName: parsed.Hostname()})
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (c LdapConfig) connect() (*ldap.Conn, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.BindDn == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(c.BindDn, c.BindPassword)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("could not bind as %s: %w", c.BindDn, err)
+	}
+
+	return conn, nil
+}
+
+// Authenticate binds as the user to verify the password.
+func (c LdapConfig) Authenticate(username string, password string) error {
+	// an empty password would be an unauthenticated bind, which most directories accept for any dn
+	if password == "" {
+		return ErrInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Bind(c.UserDn(username), password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// FindUsers returns every user of the directory that matches the user filter.
+func (c LdapConfig) FindUsers() ([]LdapUser, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		c.UserBaseDn,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		c.UserFilter,
+		[]string{c.UsernameAttribute, c.EmailAttribute},
+		nil))
+	if err != nil {
+		return nil, fmt.Errorf("could not search users: %w", err)
+	}
+
+	users := make([]LdapUser, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		username := entry.GetAttributeValue(c.UsernameAttribute)
+		if username == "" {
+			continue
+		}
+		users = append(users, LdapUser{
+			Dn:       entry.DN,
+			Username: username,
+			Email:    entry.GetAttributeValue(c.EmailAttribute),
+		})
+	}
+
+	return users, nil
+}
+
+// FindGroups returns every group of the directory that matches the group filter.
+func (c LdapConfig) FindGroups() ([]LdapGroup, error) {
+	if c.GroupBaseDn == "" {
+		return nil, nil
+	}
+
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		c.GroupBaseDn,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		c.GroupFilter,
+		[]string{c.GroupNameAttribute, c.GroupMemberAttribute},
+		nil))
+	if err != nil {
+		return nil, fmt.Errorf("could not search groups: %w", err)
+	}
+
+	groups := make([]LdapGroup, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		name := entry.GetAttributeValue(c.GroupNameAttribute)
+		if name == "" {
+			continue
+		}
+		groups = append(groups, LdapGroup{
+			Dn:        entry.DN,
+			Name:      name,
+			MemberDns: entry.GetAttributeValues(c.GroupMemberAttribute),
+		})
+	}
+
+	return groups, nil
+}
+
+// GroupsOfUser returns the names of the groups the user with the given dn is a member of.
+// Member dns are compared case-insensitively since directories do not normalize them consistently.
+func GroupsOfUser(groups []LdapGroup, userDn string) []string {
+	var names []string
+	for _, group := range groups {
+		for _, memberDn := range group.MemberDns {
+			if strings.EqualFold(memberDn, userDn) {
+				names = append(names, group.Name)
+				break
+			}
+		}
+	}
+	return names
+}
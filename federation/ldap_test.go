@@ -0,0 +1,167 @@
+package federation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestDirectory(t *testing.T) (*testLdapServer, LdapConfig) {
+	server := newTestLdapServer(t)
+
+	server.AddEntry("cn=admin,dc=example,dc=org", "admin-secret", map[string][]string{
+		"objectClass": {"person"},
+		"cn":          {"admin"},
+	})
+	server.AddEntry("uid=alice,ou=people,dc=example,dc=org", "alice-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"uid":         {"alice"},
+		"mail":        {"alice@example.org"},
+	})
+	server.AddEntry("uid=bob,ou=people,dc=example,dc=org", "bob-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"uid":         {"bob"},
+	})
+	server.AddEntry("cn=developers,ou=groups,dc=example,dc=org", "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"developers"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=org", "UID=BOB,OU=PEOPLE,DC=EXAMPLE,DC=ORG"},
+	})
+	server.AddEntry("cn=admins,ou=groups,dc=example,dc=org", "", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"admins"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=org"},
+	})
+
+	return server, LdapConfig{
+		Url:                  server.Url(),
+		BindDn:               "cn=admin,dc=example,dc=org",
+		BindPassword:         "admin-secret",
+		UserBaseDn:           "ou=people,dc=example,dc=org",
+		UserFilter:           "(objectClass=inetOrgPerson)",
+		UserDnTemplate:       "uid={username},ou=people,dc=example,dc=org",
+		UsernameAttribute:    "uid",
+		EmailAttribute:       "mail",
+		GroupBaseDn:          "ou=groups,dc=example,dc=org",
+		GroupFilter:          "(objectClass=groupOfNames)",
+		GroupNameAttribute:   "cn",
+		GroupMemberAttribute: "member",
+	}
+}
+
+func Test_LdapConfig_Authenticate(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+
+	// act
+	err := config.Authenticate("alice", "alice-secret")
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func Test_LdapConfig_Authenticate_WrongPassword(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+
+	// act
+	err := config.Authenticate("alice", "wrong")
+
+	// assert
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func Test_LdapConfig_Authenticate_EmptyPassword(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+
+	// act
+	err := config.Authenticate("alice", "")
+
+	// assert
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func Test_LdapConfig_FindUsers(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+
+	// act
+	users, err := config.FindUsers()
+
+	// assert
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []LdapUser{
+		{Dn: "uid=alice,ou=people,dc=example,dc=org", Username: "alice", Email: "alice@example.org"},
+		{Dn: "uid=bob,ou=people,dc=example,dc=org", Username: "bob"},
+	}, users)
+}
+
+func Test_LdapConfig_FindUsers_WrongBindPassword(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+	config.BindPassword = "wrong"
+
+	// act
+	_, err := config.FindUsers()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_LdapConfig_FindGroups(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+
+	// act
+	groups, err := config.FindGroups()
+
+	// assert
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"admins", "developers"}, GroupsOfUser(groups, "uid=alice,ou=people,dc=example,dc=org"))
+	assert.ElementsMatch(t, []string{"developers"}, GroupsOfUser(groups, "uid=bob,ou=people,dc=example,dc=org"))
+}
+
+func Test_LdapConfig_FindGroups_WithoutGroupBaseDn(t *testing.T) {
+	// arrange
+	_, config := newTestDirectory(t)
+	config.GroupBaseDn = ""
+
+	// act
+	groups, err := config.FindGroups()
+
+	// assert
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func Test_LdapConfig_UserDn_EscapesUsername(t *testing.T) {
+	// arrange
+	config := LdapConfig{UserDnTemplate: "uid={username},ou=people,dc=example,dc=org"}
+
+	// act
+	dn := config.UserDn("alice,ou=admins")
+
+	// assert
+	assert.Equal(t, `uid=alice\,ou=admins,ou=people,dc=example,dc=org`, dn)
+}
+
+func Test_EscapeDnValue(t *testing.T) {
+	tests := map[string]string{
+		"alice":       "alice",
+		" alice":      `\ alice`,
+		"alice ":      `alice\ `,
+		"#alice":      `\#alice`,
+		`a+b;c<d>e"f`: `a\+b\;c\<d\>e\"f`,
+		`back\slash`:  `back\\slash`,
+	}
+
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			// act
+			escaped := escapeDnValue(input)
+
+			// assert
+			assert.Equal(t, expected, escaped)
+		})
+	}
+}
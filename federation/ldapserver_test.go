@@ -0,0 +1,191 @@
+package federation
+
+import (
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLdapServer is an in-process directory that understands just enough of the protocol for the tests:
+// simple binds, searches with and/or/not/equality/present filters and unbinds.
+type testLdapServer struct {
+	listener net.Listener
+
+	mutex     sync.Mutex
+	entries   map[string]map[string][]string
+	passwords map[string]string
+}
+
+func newTestLdapServer(t *testing.T) *testLdapServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &testLdapServer{
+		listener:  listener,
+		entries:   map[string]map[string][]string{},
+		passwords: map[string]string{},
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go server.serve()
+	return server
+}
+
+func (s *testLdapServer) Url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLdapServer) AddEntry(dn string, password string, attributes map[string][]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[strings.ToLower(dn)] = attributes
+	s.entries[strings.ToLower(dn)]["dn"] = []string{dn}
+	if password != "" {
+		s.passwords[strings.ToLower(dn)] = password
+	}
+}
+
+func (s *testLdapServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testLdapServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageId := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+
+			s.mutex.Lock()
+			expected, ok := s.passwords[strings.ToLower(dn)]
+			s.mutex.Unlock()
+
+			resultCode := ldap.LDAPResultSuccess
+			if dn != "" && (!ok || expected != password) {
+				resultCode = ldap.LDAPResultInvalidCredentials
+			}
+			s.write(conn, messageId, ldapResult(ldap.ApplicationBindResponse, resultCode))
+		case ldap.ApplicationSearchRequest:
+			baseDn := strings.ToLower(op.Children[0].Data.String())
+			filter := op.Children[6]
+
+			s.mutex.Lock()
+			for dn, attributes := range s.entries {
+				if !strings.HasSuffix(dn, baseDn) || !matchFilter(filter, attributes) {
+					continue
+				}
+				s.write(conn, messageId, searchEntry(attributes))
+			}
+			s.mutex.Unlock()
+
+			s.write(conn, messageId, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *testLdapServer) write(conn net.Conn, messageId int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId, "MessageID"))
+	packet.AppendChild(op)
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func ldapResult(application ber.Tag, resultCode int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func searchEntry(attributes map[string][]string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attributes["dn"][0], "objectName"))
+
+	attributeList := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range attributes {
+		if name == "dn" {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		valueSet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			valueSet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(valueSet)
+		attributeList.AppendChild(attribute)
+	}
+	op.AppendChild(attributeList)
+
+	return op
+}
+
+func matchFilter(filter *ber.Packet, attributes map[string][]string) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(child, attributes) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchFilter(child, attributes) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(filter.Children[0], attributes)
+	case ldap.FilterEqualityMatch:
+		name := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		for _, candidate := range attributeValues(attributes, name) {
+			if strings.EqualFold(candidate, value) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(attributeValues(attributes, filter.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+func attributeValues(attributes map[string][]string, name string) []string {
+	for attributeName, values := range attributes {
+		if strings.EqualFold(attributeName, name) {
+			return values
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package account
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"holvit/h"
+	"holvit/handlers/api"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+)
+
+// getSessionRealm returns the realm of the current session, making sure it is the realm of the route.
+func getSessionRealm(r *http.Request) (repos.Realm, uuid.UUID) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	currentSessionService := ioc.Get[services.CurrentSessionService](scope)
+	currentSessionService.VerifyAuthorized()
+
+	realm := currentSessionService.Realm(ctx)
+	if realm.Name != mux.Vars(r)["realmName"] {
+		panic(httpErrors.Unauthorized().WithMessage("not authorized"))
+	}
+
+	return realm, currentSessionService.UserId()
+}
+
+func FindConsents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, userId := getSessionRealm(r)
+
+	consentService := ioc.Get[services.ConsentService](scope)
+	consents := consentService.FindConsents(ctx, realm, userId)
+
+	response := make([]api.ConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		response = append(response, api.MapConsentResponse(consent))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+func RevokeConsent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, userId := getSessionRealm(r)
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(mux.Vars(r)["clientId"]),
+	}).SingleOrNone().Get()
+	if !ok {
+		rcs.Error(httpErrors.NotFound().WithMessage("client not found"))
+		return
+	}
+
+	consentService := ioc.Get[services.ConsentService](scope)
+	consentService.RevokeConsent(ctx, userId, client.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/authflow"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"net/http"
+	"time"
+)
+
+type CreateAuthenticationFlowRequest struct {
+	Name       string               `json:"name"`
+	Executions []authflow.Execution `json:"executions"`
+}
+
+func CreateAuthenticationFlow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := CreateAuthenticationFlowRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	if request.Name == "" {
+		panic(httpErrors.BadRequest().WithMessage("name is required"))
+	}
+
+	realm := getRequestRealm(r)
+
+	authenticationFlowService := ioc.Get[services.AuthenticationFlowService](scope)
+	result := authenticationFlowService.CreateAuthenticationFlow(ctx, services.CreateAuthenticationFlowRequest{
+		RealmId:    realm.Id,
+		Name:       request.Name,
+		Executions: request.Executions,
+	})
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), repos.DuplicateAuthenticationFlowNameError{}) {
+			panic(httpErrors.Conflict().WithMessage("an authentication flow with this name already exists"))
+		}
+		panic(result.UnwrapErr())
+	}
+
+	writeCreateResponse(w, result.Unwrap())
+}
+
+type AuthenticationFlowResponse struct {
+	Id         uuid.UUID            `json:"id"`
+	Name       string               `json:"name"`
+	Executions []authflow.Execution `json:"executions"`
+	CreatedAt  time.Time            `json:"createdAt"`
+}
+
+func mapAuthenticationFlowResponse(authenticationFlow *repos.AuthenticationFlow) AuthenticationFlowResponse {
+	return AuthenticationFlowResponse{
+		Id:         authenticationFlow.Id,
+		Name:       authenticationFlow.Name,
+		Executions: authenticationFlow.Executions,
+		CreatedAt:  authenticationFlow.AuditCreatedAt,
+	}
+}
+
+func FindAuthenticationFlows(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	authenticationFlows := authenticationFlowRepository.FindAuthenticationFlows(ctx, repos.AuthenticationFlowFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+		},
+		RealmId: h.Some(realm.Id),
+	})
+
+	rows := iter.Map(authenticationFlows.Values(), mapAuthenticationFlowResponse)
+
+	writeFindResponse(w, rows, authenticationFlows.Count())
+}
+
+type UpdateAuthenticationFlowRequest struct {
+	Name       *string               `json:"name"`
+	Executions *[]authflow.Execution `json:"executions"`
+}
+
+func UpdateAuthenticationFlow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := UpdateAuthenticationFlowRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	if request.Name != nil && *request.Name == "" {
+		panic(httpErrors.BadRequest().WithMessage("name must not be empty"))
+	}
+
+	authenticationFlow := findRequestAuthenticationFlow(r)
+
+	authenticationFlowService := ioc.Get[services.AuthenticationFlowService](scope)
+	result := authenticationFlowService.UpdateAuthenticationFlow(ctx, authenticationFlow.Id, services.UpdateAuthenticationFlowRequest{
+		Name:       h.FromPtr(request.Name),
+		Executions: h.FromPtr(request.Executions),
+	})
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), repos.DuplicateAuthenticationFlowNameError{}) {
+			panic(httpErrors.Conflict().WithMessage("an authentication flow with this name already exists"))
+		}
+		panic(result.UnwrapErr())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAuthenticationFlow deletes the flow, realms and clients that used it fall back to the default flow.
+func DeleteAuthenticationFlow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	authenticationFlow := findRequestAuthenticationFlow(r)
+
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	authenticationFlowRepository.DeleteAuthenticationFlow(ctx, authenticationFlow.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func findRequestAuthenticationFlow(r *http.Request) repos.AuthenticationFlow {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid id"))
+	}
+
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	authenticationFlow, ok := authenticationFlowRepository.FindAuthenticationFlowById(ctx, id).Get()
+	if !ok || authenticationFlow.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("authentication flow not found"))
+	}
+
+	return authenticationFlow
+}
+
+// validateAuthenticationFlowId makes sure that a realm or client only uses an authentication flow of its own realm.
+func validateAuthenticationFlowId(r *http.Request, flowId uuid.UUID) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	authenticationFlow, ok := authenticationFlowRepository.FindAuthenticationFlowById(ctx, flowId).Get()
+	if !ok || authenticationFlow.RealmId != realm.Id {
+		panic(httpErrors.BadRequest().WithMessage("authentication flow not found"))
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"net/http"
+)
+
+type ClientRoleResponse struct {
+	Id          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type GrantClientRoleRequest struct {
+	RoleId uuid.UUID `json:"roleId"`
+}
+
+func getRequestClient(r *http.Request, realm repos.Realm) repos.Client {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(mux.Vars(r)["clientId"]),
+	}).SingleOrNone().Get()
+	if !ok {
+		panic(httpErrors.NotFound().WithMessage("client not found"))
+	}
+
+	return client
+}
+
+func FindClientRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	client := getRequestClient(r, realm)
+
+	clientRoleRepository := ioc.Get[repos.ClientRoleRepository](scope)
+	clientRoles := clientRoleRepository.FindClientRoles(ctx, repos.ClientRoleFilter{
+		ClientId: h.Some(client.Id),
+	})
+
+	if len(clientRoles) == 0 {
+		writeFindResponse(w, []ClientRoleResponse{}, 0)
+		return
+	}
+
+	roleIds := make([]uuid.UUID, 0, len(clientRoles))
+	for _, clientRole := range clientRoles {
+		roleIds = append(roleIds, clientRole.RoleId)
+	}
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	roles := roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: realm.Id,
+		RoleIds: h.Some(roleIds),
+	})
+
+	rows := iter.Map(roles.Values(), func(t *repos.Role) ClientRoleResponse {
+		return ClientRoleResponse{
+			Id:          t.Id,
+			Name:        t.Name,
+			DisplayName: t.DisplayName,
+		}
+	})
+
+	writeFindResponse(w, rows, len(rows))
+}
+
+func GrantClientRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := GrantClientRoleRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realm := getRequestRealm(r)
+	client := getRequestClient(r, realm)
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	role, ok := roleRepository.FindRoleById(ctx, request.RoleId).Get()
+	if !ok || role.RealmId != realm.Id {
+		panic(httpErrors.BadRequest().WithMessage("role not found"))
+	}
+
+	clientRoleRepository := ioc.Get[repos.ClientRoleRepository](scope)
+	clientRoleRepository.CreateClientRoles(ctx, []repos.ClientRole{
+		{
+			ClientId: client.Id,
+			RoleId:   role.Id,
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func RevokeClientRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	roleId, err := uuid.Parse(mux.Vars(r)["roleId"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid role id"))
+	}
+
+	realm := getRequestRealm(r)
+	client := getRequestClient(r, realm)
+
+	clientRoleRepository := ioc.Get[repos.ClientRoleRepository](scope)
+	clientRoles := clientRoleRepository.FindClientRoles(ctx, repos.ClientRoleFilter{
+		ClientId: h.Some(client.Id),
+		RoleId:   h.Some(roleId),
+	})
+	if len(clientRoles) == 0 {
+		panic(httpErrors.NotFound().WithMessage("role not granted to the client"))
+	}
+
+	for _, clientRole := range clientRoles {
+		clientRoleRepository.DeleteClientRole(ctx, clientRole.Id)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
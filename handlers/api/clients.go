@@ -0,0 +1,355 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/saml"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+	"slices"
+)
+
+type ClientResponse struct {
+	Id                          uuid.UUID  `json:"id"`
+	ClientId                    string     `json:"clientId"`
+	DisplayName                 string     `json:"displayName"`
+	Protocol                    string     `json:"protocol"`
+	RedirectUris                []string   `json:"redirectUris"`
+	GrantTypes                  []string   `json:"grantTypes"`
+	ResponseTypes               []string   `json:"responseTypes"`
+	DefaultScopes               []string   `json:"defaultScopes"`
+	OptionalScopes              []string   `json:"optionalScopes"`
+	PkceRequired                bool       `json:"pkceRequired"`
+	ConsentRequired             bool       `json:"consentRequired"`
+	AccessTokenLifetimeSeconds  *int       `json:"accessTokenLifetimeSeconds"`
+	IdTokenLifetimeSeconds      *int       `json:"idTokenLifetimeSeconds"`
+	RefreshTokenLifetimeSeconds *int       `json:"refreshTokenLifetimeSeconds"`
+	FrontChannelLogoutUri       *string    `json:"frontChannelLogoutUri"`
+	BackChannelLogoutUri        *string    `json:"backChannelLogoutUri"`
+	WebOrigins                  []string   `json:"webOrigins"`
+	SamlNameIdFormat            *string    `json:"samlNameIdFormat"`
+	SamlSignatureAlgorithm      *string    `json:"samlSignatureAlgorithm"`
+	SamlRequireSignedRequests   bool       `json:"samlRequireSignedRequests"`
+	SamlSigningCertificate      *string    `json:"samlSigningCertificate"`
+	AuthenticationFlowId        *uuid.UUID `json:"authenticationFlowId"`
+}
+
+func mapClientResponse(client *repos.Client) ClientResponse {
+	return ClientResponse{
+		Id:                          client.Id,
+		ClientId:                    client.ClientId,
+		DisplayName:                 client.DisplayName,
+		Protocol:                    client.Protocol,
+		RedirectUris:                client.RedirectUris,
+		GrantTypes:                  client.GrantTypes,
+		ResponseTypes:               client.ResponseTypes,
+		DefaultScopes:               client.DefaultScopes,
+		OptionalScopes:              client.OptionalScopes,
+		PkceRequired:                client.PkceRequired,
+		ConsentRequired:             client.ConsentRequired,
+		AccessTokenLifetimeSeconds:  client.AccessTokenLifetimeSeconds.ToNillablePtr(),
+		IdTokenLifetimeSeconds:      client.IdTokenLifetimeSeconds.ToNillablePtr(),
+		RefreshTokenLifetimeSeconds: client.RefreshTokenLifetimeSeconds.ToNillablePtr(),
+		FrontChannelLogoutUri:       client.FrontChannelLogoutUri.ToNillablePtr(),
+		BackChannelLogoutUri:        client.BackChannelLogoutUri.ToNillablePtr(),
+		WebOrigins:                  client.WebOrigins,
+		SamlNameIdFormat:            client.SamlNameIdFormat.ToNillablePtr(),
+		SamlSignatureAlgorithm:      client.SamlSignatureAlgorithm.ToNillablePtr(),
+		SamlRequireSignedRequests:   client.SamlRequireSignedRequests,
+		SamlSigningCertificate:      client.SamlSigningCertificate.ToNillablePtr(),
+		AuthenticationFlowId:        client.AuthenticationFlowId.ToNillablePtr(),
+	}
+}
+
+func FindClients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	filter := repos.ClientFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+			SortInfo: h.MapOpt(sortFromQuery(r), func(order QuerySortOrder) repos.SortInfo {
+				return order.MapAllowed(map[string]string{
+					"clientId":    "client_id",
+					"displayName": "display_name",
+				})
+			}),
+		},
+		RealmId: h.Some(realm.Id),
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	clients := clientRepository.FindClients(ctx, filter)
+
+	rows := iter.Map(clients.Values(), mapClientResponse)
+
+	writeFindResponse(w, rows, clients.Count())
+}
+
+// UpdateClientRequest only changes the fields that are present.
+// The nullable settings are cleared by sending them with an explicit null.
+type UpdateClientRequest struct {
+	DisplayName     *string   `json:"displayName"`
+	RedirectUris    *[]string `json:"redirectUris"`
+	GrantTypes      *[]string `json:"grantTypes"`
+	ResponseTypes   *[]string `json:"responseTypes"`
+	DefaultScopes   *[]string `json:"defaultScopes"`
+	OptionalScopes  *[]string `json:"optionalScopes"`
+	PkceRequired    *bool     `json:"pkceRequired"`
+	ConsentRequired *bool     `json:"consentRequired"`
+	WebOrigins      *[]string `json:"webOrigins"`
+
+	SamlRequireSignedRequests *bool `json:"samlRequireSignedRequests"`
+
+	AccessTokenLifetimeSeconds  json.RawMessage `json:"accessTokenLifetimeSeconds"`
+	IdTokenLifetimeSeconds      json.RawMessage `json:"idTokenLifetimeSeconds"`
+	RefreshTokenLifetimeSeconds json.RawMessage `json:"refreshTokenLifetimeSeconds"`
+	FrontChannelLogoutUri       json.RawMessage `json:"frontChannelLogoutUri"`
+	BackChannelLogoutUri        json.RawMessage `json:"backChannelLogoutUri"`
+	SamlNameIdFormat            json.RawMessage `json:"samlNameIdFormat"`
+	SamlSignatureAlgorithm      json.RawMessage `json:"samlSignatureAlgorithm"`
+	SamlSigningCertificate      json.RawMessage `json:"samlSigningCertificate"`
+	AuthenticationFlowId        json.RawMessage `json:"authenticationFlowId"`
+}
+
+func nullableFromRaw[T any](raw json.RawMessage) h.Opt[h.Opt[T]] {
+	if raw == nil {
+		return h.None[h.Opt[T]]()
+	}
+
+	var value *T
+	if err := json.Unmarshal(raw, &value); err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+	return h.Some(h.FromPtr(value))
+}
+
+func UpdateClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := UpdateClientRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realm := getRequestRealm(r)
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(mux.Vars(r)["clientId"]),
+	}).SingleOrNone().Get()
+	if !ok {
+		panic(httpErrors.NotFound().WithMessage("client not found"))
+	}
+
+	if request.GrantTypes != nil {
+		validateGrantTypes(*request.GrantTypes)
+	}
+
+	if request.ResponseTypes != nil {
+		validateResponseTypes(*request.ResponseTypes)
+	}
+
+	samlNameIdFormat := nullableFromRaw[string](request.SamlNameIdFormat)
+	samlNameIdFormat.IfSome(func(x h.Opt[string]) {
+		x.IfSome(validateSamlNameIdFormat)
+	})
+
+	samlSignatureAlgorithm := nullableFromRaw[string](request.SamlSignatureAlgorithm)
+	samlSignatureAlgorithm.IfSome(func(x h.Opt[string]) {
+		x.IfSome(validateSamlSignatureAlgorithm)
+	})
+
+	samlSigningCertificate := nullableFromRaw[string](request.SamlSigningCertificate)
+	samlSigningCertificate.IfSome(func(x h.Opt[string]) {
+		x.IfSome(validateSamlSigningCertificate)
+	})
+
+	// signed requests can only be verified with the certificate of the service provider
+	if utils.GetOrDefault(request.SamlRequireSignedRequests, client.SamlRequireSignedRequests) &&
+		samlSigningCertificate.OrDefault(client.SamlSigningCertificate).IsNone() {
+		panic(httpErrors.BadRequest().WithMessage("signed requests require the signing certificate of the service provider"))
+	}
+
+	authenticationFlowId := nullableFromRaw[uuid.UUID](request.AuthenticationFlowId)
+	authenticationFlowId.IfSome(func(x h.Opt[uuid.UUID]) {
+		x.IfSome(func(flowId uuid.UUID) {
+			validateAuthenticationFlowId(r, flowId)
+		})
+	})
+
+	clientRepository.UpdateClient(ctx, client.Id, repos.ClientUpdate{
+		DisplayName:                 h.FromPtr(request.DisplayName),
+		RedirectUris:                h.FromPtr(request.RedirectUris),
+		GrantTypes:                  h.FromPtr(request.GrantTypes),
+		ResponseTypes:               h.FromPtr(request.ResponseTypes),
+		DefaultScopes:               h.FromPtr(request.DefaultScopes),
+		OptionalScopes:              h.FromPtr(request.OptionalScopes),
+		PkceRequired:                h.FromPtr(request.PkceRequired),
+		ConsentRequired:             h.FromPtr(request.ConsentRequired),
+		AccessTokenLifetimeSeconds:  nullableFromRaw[int](request.AccessTokenLifetimeSeconds),
+		IdTokenLifetimeSeconds:      nullableFromRaw[int](request.IdTokenLifetimeSeconds),
+		RefreshTokenLifetimeSeconds: nullableFromRaw[int](request.RefreshTokenLifetimeSeconds),
+		FrontChannelLogoutUri:       nullableFromRaw[string](request.FrontChannelLogoutUri),
+		BackChannelLogoutUri:        nullableFromRaw[string](request.BackChannelLogoutUri),
+		WebOrigins:                  h.FromPtr(request.WebOrigins),
+		SamlNameIdFormat:            samlNameIdFormat,
+		SamlSignatureAlgorithm:      samlSignatureAlgorithm,
+		SamlRequireSignedRequests:   h.FromPtr(request.SamlRequireSignedRequests),
+		SamlSigningCertificate:      samlSigningCertificate,
+		AuthenticationFlowId:        authenticationFlowId,
+	}).Unwrap()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateGrantTypes(grantTypes []string) {
+	for _, grantType := range grantTypes {
+		if grantType != constants.TokenGrantTypeAuthorizationCode && grantType != constants.TokenGrantTypeRefreshToken && grantType != constants.TokenGrantTypeCiba && grantType != constants.TokenGrantTypeClientCredentials {
+			panic(httpErrors.BadRequest().WithMessage(fmt.Sprintf("unsupported grant type '%s'", grantType)))
+		}
+	}
+}
+
+func validateResponseTypes(responseTypes []string) {
+	if slices.ContainsFunc(responseTypes, func(responseType string) bool {
+		return responseType != constants.AuthorizationResponseTypeCode
+	}) {
+		panic(httpErrors.BadRequest().WithMessage("only the response type 'code' is supported"))
+	}
+}
+
+func validateSamlNameIdFormat(nameIdFormat string) {
+	if nameIdFormat != saml.NameIdFormatUnspecified && nameIdFormat != saml.NameIdFormatEmailAddress && nameIdFormat != saml.NameIdFormatPersistent {
+		panic(httpErrors.BadRequest().WithMessage(fmt.Sprintf("unsupported name id format '%s'", nameIdFormat)))
+	}
+}
+
+func validateSamlSignatureAlgorithm(signatureAlgorithm string) {
+	if signatureAlgorithm != saml.SignatureRsaSha256 && signatureAlgorithm != saml.SignatureEd25519 {
+		panic(httpErrors.BadRequest().WithMessage(fmt.Sprintf("unsupported signature algorithm '%s'", signatureAlgorithm)))
+	}
+}
+
+func validateSamlSigningCertificate(certificate string) {
+	if _, err := saml.ParseCertificate(certificate); err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid signing certificate"))
+	}
+}
+
+type CreateClientRequest struct {
+	ClientId               *string  `json:"clientId"`
+	DisplayName            string   `json:"displayName"`
+	Protocol               string   `json:"protocol"`
+	WithSecret             bool     `json:"withSecret"`
+	RedirectUris           []string `json:"redirectUris"`
+	GrantTypes             []string `json:"grantTypes"`
+	ResponseTypes          []string `json:"responseTypes"`
+	DefaultScopes          []string `json:"defaultScopes"`
+	OptionalScopes         []string `json:"optionalScopes"`
+	PkceRequired           bool     `json:"pkceRequired"`
+	ConsentRequired        *bool    `json:"consentRequired"`
+	WebOrigins             []string `json:"webOrigins"`
+	SamlNameIdFormat       *string  `json:"samlNameIdFormat"`
+	SamlSignatureAlgorithm *string  `json:"samlSignatureAlgorithm"`
+
+	SamlRequireSignedRequests bool    `json:"samlRequireSignedRequests"`
+	SamlSigningCertificate    *string `json:"samlSigningCertificate"`
+}
+
+type CreateClientResponse struct {
+	Id           uuid.UUID `json:"id"`
+	ClientId     string    `json:"clientId"`
+	ClientSecret *string   `json:"clientSecret"`
+}
+
+// CreateClient registers either an OpenID Connect client or a SAML service provider.
+// The client id of a service provider is its entity id and the redirect uris are its assertion consumer service urls.
+func CreateClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := CreateClientRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realm := getRequestRealm(r)
+
+	switch request.Protocol {
+	case "", constants.ClientProtocolOidc:
+		validateGrantTypes(request.GrantTypes)
+		validateResponseTypes(request.ResponseTypes)
+		if request.SamlNameIdFormat != nil || request.SamlSignatureAlgorithm != nil || request.SamlRequireSignedRequests || request.SamlSigningCertificate != nil {
+			panic(httpErrors.BadRequest().WithMessage("only SAML clients have a name id format, signature algorithm or signing certificate"))
+		}
+	case constants.ClientProtocolSaml:
+		if request.ClientId == nil {
+			panic(httpErrors.BadRequest().WithMessage("the entity id of the service provider is required as client id"))
+		}
+		if len(request.GrantTypes) != 0 || len(request.ResponseTypes) != 0 || request.WithSecret {
+			panic(httpErrors.BadRequest().WithMessage("SAML clients do not use grant types, response types or secrets"))
+		}
+		if request.SamlNameIdFormat != nil {
+			validateSamlNameIdFormat(*request.SamlNameIdFormat)
+		}
+		if request.SamlSignatureAlgorithm != nil {
+			validateSamlSignatureAlgorithm(*request.SamlSignatureAlgorithm)
+		}
+		if request.SamlSigningCertificate != nil {
+			validateSamlSigningCertificate(*request.SamlSigningCertificate)
+		} else if request.SamlRequireSignedRequests {
+			panic(httpErrors.BadRequest().WithMessage("signed requests require the signing certificate of the service provider"))
+		}
+	default:
+		panic(httpErrors.BadRequest().WithMessage(fmt.Sprintf("unsupported protocol '%s'", request.Protocol)))
+	}
+
+	clientService := ioc.Get[services.ClientService](scope)
+	response := clientService.CreateClient(ctx, services.CreateClientRequest{
+		RealmId:                realm.Id,
+		ClientId:               h.FromPtr(request.ClientId),
+		DisplayName:            request.DisplayName,
+		Protocol:               request.Protocol,
+		WithSecret:             request.WithSecret,
+		RedirectUrls:           request.RedirectUris,
+		GrantTypes:             request.GrantTypes,
+		ResponseTypes:          request.ResponseTypes,
+		DefaultScopes:          request.DefaultScopes,
+		OptionalScopes:         request.OptionalScopes,
+		PkceRequired:           request.PkceRequired,
+		ConsentRequired:        request.ConsentRequired,
+		WebOrigins:             request.WebOrigins,
+		SamlNameIdFormat:       h.FromPtr(request.SamlNameIdFormat),
+		SamlSignatureAlgorithm: h.FromPtr(request.SamlSignatureAlgorithm),
+
+		SamlRequireSignedRequests: request.SamlRequireSignedRequests,
+		SamlSigningCertificate:    h.FromPtr(request.SamlSigningCertificate),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(CreateClientResponse{
+		Id:           response.Id,
+		ClientId:     response.ClientId,
+		ClientSecret: response.ClientSecret.ToNillablePtr(),
+	})
+	if err != nil {
+		panic(err)
+	}
+}
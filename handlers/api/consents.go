@@ -0,0 +1,102 @@
+package api
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"net/http"
+	"time"
+)
+
+type ConsentScopeResponse struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+	GrantedAt   time.Time `json:"grantedAt"`
+}
+
+type ConsentResponse struct {
+	ClientId          string                 `json:"clientId"`
+	ClientDisplayName string                 `json:"clientDisplayName"`
+	Scopes            []ConsentScopeResponse `json:"scopes"`
+}
+
+// MapConsentResponse is shared with the account console, which lists the consents of the signed in user.
+func MapConsentResponse(consent services.Consent) ConsentResponse {
+	scopes := make([]ConsentScopeResponse, 0, len(consent.Scopes))
+	for _, consentScope := range consent.Scopes {
+		scopes = append(scopes, ConsentScopeResponse{
+			Name:        consentScope.Name,
+			DisplayName: consentScope.DisplayName,
+			GrantedAt:   consentScope.GrantedAt,
+		})
+	}
+
+	return ConsentResponse{
+		ClientId:          consent.Client.ClientId,
+		ClientDisplayName: consent.Client.DisplayName,
+		Scopes:            scopes,
+	}
+}
+
+func getRequestUser(r *http.Request, realm repos.Realm) repos.User {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	userId, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid user id"))
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || user.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("user not found"))
+	}
+
+	return user
+}
+
+func FindUserConsents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	user := getRequestUser(r, realm)
+
+	consentService := ioc.Get[services.ConsentService](scope)
+	consents := consentService.FindConsents(ctx, realm, user.Id)
+
+	rows := make([]ConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		rows = append(rows, MapConsentResponse(consent))
+	}
+
+	writeFindResponse(w, rows, len(rows))
+}
+
+func RevokeUserConsent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	user := getRequestUser(r, realm)
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(mux.Vars(r)["clientId"]),
+	}).SingleOrNone().Get()
+	if !ok {
+		panic(httpErrors.NotFound().WithMessage("client not found"))
+	}
+
+	consentService := ioc.Get[services.ConsentService](scope)
+	consentService.RevokeConsent(ctx, user.Id, client.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"net/http"
+	"time"
+)
+
+type CreateGroupRequest struct {
+	ParentId    *uuid.UUID `json:"parentId"`
+	Name        string     `json:"name"`
+	DisplayName *string    `json:"displayName"`
+	Description *string    `json:"description"`
+}
+
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := CreateGroupRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realm := getRequestRealm(r)
+
+	groupService := ioc.Get[services.GroupService](scope)
+	result := groupService.CreateGroup(ctx, services.CreateGroupRequest{
+		RealmId:     realm.Id,
+		ParentId:    h.FromPtr(request.ParentId),
+		Name:        request.Name,
+		DisplayName: h.FromPtr(request.DisplayName),
+		Description: h.FromPtr(request.Description),
+	})
+	if result.IsErr() {
+		panic(mapGroupError(result.UnwrapErr()))
+	}
+
+	writeCreateResponse(w, result.Unwrap())
+}
+
+type GroupResponse struct {
+	Id          uuid.UUID  `json:"id"`
+	ParentId    *uuid.UUID `json:"parentId"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+	Description string     `json:"description"`
+	Path        string     `json:"path"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func mapGroupResponse(group *repos.Group) GroupResponse {
+	return GroupResponse{
+		Id:          group.Id,
+		ParentId:    group.ParentId.ToNillablePtr(),
+		Name:        group.Name,
+		DisplayName: group.DisplayName,
+		Description: group.Description,
+		Path:        group.Path,
+		CreatedAt:   group.AuditCreatedAt,
+	}
+}
+
+func FindGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	filter := repos.GroupFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+			SearchText: searchTextFromQuery(r),
+		},
+		RealmId: h.Some(realm.Id),
+	}
+
+	if value := r.URL.Query().Get("parentId"); value != "" {
+		parentId, err := uuid.Parse(value)
+		if err != nil {
+			panic(httpErrors.BadRequest().WithMessage("invalid query parameter 'parentId'"))
+		}
+		filter.ParentId = h.Some(parentId)
+	}
+
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+	groups := groupRepository.FindGroups(ctx, filter)
+
+	rows := iter.Map(groups.Values(), mapGroupResponse)
+
+	writeFindResponse(w, rows, groups.Count())
+}
+
+type UpdateGroupRequest struct {
+	// ParentId moves the group, null moves it to the top level.
+	ParentId    json.RawMessage `json:"parentId"`
+	Name        *string         `json:"name"`
+	DisplayName *string         `json:"displayName"`
+	Description *string         `json:"description"`
+}
+
+func UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := UpdateGroupRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+
+	groupService := ioc.Get[services.GroupService](scope)
+	result := groupService.UpdateGroup(ctx, services.UpdateGroupRequest{
+		RealmId:     realm.Id,
+		GroupId:     group.Id,
+		ParentId:    nullableFromRaw[uuid.UUID](request.ParentId),
+		Name:        h.FromPtr(request.Name),
+		DisplayName: h.FromPtr(request.DisplayName),
+		Description: h.FromPtr(request.Description),
+	})
+	if result.IsErr() {
+		panic(mapGroupError(result.UnwrapErr()))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+
+	// the child groups are deleted with it
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+	groupRepository.DeleteGroup(ctx, group.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type GroupRoleResponse struct {
+	Id          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+	// Inherited is set for roles that come from a parent group or are implied by another role.
+	Inherited bool `json:"inherited"`
+}
+
+func FindGroupRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+
+	groupRoleRepository := ioc.Get[repos.GroupRoleRepository](scope)
+	groupRoles := groupRoleRepository.FindGroupRoles(ctx, repos.GroupRoleFilter{
+		GroupId: h.Some(group.Id),
+	})
+
+	assigned := make(map[uuid.UUID]bool, len(groupRoles))
+	roleIds := make([]uuid.UUID, 0, len(groupRoles)+len(group.RolesCache))
+	for _, groupRole := range groupRoles {
+		assigned[groupRole.RoleId] = true
+		roleIds = append(roleIds, groupRole.RoleId)
+	}
+	roleIds = append(roleIds, group.RolesCache...)
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	roles := roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: realm.Id,
+		RoleIds: h.Some(roleIds),
+	})
+
+	rows := iter.Map(roles.Values(), func(t *repos.Role) GroupRoleResponse {
+		return GroupRoleResponse{
+			Id:          t.Id,
+			Name:        t.Name,
+			DisplayName: t.DisplayName,
+			Inherited:   !assigned[t.Id],
+		}
+	})
+
+	writeFindResponse(w, rows, len(rows))
+}
+
+type SetGroupRolesRequest struct {
+	RoleIds []uuid.UUID `json:"roleIds"`
+}
+
+func SetGroupRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := SetGroupRolesRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+
+	groupService := ioc.Get[services.GroupService](scope)
+	result := groupService.SetGroupRoles(ctx, services.SetGroupRolesRequest{
+		RealmId: realm.Id,
+		GroupId: group.Id,
+		RoleIds: request.RoleIds,
+	})
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), services.WrongRealmRoleError{}) {
+			panic(httpErrors.BadRequest().WithMessage("role not found"))
+		}
+		panic(result.UnwrapErr())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func FindGroupMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	users := userRepository.FindUsers(ctx, repos.UserFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+			SearchText: searchTextFromQuery(r),
+		},
+		RealmId: h.Some(realm.Id),
+		GroupId: h.Some(group.Id),
+	})
+
+	rows := iter.Map(users.Values(), mapUserResponse)
+
+	writeFindResponse(w, rows, users.Count())
+}
+
+func AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+	user := getRequestGroupUser(r, realm)
+
+	groupMemberRepository := ioc.Get[repos.GroupMemberRepository](scope)
+	groupMemberRepository.CreateGroupMembers(ctx, []repos.GroupMember{
+		{
+			GroupId: group.Id,
+			UserId:  user.Id,
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	group := getRequestGroup(r, realm)
+	user := getRequestGroupUser(r, realm)
+
+	groupMemberRepository := ioc.Get[repos.GroupMemberRepository](scope)
+	groupMembers := groupMemberRepository.FindGroupMembers(ctx, repos.GroupMemberFilter{
+		GroupId: h.Some(group.Id),
+		UserId:  h.Some(user.Id),
+	})
+	if len(groupMembers) == 0 {
+		panic(httpErrors.NotFound().WithMessage("the user is not a member of the group"))
+	}
+
+	for _, groupMember := range groupMembers {
+		groupMemberRepository.DeleteGroupMember(ctx, groupMember.Id)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func FindUserGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+	user := getRequestGroupUser(r, realm)
+
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+	groups := groupRepository.FindGroups(ctx, repos.GroupFilter{
+		RealmId:  h.Some(realm.Id),
+		MemberId: h.Some(user.Id),
+	})
+
+	rows := iter.Map(groups.Values(), mapGroupResponse)
+
+	writeFindResponse(w, rows, len(rows))
+}
+
+func getRequestGroup(r *http.Request, realm repos.Realm) repos.Group {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	id, err := uuid.Parse(mux.Vars(r)["groupId"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid group id"))
+	}
+
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+	group, ok := groupRepository.FindGroupById(ctx, id).Get()
+	if !ok || group.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("group not found"))
+	}
+
+	return group
+}
+
+func getRequestGroupUser(r *http.Request, realm repos.Realm) repos.User {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	userId, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid user id"))
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || user.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("user not found"))
+	}
+
+	return user
+}
+
+func mapGroupError(err error) error {
+	switch {
+	case errors.Is(err, repos.DuplicateGroupError{}):
+		return httpErrors.Conflict().WithMessage("a group with this name already exists at this level")
+	case errors.Is(err, services.InvalidGroupNameError{}):
+		return httpErrors.BadRequest().WithMessage("the name must not be empty or contain '/'")
+	case errors.Is(err, services.ParentGroupNotFoundError{}):
+		return httpErrors.BadRequest().WithMessage("parent group not found")
+	case errors.Is(err, services.CircularGroupError{}):
+		return httpErrors.BadRequest().WithMessage("a group can not be moved below itself")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/broker"
+	"holvit/config"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+var identityProviderAliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type CreateIdentityProviderRequest struct {
+	Alias         string            `json:"alias"`
+	DisplayName   string            `json:"displayName"`
+	Issuer        string            `json:"issuer"`
+	ClientId      string            `json:"clientId"`
+	ClientSecret  string            `json:"clientSecret"`
+	Scopes        []string          `json:"scopes"`
+	ClaimMappings map[string]string `json:"claimMappings"`
+	TrustEmail    bool              `json:"trustEmail"`
+	Enabled       *bool             `json:"enabled"`
+}
+
+func CreateIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := CreateIdentityProviderRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	if !identityProviderAliasPattern.MatchString(request.Alias) {
+		panic(httpErrors.BadRequest().WithMessage("the alias may only contain lowercase letters, digits, '-' and '_'"))
+	}
+	if request.DisplayName == "" {
+		panic(httpErrors.BadRequest().WithMessage("displayName is required"))
+	}
+	if request.ClientId == "" {
+		panic(httpErrors.BadRequest().WithMessage("clientId is required"))
+	}
+	validateIssuer(request.Issuer)
+	validateClaimMappings(request.ClaimMappings)
+
+	realm := getRequestRealm(r)
+
+	identityBrokerService := ioc.Get[services.IdentityBrokerService](scope)
+	result := identityBrokerService.CreateIdentityProvider(ctx, services.CreateIdentityProviderRequest{
+		RealmId:       realm.Id,
+		Alias:         request.Alias,
+		DisplayName:   request.DisplayName,
+		Issuer:        request.Issuer,
+		ClientId:      request.ClientId,
+		ClientSecret:  request.ClientSecret,
+		Scopes:        utils.NonNilSlice(request.Scopes),
+		ClaimMappings: request.ClaimMappings,
+		TrustEmail:    request.TrustEmail,
+		Enabled:       utils.GetOrDefault(request.Enabled, true),
+	})
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), repos.DuplicateIdentityProviderAliasError{}) {
+			panic(httpErrors.Conflict().WithMessage("an identity provider with this alias already exists"))
+		}
+		panic(result.UnwrapErr())
+	}
+
+	writeCreateResponse(w, result.Unwrap())
+}
+
+type IdentityProviderResponse struct {
+	Id            uuid.UUID         `json:"id"`
+	Alias         string            `json:"alias"`
+	DisplayName   string            `json:"displayName"`
+	Issuer        string            `json:"issuer"`
+	ClientId      string            `json:"clientId"`
+	Scopes        []string          `json:"scopes"`
+	ClaimMappings map[string]string `json:"claimMappings"`
+	TrustEmail    bool              `json:"trustEmail"`
+	Enabled       bool              `json:"enabled"`
+	CreatedAt     time.Time         `json:"createdAt"`
+}
+
+func mapIdentityProviderResponse(identityProvider *repos.IdentityProvider) IdentityProviderResponse {
+	return IdentityProviderResponse{
+		Id:            identityProvider.Id,
+		Alias:         identityProvider.Alias,
+		DisplayName:   identityProvider.DisplayName,
+		Issuer:        identityProvider.Issuer,
+		ClientId:      identityProvider.ClientId,
+		Scopes:        identityProvider.Scopes,
+		ClaimMappings: identityProvider.ClaimMappings,
+		TrustEmail:    identityProvider.TrustEmail,
+		Enabled:       identityProvider.Enabled,
+		CreatedAt:     identityProvider.AuditCreatedAt,
+	}
+}
+
+func FindIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	identityProviders := identityProviderRepository.FindIdentityProviders(ctx, repos.IdentityProviderFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+		},
+		RealmId: h.Some(realm.Id),
+	})
+
+	rows := iter.Map(identityProviders.Values(), mapIdentityProviderResponse)
+
+	writeFindResponse(w, rows, identityProviders.Count())
+}
+
+type UpdateIdentityProviderRequest struct {
+	DisplayName   *string            `json:"displayName"`
+	Issuer        *string            `json:"issuer"`
+	ClientId      *string            `json:"clientId"`
+	ClientSecret  *string            `json:"clientSecret"`
+	Scopes        *[]string          `json:"scopes"`
+	ClaimMappings *map[string]string `json:"claimMappings"`
+	TrustEmail    *bool              `json:"trustEmail"`
+	Enabled       *bool              `json:"enabled"`
+}
+
+func UpdateIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := UpdateIdentityProviderRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	identityProvider := findRequestIdentityProvider(r)
+
+	if request.Issuer != nil {
+		validateIssuer(*request.Issuer)
+	}
+
+	claimMappings := h.None[repos.ClaimMappings]()
+	if request.ClaimMappings != nil {
+		validateClaimMappings(*request.ClaimMappings)
+		claimMappings = h.Some(repos.ClaimMappings(*request.ClaimMappings))
+	}
+
+	encryptedClientSecret := h.None[[]byte]()
+	if request.ClientSecret != nil {
+		key := config.C.GetSymmetricEncryptionKey()
+		encryptedClientSecret = h.Some(utils.EncryptSymmetric([]byte(*request.ClientSecret), key))
+	}
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	identityProviderRepository.UpdateIdentityProvider(ctx, identityProvider.Id, repos.IdentityProviderUpdate{
+		DisplayName:           h.FromPtr(request.DisplayName),
+		Issuer:                h.FromPtr(request.Issuer),
+		ClientId:              h.FromPtr(request.ClientId),
+		EncryptedClientSecret: encryptedClientSecret,
+		Scopes:                h.FromPtr(request.Scopes),
+		ClaimMappings:         claimMappings,
+		TrustEmail:            h.FromPtr(request.TrustEmail),
+		Enabled:               h.FromPtr(request.Enabled),
+	}).Unwrap()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func DeleteIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	identityProvider := findRequestIdentityProvider(r)
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	identityProviderRepository.DeleteIdentityProvider(ctx, identityProvider.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func findRequestIdentityProvider(r *http.Request) repos.IdentityProvider {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid id"))
+	}
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	identityProvider, ok := identityProviderRepository.FindIdentityProviderById(ctx, id).Get()
+	if !ok || identityProvider.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("identity provider not found"))
+	}
+
+	return identityProvider
+}
+
+func validateIssuer(issuer string) {
+	parsed, err := url.Parse(issuer)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		panic(httpErrors.BadRequest().WithMessage("the issuer has to be an absolute url"))
+	}
+}
+
+func validateClaimMappings(claimMappings map[string]string) {
+	for attribute := range claimMappings {
+		if _, ok := broker.DefaultClaimMappings[attribute]; !ok {
+			panic(httpErrors.BadRequest().WithMessage("unsupported attribute '" + attribute + "' in claimMappings"))
+		}
+	}
+}
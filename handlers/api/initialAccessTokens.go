@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"net/http"
+	"time"
+)
+
+type CreateInitialAccessTokenRequest struct {
+	Description string     `json:"description"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	// MaxUses defaults to a single use for tokens that do not expire.
+	MaxUses *int `json:"maxUses"`
+}
+
+type CreateInitialAccessTokenResponse struct {
+	Token string `json:"token"`
+}
+
+func CreateInitialAccessToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := CreateInitialAccessTokenRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	if request.MaxUses != nil && *request.MaxUses < 1 {
+		panic(httpErrors.BadRequest().WithMessage("maxUses must be at least 1"))
+	}
+
+	realm := getRequestRealm(r)
+
+	clientRegistrationService := ioc.Get[services.ClientRegistrationService](scope)
+	token := clientRegistrationService.CreateInitialAccessToken(ctx, services.CreateInitialAccessTokenRequest{
+		RealmId:     realm.Id,
+		Description: request.Description,
+		ExpiresAt:   h.FromPtr(request.ExpiresAt),
+		MaxUses:     h.FromPtr(request.MaxUses),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(CreateInitialAccessTokenResponse{
+		Token: token,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type InitialAccessTokenResponse struct {
+	Id          uuid.UUID  `json:"id"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	MaxUses     *int       `json:"maxUses"`
+	UseCount    int        `json:"useCount"`
+}
+
+func mapInitialAccessTokenResponse(token *repos.InitialAccessToken) InitialAccessTokenResponse {
+	return InitialAccessTokenResponse{
+		Id:          token.Id,
+		Description: token.Description,
+		CreatedAt:   token.AuditCreatedAt,
+		ExpiresAt:   token.ExpiresAt.ToNillablePtr(),
+		MaxUses:     token.MaxUses.ToNillablePtr(),
+		UseCount:    token.UseCount,
+	}
+}
+
+func FindInitialAccessTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	initialAccessTokenRepository := ioc.Get[repos.InitialAccessTokenRepository](scope)
+	tokens := initialAccessTokenRepository.FindInitialAccessTokens(ctx, repos.InitialAccessTokenFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+		},
+		RealmId: h.Some(realm.Id),
+	})
+
+	rows := iter.Map(tokens.Values(), mapInitialAccessTokenResponse)
+
+	writeFindResponse(w, rows, tokens.Count())
+}
+
+func DeleteInitialAccessToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid id"))
+	}
+
+	initialAccessTokenRepository := ioc.Get[repos.InitialAccessTokenRepository](scope)
+	token, ok := initialAccessTokenRepository.FindInitialAccessTokenById(ctx, id).Get()
+	if !ok || token.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("initial access token not found"))
+	}
+
+	initialAccessTokenRepository.DeleteInitialAccessToken(ctx, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type CreateLdapProviderRequest struct {
+	DisplayName  string  `json:"displayName"`
+	Url          string  `json:"url"`
+	StartTls     bool    `json:"startTls"`
+	BindDn       *string `json:"bindDn"`
+	BindPassword *string `json:"bindPassword"`
+
+	UserBaseDn        string  `json:"userBaseDn"`
+	UserFilter        *string `json:"userFilter"`
+	UserDnTemplate    string  `json:"userDnTemplate"`
+	UsernameAttribute *string `json:"usernameAttribute"`
+	EmailAttribute    *string `json:"emailAttribute"`
+
+	GroupBaseDn          *string `json:"groupBaseDn"`
+	GroupFilter          *string `json:"groupFilter"`
+	GroupNameAttribute   *string `json:"groupNameAttribute"`
+	GroupMemberAttribute *string `json:"groupMemberAttribute"`
+
+	Enabled *bool `json:"enabled"`
+}
+
+func CreateLdapProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := CreateLdapProviderRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	if request.DisplayName == "" {
+		panic(httpErrors.BadRequest().WithMessage("displayName is required"))
+	}
+	if request.UserBaseDn == "" {
+		panic(httpErrors.BadRequest().WithMessage("userBaseDn is required"))
+	}
+	validateLdapUrl(request.Url)
+	validateUserDnTemplate(request.UserDnTemplate)
+
+	realm := getRequestRealm(r)
+
+	ldapFederationService := ioc.Get[services.LdapFederationService](scope)
+	id := ldapFederationService.CreateLdapProvider(ctx, services.CreateLdapProviderRequest{
+		RealmId:              realm.Id,
+		DisplayName:          request.DisplayName,
+		Url:                  request.Url,
+		StartTls:             request.StartTls,
+		BindDn:               h.FromPtr(request.BindDn),
+		BindPassword:         h.FromPtr(request.BindPassword),
+		UserBaseDn:           request.UserBaseDn,
+		UserFilter:           utils.GetOrDefault(request.UserFilter, "(objectClass=inetOrgPerson)"),
+		UserDnTemplate:       request.UserDnTemplate,
+		UsernameAttribute:    utils.GetOrDefault(request.UsernameAttribute, "uid"),
+		EmailAttribute:       utils.GetOrDefault(request.EmailAttribute, "mail"),
+		GroupBaseDn:          h.FromPtr(request.GroupBaseDn),
+		GroupFilter:          utils.GetOrDefault(request.GroupFilter, "(objectClass=groupOfNames)"),
+		GroupNameAttribute:   utils.GetOrDefault(request.GroupNameAttribute, "cn"),
+		GroupMemberAttribute: utils.GetOrDefault(request.GroupMemberAttribute, "member"),
+		Enabled:              utils.GetOrDefault(request.Enabled, true),
+	})
+
+	writeCreateResponse(w, id)
+}
+
+type LdapProviderResponse struct {
+	Id             uuid.UUID `json:"id"`
+	DisplayName    string    `json:"displayName"`
+	Url            string    `json:"url"`
+	StartTls       bool      `json:"startTls"`
+	BindDn         *string   `json:"bindDn"`
+	UserBaseDn     string    `json:"userBaseDn"`
+	UserFilter     string    `json:"userFilter"`
+	UserDnTemplate string    `json:"userDnTemplate"`
+
+	UsernameAttribute    string     `json:"usernameAttribute"`
+	EmailAttribute       string     `json:"emailAttribute"`
+	GroupBaseDn          *string    `json:"groupBaseDn"`
+	GroupFilter          string     `json:"groupFilter"`
+	GroupNameAttribute   string     `json:"groupNameAttribute"`
+	GroupMemberAttribute string     `json:"groupMemberAttribute"`
+	Enabled              bool       `json:"enabled"`
+	LastSyncedAt         *time.Time `json:"lastSyncedAt"`
+	CreatedAt            time.Time  `json:"createdAt"`
+}
+
+func mapLdapProviderResponse(ldapProvider *repos.LdapProvider) LdapProviderResponse {
+	return LdapProviderResponse{
+		Id:                   ldapProvider.Id,
+		DisplayName:          ldapProvider.DisplayName,
+		Url:                  ldapProvider.Url,
+		StartTls:             ldapProvider.StartTls,
+		BindDn:               ldapProvider.BindDn.ToNillablePtr(),
+		UserBaseDn:           ldapProvider.UserBaseDn,
+		UserFilter:           ldapProvider.UserFilter,
+		UserDnTemplate:       ldapProvider.UserDnTemplate,
+		UsernameAttribute:    ldapProvider.UsernameAttribute,
+		EmailAttribute:       ldapProvider.EmailAttribute,
+		GroupBaseDn:          ldapProvider.GroupBaseDn.ToNillablePtr(),
+		GroupFilter:          ldapProvider.GroupFilter,
+		GroupNameAttribute:   ldapProvider.GroupNameAttribute,
+		GroupMemberAttribute: ldapProvider.GroupMemberAttribute,
+		Enabled:              ldapProvider.Enabled,
+		LastSyncedAt:         ldapProvider.LastSyncedAt.ToNillablePtr(),
+		CreatedAt:            ldapProvider.AuditCreatedAt,
+	}
+}
+
+func FindLdapProviders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProviders := ldapProviderRepository.FindLdapProviders(ctx, repos.LdapProviderFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+		},
+		RealmId: h.Some(realm.Id),
+	})
+
+	rows := iter.Map(ldapProviders.Values(), mapLdapProviderResponse)
+
+	writeFindResponse(w, rows, ldapProviders.Count())
+}
+
+type UpdateLdapProviderRequest struct {
+	DisplayName  *string `json:"displayName"`
+	Url          *string `json:"url"`
+	StartTls     *bool   `json:"startTls"`
+	BindDn       *string `json:"bindDn"`
+	BindPassword *string `json:"bindPassword"`
+
+	UserBaseDn        *string `json:"userBaseDn"`
+	UserFilter        *string `json:"userFilter"`
+	UserDnTemplate    *string `json:"userDnTemplate"`
+	UsernameAttribute *string `json:"usernameAttribute"`
+	EmailAttribute    *string `json:"emailAttribute"`
+
+	GroupBaseDn          *string `json:"groupBaseDn"`
+	GroupFilter          *string `json:"groupFilter"`
+	GroupNameAttribute   *string `json:"groupNameAttribute"`
+	GroupMemberAttribute *string `json:"groupMemberAttribute"`
+
+	Enabled *bool `json:"enabled"`
+}
+
+func UpdateLdapProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := UpdateLdapProviderRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	ldapProvider := findRequestLdapProvider(r)
+
+	if request.Url != nil {
+		validateLdapUrl(*request.Url)
+	}
+	if request.UserDnTemplate != nil {
+		validateUserDnTemplate(*request.UserDnTemplate)
+	}
+
+	// an empty bind dn, bind password or group base dn clears the value
+	upd := repos.LdapProviderUpdate{
+		DisplayName:          h.FromPtr(request.DisplayName),
+		Url:                  h.FromPtr(request.Url),
+		StartTls:             h.FromPtr(request.StartTls),
+		BindDn:               h.MapOpt(h.FromPtr(request.BindDn), h.FromDefault[string]),
+		UserBaseDn:           h.FromPtr(request.UserBaseDn),
+		UserFilter:           h.FromPtr(request.UserFilter),
+		UserDnTemplate:       h.FromPtr(request.UserDnTemplate),
+		UsernameAttribute:    h.FromPtr(request.UsernameAttribute),
+		EmailAttribute:       h.FromPtr(request.EmailAttribute),
+		GroupBaseDn:          h.MapOpt(h.FromPtr(request.GroupBaseDn), h.FromDefault[string]),
+		GroupFilter:          h.FromPtr(request.GroupFilter),
+		GroupNameAttribute:   h.FromPtr(request.GroupNameAttribute),
+		GroupMemberAttribute: h.FromPtr(request.GroupMemberAttribute),
+		Enabled:              h.FromPtr(request.Enabled),
+	}
+
+	if request.BindPassword != nil {
+		upd.EncryptedBindPassword = h.Some(h.None[[]byte]())
+		if *request.BindPassword != "" {
+			ldapFederationService := ioc.Get[services.LdapFederationService](scope)
+			upd.EncryptedBindPassword = h.Some(h.Some(ldapFederationService.EncryptBindPassword(*request.BindPassword)))
+		}
+	}
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProviderRepository.UpdateLdapProvider(ctx, ldapProvider.Id, upd)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func DeleteLdapProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	ldapProvider := findRequestLdapProvider(r)
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProviderRepository.DeleteLdapProvider(ctx, ldapProvider.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func SyncLdapProvider(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	ldapProvider := findRequestLdapProvider(r)
+
+	ldapFederationService := ioc.Get[services.LdapFederationService](scope)
+	err := ldapFederationService.SyncProvider(ctx, ldapProvider)
+	if err != nil {
+		panic(httpErrors.NewHttpError(http.StatusBadGateway).WithMessage("could not sync the ldap provider: " + err.Error()))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func findRequestLdapProvider(r *http.Request) repos.LdapProvider {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid id"))
+	}
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProvider, ok := ldapProviderRepository.FindLdapProviderById(ctx, id).Get()
+	if !ok || ldapProvider.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("ldap provider not found"))
+	}
+
+	return ldapProvider
+}
+
+func validateLdapUrl(ldapUrl string) {
+	parsed, err := url.Parse(ldapUrl)
+	if err != nil || (parsed.Scheme != "ldap" && parsed.Scheme != "ldaps") || parsed.Host == "" {
+		panic(httpErrors.BadRequest().WithMessage("the url has to be an ldap:// or ldaps:// url"))
+	}
+}
+
+func validateUserDnTemplate(userDnTemplate string) {
+	if !strings.Contains(userDnTemplate, "{username}") {
+		panic(httpErrors.BadRequest().WithMessage("the userDnTemplate has to contain {username}"))
+	}
+}
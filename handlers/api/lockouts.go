@@ -0,0 +1,134 @@
+package api
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sourcegraph/conc/iter"
+	"holvit/config"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+	"time"
+)
+
+type LockoutResponse struct {
+	UserId      *uuid.UUID `json:"userId"`
+	Ip          *string    `json:"ip"`
+	Failures    int        `json:"failures"`
+	LockedUntil *time.Time `json:"lockedUntil"`
+	Permanent   bool       `json:"permanent"`
+}
+
+func mapLockoutResponse(lockout *services.Lockout) LockoutResponse {
+	return LockoutResponse{
+		UserId:      lockout.UserId.ToNillablePtr(),
+		Ip:          lockout.Ip.ToNillablePtr(),
+		Failures:    lockout.Failures,
+		LockedUntil: h.SomeIf(!lockout.Permanent, lockout.LockedUntil).ToNillablePtr(),
+		Permanent:   lockout.Permanent,
+	}
+}
+
+func FindLockouts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	bruteForceService := ioc.Get[services.BruteForceService](scope)
+	lockouts := bruteForceService.FindLockouts(ctx, realm.Id)
+
+	rows := iter.Map(lockouts, mapLockoutResponse)
+
+	writeFindResponse(w, rows, len(rows))
+}
+
+func ClearUserLockout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	userId, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid user id"))
+	}
+
+	bruteForceService := ioc.Get[services.BruteForceService](scope)
+	if !bruteForceService.ClearUserLockout(ctx, realm.Id, userId, utils.GetRequestIp(r, config.C.GetTrustedProxies())) {
+		panic(httpErrors.NotFound().WithMessage("lockout not found"))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ClearIpLockout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	bruteForceService := ioc.Get[services.BruteForceService](scope)
+	if !bruteForceService.ClearIpLockout(ctx, realm.Id, mux.Vars(r)["ip"], utils.GetRequestIp(r, config.C.GetTrustedProxies())) {
+		panic(httpErrors.NotFound().WithMessage("lockout not found"))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type SecurityEventResponse struct {
+	Id        uuid.UUID  `json:"id"`
+	UserId    *uuid.UUID `json:"userId"`
+	Type      string     `json:"type"`
+	IpAddress string     `json:"ipAddress"`
+	Details   string     `json:"details"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func mapSecurityEventResponse(securityEvent *repos.SecurityEvent) SecurityEventResponse {
+	return SecurityEventResponse{
+		Id:        securityEvent.Id,
+		UserId:    securityEvent.UserId.ToNillablePtr(),
+		Type:      securityEvent.Type,
+		IpAddress: securityEvent.IpAddress,
+		Details:   securityEvent.Details,
+		CreatedAt: securityEvent.AuditCreatedAt,
+	}
+}
+
+func FindSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	realm := getRequestRealm(r)
+
+	userId := h.None[uuid.UUID]()
+	if userIdString := r.URL.Query().Get("userId"); userIdString != "" {
+		parsed, err := uuid.Parse(userIdString)
+		if err != nil {
+			panic(httpErrors.BadRequest().WithMessage("invalid query parameter 'userId'"))
+		}
+		userId = h.Some(parsed)
+	}
+
+	eventType := r.URL.Query().Get("type")
+
+	securityEventRepository := ioc.Get[repos.SecurityEventRepository](scope)
+	securityEvents := securityEventRepository.FindSecurityEvents(ctx, repos.SecurityEventFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: pagingFromQuery(r),
+		},
+		RealmId: realm.Id,
+		UserId:  userId,
+		Type:    h.SomeIf(eventType != "", eventType),
+	})
+
+	rows := iter.Map(securityEvents.Values(), mapSecurityEventResponse)
+
+	writeFindResponse(w, rows, securityEvents.Count())
+}
@@ -1,12 +1,22 @@
 package api
 
 import (
+	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/sourcegraph/conc/iter"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
+	"holvit/passwordpolicy"
+	"holvit/realmconfig"
+	"holvit/realmexport"
 	"holvit/repos"
+	"holvit/services"
 	"net/http"
+	"slices"
+	"strconv"
 )
 
 type RealmResponse struct {
@@ -34,3 +44,260 @@ func FindRealms(w http.ResponseWriter, r *http.Request) {
 
 	writeFindResponse(w, rows, realms.Count())
 }
+
+type UpdateRealmRequest struct {
+	DisplayName               *string `json:"displayName"`
+	RequireUsername           *bool   `json:"requireUsername"`
+	RequireEmail              *bool   `json:"requireEmail"`
+	RequireDeviceVerification *bool   `json:"requireDeviceVerification"`
+	RequireTotp               *bool   `json:"requireTotp"`
+	RequireWebauthn           *bool   `json:"requireWebauthn"`
+	EnableRememberMe          *bool   `json:"enableRememberMe"`
+	EmailLoginMode            *string `json:"emailLoginMode"`
+	RequireEmailVerification  *bool   `json:"requireEmailVerification"`
+
+	PasswordPolicy        *passwordpolicy.Policy `json:"passwordPolicy"`
+	PasswordHistoryLength *int                   `json:"passwordHistoryLength"`
+
+	EnableRegistration           *bool        `json:"enableRegistration"`
+	RegistrationRequiresApproval *bool        `json:"registrationRequiresApproval"`
+	DefaultRoleIds               *[]uuid.UUID `json:"defaultRoleIds"`
+
+	ConsentExpirySeconds json.RawMessage `json:"consentExpirySeconds"`
+	AuthenticationFlowId json.RawMessage `json:"authenticationFlowId"`
+
+	BruteForceProtection            *bool           `json:"bruteForceProtection"`
+	BruteForceMaxFailures           *int            `json:"bruteForceMaxFailures"`
+	BruteForceIpMaxFailures         *int            `json:"bruteForceIpMaxFailures"`
+	BruteForceLockoutSeconds        *int            `json:"bruteForceLockoutSeconds"`
+	BruteForceMaxDelaySeconds       *int            `json:"bruteForceMaxDelaySeconds"`
+	BruteForcePermanentLockoutAfter json.RawMessage `json:"bruteForcePermanentLockoutAfter"`
+}
+
+func UpdateRealm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	request := UpdateRealmRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	if request.EmailLoginMode != nil && !slices.Contains(constants.EmailLoginModes, *request.EmailLoginMode) {
+		panic(httpErrors.BadRequest().WithMessage("invalid email login mode"))
+	}
+
+	realm := getRequestRealm(r)
+
+	if request.DefaultRoleIds != nil {
+		// default roles have to be realm roles of this realm
+		roleRepository := ioc.Get[repos.RoleRepository](scope)
+		roles := roleRepository.FindRoles(ctx, repos.RoleFilter{
+			RealmId:      realm.Id,
+			RoleIds:      h.Some(*request.DefaultRoleIds),
+			IsClientRole: h.Some(false),
+		})
+		if roles.Count() != len(*request.DefaultRoleIds) {
+			panic(httpErrors.BadRequest().WithMessage("invalid default roles"))
+		}
+	}
+
+	passwordPolicy := h.None[repos.PasswordPolicy]()
+	if request.PasswordPolicy != nil {
+		err := passwordpolicy.Validate(*request.PasswordPolicy)
+		if err != nil {
+			panic(httpErrors.BadRequest().WithMessage("invalid password policy: " + err.Error()))
+		}
+		passwordPolicy = h.Some(repos.PasswordPolicy(*request.PasswordPolicy))
+	}
+	if request.PasswordHistoryLength != nil && *request.PasswordHistoryLength < 0 {
+		panic(httpErrors.BadRequest().WithMessage("passwordHistoryLength must not be negative"))
+	}
+
+	for _, threshold := range []*int{request.BruteForceMaxFailures, request.BruteForceIpMaxFailures, request.BruteForceLockoutSeconds} {
+		if threshold != nil && *threshold < 1 {
+			panic(httpErrors.BadRequest().WithMessage("brute force thresholds have to be positive"))
+		}
+	}
+	if request.BruteForceMaxDelaySeconds != nil && *request.BruteForceMaxDelaySeconds < 0 {
+		panic(httpErrors.BadRequest().WithMessage("bruteForceMaxDelaySeconds must not be negative"))
+	}
+
+	permanentLockoutAfter := nullableFromRaw[int](request.BruteForcePermanentLockoutAfter)
+	permanentLockoutAfter.IfSome(func(x h.Opt[int]) {
+		if x.IsSome() && x.Unwrap() < 1 {
+			panic(httpErrors.BadRequest().WithMessage("bruteForcePermanentLockoutAfter has to be positive"))
+		}
+	})
+
+	authenticationFlowId := nullableFromRaw[uuid.UUID](request.AuthenticationFlowId)
+	authenticationFlowId.IfSome(func(x h.Opt[uuid.UUID]) {
+		x.IfSome(func(flowId uuid.UUID) {
+			validateAuthenticationFlowId(r, flowId)
+		})
+	})
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realmRepository.UpdateRealm(ctx, realm.Id, repos.RealmUpdate{
+		DisplayName:                  h.FromPtr(request.DisplayName),
+		RequireUsername:              h.FromPtr(request.RequireUsername),
+		RequireEmail:                 h.FromPtr(request.RequireEmail),
+		RequireDeviceVerification:    h.FromPtr(request.RequireDeviceVerification),
+		RequireTotp:                  h.FromPtr(request.RequireTotp),
+		RequireWebauthn:              h.FromPtr(request.RequireWebauthn),
+		EnableRememberMe:             h.FromPtr(request.EnableRememberMe),
+		EmailLoginMode:               h.FromPtr(request.EmailLoginMode),
+		RequireEmailVerification:     h.FromPtr(request.RequireEmailVerification),
+		PasswordPolicy:               passwordPolicy,
+		PasswordHistoryLength:        h.FromPtr(request.PasswordHistoryLength),
+		EnableRegistration:           h.FromPtr(request.EnableRegistration),
+		RegistrationRequiresApproval: h.FromPtr(request.RegistrationRequiresApproval),
+		DefaultRoleIds:               h.FromPtr(request.DefaultRoleIds),
+		ConsentExpirySeconds:         nullableFromRaw[int](request.ConsentExpirySeconds),
+		AuthenticationFlowId:         authenticationFlowId,
+
+		BruteForceProtection:            h.FromPtr(request.BruteForceProtection),
+		BruteForceMaxFailures:           h.FromPtr(request.BruteForceMaxFailures),
+		BruteForceIpMaxFailures:         h.FromPtr(request.BruteForceIpMaxFailures),
+		BruteForceLockoutSeconds:        h.FromPtr(request.BruteForceLockoutSeconds),
+		BruteForceMaxDelaySeconds:       h.FromPtr(request.BruteForceMaxDelaySeconds),
+		BruteForcePermanentLockoutAfter: permanentLockoutAfter,
+	}).Unwrap()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ExportRealm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	includeUsers := false
+	if value := r.URL.Query().Get("includeUsers"); value != "" {
+		var err error
+		includeUsers, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(httpErrors.BadRequest().WithMessage("invalid query parameter 'includeUsers'"))
+		}
+	}
+
+	realm := getRequestRealm(r)
+
+	realmExportService := ioc.Get[services.RealmExportService](scope)
+	document := realmExportService.ExportRealm(ctx, realm.Id, includeUsers)
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(document)
+	if err != nil {
+		panic(err)
+	}
+}
+
+type ImportRealmResponse struct {
+	Id            uuid.UUID         `json:"id"`
+	ClientSecrets map[string]string `json:"clientSecrets"`
+}
+
+func ImportRealm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	policy := r.URL.Query().Get("policy")
+	if policy == "" {
+		policy = realmexport.PolicyCreate
+	}
+
+	document := realmexport.Document{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&document)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid request body"))
+	}
+
+	realmExportService := ioc.Get[services.RealmExportService](scope)
+	result := realmExportService.ImportRealm(ctx, services.ImportRealmRequest{
+		Document: document,
+		Policy:   policy,
+	}).Unwrap()
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(ImportRealmResponse{
+		Id:            result.RealmId,
+		ClientSecrets: result.ClientSecrets,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type ReconcileRealmsResponse struct {
+	Changes       []ReconcileRealmsChange       `json:"changes"`
+	ClientSecrets []ReconcileRealmsClientSecret `json:"clientSecrets"`
+}
+
+type ReconcileRealmsChange struct {
+	Action string   `json:"action"`
+	Kind   string   `json:"kind"`
+	Realm  string   `json:"realm"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+type ReconcileRealmsClientSecret struct {
+	Realm    string `json:"realm"`
+	ClientId string `json:"clientId"`
+	Secret   string `json:"secret"`
+}
+
+func ReconcileRealms(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	dryRun := false
+	if value := r.URL.Query().Get("dryRun"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(httpErrors.BadRequest().WithMessage("invalid query parameter 'dryRun'"))
+		}
+	}
+
+	realmConfigService := ioc.Get[services.RealmConfigService](scope)
+	realms := realmConfigService.LoadDeclaredRealms().Unwrap()
+	if len(realms) == 0 {
+		panic(httpErrors.BadRequest().WithMessage("no realms are declared"))
+	}
+
+	result := realmConfigService.ReconcileRealms(ctx, services.ReconcileRealmsRequest{
+		Realms: realms,
+		DryRun: dryRun,
+	}).Unwrap()
+
+	response := ReconcileRealmsResponse{
+		Changes: iter.Map(result.Changes, func(change *realmconfig.Change) ReconcileRealmsChange {
+			return ReconcileRealmsChange{
+				Action: change.Action,
+				Kind:   change.Kind,
+				Realm:  change.Realm,
+				Name:   change.Name,
+				Fields: change.Fields,
+			}
+		}),
+		ClientSecrets: iter.Map(result.ClientSecrets, func(secret *services.GeneratedClientSecret) ReconcileRealmsClientSecret {
+			return ReconcileRealmsClientSecret{
+				Realm:    secret.Realm,
+				ClientId: secret.ClientId,
+				Secret:   secret.Secret,
+			}
+		}),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -3,13 +3,22 @@ package api
 import (
 	"encoding/json"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/sourcegraph/conc/iter"
+	"holvit/config"
 	"holvit/h"
+	"holvit/httpErrors"
 	"holvit/ioc"
+	"holvit/logging"
 	"holvit/middlewares"
 	"holvit/repos"
 	"holvit/services"
+	"holvit/userimport"
+	"holvit/utils"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type CreateUserRequest struct {
@@ -40,18 +49,20 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 type UserRepsonse struct {
-	Id            uuid.UUID `json:"id"`
-	Username      string    `json:"username"`
-	Email         *string   `json:"email"`
-	EmailVerified bool      `json:"emailVerified"`
+	Id              uuid.UUID `json:"id"`
+	Username        string    `json:"username"`
+	Email           *string   `json:"email"`
+	EmailVerified   bool      `json:"emailVerified"`
+	ApprovalPending bool      `json:"approvalPending"`
 }
 
 func mapUserResponse(user *repos.User) UserRepsonse {
 	return UserRepsonse{
-		Id:            user.Id,
-		Username:      user.Username,
-		Email:         user.Email.ToNillablePtr(),
-		EmailVerified: user.EmailVerified,
+		Id:              user.Id,
+		Username:        user.Username,
+		Email:           user.Email.ToNillablePtr(),
+		EmailVerified:   user.EmailVerified,
+		ApprovalPending: user.ApprovalPending,
 	}
 }
 
@@ -75,6 +86,10 @@ func FindUsers(w http.ResponseWriter, r *http.Request) {
 		RealmId: h.Some(realm.Id),
 	}
 
+	if approvalPending, err := strconv.ParseBool(r.URL.Query().Get("approvalPending")); err == nil {
+		filter.ApprovalPending = h.Some(approvalPending)
+	}
+
 	userRepository := ioc.Get[repos.UserRepository](scope)
 	users := userRepository.FindUsers(ctx, filter)
 
@@ -82,3 +97,106 @@ func FindUsers(w http.ResponseWriter, r *http.Request) {
 
 	writeFindResponse(w, rows, users.Count())
 }
+
+func ApproveUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	userId, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage("invalid user id"))
+	}
+
+	realm := getRequestRealm(r)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || user.RealmId != realm.Id {
+		panic(httpErrors.NotFound().WithMessage("user not found"))
+	}
+
+	userService := ioc.Get[services.UserService](scope)
+	err = userService.ApproveUser(ctx, user.Id)
+	if err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ImportUsersResponse struct {
+	Created int                      `json:"created"`
+	Skipped int                      `json:"skipped"`
+	Failed  int                      `json:"failed"`
+	Errors  []ImportUsersRowResponse `json:"errors"`
+	// Error is set if the import was aborted because the body could not be read, the counts cover the rows before.
+	Error *string `json:"error,omitempty"`
+}
+
+type ImportUsersRowResponse struct {
+	Row      int    `json:"row"`
+	Username string `json:"username"`
+	Message  string `json:"message"`
+}
+
+func ImportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	// imports are streamed and can take a lot longer than normal requests
+	middlewares.RaiseMaxReadBytes(w, r, config.C.Server.MaxImportBytes)
+	controller := http.NewResponseController(w)
+	deadline := time.Now().Add(config.C.Server.ImportTimeout)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		logging.Logger.Warnf("could not extend the read deadline of the user import: %v", err)
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		logging.Logger.Warnf("could not extend the write deadline of the user import: %v", err)
+	}
+
+	realm := getRequestRealm(r)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = userimport.FormatJsonLines
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = userimport.FormatCsv
+		}
+	}
+
+	reader, err := userimport.NewReader(r.Body, format)
+	if err != nil {
+		panic(httpErrors.BadRequest().WithMessage(err.Error()))
+	}
+
+	userImportService := ioc.Get[services.UserImportService](scope)
+	result, err := userImportService.ImportUsers(ctx, services.ImportUsersRequest{
+		RealmId: realm.Id,
+		Reader:  reader,
+	})
+
+	response := ImportUsersResponse{
+		Created: result.Created,
+		Skipped: result.Skipped,
+		Failed:  result.Failed,
+		Errors: utils.NonNilSlice(iter.Map(result.Errors, func(e *services.ImportUsersError) ImportUsersRowResponse {
+			return ImportUsersRowResponse{
+				Row:      e.Row,
+				Username: e.Username,
+				Message:  e.Message,
+			}
+		})),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		message := err.Error()
+		response.Error = &message
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+)
+
+func BrokerLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		rcs.Error(httpErrors.BadRequest().WithMessage("Missing token"))
+		return
+	}
+
+	identityBrokerService := ioc.Get[services.IdentityBrokerService](scope)
+	redirectUrl, err := identityBrokerService.StartLogin(ctx, services.StartBrokerLoginRequest{
+		RealmName:  routeParams["realmName"],
+		Alias:      routeParams["alias"],
+		LoginToken: token,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	http.Redirect(w, r, redirectUrl, http.StatusFound)
+}
+
+func BrokerCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	query := r.URL.Query()
+
+	identityBrokerService := ioc.Get[services.IdentityBrokerService](scope)
+	result, err := identityBrokerService.CompleteLogin(ctx, services.CompleteBrokerLoginRequest{
+		RealmName: routeParams["realmName"],
+		Alias:     routeParams["alias"],
+		State:     query.Get("state"),
+		Code:      query.Get("code"),
+		Error:     query.Get("error"),
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo, err := continueLogin(ctx, result.LoginToken, result.UserId, constants.AuthenticateStepBrokerLogin)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	if loginInfo.NextStep == constants.AuthenticateStepSubmit {
+		err = finishLogin(w, r, result.LoginToken)
+		if err != nil {
+			rcs.Error(err)
+		}
+		return
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, loginInfo.RealmId).Unwrap()
+
+	writeLoginFrontend(w, r, realm, result.LoginToken, *loginInfo)
+}
+
+type BrokerLoginStep struct {
+}
+
+func (s *BrokerLoginStep) Name() string {
+	return constants.AuthenticateStepBrokerLogin
+}
+
+// NeedsToRun applies to users that have an upstream identity linked, before the user is known it applies
+// if the realm has an enabled identity provider.
+func (s *BrokerLoginStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if info.UserId == uuid.Nil {
+		identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+		return identityProviderRepository.FindIdentityProviders(ctx, repos.IdentityProviderFilter{
+			RealmId: h.Some(info.RealmId),
+			Enabled: h.Some(true),
+		}).Any(), nil
+	}
+
+	federatedIdentityRepository := ioc.Get[repos.FederatedIdentityRepository](scope)
+	federatedIdentities := federatedIdentityRepository.FindFederatedIdentities(ctx, repos.FederatedIdentityFilter{
+		UserId: h.Some(info.UserId),
+	})
+	return len(federatedIdentities.Values()) > 0, nil
+}
+
+func (s *BrokerLoginStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
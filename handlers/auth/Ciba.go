@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"github.com/gorilla/mux"
+	"holvit/constants"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/routes"
+	"holvit/services"
+	"net/http"
+)
+
+func CibaDecision(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		rcs.Error(httpErrors.BadRequest().WithMessage("Missing token"))
+		return
+	}
+
+	cibaService := ioc.Get[services.CibaService](scope)
+	decision, err := cibaService.GetDecision(ctx, realmName, token)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	// the user signs in before deciding, the login runs the authentication flow of the requesting client
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	if !currentUser.IsAuthorized() {
+		err = StartLogin(w, r, realmName, decision.Client.ClientId, r.URL.String())
+		if err != nil {
+			rcs.Error(err)
+		}
+		return
+	}
+	if currentUser.UserId() != decision.User.Id {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("the authentication request is for another user"))
+		return
+	}
+
+	scopes := make([]services.AuthFrontendScope, 0, len(decision.Scopes))
+	for _, oidcScope := range decision.Scopes {
+		scopes = append(scopes, services.AuthFrontendScope{
+			Required:    true,
+			Name:        oidcScope.Name,
+			DisplayName: oidcScope.DisplayName,
+			Description: oidcScope.Description,
+		})
+	}
+
+	frontendData := services.AuthFrontendData{
+		Mode: constants.FrontendModeCiba,
+		Ciba: &services.AuthFrontendDataCiba{
+			ClientName: decision.Client.DisplayName,
+			User: services.AuthFrontendUser{
+				Name: decision.User.Username,
+			},
+			BindingMessage: decision.BindingMessage,
+			Scopes:         scopes,
+			Token:          token,
+			DecisionUrl:    routes.AuthCiba.Url(realmName),
+		},
+	}
+
+	frontendService := ioc.Get[services.FrontendService](scope)
+	frontendService.WriteAuthFrontend(w, realmName, frontendData)
+}
+
+func DecideCiba(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	if err := r.ParseForm(); err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	token := r.Form.Get("token")
+	if token == "" {
+		rcs.Error(httpErrors.BadRequest().WithMessage("Missing token"))
+		return
+	}
+
+	var approve bool
+	switch r.Form.Get("decision") {
+	case "approve":
+		approve = true
+	case "deny":
+		approve = false
+	default:
+		rcs.Error(httpErrors.BadRequest().WithMessage("decision must be either 'approve' or 'deny'"))
+		return
+	}
+
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	if !currentUser.IsAuthorized() {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("not signed in"))
+		return
+	}
+
+	cibaService := ioc.Get[services.CibaService](scope)
+	err := cibaService.Decide(ctx, services.CibaDecisionRequest{
+		RealmName: realmName,
+		Token:     token,
+		UserId:    currentUser.UserId(),
+		Approve:   approve,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
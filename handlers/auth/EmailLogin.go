@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+)
+
+type StartEmailLoginRequest struct {
+	Email      string `json:"email"`
+	Token      string `json:"token"`
+	RememberMe bool   `json:"rememberMe"`
+}
+
+type VerifyEmailLoginRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// StartEmailLogin is the passwordless alternative to VerifyPassword, it sends a code or magic link to the email.
+func StartEmailLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request StartEmailLoginRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	emailLoginService := ioc.Get[services.EmailLoginService](scope)
+	err = emailLoginService.StartLogin(ctx, services.StartEmailLoginRequest{
+		LoginToken: request.Token,
+		Email:      request.Email,
+		RememberMe: request.RememberMe,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(VerifyLoginStepResponse{
+		NextStep: constants.AuthenticateStepVerifyEmailLogin,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+// VerifyEmailLogin completes an email login with the code that was sent to the user.
+func VerifyEmailLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request VerifyEmailLoginRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	emailLoginService := ioc.Get[services.EmailLoginService](scope)
+	result, err := emailLoginService.VerifyCode(ctx, services.VerifyEmailLoginCodeRequest{
+		LoginToken: request.Token,
+		Code:       request.Code,
+		Ip:         utils.GetRequestIp(r, config.C.GetTrustedProxies()),
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo, err := continueLogin(ctx, result.LoginToken, result.UserId, constants.AuthenticateStepVerifyEmailLogin)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(VerifyLoginStepResponse{
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+// MagicLinkLogin completes an email login with the link that was sent to the user.
+// The login page is shown again if there are steps left, otherwise the login is finished right away.
+func MagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realmName := mux.Vars(r)["realmName"]
+	query := r.URL.Query()
+
+	emailLoginService := ioc.Get[services.EmailLoginService](scope)
+	result, err := emailLoginService.VerifyMagicLink(ctx, services.VerifyMagicLinkRequest{
+		RealmName: realmName,
+		Token:     query.Get("token"),
+		Signature: query.Get("signature"),
+		Ip:        utils.GetRequestIp(r, config.C.GetTrustedProxies()),
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo, err := continueLogin(ctx, result.LoginToken, result.UserId, constants.AuthenticateStepVerifyEmailLogin)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	if loginInfo.NextStep == constants.AuthenticateStepSubmit {
+		err = finishLogin(w, r, result.LoginToken)
+		if err != nil {
+			rcs.Error(err)
+		}
+		return
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, loginInfo.RealmId).Unwrap()
+
+	writeLoginFrontend(w, r, realm, result.LoginToken, *loginInfo)
+}
+
+type VerifyEmailLoginStep struct {
+}
+
+func (s *VerifyEmailLoginStep) Name() string {
+	return constants.AuthenticateStepVerifyEmailLogin
+}
+
+// NeedsToRun applies if the realm allows email logins. Once the user is known, the code or link can only be sent
+// to the email of that user, so the step then also requires the user to have an email.
+func (s *VerifyEmailLoginStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, info.RealmId).Unwrap()
+	if realm.EmailLoginMode == constants.EmailLoginModeDisabled {
+		return false, nil
+	}
+
+	if info.UserId == uuid.Nil {
+		return true, nil
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, info.UserId).Unwrap()
+	return user.Email.IsSome(), nil
+}
+
+func (s *VerifyEmailLoginStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
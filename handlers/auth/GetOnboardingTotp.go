@@ -4,7 +4,6 @@ import (
 	"encoding/base32"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"holvit/config"
 	"holvit/constants"
 	"holvit/httpErrors"
@@ -45,10 +44,10 @@ func GetOnboardingTotp(w http.ResponseWriter, r *http.Request) {
 		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
 	}
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepTotpOnboarding {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepTotpOnboarding)))
+	currentStep := constants.AuthenticateStepTotpOnboarding
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
 		return
 	}
 
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+)
+
+type WebauthnOptionsRequest struct {
+	Token string `json:"token"`
+}
+
+// GetWebauthnOptions starts the webauthn ceremony of the current login step and returns the options for
+// navigator.credentials.create or navigator.credentials.get. Before the user is known it starts a passwordless login.
+func GetWebauthnOptions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request WebauthnOptionsRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo := tokenService.PeekLoginCode(ctx, request.Token).UnwrapErr(httpErrors.BadRequest().WithMessage("token not found"))
+
+	// before the user is known a passwordless login is started
+	passwordless := loginInfo.UserId == uuid.Nil
+	if !passwordless {
+		currentUser := ioc.Get[services.CurrentSessionService](scope)
+		if currentUser.DeviceIdString() != loginInfo.DeviceId {
+			rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+			return
+		}
+	}
+
+	// the first webauthn step the user can continue with, the next step takes precedence over the alternatives
+	currentStep := ""
+	for _, step := range append([]string{loginInfo.NextStep}, loginInfo.AllowedSteps...) {
+		if step == constants.AuthenticateStepWebauthnOnboarding || step == constants.AuthenticateStepVerifyWebauthn {
+			currentStep = step
+			break
+		}
+	}
+
+	webauthnService := ioc.Get[services.WebauthnService](scope)
+
+	var options any
+	switch {
+	case passwordless && currentStep == constants.AuthenticateStepVerifyWebauthn:
+		assertion, session, err := webauthnService.BeginLogin(ctx, loginInfo.RealmId, h.None[uuid.UUID]())
+		if err != nil {
+			rcs.Error(err)
+			return
+		}
+		options = assertion
+		loginInfo.WebauthnSession = session
+	case !passwordless && currentStep == constants.AuthenticateStepWebauthnOnboarding:
+		creation, session, err := webauthnService.BeginRegistration(ctx, loginInfo.UserId)
+		if err != nil {
+			rcs.Error(err)
+			return
+		}
+		options = creation
+		loginInfo.WebauthnSession = session
+	case !passwordless && currentStep == constants.AuthenticateStepVerifyWebauthn:
+		assertion, session, err := webauthnService.BeginLogin(ctx, loginInfo.RealmId, h.Some(loginInfo.UserId))
+		if err != nil {
+			rcs.Error(err)
+			return
+		}
+		options = assertion
+		loginInfo.WebauthnSession = session
+	default:
+		rcs.Error(httpErrors.Unauthorized().WithMessage(
+			fmt.Sprintf("wrong login step '%s', webauthn is not used in this step", loginInfo.NextStep)))
+		return
+	}
+
+	tokenService.OverwriteLoginCode(ctx, request.Token, loginInfo).SetErr(httpErrors.BadRequest().WithMessage("token not found")).Unwrap()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(options)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
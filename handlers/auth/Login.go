@@ -2,19 +2,100 @@ package auth
 
 import (
 	"context"
-	"fmt"
 	"github.com/google/uuid"
+	"holvit/config"
 	"holvit/constants"
+	"holvit/h"
 	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
 	"holvit/repos"
 	"holvit/requestContext"
+	"holvit/routes"
 	"holvit/services"
 	"holvit/utils"
 	"net/http"
 )
 
+// StartLogin renders the login page of the realm, after a successful login the user is sent back to the original url.
+// StartLogin shows the login page, the clientId selects the authentication flow if the client has one of its own.
+func StartLogin(w http.ResponseWriter, r *http.Request, realmName string, clientId string, originalUrl string) error {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).Single()
+
+	authenticationFlowService := ioc.Get[services.AuthenticationFlowService](scope)
+	loginInfo := services.LoginInfo{
+		RealmId:              realm.Id,
+		OriginalUrl:          originalUrl,
+		AuthenticationFlowId: authenticationFlowService.FindFlowForLogin(ctx, realm.Id, clientId),
+	}
+
+	firstStep, err := evaluateFlow(ctx, &loginInfo)
+	if err != nil {
+		return err
+	}
+	err = firstStep.Prepare(ctx, &loginInfo)
+	if err != nil {
+		return err
+	}
+	loginInfo.NextStep = firstStep.Name()
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginToken := tokenService.StoreLoginCode(ctx, loginInfo)
+
+	writeLoginFrontend(w, r, realm, loginToken, loginInfo)
+	return nil
+}
+
+// writeLoginFrontend renders the login page for the login token at the current step of the login.
+func writeLoginFrontend(w http.ResponseWriter, r *http.Request, realm repos.Realm, loginToken string, loginInfo services.LoginInfo) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	identityBrokerService := ioc.Get[services.IdentityBrokerService](scope)
+
+	identityProviders := make([]services.AuthFrontendIdentityProvider, 0)
+	if loginInfo.IsStepAllowed(constants.AuthenticateStepBrokerLogin) {
+		identityProviders = identityBrokerService.LoginOptions(ctx, realm, loginToken)
+	}
+
+	registerUrl := ""
+	if loginInfo.IsStepAllowed(constants.AuthenticateStepVerifyRegistration) {
+		registerUrl = routes.ApiRegister.Url(realm.Name)
+	}
+
+	frontendData := services.AuthFrontendData{
+		Mode: constants.FrontendModeAuthenticate,
+		Authenticate: &services.AuthFrontendDataAuthenticate{
+			ClientName:        "TODO (client name)",
+			Token:             loginToken,
+			UseRememberMe:     realm.EnableRememberMe,
+			RegisterUrl:       registerUrl,
+			LoginCompleteUrl:  routes.LoginComplete.Url(realm.Name),
+			IdentityProviders: identityProviders,
+			EmailLoginMode:    realm.EmailLoginMode,
+			RequireUsername:   realm.RequireUsername,
+			RequireEmail:      realm.RequireEmail,
+			ForgotPasswordUrl: routes.ApiForgotPassword.Url(realm.Name),
+			NextStep:          loginInfo.NextStep,
+			AllowedSteps:      loginInfo.AllowedSteps,
+		},
+	}
+
+	frontendService := ioc.Get[services.FrontendService](scope)
+
+	frontendService.WriteAuthFrontend(w, realm.Name, frontendData)
+}
+
 func CompleteAuthFlow(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	scope := middlewares.GetScope(ctx)
@@ -26,8 +107,23 @@ func CompleteAuthFlow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = finishLogin(w, r, r.Form.Get("token"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+// finishLogin creates the session of a login that completed all steps and sends the user back to the original url.
+func finishLogin(w http.ResponseWriter, r *http.Request, loginToken string) error {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
 	tokenService := ioc.Get[services.TokenService](scope)
-	loginInfo := tokenService.RetrieveLoginCode(ctx, r.Form.Get("token")).UnwrapErr(httpErrors.BadRequest().WithMessage("token not found"))
+	loginInfo, ok := tokenService.RetrieveLoginCode(ctx, loginToken).Get()
+	if !ok {
+		return httpErrors.BadRequest().WithMessage("token not found")
+	}
 
 	realmRepository := ioc.Get[repos.RealmRepository](scope)
 	realm := realmRepository.FindRealmById(ctx, loginInfo.RealmId).Unwrap()
@@ -35,16 +131,22 @@ func CompleteAuthFlow(w http.ResponseWriter, r *http.Request) {
 	currentUser := ioc.Get[services.CurrentSessionService](scope)
 	deviceIdString := currentUser.DeviceIdString()
 	if deviceIdString != loginInfo.DeviceId {
-		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return httpErrors.Unauthorized().WithMessage("wrong device id")
 	}
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepSubmit {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepSubmit)))
-		return
+	err := loginInfo.ExpectStep(constants.AuthenticateStepSubmit)
+	if err != nil {
+		return err
 	}
 
+	// the failures are only reset once all steps succeeded, a correct password alone does not reset them
+	bruteForceService := ioc.Get[services.BruteForceService](scope)
+	bruteForceService.RecordSuccess(ctx, services.LoginAttempt{
+		RealmId: loginInfo.RealmId,
+		UserId:  loginInfo.UserId,
+		Ip:      utils.GetRequestIp(r, config.C.GetTrustedProxies()),
+	})
+
 	deviceService := ioc.Get[services.DeviceService](scope)
 	isKnownDeviceResponse := deviceService.IsKnownUserDevice(ctx, services.IsKnownDeviceRequest{
 		UserId:   loginInfo.UserId,
@@ -56,7 +158,7 @@ func CompleteAuthFlow(w http.ResponseWriter, r *http.Request) {
 			UserId:    loginInfo.UserId,
 			DeviceId:  deviceIdString,
 			UserAgent: r.UserAgent(),
-			Ip:        utils.GetRequestIp(r),
+			Ip:        utils.GetRequestIp(r, config.C.GetTrustedProxies()),
 		})
 	})
 
@@ -70,6 +172,7 @@ func CompleteAuthFlow(w http.ResponseWriter, r *http.Request) {
 	currentUser.SetSession(w, loginInfo.UserId, loginInfo.RememberMe, realm.Name, sessionToken)
 
 	http.Redirect(w, r, loginInfo.OriginalUrl, http.StatusFound)
+	return nil
 }
 
 type SubmitLoginStep struct {
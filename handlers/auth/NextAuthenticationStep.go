@@ -2,8 +2,15 @@ package auth
 
 import (
 	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/authflow"
 	"holvit/constants"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
 	"holvit/services"
+	"slices"
 )
 
 type NextAuthenticationStep interface {
@@ -12,31 +19,173 @@ type NextAuthenticationStep interface {
 	Prepare(ctx context.Context, info *services.LoginInfo) error
 }
 
-func getNextStep(ctx context.Context, currentStep string, info *services.LoginInfo) (NextAuthenticationStep, error) {
-	var nextStep NextAuthenticationStep
-	// TODO: gwen would really like to make this less brittle and more understandable
-	switch currentStep {
-	case constants.AuthenticateStepVerifyPassword:
-		nextStep = &VerifyEmailStep{}
-	case constants.AuthenticateStepVerifyEmail:
-		nextStep = &ResetPasswordStep{}
-	case constants.AuthenticateStepResetPassword:
-		nextStep = &TotpOnboardingStep{}
-	case constants.AuthenticateStepTotpOnboarding:
-		nextStep = &VerifyDeviceStep{}
-	case constants.AuthenticateStepVerifyTotp:
-		nextStep = &VerifyDeviceStep{}
-	default:
-		nextStep = &SubmitLoginStep{}
-	}
-
-	needsToRun, err := nextStep.NeedsToRun(ctx, info)
+// authenticationSteps is the registry of the steps authentication flows are built from.
+var authenticationSteps = map[string]func() NextAuthenticationStep{
+	constants.AuthenticateStepVerifyPassword:     func() NextAuthenticationStep { return &VerifyPasswordStep{} },
+	constants.AuthenticateStepVerifyEmailLogin:   func() NextAuthenticationStep { return &VerifyEmailLoginStep{} },
+	constants.AuthenticateStepVerifyRegistration: func() NextAuthenticationStep { return &VerifyRegistrationStep{} },
+	constants.AuthenticateStepBrokerLogin:        func() NextAuthenticationStep { return &BrokerLoginStep{} },
+	constants.AuthenticateStepVerifyEmail:        func() NextAuthenticationStep { return &VerifyEmailStep{} },
+	constants.AuthenticateStepResetPassword:      func() NextAuthenticationStep { return &ResetPasswordStep{} },
+	constants.AuthenticateStepTotpOnboarding:     func() NextAuthenticationStep { return &TotpOnboardingStep{} },
+	constants.AuthenticateStepVerifyTotp:         func() NextAuthenticationStep { return &VerifyTotpStep{} },
+	constants.AuthenticateStepVerifyRecoveryCode: func() NextAuthenticationStep { return &VerifyRecoveryCodeStep{} },
+	constants.AuthenticateStepWebauthnOnboarding: func() NextAuthenticationStep { return &WebauthnOnboardingStep{} },
+	constants.AuthenticateStepVerifyWebauthn:     func() NextAuthenticationStep { return &VerifyWebauthnStep{} },
+	constants.AuthenticateStepVerifyDevice:       func() NextAuthenticationStep { return &VerifyDeviceStep{} },
+	constants.AuthenticateStepSubmit:             func() NextAuthenticationStep { return &SubmitLoginStep{} },
+}
+
+// authenticationFlowConditions are the conditions conditional executions of authentication flows can use.
+// They do not hold as long as it is not known which user signs in.
+var authenticationFlowConditions = map[string]func(ctx context.Context, info *services.LoginInfo) (bool, error){
+	constants.AuthenticationFlowConditionUserHasTotp: func(ctx context.Context, info *services.LoginInfo) (bool, error) {
+		userService := ioc.Get[services.UserService](middlewares.GetScope(ctx))
+		return userService.HasTotpConfigured(ctx, info.UserId), nil
+	},
+	constants.AuthenticationFlowConditionUserHasWebauthn: func(ctx context.Context, info *services.LoginInfo) (bool, error) {
+		webauthnService := ioc.Get[services.WebauthnService](middlewares.GetScope(ctx))
+		return webauthnService.HasWebauthnCredentials(ctx, info.UserId), nil
+	},
+	constants.AuthenticationFlowConditionKnownDevice: func(ctx context.Context, info *services.LoginInfo) (bool, error) {
+		deviceService := ioc.Get[services.DeviceService](middlewares.GetScope(ctx))
+		return deviceService.IsKnownUserDevice(ctx, services.IsKnownDeviceRequest{
+			UserId:   info.UserId,
+			DeviceId: info.DeviceId,
+		}).Id.IsSome(), nil
+	},
+	constants.AuthenticationFlowConditionRememberMe: func(ctx context.Context, info *services.LoginInfo) (bool, error) {
+		return info.RememberMe, nil
+	},
+}
+
+// getNextStep marks completedStep as done and finds the next step in the authentication flow of the login.
+func getNextStep(ctx context.Context, completedStep string, info *services.LoginInfo) (NextAuthenticationStep, error) {
+	completeStep(info, completedStep)
+
+	return evaluateFlow(ctx, info)
+}
+
+// completeStep marks a step as done, e.g. a step that another step already covered.
+func completeStep(info *services.LoginInfo, step string) {
+	if !slices.Contains(info.CompletedSteps, step) {
+		info.CompletedSteps = append(info.CompletedSteps, step)
+	}
+}
+
+// evaluateFlow returns the step the login is suggested to continue with and stores the alternatives in info.AllowedSteps.
+func evaluateFlow(ctx context.Context, info *services.LoginInfo) (NextAuthenticationStep, error) {
+	scope := middlewares.GetScope(ctx)
+
+	authenticationFlowService := ioc.Get[services.AuthenticationFlowService](scope)
+	executions := authenticationFlowService.GetExecutions(ctx, info.AuthenticationFlowId)
+
+	result, err := authflow.Evaluate(executions, &loginFlowState{
+		ctx:  ctx,
+		info: info,
+	})
 	if err != nil {
 		return nil, err
 	}
-	if !needsToRun {
-		return getNextStep(ctx, nextStep.Name(), info)
+
+	steps := result.Steps
+	if result.Complete {
+		steps = append(steps, constants.AuthenticateStepSubmit)
+	}
+
+	// the flow only asks the steps whether they apply once the user is known, but whether an identification step
+	// can be used at all also depends on the realm, e.g. registration
+	if info.UserId == uuid.Nil {
+		steps, err = filterApplyingSteps(ctx, info, steps)
+		if err != nil {
+			return nil, err
+		}
+		if len(steps) == 0 {
+			return nil, httpErrors.BadRequest().WithMessage("the authentication flow offers no way to sign in")
+		}
+	}
+
+	info.AllowedSteps = steps[1:]
+	return authenticationSteps[steps[0]](), nil
+}
+
+func filterApplyingSteps(ctx context.Context, info *services.LoginInfo, steps []string) ([]string, error) {
+	applying := make([]string, 0, len(steps))
+	for _, step := range steps {
+		needsToRun, err := authenticationSteps[step]().NeedsToRun(ctx, info)
+		if err != nil {
+			return nil, err
+		}
+		if needsToRun {
+			applying = append(applying, step)
+		}
+	}
+	return applying, nil
+}
+
+// loginFlowState evaluates an authentication flow against a running login.
+type loginFlowState struct {
+	ctx  context.Context
+	info *services.LoginInfo
+}
+
+func (s *loginFlowState) IsCompleted(step string) bool {
+	return slices.Contains(s.info.CompletedSteps, step)
+}
+
+func (s *loginFlowState) IsIdentified() bool {
+	return s.info.UserId != uuid.Nil
+}
+
+func (s *loginFlowState) NeedsToRun(step string) (bool, error) {
+	newStep, ok := authenticationSteps[step]
+	if !ok {
+		return false, fmt.Errorf("unknown authentication step '%s'", step)
+	}
+	return newStep().NeedsToRun(s.ctx, s.info)
+}
+
+func (s *loginFlowState) Condition(name string) (bool, error) {
+	condition, ok := authenticationFlowConditions[name]
+	if !ok {
+		return false, fmt.Errorf("unknown authentication flow condition '%s'", name)
+	}
+	if !s.IsIdentified() {
+		return false, nil
+	}
+	return condition(s.ctx, s.info)
+}
+
+// continueLogin moves a login on to the steps after completedStep once it is known which user signs in.
+// It is used by the alternatives to VerifyPassword that do not run through the usual handler.
+func continueLogin(ctx context.Context, loginToken string, userId uuid.UUID, completedStep string) (*services.LoginInfo, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, loginToken).Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	loginInfo.UserId = userId
+	loginInfo.EmailLoginToken = ""
+	loginInfo.RegistrationToken = ""
+
+	nextStep, err := getNextStep(ctx, completedStep, &loginInfo)
+	if err != nil {
+		return nil, err
+	}
+	err = nextStep.Prepare(ctx, &loginInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	loginInfo.NextStep = nextStep.Name()
+
+	result := tokenService.OverwriteLoginCode(ctx, loginToken, loginInfo)
+	if result.IsErr() {
+		return nil, result.UnwrapErr()
 	}
 
-	return nextStep, nil
+	return &loginInfo, nil
 }
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"holvit/constants"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/routes"
+	"holvit/services"
+	"net/http"
+)
+
+type ForgotPasswordRequest struct {
+	// Identifier is the username or email of the user.
+	Identifier string `json:"identifier"`
+}
+
+type CompletePasswordResetRequest struct {
+	Token          string `json:"token"`
+	NewPassword    string `json:"newPassword"`
+	RevokeSessions bool   `json:"revokeSessions"`
+}
+
+// ForgotPassword sends a reset link to the user. It always succeeds so that it cannot be used to find out which users exist.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request ForgotPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	passwordResetService := ioc.Get[services.PasswordResetService](scope)
+	err = passwordResetService.RequestReset(ctx, services.RequestPasswordResetRequest{
+		RealmName:  mux.Vars(r)["realmName"],
+		Identifier: request.Identifier,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PasswordResetPage shows the page to choose a new password, it is the target of the reset link.
+func PasswordResetPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realmName := mux.Vars(r)["realmName"]
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		rcs.Error(httpErrors.BadRequest().WithMessage("Missing token"))
+		return
+	}
+
+	passwordResetService := ioc.Get[services.PasswordResetService](scope)
+	if !passwordResetService.IsValidToken(ctx, realmName, token) {
+		rcs.Error(httpErrors.BadRequest().WithMessage("the link expired or was already used"))
+		return
+	}
+
+	frontendData := services.AuthFrontendData{
+		Mode: constants.FrontendModeResetPassword,
+		ResetPassword: &services.AuthFrontendDataResetPassword{
+			Token:    token,
+			ResetUrl: routes.ApiCompletePasswordReset.Url(realmName),
+		},
+	}
+
+	frontendService := ioc.Get[services.FrontendService](scope)
+	frontendService.WriteAuthFrontend(w, realmName, frontendData)
+}
+
+func CompletePasswordReset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request CompletePasswordResetRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	passwordResetService := ioc.Get[services.PasswordResetService](scope)
+	err = passwordResetService.CompleteReset(ctx, services.CompletePasswordResetRequest{
+		RealmName:      mux.Vars(r)["realmName"],
+		Token:          request.Token,
+		NewPassword:    request.NewPassword,
+		RevokeSessions: request.RevokeSessions,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
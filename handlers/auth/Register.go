@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+)
+
+type RegisterRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type VerifyRegistrationRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// Register creates a new account from the login page. The new user continues through the login steps
+// and ends up in a session, unless the realm requires an admin to approve the account first.
+func Register(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request RegisterRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	registrationService := ioc.Get[services.RegistrationService](scope)
+	result, err := registrationService.Register(ctx, services.RegisterRequest{
+		LoginToken: request.Token,
+		Username:   request.Username,
+		Email:      request.Email,
+		Password:   request.Password,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeRegistrationResult(w, r, request.Token, result)
+}
+
+// VerifyRegistration creates the account once the user entered the code that was sent to their email.
+func VerifyRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request VerifyRegistrationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	registrationService := ioc.Get[services.RegistrationService](scope)
+	result, err := registrationService.VerifyRegistration(ctx, services.VerifyRegistrationRequest{
+		LoginToken: request.Token,
+		Code:       request.Code,
+		Ip:         utils.GetRequestIp(r, config.C.GetTrustedProxies()),
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeRegistrationResult(w, r, request.Token, result)
+}
+
+func writeRegistrationResult(w http.ResponseWriter, r *http.Request, loginToken string, result *services.RegistrationResult) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	nextStep := result.NextStep
+	var allowedSteps []string
+	if userId, ok := result.UserId.Get(); ok {
+		loginInfo, err := continueLogin(ctx, loginToken, userId, constants.AuthenticateStepVerifyRegistration)
+		if err != nil {
+			rcs.Error(err)
+			return
+		}
+		nextStep = loginInfo.NextStep
+		allowedSteps = loginInfo.AllowedSteps
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(VerifyLoginStepResponse{
+		NextStep:     nextStep,
+		AllowedSteps: allowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+type VerifyRegistrationStep struct {
+}
+
+func (s *VerifyRegistrationStep) Name() string {
+	return constants.AuthenticateStepVerifyRegistration
+}
+
+// NeedsToRun applies if the realm allows registration and it is not known yet which user signs in.
+func (s *VerifyRegistrationStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	if info.UserId != uuid.Nil {
+		return false, nil
+	}
+
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, info.RealmId).Unwrap()
+	return realm.EnableRegistration, nil
+}
+
+func (s *VerifyRegistrationStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
@@ -3,7 +3,6 @@ package auth
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"holvit/constants"
 	"holvit/httpErrors"
 	"holvit/ioc"
@@ -40,19 +39,23 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
 	}
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepResetPassword {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepVerifyPassword)))
+	currentStep := constants.AuthenticateStepResetPassword
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
 		return
 	}
 
 	userService := ioc.Get[services.UserService](scope)
-	userService.SetPassword(ctx, services.SetPasswordRequest{
+	result := userService.SetPassword(ctx, services.SetPasswordRequest{
 		UserId:    loginInfo.UserId,
 		Password:  request.NewPassword,
 		Temporary: false,
 	}, services.DangerousNoAuthStrategy{})
+	if result.IsErr() {
+		rcs.Error(result.UnwrapErr())
+		return
+	}
 
 	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
 	if err != nil {
@@ -73,7 +76,8 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(VerifyLoginStepResponse{
-		NextStep: loginInfo.NextStep,
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
 	})
 	if err != nil {
 		rcs.Error(err)
@@ -91,9 +95,11 @@ func (s *ResetPasswordStep) NeedsToRun(ctx context.Context, loginInfo *services.
 	scope := middlewares.GetScope(ctx)
 
 	userService := ioc.Get[services.UserService](scope)
-	isTemporary := userService.IsPasswordTemporary(ctx, loginInfo.UserId)
+	if userService.IsPasswordTemporary(ctx, loginInfo.UserId) {
+		return true, nil
+	}
 
-	return isTemporary, nil
+	return userService.IsPasswordExpired(ctx, loginInfo.UserId), nil
 }
 
 func (s *ResetPasswordStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
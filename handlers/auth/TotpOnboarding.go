@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 	"holvit/config"
@@ -25,6 +24,13 @@ type TotpOnboardingRequest struct {
 	DisplayName *string `json:"displayName"`
 }
 
+type TotpOnboardingResponse struct {
+	NextStep     string   `json:"nextStep"`
+	AllowedSteps []string `json:"allowedSteps,omitempty"`
+	// RecoveryCodes can be used once each instead of a totp code, they are only shown this one time.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
 func TotpOnboarding(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	scope := middlewares.GetScope(ctx)
@@ -44,12 +50,13 @@ func TotpOnboarding(w http.ResponseWriter, r *http.Request) {
 	deviceIdString := currentUser.DeviceIdString()
 	if deviceIdString != loginInfo.DeviceId {
 		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
 	}
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepTotpOnboarding {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepTotpOnboarding)))
+	currentStep := constants.AuthenticateStepTotpOnboarding
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
 		return
 	}
 
@@ -85,6 +92,10 @@ func TotpOnboarding(w http.ResponseWriter, r *http.Request) {
 		DisplayName: h.FromPtr(request.DisplayName),
 		Secret:      totpSecret,
 	}, services.DangerousNoAuthStrategy{})
+	// the code entered for the new totp also verifies it for this login
+	completeStep(&loginInfo, constants.AuthenticateStepVerifyTotp)
+
+	recoveryCodes := userService.GenerateRecoveryCodes(ctx, loginInfo.UserId)
 
 	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
 	if err != nil {
@@ -104,8 +115,10 @@ func TotpOnboarding(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	encoder := json.NewEncoder(w)
-	err = encoder.Encode(VerifyLoginStepResponse{
-		NextStep: loginInfo.NextStep,
+	err = encoder.Encode(TotpOnboardingResponse{
+		NextStep:      loginInfo.NextStep,
+		AllowedSteps:  loginInfo.AllowedSteps,
+		RecoveryCodes: recoveryCodes,
 	})
 	if err != nil {
 		rcs.Error(err)
@@ -3,19 +3,27 @@ package auth
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"holvit/config"
 	"holvit/constants"
+	"holvit/h"
 	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
 	"holvit/requestContext"
 	"holvit/services"
+	"holvit/utils"
 	"net/http"
 )
 
 type VerifyDeviceRequest struct {
 	Token string `json:"token"`
 	Code  string `json:"code"`
+	// DeviceName is optional, the name is derived from the user agent otherwise.
+	DeviceName string `json:"deviceName"`
+}
+
+type ResendDeviceVerificationRequest struct {
+	Token string `json:"token"`
 }
 
 func VerifyDevice(w http.ResponseWriter, r *http.Request) {
@@ -37,20 +45,38 @@ func VerifyDevice(w http.ResponseWriter, r *http.Request) {
 	deviceIdString := currentUser.DeviceIdString()
 	if deviceIdString != loginInfo.DeviceId {
 		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
 	}
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepVerifyDevice {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepVerifyDevice)))
+	currentStep := constants.AuthenticateStepVerifyDevice
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
 		return
 	}
 
 	deviceService := ioc.Get[services.DeviceService](scope)
-	deviceService.AddKnownDevice(ctx, services.AddDeviceRequest{
+	err = deviceService.VerifyCode(ctx, services.VerifyDeviceCodeRequest{
+		Token:    loginInfo.DeviceVerificationToken,
+		RealmId:  loginInfo.RealmId,
 		UserId:   loginInfo.UserId,
 		DeviceId: deviceIdString,
+		Code:     request.Code,
+		Ip:       utils.GetRequestIp(r, config.C.GetTrustedProxies()),
 	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	deviceService.AddKnownDevice(ctx, services.AddDeviceRequest{
+		UserId:      loginInfo.UserId,
+		DeviceId:    deviceIdString,
+		UserAgent:   r.UserAgent(),
+		Ip:          utils.GetRequestIp(r, config.C.GetTrustedProxies()),
+		DisplayName: h.SomeIf(request.DeviceName != "", request.DeviceName),
+	})
+	loginInfo.DeviceVerificationToken = ""
 
 	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
 	if err != nil {
@@ -71,12 +97,66 @@ func VerifyDevice(w http.ResponseWriter, r *http.Request) {
 
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(VerifyLoginStepResponse{
-		NextStep: loginInfo.NextStep,
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+// ResendDeviceVerification sends a new code for the login, at most once per configured interval.
+func ResendDeviceVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request ResendDeviceVerificationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, request.Token).Get()
+	if !ok {
+		rcs.Error(httpErrors.BadRequest().WithMessage("token not found"))
+		return
+	}
+
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	if currentUser.DeviceIdString() != loginInfo.DeviceId {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
+	}
+
+	err = loginInfo.ExpectStep(constants.AuthenticateStepVerifyDevice)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	deviceService := ioc.Get[services.DeviceService](scope)
+	response, err := deviceService.ResendVerificationEmail(ctx, services.ResendVerificationRequest{
+		Token:     loginInfo.DeviceVerificationToken,
+		UserAgent: r.UserAgent(),
 	})
 	if err != nil {
 		rcs.Error(err)
 		return
 	}
+
+	loginInfo.DeviceVerificationToken = response.Token
+
+	result := tokenService.OverwriteLoginCode(ctx, request.Token, loginInfo)
+	if result.IsErr() {
+		rcs.Error(result.UnwrapErr())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 type VerifyDeviceStep struct {
@@ -98,6 +178,19 @@ func (s *VerifyDeviceStep) NeedsToRun(ctx context.Context, info *services.LoginI
 	return response.Id.IsNone() && response.RequiresVerification, nil
 }
 
+// Prepare sends the verification code when the login reaches this step.
 func (s *VerifyDeviceStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	scope := middlewares.GetScope(ctx)
+
+	deviceService := ioc.Get[services.DeviceService](scope)
+	response, err := deviceService.SendVerificationEmail(ctx, services.SendVerificationRequest{
+		UserId:   info.UserId,
+		DeviceId: info.DeviceId,
+	})
+	if err != nil {
+		return err
+	}
+
+	info.DeviceVerificationToken = response.Token
 	return nil
 }
@@ -2,16 +2,185 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"holvit/config"
 	"holvit/constants"
+	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
 	"holvit/repos"
+	"holvit/requestContext"
 	"holvit/services"
+	"holvit/utils"
 	"net/http"
 )
 
+type ResendEmailVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+type ContinueEmailVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail is the target of the link in the verification email, it can be opened in any browser.
 func VerifyEmail(w http.ResponseWriter, r *http.Request) {
-	//TODO: implement
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realmName := mux.Vars(r)["realmName"]
+	query := r.URL.Query()
+
+	emailVerificationService := ioc.Get[services.EmailVerificationService](scope)
+	user, err := emailVerificationService.VerifyEmail(ctx, services.VerifyEmailRequest{
+		RealmName: realmName,
+		UserId:    query.Get("user"),
+		Expires:   query.Get("expires"),
+		Signature: query.Get("signature"),
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	frontendData := services.AuthFrontendData{
+		Mode: constants.FrontendModeEmailVerified,
+		EmailVerified: &services.AuthFrontendDataEmailVerified{
+			Email: user.Email.Unwrap(),
+		},
+	}
+
+	frontendService := ioc.Get[services.FrontendService](scope)
+	frontendService.WriteAuthFrontend(w, realmName, frontendData)
+}
+
+// ResendEmailVerification sends the verification email of a login again, at most once per configured interval.
+func ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request ResendEmailVerificationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo, err := getEmailVerificationLogin(ctx, request.Token)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+	if now.Before(loginInfo.EmailVerificationSentAt.Add(config.C.EmailVerification.ResendInterval)) {
+		rcs.Error(httpErrors.TooManyRequests().WithMessage("the verification email was sent recently, please wait before requesting another one"))
+		return
+	}
+
+	emailVerificationService := ioc.Get[services.EmailVerificationService](scope)
+	err = emailVerificationService.SendVerificationEmail(ctx, loginInfo.UserId)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo.EmailVerificationSentAt = now
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	result := tokenService.OverwriteLoginCode(ctx, request.Token, *loginInfo)
+	if result.IsErr() {
+		rcs.Error(result.UnwrapErr())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ContinueEmailVerification moves the login on once the user opened the verification link.
+func ContinueEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request ContinueEmailVerificationRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo, err := getEmailVerificationLogin(ctx, request.Token)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, loginInfo.UserId).Unwrap()
+	if !user.EmailVerified {
+		rcs.Error(httpErrors.Forbidden().WithMessage("the email is not verified yet"))
+		return
+	}
+
+	nextStep, err := getNextStep(ctx, constants.AuthenticateStepVerifyEmail, loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+	err = nextStep.Prepare(ctx, loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo.NextStep = nextStep.Name()
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	result := tokenService.OverwriteLoginCode(ctx, request.Token, *loginInfo)
+	if result.IsErr() {
+		rcs.Error(result.UnwrapErr())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(VerifyLoginStepResponse{
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+// getEmailVerificationLogin returns the login that waits for the email verification, it has to continue on the device it was started on.
+func getEmailVerificationLogin(ctx context.Context, loginToken string) (*services.LoginInfo, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, loginToken).Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	if currentUser.DeviceIdString() != loginInfo.DeviceId {
+		return nil, httpErrors.Unauthorized().WithMessage("wrong device id")
+	}
+
+	err := loginInfo.ExpectStep(constants.AuthenticateStepVerifyEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginInfo, nil
 }
 
 type VerifyEmailStep struct {
@@ -24,16 +193,34 @@ func (s *VerifyEmailStep) Name() string {
 func (s *VerifyEmailStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
 	scope := middlewares.GetScope(ctx)
 
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, info.RealmId).Unwrap()
+	if !realm.RequireEmailVerification {
+		return false, nil
+	}
+
 	userRepository := ioc.Get[repos.UserRepository](scope)
 	user := userRepository.FindUserById(ctx, info.UserId).Unwrap()
 
-	if user.Email.IsSome() && user.EmailVerified {
+	if user.Email.IsSome() && !user.EmailVerified {
 		return true, nil
 	}
 
 	return false, nil
 }
 
+// Prepare sends the verification email when the login reaches this step.
 func (s *VerifyEmailStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	scope := middlewares.GetScope(ctx)
+
+	emailVerificationService := ioc.Get[services.EmailVerificationService](scope)
+	err := emailVerificationService.SendVerificationEmail(ctx, info.UserId)
+	if err != nil {
+		return err
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	info.EmailVerificationSentAt = clockService.Now()
+
 	return nil
 }
@@ -2,4 +2,6 @@ package auth
 
 type VerifyLoginStepResponse struct {
 	NextStep string `json:"nextStep"`
+	// AllowedSteps are the other steps the authentication flow lets the user continue with instead of NextStep.
+	AllowedSteps []string `json:"allowedSteps,omitempty"`
 }
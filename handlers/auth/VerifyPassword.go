@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"github.com/google/uuid"
+	"holvit/config"
 	"holvit/constants"
 	"holvit/h"
 	"holvit/httpErrors"
@@ -11,6 +13,7 @@ import (
 	"holvit/repos"
 	"holvit/requestContext"
 	"holvit/services"
+	"holvit/utils"
 	"net/http"
 )
 
@@ -39,10 +42,10 @@ func VerifyPassword(w http.ResponseWriter, r *http.Request) {
 	tokenService := ioc.Get[services.TokenService](scope)
 	loginInfo := tokenService.PeekLoginCode(ctx, request.Token).UnwrapErr(httpErrors.BadRequest().WithMessage("token not found"))
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepVerifyPassword {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepVerifyPassword)))
+	currentStep := constants.AuthenticateStepVerifyPassword
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
 		return
 	}
 
@@ -54,20 +57,28 @@ func VerifyPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// unknown usernames are verified as well, so that they count as failed attempts of the ip address
 	userRepository := ioc.Get[repos.UserRepository](scope)
 	user := userRepository.FindUsers(ctx, repos.UserFilter{
 		RealmId:  h.Some(realm.Id),
 		Username: h.Some(request.Username),
-	}).Single()
+	}).SingleOrNone()
 
 	userService := ioc.Get[services.UserService](scope)
 	loginResponse := userService.VerifyLogin(ctx, services.VerifyLoginRequest{
-		UserId:   user.Id,
+		UserId:   user.UnwrapOrEmpty().Id,
 		Username: request.Username,
 		Password: request.Password,
 		RealmId:  loginInfo.RealmId,
+		Ip:       utils.GetRequestIp(r, config.C.GetTrustedProxies()),
 	})
 
+	// the password can also be asked for after the user signed in with another step
+	if loginInfo.UserId != uuid.Nil && loginInfo.UserId != loginResponse.UserId {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("the login was started by another user"))
+		return
+	}
+
 	loginInfo.UserId = loginResponse.UserId
 	loginInfo.DeviceId = deviceIdString
 	loginInfo.RememberMe = request.RememberMe
@@ -91,10 +102,27 @@ func VerifyPassword(w http.ResponseWriter, r *http.Request) {
 
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(VerifyLoginStepResponse{
-		NextStep: loginInfo.NextStep,
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
 	})
 	if err != nil {
 		rcs.Error(err)
 		return
 	}
 }
+
+type VerifyPasswordStep struct {
+}
+
+func (s *VerifyPasswordStep) Name() string {
+	return constants.AuthenticateStepVerifyPassword
+}
+
+// NeedsToRun is only asked once the user is known, the password is then asked for in addition to the other steps.
+func (s *VerifyPasswordStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	return true, nil
+}
+
+func (s *VerifyPasswordStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/services"
+	"holvit/utils"
+	"net/http"
+)
+
+type VerifyRecoveryCodeRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// VerifyRecoveryCode lets a user who lost their authenticator sign in with a recovery code instead of a second factor.
+func VerifyRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request VerifyRecoveryCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo := tokenService.PeekLoginCode(ctx, request.Token).UnwrapErr(httpErrors.BadRequest().WithMessage("token not found"))
+
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	deviceIdString := currentUser.DeviceIdString()
+	if deviceIdString != loginInfo.DeviceId {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
+	}
+
+	currentStep := constants.AuthenticateStepVerifyRecoveryCode
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	userService := ioc.Get[services.UserService](scope)
+	userService.VerifyRecoveryCode(ctx, services.VerifyRecoveryCodeRequest{
+		RealmId: loginInfo.RealmId,
+		UserId:  loginInfo.UserId,
+		Code:    request.Code,
+		Ip:      utils.GetRequestIp(r, config.C.GetTrustedProxies()),
+	})
+
+	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+	err = nextStep.Prepare(ctx, &loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo.NextStep = nextStep.Name()
+
+	tokenService.OverwriteLoginCode(ctx, request.Token, loginInfo).SetErr(httpErrors.BadRequest().WithMessage("token not found")).Unwrap()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(VerifyLoginStepResponse{
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+type VerifyRecoveryCodeStep struct {
+}
+
+func (s *VerifyRecoveryCodeStep) Name() string {
+	return constants.AuthenticateStepVerifyRecoveryCode
+}
+
+// NeedsToRun offers a recovery code if the user has unused ones left.
+func (s *VerifyRecoveryCodeStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	scope := middlewares.GetScope(ctx)
+
+	userService := ioc.Get[services.UserService](scope)
+	return userService.HasRecoveryCodes(ctx, info.UserId), nil
+}
+
+func (s *VerifyRecoveryCodeStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
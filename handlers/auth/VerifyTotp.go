@@ -3,13 +3,14 @@ package auth
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"holvit/config"
 	"holvit/constants"
 	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
 	"holvit/requestContext"
 	"holvit/services"
+	"holvit/utils"
 	"net/http"
 )
 
@@ -37,19 +38,22 @@ func VerifyTotp(w http.ResponseWriter, r *http.Request) {
 	deviceIdString := currentUser.DeviceIdString()
 	if deviceIdString != loginInfo.DeviceId {
 		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
 	}
 
-	currentStep := loginInfo.NextStep
-	if currentStep != constants.AuthenticateStepVerifyTotp {
-		rcs.Error(httpErrors.Unauthorized().WithMessage(
-			fmt.Sprintf("wrong login step '%s', expected '%s'", currentStep, constants.AuthenticateStepVerifyTotp)))
+	currentStep := constants.AuthenticateStepVerifyTotp
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
 		return
 	}
 
 	userService := ioc.Get[services.UserService](scope)
 	userService.VerifyTotp(ctx, services.VerifyTotpRequest{
-		UserId: loginInfo.UserId,
-		Code:   request.Code,
+		RealmId: loginInfo.RealmId,
+		UserId:  loginInfo.UserId,
+		Code:    request.Code,
+		Ip:      utils.GetRequestIp(r, config.C.GetTrustedProxies()),
 	})
 
 	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
@@ -63,13 +67,16 @@ func VerifyTotp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loginInfo.NextStep = nextStep.Name()
+
 	tokenService.OverwriteLoginCode(ctx, request.Token, loginInfo).SetErr(httpErrors.BadRequest().WithMessage("token not found")).Unwrap()
 
 	w.Header().Set("Content-Type", "application/json")
 
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(VerifyLoginStepResponse{
-		NextStep: loginInfo.NextStep,
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
 	})
 	if err != nil {
 		rcs.Error(err)
@@ -84,12 +91,13 @@ func (s *VerifyTotpStep) Name() string {
 	return constants.AuthenticateStepVerifyTotp
 }
 
+// NeedsToRun asks for a totp code if the user has a totp configured.
+// Whether another second factor can be used instead is up to the authentication flow.
 func (s *VerifyTotpStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
 	scope := middlewares.GetScope(ctx)
 
 	userService := ioc.Get[services.UserService](scope)
-	requiresTotpOnboarding := userService.RequiresTotpOnboarding(ctx, info.UserId)
-	return requiresTotpOnboarding, nil
+	return userService.HasTotpConfigured(ctx, info.UserId), nil
 }
 
 func (s *VerifyTotpStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
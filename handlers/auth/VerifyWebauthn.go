@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+)
+
+type VerifyWebauthnRequest struct {
+	Token      string          `json:"token"`
+	Credential json.RawMessage `json:"credential"`
+	RememberMe bool            `json:"rememberMe"`
+}
+
+// VerifyWebauthn verifies a webauthn assertion, either as second factor or, before the user is known, as passwordless login
+// with a discoverable credential.
+func VerifyWebauthn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request VerifyWebauthnRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo := tokenService.PeekLoginCode(ctx, request.Token).UnwrapErr(httpErrors.BadRequest().WithMessage("token not found"))
+
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	deviceIdString := currentUser.DeviceIdString()
+
+	currentStep := constants.AuthenticateStepVerifyWebauthn
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	passwordless := loginInfo.UserId == uuid.Nil
+	if !passwordless && deviceIdString != loginInfo.DeviceId {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
+	}
+
+	if loginInfo.WebauthnSession == nil {
+		rcs.Error(httpErrors.BadRequest().WithMessage("no webauthn ceremony was started"))
+		return
+	}
+
+	userId := h.None[uuid.UUID]()
+	if !passwordless {
+		userId = h.Some(loginInfo.UserId)
+	}
+
+	webauthnService := ioc.Get[services.WebauthnService](scope)
+	verifiedUserId, err := webauthnService.FinishLogin(ctx, services.FinishWebauthnLoginRequest{
+		RealmId:  loginInfo.RealmId,
+		UserId:   userId,
+		Session:  *loginInfo.WebauthnSession,
+		Response: request.Credential,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	if passwordless {
+		realmRepository := ioc.Get[repos.RealmRepository](scope)
+		realm := realmRepository.FindRealmById(ctx, loginInfo.RealmId).Unwrap()
+
+		if request.RememberMe && !realm.EnableRememberMe {
+			rcs.Error(httpErrors.BadRequest().WithMessage("realm does not allow remember me"))
+			return
+		}
+
+		loginInfo.UserId = verifiedUserId
+		loginInfo.DeviceId = deviceIdString
+		loginInfo.RememberMe = request.RememberMe
+	}
+
+	loginInfo.WebauthnSession = nil
+	loginInfo.WebauthnVerified = true
+
+	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+	err = nextStep.Prepare(ctx, &loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo.NextStep = nextStep.Name()
+
+	tokenService.OverwriteLoginCode(ctx, request.Token, loginInfo).SetErr(httpErrors.BadRequest().WithMessage("token not found")).Unwrap()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(VerifyLoginStepResponse{
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+type VerifyWebauthnStep struct {
+}
+
+func (s *VerifyWebauthnStep) Name() string {
+	return constants.AuthenticateStepVerifyWebauthn
+}
+
+// NeedsToRun asks for a webauthn credential as second factor if the user has one.
+// Whether another second factor can be used instead is up to the authentication flow.
+// Before the user is known, any passkey can be used to sign in.
+func (s *VerifyWebauthnStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	if info.UserId == uuid.Nil {
+		return true, nil
+	}
+
+	scope := middlewares.GetScope(ctx)
+
+	webauthnService := ioc.Get[services.WebauthnService](scope)
+	return webauthnService.HasWebauthnCredentials(ctx, info.UserId), nil
+}
+
+func (s *VerifyWebauthnStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+)
+
+type WebauthnOnboardingRequest struct {
+	Token       string          `json:"token"`
+	Credential  json.RawMessage `json:"credential"`
+	DisplayName *string         `json:"displayName"`
+}
+
+func WebauthnOnboarding(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var request WebauthnOnboardingRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	tokenService := ioc.Get[services.TokenService](scope)
+	loginInfo := tokenService.PeekLoginCode(ctx, request.Token).UnwrapErr(httpErrors.BadRequest().WithMessage("token not found"))
+
+	currentUser := ioc.Get[services.CurrentSessionService](scope)
+	deviceIdString := currentUser.DeviceIdString()
+	if deviceIdString != loginInfo.DeviceId {
+		rcs.Error(httpErrors.Unauthorized().WithMessage("wrong device id"))
+		return
+	}
+
+	currentStep := constants.AuthenticateStepWebauthnOnboarding
+	err = loginInfo.ExpectStep(currentStep)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	if loginInfo.WebauthnSession == nil {
+		rcs.Error(httpErrors.BadRequest().WithMessage("no webauthn ceremony was started"))
+		return
+	}
+
+	webauthnService := ioc.Get[services.WebauthnService](scope)
+	err = webauthnService.FinishRegistration(ctx, services.FinishWebauthnRegistrationRequest{
+		UserId:      loginInfo.UserId,
+		DisplayName: h.FromPtr(request.DisplayName),
+		Session:     *loginInfo.WebauthnSession,
+		Response:    request.Credential,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	// creating the credential already proved possession of the authenticator
+	loginInfo.WebauthnSession = nil
+	loginInfo.WebauthnVerified = true
+	completeStep(&loginInfo, constants.AuthenticateStepVerifyWebauthn)
+
+	nextStep, err := getNextStep(ctx, currentStep, &loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+	err = nextStep.Prepare(ctx, &loginInfo)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	loginInfo.NextStep = nextStep.Name()
+
+	tokenService.OverwriteLoginCode(ctx, request.Token, loginInfo).SetErr(httpErrors.BadRequest().WithMessage("token not found")).Unwrap()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(VerifyLoginStepResponse{
+		NextStep:     loginInfo.NextStep,
+		AllowedSteps: loginInfo.AllowedSteps,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+type WebauthnOnboardingStep struct {
+}
+
+func (s *WebauthnOnboardingStep) Name() string {
+	return constants.AuthenticateStepWebauthnOnboarding
+}
+
+func (s *WebauthnOnboardingStep) NeedsToRun(ctx context.Context, info *services.LoginInfo) (bool, error) {
+	if info.WebauthnVerified {
+		return false, nil
+	}
+
+	scope := middlewares.GetScope(ctx)
+
+	webauthnService := ioc.Get[services.WebauthnService](scope)
+	return webauthnService.RequiresWebauthnOnboarding(ctx, info.UserId), nil
+}
+
+func (s *WebauthnOnboardingStep) Prepare(ctx context.Context, info *services.LoginInfo) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func BackchannelAuthentication(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	if err := r.ParseForm(); err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	clientId, clientSecret := clientCredentials(r)
+
+	requestedExpiry := h.None[int]()
+	if requestedExpiryStr := r.Form.Get("requested_expiry"); requestedExpiryStr != "" {
+		seconds, err := strconv.Atoi(requestedExpiryStr)
+		if err != nil {
+			rcs.Error(httpErrors.BadRequest().WithMessage("invalid_request: requested_expiry must be a number"))
+			return
+		}
+		requestedExpiry = h.Some(seconds)
+	}
+
+	cibaService := ioc.Get[services.CibaService](scope)
+	response, err := cibaService.BackchannelAuthenticate(ctx, services.BackchannelAuthenticationRequest{
+		RealmName:       realmName,
+		ClientId:        clientId,
+		ClientSecret:    clientSecret,
+		Scopes:          strings.Split(r.Form.Get("scope"), " "),
+		LoginHint:       r.Form.Get("login_hint"),
+		BindingMessage:  r.Form.Get("binding_message"),
+		RequestedExpiry: requestedExpiry,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
@@ -7,10 +7,10 @@ import (
 	"holvit/config"
 	"holvit/constants"
 	"holvit/h"
+	"holvit/handlers/auth"
 	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
-	"holvit/repos"
 	"holvit/requestContext"
 	"holvit/routes"
 	"holvit/services"
@@ -18,44 +18,6 @@ import (
 	"strings"
 )
 
-func login(w http.ResponseWriter, r *http.Request, realmName string) error {
-	ctx := r.Context()
-	scope := middlewares.GetScope(ctx)
-
-	if err := r.ParseForm(); err != nil {
-		return err
-	}
-
-	realmRepository := ioc.Get[repos.RealmRepository](scope)
-	realm := realmRepository.FindRealms(ctx, repos.RealmFilter{
-		Name: h.Some(realmName),
-	}).Single()
-
-	tokenService := ioc.Get[services.TokenService](scope)
-	loginToken := tokenService.StoreLoginCode(ctx, services.LoginInfo{
-		NextStep: constants.AuthenticateStepVerifyPassword,
-		RealmId:  realm.Id,
-		// TODO: the original url thing does not work if the initial request was a POST request -- how to deal with that?
-		OriginalUrl: r.URL.String(),
-	})
-
-	frontendData := services.AuthFrontendData{
-		Mode: constants.FrontendModeAuthenticate,
-		Authenticate: &services.AuthFrontendDataAuthenticate{
-			ClientName:       "TODO (client name)",
-			Token:            loginToken,
-			UseRememberMe:    realm.EnableRememberMe,
-			RegisterUrl:      "TODO (register URL)",
-			LoginCompleteUrl: routes.LoginComplete.Url(realmName),
-		},
-	}
-
-	frontendService := ioc.Get[services.FrontendService](scope)
-
-	frontendService.WriteAuthFrontend(w, realmName, frontendData)
-	return nil
-}
-
 func Authorize(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	scope := middlewares.GetScope(ctx)
@@ -80,10 +42,20 @@ func Authorize(w http.ResponseWriter, r *http.Request) {
 		PKCEChallengeMethod: r.Form.Get("code_challenge_method"),
 	}
 
+	if claims := r.Form.Get("claims"); claims != "" {
+		claimsRequest, err := services.ParseClaimsRequest(claims)
+		if err != nil {
+			rcs.Error(httpErrors.BadRequest().WithMessage("invalid claims parameter"))
+			return
+		}
+		request.ClaimsRequest = &claimsRequest
+	}
+
 	currentUserService := ioc.Get[services.CurrentSessionService](scope)
 
 	if !currentUserService.IsAuthorized() {
-		err := login(w, r, realmName)
+		// TODO: the original url thing does not work if the initial request was a POST request -- how to deal with that?
+		err := auth.StartLogin(w, r, realmName, request.ClientId, r.URL.String())
 		if err != nil {
 			rcs.Error(err)
 			return
@@ -101,6 +73,20 @@ func Authorize(w http.ResponseWriter, r *http.Request) {
 	response.HandleHttp(w, r)
 }
 
+// clientCredentials reads the client credentials from the basic auth header or, if absent, from the form.
+func clientCredentials(r *http.Request) (string, h.Opt[string]) {
+	clientId, clientSecretStr, hasBasicAuth := r.BasicAuth()
+	if hasBasicAuth {
+		return clientId, h.Some(clientSecretStr)
+	}
+
+	clientSecret := h.None[string]()
+	if formClientSecret := r.Form.Get("client_secret"); formClientSecret != "" {
+		clientSecret = h.Some(formClientSecret)
+	}
+	return r.Form.Get("client_id"), clientSecret
+}
+
 func Token(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	scope := middlewares.GetScope(ctx)
@@ -113,13 +99,11 @@ func Token(w http.ResponseWriter, r *http.Request) {
 
 	grantType := r.Form.Get("grant_type")
 
-	clientId, clientSecretStr, hasBasicAuth := r.BasicAuth()
+	clientId, clientSecret := clientCredentials(r)
 
-	clientSecret := h.None[string]()
-	if hasBasicAuth {
-		clientSecret = h.Some(clientSecretStr)
-	} else {
-		clientId = r.Form.Get("client_id")
+	origin := h.None[string]()
+	if originHeader := r.Header.Get("Origin"); originHeader != "" {
+		origin = h.Some(originHeader)
 	}
 
 	pkceVerifierStr := r.Form.Get("code_verifier")
@@ -141,6 +125,7 @@ func Token(w http.ResponseWriter, r *http.Request) {
 			ClientId:     clientId,
 			ClientSecret: clientSecret,
 			PKCEVerifier: pkceVerifier,
+			Origin:       origin,
 		})
 	case constants.TokenGrantTypeRefreshToken:
 		response, err = oidcService.HandleRefreshToken(ctx, services.RefreshTokenRequest{
@@ -148,9 +133,25 @@ func Token(w http.ResponseWriter, r *http.Request) {
 			ClientId:     clientId,
 			ClientSecret: clientSecret,
 			ScopeNames:   strings.Split(r.Form.Get("scope"), " "),
+			Origin:       origin,
+		})
+	case constants.TokenGrantTypeCiba:
+		response, err = oidcService.HandleCiba(ctx, services.CibaTokenRequest{
+			AuthReqId:    r.Form.Get("auth_req_id"),
+			ClientId:     clientId,
+			ClientSecret: clientSecret,
+			Origin:       origin,
+		})
+	case constants.TokenGrantTypeClientCredentials:
+		response, err = oidcService.HandleClientCredentials(ctx, services.ClientCredentialsTokenRequest{
+			ClientId:     clientId,
+			ClientSecret: clientSecret,
+			ScopeNames:   strings.Fields(r.Form.Get("scope")),
+			Origin:       origin,
 		})
 	default:
 		rcs.Error(httpErrors.BadRequest().WithMessage(fmt.Sprintf("Unsupported grant_type '%s'", grantType)))
+		return
 	}
 
 	if err != nil {
@@ -158,6 +159,12 @@ func Token(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if requestOrigin, ok := origin.Get(); ok {
+		// the origin has been checked against the web origins of the client
+		w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+		w.Header().Set("Vary", "Origin")
+	}
+
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
@@ -180,20 +187,64 @@ func UserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
 	bearer := r.Header.Get("Authorization")
 
 	oidcService := ioc.Get[services.OidcService](scope)
-	response := oidcService.UserInfo(bearer)
+	response, err := oidcService.UserInfo(ctx, services.UserInfoRequest{
+		RealmName: realmName,
+		Bearer:    bearer,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		clientService := ioc.Get[services.ClientService](scope)
+		if clientService.IsWebOriginAllowed(ctx, realmName, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Vary", "Origin")
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
 	encoder := json.NewEncoder(w)
-	err := encoder.Encode(response)
+	err = encoder.Encode(response)
 	if err != nil {
 		return
 	}
 }
 
+// Preflight answers the CORS preflight requests of browser based clients, the actual request checks the origin
+// against the web origins of the client again.
+func Preflight(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	origin := r.Header.Get("Origin")
+
+	clientService := ioc.Get[services.ClientService](scope)
+	if origin == "" || !clientService.IsWebOriginAllowed(ctx, realmName, origin) {
+		rcs.Error(httpErrors.Forbidden().WithMessage("origin not allowed"))
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.Header().Set("Vary", "Origin")
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func Jwks(w http.ResponseWriter, r *http.Request) {
 }
 
@@ -216,16 +267,24 @@ func EndSession(w http.ResponseWriter, r *http.Request) {
 }
 
 type WellKnownResponse struct {
-	Issuer                           string   `json:"issuer"`
-	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
-	JwksUri                          string   `json:"jwks_uri"`
-	ResponseTypesSupported           []string `json:"response_types_supported"`
-	SubjectTypesSupported            []string `json:"subject_types_supported"`
-	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
-	TokenEndpoint                    string   `json:"token_endpoint"`
-	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
-	ScopesSupported                  []string `json:"scopes_supported"`
-	ClaimsSupported                  []string `json:"claims_supported"`
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ClaimsParameterSupported          bool     `json:"claims_parameter_supported"`
+	RegistrationEndpoint              string   `json:"registration_endpoint"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+
+	BackchannelAuthenticationEndpoint      string   `json:"backchannel_authentication_endpoint"`
+	BackchannelTokenDeliveryModesSupported []string `json:"backchannel_token_delivery_modes_supported"`
+	BackchannelUserCodeParameterSupported  bool     `json:"backchannel_user_code_parameter_supported"`
 }
 
 func WellKnown(w http.ResponseWriter, r *http.Request) {
@@ -243,6 +302,17 @@ func WellKnown(w http.ResponseWriter, r *http.Request) {
 		UserinfoEndpoint:                 routes.OidcUserInfo.Url(realmName),
 		ScopesSupported:                  []string{"oidc", "email", "profile"}, //TODO: get that from database
 		ClaimsSupported:                  []string{"sub", "name", "email"},     //TODO: get that from database
+		ClaimsParameterSupported:         true,
+		RegistrationEndpoint:             routes.OidcRegister.Url(realmName),
+		GrantTypesSupported:              []string{constants.TokenGrantTypeAuthorizationCode, constants.TokenGrantTypeRefreshToken, constants.TokenGrantTypeCiba, constants.TokenGrantTypeClientCredentials},
+		TokenEndpointAuthMethodsSupported: []string{
+			constants.TokenEndpointAuthMethodNone,
+			constants.TokenEndpointAuthMethodClientSecretBasic,
+			constants.TokenEndpointAuthMethodClientSecretPost,
+		},
+		BackchannelAuthenticationEndpoint:      routes.OidcBackchannelAuthentication.Url(realmName),
+		BackchannelTokenDeliveryModesSupported: []string{constants.CibaTokenDeliveryModePoll},
+		BackchannelUserCodeParameterSupported:  false,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,131 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/services"
+	"net/http"
+)
+
+func writeClientInformationResponse(w http.ResponseWriter, status int, response *services.ClientInformationResponse) error {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+func manageClientRequest(r *http.Request) services.ManageClientRequest {
+	routeParams := mux.Vars(r)
+
+	return services.ManageClientRequest{
+		RealmName: routeParams["realmName"],
+		ClientId:  routeParams["clientId"],
+		Bearer:    r.Header.Get("Authorization"),
+	}
+}
+
+func RegisterClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	var metadata services.ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		rcs.Error(httpErrors.BadRequest().WithMessage("invalid_client_metadata: malformed request body"))
+		return
+	}
+
+	clientRegistrationService := ioc.Get[services.ClientRegistrationService](scope)
+	response, err := clientRegistrationService.RegisterClient(ctx, services.RegisterClientRequest{
+		RealmName: realmName,
+		Bearer:    r.Header.Get("Authorization"),
+		Metadata:  metadata,
+	})
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	err = writeClientInformationResponse(w, http.StatusCreated, response)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+func ReadClientRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	clientRegistrationService := ioc.Get[services.ClientRegistrationService](scope)
+	response, err := clientRegistrationService.ReadClient(ctx, manageClientRequest(r))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	err = writeClientInformationResponse(w, http.StatusOK, response)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+func UpdateClientRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	request := manageClientRequest(r)
+
+	var metadata struct {
+		services.ClientMetadata
+		ClientId string `json:"client_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		rcs.Error(httpErrors.BadRequest().WithMessage("invalid_client_metadata: malformed request body"))
+		return
+	}
+
+	if metadata.ClientId != request.ClientId {
+		rcs.Error(httpErrors.BadRequest().WithMessage("invalid_client_metadata: client_id does not match"))
+		return
+	}
+
+	clientRegistrationService := ioc.Get[services.ClientRegistrationService](scope)
+	response, err := clientRegistrationService.UpdateClient(ctx, request, metadata.ClientMetadata)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	err = writeClientInformationResponse(w, http.StatusOK, response)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+func DeleteClientRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	clientRegistrationService := ioc.Get[services.ClientRegistrationService](scope)
+	err := clientRegistrationService.DeleteClient(ctx, manageClientRequest(r))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
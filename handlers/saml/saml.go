@@ -0,0 +1,135 @@
+package saml
+
+import (
+	"github.com/gorilla/mux"
+	"holvit/handlers/auth"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/routes"
+	"holvit/saml"
+	"holvit/services"
+	"net/http"
+	"net/url"
+)
+
+func Metadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	samlService := ioc.Get[services.SamlService](scope)
+	metadata, err := samlService.Metadata(ctx, realmName)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(metadata)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+}
+
+// SingleSignOn handles SP-initiated SSO with either the HTTP-Redirect (GET) or the HTTP-POST (POST) binding.
+func SingleSignOn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	if err := r.ParseForm(); err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	samlRequest := r.Form.Get("SAMLRequest")
+	relayState := r.Form.Get("RelayState")
+	if samlRequest == "" {
+		rcs.Error(httpErrors.BadRequest().WithMessage("missing SAMLRequest"))
+		return
+	}
+
+	var data []byte
+	var err error
+	var rawQuery string
+	if r.Method == http.MethodPost {
+		data, err = saml.DecodePostBinding(samlRequest)
+	} else {
+		data, err = saml.DecodeRedirectBinding(samlRequest)
+		rawQuery = r.URL.RawQuery
+	}
+	if err != nil {
+		rcs.Error(httpErrors.BadRequest().WithMessage("malformed SAMLRequest"))
+		return
+	}
+
+	authnRequest, err := saml.ParseAuthnRequest(data)
+	if err != nil {
+		rcs.Error(httpErrors.BadRequest().WithMessage("invalid SAMLRequest: " + err.Error()))
+		return
+	}
+
+	samlService := ioc.Get[services.SamlService](scope)
+	ssoRequest := services.SamlSingleSignOnRequest{
+		RealmName:    realmName,
+		AuthnRequest: authnRequest,
+		RelayState:   relayState,
+		Message:      data,
+		RawQuery:     rawQuery,
+	}
+
+	currentUserService := ioc.Get[services.CurrentSessionService](scope)
+
+	if !currentUserService.IsAuthorized() {
+		// a forged or replayed request must not start a login for the service provider
+		err = samlService.VerifyRequest(ctx, ssoRequest)
+		if err != nil {
+			rcs.Error(err)
+			return
+		}
+
+		// the login only redirects back with a GET request, so a POST request is handed over with the redirect binding
+		// the query of a redirect request is kept as it is, its signature covers the query parameters as they were encoded
+		returnQuery := r.URL.RawQuery
+		if r.Method == http.MethodPost {
+			redirectRequest, err := saml.EncodeRedirectBinding(data)
+			if err != nil {
+				rcs.Error(err)
+				return
+			}
+
+			query := url.Values{}
+			query.Set("SAMLRequest", redirectRequest)
+			if relayState != "" {
+				query.Set("RelayState", relayState)
+			}
+			returnQuery = query.Encode()
+		}
+
+		err = auth.StartLogin(w, r, realmName, authnRequest.Issuer, routes.SamlSingleSignOn.Url(realmName)+"?"+returnQuery)
+		if err != nil {
+			rcs.Error(err)
+			return
+		}
+		return
+	}
+
+	response, err := samlService.SingleSignOn(ctx, ssoRequest)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	response.HandleHttp(w, r)
+}
@@ -0,0 +1,447 @@
+package scim
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/scim"
+	"holvit/services"
+	"net/http"
+	"strconv"
+)
+
+func writeScimResponse(w http.ResponseWriter, status int, response any) {
+	w.Header().Set("Content-Type", scim.ContentType)
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// writeScimResource writes a single resource with its version as etag.
+func writeScimResource(w http.ResponseWriter, r *http.Request, status int, resource any, meta *scim.Meta) {
+	w.Header().Set("ETag", meta.Version)
+
+	if r.Method == http.MethodGet && scim.MatchesETag(r.Header.Get("If-None-Match"), meta.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if status == http.StatusCreated {
+		w.Header().Set("Location", meta.Location)
+	}
+
+	writeScimResponse(w, status, resource)
+}
+
+func decodeScimBody[T any](r *http.Request) (T, error) {
+	var body T
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return body, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidSyntax, "invalid request body")
+	}
+	return body, nil
+}
+
+// authenticate returns the realm of the request if the bearer token is allowed to use scim.
+func authenticate(r *http.Request) (repos.Realm, error) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+
+	routeParams := mux.Vars(r)
+	realmName := routeParams["realmName"]
+
+	scimService := ioc.Get[services.ScimService](scope)
+	return scimService.Authenticate(ctx, realmName, r.Header.Get("Authorization"))
+}
+
+func listRequestFromQuery(r *http.Request) (services.ScimListRequest, error) {
+	query := r.URL.Query()
+
+	request := services.ScimListRequest{
+		StartIndex: 1,
+	}
+
+	if filter := query.Get("filter"); filter != "" {
+		request.Filter = h.Some(filter)
+	}
+
+	if rawStartIndex := query.Get("startIndex"); rawStartIndex != "" {
+		startIndex, err := strconv.Atoi(rawStartIndex)
+		if err != nil {
+			return request, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, "invalid startIndex")
+		}
+		request.StartIndex = startIndex
+	}
+
+	if rawCount := query.Get("count"); rawCount != "" {
+		count, err := strconv.Atoi(rawCount)
+		if err != nil {
+			return request, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, "invalid count")
+		}
+		request.Count = h.Some(count)
+	}
+
+	return request, nil
+}
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type filterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type bulkSupported struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type serviceProviderConfigResponse struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  bulkSupported          `json:"bulk"`
+	Filter                filterSupported        `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	ETag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+}
+
+func ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeScimResponse(w, http.StatusOK, serviceProviderConfigResponse{
+		Schemas: []string{scim.SchemaServiceProviderConfig},
+		Patch:   supported{Supported: true},
+		Bulk:    bulkSupported{Supported: false},
+		Filter: filterSupported{
+			Supported:  true,
+			MaxResults: services.ScimMaxResults,
+		},
+		ChangePassword: supported{Supported: false},
+		Sort:           supported{Supported: false},
+		ETag:           supported{Supported: true},
+		AuthenticationSchemes: []authenticationScheme{
+			{
+				Type:        "oauthbearertoken",
+				Name:        "OAuth Bearer Token",
+				Description: "An access token of a client with the scim role, issued with the client credentials grant",
+			},
+		},
+	})
+}
+
+func FindUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := listRequestFromQuery(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	response, err := scimService.FindUsers(ctx, realm, request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResponse(w, http.StatusOK, response)
+}
+
+func GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	user, err := scimService.GetUser(ctx, realm, mux.Vars(r)["id"])
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusOK, user, user.Meta)
+}
+
+func CreateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := decodeScimBody[scim.User](r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	user, err := scimService.CreateUser(ctx, realm, request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusCreated, user, user.Meta)
+}
+
+func ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := decodeScimBody[scim.User](r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	user, err := scimService.ReplaceUser(ctx, realm, mux.Vars(r)["id"], request, r.Header.Get("If-Match"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusOK, user, user.Meta)
+}
+
+func PatchUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := decodeScimBody[scim.PatchRequest](r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	user, err := scimService.PatchUser(ctx, realm, mux.Vars(r)["id"], request, r.Header.Get("If-Match"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusOK, user, user.Meta)
+}
+
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	err = scimService.DeleteUser(ctx, realm, mux.Vars(r)["id"], r.Header.Get("If-Match"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func FindGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := listRequestFromQuery(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	response, err := scimService.FindGroups(ctx, realm, request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResponse(w, http.StatusOK, response)
+}
+
+func GetGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	group, err := scimService.GetGroup(ctx, realm, mux.Vars(r)["id"])
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusOK, group, group.Meta)
+}
+
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := decodeScimBody[scim.Group](r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	group, err := scimService.CreateGroup(ctx, realm, request)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusCreated, group, group.Meta)
+}
+
+func ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := decodeScimBody[scim.Group](r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	group, err := scimService.ReplaceGroup(ctx, realm, mux.Vars(r)["id"], request, r.Header.Get("If-Match"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusOK, group, group.Meta)
+}
+
+func PatchGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	request, err := decodeScimBody[scim.PatchRequest](r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	group, err := scimService.PatchGroup(ctx, realm, mux.Vars(r)["id"], request, r.Header.Get("If-Match"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	writeScimResource(w, r, http.StatusOK, group, group.Meta)
+}
+
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	realm, err := authenticate(r)
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	scimService := ioc.Get[services.ScimService](scope)
+	err = scimService.DeleteGroup(ctx, realm, mux.Vars(r)["id"], r.Header.Get("If-Match"))
+	if err != nil {
+		rcs.Error(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -10,6 +10,12 @@ type HttpError struct {
 	message string
 }
 
+// ResponseError is implemented by errors that write their own response, e.g. in the format a protocol expects.
+type ResponseError interface {
+	error
+	WriteHttpResponse(w http.ResponseWriter) error
+}
+
 func (e *HttpError) Status() int {
 	return e.status
 }
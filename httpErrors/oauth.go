@@ -0,0 +1,37 @@
+package httpErrors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// OAuthError is an error of the token endpoint in the format of https://datatracker.ietf.org/doc/html/rfc6749#section-5.2,
+// clients decide on its code how to continue, e.g. a ciba client keeps polling while the authorization is pending.
+type OAuthError struct {
+	Status int
+	Code   string
+}
+
+func (e OAuthError) Error() string {
+	return e.Code
+}
+
+func OAuthBadRequest(code string) OAuthError {
+	return OAuthError{
+		Status: http.StatusBadRequest,
+		Code:   code,
+	}
+}
+
+type OAuthErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (e OAuthError) WriteHttpResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(e.Status)
+	return json.NewEncoder(w).Encode(OAuthErrorResponse{
+		Error: e.Code,
+	})
+}
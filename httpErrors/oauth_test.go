@@ -0,0 +1,23 @@
+package httpErrors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_OAuthError_WriteHttpResponse(t *testing.T) {
+	// arrange
+	w := httptest.NewRecorder()
+	err := OAuthBadRequest("authorization_pending")
+
+	// act
+	writeErr := err.WriteHttpResponse(w)
+
+	// assert
+	assert.NoError(t, writeErr)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"authorization_pending"}`, w.Body.String())
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/huandu/go-sqlbuilder"
-	"github.com/jaswdr/faker/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/robfig/cron/v3"
 	"holvit/cache"
@@ -18,6 +18,7 @@ import (
 	"holvit/ioc"
 	"holvit/logging"
 	"holvit/middlewares"
+	"holvit/realmexport"
 	"holvit/repos"
 	"holvit/requestContext"
 	"holvit/routes"
@@ -25,7 +26,6 @@ import (
 	"holvit/services"
 	"holvit/utils"
 	"os"
-	"strings"
 )
 
 func main() {
@@ -41,6 +41,10 @@ func main() {
 
 	ioc.RootScope = configureServices()
 
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(ioc.RootScope, flag.Args()))
+	}
+
 	initialize(ioc.RootScope)
 	server.Serve(ioc.RootScope)
 
@@ -49,6 +53,12 @@ func main() {
 }
 
 func initialize(dp *ioc.DependencyProvider) {
+	// open the breach corpus right away, a wrong path should fail on startup instead of on the first password change
+	ioc.Get[services.BreachedPasswordService](dp)
+
+	// a broken realm declaration should fail on startup as well
+	declaredRealms := ioc.Get[services.RealmConfigService](dp).LoadDeclaredRealms().Unwrap()
+
 	requestContext.RunWithScope(dp, context.Background(), func(ctx context.Context) {
 		scope := middlewares.GetScope(ctx)
 		realmRepository := ioc.Get[repos.RealmRepository](scope)
@@ -57,9 +67,13 @@ func initialize(dp *ioc.DependencyProvider) {
 			BaseFilter: repos.BaseFilter{},
 		})
 
-		if !realmsResult.Any() {
-			seedData(ctx)
-			seedDemoData(ctx)
+		firstStart := !realmsResult.Any()
+		if firstStart {
+			bootstrapMasterRealm(ctx)
+		}
+
+		if firstStart || config.C.Realms.ReconcileOnStartup {
+			reconcileRealms(ctx, declaredRealms)
 		}
 
 		initializeApplicationData(ctx)
@@ -75,10 +89,12 @@ func initializeApplicationData(ctx context.Context) {
 	realmService.InitializeRealmKeys(ctx)
 }
 
-func seedData(ctx context.Context) {
+// bootstrapMasterRealm creates the master realm with the client of the admin frontend and the admin user.
+// Everything else is declared in the realm configuration.
+func bootstrapMasterRealm(ctx context.Context) {
 	scope := middlewares.GetScope(ctx)
 
-	logging.Logger.Info("Seeding data...")
+	logging.Logger.Info("Creating the master realm...")
 
 	realmService := ioc.Get[services.RealmService](scope)
 	masterRealm := realmService.CreateRealm(ctx, services.CreateRealmRequest{
@@ -87,16 +103,14 @@ func seedData(ctx context.Context) {
 	})
 
 	clientService := ioc.Get[services.ClientService](scope)
-	adminClient := clientService.CreateClient(ctx, services.CreateClientRequest{
+	clientService.CreateClient(ctx, services.CreateClientRequest{
 		RealmId:      masterRealm.Id,
-		ClientId:     h.Some("holvit_admin"),
+		ClientId:     h.Some(constants.AdminClientId),
 		DisplayName:  "Holvit Admin",
 		WithSecret:   false,
 		RedirectUrls: []string{routes.AdminFrontend.Url()},
 	})
 
-	logging.Logger.Infof("admin client id=%s secret=%s", adminClient.ClientId, adminClient.ClientSecret)
-
 	userService := ioc.Get[services.UserService](scope)
 	adminUserId := userService.CreateUser(ctx, services.CreateUserRequest{
 		RealmId:  masterRealm.Id,
@@ -117,64 +131,29 @@ func seedData(ctx context.Context) {
 	})
 
 	userService.SetPassword(ctx, services.SetPasswordRequest{
-		UserId:    adminUserId,
-		Password:  config.C.InitialAdminPassword,
-		Temporary: true,
-	}, services.DangerousNoAuthStrategy{})
+		UserId:       adminUserId,
+		Password:     config.C.InitialAdminPassword,
+		Temporary:    true,
+		IgnorePolicy: true,
+	}, services.DangerousNoAuthStrategy{}).Unwrap()
 }
 
-func seedDemoData(ctx context.Context) {
-	if !config.C.IsDevelopment() {
-		return
-	}
-	fake := faker.New()
-
+func reconcileRealms(ctx context.Context, realms []realmexport.Document) {
 	scope := middlewares.GetScope(ctx)
 
-	logging.Logger.Info("Seeding demo data...")
+	logging.Logger.Infof("Reconciling %d declared realms...", len(realms))
 
-	realmService := ioc.Get[services.RealmService](scope)
-	realm := realmService.CreateRealm(ctx, services.CreateRealmRequest{
-		Name:        "demo",
-		DisplayName: "Demo Realm",
-	})
-
-	for i := 0; i < 5; i++ {
-		clientService := ioc.Get[services.ClientService](scope)
-		_ = clientService.CreateClient(ctx, services.CreateClientRequest{
-			RealmId:      realm.Id,
-			ClientId:     h.Some(fake.Internet().Slug()),
-			DisplayName:  fake.App().Name(),
-			WithSecret:   false,
-			RedirectUrls: []string{fake.Internet().Domain()},
-		})
-	}
+	realmConfigService := ioc.Get[services.RealmConfigService](scope)
+	response := realmConfigService.ReconcileRealms(ctx, services.ReconcileRealmsRequest{
+		Realms: realms,
+	}).Unwrap()
 
-	roleService := ioc.Get[services.RoleService](scope)
-	for i := 0; i < 5; i++ {
-		name := fake.Company().JobTitle()
-		roleService.CreateRole(ctx, services.CreateRoleRequest{
-			RealmId:     realm.Id,
-			ClientId:    h.None[uuid.UUID](),
-			Name:        strings.ToLower(name),
-			DisplayName: h.None[string](),
-			Description: h.Some(fake.Company().BS()),
-		})
+	for _, change := range response.Changes {
+		logging.Logger.Info(change.String())
 	}
 
-	for i := 0; i < 10; i++ {
-		userService := ioc.Get[services.UserService](scope)
-		userId := userService.CreateUser(ctx, services.CreateUserRequest{
-			RealmId:  realm.Id,
-			Username: fake.Gamer().Tag(),
-			Email:    h.Some(fake.Internet().Email()),
-		}).Unwrap()
-
-		userService.SetPassword(ctx, services.SetPasswordRequest{
-			UserId:    userId,
-			Password:  config.C.InitialAdminPassword,
-			Temporary: false,
-		}, services.DangerousNoAuthStrategy{})
+	for _, secret := range response.ClientSecrets {
+		logging.Logger.Infof("client id=%s realm=%s secret=%s", secret.ClientId, secret.Realm, secret.Secret)
 	}
 }
 
@@ -194,6 +173,9 @@ func configureServices() *ioc.DependencyProvider {
 	})
 
 	ioc.AddSingleton(builder, func(dp *ioc.DependencyProvider) services.FrontendService { return services.NewFrontendService() })
+	ioc.AddSingleton(builder, func(dp *ioc.DependencyProvider) services.BreachedPasswordService {
+		return services.NewBreachedPasswordService(config.C.BreachedPasswords.CorpusPath)
+	})
 
 	ioc.AddScoped(builder, func(dp *ioc.DependencyProvider) requestContext.RequestContextService {
 		return requestContext.NewRequestContextService(dp)
@@ -223,6 +205,18 @@ func configureServices() *ioc.DependencyProvider {
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.RoleRepository {
 		return repos.NewRoleRepository()
 	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.RoleImplicationRepository {
+		return repos.NewRoleImplicationRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.GroupRepository {
+		return repos.NewGroupRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.GroupMemberRepository {
+		return repos.NewGroupMemberRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.GroupRoleRepository {
+		return repos.NewGroupRoleRepository()
+	})
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.RefreshTokenRepository {
 		return repos.NewRefreshTokenRepository()
 	})
@@ -238,19 +232,103 @@ func configureServices() *ioc.DependencyProvider {
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.SessionRepository {
 		return repos.NewSessionRepository()
 	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.PasswordResetTokenRepository {
+		return repos.NewPasswordResetTokenRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.InitialAccessTokenRepository {
+		return repos.NewInitialAccessTokenRepository()
+	})
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.UserRoleRepository {
 		return repos.NewUserRoleRepository()
 	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.ClientRoleRepository {
+		return repos.NewClientRoleRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.IdentityProviderRepository {
+		return repos.NewIdentityProviderRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.AuthenticationFlowRepository {
+		return repos.NewAuthenticationFlowRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.PasswordHistoryRepository {
+		return repos.NewPasswordHistoryRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.SecurityEventRepository {
+		return repos.NewSecurityEventRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.FederatedIdentityRepository {
+		return repos.NewFederatedIdentityRepository()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.LdapProviderRepository {
+		return repos.NewLdapProviderRepository()
+	})
 
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.UserService {
 		return services.NewUserService()
 	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.UserImportService {
+		return services.NewUserImportService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.RealmExportService {
+		return services.NewRealmExportService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.RealmConfigService {
+		return services.NewRealmConfigService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.GroupService {
+		return services.NewGroupService()
+	})
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.RealmService {
 		return services.NewRealmService()
 	})
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.ClientService {
 		return services.NewClientService()
 	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.ConsentService {
+		return services.NewConsentService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.SamlService {
+		return services.NewSamlService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.CibaService {
+		return services.NewCibaService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.CibaNotifier {
+		return services.NewMailCibaNotifier()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.IdentityBrokerService {
+		return services.NewIdentityBrokerService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.LdapFederationService {
+		return services.NewLdapFederationService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.ScimService {
+		return services.NewScimService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.WebauthnService {
+		return services.NewWebauthnService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.EmailLoginService {
+		return services.NewEmailLoginService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.RegistrationService {
+		return services.NewRegistrationService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.PasswordResetService {
+		return services.NewPasswordResetService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.EmailVerificationService {
+		return services.NewEmailVerificationService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.AuthenticationFlowService {
+		return services.NewAuthenticationFlowService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.BruteForceService {
+		return services.NewBruteForceService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.ClientRegistrationService {
+		return services.NewClientRegistrationService()
+	})
 	ioc.Add(builder, func(dp *ioc.DependencyProvider) services.RefreshTokenService {
 		return services.NewRefreshTokenService()
 	})
@@ -294,6 +372,7 @@ func configureServices() *ioc.DependencyProvider {
 
 	// configure crons
 	c.AddFunc(config.C.Crons.SessionCleanup, crons.SessionCleanup)
+	c.AddFunc(config.C.Crons.LdapSync, crons.LdapSync)
 
 	c.Start()
 
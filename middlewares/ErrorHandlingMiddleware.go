@@ -20,6 +20,11 @@ func handleError(w http.ResponseWriter, err error) {
 
 		logging.Logger.Info(err)
 		http.Error(w, message, err.Status())
+	case httpErrors.ResponseError:
+		logging.Logger.Info(err)
+		if writeErr := err.WriteHttpResponse(w); writeErr != nil {
+			logging.Logger.Error(writeErr)
+		}
 	default:
 		msg := "An internal server error occurred"
 
@@ -2,12 +2,32 @@ package middlewares
 
 import (
 	"holvit/config"
+	"io"
 	"net/http"
 )
 
+// limitedBody keeps the original body so single handlers can allow bigger requests.
+type limitedBody struct {
+	io.ReadCloser
+	original io.ReadCloser
+}
+
 func MaxReadBytesMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.Body = http.MaxBytesReader(w, r.Body, config.C.Server.MaxReadBytes)
+		r.Body = limitedBody{
+			ReadCloser: http.MaxBytesReader(w, r.Body, config.C.Server.MaxReadBytes),
+			original:   r.Body,
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RaiseMaxReadBytes replaces the limit of the request body, it has to be called before the body is read.
+func RaiseMaxReadBytes(w http.ResponseWriter, r *http.Request, maxReadBytes int64) {
+	if body, ok := r.Body.(limitedBody); ok {
+		r.Body = limitedBody{
+			ReadCloser: http.MaxBytesReader(w, body.original, maxReadBytes),
+			original:   body.original,
+		}
+	}
+}
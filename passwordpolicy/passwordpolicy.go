@@ -0,0 +1,180 @@
+package passwordpolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+const (
+	ViolationMinLength        = "min_length"
+	ViolationLowercase        = "lowercase"
+	ViolationUppercase        = "uppercase"
+	ViolationDigit            = "digit"
+	ViolationSpecialCharacter = "special_character"
+	ViolationContainsUsername = "contains_username"
+	ViolationContainsEmail    = "contains_email"
+	ViolationDenylisted       = "denylisted"
+	ViolationBreached         = "breached"
+	// ViolationHistory is reported by the caller, checking the history needs the hashes of the previous passwords.
+	ViolationHistory = "history"
+)
+
+// Policy is the set of rules passwords of a realm have to follow, rules with their zero value are not checked.
+type Policy struct {
+	MinLength        int  `json:"minLength"`
+	RequireLowercase bool `json:"requireLowercase"`
+	RequireUppercase bool `json:"requireUppercase"`
+	RequireDigit     bool `json:"requireDigit"`
+	// RequireSpecialCharacter asks for a character that is neither a letter nor a digit.
+	RequireSpecialCharacter bool `json:"requireSpecialCharacter"`
+	ForbidUsername          bool `json:"forbidUsername"`
+	ForbidEmail             bool `json:"forbidEmail"`
+	// MaxAgeDays forces users to choose a new password once theirs is older.
+	MaxAgeDays int `json:"maxAgeDays"`
+	// Denylist contains passwords that are not allowed regardless of the other rules, they are compared case-insensitively.
+	Denylist []string `json:"denylist"`
+	// ForbidBreached rejects passwords that appeared in known data breaches more than MaxBreachCount times.
+	ForbidBreached bool `json:"forbidBreached"`
+	MaxBreachCount int  `json:"maxBreachCount"`
+}
+
+// Subject is the user the password is checked for.
+type Subject struct {
+	Username string
+	Email    string
+}
+
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error lists all rules a password violates.
+type Error struct {
+	Violations []Violation
+}
+
+func (e Error) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+type errorResponse struct {
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations"`
+}
+
+// WriteHttpResponse lists every violated rule, the frontend shows them next to the password input.
+func (e Error) WriteHttpResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	return json.NewEncoder(w).Encode(errorResponse{
+		Message:    e.Error(),
+		Violations: e.Violations,
+	})
+}
+
+// Validate checks that the policy itself is sensible.
+func Validate(policy Policy) error {
+	if policy.MinLength < 1 {
+		return errors.New("minLength has to be positive")
+	}
+	if policy.MaxAgeDays < 0 {
+		return errors.New("maxAgeDays must not be negative")
+	}
+	if policy.MaxBreachCount < 0 {
+		return errors.New("maxBreachCount must not be negative")
+	}
+	return nil
+}
+
+// Check returns the rules the password violates, it is empty if the password is allowed.
+func Check(policy Policy, password string, subject Subject) []Violation {
+	var violations []Violation
+
+	if len([]rune(password)) < policy.MinLength {
+		violations = append(violations, Violation{
+			Code:    ViolationMinLength,
+			Message: fmt.Sprintf("the password has to be at least %d characters long", policy.MinLength),
+		})
+	}
+
+	if policy.RequireLowercase && !strings.ContainsFunc(password, unicode.IsLower) {
+		violations = append(violations, Violation{
+			Code:    ViolationLowercase,
+			Message: "the password has to contain a lowercase letter",
+		})
+	}
+
+	if policy.RequireUppercase && !strings.ContainsFunc(password, unicode.IsUpper) {
+		violations = append(violations, Violation{
+			Code:    ViolationUppercase,
+			Message: "the password has to contain an uppercase letter",
+		})
+	}
+
+	if policy.RequireDigit && !strings.ContainsFunc(password, unicode.IsDigit) {
+		violations = append(violations, Violation{
+			Code:    ViolationDigit,
+			Message: "the password has to contain a digit",
+		})
+	}
+
+	if policy.RequireSpecialCharacter && !strings.ContainsFunc(password, isSpecialCharacter) {
+		violations = append(violations, Violation{
+			Code:    ViolationSpecialCharacter,
+			Message: "the password has to contain a special character",
+		})
+	}
+
+	lowerPassword := strings.ToLower(password)
+
+	if policy.ForbidUsername && subject.Username != "" && strings.Contains(lowerPassword, strings.ToLower(subject.Username)) {
+		violations = append(violations, Violation{
+			Code:    ViolationContainsUsername,
+			Message: "the password must not contain the username",
+		})
+	}
+
+	if policy.ForbidEmail && subject.Email != "" && strings.Contains(lowerPassword, strings.ToLower(subject.Email)) {
+		violations = append(violations, Violation{
+			Code:    ViolationContainsEmail,
+			Message: "the password must not contain the email",
+		})
+	}
+
+	for _, denied := range policy.Denylist {
+		if strings.EqualFold(password, denied) {
+			violations = append(violations, Violation{
+				Code:    ViolationDenylisted,
+				Message: "the password is not allowed",
+			})
+			break
+		}
+	}
+
+	return violations
+}
+
+// CheckBreachCount returns the violation of the breached password rule for a password seen breachCount times in breaches.
+func CheckBreachCount(policy Policy, breachCount int) []Violation {
+	if !policy.ForbidBreached || breachCount <= policy.MaxBreachCount {
+		return nil
+	}
+
+	return []Violation{{
+		Code:    ViolationBreached,
+		Message: fmt.Sprintf("the password has appeared %d times in known data breaches", breachCount),
+	}}
+}
+
+func isSpecialCharacter(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
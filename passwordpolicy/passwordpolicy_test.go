@@ -0,0 +1,146 @@
+package passwordpolicy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func codes(violations []Violation) []string {
+	result := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		result = append(result, violation.Code)
+	}
+	return result
+}
+
+func TestCheck_AllowsPasswordFollowingAllRules(t *testing.T) {
+	// arrange
+	policy := Policy{
+		MinLength:               10,
+		RequireLowercase:        true,
+		RequireUppercase:        true,
+		RequireDigit:            true,
+		RequireSpecialCharacter: true,
+		ForbidUsername:          true,
+		ForbidEmail:             true,
+		Denylist:                []string{"Password123!"},
+	}
+
+	// act
+	violations := Check(policy, "Correct-Horse-42", Subject{Username: "alice", Email: "alice@example.com"})
+
+	// assert
+	assert.Empty(t, violations)
+}
+
+func TestCheck_ReportsAllViolatedCharacterRules(t *testing.T) {
+	// arrange
+	policy := Policy{
+		MinLength:               10,
+		RequireLowercase:        true,
+		RequireUppercase:        true,
+		RequireDigit:            true,
+		RequireSpecialCharacter: true,
+	}
+
+	// act
+	violations := Check(policy, "abc", Subject{})
+
+	// assert
+	assert.Equal(t, []string{ViolationMinLength, ViolationUppercase, ViolationDigit, ViolationSpecialCharacter}, codes(violations))
+}
+
+func TestCheck_CountsCharactersNotBytes(t *testing.T) {
+	// arrange
+	policy := Policy{MinLength: 4}
+
+	// act
+	violations := Check(policy, "äöü", Subject{})
+
+	// assert
+	assert.Equal(t, []string{ViolationMinLength}, codes(violations))
+}
+
+func TestCheck_UsernameAndEmailAreCaseInsensitive(t *testing.T) {
+	// arrange
+	policy := Policy{MinLength: 1, ForbidUsername: true, ForbidEmail: true}
+
+	// act
+	violations := Check(policy, "xxALICE@Example.comxx", Subject{Username: "Alice", Email: "alice@example.com"})
+
+	// assert
+	assert.Equal(t, []string{ViolationContainsUsername, ViolationContainsEmail}, codes(violations))
+}
+
+func TestCheck_Denylist(t *testing.T) {
+	// arrange
+	policy := Policy{MinLength: 1, Denylist: []string{"letmein"}}
+
+	// act
+	denied := Check(policy, "LetMeIn", Subject{})
+	allowed := Check(policy, "letmein2", Subject{})
+
+	// assert
+	assert.Equal(t, []string{ViolationDenylisted}, codes(denied))
+	assert.Empty(t, allowed)
+}
+
+func TestError_JoinsMessages(t *testing.T) {
+	// arrange
+	err := Error{Violations: []Violation{
+		{Code: ViolationDigit, Message: "a"},
+		{Code: ViolationLowercase, Message: "b"},
+	}}
+
+	// act
+	message := err.Error()
+
+	// assert
+	assert.Equal(t, "a, b", message)
+}
+
+func TestValidate(t *testing.T) {
+	// act
+	valid := Validate(Policy{MinLength: 8})
+	noMinLength := Validate(Policy{})
+	negativeMaxAge := Validate(Policy{MinLength: 8, MaxAgeDays: -1})
+	negativeMaxBreachCount := Validate(Policy{MinLength: 8, MaxBreachCount: -1})
+
+	// assert
+	assert.NoError(t, valid)
+	assert.Error(t, noMinLength)
+	assert.Error(t, negativeMaxAge)
+	assert.Error(t, negativeMaxBreachCount)
+}
+
+func TestCheckBreachCount_ReportsPasswordsBreachedTooOften(t *testing.T) {
+	// arrange
+	policy := Policy{MinLength: 8, ForbidBreached: true, MaxBreachCount: 2}
+
+	// act
+	allowed := CheckBreachCount(policy, 2)
+	breached := CheckBreachCount(policy, 1337)
+	disabled := CheckBreachCount(Policy{MinLength: 8}, 1337)
+
+	// assert
+	assert.Empty(t, allowed)
+	assert.Equal(t, []string{ViolationBreached}, codes(breached))
+	assert.Contains(t, breached[0].Message, "1337 times")
+	assert.Empty(t, disabled)
+}
+
+func TestError_WriteHttpResponse_ListsViolations(t *testing.T) {
+	// arrange
+	w := httptest.NewRecorder()
+	err := Error{Violations: []Violation{{Code: ViolationDigit, Message: "must contain a digit"}}}
+
+	// act
+	writeErr := err.WriteHttpResponse(w)
+
+	// assert
+	assert.NoError(t, writeErr)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"message":"must contain a digit","violations":[{"code":"digit","message":"must contain a digit"}]}`, w.Body.String())
+}
@@ -0,0 +1,170 @@
+package realmconfig
+
+import (
+	"fmt"
+	"holvit/realmexport"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+const (
+	KindRealm       = "realm"
+	KindClient      = "client"
+	KindScope       = "scope"
+	KindClaimMapper = "claim mapper"
+	KindRole        = "role"
+	KindUser        = "user"
+)
+
+// Change is a difference between the declaration of a realm and the realm in the database.
+type Change struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Realm  string `json:"realm"`
+	Name   string `json:"name"`
+	// Fields are the json names of the fields an update changes.
+	Fields []string `json:"fields,omitempty"`
+}
+
+func (c Change) String() string {
+	var symbol string
+	switch c.Action {
+	case ActionCreate:
+		symbol = "+"
+	case ActionUpdate:
+		symbol = "~"
+	case ActionDelete:
+		symbol = "-"
+	}
+
+	text := fmt.Sprintf("%s %s %s/%s", symbol, c.Kind, c.Realm, c.Name)
+	if len(c.Fields) > 0 {
+		text += fmt.Sprintf(" (%s)", strings.Join(c.Fields, ", "))
+	}
+	return text
+}
+
+// Diff returns the changes that turn the current realm into the desired one, current is nil if the realm does not exist yet.
+// Lists that are left out of the declaration are not managed, a declared list deletes the objects missing from it.
+// Users are never deleted and the passwords of existing users are not compared, they are only set when a user is created.
+func Diff(current *realmexport.Document, desired realmexport.Document) []Change {
+	realmName := desired.Realm.Name
+	if current == nil {
+		return append([]Change{{Action: ActionCreate, Kind: KindRealm, Realm: realmName, Name: realmName}},
+			diffObjects(realmName, &realmexport.Document{}, desired)...)
+	}
+
+	var changes []Change
+	if fields := changedFields(current.Realm, desired.Realm); len(fields) > 0 {
+		changes = append(changes, Change{Action: ActionUpdate, Kind: KindRealm, Realm: realmName, Name: realmName, Fields: fields})
+	}
+
+	return append(changes, diffObjects(realmName, current, desired)...)
+}
+
+func diffObjects(realmName string, current *realmexport.Document, desired realmexport.Document) []Change {
+	var changes []Change
+
+	changes = append(changes, diffKeyed(realmName, KindClient, current.Clients, desired.Clients, true, func(c realmexport.Client) string {
+		return c.ClientId
+	})...)
+
+	changes = append(changes, diffKeyed(realmName, KindScope, current.Scopes, desired.Scopes, true, func(s realmexport.Scope) string {
+		return s.Name
+	})...)
+
+	changes = append(changes, diffKeyed(realmName, KindClaimMapper, current.ClaimMappers, desired.ClaimMappers, true, func(c realmexport.ClaimMapper) string {
+		return c.Type + ":" + c.ClaimName
+	})...)
+
+	changes = append(changes, diffKeyed(realmName, KindRole, current.Roles, desired.Roles, true, func(r realmexport.Role) string {
+		return r.Name
+	})...)
+
+	changes = append(changes, diffKeyed(realmName, KindUser, current.Users, desired.Users, false, func(u realmexport.User) string {
+		return strings.ToLower(u.Username)
+	}, "passwordHash", "passwordTemporary")...)
+
+	return changes
+}
+
+func diffKeyed[T any](realmName string, kind string, current []T, desired []T, deleteMissing bool, key func(T) string, ignoredFields ...string) []Change {
+	currentByKey := make(map[string]T, len(current))
+	for _, object := range current {
+		currentByKey[key(object)] = object
+	}
+
+	var changes []Change
+	desiredKeys := make(map[string]bool, len(desired))
+	for _, object := range desired {
+		objectKey := key(object)
+		desiredKeys[objectKey] = true
+
+		existing, ok := currentByKey[objectKey]
+		if !ok {
+			changes = append(changes, Change{Action: ActionCreate, Kind: kind, Realm: realmName, Name: objectKey})
+			continue
+		}
+
+		if fields := changedFields(existing, object, ignoredFields...); len(fields) > 0 {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: kind, Realm: realmName, Name: objectKey, Fields: fields})
+		}
+	}
+
+	if deleteMissing && desired != nil {
+		for _, object := range current {
+			if objectKey := key(object); !desiredKeys[objectKey] {
+				changes = append(changes, Change{Action: ActionDelete, Kind: kind, Realm: realmName, Name: objectKey})
+			}
+		}
+	}
+
+	return changes
+}
+
+// changedFields compares the fields of two structs and returns the json names of the ones that differ.
+// Lists of strings are compared without their order, missing and empty lists are the same.
+func changedFields[T any](a T, b T, ignoredFields ...string) []string {
+	aValue := reflect.ValueOf(a)
+	bValue := reflect.ValueOf(b)
+	t := aValue.Type()
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if slices.Contains(ignoredFields, name) {
+			continue
+		}
+
+		if !equalValues(aValue.Field(i).Interface(), bValue.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+func equalValues(a interface{}, b interface{}) bool {
+	aStrings, ok := a.([]string)
+	if ok {
+		bStrings := b.([]string)
+		if len(aStrings) != len(bStrings) {
+			return false
+		}
+
+		aSorted := slices.Clone(aStrings)
+		bSorted := slices.Clone(bStrings)
+		slices.Sort(aSorted)
+		slices.Sort(bSorted)
+		return slices.Equal(aSorted, bSorted)
+	}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,113 @@
+package realmconfig
+
+import (
+	"github.com/stretchr/testify/assert"
+	"holvit/realmexport"
+	"testing"
+)
+
+func testDocument() realmexport.Document {
+	return realmexport.Document{
+		Version: realmexport.Version,
+		Realm: realmexport.Realm{
+			Name:        "demo",
+			DisplayName: "Demo",
+		},
+		Clients: []realmexport.Client{
+			{ClientId: "app", RedirectUris: []string{"https://a", "https://b"}},
+			{ClientId: "legacy"},
+		},
+		Scopes: []realmexport.Scope{
+			{Name: "openid"},
+		},
+		Roles: []realmexport.Role{
+			{Name: "admin", Implies: []string{"user"}},
+			{Name: "user"},
+		},
+		Users: []realmexport.User{
+			{Username: "alice", PasswordHash: "$2a$10$old"},
+		},
+	}
+}
+
+func TestDiff_CreatesEverythingForNewRealm(t *testing.T) {
+	// arrange
+	desired := testDocument()
+
+	// act
+	changes := Diff(nil, desired)
+
+	// assert
+	assert.Len(t, changes, 7)
+	for _, change := range changes {
+		assert.Equal(t, ActionCreate, change.Action)
+	}
+	assert.Equal(t, KindRealm, changes[0].Kind)
+}
+
+func TestDiff_NoChangesForEqualRealms(t *testing.T) {
+	// arrange
+	current := testDocument()
+	desired := testDocument()
+	// the order of lists does not matter
+	desired.Clients[0].RedirectUris = []string{"https://b", "https://a"}
+	desired.Clients[1].RedirectUris = []string{}
+	// passwords of existing users are not compared
+	desired.Users[0].PasswordHash = "$2a$10$new"
+
+	// act
+	changes := Diff(&current, desired)
+
+	// assert
+	assert.Empty(t, changes)
+}
+
+func TestDiff_FindsUpdatesAndDeletes(t *testing.T) {
+	// arrange
+	current := testDocument()
+	current.Users = append(current.Users, realmexport.User{Username: "bob"})
+	desired := testDocument()
+	desired.Realm.DisplayName = "Demo Realm"
+	desired.Clients = desired.Clients[:1]
+	desired.Roles[0].Implies = nil
+	desired.Roles[0].Description = "Administrators"
+	desired.Users = nil
+
+	// act
+	changes := Diff(&current, desired)
+
+	// assert
+	assert.Equal(t, []Change{
+		{Action: ActionUpdate, Kind: KindRealm, Realm: "demo", Name: "demo", Fields: []string{"displayName"}},
+		{Action: ActionDelete, Kind: KindClient, Realm: "demo", Name: "legacy"},
+		{Action: ActionUpdate, Kind: KindRole, Realm: "demo", Name: "admin", Fields: []string{"description", "implies"}},
+	}, changes)
+}
+
+func TestDiff_KeepsObjectsOfListsLeftOut(t *testing.T) {
+	// arrange
+	current := testDocument()
+	desired := testDocument()
+	desired.Scopes = nil
+	desired.Clients = []realmexport.Client{}
+
+	// act
+	changes := Diff(&current, desired)
+
+	// assert
+	assert.Equal(t, []Change{
+		{Action: ActionDelete, Kind: KindClient, Realm: "demo", Name: "app"},
+		{Action: ActionDelete, Kind: KindClient, Realm: "demo", Name: "legacy"},
+	}, changes)
+}
+
+func TestChange_String(t *testing.T) {
+	// arrange
+	change := Change{Action: ActionUpdate, Kind: KindRole, Realm: "demo", Name: "admin", Fields: []string{"description", "implies"}}
+
+	// act
+	text := change.String()
+
+	// assert
+	assert.Equal(t, "~ role demo/admin (description, implies)", text)
+}
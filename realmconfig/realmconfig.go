@@ -0,0 +1,185 @@
+package realmconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"holvit/constants"
+	"holvit/realmexport"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// realmDefaults are the settings of realms that are not declared, they match the defaults of realms created by the admin api.
+var realmDefaults = map[string]interface{}{
+	"requireUsername":       true,
+	"emailLoginMode":        constants.EmailLoginModeDisabled,
+	"passwordHistoryLength": 3,
+	"passwordPolicy": map[string]interface{}{
+		"minLength":      8,
+		"forbidUsername": true,
+		"forbidEmail":    true,
+	},
+	"bruteForceProtection":      true,
+	"bruteForceMaxFailures":     5,
+	"bruteForceIpMaxFailures":   50,
+	"bruteForceLockoutSeconds":  900,
+	"bruteForceMaxDelaySeconds": 30,
+}
+
+// Load reads the realm declarations at the path, which is a file or a directory of .yml, .yaml and .json files.
+func Load(path string) ([]realmexport.Document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		files = nil
+		for _, entry := range entries {
+			extension := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && (extension == ".yml" || extension == ".yaml" || extension == ".json") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	var documents []realmexport.Document
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		documents = append(documents, parsed...)
+	}
+
+	realmNames := make(map[string]bool)
+	for _, document := range documents {
+		if realmNames[document.Realm.Name] {
+			return nil, fmt.Errorf("realm '%s' is declared more than once", document.Realm.Name)
+		}
+		realmNames[document.Realm.Name] = true
+	}
+
+	return documents, nil
+}
+
+// Parse reads realm documents from yaml, a stream can hold several documents separated by ---.
+// The documents have the format of realm exports, which are valid yaml as well. Settings that are left out get their defaults.
+func Parse(r io.Reader) ([]realmexport.Document, error) {
+	decoder := yaml.NewDecoder(r)
+
+	var documents []realmexport.Document
+	for {
+		var raw map[string]interface{}
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			continue
+		}
+
+		document, err := parseDocument(raw)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+func parseDocument(raw map[string]interface{}) (realmexport.Document, error) {
+	if _, ok := raw["version"]; !ok {
+		raw["version"] = realmexport.Version
+	}
+
+	realm, ok := raw["realm"].(map[string]interface{})
+	if !ok {
+		return realmexport.Document{}, errors.New("the realm of the document is missing")
+	}
+	setDefaults(realm, realmDefaults)
+
+	if clients, ok := raw["clients"].([]interface{}); ok {
+		for _, client := range clients {
+			if client, ok := client.(map[string]interface{}); ok {
+				setDefaults(client, clientDefaults(client))
+			}
+		}
+	}
+
+	// the yaml is converted to json to use the json names of the document fields
+	content, err := json.Marshal(raw)
+	if err != nil {
+		return realmexport.Document{}, err
+	}
+
+	var document realmexport.Document
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&document); err != nil {
+		return realmexport.Document{}, err
+	}
+
+	if err := realmexport.Validate(document); err != nil {
+		return realmexport.Document{}, fmt.Errorf("realm '%s': %w", document.Realm.Name, err)
+	}
+
+	return document, nil
+}
+
+// clientDefaults are the settings of clients that are not declared, they match the defaults of clients created by the admin api.
+func clientDefaults(client map[string]interface{}) map[string]interface{} {
+	defaults := map[string]interface{}{
+		"protocol":                constants.ClientProtocolOidc,
+		"consentRequired":         true,
+		"tokenEndpointAuthMethod": constants.TokenEndpointAuthMethodNone,
+	}
+
+	if hasSecret, _ := client["hasSecret"].(bool); hasSecret {
+		defaults["tokenEndpointAuthMethod"] = constants.TokenEndpointAuthMethodClientSecretBasic
+	}
+
+	// service providers do not use any of the oidc flows
+	if protocol, ok := client["protocol"]; !ok || protocol == constants.ClientProtocolOidc {
+		defaults["grantTypes"] = []interface{}{constants.TokenGrantTypeAuthorizationCode, constants.TokenGrantTypeRefreshToken}
+		defaults["responseTypes"] = []interface{}{constants.AuthorizationResponseTypeCode}
+	}
+
+	return defaults
+}
+
+func setDefaults(values map[string]interface{}, defaults map[string]interface{}) {
+	for key, value := range defaults {
+		if _, ok := values[key]; !ok {
+			values[key] = value
+		}
+	}
+}
+
+// HasRealm reports whether a realm with the name is declared.
+func HasRealm(documents []realmexport.Document, name string) bool {
+	return slices.ContainsFunc(documents, func(document realmexport.Document) bool {
+		return document.Realm.Name == name
+	})
+}
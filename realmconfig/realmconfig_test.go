@@ -0,0 +1,129 @@
+package realmconfig
+
+import (
+	"github.com/stretchr/testify/assert"
+	"holvit/constants"
+	"holvit/realmexport"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse_AppliesDefaults(t *testing.T) {
+	// arrange
+	content := `
+realm:
+  name: demo
+  displayName: Demo Realm
+clients:
+  - clientId: app
+    redirectUris: [https://app.example.com/callback]
+  - clientId: backend
+    hasSecret: true
+`
+
+	// act
+	documents, err := Parse(strings.NewReader(content))
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, documents, 1)
+
+	document := documents[0]
+	assert.Equal(t, realmexport.Version, document.Version)
+	assert.Equal(t, "demo", document.Realm.Name)
+	assert.True(t, document.Realm.RequireUsername)
+	assert.Equal(t, 8, document.Realm.PasswordPolicy.MinLength)
+	assert.Equal(t, 5, document.Realm.BruteForceMaxFailures)
+
+	assert.Equal(t, constants.ClientProtocolOidc, document.Clients[0].Protocol)
+	assert.True(t, document.Clients[0].ConsentRequired)
+	assert.Equal(t, constants.TokenEndpointAuthMethodNone, document.Clients[0].TokenEndpointAuthMethod)
+	assert.Equal(t, []string{constants.AuthorizationResponseTypeCode}, document.Clients[0].ResponseTypes)
+	assert.Equal(t, constants.TokenEndpointAuthMethodClientSecretBasic, document.Clients[1].TokenEndpointAuthMethod)
+}
+
+func TestParse_KeepsDeclaredValues(t *testing.T) {
+	// arrange
+	content := `
+realm:
+  name: demo
+  requireUsername: false
+  bruteForceMaxFailures: 10
+clients:
+  - clientId: sp
+    protocol: saml
+    consentRequired: false
+`
+
+	// act
+	documents, err := Parse(strings.NewReader(content))
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, documents[0].Realm.RequireUsername)
+	assert.Equal(t, 10, documents[0].Realm.BruteForceMaxFailures)
+	assert.False(t, documents[0].Clients[0].ConsentRequired)
+	assert.Empty(t, documents[0].Clients[0].GrantTypes)
+}
+
+func TestParse_ReadsSeveralDocuments(t *testing.T) {
+	// arrange
+	content := "realm:\n  name: first\n---\nrealm:\n  name: second\n"
+
+	// act
+	documents, err := Parse(strings.NewReader(content))
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, documents, 2)
+	assert.Equal(t, "second", documents[1].Realm.Name)
+}
+
+func TestParse_RejectsInvalidDocuments(t *testing.T) {
+	// arrange
+	unknownField := "realm:\n  name: demo\n  colour: blue\n"
+	missingRealm := "clients: []\n"
+	unknownScope := "realm:\n  name: demo\nclaimMappers:\n  - type: roles\n    claimName: roles\n    scopes: [roles]\n"
+
+	// act
+	_, unknownFieldErr := Parse(strings.NewReader(unknownField))
+	_, missingRealmErr := Parse(strings.NewReader(missingRealm))
+	_, unknownScopeErr := Parse(strings.NewReader(unknownScope))
+
+	// assert
+	assert.ErrorContains(t, unknownFieldErr, "colour")
+	assert.Error(t, missingRealmErr)
+	assert.ErrorContains(t, unknownScopeErr, "unknown scope")
+}
+
+func TestLoad_ReadsDirectory(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yml"), []byte("realm:\n  name: a\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"realm": {"name": "b"}}`), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a realm"), 0o600))
+
+	// act
+	documents, err := Load(dir)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, documents, 2)
+	assert.True(t, HasRealm(documents, "a"))
+	assert.True(t, HasRealm(documents, "b"))
+}
+
+func TestLoad_RejectsDuplicateRealms(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yml"), []byte("realm:\n  name: a\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.yml"), []byte("realm:\n  name: a\n"), 0o600))
+
+	// act
+	_, err := Load(dir)
+
+	// assert
+	assert.ErrorContains(t, err, "more than once")
+}
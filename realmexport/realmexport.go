@@ -0,0 +1,263 @@
+package realmexport
+
+import (
+	"errors"
+	"fmt"
+	"holvit/constants"
+	"holvit/passwordpolicy"
+	"slices"
+	"strings"
+)
+
+// Version is increased whenever the format of the document changes incompatibly.
+const Version = 1
+
+const (
+	// PolicyCreate fails the import if the realm already exists.
+	PolicyCreate = "create"
+	// PolicyOverwrite updates the realm and all objects of the document that already exist.
+	PolicyOverwrite = "overwrite"
+	// PolicySkipExisting only creates what does not exist yet, existing objects are left unchanged.
+	PolicySkipExisting = "skip-existing"
+)
+
+var Policies = []string{PolicyCreate, PolicyOverwrite, PolicySkipExisting}
+
+// Document is the configuration of a realm. Objects reference each other by name instead of by id,
+// so a document can be imported into another installation.
+// Authentication flows and the internal roles created with every realm are not part of it.
+type Document struct {
+	Version      int           `json:"version"`
+	Realm        Realm         `json:"realm"`
+	Roles        []Role        `json:"roles"`
+	Scopes       []Scope       `json:"scopes"`
+	ClaimMappers []ClaimMapper `json:"claimMappers"`
+	Clients      []Client      `json:"clients"`
+	Users        []User        `json:"users,omitempty"`
+}
+
+type Realm struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+
+	RequireUsername           bool   `json:"requireUsername"`
+	RequireEmail              bool   `json:"requireEmail"`
+	RequireDeviceVerification bool   `json:"requireDeviceVerification"`
+	RequireTotp               bool   `json:"requireTotp"`
+	RequireWebauthn           bool   `json:"requireWebauthn"`
+	EnableRememberMe          bool   `json:"enableRememberMe"`
+	RequireEmailVerification  bool   `json:"requireEmailVerification"`
+	EmailLoginMode            string `json:"emailLoginMode"`
+
+	PasswordHistoryLength int                   `json:"passwordHistoryLength"`
+	PasswordPolicy        passwordpolicy.Policy `json:"passwordPolicy"`
+
+	EnableRegistration           bool `json:"enableRegistration"`
+	RegistrationRequiresApproval bool `json:"registrationRequiresApproval"`
+	// DefaultRoles are the names of the roles assigned to users that register themselves.
+	DefaultRoles []string `json:"defaultRoles"`
+
+	ConsentExpirySeconds *int `json:"consentExpirySeconds"`
+
+	BruteForceProtection            bool `json:"bruteForceProtection"`
+	BruteForceMaxFailures           int  `json:"bruteForceMaxFailures"`
+	BruteForceIpMaxFailures         int  `json:"bruteForceIpMaxFailures"`
+	BruteForceLockoutSeconds        int  `json:"bruteForceLockoutSeconds"`
+	BruteForceMaxDelaySeconds       int  `json:"bruteForceMaxDelaySeconds"`
+	BruteForcePermanentLockoutAfter *int `json:"bruteForcePermanentLockoutAfter"`
+}
+
+type Role struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	// Client is the client id of the client a client role belongs to.
+	Client *string `json:"client,omitempty"`
+	// Implies are the names of the roles this role implies directly.
+	Implies []string `json:"implies"`
+}
+
+type Scope struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	SortIndex   int    `json:"sortIndex"`
+}
+
+// ClaimMapper is identified by its type and claim name, claim mappers have no name of their own.
+type ClaimMapper struct {
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	ClaimName   string `json:"claimName"`
+	// Property is the user property of user info claim mappers.
+	Property string `json:"property,omitempty"`
+	// Scopes are the names of the scopes the claim mapper belongs to.
+	Scopes []string `json:"scopes"`
+}
+
+type Client struct {
+	ClientId    string `json:"clientId"`
+	DisplayName string `json:"displayName"`
+	Protocol    string `json:"protocol"`
+	// HasSecret is set for confidential clients, the secret itself is not exported and a new one is generated on import.
+	HasSecret bool `json:"hasSecret"`
+
+	RedirectUris            []string `json:"redirectUris"`
+	GrantTypes              []string `json:"grantTypes"`
+	TokenEndpointAuthMethod string   `json:"tokenEndpointAuthMethod"`
+	Jwks                    *string  `json:"jwks"`
+
+	ResponseTypes  []string `json:"responseTypes"`
+	DefaultScopes  []string `json:"defaultScopes"`
+	OptionalScopes []string `json:"optionalScopes"`
+
+	PkceRequired    bool `json:"pkceRequired"`
+	ConsentRequired bool `json:"consentRequired"`
+
+	AccessTokenLifetimeSeconds  *int `json:"accessTokenLifetimeSeconds"`
+	IdTokenLifetimeSeconds      *int `json:"idTokenLifetimeSeconds"`
+	RefreshTokenLifetimeSeconds *int `json:"refreshTokenLifetimeSeconds"`
+
+	FrontChannelLogoutUri *string  `json:"frontChannelLogoutUri"`
+	BackChannelLogoutUri  *string  `json:"backChannelLogoutUri"`
+	WebOrigins            []string `json:"webOrigins"`
+
+	SamlNameIdFormat       *string `json:"samlNameIdFormat"`
+	SamlSignatureAlgorithm *string `json:"samlSignatureAlgorithm"`
+
+	SamlRequireSignedRequests bool    `json:"samlRequireSignedRequests"`
+	SamlSigningCertificate    *string `json:"samlSigningCertificate"`
+}
+
+type User struct {
+	Username      string  `json:"username"`
+	Email         *string `json:"email"`
+	EmailVerified bool    `json:"emailVerified"`
+	Enabled       bool    `json:"enabled"`
+	// PasswordHash is the hash of the password, the password is verified and rehashed by the importing installation.
+	PasswordHash      string   `json:"passwordHash,omitempty"`
+	PasswordTemporary bool     `json:"passwordTemporary"`
+	Roles             []string `json:"roles"`
+}
+
+// Validate checks the document for errors that can be found without looking at the realm it is imported into.
+// Roles implied by other roles can not be checked, they can also be internal roles of the realm.
+func Validate(document Document) error {
+	if document.Version != Version {
+		return fmt.Errorf("unsupported document version %d, expected %d", document.Version, Version)
+	}
+
+	if err := validateRealm(document.Realm); err != nil {
+		return err
+	}
+
+	clientIds := make(map[string]bool)
+	for _, client := range document.Clients {
+		if client.ClientId == "" {
+			return errors.New("the client id of every client is required")
+		}
+		if clientIds[client.ClientId] {
+			return fmt.Errorf("duplicate client '%s'", client.ClientId)
+		}
+		if client.Protocol != constants.ClientProtocolOidc && client.Protocol != constants.ClientProtocolSaml {
+			return fmt.Errorf("client '%s' has the unsupported protocol '%s'", client.ClientId, client.Protocol)
+		}
+		clientIds[client.ClientId] = true
+	}
+
+	roleNames := make(map[string]bool)
+	for _, role := range document.Roles {
+		if role.Name == "" {
+			return errors.New("the name of every role is required")
+		}
+		if roleNames[role.Name] {
+			return fmt.Errorf("duplicate role '%s'", role.Name)
+		}
+		if role.Client != nil && !clientIds[*role.Client] {
+			return fmt.Errorf("role '%s' belongs to the unknown client '%s'", role.Name, *role.Client)
+		}
+		if slices.Contains(role.Implies, role.Name) {
+			return fmt.Errorf("role '%s' implies itself", role.Name)
+		}
+		roleNames[role.Name] = true
+	}
+
+	scopeNames := make(map[string]bool)
+	for _, scope := range document.Scopes {
+		if scope.Name == "" {
+			return errors.New("the name of every scope is required")
+		}
+		if scopeNames[scope.Name] {
+			return fmt.Errorf("duplicate scope '%s'", scope.Name)
+		}
+		scopeNames[scope.Name] = true
+	}
+
+	claimMappers := make(map[string]bool)
+	for _, claimMapper := range document.ClaimMappers {
+		if claimMapper.Type != constants.ClaimMapperUserInfo && claimMapper.Type != constants.ClaimMapperRoles && claimMapper.Type != constants.ClaimMapperGroups {
+			return fmt.Errorf("claim mapper '%s' has the unsupported type '%s'", claimMapper.ClaimName, claimMapper.Type)
+		}
+		if claimMapper.ClaimName == "" {
+			return errors.New("the claim name of every claim mapper is required")
+		}
+		key := claimMapper.Type + ":" + claimMapper.ClaimName
+		if claimMappers[key] {
+			return fmt.Errorf("duplicate %s claim mapper for claim '%s'", claimMapper.Type, claimMapper.ClaimName)
+		}
+		for _, scope := range claimMapper.Scopes {
+			if !scopeNames[scope] {
+				return fmt.Errorf("claim mapper '%s' belongs to the unknown scope '%s'", claimMapper.ClaimName, scope)
+			}
+		}
+		claimMappers[key] = true
+	}
+
+	usernames := make(map[string]bool)
+	for _, user := range document.Users {
+		if user.Username == "" {
+			return errors.New("the username of every user is required")
+		}
+		// usernames are unique regardless of their case
+		username := strings.ToLower(user.Username)
+		if usernames[username] {
+			return fmt.Errorf("duplicate user '%s'", user.Username)
+		}
+		usernames[username] = true
+	}
+
+	return nil
+}
+
+func validateRealm(realm Realm) error {
+	if realm.Name == "" {
+		return errors.New("the realm name is required")
+	}
+
+	if !slices.Contains(constants.EmailLoginModes, realm.EmailLoginMode) {
+		return fmt.Errorf("invalid email login mode '%s'", realm.EmailLoginMode)
+	}
+
+	if err := passwordpolicy.Validate(realm.PasswordPolicy); err != nil {
+		return fmt.Errorf("invalid password policy: %w", err)
+	}
+
+	if realm.PasswordHistoryLength < 0 {
+		return errors.New("passwordHistoryLength must not be negative")
+	}
+
+	if realm.BruteForceMaxFailures < 1 || realm.BruteForceIpMaxFailures < 1 || realm.BruteForceLockoutSeconds < 1 {
+		return errors.New("brute force thresholds have to be positive")
+	}
+
+	if realm.BruteForceMaxDelaySeconds < 0 {
+		return errors.New("bruteForceMaxDelaySeconds must not be negative")
+	}
+
+	if realm.BruteForcePermanentLockoutAfter != nil && *realm.BruteForcePermanentLockoutAfter < 1 {
+		return errors.New("bruteForcePermanentLockoutAfter has to be positive")
+	}
+
+	return nil
+}
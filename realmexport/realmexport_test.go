@@ -0,0 +1,109 @@
+package realmexport
+
+import (
+	"github.com/stretchr/testify/assert"
+	"holvit/constants"
+	"holvit/passwordpolicy"
+	"testing"
+)
+
+func validDocument() Document {
+	client := "app"
+	return Document{
+		Version: Version,
+		Realm: Realm{
+			Name:                     "demo",
+			EmailLoginMode:           constants.EmailLoginModeDisabled,
+			PasswordPolicy:           passwordpolicy.Policy{MinLength: 8},
+			BruteForceMaxFailures:    5,
+			BruteForceIpMaxFailures:  50,
+			BruteForceLockoutSeconds: 900,
+		},
+		Roles: []Role{
+			{Name: "admin", Implies: []string{"user"}},
+			{Name: "user"},
+			{Name: "app.viewer", Client: &client},
+		},
+		Scopes: []Scope{
+			{Name: "openid"},
+			{Name: "roles"},
+		},
+		ClaimMappers: []ClaimMapper{
+			{Type: constants.ClaimMapperRoles, ClaimName: "roles", Scopes: []string{"roles"}},
+			{Type: constants.ClaimMapperGroups, ClaimName: "groups", Scopes: []string{"roles"}},
+			{Type: constants.ClaimMapperUserInfo, ClaimName: "sub", Property: constants.UserInfoPropertyId, Scopes: []string{"openid"}},
+		},
+		Clients: []Client{
+			{ClientId: "app", Protocol: constants.ClientProtocolOidc},
+		},
+		Users: []User{
+			{Username: "alice", Roles: []string{"admin"}},
+		},
+	}
+}
+
+func TestValidate_AcceptsValidDocument(t *testing.T) {
+	// act
+	err := Validate(validDocument())
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func TestValidate_RejectsOtherVersions(t *testing.T) {
+	// arrange
+	document := validDocument()
+	document.Version = Version + 1
+
+	// act
+	err := Validate(document)
+
+	// assert
+	assert.ErrorContains(t, err, "version")
+}
+
+func TestValidate_RejectsInvalidRealmSettings(t *testing.T) {
+	// arrange
+	noName := validDocument()
+	noName.Realm.Name = ""
+	invalidPolicy := validDocument()
+	invalidPolicy.Realm.PasswordPolicy = passwordpolicy.Policy{}
+	invalidEmailLoginMode := validDocument()
+	invalidEmailLoginMode.Realm.EmailLoginMode = "carrier pigeon"
+
+	// act & assert
+	assert.Error(t, Validate(noName))
+	assert.ErrorContains(t, Validate(invalidPolicy), "password policy")
+	assert.ErrorContains(t, Validate(invalidEmailLoginMode), "carrier pigeon")
+}
+
+func TestValidate_RejectsDuplicates(t *testing.T) {
+	// arrange
+	duplicateRole := validDocument()
+	duplicateRole.Roles = append(duplicateRole.Roles, Role{Name: "admin"})
+	duplicateClaimMapper := validDocument()
+	duplicateClaimMapper.ClaimMappers = append(duplicateClaimMapper.ClaimMappers, ClaimMapper{Type: constants.ClaimMapperRoles, ClaimName: "roles"})
+	duplicateUser := validDocument()
+	duplicateUser.Users = append(duplicateUser.Users, User{Username: "Alice"})
+
+	// act & assert
+	assert.ErrorContains(t, Validate(duplicateRole), "duplicate role")
+	assert.ErrorContains(t, Validate(duplicateClaimMapper), "duplicate")
+	assert.ErrorContains(t, Validate(duplicateUser), "duplicate user")
+}
+
+func TestValidate_RejectsUnknownReferences(t *testing.T) {
+	// arrange
+	unknownClient := "other"
+	unknownRoleClient := validDocument()
+	unknownRoleClient.Roles = append(unknownRoleClient.Roles, Role{Name: "other.viewer", Client: &unknownClient})
+	unknownScope := validDocument()
+	unknownScope.ClaimMappers[0].Scopes = []string{"groups"}
+	selfImplication := validDocument()
+	selfImplication.Roles[1].Implies = []string{"user"}
+
+	// act & assert
+	assert.ErrorContains(t, Validate(unknownRoleClient), "unknown client")
+	assert.ErrorContains(t, Validate(unknownScope), "unknown scope")
+	assert.ErrorContains(t, Validate(selfImplication), "implies itself")
+}
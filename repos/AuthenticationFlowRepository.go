@@ -0,0 +1,243 @@
+package repos
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/lib/pq"
+	"holvit/authflow"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+type AuthenticationFlowExecutions []authflow.Execution
+
+func (e AuthenticationFlowExecutions) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *AuthenticationFlowExecutions) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &e)
+}
+
+type AuthenticationFlow struct {
+	BaseModel
+
+	RealmId uuid.UUID
+
+	Name       string
+	Executions AuthenticationFlowExecutions
+}
+
+type AuthenticationFlowFilter struct {
+	BaseFilter
+
+	RealmId h.Opt[uuid.UUID]
+	Name    h.Opt[string]
+}
+
+type AuthenticationFlowUpdate struct {
+	Name       h.Opt[string]
+	Executions h.Opt[AuthenticationFlowExecutions]
+}
+
+type DuplicateAuthenticationFlowNameError struct{}
+
+func (e DuplicateAuthenticationFlowNameError) Error() string {
+	return "Duplicate authentication flow name"
+}
+
+type AuthenticationFlowRepository interface {
+	FindAuthenticationFlowById(ctx context.Context, id uuid.UUID) h.Opt[AuthenticationFlow]
+	FindAuthenticationFlows(ctx context.Context, filter AuthenticationFlowFilter) FilterResult[AuthenticationFlow]
+	CreateAuthenticationFlow(ctx context.Context, authenticationFlow AuthenticationFlow) h.Result[uuid.UUID]
+	UpdateAuthenticationFlow(ctx context.Context, id uuid.UUID, upd AuthenticationFlowUpdate) h.UResult
+	DeleteAuthenticationFlow(ctx context.Context, id uuid.UUID)
+}
+
+type authenticationFlowRepositoryImpl struct{}
+
+func NewAuthenticationFlowRepository() AuthenticationFlowRepository {
+	return &authenticationFlowRepositoryImpl{}
+}
+
+func (a *authenticationFlowRepositoryImpl) FindAuthenticationFlowById(ctx context.Context, id uuid.UUID) h.Opt[AuthenticationFlow] {
+	return a.FindAuthenticationFlows(ctx, AuthenticationFlowFilter{
+		BaseFilter: BaseFilter{
+			Id: h.Some(id),
+		},
+	}).SingleOrNone()
+}
+
+func (a *authenticationFlowRepositoryImpl) FindAuthenticationFlows(ctx context.Context, filter AuthenticationFlowFilter) FilterResult[AuthenticationFlow] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "name", "executions").
+		From("authentication_flows")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.RealmId.IfSome(func(x uuid.UUID) {
+		q.Where("realm_id = ?", x)
+	})
+
+	filter.Name.IfSome(func(x string) {
+		q.Where("name = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	filter.SortInfo.IfSome(func(x SortInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []AuthenticationFlow
+	for rows.Next() {
+		var row AuthenticationFlow
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.RealmId,
+			&row.Name,
+			&row.Executions)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (a *authenticationFlowRepositoryImpl) CreateAuthenticationFlow(ctx context.Context, authenticationFlow AuthenticationFlow) h.Result[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("authentication_flows", "realm_id", "name", "executions").
+		Values(authenticationFlow.RealmId,
+			authenticationFlow.Name,
+			authenticationFlow.Executions).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				if pqErr.Constraint == "idx_unique_authentication_flow_name_per_realm" {
+					return h.Err[uuid.UUID](DuplicateAuthenticationFlowNameError{})
+				}
+			}
+		}
+
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.Ok(resultingId)
+}
+
+func (a *authenticationFlowRepositoryImpl) UpdateAuthenticationFlow(ctx context.Context, id uuid.UUID, upd AuthenticationFlowUpdate) h.UResult {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	sb := sqlbuilder.Update("authentication_flows")
+
+	upd.Name.IfSome(func(x string) {
+		sb.Set(sb.Assign("name", x))
+	})
+
+	upd.Executions.IfSome(func(x AuthenticationFlowExecutions) {
+		sb.Set(sb.Assign("executions", x))
+	})
+
+	sb.Where(sb.Equal("id", id))
+
+	sqlString, args := sb.Build()
+	logging.Logger.Debugf("executing sql: %s", sqlString)
+	_, err = tx.Exec(sqlString, args...)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				if pqErr.Constraint == "idx_unique_authentication_flow_name_per_realm" {
+					return h.UErr(DuplicateAuthenticationFlowNameError{})
+				}
+			}
+		}
+
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.UOk()
+}
+
+func (a *authenticationFlowRepositoryImpl) DeleteAuthenticationFlow(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("authentication_flows").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -48,14 +48,20 @@ func (i SortInfo) SqlString() string {
 type PagingInfo struct {
 	PageSize   int
 	PageNumber int
+	// Offset skips additional rows, it is used for apis that page by index like scim.
+	Offset int
+}
+
+func (i PagingInfo) offset() int {
+	return i.PageSize*(i.PageNumber-1) + i.Offset
 }
 
 func (i PagingInfo) Apply(sb sqlb.SelectQuery) {
-	sb.Limit(i.PageSize).Offset(i.PageSize * (i.PageNumber - 1))
+	sb.Limit(i.PageSize).Offset(i.offset())
 }
 
 func (i PagingInfo) SqlString() string {
-	return fmt.Sprintf(" limit %d offset %d", i.PageSize, i.PageSize*(i.PageNumber-1))
+	return fmt.Sprintf(" limit %d offset %d", i.PageSize, i.offset())
 }
 
 type FilterResult[T any] interface {
@@ -46,6 +46,24 @@ func (c *RolesClaimMapperDetails) Scan(value interface{}) error {
 	return json.Unmarshal(b, &c)
 }
 
+// GroupsClaimMapperDetails emit the paths of the groups the user is a member of.
+type GroupsClaimMapperDetails struct {
+	ClaimName string
+}
+
+func (c GroupsClaimMapperDetails) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *GroupsClaimMapperDetails) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &c)
+}
+
 type UserInfoClaimMapperDetails struct {
 	ClaimName string
 	Property  string
@@ -64,11 +82,18 @@ func (c *UserInfoClaimMapperDetails) Scan(value interface{}) error {
 	return json.Unmarshal(b, &c)
 }
 
+type ClaimMapperUpdate struct {
+	DisplayName h.Opt[string]
+	Description h.Opt[string]
+	Details     h.Opt[interface{}]
+}
+
 type ClaimMapperFilter struct {
 	BaseFilter
 
-	RealmId  h.Opt[uuid.UUID]
-	ScopeIds h.Opt[[]uuid.UUID]
+	RealmId    h.Opt[uuid.UUID]
+	ScopeIds   h.Opt[[]uuid.UUID]
+	ClaimNames h.Opt[[]string]
 }
 
 type AssociateScopeClaimRequest struct {
@@ -80,7 +105,10 @@ type ClaimMapperRepository interface {
 	FindClaimMapperById(ctx context.Context, id uuid.UUID) h.Opt[ClaimMapper]
 	FindClaimMappers(ctx context.Context, filter ClaimMapperFilter) FilterResult[ClaimMapper]
 	CreateClaimMapper(ctx context.Context, claimMapper ClaimMapper) uuid.UUID
+	UpdateClaimMapper(ctx context.Context, id uuid.UUID, upd ClaimMapperUpdate)
+	DeleteClaimMapper(ctx context.Context, id uuid.UUID)
 	AssociateClaimMapper(ctx context.Context, request AssociateScopeClaimRequest) uuid.UUID
+	DisassociateClaimMapper(ctx context.Context, request AssociateScopeClaimRequest)
 }
 
 type claimMapperRepositoryImpl struct{}
@@ -108,7 +136,7 @@ func (c *claimMapperRepositoryImpl) FindClaimMappers(ctx context.Context, filter
 
 	q := sqlb.Select(filter.CountCol(), "c.id", "c.realm_id", "c.display_name", "c.description", "c.type", "c.details").From("claim_mappers c")
 
-	filter.Id.IfSome(func(x uuid.UUID) {
+	filter.RealmId.IfSome(func(x uuid.UUID) {
 		q.Where("c.realm_id = ?", x)
 	})
 
@@ -123,6 +151,10 @@ func (c *claimMapperRepositoryImpl) FindClaimMappers(ctx context.Context, filter
 			Where("sc.scope_id = any(?::uuid[])", pq.Array(x))))
 	})
 
+	filter.ClaimNames.IfSome(func(x []string) {
+		q.Where("c.details->>'ClaimName' = any(?::text[])", pq.Array(x))
+	})
+
 	filter.PagingInfo.IfSome(func(x PagingInfo) {
 		x.Apply(q)
 	})
@@ -161,6 +193,8 @@ func (c *claimMapperRepositoryImpl) FindClaimMappers(ctx context.Context, filter
 			row.Details = utils.FromRawMessage[UserInfoClaimMapperDetails](detailsRaw).Unwrap()
 		case constants.ClaimMapperRoles:
 			row.Details = utils.FromRawMessage[RolesClaimMapperDetails](detailsRaw).Unwrap()
+		case constants.ClaimMapperGroups:
+			row.Details = utils.FromRawMessage[GroupsClaimMapperDetails](detailsRaw).Unwrap()
 		default:
 			logging.Logger.Fatalf("Unsupported mapper type '%v' in claims mapper '%v'", row.Type, row.Id.String())
 		}
@@ -200,6 +234,63 @@ func (c *claimMapperRepositoryImpl) CreateClaimMapper(ctx context.Context, claim
 	return resultingId
 }
 
+func (c *claimMapperRepositoryImpl) UpdateClaimMapper(ctx context.Context, id uuid.UUID, upd ClaimMapperUpdate) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Update("claim_mappers")
+
+	upd.DisplayName.IfSome(func(x string) {
+		q.Set("display_name", x)
+	})
+
+	upd.Description.IfSome(func(x string) {
+		q.Set("description", x)
+	})
+
+	upd.Details.IfSome(func(x interface{}) {
+		q.Set("details", x)
+	})
+
+	q.Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (c *claimMapperRepositoryImpl) DeleteClaimMapper(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	queries := []sqlb.Query{
+		sqlb.DeleteFrom("scope_claims").Where("claim_mapper_id = ?", id),
+		sqlb.DeleteFrom("claim_mappers").Where("id = ?", id),
+	}
+
+	for _, q := range queries {
+		query := q.Build()
+		logging.Logger.Debugf("executing sql: %s", query.Sql)
+		_, err = tx.Exec(query.Sql, query.Parameters...)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+	}
+}
+
 func (c *claimMapperRepositoryImpl) AssociateClaimMapper(ctx context.Context, request AssociateScopeClaimRequest) uuid.UUID {
 	scope := middlewares.GetScope(ctx)
 	rcs := ioc.Get[requestContext.RequestContextService](scope)
@@ -225,3 +316,24 @@ func (c *claimMapperRepositoryImpl) AssociateClaimMapper(ctx context.Context, re
 
 	return resultingId
 }
+
+func (c *claimMapperRepositoryImpl) DisassociateClaimMapper(ctx context.Context, request AssociateScopeClaimRequest) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("scope_claims").
+		Where("scope_id = ?", request.ScopeId).
+		Where("claim_mapper_id = ?", request.ClaimMapperId)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -20,11 +20,43 @@ type Client struct {
 	RealmId uuid.UUID
 
 	DisplayName string
+	Protocol    string
 
 	ClientId     string
 	ClientSecret h.Opt[string]
 
 	RedirectUris []string
+
+	GrantTypes              []string
+	TokenEndpointAuthMethod string
+	Jwks                    h.Opt[string]
+
+	HashedRegistrationAccessToken h.Opt[string]
+
+	ResponseTypes  []string
+	DefaultScopes  []string
+	OptionalScopes []string
+
+	PkceRequired    bool
+	ConsentRequired bool
+
+	AccessTokenLifetimeSeconds  h.Opt[int]
+	IdTokenLifetimeSeconds      h.Opt[int]
+	RefreshTokenLifetimeSeconds h.Opt[int]
+
+	FrontChannelLogoutUri h.Opt[string]
+	BackChannelLogoutUri  h.Opt[string]
+	WebOrigins            []string
+
+	SamlNameIdFormat h.Opt[string]
+	// SamlSignatureAlgorithm is the signature method of the responses to the service provider, RSA-SHA256 if it is not set.
+	SamlSignatureAlgorithm h.Opt[string]
+	// SamlRequireSignedRequests rejects AuthnRequests that are not signed with the SamlSigningCertificate.
+	SamlRequireSignedRequests bool
+	SamlSigningCertificate    h.Opt[string]
+
+	// AuthenticationFlowId overrides the authentication flow of the realm for logins to this client.
+	AuthenticationFlowId h.Opt[uuid.UUID]
 }
 
 type DuplicateClientIdError struct{}
@@ -38,12 +70,42 @@ type ClientFilter struct {
 
 	RealmId  h.Opt[uuid.UUID]
 	ClientId h.Opt[string]
+	Protocol h.Opt[string]
 }
 
 type ClientUpdate struct {
 	DisplayName  h.Opt[string]
 	RedirectUris h.Opt[[]string]
-	ClientSecret h.Opt[string]
+	ClientSecret h.Opt[h.Opt[string]]
+
+	GrantTypes              h.Opt[[]string]
+	TokenEndpointAuthMethod h.Opt[string]
+	Jwks                    h.Opt[h.Opt[string]]
+
+	HashedRegistrationAccessToken h.Opt[string]
+
+	ResponseTypes  h.Opt[[]string]
+	DefaultScopes  h.Opt[[]string]
+	OptionalScopes h.Opt[[]string]
+
+	PkceRequired    h.Opt[bool]
+	ConsentRequired h.Opt[bool]
+
+	AccessTokenLifetimeSeconds  h.Opt[h.Opt[int]]
+	IdTokenLifetimeSeconds      h.Opt[h.Opt[int]]
+	RefreshTokenLifetimeSeconds h.Opt[h.Opt[int]]
+
+	FrontChannelLogoutUri h.Opt[h.Opt[string]]
+	BackChannelLogoutUri  h.Opt[h.Opt[string]]
+	WebOrigins            h.Opt[[]string]
+
+	SamlNameIdFormat       h.Opt[h.Opt[string]]
+	SamlSignatureAlgorithm h.Opt[h.Opt[string]]
+
+	SamlRequireSignedRequests h.Opt[bool]
+	SamlSigningCertificate    h.Opt[h.Opt[string]]
+
+	AuthenticationFlowId h.Opt[h.Opt[uuid.UUID]]
 }
 
 type ClientRepository interface {
@@ -51,6 +113,7 @@ type ClientRepository interface {
 	FindClients(ctx context.Context, filter ClientFilter) FilterResult[Client]
 	CreateClient(ctx context.Context, client Client) h.Result[uuid.UUID]
 	UpdateClient(ctx context.Context, id uuid.UUID, upd ClientUpdate) h.UResult
+	DeleteClient(ctx context.Context, id uuid.UUID)
 }
 
 type clientRepositoryImpl struct{}
@@ -77,7 +140,12 @@ func (c *clientRepositoryImpl) FindClients(ctx context.Context, filter ClientFil
 	}
 
 	q := sqlb.Select(filter.CountCol(),
-		"id", "realm_id", "display_name", "client_id", "hashed_client_secret", "redirect_uris").
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "display_name", "client_id", "hashed_client_secret", "redirect_uris",
+		"grant_types", "token_endpoint_auth_method", "jwks", "hashed_registration_access_token",
+		"response_types", "default_scopes", "optional_scopes", "pkce_required", "consent_required",
+		"access_token_lifetime_seconds", "id_token_lifetime_seconds", "refresh_token_lifetime_seconds",
+		"front_channel_logout_uri", "back_channel_logout_uri", "web_origins", "protocol", "saml_name_id_format", "saml_signature_algorithm",
+		"saml_require_signed_requests", "saml_signing_certificate", "authentication_flow_id").
 		From("clients")
 
 	filter.Id.IfSome(func(x uuid.UUID) {
@@ -92,6 +160,10 @@ func (c *clientRepositoryImpl) FindClients(ctx context.Context, filter ClientFil
 		q.Where("client_id = ?", x)
 	})
 
+	filter.Protocol.IfSome(func(x string) {
+		q.Where("protocol = ?", x)
+	})
+
 	filter.PagingInfo.IfSome(func(x PagingInfo) {
 		x.Apply(q)
 	})
@@ -114,11 +186,34 @@ func (c *clientRepositoryImpl) FindClients(ctx context.Context, filter ClientFil
 		var row Client
 		err := rows.Scan(&totalCount,
 			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
 			&row.RealmId,
 			&row.DisplayName,
 			&row.ClientId,
 			row.ClientSecret.AsMutPtr(),
-			pq.Array(&row.RedirectUris))
+			pq.Array(&row.RedirectUris),
+			pq.Array(&row.GrantTypes),
+			&row.TokenEndpointAuthMethod,
+			row.Jwks.AsMutPtr(),
+			row.HashedRegistrationAccessToken.AsMutPtr(),
+			pq.Array(&row.ResponseTypes),
+			pq.Array(&row.DefaultScopes),
+			pq.Array(&row.OptionalScopes),
+			&row.PkceRequired,
+			&row.ConsentRequired,
+			row.AccessTokenLifetimeSeconds.AsMutPtr(),
+			row.IdTokenLifetimeSeconds.AsMutPtr(),
+			row.RefreshTokenLifetimeSeconds.AsMutPtr(),
+			row.FrontChannelLogoutUri.AsMutPtr(),
+			row.BackChannelLogoutUri.AsMutPtr(),
+			pq.Array(&row.WebOrigins),
+			&row.Protocol,
+			row.SamlNameIdFormat.AsMutPtr(),
+			row.SamlSignatureAlgorithm.AsMutPtr(),
+			&row.SamlRequireSignedRequests,
+			row.SamlSigningCertificate.AsMutPtr(),
+			row.AuthenticationFlowId.AsMutPtr())
 		if err != nil {
 			panic(mapCustomErrorCodes(err))
 		}
@@ -140,14 +235,39 @@ func (c *clientRepositoryImpl) CreateClient(ctx context.Context, client Client)
 	}
 
 	err = tx.QueryRow(`insert into "clients"
-    			("realm_id", "display_name", "client_id", "hashed_client_secret", "redirect_uris")
-    			values ($1, $2, $3, $4, $5)
+    			("realm_id", "display_name", "client_id", "hashed_client_secret", "redirect_uris",
+    			 "grant_types", "token_endpoint_auth_method", "jwks", "hashed_registration_access_token",
+    			 "response_types", "default_scopes", "optional_scopes", "pkce_required", "consent_required",
+    			 "access_token_lifetime_seconds", "id_token_lifetime_seconds", "refresh_token_lifetime_seconds",
+    			 "front_channel_logout_uri", "back_channel_logout_uri", "web_origins", "protocol", "saml_name_id_format", "saml_signature_algorithm",
+    			 "saml_require_signed_requests", "saml_signing_certificate")
+    			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
     			returning "id"`,
 		client.RealmId,
 		client.DisplayName,
 		client.ClientId,
 		client.ClientSecret.AsMutPtr(),
-		pq.Array(client.RedirectUris)).Scan(&resultingId)
+		pq.Array(client.RedirectUris),
+		pq.Array(client.GrantTypes),
+		client.TokenEndpointAuthMethod,
+		client.Jwks.ToNillablePtr(),
+		client.HashedRegistrationAccessToken.ToNillablePtr(),
+		pq.Array(client.ResponseTypes),
+		pq.Array(client.DefaultScopes),
+		pq.Array(client.OptionalScopes),
+		client.PkceRequired,
+		client.ConsentRequired,
+		client.AccessTokenLifetimeSeconds.ToNillablePtr(),
+		client.IdTokenLifetimeSeconds.ToNillablePtr(),
+		client.RefreshTokenLifetimeSeconds.ToNillablePtr(),
+		client.FrontChannelLogoutUri.ToNillablePtr(),
+		client.BackChannelLogoutUri.ToNillablePtr(),
+		pq.Array(client.WebOrigins),
+		client.Protocol,
+		client.SamlNameIdFormat.ToNillablePtr(),
+		client.SamlSignatureAlgorithm.ToNillablePtr(),
+		client.SamlRequireSignedRequests,
+		client.SamlSigningCertificate.ToNillablePtr()).Scan(&resultingId)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code.Name() {
@@ -180,11 +300,91 @@ func (c *clientRepositoryImpl) UpdateClient(ctx context.Context, id uuid.UUID, u
 	})
 
 	upd.RedirectUris.IfSome(func(x []string) {
-		sb.Set(sb.Assign("redirect_uris", x))
+		sb.Set(sb.Assign("redirect_uris", pq.Array(x)))
+	})
+
+	upd.ClientSecret.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("hashed_client_secret", x.ToNillablePtr()))
+	})
+
+	upd.GrantTypes.IfSome(func(x []string) {
+		sb.Set(sb.Assign("grant_types", pq.Array(x)))
+	})
+
+	upd.TokenEndpointAuthMethod.IfSome(func(x string) {
+		sb.Set(sb.Assign("token_endpoint_auth_method", x))
+	})
+
+	upd.Jwks.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("jwks", x.ToNillablePtr()))
+	})
+
+	upd.HashedRegistrationAccessToken.IfSome(func(x string) {
+		sb.Set(sb.Assign("hashed_registration_access_token", x))
+	})
+
+	upd.ResponseTypes.IfSome(func(x []string) {
+		sb.Set(sb.Assign("response_types", pq.Array(x)))
+	})
+
+	upd.DefaultScopes.IfSome(func(x []string) {
+		sb.Set(sb.Assign("default_scopes", pq.Array(x)))
+	})
+
+	upd.OptionalScopes.IfSome(func(x []string) {
+		sb.Set(sb.Assign("optional_scopes", pq.Array(x)))
+	})
+
+	upd.PkceRequired.IfSome(func(x bool) {
+		sb.Set(sb.Assign("pkce_required", x))
 	})
 
-	upd.ClientSecret.IfSome(func(x string) {
-		sb.Set(sb.Assign("hashed_client_secret", x))
+	upd.ConsentRequired.IfSome(func(x bool) {
+		sb.Set(sb.Assign("consent_required", x))
+	})
+
+	upd.AccessTokenLifetimeSeconds.IfSome(func(x h.Opt[int]) {
+		sb.Set(sb.Assign("access_token_lifetime_seconds", x.ToNillablePtr()))
+	})
+
+	upd.IdTokenLifetimeSeconds.IfSome(func(x h.Opt[int]) {
+		sb.Set(sb.Assign("id_token_lifetime_seconds", x.ToNillablePtr()))
+	})
+
+	upd.RefreshTokenLifetimeSeconds.IfSome(func(x h.Opt[int]) {
+		sb.Set(sb.Assign("refresh_token_lifetime_seconds", x.ToNillablePtr()))
+	})
+
+	upd.FrontChannelLogoutUri.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("front_channel_logout_uri", x.ToNillablePtr()))
+	})
+
+	upd.BackChannelLogoutUri.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("back_channel_logout_uri", x.ToNillablePtr()))
+	})
+
+	upd.WebOrigins.IfSome(func(x []string) {
+		sb.Set(sb.Assign("web_origins", pq.Array(x)))
+	})
+
+	upd.SamlNameIdFormat.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("saml_name_id_format", x.ToNillablePtr()))
+	})
+
+	upd.SamlSignatureAlgorithm.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("saml_signature_algorithm", x.ToNillablePtr()))
+	})
+
+	upd.SamlRequireSignedRequests.IfSome(func(x bool) {
+		sb.Set(sb.Assign("saml_require_signed_requests", x))
+	})
+
+	upd.SamlSigningCertificate.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("saml_signing_certificate", x.ToNillablePtr()))
+	})
+
+	upd.AuthenticationFlowId.IfSome(func(x h.Opt[uuid.UUID]) {
+		sb.Set(sb.Assign("authentication_flow_id", x.ToNillablePtr()))
 	})
 
 	sb.Where(sb.Equal("id", id))
@@ -207,3 +407,23 @@ func (c *clientRepositoryImpl) UpdateClient(ctx context.Context, id uuid.UUID, u
 
 	return h.UOk()
 }
+
+func (c *clientRepositoryImpl) DeleteClient(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("clients").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -0,0 +1,126 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+// ClientRole is a role granted to a client itself, it applies to tokens the client gets with the client credentials grant.
+type ClientRole struct {
+	BaseModel
+
+	ClientId uuid.UUID
+	RoleId   uuid.UUID
+}
+
+type ClientRoleFilter struct {
+	ClientId h.Opt[uuid.UUID]
+	RoleId   h.Opt[uuid.UUID]
+}
+
+type ClientRoleRepository interface {
+	CreateClientRoles(ctx context.Context, clientRoles []ClientRole)
+	DeleteClientRole(ctx context.Context, id uuid.UUID)
+	FindClientRoles(ctx context.Context, filter ClientRoleFilter) []ClientRole
+}
+
+func NewClientRoleRepository() ClientRoleRepository {
+	return &clientRoleRepositoryImpl{}
+}
+
+type clientRoleRepositoryImpl struct{}
+
+func (c *clientRoleRepositoryImpl) CreateClientRoles(ctx context.Context, clientRoles []ClientRole) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("client_roles", "client_id", "role_id")
+
+	for _, clientRole := range clientRoles {
+		q.Values(clientRole.ClientId, clientRole.RoleId)
+	}
+
+	q.OnConflict().DoNothing()
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (c *clientRoleRepositoryImpl) DeleteClientRole(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("client_roles").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (c *clientRoleRepositoryImpl) FindClientRoles(ctx context.Context, filter ClientRoleFilter) []ClientRole {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select("id", "client_id", "role_id").
+		From("client_roles")
+
+	filter.ClientId.IfSome(func(x uuid.UUID) {
+		q.Where("client_id = ?", x)
+	})
+
+	filter.RoleId.IfSome(func(x uuid.UUID) {
+		q.Where("role_id = ?", x)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var result []ClientRole
+	for rows.Next() {
+		var row ClientRole
+		err := rows.Scan(&row.Id,
+			&row.ClientId,
+			&row.RoleId)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return result
+}
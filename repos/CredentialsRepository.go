@@ -69,16 +69,70 @@ func (d *CredentialTotpDetails) Scan(value interface{}) error {
 	return json.Unmarshal(b, &d)
 }
 
+// CredentialWebauthnDetails is a public key credential of a security key or passkey.
+// The credential id is stored base64url encoded, it is unique across all users.
+type CredentialWebauthnDetails struct {
+	DisplayName     string   `json:"displayName"`
+	CredentialId    string   `json:"credentialId"`
+	PublicKey       []byte   `json:"publicKey"`
+	AttestationType string   `json:"attestationType"`
+	Transports      []string `json:"transports"`
+	Aaguid          []byte   `json:"aaguid"`
+	SignCount       uint32   `json:"signCount"`
+	UserVerified    bool     `json:"userVerified"`
+	BackupEligible  bool     `json:"backupEligible"`
+	BackupState     bool     `json:"backupState"`
+}
+
+func (d CredentialWebauthnDetails) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+func (d *CredentialWebauthnDetails) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &d)
+}
+
+// CredentialRecoveryCodesDetails contains the hashes of the unused recovery codes of a user.
+type CredentialRecoveryCodesDetails struct {
+	HashedCodes []string `json:"hashedCodes"`
+}
+
+func (d CredentialRecoveryCodesDetails) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+func (d *CredentialRecoveryCodesDetails) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &d)
+}
+
+type CredentialUpdate struct {
+	Details h.Opt[interface{}]
+}
+
 type CredentialFilter struct {
 	BaseFilter
 	UserId h.Opt[uuid.UUID]
 	Type   h.Opt[string]
+
+	// LockForUpdate locks the found credentials until the end of the request transaction, the total count is not calculated.
+	LockForUpdate bool
 }
 
 type CredentialRepository interface {
 	CreateCredential(ctx context.Context, credential Credential) h.Result[uuid.UUID]
 	FindCredentialById(ctx context.Context, id uuid.UUID) h.Opt[Credential]
 	FindCredentials(ctx context.Context, filter CredentialFilter) FilterResult[Credential]
+	UpdateCredential(ctx context.Context, id uuid.UUID, upd CredentialUpdate)
 	DeleteCredential(ctx context.Context, id uuid.UUID)
 }
 
@@ -142,7 +196,12 @@ func (c *credentialRepositoryImpl) FindCredentials(ctx context.Context, filter C
 		panic(err)
 	}
 
-	q := sqlb.Select(filter.CountCol(), "id", "user_id", "type", "details").
+	selectCount := filter.CountCol()
+	if filter.LockForUpdate {
+		selectCount = "-1"
+	}
+
+	q := sqlb.Select(selectCount, "id", "audit_created_at", "audit_updated_at", "user_id", "type", "details").
 		From("credentials")
 
 	filter.Id.IfSome(func(x uuid.UUID) {
@@ -165,6 +224,10 @@ func (c *credentialRepositoryImpl) FindCredentials(ctx context.Context, filter C
 		x.Apply(q)
 	})
 
+	if filter.LockForUpdate {
+		q.LockForUpdate(false)
+	}
+
 	query := q.Build()
 	logging.Logger.Debugf("executing sql: %s", query.Sql)
 	rows, err := tx.Query(query.Sql, query.Parameters...)
@@ -180,6 +243,8 @@ func (c *credentialRepositoryImpl) FindCredentials(ctx context.Context, filter C
 		var detailsRaw json.RawMessage
 		err := rows.Scan(&totalCount,
 			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
 			&row.UserId,
 			&row.Type,
 			&detailsRaw)
@@ -192,6 +257,10 @@ func (c *credentialRepositoryImpl) FindCredentials(ctx context.Context, filter C
 			row.Details = utils.FromRawMessage[CredentialPasswordDetails](detailsRaw).Unwrap()
 		case constants.CredentialTypeTotp:
 			row.Details = utils.FromRawMessage[CredentialTotpDetails](detailsRaw).Unwrap()
+		case constants.CredentialTypeWebauthn:
+			row.Details = utils.FromRawMessage[CredentialWebauthnDetails](detailsRaw).Unwrap()
+		case constants.CredentialTypeRecoveryCodes:
+			row.Details = utils.FromRawMessage[CredentialRecoveryCodesDetails](detailsRaw).Unwrap()
 		default:
 			logging.Logger.Fatalf("Unsupported hash algorithm '%v' in password credential '%v'", row.Type, row.Id.String())
 		}
@@ -202,6 +271,31 @@ func (c *credentialRepositoryImpl) FindCredentials(ctx context.Context, filter C
 	return NewPagedResult(result, totalCount)
 }
 
+func (c *credentialRepositoryImpl) UpdateCredential(ctx context.Context, id uuid.UUID, upd CredentialUpdate) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	sb := sqlbuilder.Update("credentials")
+
+	upd.Details.IfSome(func(x interface{}) {
+		sb.Set(sb.Assign("details", x))
+	})
+
+	sb.Where(sb.Equal("id", id))
+
+	sqlString, args := sb.Build()
+	logging.Logger.Debugf("executing sql: %s", sqlString)
+	_, err = tx.Exec(sqlString, args...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
 func (c *credentialRepositoryImpl) DeleteCredential(ctx context.Context, id uuid.UUID) {
 	scope := middlewares.GetScope(ctx)
 	rcs := ioc.Get[requestContext.RequestContextService](scope)
@@ -0,0 +1,154 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+// FederatedIdentity links a user to the subject of an upstream identity provider.
+type FederatedIdentity struct {
+	BaseModel
+
+	UserId             uuid.UUID
+	IdentityProviderId uuid.UUID
+	Subject            string
+}
+
+type FederatedIdentityFilter struct {
+	BaseFilter
+
+	UserId             h.Opt[uuid.UUID]
+	IdentityProviderId h.Opt[uuid.UUID]
+	Subject            h.Opt[string]
+}
+
+type FederatedIdentityRepository interface {
+	FindFederatedIdentities(ctx context.Context, filter FederatedIdentityFilter) FilterResult[FederatedIdentity]
+	CreateFederatedIdentity(ctx context.Context, federatedIdentity FederatedIdentity) uuid.UUID
+	DeleteFederatedIdentity(ctx context.Context, id uuid.UUID)
+}
+
+type federatedIdentityRepositoryImpl struct{}
+
+func NewFederatedIdentityRepository() FederatedIdentityRepository {
+	return &federatedIdentityRepositoryImpl{}
+}
+
+func (f *federatedIdentityRepositoryImpl) FindFederatedIdentities(ctx context.Context, filter FederatedIdentityFilter) FilterResult[FederatedIdentity] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "user_id", "identity_provider_id", "subject").
+		From("federated_identities")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.UserId.IfSome(func(x uuid.UUID) {
+		q.Where("user_id = ?", x)
+	})
+
+	filter.IdentityProviderId.IfSome(func(x uuid.UUID) {
+		q.Where("identity_provider_id = ?", x)
+	})
+
+	filter.Subject.IfSome(func(x string) {
+		q.Where("subject = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	filter.SortInfo.IfSome(func(x SortInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []FederatedIdentity
+	for rows.Next() {
+		var row FederatedIdentity
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.UserId,
+			&row.IdentityProviderId,
+			&row.Subject)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (f *federatedIdentityRepositoryImpl) CreateFederatedIdentity(ctx context.Context, federatedIdentity FederatedIdentity) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("federated_identities", "user_id", "identity_provider_id", "subject").
+		Values(federatedIdentity.UserId,
+			federatedIdentity.IdentityProviderId,
+			federatedIdentity.Subject).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return resultingId
+}
+
+func (f *federatedIdentityRepositoryImpl) DeleteFederatedIdentity(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("federated_identities").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
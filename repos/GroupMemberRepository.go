@@ -0,0 +1,125 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+type GroupMember struct {
+	BaseModel
+
+	GroupId uuid.UUID
+	UserId  uuid.UUID
+}
+
+type GroupMemberFilter struct {
+	GroupId h.Opt[uuid.UUID]
+	UserId  h.Opt[uuid.UUID]
+}
+
+type GroupMemberRepository interface {
+	CreateGroupMembers(ctx context.Context, groupMembers []GroupMember)
+	DeleteGroupMember(ctx context.Context, id uuid.UUID)
+	FindGroupMembers(ctx context.Context, filter GroupMemberFilter) []GroupMember
+}
+
+func NewGroupMemberRepository() GroupMemberRepository {
+	return &groupMemberRepositoryImpl{}
+}
+
+type groupMemberRepositoryImpl struct{}
+
+func (g *groupMemberRepositoryImpl) CreateGroupMembers(ctx context.Context, groupMembers []GroupMember) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("group_members", "group_id", "user_id")
+
+	for _, groupMember := range groupMembers {
+		q.Values(groupMember.GroupId, groupMember.UserId)
+	}
+
+	q.OnConflict().DoNothing()
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (g *groupMemberRepositoryImpl) DeleteGroupMember(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("group_members").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (g *groupMemberRepositoryImpl) FindGroupMembers(ctx context.Context, filter GroupMemberFilter) []GroupMember {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select("id", "user_id", "group_id").
+		From("group_members")
+
+	filter.UserId.IfSome(func(x uuid.UUID) {
+		q.Where("user_id = ?", x)
+	})
+
+	filter.GroupId.IfSome(func(x uuid.UUID) {
+		q.Where("group_id = ?", x)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var result []GroupMember
+	for rows.Next() {
+		var row GroupMember
+		err := rows.Scan(&row.Id,
+			&row.UserId,
+			&row.GroupId)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return result
+}
@@ -0,0 +1,296 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+type Group struct {
+	BaseModel
+
+	RealmId  uuid.UUID
+	ParentId h.Opt[uuid.UUID]
+
+	Name        string
+	DisplayName string
+	Description string
+
+	// Path is the names of the group and its ancestors separated by slashes, e.g. /engineering/backend.
+	Path string
+	// RolesCache holds the roles of the group, its ancestors and the roles they imply.
+	RolesCache []uuid.UUID
+}
+
+type GroupUpdate struct {
+	ParentId    h.Opt[h.Opt[uuid.UUID]]
+	Name        h.Opt[string]
+	DisplayName h.Opt[string]
+	Description h.Opt[string]
+
+	RolesCache h.Opt[[]uuid.UUID]
+}
+
+type GroupFilter struct {
+	BaseFilter
+
+	RealmId  h.Opt[uuid.UUID]
+	GroupIds h.Opt[[]uuid.UUID]
+	ParentId h.Opt[uuid.UUID]
+	Path     h.Opt[string]
+	// MemberId only returns the groups the user is a direct member of.
+	MemberId h.Opt[uuid.UUID]
+}
+
+type DuplicateGroupError struct{}
+
+func (e DuplicateGroupError) Error() string {
+	return "Duplicate group"
+}
+
+type GroupRepository interface {
+	FindGroupById(ctx context.Context, id uuid.UUID) h.Opt[Group]
+	FindGroups(ctx context.Context, filter GroupFilter) FilterResult[Group]
+	CreateGroup(ctx context.Context, group Group) h.Result[uuid.UUID]
+	UpdateGroup(ctx context.Context, id uuid.UUID, upd GroupUpdate) h.UResult
+	// MoveGroupPaths replaces the path prefix of a group and all of its descendants.
+	MoveGroupPaths(ctx context.Context, realmId uuid.UUID, oldPath string, newPath string) h.UResult
+	DeleteGroup(ctx context.Context, id uuid.UUID)
+}
+
+func NewGroupRepository() GroupRepository {
+	return &groupRepositoryImpl{}
+}
+
+type groupRepositoryImpl struct{}
+
+func (g *groupRepositoryImpl) FindGroupById(ctx context.Context, id uuid.UUID) h.Opt[Group] {
+	return g.FindGroups(ctx, GroupFilter{
+		BaseFilter: BaseFilter{
+			Id: h.Some(id),
+		},
+	}).SingleOrNone()
+}
+
+func (g *groupRepositoryImpl) FindGroups(ctx context.Context, filter GroupFilter) FilterResult[Group] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"g.id", "g.audit_created_at", "g.audit_updated_at", "g.realm_id", "g.parent_id", "g.name", "g.display_name",
+		"g.description", "g.path", "g.roles_cache").
+		From("groups g")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("g.id = ?", x)
+	})
+
+	filter.RealmId.IfSome(func(x uuid.UUID) {
+		q.Where("g.realm_id = ?", x)
+	})
+
+	filter.GroupIds.IfSome(func(x []uuid.UUID) {
+		q.Where("g.id = any(?)", pq.Array(x))
+	})
+
+	filter.ParentId.IfSome(func(x uuid.UUID) {
+		q.Where("g.parent_id = ?", x)
+	})
+
+	filter.Path.IfSome(func(x string) {
+		q.Where("g.path = ?", x)
+	})
+
+	filter.MemberId.IfSome(func(x uuid.UUID) {
+		q.Where(sqlb.Exists(sqlb.Select("1").
+			From("group_members gm").
+			Where("gm.group_id = g.id").
+			Where("gm.user_id = ?", x)))
+	})
+
+	filter.SearchText.IfSome(func(x string) {
+		q.Where("(g.name ilike ? or g.display_name ilike ?)", "%"+x+"%", "%"+x+"%")
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	if sortInfo, ok := filter.SortInfo.Get(); ok {
+		sortInfo.Apply(q)
+	} else {
+		q.OrderBy("g.path")
+	}
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []Group
+	for rows.Next() {
+		var row Group
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.RealmId,
+			row.ParentId.AsMutPtr(),
+			&row.Name,
+			&row.DisplayName,
+			&row.Description,
+			&row.Path,
+			pq.Array(&row.RolesCache))
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (g *groupRepositoryImpl) CreateGroup(ctx context.Context, group Group) h.Result[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("groups", "realm_id", "parent_id", "name", "display_name", "description", "path", "roles_cache").
+		Values(group.RealmId,
+			group.ParentId.ToNillablePtr(),
+			group.Name,
+			group.DisplayName,
+			group.Description,
+			group.Path,
+			pq.Array(utils.NonNilSlice(group.RolesCache))).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		if isDuplicateGroupError(err) {
+			return h.Err[uuid.UUID](DuplicateGroupError{})
+		}
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.Ok(resultingId)
+}
+
+func (g *groupRepositoryImpl) UpdateGroup(ctx context.Context, id uuid.UUID, upd GroupUpdate) h.UResult {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Update("groups")
+
+	upd.ParentId.IfSome(func(x h.Opt[uuid.UUID]) {
+		q.Set("parent_id", x.ToNillablePtr())
+	})
+
+	upd.Name.IfSome(func(x string) {
+		q.Set("name", x)
+	})
+
+	upd.DisplayName.IfSome(func(x string) {
+		q.Set("display_name", x)
+	})
+
+	upd.Description.IfSome(func(x string) {
+		q.Set("description", x)
+	})
+
+	upd.RolesCache.IfSome(func(x []uuid.UUID) {
+		q.Set("roles_cache", pq.Array(utils.NonNilSlice(x)))
+	})
+
+	q.Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.UOk()
+}
+
+func (g *groupRepositoryImpl) MoveGroupPaths(ctx context.Context, realmId uuid.UUID, oldPath string, newPath string) h.UResult {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Update("groups").
+		Set("path", sqlb.Raw("? || substr(path, ?)", newPath, len(oldPath)+1)).
+		Where("realm_id = ?", realmId).
+		Where("(path = ? or starts_with(path, ?))", oldPath, oldPath+"/")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		if isDuplicateGroupError(err) {
+			return h.UErr(DuplicateGroupError{})
+		}
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.UOk()
+}
+
+func (g *groupRepositoryImpl) DeleteGroup(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("groups").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func isDuplicateGroupError(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation" && pqErr.Constraint == "idx_unique_group_path_per_realm"
+}
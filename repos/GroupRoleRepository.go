@@ -0,0 +1,133 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+type GroupRole struct {
+	BaseModel
+
+	GroupId uuid.UUID
+	RoleId  uuid.UUID
+}
+
+type GroupRoleFilter struct {
+	GroupId h.Opt[uuid.UUID]
+	RoleId  h.Opt[uuid.UUID]
+	RealmId h.Opt[uuid.UUID]
+}
+
+type GroupRoleRepository interface {
+	CreateGroupRoles(ctx context.Context, groupRoles []GroupRole)
+	DeleteGroupRole(ctx context.Context, id uuid.UUID)
+	FindGroupRoles(ctx context.Context, filter GroupRoleFilter) []GroupRole
+}
+
+func NewGroupRoleRepository() GroupRoleRepository {
+	return &groupRoleRepositoryImpl{}
+}
+
+type groupRoleRepositoryImpl struct{}
+
+func (g *groupRoleRepositoryImpl) CreateGroupRoles(ctx context.Context, groupRoles []GroupRole) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("group_roles", "group_id", "role_id")
+
+	for _, groupRole := range groupRoles {
+		q.Values(groupRole.GroupId, groupRole.RoleId)
+	}
+
+	q.OnConflict().DoNothing()
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (g *groupRoleRepositoryImpl) DeleteGroupRole(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("group_roles").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (g *groupRoleRepositoryImpl) FindGroupRoles(ctx context.Context, filter GroupRoleFilter) []GroupRole {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select("id", "group_id", "role_id").
+		From("group_roles")
+
+	filter.GroupId.IfSome(func(x uuid.UUID) {
+		q.Where("group_id = ?", x)
+	})
+
+	filter.RoleId.IfSome(func(x uuid.UUID) {
+		q.Where("role_id = ?", x)
+	})
+
+	filter.RealmId.IfSome(func(x uuid.UUID) {
+		q.Where(sqlb.Exists(sqlb.Select("1").
+			From("groups g").
+			Where("g.id = group_id").
+			Where("g.realm_id = ?", x)))
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var result []GroupRole
+	for rows.Next() {
+		var row GroupRole
+		err := rows.Scan(&row.Id,
+			&row.GroupId,
+			&row.RoleId)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return result
+}
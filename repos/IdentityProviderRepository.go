@@ -0,0 +1,292 @@
+package repos
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/lib/pq"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+// ClaimMappings maps attributes of a user to the names of the upstream claims they are taken from.
+type ClaimMappings map[string]string
+
+func (c ClaimMappings) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *ClaimMappings) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &c)
+}
+
+type IdentityProvider struct {
+	BaseModel
+
+	RealmId uuid.UUID
+
+	Alias                 string
+	DisplayName           string
+	Issuer                string
+	ClientId              string
+	EncryptedClientSecret []byte
+	Scopes                []string
+	ClaimMappings         ClaimMappings
+	TrustEmail            bool
+	Enabled               bool
+}
+
+type IdentityProviderFilter struct {
+	BaseFilter
+
+	RealmId h.Opt[uuid.UUID]
+	Alias   h.Opt[string]
+	Enabled h.Opt[bool]
+}
+
+type IdentityProviderUpdate struct {
+	DisplayName           h.Opt[string]
+	Issuer                h.Opt[string]
+	ClientId              h.Opt[string]
+	EncryptedClientSecret h.Opt[[]byte]
+	Scopes                h.Opt[[]string]
+	ClaimMappings         h.Opt[ClaimMappings]
+	TrustEmail            h.Opt[bool]
+	Enabled               h.Opt[bool]
+}
+
+type DuplicateIdentityProviderAliasError struct{}
+
+func (e DuplicateIdentityProviderAliasError) Error() string {
+	return "Duplicate identity provider alias"
+}
+
+type IdentityProviderRepository interface {
+	FindIdentityProviderById(ctx context.Context, id uuid.UUID) h.Opt[IdentityProvider]
+	FindIdentityProviders(ctx context.Context, filter IdentityProviderFilter) FilterResult[IdentityProvider]
+	CreateIdentityProvider(ctx context.Context, identityProvider IdentityProvider) h.Result[uuid.UUID]
+	UpdateIdentityProvider(ctx context.Context, id uuid.UUID, upd IdentityProviderUpdate) h.UResult
+	DeleteIdentityProvider(ctx context.Context, id uuid.UUID)
+}
+
+type identityProviderRepositoryImpl struct{}
+
+func NewIdentityProviderRepository() IdentityProviderRepository {
+	return &identityProviderRepositoryImpl{}
+}
+
+func (i *identityProviderRepositoryImpl) FindIdentityProviderById(ctx context.Context, id uuid.UUID) h.Opt[IdentityProvider] {
+	return i.FindIdentityProviders(ctx, IdentityProviderFilter{
+		BaseFilter: BaseFilter{
+			Id: h.Some(id),
+		},
+	}).SingleOrNone()
+}
+
+func (i *identityProviderRepositoryImpl) FindIdentityProviders(ctx context.Context, filter IdentityProviderFilter) FilterResult[IdentityProvider] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "alias", "display_name", "issuer", "client_id",
+		"encrypted_client_secret", "scopes", "claim_mappings", "trust_email", "enabled").
+		From("identity_providers")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.RealmId.IfSome(func(x uuid.UUID) {
+		q.Where("realm_id = ?", x)
+	})
+
+	filter.Alias.IfSome(func(x string) {
+		q.Where("alias = ?", x)
+	})
+
+	filter.Enabled.IfSome(func(x bool) {
+		q.Where("enabled = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	filter.SortInfo.IfSome(func(x SortInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []IdentityProvider
+	for rows.Next() {
+		var row IdentityProvider
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.RealmId,
+			&row.Alias,
+			&row.DisplayName,
+			&row.Issuer,
+			&row.ClientId,
+			&row.EncryptedClientSecret,
+			pq.Array(&row.Scopes),
+			&row.ClaimMappings,
+			&row.TrustEmail,
+			&row.Enabled)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (i *identityProviderRepositoryImpl) CreateIdentityProvider(ctx context.Context, identityProvider IdentityProvider) h.Result[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("identity_providers", "realm_id", "alias", "display_name", "issuer", "client_id",
+		"encrypted_client_secret", "scopes", "claim_mappings", "trust_email", "enabled").
+		Values(identityProvider.RealmId,
+			identityProvider.Alias,
+			identityProvider.DisplayName,
+			identityProvider.Issuer,
+			identityProvider.ClientId,
+			identityProvider.EncryptedClientSecret,
+			pq.Array(identityProvider.Scopes),
+			identityProvider.ClaimMappings,
+			identityProvider.TrustEmail,
+			identityProvider.Enabled).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				if pqErr.Constraint == "idx_unique_identity_provider_alias_per_realm" {
+					return h.Err[uuid.UUID](DuplicateIdentityProviderAliasError{})
+				}
+			}
+		}
+
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.Ok(resultingId)
+}
+
+func (i *identityProviderRepositoryImpl) UpdateIdentityProvider(ctx context.Context, id uuid.UUID, upd IdentityProviderUpdate) h.UResult {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	sb := sqlbuilder.Update("identity_providers")
+
+	upd.DisplayName.IfSome(func(x string) {
+		sb.Set(sb.Assign("display_name", x))
+	})
+
+	upd.Issuer.IfSome(func(x string) {
+		sb.Set(sb.Assign("issuer", x))
+	})
+
+	upd.ClientId.IfSome(func(x string) {
+		sb.Set(sb.Assign("client_id", x))
+	})
+
+	upd.EncryptedClientSecret.IfSome(func(x []byte) {
+		sb.Set(sb.Assign("encrypted_client_secret", x))
+	})
+
+	upd.Scopes.IfSome(func(x []string) {
+		sb.Set(sb.Assign("scopes", pq.Array(x)))
+	})
+
+	upd.ClaimMappings.IfSome(func(x ClaimMappings) {
+		sb.Set(sb.Assign("claim_mappings", x))
+	})
+
+	upd.TrustEmail.IfSome(func(x bool) {
+		sb.Set(sb.Assign("trust_email", x))
+	})
+
+	upd.Enabled.IfSome(func(x bool) {
+		sb.Set(sb.Assign("enabled", x))
+	})
+
+	sb.Where(sb.Equal("id", id))
+
+	sqlString, args := sb.Build()
+	logging.Logger.Debugf("executing sql: %s", sqlString)
+	_, err = tx.Exec(sqlString, args...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.UOk()
+}
+
+func (i *identityProviderRepositoryImpl) DeleteIdentityProvider(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("identity_providers").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -0,0 +1,210 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+	"time"
+)
+
+type InitialAccessToken struct {
+	BaseModel
+
+	RealmId uuid.UUID
+
+	HashedToken string
+	Description string
+	ExpiresAt   h.Opt[time.Time]
+	// MaxUses is the number of clients the token can register, it can be used until it expires if it is not set.
+	MaxUses  h.Opt[int]
+	UseCount int
+}
+
+type InitialAccessTokenFilter struct {
+	BaseFilter
+
+	RealmId     h.Opt[uuid.UUID]
+	HashedToken h.Opt[string]
+}
+
+type InitialAccessTokenRepository interface {
+	FindInitialAccessTokenById(ctx context.Context, id uuid.UUID) h.Opt[InitialAccessToken]
+	FindInitialAccessTokens(ctx context.Context, filter InitialAccessTokenFilter) FilterResult[InitialAccessToken]
+	CreateInitialAccessToken(ctx context.Context, token InitialAccessToken) uuid.UUID
+	// UseInitialAccessToken counts a use of the token if it is neither expired nor used up, in a single statement
+	// so concurrent registrations can not exceed its uses. It returns the id of the token, none if it can not be used.
+	UseInitialAccessToken(ctx context.Context, realmId uuid.UUID, hashedToken string, now time.Time) h.Opt[uuid.UUID]
+	DeleteInitialAccessToken(ctx context.Context, id uuid.UUID)
+}
+
+type initialAccessTokenRepositoryImpl struct{}
+
+func NewInitialAccessTokenRepository() InitialAccessTokenRepository {
+	return &initialAccessTokenRepositoryImpl{}
+}
+
+func (i *initialAccessTokenRepositoryImpl) FindInitialAccessTokenById(ctx context.Context, id uuid.UUID) h.Opt[InitialAccessToken] {
+	return i.FindInitialAccessTokens(ctx, InitialAccessTokenFilter{
+		BaseFilter: BaseFilter{
+			Id: h.Some(id),
+		},
+	}).SingleOrNone()
+}
+
+func (i *initialAccessTokenRepositoryImpl) FindInitialAccessTokens(ctx context.Context, filter InitialAccessTokenFilter) FilterResult[InitialAccessToken] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "hashed_token", "description", "expires_at",
+		"max_uses", "use_count").
+		From("initial_access_tokens")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.RealmId.IfSome(func(x uuid.UUID) {
+		q.Where("realm_id = ?", x)
+	})
+
+	filter.HashedToken.IfSome(func(x string) {
+		q.Where("hashed_token = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	filter.SortInfo.IfSome(func(x SortInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []InitialAccessToken
+	for rows.Next() {
+		var row InitialAccessToken
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.RealmId,
+			&row.HashedToken,
+			&row.Description,
+			row.ExpiresAt.AsMutPtr(),
+			row.MaxUses.AsMutPtr(),
+			&row.UseCount)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (i *initialAccessTokenRepositoryImpl) CreateInitialAccessToken(ctx context.Context, token InitialAccessToken) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("initial_access_tokens", "realm_id", "hashed_token", "description", "expires_at", "max_uses").
+		Values(token.RealmId,
+			token.HashedToken,
+			token.Description,
+			token.ExpiresAt.ToNillablePtr(),
+			token.MaxUses.ToNillablePtr()).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return resultingId
+}
+
+func (i *initialAccessTokenRepositoryImpl) UseInitialAccessToken(ctx context.Context, realmId uuid.UUID, hashedToken string, now time.Time) h.Opt[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Update("initial_access_tokens").
+		Set("use_count", sqlb.Raw("use_count + 1")).
+		Where("realm_id = ?", realmId).
+		Where("hashed_token = ?", hashedToken).
+		Where("(expires_at is null or expires_at > ?)", now).
+		Where("(max_uses is null or use_count < max_uses)").
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	if !rows.Next() {
+		return h.None[uuid.UUID]()
+	}
+
+	var id uuid.UUID
+	err = rows.Scan(&id)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.Some(id)
+}
+
+func (i *initialAccessTokenRepositoryImpl) DeleteInitialAccessToken(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("initial_access_tokens").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -0,0 +1,318 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/huandu/go-sqlbuilder"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+	"time"
+)
+
+type LdapProvider struct {
+	BaseModel
+
+	RealmId uuid.UUID
+
+	DisplayName           string
+	Url                   string
+	StartTls              bool
+	BindDn                h.Opt[string]
+	EncryptedBindPassword h.Opt[[]byte]
+
+	UserBaseDn        string
+	UserFilter        string
+	UserDnTemplate    string
+	UsernameAttribute string
+	EmailAttribute    string
+
+	GroupBaseDn          h.Opt[string]
+	GroupFilter          string
+	GroupNameAttribute   string
+	GroupMemberAttribute string
+
+	Enabled      bool
+	LastSyncedAt h.Opt[time.Time]
+}
+
+type LdapProviderFilter struct {
+	BaseFilter
+
+	RealmId h.Opt[uuid.UUID]
+	Enabled h.Opt[bool]
+}
+
+type LdapProviderUpdate struct {
+	DisplayName           h.Opt[string]
+	Url                   h.Opt[string]
+	StartTls              h.Opt[bool]
+	BindDn                h.Opt[h.Opt[string]]
+	EncryptedBindPassword h.Opt[h.Opt[[]byte]]
+
+	UserBaseDn        h.Opt[string]
+	UserFilter        h.Opt[string]
+	UserDnTemplate    h.Opt[string]
+	UsernameAttribute h.Opt[string]
+	EmailAttribute    h.Opt[string]
+
+	GroupBaseDn          h.Opt[h.Opt[string]]
+	GroupFilter          h.Opt[string]
+	GroupNameAttribute   h.Opt[string]
+	GroupMemberAttribute h.Opt[string]
+
+	Enabled      h.Opt[bool]
+	LastSyncedAt h.Opt[time.Time]
+}
+
+type LdapProviderRepository interface {
+	FindLdapProviderById(ctx context.Context, id uuid.UUID) h.Opt[LdapProvider]
+	FindLdapProviders(ctx context.Context, filter LdapProviderFilter) FilterResult[LdapProvider]
+	CreateLdapProvider(ctx context.Context, ldapProvider LdapProvider) uuid.UUID
+	UpdateLdapProvider(ctx context.Context, id uuid.UUID, upd LdapProviderUpdate)
+	DeleteLdapProvider(ctx context.Context, id uuid.UUID)
+}
+
+type ldapProviderRepositoryImpl struct{}
+
+func NewLdapProviderRepository() LdapProviderRepository {
+	return &ldapProviderRepositoryImpl{}
+}
+
+func (l *ldapProviderRepositoryImpl) FindLdapProviderById(ctx context.Context, id uuid.UUID) h.Opt[LdapProvider] {
+	return l.FindLdapProviders(ctx, LdapProviderFilter{
+		BaseFilter: BaseFilter{
+			Id: h.Some(id),
+		},
+	}).SingleOrNone()
+}
+
+func (l *ldapProviderRepositoryImpl) FindLdapProviders(ctx context.Context, filter LdapProviderFilter) FilterResult[LdapProvider] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "display_name", "url", "start_tls", "bind_dn",
+		"encrypted_bind_password", "user_base_dn", "user_filter", "user_dn_template", "username_attribute",
+		"email_attribute", "group_base_dn", "group_filter", "group_name_attribute", "group_member_attribute",
+		"enabled", "last_synced_at").
+		From("ldap_providers")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.RealmId.IfSome(func(x uuid.UUID) {
+		q.Where("realm_id = ?", x)
+	})
+
+	filter.Enabled.IfSome(func(x bool) {
+		q.Where("enabled = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	filter.SortInfo.IfSome(func(x SortInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []LdapProvider
+	for rows.Next() {
+		var row LdapProvider
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.RealmId,
+			&row.DisplayName,
+			&row.Url,
+			&row.StartTls,
+			row.BindDn.AsMutPtr(),
+			row.EncryptedBindPassword.AsMutPtr(),
+			&row.UserBaseDn,
+			&row.UserFilter,
+			&row.UserDnTemplate,
+			&row.UsernameAttribute,
+			&row.EmailAttribute,
+			row.GroupBaseDn.AsMutPtr(),
+			&row.GroupFilter,
+			&row.GroupNameAttribute,
+			&row.GroupMemberAttribute,
+			&row.Enabled,
+			row.LastSyncedAt.AsMutPtr())
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (l *ldapProviderRepositoryImpl) CreateLdapProvider(ctx context.Context, ldapProvider LdapProvider) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("ldap_providers", "realm_id", "display_name", "url", "start_tls", "bind_dn",
+		"encrypted_bind_password", "user_base_dn", "user_filter", "user_dn_template", "username_attribute",
+		"email_attribute", "group_base_dn", "group_filter", "group_name_attribute", "group_member_attribute",
+		"enabled").
+		Values(ldapProvider.RealmId,
+			ldapProvider.DisplayName,
+			ldapProvider.Url,
+			ldapProvider.StartTls,
+			ldapProvider.BindDn.ToNillablePtr(),
+			ldapProvider.EncryptedBindPassword.ToNillablePtr(),
+			ldapProvider.UserBaseDn,
+			ldapProvider.UserFilter,
+			ldapProvider.UserDnTemplate,
+			ldapProvider.UsernameAttribute,
+			ldapProvider.EmailAttribute,
+			ldapProvider.GroupBaseDn.ToNillablePtr(),
+			ldapProvider.GroupFilter,
+			ldapProvider.GroupNameAttribute,
+			ldapProvider.GroupMemberAttribute,
+			ldapProvider.Enabled).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return resultingId
+}
+
+func (l *ldapProviderRepositoryImpl) UpdateLdapProvider(ctx context.Context, id uuid.UUID, upd LdapProviderUpdate) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	sb := sqlbuilder.Update("ldap_providers")
+
+	upd.DisplayName.IfSome(func(x string) {
+		sb.Set(sb.Assign("display_name", x))
+	})
+
+	upd.Url.IfSome(func(x string) {
+		sb.Set(sb.Assign("url", x))
+	})
+
+	upd.StartTls.IfSome(func(x bool) {
+		sb.Set(sb.Assign("start_tls", x))
+	})
+
+	upd.BindDn.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("bind_dn", x.ToNillablePtr()))
+	})
+
+	upd.EncryptedBindPassword.IfSome(func(x h.Opt[[]byte]) {
+		sb.Set(sb.Assign("encrypted_bind_password", x.ToNillablePtr()))
+	})
+
+	upd.UserBaseDn.IfSome(func(x string) {
+		sb.Set(sb.Assign("user_base_dn", x))
+	})
+
+	upd.UserFilter.IfSome(func(x string) {
+		sb.Set(sb.Assign("user_filter", x))
+	})
+
+	upd.UserDnTemplate.IfSome(func(x string) {
+		sb.Set(sb.Assign("user_dn_template", x))
+	})
+
+	upd.UsernameAttribute.IfSome(func(x string) {
+		sb.Set(sb.Assign("username_attribute", x))
+	})
+
+	upd.EmailAttribute.IfSome(func(x string) {
+		sb.Set(sb.Assign("email_attribute", x))
+	})
+
+	upd.GroupBaseDn.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("group_base_dn", x.ToNillablePtr()))
+	})
+
+	upd.GroupFilter.IfSome(func(x string) {
+		sb.Set(sb.Assign("group_filter", x))
+	})
+
+	upd.GroupNameAttribute.IfSome(func(x string) {
+		sb.Set(sb.Assign("group_name_attribute", x))
+	})
+
+	upd.GroupMemberAttribute.IfSome(func(x string) {
+		sb.Set(sb.Assign("group_member_attribute", x))
+	})
+
+	upd.Enabled.IfSome(func(x bool) {
+		sb.Set(sb.Assign("enabled", x))
+	})
+
+	upd.LastSyncedAt.IfSome(func(x time.Time) {
+		sb.Set(sb.Assign("last_synced_at", x))
+	})
+
+	sb.Where(sb.Equal("id", id))
+
+	sqlString, args := sb.Build()
+	logging.Logger.Debugf("executing sql: %s", sqlString)
+	_, err = tx.Exec(sqlString, args...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (l *ldapProviderRepositoryImpl) DeleteLdapProvider(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("ldap_providers").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -26,6 +26,7 @@ type PasswordHistoryFilter struct {
 }
 
 type PasswordHistoryRepository interface {
+	// GetHistory returns the entries of the user, the newest first.
 	GetHistory(ctx context.Context, filter PasswordHistoryFilter) []PasswordHistoryEntry
 	CreateEntry(ctx context.Context, entry PasswordHistoryEntry)
 	DeleteEntries(ctx context.Context, ids []uuid.UUID)
@@ -47,7 +48,7 @@ func (p *passwordHistoryRepositoryImpl) DeleteEntries(ctx context.Context, ids [
 	}
 
 	q := sqlb.DeleteFrom("password_history").
-		Where("user_id IN (?)", pq.Array(ids))
+		Where("id = any(?::uuid[])", pq.Array(ids))
 
 	query := q.Build()
 	logging.Logger.Debugf("executing sql: %s", query.Sql)
@@ -89,7 +90,8 @@ func (p *passwordHistoryRepositoryImpl) GetHistory(ctx context.Context, filter P
 	q := sqlb.Select("id", "user_id", "hashed_password", "created_at").
 		From("password_history")
 
-	q.Where("user_id = ?", filter.UserId)
+	q.Where("user_id = ?", filter.UserId).
+		OrderBy("created_at desc")
 
 	query := q.Build()
 	logging.Logger.Debugf("executing sql: %s", query.Sql)
@@ -0,0 +1,208 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+	"time"
+)
+
+type PasswordResetToken struct {
+	BaseModel
+
+	UserId uuid.UUID
+
+	HashedToken string
+	ValidUntil  time.Time
+}
+
+type PasswordResetTokenFilter struct {
+	BaseFilter
+
+	UserId      h.Opt[uuid.UUID]
+	HashedToken h.Opt[string]
+}
+
+type PasswordResetTokenRepository interface {
+	FindPasswordResetTokens(ctx context.Context, filter PasswordResetTokenFilter) FilterResult[PasswordResetToken]
+	CreatePasswordResetToken(ctx context.Context, token PasswordResetToken) uuid.UUID
+	DeletePasswordResetToken(ctx context.Context, id uuid.UUID)
+	// ConsumePasswordResetToken deletes the token if it is still valid, in a single statement so concurrent requests
+	// can not use it twice. It returns the user of the token, none if it can not be used.
+	ConsumePasswordResetToken(ctx context.Context, hashedToken string, now time.Time) h.Opt[uuid.UUID]
+	// DeletePasswordResetTokensOfUser invalidates all reset links that were sent to the user.
+	DeletePasswordResetTokensOfUser(ctx context.Context, userId uuid.UUID)
+	DeleteOldPasswordResetTokens(ctx context.Context)
+}
+
+type passwordResetTokenRepositoryImpl struct{}
+
+func NewPasswordResetTokenRepository() PasswordResetTokenRepository {
+	return &passwordResetTokenRepositoryImpl{}
+}
+
+func (p *passwordResetTokenRepositoryImpl) FindPasswordResetTokens(ctx context.Context, filter PasswordResetTokenFilter) FilterResult[PasswordResetToken] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "user_id", "hashed_token", "valid_until").
+		From("password_reset_tokens")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.UserId.IfSome(func(x uuid.UUID) {
+		q.Where("user_id = ?", x)
+	})
+
+	filter.HashedToken.IfSome(func(x string) {
+		q.Where("hashed_token = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	filter.SortInfo.IfSome(func(x SortInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []PasswordResetToken
+	for rows.Next() {
+		var row PasswordResetToken
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.UserId,
+			&row.HashedToken,
+			&row.ValidUntil)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (p *passwordResetTokenRepositoryImpl) CreatePasswordResetToken(ctx context.Context, token PasswordResetToken) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	var resultingId uuid.UUID
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.InsertInto("password_reset_tokens", "user_id", "hashed_token", "valid_until").
+		Values(token.UserId,
+			token.HashedToken,
+			token.ValidUntil).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return resultingId
+}
+
+func (p *passwordResetTokenRepositoryImpl) DeletePasswordResetToken(ctx context.Context, id uuid.UUID) {
+	p.delete(ctx, sqlb.DeleteFrom("password_reset_tokens").
+		Where("id = ?", id))
+}
+
+func (p *passwordResetTokenRepositoryImpl) ConsumePasswordResetToken(ctx context.Context, hashedToken string, now time.Time) h.Opt[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("password_reset_tokens").
+		Where("hashed_token = ?", hashedToken).
+		Where("valid_until > ?", now).
+		Returning("user_id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	if !rows.Next() {
+		return h.None[uuid.UUID]()
+	}
+
+	var userId uuid.UUID
+	err = rows.Scan(&userId)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.Some(userId)
+}
+
+func (p *passwordResetTokenRepositoryImpl) DeletePasswordResetTokensOfUser(ctx context.Context, userId uuid.UUID) {
+	p.delete(ctx, sqlb.DeleteFrom("password_reset_tokens").
+		Where("user_id = ?", userId))
+}
+
+func (p *passwordResetTokenRepositoryImpl) DeleteOldPasswordResetTokens(ctx context.Context) {
+	scope := middlewares.GetScope(ctx)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	p.delete(ctx, sqlb.DeleteFrom("password_reset_tokens").
+		Where("valid_until < ?", now))
+}
+
+func (p *passwordResetTokenRepositoryImpl) delete(ctx context.Context, q sqlb.DeleteQuery) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
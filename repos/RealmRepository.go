@@ -2,6 +2,9 @@ package repos
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/lib/pq"
@@ -9,11 +12,27 @@ import (
 	"holvit/ioc"
 	"holvit/logging"
 	"holvit/middlewares"
+	"holvit/passwordpolicy"
 	"holvit/requestContext"
 	"holvit/sqlb"
 	"holvit/utils"
 )
 
+type PasswordPolicy passwordpolicy.Policy
+
+func (p PasswordPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *PasswordPolicy) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &p)
+}
+
 type Realm struct {
 	BaseModel
 
@@ -21,13 +40,43 @@ type Realm struct {
 	DisplayName string
 
 	EncryptedPrivateKey []byte
+	// EncryptedRsaPrivateKey signs SAML responses, realms created before it existed get one on startup.
+	EncryptedRsaPrivateKey h.Opt[[]byte]
 
 	RequireUsername           bool
 	RequireEmail              bool
 	RequireDeviceVerification bool
 	RequireTotp               bool
+	RequireWebauthn           bool
 	EnableRememberMe          bool
-	PasswordHistoryLength     int
+	// RequireEmailVerification blocks the login of users with an unverified email until they verified it.
+	RequireEmailVerification bool
+	// PasswordHistoryLength is the number of most recent passwords, including the current one, a new password must not match.
+	PasswordHistoryLength int
+	PasswordPolicy        PasswordPolicy
+	// EmailLoginMode is one of the constants.EmailLoginMode values.
+	EmailLoginMode string
+
+	EnableRegistration           bool
+	RegistrationRequiresApproval bool
+	// DefaultRoleIds are assigned to users that register themselves.
+	DefaultRoleIds []uuid.UUID
+
+	ConsentExpirySeconds h.Opt[int]
+
+	// AuthenticationFlowId is the flow of logins in this realm, the built-in flow is used if it is not set.
+	AuthenticationFlowId h.Opt[uuid.UUID]
+
+	BruteForceProtection bool
+	// BruteForceMaxFailures is the number of failed attempts after which a user is locked out temporarily.
+	BruteForceMaxFailures int
+	// BruteForceIpMaxFailures is the number of failed attempts after which an ip address is locked out temporarily.
+	BruteForceIpMaxFailures  int
+	BruteForceLockoutSeconds int
+	// BruteForceMaxDelaySeconds caps the delay between attempts, which doubles with every failed attempt.
+	BruteForceMaxDelaySeconds int
+	// BruteForcePermanentLockoutAfter is the number of temporary lockouts after which only an admin can unlock the user.
+	BruteForcePermanentLockoutAfter h.Opt[int]
 }
 
 type RealmFilter struct {
@@ -40,11 +89,33 @@ type RealmUpdate struct {
 	DisplayName h.Opt[string]
 	Name        h.Opt[string]
 
+	EncryptedRsaPrivateKey h.Opt[[]byte]
+
 	RequireUsername           h.Opt[bool]
 	RequireEmail              h.Opt[bool]
 	RequireDeviceVerification h.Opt[bool]
 	RequireTotp               h.Opt[bool]
+	RequireWebauthn           h.Opt[bool]
 	EnableRememberMe          h.Opt[bool]
+	RequireEmailVerification  h.Opt[bool]
+	EmailLoginMode            h.Opt[string]
+	PasswordHistoryLength     h.Opt[int]
+	PasswordPolicy            h.Opt[PasswordPolicy]
+
+	EnableRegistration           h.Opt[bool]
+	RegistrationRequiresApproval h.Opt[bool]
+	DefaultRoleIds               h.Opt[[]uuid.UUID]
+
+	ConsentExpirySeconds h.Opt[h.Opt[int]]
+
+	AuthenticationFlowId h.Opt[h.Opt[uuid.UUID]]
+
+	BruteForceProtection            h.Opt[bool]
+	BruteForceMaxFailures           h.Opt[int]
+	BruteForceIpMaxFailures         h.Opt[int]
+	BruteForceLockoutSeconds        h.Opt[int]
+	BruteForceMaxDelaySeconds       h.Opt[int]
+	BruteForcePermanentLockoutAfter h.Opt[h.Opt[int]]
 }
 
 type RealmRepository interface {
@@ -79,8 +150,12 @@ func (r *RealmRepositoryImpl) FindRealms(ctx context.Context, filter RealmFilter
 	}
 
 	q := sqlb.Select(filter.CountCol(),
-		"id", "name", "display_name", "encrypted_private_key", "require_username", "require_email",
-		"require_device_verification", "require_totp", "enable_remember_me", "password_history_length").
+		"id", "name", "display_name", "encrypted_private_key", "encrypted_rsa_private_key", "require_username", "require_email",
+		"require_device_verification", "require_totp", "require_webauthn", "enable_remember_me", "password_history_length",
+		"require_email_verification", "email_login_mode", "enable_registration", "registration_requires_approval", "default_role_ids",
+		"consent_expiry_seconds", "authentication_flow_id", "brute_force_protection", "brute_force_max_failures",
+		"brute_force_ip_max_failures", "brute_force_lockout_seconds", "brute_force_max_delay_seconds",
+		"brute_force_permanent_lockout_after", "password_policy").
 		From("realms")
 
 	filter.Id.IfSome(func(x uuid.UUID) {
@@ -116,12 +191,28 @@ func (r *RealmRepositoryImpl) FindRealms(ctx context.Context, filter RealmFilter
 			&row.Name,
 			&row.DisplayName,
 			&row.EncryptedPrivateKey,
+			row.EncryptedRsaPrivateKey.AsMutPtr(),
 			&row.RequireUsername,
 			&row.RequireEmail,
 			&row.RequireDeviceVerification,
 			&row.RequireTotp,
+			&row.RequireWebauthn,
 			&row.EnableRememberMe,
-			&row.PasswordHistoryLength)
+			&row.PasswordHistoryLength,
+			&row.RequireEmailVerification,
+			&row.EmailLoginMode,
+			&row.EnableRegistration,
+			&row.RegistrationRequiresApproval,
+			pq.Array(&row.DefaultRoleIds),
+			row.ConsentExpirySeconds.AsMutPtr(),
+			row.AuthenticationFlowId.AsMutPtr(),
+			&row.BruteForceProtection,
+			&row.BruteForceMaxFailures,
+			&row.BruteForceIpMaxFailures,
+			&row.BruteForceLockoutSeconds,
+			&row.BruteForceMaxDelaySeconds,
+			row.BruteForcePermanentLockoutAfter.AsMutPtr(),
+			&row.PasswordPolicy)
 		if err != nil {
 			panic(err)
 		}
@@ -142,16 +233,24 @@ func (r *RealmRepositoryImpl) CreateRealm(ctx context.Context, realm Realm) h.Re
 		panic(err)
 	}
 
-	q := sqlb.InsertInto("realms", "name", "display_name", "encrypted_private_key", "require_username", "require_email", "require_device_verification", "require_totp", "enable_remember_me", "password_history_length").
+	q := sqlb.InsertInto("realms", "name", "display_name", "encrypted_private_key", "encrypted_rsa_private_key", "require_username", "require_email", "require_device_verification", "require_totp", "require_webauthn", "enable_remember_me", "password_history_length", "require_email_verification", "email_login_mode", "enable_registration", "registration_requires_approval", "default_role_ids", "consent_expiry_seconds").
 		Values(realm.Name,
 			realm.DisplayName,
 			realm.EncryptedPrivateKey,
+			realm.EncryptedRsaPrivateKey.ToNillablePtr(),
 			realm.RequireUsername,
 			realm.RequireEmail,
 			realm.RequireDeviceVerification,
 			realm.RequireTotp,
+			realm.RequireWebauthn,
 			realm.EnableRememberMe,
-			realm.PasswordHistoryLength).
+			realm.PasswordHistoryLength,
+			realm.RequireEmailVerification,
+			realm.EmailLoginMode,
+			realm.EnableRegistration,
+			realm.RegistrationRequiresApproval,
+			pq.Array(realm.DefaultRoleIds),
+			realm.ConsentExpirySeconds.ToNillablePtr()).
 		Returning("id")
 
 	query := q.Build()
@@ -192,6 +291,10 @@ func (r *RealmRepositoryImpl) UpdateRealm(ctx context.Context, id uuid.UUID, upd
 		sb.Set(sb.Assign("display_name", x))
 	})
 
+	upd.EncryptedRsaPrivateKey.IfSome(func(x []byte) {
+		sb.Set(sb.Assign("encrypted_rsa_private_key", x))
+	})
+
 	upd.RequireUsername.IfSome(func(x bool) {
 		sb.Set(sb.Assign("require_username", x))
 	})
@@ -204,14 +307,78 @@ func (r *RealmRepositoryImpl) UpdateRealm(ctx context.Context, id uuid.UUID, upd
 		sb.Set(sb.Assign("require_totp", x))
 	})
 
+	upd.RequireWebauthn.IfSome(func(x bool) {
+		sb.Set(sb.Assign("require_webauthn", x))
+	})
+
 	upd.EnableRememberMe.IfSome(func(x bool) {
 		sb.Set(sb.Assign("enable_remember_me", x))
 	})
 
+	upd.RequireEmailVerification.IfSome(func(x bool) {
+		sb.Set(sb.Assign("require_email_verification", x))
+	})
+
+	upd.EmailLoginMode.IfSome(func(x string) {
+		sb.Set(sb.Assign("email_login_mode", x))
+	})
+
+	upd.EnableRegistration.IfSome(func(x bool) {
+		sb.Set(sb.Assign("enable_registration", x))
+	})
+
+	upd.RegistrationRequiresApproval.IfSome(func(x bool) {
+		sb.Set(sb.Assign("registration_requires_approval", x))
+	})
+
+	upd.DefaultRoleIds.IfSome(func(x []uuid.UUID) {
+		sb.Set(sb.Assign("default_role_ids", pq.Array(x)))
+	})
+
 	upd.RequireDeviceVerification.IfSome(func(x bool) {
 		sb.Set(sb.Assign("require_device_verification", x))
 	})
 
+	upd.ConsentExpirySeconds.IfSome(func(x h.Opt[int]) {
+		sb.Set(sb.Assign("consent_expiry_seconds", x.ToNillablePtr()))
+	})
+
+	upd.AuthenticationFlowId.IfSome(func(x h.Opt[uuid.UUID]) {
+		sb.Set(sb.Assign("authentication_flow_id", x.ToNillablePtr()))
+	})
+
+	upd.PasswordHistoryLength.IfSome(func(x int) {
+		sb.Set(sb.Assign("password_history_length", x))
+	})
+
+	upd.PasswordPolicy.IfSome(func(x PasswordPolicy) {
+		sb.Set(sb.Assign("password_policy", x))
+	})
+
+	upd.BruteForceProtection.IfSome(func(x bool) {
+		sb.Set(sb.Assign("brute_force_protection", x))
+	})
+
+	upd.BruteForceMaxFailures.IfSome(func(x int) {
+		sb.Set(sb.Assign("brute_force_max_failures", x))
+	})
+
+	upd.BruteForceIpMaxFailures.IfSome(func(x int) {
+		sb.Set(sb.Assign("brute_force_ip_max_failures", x))
+	})
+
+	upd.BruteForceLockoutSeconds.IfSome(func(x int) {
+		sb.Set(sb.Assign("brute_force_lockout_seconds", x))
+	})
+
+	upd.BruteForceMaxDelaySeconds.IfSome(func(x int) {
+		sb.Set(sb.Assign("brute_force_max_delay_seconds", x))
+	})
+
+	upd.BruteForcePermanentLockoutAfter.IfSome(func(x h.Opt[int]) {
+		sb.Set(sb.Assign("brute_force_permanent_lockout_after", x.ToNillablePtr()))
+	})
+
 	sb.Where(sb.Equal("id", id))
 
 	sqlString, args := sb.Build()
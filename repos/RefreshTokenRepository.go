@@ -29,6 +29,8 @@ type RefreshToken struct {
 	Subject  string
 	Audience string
 	Scopes   []string
+
+	ClaimsRequest h.Opt[string]
 }
 
 type RefreshTokenFilter struct {
@@ -43,6 +45,8 @@ type RefreshTokenRepository interface {
 	FindRefreshTokens(ctx context.Context, filter RefreshTokenFilter) FilterResult[RefreshToken]
 	CreateRefreshToken(ctx context.Context, refreshToken RefreshToken) uuid.UUID
 	DeleteRefreshToken(ctx context.Context, id uuid.UUID)
+	DeleteRefreshTokens(ctx context.Context, userId uuid.UUID, clientId uuid.UUID)
+	DeleteRefreshTokensOfUser(ctx context.Context, userId uuid.UUID)
 }
 
 type refreshTokenRepositoryImpl struct{}
@@ -69,7 +73,7 @@ func (r *refreshTokenRepositoryImpl) FindRefreshTokens(ctx context.Context, filt
 	}
 
 	q := sqlb.Select(filter.CountCol(),
-		"id", "user_id", "client_id", "realm_id", "hashed_token", "valid_until", "issuer", "subject", "audience", "scopes").
+		"id", "user_id", "client_id", "realm_id", "hashed_token", "valid_until", "issuer", "subject", "audience", "scopes", "claims_request").
 		From("refresh_tokens")
 
 	filter.Id.IfSome(func(x uuid.UUID) {
@@ -114,7 +118,8 @@ func (r *refreshTokenRepositoryImpl) FindRefreshTokens(ctx context.Context, filt
 			&row.Issuer,
 			&row.Subject,
 			&row.Audience,
-			pq.Array(&row.Scopes))
+			pq.Array(&row.Scopes),
+			row.ClaimsRequest.AsMutPtr())
 		if err != nil {
 			panic(err)
 		}
@@ -135,7 +140,7 @@ func (r *refreshTokenRepositoryImpl) CreateRefreshToken(ctx context.Context, ref
 		panic(err)
 	}
 
-	q := sqlb.InsertInto("refresh_tokens", "user_id", "client_id", "realm_id", "hashed_token", "valid_until", "issuer", "subject", "audience", "scopes").
+	q := sqlb.InsertInto("refresh_tokens", "user_id", "client_id", "realm_id", "hashed_token", "valid_until", "issuer", "subject", "audience", "scopes", "claims_request").
 		Values(refreshToken.UserId,
 			refreshToken.ClientId,
 			refreshToken.RealmId,
@@ -144,7 +149,8 @@ func (r *refreshTokenRepositoryImpl) CreateRefreshToken(ctx context.Context, ref
 			refreshToken.Issuer,
 			refreshToken.Subject,
 			refreshToken.Audience,
-			pq.Array(refreshToken.Scopes)).
+			pq.Array(refreshToken.Scopes),
+			refreshToken.ClaimsRequest.ToNillablePtr()).
 		Returning("id")
 
 	query := q.Build()
@@ -180,3 +186,44 @@ func (r *refreshTokenRepositoryImpl) DeleteRefreshToken(ctx context.Context, id
 		panic(err)
 	}
 }
+
+func (r *refreshTokenRepositoryImpl) DeleteRefreshTokens(ctx context.Context, userId uuid.UUID, clientId uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("refresh_tokens").
+		Where("user_id = ?", userId).
+		Where("client_id = ?", clientId)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (r *refreshTokenRepositoryImpl) DeleteRefreshTokensOfUser(ctx context.Context, userId uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("refresh_tokens").
+		Where("user_id = ?", userId)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -103,7 +103,7 @@ func (r *roleImplicationRepositoryImpl) FindRoleImplications(ctx context.Context
 	for rows.Next() {
 		var row RoleImplication
 		err := rows.Scan(&row.Id,
-			row.RoleId,
+			&row.RoleId,
 			&row.ImpliedRoleId)
 		if err != nil {
 			panic(mapCustomErrorCodes(err))
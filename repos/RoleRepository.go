@@ -25,6 +25,9 @@ type Role struct {
 
 	ImpliesCache []uuid.UUID
 	Internal     bool
+
+	// LdapProviderId is set for roles that an ldap sync created for a directory group, only those are managed by the sync.
+	LdapProviderId h.Opt[uuid.UUID]
 }
 
 type RoleUpdate struct {
@@ -46,6 +49,11 @@ type RoleFilter struct {
 	RealmId uuid.UUID
 	RoleIds h.Opt[[]uuid.UUID]
 	Name    h.Opt[string]
+
+	Internal     h.Opt[bool]
+	IsClientRole h.Opt[bool]
+
+	LdapProviderId h.Opt[uuid.UUID]
 }
 
 type RoleRepository interface {
@@ -80,7 +88,8 @@ func (r *roleRepositoryImpl) FindRoles(ctx context.Context, filter RoleFilter) F
 	}
 
 	q := sqlb.Select(filter.CountCol(),
-		"id", "realm_id", "client_id", "display_name", "name", "description", "implies_cache", "internal").
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "client_id", "display_name", "name", "description", "implies_cache", "internal",
+		"ldap_provider_id").
 		From("roles").
 		Where("realm_id = ?", filter.RealmId)
 
@@ -89,13 +98,29 @@ func (r *roleRepositoryImpl) FindRoles(ctx context.Context, filter RoleFilter) F
 	})
 
 	filter.RoleIds.IfSome(func(x []uuid.UUID) {
-		q.Where("id IN (?)", pq.Array(x))
+		q.Where("id = any(?)", pq.Array(x))
 	})
 
 	filter.Name.IfSome(func(x string) {
 		q.Where("name = ?", x)
 	})
 
+	filter.Internal.IfSome(func(x bool) {
+		q.Where("internal = ?", x)
+	})
+
+	filter.IsClientRole.IfSome(func(x bool) {
+		if x {
+			q.Where("client_id is not null")
+		} else {
+			q.Where("client_id is null")
+		}
+	})
+
+	filter.LdapProviderId.IfSome(func(x uuid.UUID) {
+		q.Where("ldap_provider_id = ?", x)
+	})
+
 	filter.PagingInfo.IfSome(func(x PagingInfo) {
 		x.Apply(q)
 	})
@@ -118,13 +143,16 @@ func (r *roleRepositoryImpl) FindRoles(ctx context.Context, filter RoleFilter) F
 		var row Role
 		err := rows.Scan(&totalCount,
 			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
 			&row.RealmId,
 			row.ClientId.AsMutPtr(),
 			&row.DisplayName,
 			&row.Name,
 			&row.Description,
 			pq.Array(&row.ImpliesCache),
-			&row.Internal)
+			&row.Internal,
+			row.LdapProviderId.AsMutPtr())
 		if err != nil {
 			panic(mapCustomErrorCodes(err))
 		}
@@ -145,8 +173,8 @@ func (r *roleRepositoryImpl) CreateRole(ctx context.Context, role Role) h.Result
 		return h.Err[uuid.UUID](err)
 	}
 
-	q := sqlb.InsertInto("roles", "realm_id", "client_id", "display_name", "name", "description", "internal").
-		Values(role.RealmId, role.ClientId.ToNillablePtr(), role.DisplayName, role.Name, role.Description, role.Internal).
+	q := sqlb.InsertInto("roles", "realm_id", "client_id", "display_name", "name", "description", "internal", "ldap_provider_id").
+		Values(role.RealmId, role.ClientId.ToNillablePtr(), role.DisplayName, role.Name, role.Description, role.Internal, role.LdapProviderId.ToNillablePtr()).
 		Returning("id")
 
 	query := q.Build()
@@ -3,7 +3,6 @@ package repos
 import (
 	"context"
 	"github.com/google/uuid"
-	"github.com/huandu/go-sqlbuilder"
 	"github.com/lib/pq"
 	"holvit/h"
 	"holvit/ioc"
@@ -12,6 +11,7 @@ import (
 	"holvit/requestContext"
 	"holvit/sqlb"
 	"holvit/utils"
+	"time"
 )
 
 type Scope struct {
@@ -27,6 +27,12 @@ type Scope struct {
 	Grant h.Opt[Grant]
 }
 
+type ScopeUpdate struct {
+	DisplayName h.Opt[string]
+	Description h.Opt[string]
+	SortIndex   h.Opt[int]
+}
+
 type DuplicateScopeError struct{}
 
 func (e DuplicateScopeError) Error() string {
@@ -39,26 +45,33 @@ type Grant struct {
 	ScopeId  uuid.UUID
 	UserId   uuid.UUID
 	ClientId uuid.UUID
+
+	GrantedAt time.Time
 }
 
 type ScopeFilter struct {
 	BaseFilter
 
-	RealmId uuid.UUID
-	Names   h.Opt[[]string]
+	RealmId    uuid.UUID
+	Names      h.Opt[[]string]
+	ClaimNames h.Opt[[]string]
 
 	IncludeGrants bool
 	OnlyGranted   bool
 
-	UserId   h.Opt[uuid.UUID]
-	ClientId h.Opt[uuid.UUID]
+	UserId       h.Opt[uuid.UUID]
+	ClientId     h.Opt[uuid.UUID]
+	GrantedAfter h.Opt[time.Time]
 }
 
 type ScopeRepository interface {
 	FindScopeById(ctx context.Context, id uuid.UUID) h.Opt[Scope]
 	FindScopes(ctx context.Context, filter ScopeFilter) FilterResult[Scope]
 	CreateScope(ctx context.Context, scope Scope) h.Result[uuid.UUID]
+	UpdateScope(ctx context.Context, id uuid.UUID, upd ScopeUpdate)
+	DeleteScope(ctx context.Context, id uuid.UUID)
 	CreateGrants(ctx context.Context, userId uuid.UUID, clientId uuid.UUID, scopeIds []uuid.UUID)
+	DeleteGrants(ctx context.Context, userId uuid.UUID, clientId uuid.UUID)
 }
 
 type scopeRepositoryImpl struct{}
@@ -84,18 +97,33 @@ func (s *scopeRepositoryImpl) FindScopes(ctx context.Context, filter ScopeFilter
 		panic(err)
 	}
 
-	q := sqlb.Select(filter.CountCol(), "s.id", "s.realm_id", "s.name", "s.display_name", "s.description").
+	q := sqlb.Select(filter.CountCol(), "s.id", "s.realm_id", "s.name", "s.display_name", "s.description", "s.sort_index").
 		From("scopes s")
 
 	if filter.IncludeGrants {
-		q.Select("g.id", "g.scope_id", "g.user_id", "g.client_id")
+		q.Select("g.id", "g.scope_id", "g.user_id", "g.client_id", "g.granted_at")
 	}
 
 	if filter.IncludeGrants {
+		// the grant conditions have to be part of the join, otherwise scopes granted to other users or clients would be filtered out
+		joinConditions := []any{sqlb.Raw("g.scope_id = s.id")}
+
+		filter.UserId.IfSome(func(x uuid.UUID) {
+			joinConditions = append(joinConditions, sqlb.Raw("g.user_id = ?", x))
+		})
+
+		filter.ClientId.IfSome(func(x uuid.UUID) {
+			joinConditions = append(joinConditions, sqlb.Raw("g.client_id = ?", x))
+		})
+
+		filter.GrantedAfter.IfSome(func(x time.Time) {
+			joinConditions = append(joinConditions, sqlb.Raw("g.granted_at >= ?", x))
+		})
+
 		if filter.OnlyGranted {
-			q.InnerJoin("grants g", "g.scope_id = s.id")
+			q.InnerJoin("grants g", sqlb.And(joinConditions...))
 		} else {
-			q.LeftJoin("grants g", "g.scope_id = s.id")
+			q.LeftJoin("grants g", sqlb.And(joinConditions...))
 		}
 	}
 
@@ -109,8 +137,12 @@ func (s *scopeRepositoryImpl) FindScopes(ctx context.Context, filter ScopeFilter
 		q.Where("s.name = any(?::text[])", pq.Array(x))
 	})
 
-	filter.ClientId.IfSome(func(x uuid.UUID) {
-		q.Where("(g.client_id = ? or g.client_id is null)", x)
+	filter.ClaimNames.IfSome(func(x []string) {
+		q.Where(sqlb.Exists(sqlb.Select("1").
+			From("scope_claims sc").
+			Join("claim_mappers c", "c.id = sc.claim_mapper_id").
+			Where("sc.scope_id = s.id").
+			Where("c.details->>'ClaimName' = any(?::text[])", pq.Array(x))))
 	})
 
 	filter.PagingInfo.IfSome(func(x PagingInfo) {
@@ -138,18 +170,21 @@ func (s *scopeRepositoryImpl) FindScopes(ctx context.Context, filter ScopeFilter
 		var grantScopeId h.Opt[uuid.UUID]
 		var grantUserId h.Opt[uuid.UUID]
 		var grantClientId h.Opt[uuid.UUID]
+		var grantGrantedAt h.Opt[time.Time]
 		scan := []any{&totalCount,
 			&row.Id,
 			&row.RealmId,
 			&row.Name,
 			&row.DisplayName,
-			&row.Description}
+			&row.Description,
+			&row.SortIndex}
 		if filter.IncludeGrants {
 			scan = append(scan,
 				grantId.AsMutPtr(),
 				grantScopeId.AsMutPtr(),
 				grantUserId.AsMutPtr(),
-				grantClientId.AsMutPtr())
+				grantClientId.AsMutPtr(),
+				grantGrantedAt.AsMutPtr())
 		}
 		err := rows.Scan(scan...)
 		if err != nil {
@@ -161,9 +196,10 @@ func (s *scopeRepositoryImpl) FindScopes(ctx context.Context, filter ScopeFilter
 				BaseModel: BaseModel{
 					Id: grantId.Unwrap(),
 				},
-				ScopeId:  grantScopeId.Unwrap(),
-				UserId:   grantUserId.Unwrap(),
-				ClientId: grantClientId.Unwrap(),
+				ScopeId:   grantScopeId.Unwrap(),
+				UserId:    grantUserId.Unwrap(),
+				ClientId:  grantClientId.Unwrap(),
+				GrantedAt: grantGrantedAt.Unwrap(),
 			})
 		}
 
@@ -211,6 +247,65 @@ func (s *scopeRepositoryImpl) CreateScope(ctx context.Context, scope Scope) h.Re
 	return h.Ok(resultingId)
 }
 
+func (s *scopeRepositoryImpl) UpdateScope(ctx context.Context, id uuid.UUID, upd ScopeUpdate) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Update("scopes")
+
+	upd.DisplayName.IfSome(func(x string) {
+		q.Set("display_name", x)
+	})
+
+	upd.Description.IfSome(func(x string) {
+		q.Set("description", x)
+	})
+
+	upd.SortIndex.IfSome(func(x int) {
+		q.Set("sort_index", x)
+	})
+
+	q.Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
+
+func (s *scopeRepositoryImpl) DeleteScope(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	// grants and claim mapper associations do not cascade
+	queries := []sqlb.Query{
+		sqlb.DeleteFrom("grants").Where("scope_id = ?", id),
+		sqlb.DeleteFrom("scope_claims").Where("scope_id = ?", id),
+		sqlb.DeleteFrom("scopes").Where("id = ?", id),
+	}
+
+	for _, q := range queries {
+		query := q.Build()
+		logging.Logger.Debugf("executing sql: %s", query.Sql)
+		_, err = tx.Exec(query.Sql, query.Parameters...)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+	}
+}
+
 func (s *scopeRepositoryImpl) CreateGrants(ctx context.Context, userId uuid.UUID, clientId uuid.UUID, scopeIds []uuid.UUID) {
 	scope := middlewares.GetScope(ctx)
 	rcs := ioc.Get[requestContext.RequestContextService](scope)
@@ -220,18 +315,45 @@ func (s *scopeRepositoryImpl) CreateGrants(ctx context.Context, userId uuid.UUID
 		panic(err)
 	}
 
-	sb := sqlbuilder.InsertInto("grants").
-		Cols("scope_id", "user_id", "client_id")
+	if len(scopeIds) == 0 {
+		return
+	}
+
+	q := sqlb.InsertInto("grants", "scope_id", "user_id", "client_id")
 
 	for _, scopeId := range scopeIds {
-		sb.Values(scopeId, userId, clientId)
+		q.Values(scopeId, userId, clientId)
 	}
 
-	sqlString, args := sb.Build()
-	logging.Logger.Debugf("executing sql: %s", sqlString)
-	_, err = tx.Exec(sqlString, args...)
+	// granting a scope again renews an expired consent
+	q.OnConflict().Cols("scope_id", "user_id", "client_id").DoUpdate().Set("granted_at", "now()")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
 
 	if err != nil {
 		panic(mapCustomErrorCodes(err))
 	}
 }
+
+func (s *scopeRepositoryImpl) DeleteGrants(ctx context.Context, userId uuid.UUID, clientId uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("grants").
+		Where("user_id = ?", userId).
+		Where("client_id = ?", clientId)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -0,0 +1,134 @@
+package repos
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/requestContext"
+	"holvit/sqlb"
+	"holvit/utils"
+)
+
+type SecurityEvent struct {
+	BaseModel
+
+	RealmId uuid.UUID
+	UserId  h.Opt[uuid.UUID]
+
+	// Type is one of the constants.SecurityEvent values.
+	Type      string
+	IpAddress string
+	Details   string
+}
+
+type SecurityEventFilter struct {
+	BaseFilter
+
+	RealmId uuid.UUID
+	UserId  h.Opt[uuid.UUID]
+	Type    h.Opt[string]
+}
+
+type SecurityEventRepository interface {
+	FindSecurityEvents(ctx context.Context, filter SecurityEventFilter) FilterResult[SecurityEvent]
+	CreateSecurityEvent(ctx context.Context, securityEvent SecurityEvent) uuid.UUID
+}
+
+type securityEventRepositoryImpl struct{}
+
+func NewSecurityEventRepository() SecurityEventRepository {
+	return &securityEventRepositoryImpl{}
+}
+
+func (s *securityEventRepositoryImpl) FindSecurityEvents(ctx context.Context, filter SecurityEventFilter) FilterResult[SecurityEvent] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.Select(filter.CountCol(),
+		"id", "audit_created_at", "audit_updated_at", "realm_id", "user_id", "type", "ip_address", "details").
+		From("security_events").
+		Where("realm_id = ?", filter.RealmId).
+		OrderBy("audit_created_at desc")
+
+	filter.Id.IfSome(func(x uuid.UUID) {
+		q.Where("id = ?", x)
+	})
+
+	filter.UserId.IfSome(func(x uuid.UUID) {
+		q.Where("user_id = ?", x)
+	})
+
+	filter.Type.IfSome(func(x string) {
+		q.Where("type = ?", x)
+	})
+
+	filter.PagingInfo.IfSome(func(x PagingInfo) {
+		x.Apply(q)
+	})
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	rows, err := tx.Query(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+	defer utils.PanicOnErr(rows.Close)
+
+	var totalCount int
+	var result []SecurityEvent
+	for rows.Next() {
+		var row SecurityEvent
+		err := rows.Scan(&totalCount,
+			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
+			&row.RealmId,
+			row.UserId.AsMutPtr(),
+			&row.Type,
+			&row.IpAddress,
+			&row.Details)
+		if err != nil {
+			panic(mapCustomErrorCodes(err))
+		}
+		result = append(result, row)
+	}
+
+	return NewPagedResult(result, totalCount)
+}
+
+func (s *securityEventRepositoryImpl) CreateSecurityEvent(ctx context.Context, securityEvent SecurityEvent) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	var resultingId uuid.UUID
+
+	q := sqlb.InsertInto("security_events", "realm_id", "user_id", "type", "ip_address", "details").
+		Values(securityEvent.RealmId,
+			securityEvent.UserId.ToNillablePtr(),
+			securityEvent.Type,
+			securityEvent.IpAddress,
+			securityEvent.Details).
+		Returning("id")
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	err = tx.QueryRow(query.Sql, query.Parameters...).Scan(&resultingId)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return resultingId
+}
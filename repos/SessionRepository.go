@@ -38,6 +38,7 @@ type SessionRepository interface {
 	FindSessions(ctx context.Context, filter SessionFilter) FilterResult[Session]
 	CreateSession(ctx context.Context, session Session) uuid.UUID
 	DeleteOldSessions(ctx context.Context)
+	DeleteSessionsOfUser(ctx context.Context, userId uuid.UUID)
 }
 
 type sessionRepositoryImpl struct{}
@@ -161,3 +162,22 @@ func (s *sessionRepositoryImpl) CreateSession(ctx context.Context, session Sessi
 
 	return resultingId
 }
+
+func (s *sessionRepositoryImpl) DeleteSessionsOfUser(ctx context.Context, userId uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("sessions").Where("user_id = ?", userId)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -3,6 +3,7 @@ package repos
 import (
 	"context"
 	"github.com/google/uuid"
+	"github.com/huandu/go-sqlbuilder"
 	"github.com/lib/pq"
 	"holvit/h"
 	"holvit/ioc"
@@ -22,6 +23,25 @@ type User struct {
 	Username      string
 	Email         h.Opt[string]
 	EmailVerified bool
+	Enabled       bool
+	// ApprovalPending is set for self-registered users until an admin approves them, they stay disabled until then.
+	ApprovalPending bool
+
+	// LdapProviderId is set for users that are federated from an ldap directory, they authenticate against the directory.
+	LdapProviderId h.Opt[uuid.UUID]
+	LdapDn         h.Opt[string]
+}
+
+type UserUpdate struct {
+	Username      h.Opt[string]
+	Email         h.Opt[h.Opt[string]]
+	EmailVerified h.Opt[bool]
+	Enabled       h.Opt[bool]
+
+	ApprovalPending h.Opt[bool]
+
+	LdapProviderId h.Opt[h.Opt[uuid.UUID]]
+	LdapDn         h.Opt[h.Opt[string]]
 }
 
 type DuplicateUsernameError struct{}
@@ -34,13 +54,24 @@ type UserFilter struct {
 	BaseFilter
 
 	RealmId  h.Opt[uuid.UUID]
+	UserIds  h.Opt[[]uuid.UUID]
 	Username h.Opt[string]
+	// Usernames matches users with any of the usernames, ignoring the case like Username.
+	Usernames      h.Opt[[]string]
+	Email          h.Opt[string]
+	LdapProviderId h.Opt[uuid.UUID]
+	// GroupId only returns the direct members of the group.
+	GroupId h.Opt[uuid.UUID]
+
+	ApprovalPending h.Opt[bool]
 }
 
 type UserRepository interface {
 	FindUserById(ctx context.Context, id uuid.UUID) h.Opt[User]
 	FindUsers(ctx context.Context, filter UserFilter) FilterResult[User]
 	CreateUser(ctx context.Context, user User) h.Result[uuid.UUID]
+	UpdateUser(ctx context.Context, id uuid.UUID, upd UserUpdate) h.UResult
+	DeleteUser(ctx context.Context, id uuid.UUID)
 }
 
 type userRepositoryImpl struct{}
@@ -66,7 +97,7 @@ func (u *userRepositoryImpl) FindUsers(ctx context.Context, filter UserFilter) F
 		panic(err)
 	}
 
-	q := sqlb.Select(filter.CountCol(), "id", "realm_id", "username", "email", "email_verified").
+	q := sqlb.Select(filter.CountCol(), "id", "audit_created_at", "audit_updated_at", "realm_id", "username", "email", "email_verified", "enabled", "approval_pending", "ldap_provider_id", "ldap_dn").
 		From("users")
 
 	filter.Id.IfSome(func(x uuid.UUID) {
@@ -77,8 +108,39 @@ func (u *userRepositoryImpl) FindUsers(ctx context.Context, filter UserFilter) F
 		q.Where("realm_id = ?", x)
 	})
 
+	filter.UserIds.IfSome(func(x []uuid.UUID) {
+		q.Where("id = any(?)", pq.Array(x))
+	})
+
 	filter.Username.IfSome(func(x string) {
-		q.Where("username = lower(?)", x)
+		q.Where("lower(username) = lower(?)", x)
+	})
+
+	filter.Usernames.IfSome(func(x []string) {
+		lowerUsernames := make([]string, 0, len(x))
+		for _, username := range x {
+			lowerUsernames = append(lowerUsernames, strings.ToLower(username))
+		}
+		q.Where("lower(username) = any(?::text[])", pq.Array(lowerUsernames))
+	})
+
+	filter.Email.IfSome(func(x string) {
+		q.Where("lower(email) = lower(?)", x)
+	})
+
+	filter.LdapProviderId.IfSome(func(x uuid.UUID) {
+		q.Where("ldap_provider_id = ?", x)
+	})
+
+	filter.GroupId.IfSome(func(x uuid.UUID) {
+		q.Where(sqlb.Exists(sqlb.Select("1").
+			From("group_members gm").
+			Where("gm.user_id = users.id").
+			Where("gm.group_id = ?", x)))
+	})
+
+	filter.ApprovalPending.IfSome(func(x bool) {
+		q.Where("approval_pending = ?", x)
 	})
 
 	filter.PagingInfo.IfSome(func(x PagingInfo) {
@@ -117,10 +179,16 @@ func (u *userRepositoryImpl) FindUsers(ctx context.Context, filter UserFilter) F
 		var row User
 		err := rows.Scan(&totalCount,
 			&row.Id,
+			&row.AuditCreatedAt,
+			&row.AuditUpdatedAt,
 			&row.RealmId,
 			&row.Username,
 			row.Email.AsMutPtr(),
-			&row.EmailVerified)
+			&row.EmailVerified,
+			&row.Enabled,
+			&row.ApprovalPending,
+			row.LdapProviderId.AsMutPtr(),
+			row.LdapDn.AsMutPtr())
 		if err != nil {
 			panic(mapCustomErrorCodes(err))
 		}
@@ -142,11 +210,15 @@ func (u *userRepositoryImpl) CreateUser(ctx context.Context, user User) h.Result
 		return h.Err[uuid.UUID](err)
 	}
 
-	q := sqlb.InsertInto("users", "realm_id", "username", "email", "email_verified").
+	q := sqlb.InsertInto("users", "realm_id", "username", "email", "email_verified", "enabled", "approval_pending", "ldap_provider_id", "ldap_dn").
 		Values(user.RealmId,
 			user.Username,
 			user.Email.ToNillablePtr(),
-			user.EmailVerified).
+			user.EmailVerified,
+			user.Enabled,
+			user.ApprovalPending,
+			user.LdapProviderId.ToNillablePtr(),
+			user.LdapDn.ToNillablePtr()).
 		Returning("id")
 
 	query := q.Build()
@@ -167,3 +239,83 @@ func (u *userRepositoryImpl) CreateUser(ctx context.Context, user User) h.Result
 
 	return h.Ok(resultingId)
 }
+
+func (u *userRepositoryImpl) UpdateUser(ctx context.Context, id uuid.UUID, upd UserUpdate) h.UResult {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		return h.UErr(err)
+	}
+
+	sb := sqlbuilder.Update("users")
+
+	upd.Username.IfSome(func(x string) {
+		sb.Set(sb.Assign("username", x))
+	})
+
+	upd.Email.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("email", x.ToNillablePtr()))
+	})
+
+	upd.EmailVerified.IfSome(func(x bool) {
+		sb.Set(sb.Assign("email_verified", x))
+	})
+
+	upd.Enabled.IfSome(func(x bool) {
+		sb.Set(sb.Assign("enabled", x))
+	})
+
+	upd.ApprovalPending.IfSome(func(x bool) {
+		sb.Set(sb.Assign("approval_pending", x))
+	})
+
+	upd.LdapProviderId.IfSome(func(x h.Opt[uuid.UUID]) {
+		sb.Set(sb.Assign("ldap_provider_id", x.ToNillablePtr()))
+	})
+
+	upd.LdapDn.IfSome(func(x h.Opt[string]) {
+		sb.Set(sb.Assign("ldap_dn", x.ToNillablePtr()))
+	})
+
+	sb.Where(sb.Equal("id", id))
+
+	sqlString, args := sb.Build()
+	logging.Logger.Debugf("executing sql: %s", sqlString)
+	_, err = tx.Exec(sqlString, args...)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				if pqErr.Constraint == "idx_unique_username_per_realm" {
+					return h.UErr(DuplicateUsernameError{})
+				}
+			}
+		}
+
+		panic(mapCustomErrorCodes(err))
+	}
+
+	return h.UOk()
+}
+
+func (u *userRepositoryImpl) DeleteUser(ctx context.Context, id uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	tx, err := rcs.GetTx()
+	if err != nil {
+		panic(err)
+	}
+
+	q := sqlb.DeleteFrom("users").
+		Where("id = ?", id)
+
+	query := q.Build()
+	logging.Logger.Debugf("executing sql: %s", query.Sql)
+	_, err = tx.Exec(query.Sql, query.Parameters...)
+	if err != nil {
+		panic(mapCustomErrorCodes(err))
+	}
+}
@@ -3,6 +3,7 @@ package repos
 import (
 	"context"
 	"github.com/google/uuid"
+	"holvit/h"
 	"holvit/ioc"
 	"holvit/logging"
 	"holvit/middlewares"
@@ -19,7 +20,8 @@ type UserRole struct {
 }
 
 type UserRoleFilter struct {
-	UserId uuid.UUID
+	UserId h.Opt[uuid.UUID]
+	RoleId h.Opt[uuid.UUID]
 }
 
 type UserRoleRepository interface {
@@ -91,7 +93,13 @@ func (u *userRoleRepositoryImpl) FindUserRoles(ctx context.Context, filter UserR
 	q := sqlb.Select("id", "user_id", "role_id").
 		From("user_roles")
 
-	q.Where("user_id = ?", filter.UserId)
+	filter.UserId.IfSome(func(x uuid.UUID) {
+		q.Where("user_id = ?", x)
+	})
+
+	filter.RoleId.IfSome(func(x uuid.UUID) {
+		q.Where("role_id = ?", x)
+	})
 
 	query := q.Build()
 	logging.Logger.Debugf("executing sql: %s", query.Sql)
@@ -101,12 +109,10 @@ func (u *userRoleRepositoryImpl) FindUserRoles(ctx context.Context, filter UserR
 	}
 	defer utils.PanicOnErr(rows.Close)
 
-	var totalCount int
 	var result []UserRole
 	for rows.Next() {
 		var row UserRole
-		err := rows.Scan(&totalCount,
-			&row.Id,
+		err := rows.Scan(&row.Id,
 			&row.UserId,
 			&row.RoleId)
 		if err != nil {
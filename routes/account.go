@@ -0,0 +1,4 @@
+package routes
+
+var ApiFindConsents = RealmRoute(realmApiBase + "/account/consents")
+var ApiRevokeConsent = RealmRoute(realmApiBase + "/account/consents/{clientId}")
@@ -6,9 +6,65 @@ var adminApiBase = "/api/admin"
 
 var AdminApiBase = SimpleRoute(adminApiBase)
 
+var ReconcileRealms = SimpleRoute(adminApiBase + "/reconcile")
+
 var FindRealms = RealmRoute(adminApiBase + "/realms")
+var ImportRealm = RealmRoute(adminApiBase + "/realms/import")
+var UpdateRealm = RealmRoute(adminApiBase + "/realms/{realmName}")
+var ExportRealm = RealmRoute(adminApiBase + "/realms/{realmName}/export")
 
 var CreateUser = RealmRoute(adminApiBase + "/realms/{realmName}/users")
 var FindUsers = RealmRoute(adminApiBase + "/realms/{realmName}/users")
+var ImportUsers = RealmRoute(adminApiBase + "/realms/{realmName}/users/import")
+var ApproveUser = RealmRoute(adminApiBase + "/realms/{realmName}/users/{userId}/approve")
+
+var FindUserGroups = RealmRoute(adminApiBase + "/realms/{realmName}/users/{userId}/groups")
+
+var FindUserConsents = RealmRoute(adminApiBase + "/realms/{realmName}/users/{userId}/consents")
+var RevokeUserConsent = RealmRoute(adminApiBase + "/realms/{realmName}/users/{userId}/consents/{clientId}")
+
+var CreateClient = RealmRoute(adminApiBase + "/realms/{realmName}/clients")
+var FindClients = RealmRoute(adminApiBase + "/realms/{realmName}/clients")
+var UpdateClient = RealmRoute(adminApiBase + "/realms/{realmName}/clients/{clientId}")
+
+var FindClientRoles = RealmRoute(adminApiBase + "/realms/{realmName}/clients/{clientId}/roles")
+var GrantClientRole = RealmRoute(adminApiBase + "/realms/{realmName}/clients/{clientId}/roles")
+var RevokeClientRole = RealmRoute(adminApiBase + "/realms/{realmName}/clients/{clientId}/roles/{roleId}")
+
+var CreateGroup = RealmRoute(adminApiBase + "/realms/{realmName}/groups")
+var FindGroups = RealmRoute(adminApiBase + "/realms/{realmName}/groups")
+var UpdateGroup = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}")
+var DeleteGroup = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}")
+var FindGroupRoles = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}/roles")
+var SetGroupRoles = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}/roles")
+var FindGroupMembers = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}/members")
+var AddGroupMember = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}/members/{userId}")
+var RemoveGroupMember = RealmRoute(adminApiBase + "/realms/{realmName}/groups/{groupId}/members/{userId}")
 
 var FindScopes = RealmRoute(adminApiBase + "/realms/{realmName}/scopes")
+
+var CreateInitialAccessToken = RealmRoute(adminApiBase + "/realms/{realmName}/initial-access-tokens")
+var FindInitialAccessTokens = RealmRoute(adminApiBase + "/realms/{realmName}/initial-access-tokens")
+var DeleteInitialAccessToken = RealmRoute(adminApiBase + "/realms/{realmName}/initial-access-tokens/{id}")
+
+var CreateIdentityProvider = RealmRoute(adminApiBase + "/realms/{realmName}/identity-providers")
+var FindIdentityProviders = RealmRoute(adminApiBase + "/realms/{realmName}/identity-providers")
+var UpdateIdentityProvider = RealmRoute(adminApiBase + "/realms/{realmName}/identity-providers/{id}")
+var DeleteIdentityProvider = RealmRoute(adminApiBase + "/realms/{realmName}/identity-providers/{id}")
+
+var CreateAuthenticationFlow = RealmRoute(adminApiBase + "/realms/{realmName}/authentication-flows")
+var FindAuthenticationFlows = RealmRoute(adminApiBase + "/realms/{realmName}/authentication-flows")
+var UpdateAuthenticationFlow = RealmRoute(adminApiBase + "/realms/{realmName}/authentication-flows/{id}")
+var DeleteAuthenticationFlow = RealmRoute(adminApiBase + "/realms/{realmName}/authentication-flows/{id}")
+
+var FindLockouts = RealmRoute(adminApiBase + "/realms/{realmName}/lockouts")
+var ClearUserLockout = RealmRoute(adminApiBase + "/realms/{realmName}/lockouts/users/{userId}")
+var ClearIpLockout = RealmRoute(adminApiBase + "/realms/{realmName}/lockouts/ips/{ip}")
+
+var FindSecurityEvents = RealmRoute(adminApiBase + "/realms/{realmName}/security-events")
+
+var CreateLdapProvider = RealmRoute(adminApiBase + "/realms/{realmName}/ldap-providers")
+var FindLdapProviders = RealmRoute(adminApiBase + "/realms/{realmName}/ldap-providers")
+var UpdateLdapProvider = RealmRoute(adminApiBase + "/realms/{realmName}/ldap-providers/{id}")
+var DeleteLdapProvider = RealmRoute(adminApiBase + "/realms/{realmName}/ldap-providers/{id}")
+var SyncLdapProvider = RealmRoute(adminApiBase + "/realms/{realmName}/ldap-providers/{id}/sync")
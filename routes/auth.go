@@ -8,10 +8,25 @@ var ApiVerifyPassword = RealmRoute(realmApiBase + "/auth/verify-password")
 var ApiResetPassword = RealmRoute(realmApiBase + "/auth/reset-password")
 var ApiTotpOnboarding = RealmRoute(realmApiBase + "/auth/totp-onboarding")
 var ApiVerifyTotp = RealmRoute(realmApiBase + "/auth/verify-totp")
+var ApiVerifyRecoveryCode = RealmRoute(realmApiBase + "/auth/verify-recovery-code")
 var ApiVerifyDevice = RealmRoute(realmApiBase + "/auth/verify-device")
+var ApiResendDeviceVerification = RealmRoute(realmApiBase + "/auth/resend-device-verification")
 var ApiGetOnboardingTotp = RealmRoute(realmApiBase + "/auth/get-onboarding-totp")
+var ApiGetWebauthnOptions = RealmRoute(realmApiBase + "/auth/get-webauthn-options")
+var ApiWebauthnOnboarding = RealmRoute(realmApiBase + "/auth/webauthn-onboarding")
+var ApiVerifyWebauthn = RealmRoute(realmApiBase + "/auth/verify-webauthn")
+var ApiStartEmailLogin = RealmRoute(realmApiBase + "/auth/start-email-login")
+var ApiVerifyEmailLogin = RealmRoute(realmApiBase + "/auth/verify-email-login")
+var ApiRegister = RealmRoute(realmApiBase + "/auth/register")
+var ApiVerifyRegistration = RealmRoute(realmApiBase + "/auth/verify-registration")
+var ApiForgotPassword = RealmRoute(realmApiBase + "/auth/forgot-password")
+var ApiCompletePasswordReset = RealmRoute(realmApiBase + "/auth/complete-password-reset")
 var ApiResendEmailVerification = RealmRoute(realmApiBase + "/auth/resend-email-verification")
+var ApiContinueEmailVerification = RealmRoute(realmApiBase + "/auth/continue-email-verification")
 
 var LoginComplete = RealmRoute("/auth/{realmName}/login-complete")
 var AuthorizeGrant = RealmRoute("/auth/{realmName}/authorize-grant")
 var AuthVerifyEmail = RealmRoute("/auth/{realmName}/verify-email")
+var AuthCiba = RealmRoute("/auth/{realmName}/ciba")
+var AuthMagicLink = RealmRoute("/auth/{realmName}/magic-link")
+var AuthResetPassword = RealmRoute("/auth/{realmName}/reset-password")
@@ -0,0 +1,4 @@
+package routes
+
+var AuthBrokerLogin = IdentityProviderRoute("/auth/{realmName}/broker/{alias}/login")
+var AuthBrokerCallback = IdentityProviderRoute("/auth/{realmName}/broker/{alias}/callback")
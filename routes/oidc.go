@@ -1,8 +1,11 @@
 package routes
 
 var OidcAuthorize = RealmRoute("/oidc/{realmName}/authorize")
+var OidcBackchannelAuthentication = RealmRoute("/oidc/{realmName}/bc-authorize")
 var OidcToken = RealmRoute("/oidc/{realmName}/token")
 var OidcUserInfo = RealmRoute("/oidc/{realmName}/userinfo")
 var OidcJwks = RealmRoute("/oidc/{realmName}/jwks")
 var OidcLogout = RealmRoute("/oidc/{realmName}/logout")
+var OidcRegister = RealmRoute("/oidc/{realmName}/register")
+var OidcRegisterClient = RealmRoute("/oidc/{realmName}/register/{clientId}")
 var WellKnown = RealmRoute("/oidc/{realmName}/.well-known/openid-configuration")
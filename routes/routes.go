@@ -17,6 +17,15 @@ func (r RealmRoute) Url(realmName string) string {
 
 func (r RealmRoute) String() string { return string(r) }
 
+// IdentityProviderRoute is a route of an upstream identity provider of a realm.
+type IdentityProviderRoute string
+
+func (r IdentityProviderRoute) Url(realmName string, alias string) string {
+	return makeUrl(strings.NewReplacer("{realmName}", realmName, "{alias}", alias).Replace(string(r)))
+}
+
+func (r IdentityProviderRoute) String() string { return string(r) }
+
 type SimpleRoute string
 
 func (r SimpleRoute) Url() string {
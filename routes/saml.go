@@ -0,0 +1,4 @@
+package routes
+
+var SamlMetadata = RealmRoute("/saml/{realmName}/metadata")
+var SamlSingleSignOn = RealmRoute("/saml/{realmName}/sso")
@@ -0,0 +1,7 @@
+package routes
+
+var ScimServiceProviderConfig = RealmRoute("/scim/v2/{realmName}/ServiceProviderConfig")
+var ScimUsers = RealmRoute("/scim/v2/{realmName}/Users")
+var ScimUser = RealmRoute("/scim/v2/{realmName}/Users/{id}")
+var ScimGroups = RealmRoute("/scim/v2/{realmName}/Groups")
+var ScimGroup = RealmRoute("/scim/v2/{realmName}/Groups/{id}")
@@ -0,0 +1,118 @@
+package saml
+
+import (
+	"sort"
+	"strings"
+)
+
+// element is a minimal xml writer which renders elements directly in exclusive canonical form
+// (https://www.w3.org/TR/xml-exc-c14n/), so that the rendered bytes can be digested and signed as is.
+// Every element has to declare the namespace prefixes it uses unless an ancestor in the signed subtree already does.
+type element struct {
+	name       string
+	namespaces []xmlAttr
+	attrs      []xmlAttr
+	children   []*element
+	text       string
+}
+
+type xmlAttr struct {
+	name  string
+	value string
+}
+
+func newElement(name string) *element {
+	return &element{
+		name: name,
+	}
+}
+
+func (e *element) ns(prefix string, uri string) *element {
+	e.namespaces = append(e.namespaces, xmlAttr{name: "xmlns:" + prefix, value: uri})
+	return e
+}
+
+func (e *element) attr(name string, value string) *element {
+	e.attrs = append(e.attrs, xmlAttr{name: name, value: value})
+	return e
+}
+
+func (e *element) child(children ...*element) *element {
+	e.children = append(e.children, children...)
+	return e
+}
+
+func (e *element) setText(text string) *element {
+	e.text = text
+	return e
+}
+
+func (e *element) insertChild(index int, child *element) {
+	e.children = append(e.children[:index], append([]*element{child}, e.children[index:]...)...)
+}
+
+func (e *element) String() string {
+	var sb strings.Builder
+	e.render(&sb)
+	return sb.String()
+}
+
+func (e *element) render(sb *strings.Builder) {
+	sb.WriteString("<")
+	sb.WriteString(e.name)
+
+	// namespace declarations come first, followed by the attributes, both in lexicographic order
+	// only unqualified attributes are used, so ordering by name matches the canonical order
+	namespaces := sortedAttrs(e.namespaces)
+	attrs := sortedAttrs(e.attrs)
+	for _, a := range append(namespaces, attrs...) {
+		sb.WriteString(" ")
+		sb.WriteString(a.name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeAttr(a.value))
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(">")
+
+	sb.WriteString(escapeText(e.text))
+	for _, child := range e.children {
+		child.render(sb)
+	}
+
+	sb.WriteString("</")
+	sb.WriteString(e.name)
+	sb.WriteString(">")
+}
+
+func sortedAttrs(attrs []xmlAttr) []xmlAttr {
+	result := make([]xmlAttr, len(attrs))
+	copy(result, attrs)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+var textEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\r", "&#xD;",
+)
+
+var attrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	`"`, "&quot;",
+	"\t", "&#x9;",
+	"\n", "&#xA;",
+	"\r", "&#xD;",
+)
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+func escapeAttr(value string) string {
+	return attrEscaper.Replace(value)
+}
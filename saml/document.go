@@ -0,0 +1,281 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const namespaceXml = "http://www.w3.org/XML/1998/namespace"
+
+// xmlElement is a parsed element that keeps the prefixes as they were sent,
+// which is needed to canonicalize received messages for signature verification.
+type xmlElement struct {
+	prefix string
+	local  string
+	// attrs do not contain the namespace declarations, the prefix of an attribute is in Name.Space
+	attrs []xml.Attr
+	// namespaces are all namespaces in scope by prefix, the default namespace has the empty prefix
+	namespaces map[string]string
+	children   []xmlNode
+}
+
+// xmlNode is either an element, character data or a processing instruction.
+type xmlNode struct {
+	element  *xmlElement
+	text     string
+	procInst *xml.ProcInst
+}
+
+// parseDocument parses a document into a tree, comments are dropped and document type declarations are rejected.
+func parseDocument(data []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				return nil, fmt.Errorf("more than one root element")
+			}
+
+			parentNamespaces := map[string]string{"xml": namespaceXml}
+			if len(stack) > 0 {
+				parentNamespaces = stack[len(stack)-1].namespaces
+			}
+
+			e := &xmlElement{
+				prefix:     t.Name.Space,
+				local:      t.Name.Local,
+				namespaces: parentNamespaces,
+			}
+			copied := false
+			for _, a := range t.Attr {
+				var prefix string
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					prefix = ""
+				case a.Name.Space == "xmlns":
+					prefix = a.Name.Local
+				default:
+					e.attrs = append(e.attrs, a)
+					continue
+				}
+				if !copied {
+					e.namespaces = make(map[string]string, len(parentNamespaces)+1)
+					for p, uri := range parentNamespaces {
+						e.namespaces[p] = uri
+					}
+					copied = true
+				}
+				e.namespaces[prefix] = a.Value
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, xmlNode{element: e})
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected end element")
+			}
+			current := stack[len(stack)-1]
+			if t.Name.Space != current.prefix || t.Name.Local != current.local {
+				return nil, fmt.Errorf("mismatched end element")
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, xmlNode{text: string(t)})
+			}
+		case xml.ProcInst:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				procInst := t.Copy()
+				parent.children = append(parent.children, xmlNode{procInst: &procInst})
+			}
+		case xml.Directive:
+			return nil, fmt.Errorf("document type declarations are not allowed")
+		}
+	}
+
+	if root == nil || len(stack) != 0 {
+		return nil, fmt.Errorf("incomplete document")
+	}
+	return root, nil
+}
+
+func (e *xmlElement) namespace() string {
+	return e.namespaces[e.prefix]
+}
+
+// attr returns the value of an unqualified attribute.
+func (e *xmlElement) attr(name string) string {
+	for _, a := range e.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *xmlElement) childElements(namespace string, local string) []*xmlElement {
+	var result []*xmlElement
+	for _, child := range e.children {
+		if child.element != nil && child.element.local == local && child.element.namespace() == namespace {
+			result = append(result, child.element)
+		}
+	}
+	return result
+}
+
+func (e *xmlElement) singleChild(namespace string, local string) (*xmlElement, error) {
+	children := e.childElements(namespace, local)
+	if len(children) != 1 {
+		return nil, fmt.Errorf("expected exactly one %s element", local)
+	}
+	return children[0], nil
+}
+
+func (e *xmlElement) textContent() string {
+	var sb strings.Builder
+	for _, child := range e.children {
+		sb.WriteString(child.text)
+	}
+	return sb.String()
+}
+
+// canonicalize renders the element in exclusive canonical form without comments (https://www.w3.org/TR/xml-exc-c14n/).
+// The prefixes of the InclusiveNamespaces PrefixList are rendered like in inclusive canonicalization, the excluded element is left out.
+func (e *xmlElement) canonicalize(inclusivePrefixes []string, excluded *xmlElement) string {
+	var sb strings.Builder
+	e.renderCanonical(&sb, map[string]string{}, inclusivePrefixes, excluded)
+	return sb.String()
+}
+
+func (e *xmlElement) renderCanonical(sb *strings.Builder, rendered map[string]string, inclusivePrefixes []string, excluded *xmlElement) {
+	// only the namespaces that are visibly used by the element or its attributes are rendered
+	used := map[string]bool{e.prefix: true}
+	for _, a := range e.attrs {
+		if a.Name.Space != "" {
+			used[a.Name.Space] = true
+		}
+	}
+	for _, prefix := range inclusivePrefixes {
+		if _, ok := e.namespaces[prefix]; ok {
+			used[prefix] = true
+		}
+	}
+	delete(used, "xml")
+
+	var declarations []xmlAttr
+	renderedHere := rendered
+	for prefix := range used {
+		uri, ok := e.namespaces[prefix]
+		if !ok && prefix != "" {
+			continue
+		}
+
+		previous, wasRendered := rendered[prefix]
+		if previous == uri && (wasRendered || prefix == "") {
+			continue
+		}
+
+		if len(declarations) == 0 {
+			renderedHere = make(map[string]string, len(rendered)+1)
+			for p, u := range rendered {
+				renderedHere[p] = u
+			}
+		}
+		renderedHere[prefix] = uri
+
+		name := "xmlns"
+		if prefix != "" {
+			name += ":" + prefix
+		}
+		declarations = append(declarations, xmlAttr{name: name, value: uri})
+	}
+
+	attrs := make([]xml.Attr, len(e.attrs))
+	copy(attrs, e.attrs)
+	sort.Slice(attrs, func(i, j int) bool {
+		iNamespace, jNamespace := e.attrNamespace(attrs[i]), e.attrNamespace(attrs[j])
+		if iNamespace != jNamespace {
+			return iNamespace < jNamespace
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	name := e.local
+	if e.prefix != "" {
+		name = e.prefix + ":" + e.local
+	}
+
+	sb.WriteString("<")
+	sb.WriteString(name)
+	for _, declaration := range sortedAttrs(declarations) {
+		sb.WriteString(" ")
+		sb.WriteString(declaration.name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeAttr(declaration.value))
+		sb.WriteString(`"`)
+	}
+	for _, a := range attrs {
+		sb.WriteString(" ")
+		if a.Name.Space != "" {
+			sb.WriteString(a.Name.Space)
+			sb.WriteString(":")
+		}
+		sb.WriteString(a.Name.Local)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeAttr(a.Value))
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(">")
+
+	for _, child := range e.children {
+		switch {
+		case child.element != nil:
+			if child.element != excluded {
+				child.element.renderCanonical(sb, renderedHere, inclusivePrefixes, excluded)
+			}
+		case child.procInst != nil:
+			sb.WriteString("<?")
+			sb.WriteString(child.procInst.Target)
+			if len(child.procInst.Inst) > 0 {
+				sb.WriteString(" ")
+				sb.Write(child.procInst.Inst)
+			}
+			sb.WriteString("?>")
+		default:
+			sb.WriteString(escapeText(child.text))
+		}
+	}
+
+	sb.WriteString("</")
+	sb.WriteString(name)
+	sb.WriteString(">")
+}
+
+func (e *xmlElement) attrNamespace(a xml.Attr) string {
+	if a.Name.Space == "" {
+		return ""
+	}
+	return e.namespaces[a.Name.Space]
+}
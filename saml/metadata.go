@@ -0,0 +1,85 @@
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+)
+
+type EntityDescriptor struct {
+	XMLName          xml.Name         `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityId         string           `xml:"entityID,attr"`
+	IdpSsoDescriptor IdpSsoDescriptor `xml:"IDPSSODescriptor"`
+}
+
+type IdpSsoDescriptor struct {
+	ProtocolSupportEnumeration string                `xml:"protocolSupportEnumeration,attr"`
+	WantAuthnRequestsSigned    bool                  `xml:"WantAuthnRequestsSigned,attr"`
+	KeyDescriptors             []KeyDescriptor       `xml:"KeyDescriptor"`
+	NameIdFormats              []string              `xml:"NameIDFormat"`
+	SingleSignOnServices       []SingleSignOnService `xml:"SingleSignOnService"`
+}
+
+type KeyDescriptor struct {
+	Use     string  `xml:"use,attr"`
+	KeyInfo KeyInfo `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+}
+
+type KeyInfo struct {
+	X509Certificate string `xml:"X509Data>X509Certificate"`
+}
+
+type SingleSignOnService struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+}
+
+type MetadataParams struct {
+	EntityId        string
+	SingleSignOnUrl string
+	// Certificates are the DER encoded certificates of every key the responses may be signed with.
+	Certificates [][]byte
+}
+
+// BuildMetadata creates the metadata of an identity provider supporting SP-initiated SSO.
+func BuildMetadata(params MetadataParams) ([]byte, error) {
+	keyDescriptors := make([]KeyDescriptor, 0, len(params.Certificates))
+	for _, certificate := range params.Certificates {
+		keyDescriptors = append(keyDescriptors, KeyDescriptor{
+			Use: "signing",
+			KeyInfo: KeyInfo{
+				X509Certificate: base64.StdEncoding.EncodeToString(certificate),
+			},
+		})
+	}
+
+	descriptor := EntityDescriptor{
+		EntityId: params.EntityId,
+		IdpSsoDescriptor: IdpSsoDescriptor{
+			ProtocolSupportEnumeration: NamespaceProtocol,
+			WantAuthnRequestsSigned:    false,
+			KeyDescriptors:             keyDescriptors,
+			NameIdFormats: []string{
+				NameIdFormatUnspecified,
+				NameIdFormatEmailAddress,
+				NameIdFormatPersistent,
+			},
+			SingleSignOnServices: []SingleSignOnService{
+				{
+					Binding:  BindingHttpRedirect,
+					Location: params.SingleSignOnUrl,
+				},
+				{
+					Binding:  BindingHttpPost,
+					Location: params.SingleSignOnUrl,
+				},
+			},
+		},
+	}
+
+	data, err := xml.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,187 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+const CanonicalizationExclusive = "http://www.w3.org/2001/10/xml-exc-c14n#"
+const TransformEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+const DigestSha256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+// SignatureRsaSha256 is the signature method every service provider supports, it is used for RSA keys.
+const SignatureRsaSha256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+
+// SignatureEd25519 is the EdDSA signature method from RFC 9231, it is used for ed25519 keys.
+const SignatureEd25519 = "http://www.w3.org/2021/04/xmldsig-more#eddsa-ed25519"
+
+const SubjectConfirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+const AuthnContextPasswordProtectedTransport = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+const AttributeNameFormatBasic = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+type ResponseParams struct {
+	ResponseId  string
+	AssertionId string
+
+	Issuer       string
+	Destination  string
+	Audience     string
+	InResponseTo string
+
+	NameId       string
+	NameIdFormat string
+
+	IssueInstant time.Time
+	ValidFor     time.Duration
+
+	Attributes []Attribute
+}
+
+// BuildResponse creates a successful response containing a single assertion signed with the given key.
+// The key is either an RSA or an ed25519 key, the certificate (DER) of the key is embedded in the signature.
+func BuildResponse(params ResponseParams, key crypto.Signer, certificate []byte) []byte {
+	assertion := buildAssertion(params)
+
+	signature := signElement(assertion, params.AssertionId, key, certificate)
+
+	// the signature of an assertion has to follow the issuer
+	assertion.insertChild(1, signature)
+
+	response := newElement("samlp:Response").
+		ns("samlp", NamespaceProtocol).
+		ns("saml", NamespaceAssertion).
+		attr("ID", params.ResponseId).
+		attr("Version", "2.0").
+		attr("IssueInstant", FormatTime(params.IssueInstant)).
+		attr("Destination", params.Destination)
+
+	if params.InResponseTo != "" {
+		response.attr("InResponseTo", params.InResponseTo)
+	}
+
+	response.child(
+		newElement("saml:Issuer").setText(params.Issuer),
+		newElement("samlp:Status").child(
+			newElement("samlp:StatusCode").attr("Value", StatusSuccess)),
+		assertion)
+
+	return []byte(response.String())
+}
+
+func buildAssertion(params ResponseParams) *element {
+	notOnOrAfter := FormatTime(params.IssueInstant.Add(params.ValidFor))
+
+	subjectConfirmationData := newElement("saml:SubjectConfirmationData").
+		attr("NotOnOrAfter", notOnOrAfter).
+		attr("Recipient", params.Destination)
+	if params.InResponseTo != "" {
+		subjectConfirmationData.attr("InResponseTo", params.InResponseTo)
+	}
+
+	assertion := newElement("saml:Assertion").
+		ns("saml", NamespaceAssertion).
+		attr("ID", params.AssertionId).
+		attr("Version", "2.0").
+		attr("IssueInstant", FormatTime(params.IssueInstant)).
+		child(
+			newElement("saml:Issuer").setText(params.Issuer),
+			newElement("saml:Subject").child(
+				newElement("saml:NameID").attr("Format", params.NameIdFormat).setText(params.NameId),
+				newElement("saml:SubjectConfirmation").attr("Method", SubjectConfirmationBearer).child(
+					subjectConfirmationData)),
+			newElement("saml:Conditions").
+				attr("NotBefore", FormatTime(params.IssueInstant)).
+				attr("NotOnOrAfter", notOnOrAfter).
+				child(newElement("saml:AudienceRestriction").child(
+					newElement("saml:Audience").setText(params.Audience))),
+			newElement("saml:AuthnStatement").
+				attr("AuthnInstant", FormatTime(params.IssueInstant)).
+				child(newElement("saml:AuthnContext").child(
+					newElement("saml:AuthnContextClassRef").setText(AuthnContextPasswordProtectedTransport))))
+
+	// an attribute statement must not be empty
+	if len(params.Attributes) > 0 {
+		attributeStatement := newElement("saml:AttributeStatement")
+		for _, attribute := range params.Attributes {
+			samlAttribute := newElement("saml:Attribute").
+				attr("Name", attribute.Name).
+				attr("NameFormat", AttributeNameFormatBasic)
+			for _, value := range attribute.Values {
+				samlAttribute.child(newElement("saml:AttributeValue").setText(value))
+			}
+			attributeStatement.child(samlAttribute)
+		}
+		assertion.child(attributeStatement)
+	}
+
+	return assertion
+}
+
+// signElement creates an enveloped signature for the element, which must not contain the signature yet.
+func signElement(signed *element, id string, key crypto.Signer, certificate []byte) *element {
+	digest := sha256.Sum256([]byte(signed.String()))
+
+	signatureMethod, hash := signatureMethodFor(key)
+
+	signedInfo := newElement("ds:SignedInfo").
+		ns("ds", NamespaceXmlDsig).
+		child(
+			newElement("ds:CanonicalizationMethod").attr("Algorithm", CanonicalizationExclusive),
+			newElement("ds:SignatureMethod").attr("Algorithm", signatureMethod),
+			newElement("ds:Reference").attr("URI", "#"+id).child(
+				newElement("ds:Transforms").child(
+					newElement("ds:Transform").attr("Algorithm", TransformEnvelopedSignature),
+					newElement("ds:Transform").attr("Algorithm", CanonicalizationExclusive)),
+				newElement("ds:DigestMethod").attr("Algorithm", DigestSha256),
+				newElement("ds:DigestValue").setText(base64.StdEncoding.EncodeToString(digest[:]))))
+
+	signatureValue := sign(key, hash, []byte(signedInfo.String()))
+
+	return newElement("ds:Signature").
+		ns("ds", NamespaceXmlDsig).
+		child(
+			signedInfo,
+			newElement("ds:SignatureValue").setText(base64.StdEncoding.EncodeToString(signatureValue)),
+			newElement("ds:KeyInfo").child(
+				newElement("ds:X509Data").child(
+					newElement("ds:X509Certificate").setText(base64.StdEncoding.EncodeToString(certificate)))))
+}
+
+// signatureMethodFor returns the signature method of the key and the hash that is signed with it.
+// Ed25519 signs the message itself, so there is no hash.
+func signatureMethodFor(key crypto.Signer) (string, crypto.Hash) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return SignatureRsaSha256, crypto.SHA256
+	case ed25519.PublicKey:
+		return SignatureEd25519, crypto.Hash(0)
+	default:
+		panic(fmt.Errorf("unsupported signing key type %T", key))
+	}
+}
+
+func sign(key crypto.Signer, hash crypto.Hash, message []byte) []byte {
+	signed := message
+	if hash != crypto.Hash(0) {
+		hasher := hash.New()
+		hasher.Write(message)
+		signed = hasher.Sum(nil)
+	}
+
+	signature, err := key.Sign(rand.Reader, signed, hash)
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
@@ -0,0 +1,130 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildTestResponse(key crypto.Signer) string {
+	response := BuildResponse(ResponseParams{
+		ResponseId:   "_response",
+		AssertionId:  "_assertion",
+		Issuer:       "https://idp.example.com",
+		Destination:  "https://sp.example.com/acs",
+		Audience:     "https://sp.example.com",
+		InResponseTo: "_request",
+		NameId:       "alice & bob",
+		NameIdFormat: NameIdFormatUnspecified,
+		IssueInstant: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ValidFor:     5 * time.Minute,
+		Attributes: []Attribute{
+			{Name: "role", Values: []string{"admin", "<user>"}},
+		},
+	}, key, []byte("certificate"))
+
+	return string(response)
+}
+
+func generateTestKey(t *testing.T) ed25519.PrivateKey {
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	return privateKey
+}
+
+func Test_BuildResponse_IsWellFormed(t *testing.T) {
+	// arrange
+	response := buildTestResponse(generateTestKey(t))
+
+	// act
+	var parsed struct {
+		Assertion struct {
+			Id     string `xml:"ID,attr"`
+			NameId string `xml:"Subject>NameID"`
+		} `xml:"Assertion"`
+	}
+	err := xml.Unmarshal([]byte(response), &parsed)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "_assertion", parsed.Assertion.Id)
+	assert.Equal(t, "alice & bob", parsed.Assertion.NameId)
+}
+
+func Test_BuildResponse_DigestMatchesAssertion(t *testing.T) {
+	// arrange
+	response := buildTestResponse(generateTestKey(t))
+
+	assertionStart := strings.Index(response, "<saml:Assertion")
+	assertionEnd := strings.Index(response, "</saml:Assertion>") + len("</saml:Assertion>")
+	assertion := response[assertionStart:assertionEnd]
+
+	signatureStart := strings.Index(assertion, "<ds:Signature")
+	signatureEnd := strings.Index(assertion, "</ds:Signature>") + len("</ds:Signature>")
+	withoutSignature := assertion[:signatureStart] + assertion[signatureEnd:]
+
+	// act
+	digest := sha256.Sum256([]byte(withoutSignature))
+
+	// assert
+	digestValue := regexp.MustCompile(`<ds:DigestValue>(.*?)</ds:DigestValue>`).FindStringSubmatch(response)[1]
+	assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), digestValue)
+}
+
+func Test_BuildResponse_SignatureIsValid(t *testing.T) {
+	// arrange
+	privateKey := generateTestKey(t)
+	response := buildTestResponse(privateKey)
+
+	signedInfo := regexp.MustCompile(`<ds:SignedInfo.*?</ds:SignedInfo>`).FindString(response)
+	signatureValue := regexp.MustCompile(`<ds:SignatureValue>(.*?)</ds:SignatureValue>`).FindStringSubmatch(response)[1]
+	signature, err := base64.StdEncoding.DecodeString(signatureValue)
+	assert.NoError(t, err)
+
+	// act
+	valid := ed25519.Verify(privateKey.Public().(ed25519.PublicKey), []byte(signedInfo), signature)
+
+	// assert
+	assert.Contains(t, signedInfo, SignatureEd25519)
+	assert.True(t, valid)
+}
+
+func Test_BuildResponse_RsaSignatureIsValid(t *testing.T) {
+	// arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	response := buildTestResponse(privateKey)
+
+	signedInfo := regexp.MustCompile(`<ds:SignedInfo.*?</ds:SignedInfo>`).FindString(response)
+	signatureValue := regexp.MustCompile(`<ds:SignatureValue>(.*?)</ds:SignatureValue>`).FindStringSubmatch(response)[1]
+	signature, err := base64.StdEncoding.DecodeString(signatureValue)
+	assert.NoError(t, err)
+
+	// act
+	hashed := sha256.Sum256([]byte(signedInfo))
+	err = rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, hashed[:], signature)
+
+	// assert
+	assert.Contains(t, signedInfo, SignatureRsaSha256)
+	assert.NoError(t, err)
+}
+
+func Test_Element_CanonicalAttributeOrder(t *testing.T) {
+	// arrange
+	e := newElement("a:b").attr("z", "1").ns("a", "urn:a").attr("b", `"<&>`)
+
+	// act
+	result := e.String()
+
+	// assert
+	assert.Equal(t, `<a:b xmlns:a="urn:a" b="&quot;&lt;&amp;>" z="1"></a:b>`, result)
+}
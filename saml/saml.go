@@ -0,0 +1,145 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+const NamespaceProtocol = "urn:oasis:names:tc:SAML:2.0:protocol"
+const NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+const NamespaceMetadata = "urn:oasis:names:tc:SAML:2.0:metadata"
+const NamespaceXmlDsig = "http://www.w3.org/2000/09/xmldsig#"
+
+const BindingHttpRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+const BindingHttpPost = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+const NameIdFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+const NameIdFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+const NameIdFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+const StatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+const maxMessageSize = 1024 * 1024
+
+// TimeFormat is the xs:dateTime format used for all timestamps, always in UTC.
+const TimeFormat = "2006-01-02T15:04:05Z"
+
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// maxClockSkew tolerates service providers with a clock that is slightly ahead.
+const maxClockSkew = time.Minute
+
+// ValidateIssueInstant fails for messages issued in the future or more than maxAge ago, so old messages can not be replayed.
+func ValidateIssueInstant(issueInstant string, now time.Time, maxAge time.Duration) error {
+	issuedAt, err := time.Parse(time.RFC3339, issueInstant)
+	if err != nil {
+		return fmt.Errorf("invalid issue instant '%s'", issueInstant)
+	}
+
+	if issuedAt.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("the message was issued in the future")
+	}
+	if issuedAt.Before(now.Add(-maxAge)) {
+		return fmt.Errorf("the message has expired")
+	}
+
+	return nil
+}
+
+// NewId generates a random identifier, which has to start with a letter or an underscore to be a valid xs:ID.
+func NewId() string {
+	idBytes := make([]byte, 20)
+	if _, err := rand.Read(idBytes); err != nil {
+		panic(err)
+	}
+	return "_" + hex.EncodeToString(idBytes)
+}
+
+type NameIdPolicy struct {
+	Format      string `xml:"Format,attr"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+type AuthnRequest struct {
+	XMLName                     xml.Name      `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	Id                          string        `xml:"ID,attr"`
+	Version                     string        `xml:"Version,attr"`
+	IssueInstant                string        `xml:"IssueInstant,attr"`
+	Destination                 string        `xml:"Destination,attr"`
+	AssertionConsumerServiceUrl string        `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string        `xml:"ProtocolBinding,attr"`
+	Issuer                      string        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIdPolicy                *NameIdPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+func ParseAuthnRequest(data []byte) (AuthnRequest, error) {
+	var request AuthnRequest
+	err := xml.Unmarshal(data, &request)
+	if err != nil {
+		return AuthnRequest{}, err
+	}
+
+	if request.Version != "2.0" {
+		return AuthnRequest{}, fmt.Errorf("unsupported SAML version '%s'", request.Version)
+	}
+	if request.Id == "" {
+		return AuthnRequest{}, fmt.Errorf("the request is missing an ID")
+	}
+	if request.Issuer == "" {
+		return AuthnRequest{}, fmt.Errorf("the request is missing an issuer")
+	}
+
+	return request, nil
+}
+
+// DecodeRedirectBinding decodes a message sent with the HTTP-Redirect binding, which is deflated and base64 encoded.
+func DecodeRedirectBinding(encoded string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMessageSize {
+		return nil, fmt.Errorf("the message is too large")
+	}
+
+	return data, nil
+}
+
+// EncodeRedirectBinding encodes a message for the HTTP-Redirect binding.
+func EncodeRedirectBinding(data []byte) (string, error) {
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// DecodePostBinding decodes a message sent with the HTTP-POST binding, which is only base64 encoded.
+func DecodePostBinding(encoded string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(encoded)
+}
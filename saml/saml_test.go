@@ -0,0 +1,102 @@
+package saml
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const testAuthnRequest = `<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_abc" Version="2.0" IssueInstant="2024-01-01T00:00:00Z" AssertionConsumerServiceURL="https://sp.example.com/acs" ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"><saml:Issuer>https://sp.example.com</saml:Issuer><samlp:NameIDPolicy Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress" AllowCreate="true"/></samlp:AuthnRequest>`
+
+func Test_RedirectBinding_RoundTrip(t *testing.T) {
+	// arrange
+	encoded, err := EncodeRedirectBinding([]byte(testAuthnRequest))
+	assert.NoError(t, err)
+
+	// act
+	decoded, err := DecodeRedirectBinding(encoded)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, testAuthnRequest, string(decoded))
+}
+
+func Test_DecodeRedirectBinding_InvalidBase64(t *testing.T) {
+	// arrange
+	encoded := "not base64!"
+
+	// act
+	_, err := DecodeRedirectBinding(encoded)
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_ParseAuthnRequest(t *testing.T) {
+	// arrange
+	data := []byte(testAuthnRequest)
+
+	// act
+	request, err := ParseAuthnRequest(data)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "_abc", request.Id)
+	assert.Equal(t, "https://sp.example.com", request.Issuer)
+	assert.Equal(t, "https://sp.example.com/acs", request.AssertionConsumerServiceUrl)
+	assert.Equal(t, BindingHttpPost, request.ProtocolBinding)
+	assert.Equal(t, NameIdFormatEmailAddress, request.NameIdPolicy.Format)
+}
+
+func Test_ParseAuthnRequest_MissingIssuer(t *testing.T) {
+	// arrange
+	data := []byte(`<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_abc" Version="2.0"></samlp:AuthnRequest>`)
+
+	// act
+	_, err := ParseAuthnRequest(data)
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_ParseAuthnRequest_WrongVersion(t *testing.T) {
+	// arrange
+	data := []byte(`<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_abc" Version="1.1"><saml:Issuer>sp</saml:Issuer></samlp:AuthnRequest>`)
+
+	// act
+	_, err := ParseAuthnRequest(data)
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_ValidateIssueInstant(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		issueInstant string
+		valid        bool
+	}{
+		{name: "recent", issueInstant: "2024-01-01T00:08:00Z", valid: true},
+		{name: "fractional seconds", issueInstant: "2024-01-01T00:08:00.123Z", valid: true},
+		{name: "slightly ahead", issueInstant: "2024-01-01T00:10:30Z", valid: true},
+		{name: "in the future", issueInstant: "2024-01-01T00:15:00Z", valid: false},
+		{name: "expired", issueInstant: "2024-01-01T00:00:00Z", valid: false},
+		{name: "malformed", issueInstant: "yesterday", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			err := ValidateIssueInstant(test.issueInstant, now, 5*time.Minute)
+
+			// assert
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
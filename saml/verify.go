@@ -0,0 +1,218 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrNotSigned = errors.New("the message is not signed")
+
+// ParseCertificate reads a certificate either PEM encoded or as the bare base64 DER found in metadata.
+func ParseCertificate(encoded string) (*x509.Certificate, error) {
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+
+	der, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// IsRedirectSigned reports whether a message sent with the HTTP-Redirect binding carries a signature in the query.
+func IsRedirectSigned(rawQuery string) bool {
+	query, err := url.ParseQuery(rawQuery)
+	return err == nil && query.Has("Signature")
+}
+
+// VerifyRedirectSignature checks the signature of a message sent with the HTTP-Redirect binding.
+// The signature covers the query parameters SAMLRequest, RelayState and SigAlg exactly as they were url encoded by the sender.
+func VerifyRedirectSignature(rawQuery string, publicKey crypto.PublicKey) error {
+	values := make(map[string]string)
+	for _, parameter := range strings.Split(rawQuery, "&") {
+		name, value, _ := strings.Cut(parameter, "=")
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("duplicate query parameter '%s'", name)
+		}
+		values[name] = value
+	}
+
+	samlRequest, ok := values["SAMLRequest"]
+	if !ok {
+		return fmt.Errorf("missing SAMLRequest")
+	}
+	encodedSignature, ok := values["Signature"]
+	if !ok {
+		return ErrNotSigned
+	}
+	encodedSigAlg, ok := values["SigAlg"]
+	if !ok {
+		return fmt.Errorf("missing SigAlg")
+	}
+
+	signed := "SAMLRequest=" + samlRequest
+	if relayState, ok := values["RelayState"]; ok {
+		signed += "&RelayState=" + relayState
+	}
+	signed += "&SigAlg=" + encodedSigAlg
+
+	sigAlg, err := url.QueryUnescape(encodedSigAlg)
+	if err != nil {
+		return err
+	}
+	signatureValue, err := url.QueryUnescape(encodedSignature)
+	if err != nil {
+		return err
+	}
+	signature, err := decodeBase64(signatureValue)
+	if err != nil {
+		return err
+	}
+
+	return verifySignature(publicKey, sigAlg, []byte(signed), signature)
+}
+
+// VerifyEnvelopedSignature checks the enveloped signature of a message sent with the HTTP-POST binding.
+// Only a signature referencing the root element is accepted, so no part of the message can be left unsigned.
+func VerifyEnvelopedSignature(data []byte, publicKey crypto.PublicKey) error {
+	root, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+
+	signatures := root.childElements(NamespaceXmlDsig, "Signature")
+	if len(signatures) == 0 {
+		return ErrNotSigned
+	}
+	if len(signatures) > 1 {
+		return fmt.Errorf("the message has more than one signature")
+	}
+	signature := signatures[0]
+
+	signedInfo, err := signature.singleChild(NamespaceXmlDsig, "SignedInfo")
+	if err != nil {
+		return err
+	}
+
+	canonicalizationMethod, err := signedInfo.singleChild(NamespaceXmlDsig, "CanonicalizationMethod")
+	if err != nil {
+		return err
+	}
+	if algorithm := canonicalizationMethod.attr("Algorithm"); algorithm != CanonicalizationExclusive {
+		return fmt.Errorf("unsupported canonicalization method '%s'", algorithm)
+	}
+
+	signatureMethod, err := signedInfo.singleChild(NamespaceXmlDsig, "SignatureMethod")
+	if err != nil {
+		return err
+	}
+
+	reference, err := signedInfo.singleChild(NamespaceXmlDsig, "Reference")
+	if err != nil {
+		return err
+	}
+	if id := root.attr("ID"); id == "" || reference.attr("URI") != "#"+id {
+		return fmt.Errorf("the signature does not reference the message")
+	}
+
+	// the enveloped signature is removed and the rest is canonicalized, any other transform could hide parts of the message
+	transforms, err := reference.singleChild(NamespaceXmlDsig, "Transforms")
+	if err != nil {
+		return err
+	}
+	transformList := transforms.childElements(NamespaceXmlDsig, "Transform")
+	if len(transformList) != 2 ||
+		transformList[0].attr("Algorithm") != TransformEnvelopedSignature ||
+		transformList[1].attr("Algorithm") != CanonicalizationExclusive {
+		return fmt.Errorf("unsupported transforms")
+	}
+
+	digestMethod, err := reference.singleChild(NamespaceXmlDsig, "DigestMethod")
+	if err != nil {
+		return err
+	}
+	if algorithm := digestMethod.attr("Algorithm"); algorithm != DigestSha256 {
+		return fmt.Errorf("unsupported digest method '%s'", algorithm)
+	}
+
+	digestValue, err := reference.singleChild(NamespaceXmlDsig, "DigestValue")
+	if err != nil {
+		return err
+	}
+	expectedDigest, err := decodeBase64(digestValue.textContent())
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(root.canonicalize(inclusivePrefixes(transformList[1]), signature)))
+	if !bytes.Equal(digest[:], expectedDigest) {
+		return fmt.Errorf("the digest does not match the message")
+	}
+
+	signatureValue, err := signature.singleChild(NamespaceXmlDsig, "SignatureValue")
+	if err != nil {
+		return err
+	}
+	signatureBytes, err := decodeBase64(signatureValue.textContent())
+	if err != nil {
+		return err
+	}
+
+	canonicalSignedInfo := signedInfo.canonicalize(inclusivePrefixes(canonicalizationMethod), nil)
+	return verifySignature(publicKey, signatureMethod.attr("Algorithm"), []byte(canonicalSignedInfo), signatureBytes)
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces PrefixList of an exclusive canonicalization method or transform.
+func inclusivePrefixes(method *xmlElement) []string {
+	inclusiveNamespaces := method.childElements(CanonicalizationExclusive, "InclusiveNamespaces")
+	if len(inclusiveNamespaces) == 0 {
+		return nil
+	}
+
+	prefixes := strings.Fields(inclusiveNamespaces[0].attr("PrefixList"))
+	for i, prefix := range prefixes {
+		if prefix == "#default" {
+			prefixes[i] = ""
+		}
+	}
+	return prefixes
+}
+
+func verifySignature(publicKey crypto.PublicKey, signatureMethod string, message []byte, signature []byte) error {
+	switch signatureMethod {
+	case SignatureRsaSha256:
+		rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("the signature method does not match the key")
+		}
+		hashed := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(rsaPublicKey, crypto.SHA256, hashed[:], signature)
+	case SignatureEd25519:
+		ed25519PublicKey, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("the signature method does not match the key")
+		}
+		if !ed25519.Verify(ed25519PublicKey, message, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signature method '%s'", signatureMethod)
+	}
+}
+
+// decodeBase64 decodes base64 that may be wrapped over several lines, as it usually is inside of xml.
+func decodeBase64(encoded string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+}
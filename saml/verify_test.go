@@ -0,0 +1,132 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func buildSignedAuthnRequest(key crypto.Signer) string {
+	request := newElement("samlp:AuthnRequest").
+		ns("samlp", NamespaceProtocol).
+		attr("ID", "_request").
+		attr("Version", "2.0").
+		attr("IssueInstant", "2024-01-01T00:00:00Z").
+		attr("AssertionConsumerServiceURL", "https://sp.example.com/acs").
+		child(
+			newElement("saml:Issuer").ns("saml", NamespaceAssertion).setText("https://sp.example.com"),
+			newElement("samlp:NameIDPolicy").attr("Format", NameIdFormatPersistent).attr("AllowCreate", "true"))
+
+	signature := signElement(request, "_request", key, []byte("certificate"))
+	request.insertChild(1, signature)
+
+	return request.String()
+}
+
+func Test_VerifyEnvelopedSignature(t *testing.T) {
+	// arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	request := buildSignedAuthnRequest(privateKey)
+
+	// act
+	err = VerifyEnvelopedSignature([]byte(request), &privateKey.PublicKey)
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func Test_VerifyEnvelopedSignature_NonCanonicalInput(t *testing.T) {
+	// arrange
+	privateKey := generateTestKey(t)
+	request := buildSignedAuthnRequest(privateKey)
+
+	// the same message as another serializer could have written it
+	request = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + request
+	request = strings.Replace(request, `AllowCreate="true" Format="`+NameIdFormatPersistent+`"></samlp:NameIDPolicy>`, `Format="`+NameIdFormatPersistent+`"  AllowCreate='true'/>`, 1)
+	request = strings.Replace(request, `<saml:Issuer xmlns:saml="`+NamespaceAssertion+`">`, `<!-- the issuer --><saml:Issuer>`, 1)
+	request = strings.Replace(request, `<samlp:AuthnRequest `, `<samlp:AuthnRequest xmlns:saml="`+NamespaceAssertion+`" `, 1)
+
+	// act
+	err := VerifyEnvelopedSignature([]byte(request), privateKey.Public())
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func Test_VerifyEnvelopedSignature_Tampered(t *testing.T) {
+	// arrange
+	privateKey := generateTestKey(t)
+	request := buildSignedAuthnRequest(privateKey)
+	request = strings.Replace(request, "https://sp.example.com/acs", "https://attacker.example.com/acs", 1)
+
+	// act
+	err := VerifyEnvelopedSignature([]byte(request), privateKey.Public())
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_VerifyEnvelopedSignature_WrongKey(t *testing.T) {
+	// arrange
+	request := buildSignedAuthnRequest(generateTestKey(t))
+
+	// act
+	err := VerifyEnvelopedSignature([]byte(request), generateTestKey(t).Public())
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_VerifyEnvelopedSignature_NotSigned(t *testing.T) {
+	// act
+	err := VerifyEnvelopedSignature([]byte(testAuthnRequest), generateTestKey(t).Public())
+
+	// assert
+	assert.ErrorIs(t, err, ErrNotSigned)
+}
+
+func Test_VerifyRedirectSignature(t *testing.T) {
+	// arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	encoded, err := EncodeRedirectBinding([]byte(testAuthnRequest))
+	assert.NoError(t, err)
+
+	signed := "SAMLRequest=" + url.QueryEscape(encoded) + "&RelayState=" + url.QueryEscape("state 1") + "&SigAlg=" + url.QueryEscape(SignatureRsaSha256)
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	assert.NoError(t, err)
+
+	rawQuery := signed + "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+
+	// act
+	err = VerifyRedirectSignature(rawQuery, &privateKey.PublicKey)
+	tampered := VerifyRedirectSignature(strings.Replace(rawQuery, "state+1", "state+2", 1), &privateKey.PublicKey)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Error(t, tampered)
+	assert.True(t, IsRedirectSigned(rawQuery))
+}
+
+func Test_VerifyRedirectSignature_NotSigned(t *testing.T) {
+	// arrange
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	// act
+	err = VerifyRedirectSignature("SAMLRequest=abc&RelayState=state", publicKey)
+
+	// assert
+	assert.ErrorIs(t, err, ErrNotSigned)
+	assert.False(t, IsRedirectSigned("SAMLRequest=abc&RelayState=state"))
+}
@@ -0,0 +1,381 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Filter is a parsed filter expression as described in https://datatracker.ietf.org/doc/html/rfc7644#section-3.4.2.2
+type Filter interface {
+	isFilter()
+}
+
+// AttributeExpression compares an attribute with a value, Value is nil for the "pr" operator.
+type AttributeExpression struct {
+	Path     string
+	Operator string
+	Value    any
+}
+
+type LogicalExpression struct {
+	Operator string
+	Left     Filter
+	Right    Filter
+}
+
+type NotExpression struct {
+	Filter Filter
+}
+
+// ValuePathExpression filters the values of a multi-valued attribute, e.g. emails[type eq "work"].
+type ValuePathExpression struct {
+	Path   string
+	Filter Filter
+}
+
+func (AttributeExpression) isFilter() {}
+func (LogicalExpression) isFilter()   {}
+func (NotExpression) isFilter()       {}
+func (ValuePathExpression) isFilter() {}
+
+const (
+	OperatorEqual      = "eq"
+	OperatorNotEqual   = "ne"
+	OperatorContains   = "co"
+	OperatorStartsWith = "sw"
+	OperatorEndsWith   = "ew"
+	OperatorGreater    = "gt"
+	OperatorLess       = "lt"
+	OperatorGreaterEq  = "ge"
+	OperatorLessEq     = "le"
+	OperatorPresent    = "pr"
+
+	OperatorAnd = "and"
+	OperatorOr  = "or"
+)
+
+var compareOperators = map[string]bool{
+	OperatorEqual:      true,
+	OperatorNotEqual:   true,
+	OperatorContains:   true,
+	OperatorStartsWith: true,
+	OperatorEndsWith:   true,
+	OperatorGreater:    true,
+	OperatorLess:       true,
+	OperatorGreaterEq:  true,
+	OperatorLessEq:     true,
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func invalidFilter(format string, args ...any) error {
+	return NewError(http.StatusBadRequest, ErrorTypeInvalidFilter, fmt.Sprintf(format, args...))
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenOpenBracket})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenCloseBracket})
+			i++
+		case r == '"':
+			end := i + 1
+			for ; end < len(runes); end++ {
+				if runes[end] == '\\' {
+					end++
+					continue
+				}
+				if runes[end] == '"' {
+					break
+				}
+			}
+			if end >= len(runes) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(string(runes[i:end+1])), &value); err != nil {
+				return nil, invalidFilter("invalid string %s", string(runes[i:end+1]))
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()[]"`, runes[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: string(runes[i:end])})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens   []token
+	position int
+}
+
+// ParseFilter parses the value of the filter query parameter.
+func ParseFilter(input string) (Filter, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, invalidFilter("the filter is empty")
+	}
+
+	parser := &filterParser{tokens: tokens}
+	filter, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position != len(parser.tokens) {
+		return nil, invalidFilter("unexpected token at position %d", parser.position)
+	}
+
+	return filter, nil
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.position >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.position], true
+}
+
+func (p *filterParser) next() (token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.position++
+	}
+	return t, ok
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+func (p *filterParser) expect(kind tokenKind, description string) error {
+	t, ok := p.next()
+	if !ok || t.kind != kind {
+		return invalidFilter("expected %s", description)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword(OperatorOr) {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = LogicalExpression{Operator: OperatorOr, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword(OperatorAnd) {
+		p.position++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = LogicalExpression{Operator: OperatorAnd, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.peekKeyword("not") {
+		p.position++
+		filter, err := p.parseParenthesized()
+		if err != nil {
+			return nil, err
+		}
+		return NotExpression{Filter: filter}, nil
+	}
+
+	if t, ok := p.peek(); ok && t.kind == tokenOpenParen {
+		return p.parseParenthesized()
+	}
+
+	return p.parseAttributeExpression()
+}
+
+func (p *filterParser) parseParenthesized() (Filter, error) {
+	if err := p.expect(tokenOpenParen, "'('"); err != nil {
+		return nil, err
+	}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenCloseParen, "')'"); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (p *filterParser) parseAttributeExpression() (Filter, error) {
+	t, ok := p.next()
+	if !ok || t.kind != tokenWord {
+		return nil, invalidFilter("expected an attribute")
+	}
+	path := NormalizeAttribute(t.value)
+
+	if next, ok := p.peek(); ok && next.kind == tokenOpenBracket {
+		p.position++
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenCloseBracket, "']'"); err != nil {
+			return nil, err
+		}
+		return ValuePathExpression{Path: path, Filter: filter}, nil
+	}
+
+	operatorToken, ok := p.next()
+	if !ok || operatorToken.kind != tokenWord {
+		return nil, invalidFilter("expected an operator after %s", path)
+	}
+	operator := strings.ToLower(operatorToken.value)
+
+	if operator == OperatorPresent {
+		return AttributeExpression{Path: path, Operator: operator}, nil
+	}
+	if !compareOperators[operator] {
+		return nil, invalidFilter("unsupported operator %s", operatorToken.value)
+	}
+
+	valueToken, ok := p.next()
+	if !ok {
+		return nil, invalidFilter("expected a value after %s %s", path, operator)
+	}
+
+	var value any
+	switch valueToken.kind {
+	case tokenString:
+		value = valueToken.value
+	case tokenWord:
+		switch strings.ToLower(valueToken.value) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			var number float64
+			if err := json.Unmarshal([]byte(valueToken.value), &number); err != nil {
+				return nil, invalidFilter("invalid value %s", valueToken.value)
+			}
+			value = number
+		}
+	default:
+		return nil, invalidFilter("expected a value after %s %s", path, operator)
+	}
+
+	return AttributeExpression{Path: path, Operator: operator, Value: value}, nil
+}
+
+// NormalizeAttribute removes the schema urn from fully qualified attribute names,
+// e.g. "urn:ietf:params:scim:schemas:core:2.0:User:userName" becomes "userName".
+func NormalizeAttribute(attribute string) string {
+	if strings.HasPrefix(strings.ToLower(attribute), "urn:") {
+		return attribute[strings.LastIndex(attribute, ":")+1:]
+	}
+	return attribute
+}
+
+// Equalities returns the compared values of a filter that only consists of "eq" comparisons joined by "and".
+// The attribute names are lowercased since attribute names are case-insensitive.
+// The second return value is false if the filter uses anything else.
+func Equalities(filter Filter) (map[string]any, bool) {
+	result := make(map[string]any)
+
+	var collect func(filter Filter) bool
+	collect = func(filter Filter) bool {
+		switch f := filter.(type) {
+		case AttributeExpression:
+			if f.Operator != OperatorEqual {
+				return false
+			}
+			key := strings.ToLower(f.Path)
+			if _, ok := result[key]; ok {
+				return false
+			}
+			result[key] = f.Value
+			return true
+		case LogicalExpression:
+			return f.Operator == OperatorAnd && collect(f.Left) && collect(f.Right)
+		case ValuePathExpression:
+			// emails[value eq "x"] is the same as emails.value eq "x"
+			inner, ok := f.Filter.(AttributeExpression)
+			if !ok {
+				return false
+			}
+			return collect(AttributeExpression{
+				Path:     f.Path + "." + inner.Path,
+				Operator: inner.Operator,
+				Value:    inner.Value,
+			})
+		default:
+			return false
+		}
+	}
+
+	if !collect(filter) {
+		return nil, false
+	}
+	return result, true
+}
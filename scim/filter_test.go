@@ -0,0 +1,134 @@
+package scim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_ParseFilter_Equal(t *testing.T) {
+	// act
+	filter, err := ParseFilter(`userName eq "bjensen"`)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, AttributeExpression{Path: "userName", Operator: OperatorEqual, Value: "bjensen"}, filter)
+}
+
+func Test_ParseFilter_Precedence(t *testing.T) {
+	// act
+	filter, err := ParseFilter(`title pr or userType eq "Employee" and active eq true`)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, LogicalExpression{
+		Operator: OperatorOr,
+		Left:     AttributeExpression{Path: "title", Operator: OperatorPresent},
+		Right: LogicalExpression{
+			Operator: OperatorAnd,
+			Left:     AttributeExpression{Path: "userType", Operator: OperatorEqual, Value: "Employee"},
+			Right:    AttributeExpression{Path: "active", Operator: OperatorEqual, Value: true},
+		},
+	}, filter)
+}
+
+func Test_ParseFilter_NotAndParentheses(t *testing.T) {
+	// act
+	filter, err := ParseFilter(`not (meta.version GE 2) AND (a eq null)`)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, LogicalExpression{
+		Operator: OperatorAnd,
+		Left:     NotExpression{Filter: AttributeExpression{Path: "meta.version", Operator: OperatorGreaterEq, Value: float64(2)}},
+		Right:    AttributeExpression{Path: "a", Operator: OperatorEqual, Value: nil},
+	}, filter)
+}
+
+func Test_ParseFilter_ValuePath(t *testing.T) {
+	// act
+	filter, err := ParseFilter(`emails[type eq "work" and value co "@example.com"]`)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, ValuePathExpression{
+		Path: "emails",
+		Filter: LogicalExpression{
+			Operator: OperatorAnd,
+			Left:     AttributeExpression{Path: "type", Operator: OperatorEqual, Value: "work"},
+			Right:    AttributeExpression{Path: "value", Operator: OperatorContains, Value: "@example.com"},
+		},
+	}, filter)
+}
+
+func Test_ParseFilter_FullyQualifiedAttribute(t *testing.T) {
+	// act
+	filter, err := ParseFilter(`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "a \"quoted\" name"`)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, AttributeExpression{Path: "userName", Operator: OperatorEqual, Value: `a "quoted" name`}, filter)
+}
+
+func Test_ParseFilter_Invalid(t *testing.T) {
+	tests := []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName is "bjensen"`,
+		`userName eq "bjensen`,
+		`(userName eq "bjensen"`,
+		`userName eq "bjensen" and`,
+		`userName eq bjensen`,
+		`emails[type eq "work"`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			// act
+			_, err := ParseFilter(input)
+
+			// assert
+			var scimErr Error
+			assert.ErrorAs(t, err, &scimErr)
+			assert.Equal(t, ErrorTypeInvalidFilter, scimErr.ScimType)
+		})
+	}
+}
+
+func Test_Equalities(t *testing.T) {
+	// arrange
+	filter, _ := ParseFilter(`userName eq "bjensen" and emails[value eq "bjensen@example.com"]`)
+
+	// act
+	equalities, ok := Equalities(filter)
+
+	// assert
+	assert.True(t, ok)
+	assert.Equal(t, map[string]any{
+		"username":     "bjensen",
+		"emails.value": "bjensen@example.com",
+	}, equalities)
+}
+
+func Test_Equalities_Unsupported(t *testing.T) {
+	tests := []string{
+		`userName eq "a" or userName eq "b"`,
+		`userName co "a"`,
+		`not (userName eq "a")`,
+		`userName eq "a" and userName eq "b"`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			// arrange
+			filter, err := ParseFilter(input)
+			assert.NoError(t, err)
+
+			// act
+			_, ok := Equalities(filter)
+
+			// assert
+			assert.False(t, ok)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+)
+
+// PatchRequest is the body of a PATCH request as described in https://datatracker.ietf.org/doc/html/rfc7644#section-3.5.2
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Path is the target of a patch operation, e.g. members[value eq "2819c223"] or emails[type eq "work"].value.
+type Path struct {
+	Attribute    string
+	Filter       Filter
+	SubAttribute string
+}
+
+func invalidPath(format string, args ...any) error {
+	return NewError(http.StatusBadRequest, ErrorTypeInvalidPath, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the schema and operations of the request and lowercases the operation names,
+// some providers send "Replace" instead of "replace".
+func (r *PatchRequest) Validate() error {
+	if !slices.Contains(r.Schemas, SchemaPatchOp) {
+		return NewError(http.StatusBadRequest, ErrorTypeInvalidSyntax, "the request has to use the PatchOp schema")
+	}
+	if len(r.Operations) == 0 {
+		return NewError(http.StatusBadRequest, ErrorTypeInvalidSyntax, "no operations")
+	}
+
+	for i := range r.Operations {
+		operation := &r.Operations[i]
+		operation.Op = strings.ToLower(operation.Op)
+
+		switch operation.Op {
+		case PatchOpAdd, PatchOpReplace:
+			if len(operation.Value) == 0 {
+				return NewError(http.StatusBadRequest, ErrorTypeInvalidValue, fmt.Sprintf("the %s operation requires a value", operation.Op))
+			}
+		case PatchOpRemove:
+			if operation.Path == "" {
+				return NewError(http.StatusBadRequest, ErrorTypeNoTarget, "the remove operation requires a path")
+			}
+		default:
+			return NewError(http.StatusBadRequest, ErrorTypeInvalidSyntax, fmt.Sprintf("unsupported operation '%s'", operation.Op))
+		}
+	}
+
+	return nil
+}
+
+// ParsePath parses the path of a patch operation.
+func ParsePath(input string) (Path, error) {
+	tokens, err := tokenize(input)
+	if err != nil || len(tokens) == 0 || tokens[0].kind != tokenWord {
+		return Path{}, invalidPath("invalid path '%s'", input)
+	}
+
+	path := Path{
+		Attribute: NormalizeAttribute(tokens[0].value),
+	}
+
+	if len(tokens) == 1 {
+		// name.givenName is a sub attribute, but urns contain dots as well so they have to be removed first
+		if attribute, subAttribute, ok := strings.Cut(path.Attribute, "."); ok {
+			path.Attribute = attribute
+			path.SubAttribute = subAttribute
+		}
+		return path, nil
+	}
+
+	if tokens[1].kind != tokenOpenBracket {
+		return Path{}, invalidPath("invalid path '%s'", input)
+	}
+
+	parser := &filterParser{tokens: tokens, position: 2}
+	path.Filter, err = parser.parseOr()
+	if err != nil {
+		return Path{}, invalidPath("invalid filter in path '%s'", input)
+	}
+	if err := parser.expect(tokenCloseBracket, "']'"); err != nil {
+		return Path{}, invalidPath("invalid path '%s'", input)
+	}
+
+	if t, ok := parser.next(); ok {
+		subAttribute, isSubAttribute := strings.CutPrefix(t.value, ".")
+		if t.kind != tokenWord || !isSubAttribute || subAttribute == "" {
+			return Path{}, invalidPath("invalid path '%s'", input)
+		}
+		path.SubAttribute = subAttribute
+	}
+	if parser.position != len(tokens) {
+		return Path{}, invalidPath("invalid path '%s'", input)
+	}
+
+	return path, nil
+}
+
+// Is checks whether the path targets the given attribute, attribute names are case-insensitive.
+func (p Path) Is(attribute string) bool {
+	return strings.EqualFold(p.Attribute, attribute)
+}
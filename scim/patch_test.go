@@ -0,0 +1,100 @@
+package scim
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_ParsePath(t *testing.T) {
+	tests := map[string]Path{
+		"userName":       {Attribute: "userName"},
+		"name.givenName": {Attribute: "name", SubAttribute: "givenName"},
+		"urn:ietf:params:scim:schemas:core:2.0:User:userName": {Attribute: "userName"},
+		`members[value eq "2819c223"]`: {
+			Attribute: "members",
+			Filter:    AttributeExpression{Path: "value", Operator: OperatorEqual, Value: "2819c223"},
+		},
+		`emails[type eq "work"].value`: {
+			Attribute:    "emails",
+			Filter:       AttributeExpression{Path: "type", Operator: OperatorEqual, Value: "work"},
+			SubAttribute: "value",
+		},
+	}
+
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			// act
+			path, err := ParsePath(input)
+
+			// assert
+			assert.NoError(t, err)
+			assert.Equal(t, expected, path)
+		})
+	}
+}
+
+func Test_ParsePath_Invalid(t *testing.T) {
+	tests := []string{
+		``,
+		`members[value eq "x"`,
+		`members[value eq "x"] value`,
+		`members value`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			// act
+			_, err := ParsePath(input)
+
+			// assert
+			var scimErr Error
+			assert.ErrorAs(t, err, &scimErr)
+			assert.Equal(t, ErrorTypeInvalidPath, scimErr.ScimType)
+		})
+	}
+}
+
+func Test_PatchRequest_Validate(t *testing.T) {
+	// arrange
+	var request PatchRequest
+	_ = json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": false},
+			{"op": "remove", "path": "emails"}
+		]
+	}`), &request)
+
+	// act
+	err := request.Validate()
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, PatchOpReplace, request.Operations[0].Op)
+	assert.Equal(t, PatchOpRemove, request.Operations[1].Op)
+}
+
+func Test_PatchRequest_Validate_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing schema":        `{"schemas": [], "Operations": [{"op": "add", "path": "a", "value": 1}]}`,
+		"no operations":         `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": []}`,
+		"unknown operation":     `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "move", "path": "a"}]}`,
+		"add without value":     `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "add", "path": "a"}]}`,
+		"remove without target": `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "remove"}]}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			// arrange
+			var request PatchRequest
+			_ = json.Unmarshal([]byte(body), &request)
+
+			// act
+			err := request.Validate()
+
+			// assert
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type User struct {
+	Schemas  []string         `json:"schemas"`
+	Id       string           `json:"id,omitempty"`
+	UserName string           `json:"userName"`
+	Active   *bool            `json:"active,omitempty"`
+	Emails   []Email          `json:"emails,omitempty"`
+	Groups   []GroupReference `json:"groups,omitempty"`
+	Meta     *Meta            `json:"meta,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type GroupReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	Id          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// PrimaryEmail returns the primary email of the user, or the first one if none is marked as primary.
+func (u *User) PrimaryEmail() (string, bool) {
+	for _, email := range u.Emails {
+		if email.Primary && email.Value != "" {
+			return email.Value, true
+		}
+	}
+	for _, email := range u.Emails {
+		if email.Value != "" {
+			return email.Value, true
+		}
+	}
+	return "", false
+}
+
+// IsActive returns whether the user is active, users are active unless stated otherwise.
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+func invalidValue(format string, args ...any) error {
+	return NewError(http.StatusBadRequest, ErrorTypeInvalidValue, fmt.Sprintf(format, args...))
+}
+
+func unmarshalValue[T any](raw json.RawMessage, attribute string) (T, error) {
+	var value T
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, invalidValue("invalid value for %s", attribute)
+	}
+	return value, nil
+}
+
+// unmarshalBool also accepts "True" and "False" as strings, which some providers send for boolean attributes.
+func unmarshalBool(raw json.RawMessage, attribute string) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		switch strings.ToLower(text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+
+	return false, invalidValue("invalid value for %s", attribute)
+}
+
+// unmarshalList accepts a single object as well as a list of objects for multi-valued attributes.
+func unmarshalList[T any](raw json.RawMessage, attribute string) ([]T, error) {
+	var values []T
+	if err := json.Unmarshal(raw, &values); err == nil {
+		return values, nil
+	}
+
+	value, err := unmarshalValue[T](raw, attribute)
+	if err != nil {
+		return nil, err
+	}
+	return []T{value}, nil
+}
+
+// splitValueObject turns an operation without a path into one operation per attribute of its value.
+func splitValueObject(operation PatchOperation) ([]PatchOperation, error) {
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+		return nil, invalidValue("operations without a path need an object as value")
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	operations := make([]PatchOperation, 0, len(attributes))
+	for _, key := range keys {
+		operations = append(operations, PatchOperation{
+			Op:    operation.Op,
+			Path:  key,
+			Value: attributes[key],
+		})
+	}
+	return operations, nil
+}
+
+// ApplyUserPatch applies validated patch operations to a user.
+// Attributes that are not stored, like name or title, are ignored so that provisioning clients keep working.
+func ApplyUserPatch(user *User, operations []PatchOperation) error {
+	for _, operation := range operations {
+		if operation.Path == "" {
+			split, err := splitValueObject(operation)
+			if err != nil {
+				return err
+			}
+			if err := ApplyUserPatch(user, split); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path, err := ParsePath(operation.Path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case path.Is("userName"):
+			if operation.Op == PatchOpRemove {
+				return NewError(http.StatusBadRequest, ErrorTypeMutability, "userName is required")
+			}
+			userName, err := unmarshalValue[string](operation.Value, "userName")
+			if err != nil {
+				return err
+			}
+			if userName == "" {
+				return invalidValue("userName is required")
+			}
+			user.UserName = userName
+		case path.Is("active"):
+			active := false
+			if operation.Op != PatchOpRemove {
+				active, err = unmarshalBool(operation.Value, "active")
+				if err != nil {
+					return err
+				}
+			}
+			user.Active = &active
+		case path.Is("emails"):
+			if operation.Op == PatchOpRemove {
+				user.Emails = nil
+				continue
+			}
+
+			if path.SubAttribute != "" {
+				if !strings.EqualFold(path.SubAttribute, "value") {
+					continue
+				}
+				value, err := unmarshalValue[string](operation.Value, "emails")
+				if err != nil {
+					return err
+				}
+				user.Emails = []Email{{Value: value, Primary: true}}
+				continue
+			}
+
+			emails, err := unmarshalList[Email](operation.Value, "emails")
+			if err != nil {
+				return err
+			}
+			if operation.Op == PatchOpAdd {
+				emails = append(emails, user.Emails...)
+			}
+			user.Emails = emails
+		}
+	}
+
+	return nil
+}
+
+// ApplyGroupPatch applies validated patch operations to a group.
+func ApplyGroupPatch(group *Group, operations []PatchOperation) error {
+	for _, operation := range operations {
+		if operation.Path == "" {
+			split, err := splitValueObject(operation)
+			if err != nil {
+				return err
+			}
+			if err := ApplyGroupPatch(group, split); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path, err := ParsePath(operation.Path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case path.Is("displayName"):
+			if operation.Op == PatchOpRemove {
+				return NewError(http.StatusBadRequest, ErrorTypeMutability, "displayName is required")
+			}
+			displayName, err := unmarshalValue[string](operation.Value, "displayName")
+			if err != nil {
+				return err
+			}
+			if displayName == "" {
+				return invalidValue("displayName is required")
+			}
+			group.DisplayName = displayName
+		case path.Is("members"):
+			err := applyMembersOperation(group, operation, path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyMembersOperation(group *Group, operation PatchOperation, path Path) error {
+	switch operation.Op {
+	case PatchOpAdd:
+		members, err := unmarshalList[Member](operation.Value, "members")
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if !slices.ContainsFunc(group.Members, func(m Member) bool { return m.Value == member.Value }) {
+				group.Members = append(group.Members, Member{Value: member.Value})
+			}
+		}
+	case PatchOpReplace:
+		members, err := unmarshalList[Member](operation.Value, "members")
+		if err != nil {
+			return err
+		}
+		group.Members = nil
+		for _, member := range members {
+			group.Members = append(group.Members, Member{Value: member.Value})
+		}
+	case PatchOpRemove:
+		switch {
+		case path.Filter != nil:
+			group.Members = slices.DeleteFunc(group.Members, func(m Member) bool {
+				return matchesMember(path.Filter, m)
+			})
+		case len(operation.Value) > 0:
+			// some providers send the members to remove as value instead of using a filter
+			members, err := unmarshalList[Member](operation.Value, "members")
+			if err != nil {
+				return err
+			}
+			group.Members = slices.DeleteFunc(group.Members, func(m Member) bool {
+				return slices.ContainsFunc(members, func(removed Member) bool { return removed.Value == m.Value })
+			})
+		default:
+			group.Members = nil
+		}
+	}
+
+	return nil
+}
+
+// matchesMember evaluates a value filter like [value eq "2819c223"] for a member.
+func matchesMember(filter Filter, member Member) bool {
+	switch f := filter.(type) {
+	case AttributeExpression:
+		var actual string
+		switch strings.ToLower(f.Path) {
+		case "value":
+			actual = member.Value
+		case "display":
+			actual = member.Display
+		default:
+			return false
+		}
+		expected, _ := f.Value.(string)
+		switch f.Operator {
+		case OperatorEqual:
+			return actual == expected
+		case OperatorNotEqual:
+			return actual != expected
+		case OperatorPresent:
+			return actual != ""
+		}
+		return false
+	case LogicalExpression:
+		if f.Operator == OperatorAnd {
+			return matchesMember(f.Left, member) && matchesMember(f.Right, member)
+		}
+		return matchesMember(f.Left, member) || matchesMember(f.Right, member)
+	case NotExpression:
+		return !matchesMember(f.Filter, member)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,119 @@
+package scim
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func parseOperations(t *testing.T, raw string) []PatchOperation {
+	var request PatchRequest
+	err := json.Unmarshal([]byte(raw), &request)
+	assert.NoError(t, err)
+	assert.NoError(t, request.Validate())
+	return request.Operations
+}
+
+func Test_ApplyUserPatch_WithoutPath(t *testing.T) {
+	// arrange
+	user := User{UserName: "jdoe"}
+	operations := parseOperations(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "value": {"active": "False", "userName": "john.doe", "title": "Engineer"}}]
+	}`)
+
+	// act
+	err := ApplyUserPatch(&user, operations)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "john.doe", user.UserName)
+	assert.False(t, user.IsActive())
+}
+
+func Test_ApplyUserPatch_EmailValuePath(t *testing.T) {
+	// arrange
+	user := User{UserName: "jdoe", Emails: []Email{{Value: "old@example.com", Primary: true}}}
+	operations := parseOperations(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "new@example.com"}]
+	}`)
+
+	// act
+	err := ApplyUserPatch(&user, operations)
+
+	// assert
+	assert.NoError(t, err)
+	email, ok := user.PrimaryEmail()
+	assert.True(t, ok)
+	assert.Equal(t, "new@example.com", email)
+}
+
+func Test_ApplyUserPatch_RemoveUserName(t *testing.T) {
+	// arrange
+	user := User{UserName: "jdoe"}
+	operations := parseOperations(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "userName"}]
+	}`)
+
+	// act
+	err := ApplyUserPatch(&user, operations)
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, ErrorTypeMutability, err.(Error).ScimType)
+}
+
+func Test_ApplyGroupPatch_Members(t *testing.T) {
+	// arrange
+	group := Group{DisplayName: "Engineering", Members: []Member{{Value: "a"}, {Value: "b"}}}
+	operations := parseOperations(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "add", "path": "members", "value": [{"value": "b"}, {"value": "c"}]},
+			{"op": "remove", "path": "members[value eq \"a\"]"},
+			{"op": "replace", "path": "displayName", "value": "Platform"}
+		]
+	}`)
+
+	// act
+	err := ApplyGroupPatch(&group, operations)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "Platform", group.DisplayName)
+	assert.Equal(t, []Member{{Value: "b"}, {Value: "c"}}, group.Members)
+}
+
+func Test_ApplyGroupPatch_RemoveMembersByValue(t *testing.T) {
+	// arrange
+	group := Group{DisplayName: "Engineering", Members: []Member{{Value: "a"}, {Value: "b"}}}
+	operations := parseOperations(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members", "value": [{"value": "a"}]}]
+	}`)
+
+	// act
+	err := ApplyGroupPatch(&group, operations)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []Member{{Value: "b"}}, group.Members)
+}
+
+func Test_ApplyGroupPatch_RemoveAllMembers(t *testing.T) {
+	// arrange
+	group := Group{DisplayName: "Engineering", Members: []Member{{Value: "a"}, {Value: "b"}}}
+	operations := parseOperations(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members"}]
+	}`)
+
+	// act
+	err := ApplyGroupPatch(&group, operations)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Empty(t, group.Members)
+}
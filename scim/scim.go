@@ -0,0 +1,138 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ContentType = "application/scim+json"
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+const (
+	ResourceTypeUser  = "User"
+	ResourceTypeGroup = "Group"
+)
+
+// ScimType values of errors, see https://datatracker.ietf.org/doc/html/rfc7644#section-3.12
+const (
+	ErrorTypeInvalidFilter = "invalidFilter"
+	ErrorTypeUniqueness    = "uniqueness"
+	ErrorTypeInvalidSyntax = "invalidSyntax"
+	ErrorTypeInvalidPath   = "invalidPath"
+	ErrorTypeNoTarget      = "noTarget"
+	ErrorTypeInvalidValue  = "invalidValue"
+	ErrorTypeMutability    = "mutability"
+)
+
+// Error is returned by the scim endpoints in the format described in https://datatracker.ietf.org/doc/html/rfc7644#section-3.12
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e Error) Error() string {
+	if e.ScimType == "" {
+		return e.Detail
+	}
+	return fmt.Sprintf("%s: %s", e.ScimType, e.Detail)
+}
+
+func NewError(status int, scimType string, detail string) Error {
+	return Error{
+		Status:   status,
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+type ErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// WriteHttpResponse writes the error in the scim format scim clients expect.
+func (e Error) WriteHttpResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(e.Status)
+	return json.NewEncoder(w).Encode(e.Response())
+}
+
+func (e Error) Response() ErrorResponse {
+	return ErrorResponse{
+		Schemas:  []string{SchemaError},
+		Status:   fmt.Sprint(e.Status),
+		ScimType: e.ScimType,
+		Detail:   e.Detail,
+	}
+}
+
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+	Version      string    `json:"version,omitempty"`
+}
+
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+func NewListResponse[T any](resources []T, totalResults int, startIndex int) ListResponse[T] {
+	if resources == nil {
+		resources = make([]T, 0)
+	}
+	return ListResponse[T]{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: totalResults,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// Version computes a weak etag from the json representation of a resource, so it changes whenever anything visible changes.
+// The meta version of the resource has to be empty when it is passed in.
+func Version(resource any) string {
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(raw)
+	return `W/"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// MatchesETag checks whether an If-Match or If-None-Match header value matches the version of a resource.
+// Etags are compared weakly as described in https://datatracker.ietf.org/doc/html/rfc9110#section-8.8.3.2
+func MatchesETag(header string, version string) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(version, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package scim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Version_ChangesWithResource(t *testing.T) {
+	// arrange
+	type resource struct {
+		UserName string `json:"userName"`
+	}
+
+	// act
+	first := Version(resource{UserName: "bjensen"})
+	same := Version(resource{UserName: "bjensen"})
+	changed := Version(resource{UserName: "jsmith"})
+
+	// assert
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, first)
+	assert.Equal(t, first, same)
+	assert.NotEqual(t, first, changed)
+}
+
+func Test_MatchesETag(t *testing.T) {
+	tests := map[string]bool{
+		`*`:                true,
+		`W/"abc"`:          true,
+		`"abc"`:            true,
+		`W/"xyz", W/"abc"`: true,
+		`W/"xyz"`:          false,
+		`W/"abcd", "ab"`:   false,
+	}
+
+	for header, expected := range tests {
+		t.Run(header, func(t *testing.T) {
+			// act
+			matches := MatchesETag(header, `W/"abc"`)
+
+			// assert
+			assert.Equal(t, expected, matches)
+		})
+	}
+}
+
+func Test_NewListResponse_EmptyResources(t *testing.T) {
+	// act
+	response := NewListResponse[string](nil, 3, 4)
+
+	// assert
+	assert.Equal(t, []string{SchemaListResponse}, response.Schemas)
+	assert.Equal(t, 3, response.TotalResults)
+	assert.Equal(t, 4, response.StartIndex)
+	assert.Equal(t, 0, response.ItemsPerPage)
+	assert.NotNil(t, response.Resources)
+}
+
+func Test_Error_WriteHttpResponse(t *testing.T) {
+	// arrange
+	w := httptest.NewRecorder()
+	err := Error{Status: http.StatusConflict, ScimType: ErrorTypeUniqueness, Detail: "userName is taken"}
+
+	// act
+	writeErr := err.WriteHttpResponse(w)
+
+	// assert
+	assert.NoError(t, writeErr)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"409","scimType":"uniqueness","detail":"userName is taken"}`, w.Body.String())
+}
@@ -6,9 +6,12 @@ import (
 	"github.com/gorilla/mux"
 	"holvit/config"
 	"holvit/handlers"
+	"holvit/handlers/account"
 	"holvit/handlers/api"
 	"holvit/handlers/auth"
 	"holvit/handlers/oidc"
+	"holvit/handlers/saml"
+	"holvit/handlers/scim"
 	"holvit/ioc"
 	"holvit/logging"
 	"holvit/middlewares"
@@ -47,30 +50,129 @@ func Serve(dp *ioc.DependencyProvider) {
 
 	r.HandleFunc(routes.OidcAuthorize.String(), oidc.Authorize).Methods("GET", "POST")
 	r.HandleFunc(routes.OidcToken.String(), oidc.Token).Methods("POST")
+	r.HandleFunc(routes.OidcToken.String(), oidc.Preflight).Methods("OPTIONS")
+	r.HandleFunc(routes.OidcBackchannelAuthentication.String(), oidc.BackchannelAuthentication).Methods("POST")
 	r.HandleFunc(routes.OidcUserInfo.String(), oidc.UserInfo).Methods("GET", "POST")
+	r.HandleFunc(routes.OidcUserInfo.String(), oidc.Preflight).Methods("OPTIONS")
 	r.HandleFunc(routes.OidcJwks.String(), oidc.Jwks)
 	r.HandleFunc(routes.OidcLogout.String(), oidc.EndSession)
 	r.HandleFunc(routes.WellKnown.String(), oidc.WellKnown)
+	r.HandleFunc(routes.OidcRegister.String(), oidc.RegisterClient).Methods("POST")
+	r.HandleFunc(routes.OidcRegisterClient.String(), oidc.ReadClientRegistration).Methods("GET")
+	r.HandleFunc(routes.OidcRegisterClient.String(), oidc.UpdateClientRegistration).Methods("PUT")
+	r.HandleFunc(routes.OidcRegisterClient.String(), oidc.DeleteClientRegistration).Methods("DELETE")
+
+	r.HandleFunc(routes.SamlMetadata.String(), saml.Metadata).Methods("GET")
+	r.HandleFunc(routes.SamlSingleSignOn.String(), saml.SingleSignOn).Methods("GET", "POST")
+
+	r.HandleFunc(routes.ScimServiceProviderConfig.String(), scim.ServiceProviderConfig).Methods("GET")
+	r.HandleFunc(routes.ScimUsers.String(), scim.FindUsers).Methods("GET")
+	r.HandleFunc(routes.ScimUsers.String(), scim.CreateUser).Methods("POST")
+	r.HandleFunc(routes.ScimUser.String(), scim.GetUser).Methods("GET")
+	r.HandleFunc(routes.ScimUser.String(), scim.ReplaceUser).Methods("PUT")
+	r.HandleFunc(routes.ScimUser.String(), scim.PatchUser).Methods("PATCH")
+	r.HandleFunc(routes.ScimUser.String(), scim.DeleteUser).Methods("DELETE")
+	r.HandleFunc(routes.ScimGroups.String(), scim.FindGroups).Methods("GET")
+	r.HandleFunc(routes.ScimGroups.String(), scim.CreateGroup).Methods("POST")
+	r.HandleFunc(routes.ScimGroup.String(), scim.GetGroup).Methods("GET")
+	r.HandleFunc(routes.ScimGroup.String(), scim.ReplaceGroup).Methods("PUT")
+	r.HandleFunc(routes.ScimGroup.String(), scim.PatchGroup).Methods("PATCH")
+	r.HandleFunc(routes.ScimGroup.String(), scim.DeleteGroup).Methods("DELETE")
 
 	r.HandleFunc(routes.ApiVerifyPassword.String(), auth.VerifyPassword).Methods("POST")
 	r.HandleFunc(routes.ApiResetPassword.String(), auth.ResetPassword).Methods("POST")
 	r.HandleFunc(routes.ApiTotpOnboarding.String(), auth.TotpOnboarding).Methods("POST")
 	r.HandleFunc(routes.ApiVerifyTotp.String(), auth.VerifyTotp).Methods("POST")
+	r.HandleFunc(routes.ApiVerifyRecoveryCode.String(), auth.VerifyRecoveryCode).Methods("POST")
 	r.HandleFunc(routes.ApiVerifyDevice.String(), auth.VerifyDevice).Methods("POST")
+	r.HandleFunc(routes.ApiResendDeviceVerification.String(), auth.ResendDeviceVerification).Methods("POST")
 	r.HandleFunc(routes.ApiGetOnboardingTotp.String(), auth.GetOnboardingTotp).Methods("POST")
+	r.HandleFunc(routes.ApiGetWebauthnOptions.String(), auth.GetWebauthnOptions).Methods("POST")
+	r.HandleFunc(routes.ApiWebauthnOnboarding.String(), auth.WebauthnOnboarding).Methods("POST")
+	r.HandleFunc(routes.ApiVerifyWebauthn.String(), auth.VerifyWebauthn).Methods("POST")
+	r.HandleFunc(routes.ApiStartEmailLogin.String(), auth.StartEmailLogin).Methods("POST")
+	r.HandleFunc(routes.ApiVerifyEmailLogin.String(), auth.VerifyEmailLogin).Methods("POST")
+	r.HandleFunc(routes.ApiRegister.String(), auth.Register).Methods("POST")
+	r.HandleFunc(routes.ApiVerifyRegistration.String(), auth.VerifyRegistration).Methods("POST")
+	r.HandleFunc(routes.ApiForgotPassword.String(), auth.ForgotPassword).Methods("POST")
+	r.HandleFunc(routes.ApiCompletePasswordReset.String(), auth.CompletePasswordReset).Methods("POST")
 
 	r.HandleFunc(routes.AuthorizeGrant.String(), auth.AuthorizeGrant).Methods("POST")
 	r.HandleFunc(routes.AuthVerifyEmail.String(), auth.VerifyEmail).Methods("GET")
 	r.HandleFunc(routes.LoginComplete.String(), auth.CompleteAuthFlow).Methods("POST")
-	//TODO: r.HandleFunc(routes.ApiResendEmailVerification.String(), auth.ResendEmailVerification).Methods("POST")
-
+	r.HandleFunc(routes.AuthMagicLink.String(), auth.MagicLinkLogin).Methods("GET")
+	r.HandleFunc(routes.AuthResetPassword.String(), auth.PasswordResetPage).Methods("GET")
+	r.HandleFunc(routes.AuthCiba.String(), auth.CibaDecision).Methods("GET")
+	r.HandleFunc(routes.AuthCiba.String(), auth.DecideCiba).Methods("POST")
+	r.HandleFunc(routes.AuthBrokerLogin.String(), auth.BrokerLogin).Methods("GET")
+	r.HandleFunc(routes.AuthBrokerCallback.String(), auth.BrokerCallback).Methods("GET")
+	r.HandleFunc(routes.ApiResendEmailVerification.String(), auth.ResendEmailVerification).Methods("POST")
+	r.HandleFunc(routes.ApiContinueEmailVerification.String(), auth.ContinueEmailVerification).Methods("POST")
+
+	r.HandleFunc(routes.ApiFindConsents.String(), account.FindConsents).Methods("GET")
+	r.HandleFunc(routes.ApiRevokeConsent.String(), account.RevokeConsent).Methods("DELETE")
+
+	r.HandleFunc(routes.ReconcileRealms.String(), api.ReconcileRealms).Methods("POST")
 	r.HandleFunc(routes.FindRealms.String(), api.FindRealms).Methods("GET")
+	r.HandleFunc(routes.ImportRealm.String(), api.ImportRealm).Methods("POST")
+	r.HandleFunc(routes.UpdateRealm.String(), api.UpdateRealm).Methods("PATCH")
+	r.HandleFunc(routes.ExportRealm.String(), api.ExportRealm).Methods("GET")
 
 	r.HandleFunc(routes.CreateUser.String(), api.CreateUser).Methods("POST")
 	r.HandleFunc(routes.FindUsers.String(), api.FindUsers).Methods("GET")
+	r.HandleFunc(routes.ImportUsers.String(), api.ImportUsers).Methods("POST")
+	r.HandleFunc(routes.ApproveUser.String(), api.ApproveUser).Methods("POST")
+	r.HandleFunc(routes.FindUserGroups.String(), api.FindUserGroups).Methods("GET")
+
+	r.HandleFunc(routes.FindUserConsents.String(), api.FindUserConsents).Methods("GET")
+	r.HandleFunc(routes.RevokeUserConsent.String(), api.RevokeUserConsent).Methods("DELETE")
+
+	r.HandleFunc(routes.CreateClient.String(), api.CreateClient).Methods("POST")
+	r.HandleFunc(routes.FindClients.String(), api.FindClients).Methods("GET")
+	r.HandleFunc(routes.UpdateClient.String(), api.UpdateClient).Methods("PATCH")
+
+	r.HandleFunc(routes.FindClientRoles.String(), api.FindClientRoles).Methods("GET")
+	r.HandleFunc(routes.GrantClientRole.String(), api.GrantClientRole).Methods("POST")
+	r.HandleFunc(routes.RevokeClientRole.String(), api.RevokeClientRole).Methods("DELETE")
+
+	r.HandleFunc(routes.CreateGroup.String(), api.CreateGroup).Methods("POST")
+	r.HandleFunc(routes.FindGroups.String(), api.FindGroups).Methods("GET")
+	r.HandleFunc(routes.UpdateGroup.String(), api.UpdateGroup).Methods("PATCH")
+	r.HandleFunc(routes.DeleteGroup.String(), api.DeleteGroup).Methods("DELETE")
+	r.HandleFunc(routes.FindGroupRoles.String(), api.FindGroupRoles).Methods("GET")
+	r.HandleFunc(routes.SetGroupRoles.String(), api.SetGroupRoles).Methods("PUT")
+	r.HandleFunc(routes.FindGroupMembers.String(), api.FindGroupMembers).Methods("GET")
+	r.HandleFunc(routes.AddGroupMember.String(), api.AddGroupMember).Methods("PUT")
+	r.HandleFunc(routes.RemoveGroupMember.String(), api.RemoveGroupMember).Methods("DELETE")
 
 	r.HandleFunc(routes.FindScopes.String(), api.FindScopes).Methods("GET")
 
+	r.HandleFunc(routes.CreateInitialAccessToken.String(), api.CreateInitialAccessToken).Methods("POST")
+	r.HandleFunc(routes.FindInitialAccessTokens.String(), api.FindInitialAccessTokens).Methods("GET")
+	r.HandleFunc(routes.DeleteInitialAccessToken.String(), api.DeleteInitialAccessToken).Methods("DELETE")
+
+	r.HandleFunc(routes.CreateIdentityProvider.String(), api.CreateIdentityProvider).Methods("POST")
+	r.HandleFunc(routes.FindIdentityProviders.String(), api.FindIdentityProviders).Methods("GET")
+	r.HandleFunc(routes.UpdateIdentityProvider.String(), api.UpdateIdentityProvider).Methods("PATCH")
+	r.HandleFunc(routes.DeleteIdentityProvider.String(), api.DeleteIdentityProvider).Methods("DELETE")
+
+	r.HandleFunc(routes.CreateAuthenticationFlow.String(), api.CreateAuthenticationFlow).Methods("POST")
+	r.HandleFunc(routes.FindAuthenticationFlows.String(), api.FindAuthenticationFlows).Methods("GET")
+	r.HandleFunc(routes.UpdateAuthenticationFlow.String(), api.UpdateAuthenticationFlow).Methods("PATCH")
+	r.HandleFunc(routes.DeleteAuthenticationFlow.String(), api.DeleteAuthenticationFlow).Methods("DELETE")
+
+	r.HandleFunc(routes.FindLockouts.String(), api.FindLockouts).Methods("GET")
+	r.HandleFunc(routes.ClearUserLockout.String(), api.ClearUserLockout).Methods("DELETE")
+	r.HandleFunc(routes.ClearIpLockout.String(), api.ClearIpLockout).Methods("DELETE")
+
+	r.HandleFunc(routes.FindSecurityEvents.String(), api.FindSecurityEvents).Methods("GET")
+
+	r.HandleFunc(routes.CreateLdapProvider.String(), api.CreateLdapProvider).Methods("POST")
+	r.HandleFunc(routes.FindLdapProviders.String(), api.FindLdapProviders).Methods("GET")
+	r.HandleFunc(routes.UpdateLdapProvider.String(), api.UpdateLdapProvider).Methods("PATCH")
+	r.HandleFunc(routes.DeleteLdapProvider.String(), api.DeleteLdapProvider).Methods("DELETE")
+	r.HandleFunc(routes.SyncLdapProvider.String(), api.SyncLdapProvider).Methods("POST")
+
 	registerStatics(r)
 
 	srv := &http.Server{
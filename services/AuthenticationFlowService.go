@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/authflow"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"slices"
+)
+
+// DefaultAuthenticationFlow is used by realms and clients without an authentication flow of their own.
+// The user signs in with any of the identification steps, the other steps only run when they apply to the user.
+// Users with more than one second factor only need one of them, signing in with webauthn already counts as one.
+// A recovery code can be used instead of any second factor.
+var DefaultAuthenticationFlow = []authflow.Execution{
+	{Step: constants.AuthenticateStepVerifyPassword, Requirement: authflow.RequirementAlternative},
+	{Step: constants.AuthenticateStepVerifyWebauthn, Requirement: authflow.RequirementAlternative},
+	{Step: constants.AuthenticateStepVerifyEmailLogin, Requirement: authflow.RequirementAlternative},
+	{Step: constants.AuthenticateStepVerifyRegistration, Requirement: authflow.RequirementAlternative},
+	{Step: constants.AuthenticateStepBrokerLogin, Requirement: authflow.RequirementAlternative},
+	{Step: constants.AuthenticateStepVerifyEmail, Requirement: authflow.RequirementRequired},
+	{Step: constants.AuthenticateStepResetPassword, Requirement: authflow.RequirementRequired},
+	{Step: constants.AuthenticateStepTotpOnboarding, Requirement: authflow.RequirementRequired},
+	{Requirement: authflow.RequirementRequired, Flow: []authflow.Execution{
+		{Step: constants.AuthenticateStepVerifyTotp, Requirement: authflow.RequirementAlternative},
+		{Step: constants.AuthenticateStepVerifyWebauthn, Requirement: authflow.RequirementAlternative},
+		{Step: constants.AuthenticateStepVerifyRecoveryCode, Requirement: authflow.RequirementAlternative},
+	}},
+	{Step: constants.AuthenticateStepWebauthnOnboarding, Requirement: authflow.RequirementRequired},
+	{Step: constants.AuthenticateStepVerifyDevice, Requirement: authflow.RequirementRequired},
+}
+
+type CreateAuthenticationFlowRequest struct {
+	RealmId    uuid.UUID
+	Name       string
+	Executions []authflow.Execution
+}
+
+type UpdateAuthenticationFlowRequest struct {
+	Name       h.Opt[string]
+	Executions h.Opt[[]authflow.Execution]
+}
+
+type AuthenticationFlowService interface {
+	CreateAuthenticationFlow(ctx context.Context, request CreateAuthenticationFlowRequest) h.Result[uuid.UUID]
+	UpdateAuthenticationFlow(ctx context.Context, id uuid.UUID, request UpdateAuthenticationFlowRequest) h.UResult
+	// FindFlowForLogin returns the id of the flow of a login to the client, uuid.Nil stands for the DefaultAuthenticationFlow.
+	FindFlowForLogin(ctx context.Context, realmId uuid.UUID, clientId string) uuid.UUID
+	GetExecutions(ctx context.Context, flowId uuid.UUID) []authflow.Execution
+}
+
+type authenticationFlowServiceImpl struct{}
+
+func NewAuthenticationFlowService() AuthenticationFlowService {
+	return &authenticationFlowServiceImpl{}
+}
+
+func (a *authenticationFlowServiceImpl) CreateAuthenticationFlow(ctx context.Context, request CreateAuthenticationFlowRequest) h.Result[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+
+	err := validateAuthenticationFlow(request.Executions)
+	if err != nil {
+		return h.Err[uuid.UUID](err)
+	}
+
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	return authenticationFlowRepository.CreateAuthenticationFlow(ctx, repos.AuthenticationFlow{
+		RealmId:    request.RealmId,
+		Name:       request.Name,
+		Executions: request.Executions,
+	})
+}
+
+func (a *authenticationFlowServiceImpl) UpdateAuthenticationFlow(ctx context.Context, id uuid.UUID, request UpdateAuthenticationFlowRequest) h.UResult {
+	scope := middlewares.GetScope(ctx)
+
+	executions := h.None[repos.AuthenticationFlowExecutions]()
+	if x, ok := request.Executions.Get(); ok {
+		err := validateAuthenticationFlow(x)
+		if err != nil {
+			return h.UErr(err)
+		}
+		executions = h.Some(repos.AuthenticationFlowExecutions(x))
+	}
+
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	return authenticationFlowRepository.UpdateAuthenticationFlow(ctx, id, repos.AuthenticationFlowUpdate{
+		Name:       request.Name,
+		Executions: executions,
+	})
+}
+
+func (a *authenticationFlowServiceImpl) FindFlowForLogin(ctx context.Context, realmId uuid.UUID, clientId string) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+
+	if clientId != "" {
+		clientRepository := ioc.Get[repos.ClientRepository](scope)
+		client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+			RealmId:  h.Some(realmId),
+			ClientId: h.Some(clientId),
+		}).SingleOrNone().Get()
+		if ok {
+			if flowId, ok := client.AuthenticationFlowId.Get(); ok {
+				return flowId
+			}
+		}
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, realmId).Unwrap()
+
+	return realm.AuthenticationFlowId.UnwrapOrEmpty()
+}
+
+func (a *authenticationFlowServiceImpl) GetExecutions(ctx context.Context, flowId uuid.UUID) []authflow.Execution {
+	scope := middlewares.GetScope(ctx)
+
+	if flowId == uuid.Nil {
+		return DefaultAuthenticationFlow
+	}
+
+	// the flow may have been deleted while the login was running
+	authenticationFlowRepository := ioc.Get[repos.AuthenticationFlowRepository](scope)
+	flow, ok := authenticationFlowRepository.FindAuthenticationFlowById(ctx, flowId).Get()
+	if !ok {
+		return DefaultAuthenticationFlow
+	}
+
+	return flow.Executions
+}
+
+// validateAuthenticationFlow checks the executions and makes sure that every login starts by finding out who signs in.
+func validateAuthenticationFlow(executions []authflow.Execution) error {
+	err := authflow.Validate(executions, authflow.ValidationOptions{
+		Steps:      constants.AuthenticationFlowSteps,
+		Conditions: constants.AuthenticationFlowConditions,
+	})
+	if err != nil {
+		return httpErrors.BadRequest().WithMessage(err.Error())
+	}
+
+	result, err := authflow.Evaluate(executions, unidentifiedLoginState{})
+	if err != nil {
+		return err
+	}
+	if result.Complete {
+		return httpErrors.BadRequest().WithMessage("the flow has to contain an identification step")
+	}
+	for _, step := range result.Steps {
+		if !slices.Contains(constants.IdentificationSteps, step) {
+			return httpErrors.BadRequest().WithMessage(
+				fmt.Sprintf("the flow has to start with identification steps, but '%s' can run before the user is known", step))
+		}
+	}
+
+	return nil
+}
+
+// unidentifiedLoginState is a login that just started.
+type unidentifiedLoginState struct{}
+
+func (unidentifiedLoginState) IsCompleted(string) bool {
+	return false
+}
+
+func (unidentifiedLoginState) IsIdentified() bool {
+	return false
+}
+
+func (unidentifiedLoginState) NeedsToRun(string) (bool, error) {
+	return true, nil
+}
+
+func (unidentifiedLoginState) Condition(string) (bool, error) {
+	return false, nil
+}
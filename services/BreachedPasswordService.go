@@ -0,0 +1,48 @@
+package services
+
+import (
+	"holvit/breachcorpus"
+	"holvit/h"
+	"holvit/logging"
+)
+
+type BreachedPasswordService interface {
+	// GetBreachCount returns how often the password appeared in known data breaches.
+	// It is none if no breach corpus is configured.
+	GetBreachCount(password string) h.Opt[int]
+}
+
+type breachedPasswordServiceImpl struct {
+	corpus *breachcorpus.Corpus
+}
+
+// NewBreachedPasswordService opens the breach corpus at the path, breached passwords are not checked if the path is empty.
+func NewBreachedPasswordService(corpusPath string) BreachedPasswordService {
+	if corpusPath == "" {
+		logging.Logger.Info("No breach corpus configured, breached passwords are not checked")
+		return &breachedPasswordServiceImpl{}
+	}
+
+	corpus, err := breachcorpus.Open(corpusPath)
+	if err != nil {
+		panic(err)
+	}
+
+	logging.Logger.Infof("Loaded breach corpus with %d hashes", corpus.Len())
+	return &breachedPasswordServiceImpl{
+		corpus: corpus,
+	}
+}
+
+func (s *breachedPasswordServiceImpl) GetBreachCount(password string) h.Opt[int] {
+	if s.corpus == nil {
+		return h.None[int]()
+	}
+
+	count, err := s.corpus.Count(password)
+	if err != nil {
+		panic(err)
+	}
+
+	return h.Some(count)
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/utils"
+	"strings"
+	"time"
+)
+
+const bruteForceKeyPrefix = "bruteForce"
+const bruteForceKindUser = "user"
+const bruteForceKindIp = "ip"
+
+// LoginAttempt is a single try to prove the identity of a user, e.g. with a password or a totp code.
+type LoginAttempt struct {
+	RealmId uuid.UUID
+	// UserId is uuid.Nil if no user was found, then only the ip address is tracked.
+	UserId uuid.UUID
+	Ip     string
+}
+
+// Lockout is a user or an ip address that cannot sign in at the moment, exactly one of UserId and Ip is set.
+type Lockout struct {
+	UserId      h.Opt[uuid.UUID]
+	Ip          h.Opt[string]
+	Failures    int
+	LockedUntil time.Time
+	// Permanent lockouts only end when an admin clears them.
+	Permanent bool
+}
+
+// bruteForceInfo counts the failed attempts of a user or an ip address.
+type bruteForceInfo struct {
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"lastFailureAt"`
+	LockedUntil   time.Time `json:"lockedUntil"`
+	Lockouts      int       `json:"lockouts"`
+	Permanent     bool      `json:"permanent"`
+}
+
+type BruteForceService interface {
+	// CheckAttempt fails if the user or the ip address is locked out or has to wait before trying again.
+	CheckAttempt(ctx context.Context, attempt LoginAttempt) error
+	RecordFailure(ctx context.Context, attempt LoginAttempt)
+	// RecordSuccess resets the failures of the user once a login completed all of its steps, the failures of
+	// the ip address are kept so that an attacker cannot reset them with an account of their own.
+	RecordSuccess(ctx context.Context, attempt LoginAttempt)
+
+	FindLockouts(ctx context.Context, realmId uuid.UUID) []Lockout
+	ClearUserLockout(ctx context.Context, realmId uuid.UUID, userId uuid.UUID, requestIp string) bool
+	ClearIpLockout(ctx context.Context, realmId uuid.UUID, ip string, requestIp string) bool
+}
+
+type bruteForceServiceImpl struct{}
+
+func NewBruteForceService() BruteForceService {
+	return &bruteForceServiceImpl{}
+}
+
+func (b *bruteForceServiceImpl) CheckAttempt(ctx context.Context, attempt LoginAttempt) error {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, attempt.RealmId).Unwrap()
+	if !realm.BruteForceProtection {
+		return nil
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	if attempt.UserId != uuid.Nil {
+		info, _ := b.getInfo(ctx, bruteForceKey(realm.Id, bruteForceKindUser, attempt.UserId.String())).Get()
+		if info.Permanent {
+			return httpErrors.Forbidden().WithMessage("the account is locked, please contact an administrator")
+		}
+		err := checkBruteForceInfo(info, realm, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	info, _ := b.getInfo(ctx, bruteForceKey(realm.Id, bruteForceKindIp, attempt.Ip)).Get()
+	return checkBruteForceInfo(info, realm, now)
+}
+
+func checkBruteForceInfo(info bruteForceInfo, realm repos.Realm, now time.Time) error {
+	if now.Before(info.LockedUntil) {
+		return httpErrors.TooManyRequests().WithMessage("too many failed attempts, please try again later")
+	}
+
+	if info.Failures > 0 && now.Before(info.LastFailureAt.Add(bruteForceDelay(info.Failures, realm.BruteForceMaxDelaySeconds))) {
+		return httpErrors.TooManyRequests().WithMessage("please wait before trying again")
+	}
+
+	return nil
+}
+
+// bruteForceDelay starts at one second after the first failure and doubles with every further failure.
+func bruteForceDelay(failures int, maxDelaySeconds int) time.Duration {
+	maxDelay := time.Duration(maxDelaySeconds) * time.Second
+	if failures > 31 {
+		return maxDelay
+	}
+	return min(time.Second<<(failures-1), maxDelay)
+}
+
+func (b *bruteForceServiceImpl) RecordFailure(ctx context.Context, attempt LoginAttempt) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, attempt.RealmId).Unwrap()
+	if !realm.BruteForceProtection {
+		return
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+	lockedUntil := now.Add(time.Duration(realm.BruteForceLockoutSeconds) * time.Second)
+
+	var securityEvents []repos.SecurityEvent
+
+	if attempt.UserId != uuid.Nil {
+		key := bruteForceKey(realm.Id, bruteForceKindUser, attempt.UserId.String())
+		result := b.recordFailure(ctx, key, realm.BruteForceMaxFailures, realm.BruteForcePermanentLockoutAfter.OrDefault(0), now, lockedUntil)
+
+		if result.lockedOut {
+			eventType := constants.SecurityEventTemporaryLockout
+			details := fmt.Sprintf("locked until %s after %d failed attempts", lockedUntil.Format(time.RFC3339), realm.BruteForceMaxFailures)
+
+			if result.permanent {
+				eventType = constants.SecurityEventPermanentLockout
+				details = fmt.Sprintf("locked until an admin unlocks the account after %d lockouts", result.lockouts)
+			}
+
+			securityEvents = append(securityEvents, repos.SecurityEvent{
+				RealmId:   realm.Id,
+				UserId:    h.Some(attempt.UserId),
+				Type:      eventType,
+				IpAddress: attempt.Ip,
+				Details:   details,
+			})
+		}
+	}
+
+	key := bruteForceKey(realm.Id, bruteForceKindIp, attempt.Ip)
+	result := b.recordFailure(ctx, key, realm.BruteForceIpMaxFailures, 0, now, lockedUntil)
+
+	if result.lockedOut {
+		securityEvents = append(securityEvents, repos.SecurityEvent{
+			RealmId:   realm.Id,
+			UserId:    h.None[uuid.UUID](),
+			Type:      constants.SecurityEventIpLockout,
+			IpAddress: attempt.Ip,
+			Details:   fmt.Sprintf("locked until %s after %d failed attempts", lockedUntil.Format(time.RFC3339), realm.BruteForceIpMaxFailures),
+		})
+	}
+
+	createSecurityEvents(ctx, securityEvents)
+}
+
+// createSecurityEvents writes the lockouts in a transaction of their own, the request usually fails after a failed
+// attempt and rolls its transaction back, while the counters in redis are kept and would not report the lockout again.
+func createSecurityEvents(ctx context.Context, securityEvents []repos.SecurityEvent) {
+	if len(securityEvents) == 0 {
+		return
+	}
+
+	requestContext.RunWithScope(ioc.RootScope, ctx, func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+
+		securityEventRepository := ioc.Get[repos.SecurityEventRepository](scope)
+		for _, securityEvent := range securityEvents {
+			securityEventRepository.CreateSecurityEvent(ctx, securityEvent)
+		}
+	})
+}
+
+// recordFailureScript counts a failure in a single step, so that concurrent attempts cannot overwrite each other's failures.
+// A failure that reaches the maximum resets the failures and starts a lockout, which becomes permanent after the
+// configured number of lockouts. The failures are kept for the reset interval after the last one or until the lockout ends.
+var recordFailureScript = redis.NewScript(`
+local info = {failures = 0, lockouts = 0, permanent = false, lockedUntil = "0001-01-01T00:00:00Z"}
+local data = redis.call("GET", KEYS[1])
+if data then
+	info = cjson.decode(data)
+end
+local ttl = redis.call("PTTL", KEYS[1])
+
+info.failures = info.failures + 1
+info.lastFailureAt = ARGV[1]
+
+local lockedOut = 0
+if info.failures >= tonumber(ARGV[3]) then
+	info.failures = 0
+	info.lockouts = info.lockouts + 1
+	info.lockedUntil = ARGV[2]
+	lockedOut = 1
+	ttl = math.max(ttl, tonumber(ARGV[6]))
+
+	local permanentAfter = tonumber(ARGV[4])
+	if permanentAfter > 0 and info.lockouts >= permanentAfter then
+		info.permanent = true
+	end
+end
+
+redis.call("SET", KEYS[1], cjson.encode(info))
+if not info.permanent then
+	redis.call("PEXPIRE", KEYS[1], math.max(ttl, tonumber(ARGV[5])))
+end
+
+local permanent = 0
+if info.permanent then
+	permanent = 1
+end
+return {lockedOut, info.lockouts, permanent}
+`)
+
+type recordFailureResult struct {
+	// lockedOut is set if the failure started a lockout.
+	lockedOut bool
+	lockouts  int
+	permanent bool
+}
+
+func (b *bruteForceServiceImpl) recordFailure(ctx context.Context, key string, maxFailures int, permanentAfter int, now time.Time, lockedUntil time.Time) recordFailureResult {
+	logging.Logger.Debugf("recording failure in redis: %s", key)
+	scope := middlewares.GetScope(ctx)
+	redisClient := ioc.Get[*redis.Client](scope)
+
+	values, err := recordFailureScript.Run(ctx, redisClient, []string{key},
+		now.Format(time.RFC3339Nano),
+		lockedUntil.Format(time.RFC3339Nano),
+		maxFailures,
+		permanentAfter,
+		config.C.BruteForce.FailureResetInterval.Milliseconds(),
+		lockedUntil.Sub(now).Milliseconds()).Int64Slice()
+	if err != nil {
+		panic(err)
+	}
+
+	return recordFailureResult{
+		lockedOut: values[0] == 1,
+		lockouts:  int(values[1]),
+		permanent: values[2] == 1,
+	}
+}
+
+func (b *bruteForceServiceImpl) RecordSuccess(ctx context.Context, attempt LoginAttempt) {
+	if attempt.UserId == uuid.Nil {
+		return
+	}
+
+	b.deleteInfo(ctx, bruteForceKey(attempt.RealmId, bruteForceKindUser, attempt.UserId.String()))
+}
+
+func (b *bruteForceServiceImpl) FindLockouts(ctx context.Context, realmId uuid.UUID) []Lockout {
+	scope := middlewares.GetScope(ctx)
+	redisClient := ioc.Get[*redis.Client](scope)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	prefix := bruteForceKeyPrefix + ":" + realmId.String() + ":"
+
+	lockouts := make([]Lockout, 0)
+	iter := redisClient.Scan(ctx, 0, prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+
+		info, ok := b.getInfo(ctx, key).Get()
+		if !ok || (!info.Permanent && !now.Before(info.LockedUntil)) {
+			continue
+		}
+
+		lockout := Lockout{
+			Failures:    info.Failures,
+			LockedUntil: info.LockedUntil,
+			Permanent:   info.Permanent,
+		}
+
+		kind, id, _ := strings.Cut(strings.TrimPrefix(key, prefix), ":")
+		switch kind {
+		case bruteForceKindUser:
+			userId, err := uuid.Parse(id)
+			if err != nil {
+				continue
+			}
+			lockout.UserId = h.Some(userId)
+		case bruteForceKindIp:
+			lockout.Ip = h.Some(id)
+		default:
+			continue
+		}
+
+		lockouts = append(lockouts, lockout)
+	}
+	if err := iter.Err(); err != nil {
+		panic(err)
+	}
+
+	return lockouts
+}
+
+func (b *bruteForceServiceImpl) ClearUserLockout(ctx context.Context, realmId uuid.UUID, userId uuid.UUID, requestIp string) bool {
+	scope := middlewares.GetScope(ctx)
+
+	if !b.deleteInfo(ctx, bruteForceKey(realmId, bruteForceKindUser, userId.String())) {
+		return false
+	}
+
+	securityEventRepository := ioc.Get[repos.SecurityEventRepository](scope)
+	securityEventRepository.CreateSecurityEvent(ctx, repos.SecurityEvent{
+		RealmId:   realmId,
+		UserId:    h.Some(userId),
+		Type:      constants.SecurityEventLockoutCleared,
+		IpAddress: requestIp,
+		Details:   "the lockout of the user was cleared by an admin",
+	})
+
+	return true
+}
+
+func (b *bruteForceServiceImpl) ClearIpLockout(ctx context.Context, realmId uuid.UUID, ip string, requestIp string) bool {
+	scope := middlewares.GetScope(ctx)
+
+	if !b.deleteInfo(ctx, bruteForceKey(realmId, bruteForceKindIp, ip)) {
+		return false
+	}
+
+	securityEventRepository := ioc.Get[repos.SecurityEventRepository](scope)
+	securityEventRepository.CreateSecurityEvent(ctx, repos.SecurityEvent{
+		RealmId:   realmId,
+		UserId:    h.None[uuid.UUID](),
+		Type:      constants.SecurityEventLockoutCleared,
+		IpAddress: requestIp,
+		Details:   fmt.Sprintf("the lockout of the ip address %s was cleared by an admin", ip),
+	})
+
+	return true
+}
+
+func bruteForceKey(realmId uuid.UUID, kind string, id string) string {
+	return bruteForceKeyPrefix + ":" + realmId.String() + ":" + kind + ":" + id
+}
+
+func (b *bruteForceServiceImpl) getInfo(ctx context.Context, key string) h.Opt[bruteForceInfo] {
+	logging.Logger.Debugf("peeking redis: %s", key)
+	scope := middlewares.GetScope(ctx)
+	redisClient := ioc.Get[*redis.Client](scope)
+
+	val, err := redisClient.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return h.None[bruteForceInfo]()
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	var info bruteForceInfo
+	err = json.Unmarshal([]byte(val), &info)
+	if err != nil {
+		panic(err)
+	}
+
+	return h.Some(info)
+}
+
+func (b *bruteForceServiceImpl) deleteInfo(ctx context.Context, key string) bool {
+	logging.Logger.Debugf("deleting redis: %s", key)
+	scope := middlewares.GetScope(ctx)
+	redisClient := ioc.Get[*redis.Client](scope)
+
+	deleted, err := redisClient.Del(ctx, key).Result()
+	if err != nil {
+		panic(err)
+	}
+
+	return deleted > 0
+}
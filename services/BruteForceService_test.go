@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/events"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/utils"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRequestContextService stands in for the transaction of a scope, its writes are only committed if no error occurred.
+type fakeRequestContextService struct {
+	errors    []error
+	pending   []repos.SecurityEvent
+	committed *[]repos.SecurityEvent
+}
+
+func (f *fakeRequestContextService) Errors() []error {
+	return f.errors
+}
+
+func (f *fakeRequestContextService) Error(err error) {
+	f.errors = append(f.errors, err)
+}
+
+func (f *fakeRequestContextService) GetTx() (*sql.Tx, error) {
+	return nil, errors.New("no database in tests")
+}
+
+func (f *fakeRequestContextService) Close() error {
+	if len(f.errors) == 0 {
+		*f.committed = append(*f.committed, f.pending...)
+	}
+	return nil
+}
+
+func (f *fakeRequestContextService) OnAfterTx(_ events.EventHandler[requestContext.AfterTxEventArgs]) {
+}
+
+type fakeSecurityEventRepository struct {
+	repos.SecurityEventRepository
+}
+
+func (f fakeSecurityEventRepository) CreateSecurityEvent(ctx context.Context, securityEvent repos.SecurityEvent) uuid.UUID {
+	rcs := ioc.Get[requestContext.RequestContextService](middlewares.GetScope(ctx)).(*fakeRequestContextService)
+	rcs.pending = append(rcs.pending, securityEvent)
+	return uuid.New()
+}
+
+type fakeRealmRepository struct {
+	repos.RealmRepository
+	realm repos.Realm
+}
+
+func (f fakeRealmRepository) FindRealmById(_ context.Context, _ uuid.UUID) h.Opt[repos.Realm] {
+	return h.Some(f.realm)
+}
+
+type fakeDeviceTokenService struct {
+	TokenService
+	info DeviceVerificationInfo
+}
+
+func (f fakeDeviceTokenService) PeekDeviceVerification(_ context.Context, _ string) h.Opt[DeviceVerificationInfo] {
+	return h.Some(f.info)
+}
+
+func (f fakeDeviceTokenService) OverwriteDeviceVerification(_ context.Context, _ string, _ DeviceVerificationInfo, _ time.Duration) h.Result[h.Unit] {
+	return h.Ok(h.Unit{})
+}
+
+func (f fakeDeviceTokenService) RetrieveDeviceVerification(_ context.Context, _ string) h.Opt[DeviceVerificationInfo] {
+	return h.Some(f.info)
+}
+
+// fakeRedisHook answers the brute force commands without a redis server, a key is locked out once it reaches its maximum.
+type fakeRedisHook struct {
+	failures map[string]int
+}
+
+func (f *fakeRedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (f *fakeRedisHook) ProcessHook(_ redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		switch cmd.Name() {
+		case "get":
+			cmd.SetErr(redis.Nil)
+			return redis.Nil
+		case "evalsha":
+			// evalsha <sha> <number of keys> <key> <now> <locked until> <max failures> ...
+			key := fmt.Sprint(cmd.Args()[3])
+			maxFailures, _ := strconv.Atoi(fmt.Sprint(cmd.Args()[6]))
+
+			f.failures[key]++
+			lockedOut := int64(0)
+			if f.failures[key] >= maxFailures {
+				f.failures[key] = 0
+				lockedOut = 1
+			}
+
+			cmd.(*redis.Cmd).SetVal([]interface{}{lockedOut, lockedOut, int64(0)})
+			return nil
+		default:
+			err := fmt.Errorf("unexpected redis command %s", cmd.Name())
+			cmd.SetErr(err)
+			return err
+		}
+	}
+}
+
+func (f *fakeRedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func newBruteForceTestScope(t *testing.T, realm repos.Realm, info DeviceVerificationInfo, committed *[]repos.SecurityEvent) *ioc.DependencyProvider {
+	builder := ioc.NewDependencyProviderBuilder()
+
+	ioc.AddScoped(builder, func(dp *ioc.DependencyProvider) requestContext.RequestContextService {
+		return &fakeRequestContextService{committed: committed}
+	})
+	ioc.AddCloseHandler[requestContext.RequestContextService](builder, func(rcs requestContext.RequestContextService) error {
+		return rcs.Close()
+	})
+	ioc.AddSingleton(builder, func(dp *ioc.DependencyProvider) utils.ClockService {
+		return utils.NewClockService()
+	})
+	ioc.AddSingleton(builder, func(dp *ioc.DependencyProvider) *redis.Client {
+		redisClient := redis.NewClient(&redis.Options{})
+		redisClient.AddHook(&fakeRedisHook{failures: map[string]int{}})
+		return redisClient
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.RealmRepository {
+		return fakeRealmRepository{realm: realm}
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) repos.SecurityEventRepository {
+		return fakeSecurityEventRepository{}
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) TokenService {
+		return fakeDeviceTokenService{info: info}
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) BruteForceService {
+		return NewBruteForceService()
+	})
+	ioc.Add(builder, func(dp *ioc.DependencyProvider) DeviceService {
+		return NewDeviceService()
+	})
+
+	dp := builder.Build()
+
+	rootScope := ioc.RootScope
+	ioc.RootScope = dp
+	t.Cleanup(func() {
+		ioc.RootScope = rootScope
+	})
+
+	return dp
+}
+
+func Test_RecordFailure_LockoutSurvivesFailedRequest(t *testing.T) {
+	// arrange
+	config.C.Secret = "secret"
+	config.C.DeviceVerification.MaxAttempts = 5
+
+	realm := repos.Realm{
+		BruteForceProtection:      true,
+		BruteForceMaxFailures:     1,
+		BruteForceIpMaxFailures:   100,
+		BruteForceLockoutSeconds:  60,
+		BruteForceMaxDelaySeconds: 60,
+	}
+	realm.Id = uuid.New()
+	info := DeviceVerificationInfo{
+		UserId:     uuid.New(),
+		DeviceId:   "device",
+		HashedCode: utils.Sign("123456", config.C.GetSymmetricEncryptionKey()),
+		ExpiresAt:  time.Now().Add(time.Minute),
+	}
+
+	var committed []repos.SecurityEvent
+	dp := newBruteForceTestScope(t, realm, info, &committed)
+
+	// act
+	var err error
+	requestContext.RunWithScope(dp, context.Background(), func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+
+		deviceService := ioc.Get[DeviceService](scope)
+		err = deviceService.VerifyCode(ctx, VerifyDeviceCodeRequest{
+			Token:    "token",
+			RealmId:  realm.Id,
+			UserId:   info.UserId,
+			DeviceId: info.DeviceId,
+			Code:     "654321",
+			Ip:       "127.0.0.1",
+		})
+
+		// the handler fails the request with the error, which rolls back its transaction
+		rcs := ioc.Get[requestContext.RequestContextService](scope)
+		rcs.Error(err)
+	})
+
+	// assert
+	assert.Error(t, err)
+	if assert.Len(t, committed, 1) {
+		assert.Equal(t, constants.SecurityEventTemporaryLockout, committed[0].Type)
+		assert.Equal(t, h.Some(info.UserId), committed[0].UserId)
+		assert.True(t, strings.HasPrefix(committed[0].Details, "locked until"))
+	}
+}
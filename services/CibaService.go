@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/utils"
+	"html"
+	"net/url"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+const maxBindingMessageLength = 64
+
+type BackchannelAuthenticationRequest struct {
+	RealmName       string
+	ClientId        string
+	ClientSecret    h.Opt[string]
+	Scopes          []string
+	LoginHint       string
+	BindingMessage  string
+	RequestedExpiry h.Opt[int]
+}
+
+type BackchannelAuthenticationResponse struct {
+	AuthReqId string `json:"auth_req_id"`
+	ExpiresIn int    `json:"expires_in"`
+	Interval  int    `json:"interval"`
+}
+
+type CibaDecisionResponse struct {
+	Client         repos.Client
+	User           repos.User
+	Scopes         []repos.Scope
+	BindingMessage string
+}
+
+type CibaDecisionRequest struct {
+	RealmName string
+	Token     string
+	// UserId is the user of the session the decision is made in, only the requested user can decide.
+	UserId  uuid.UUID
+	Approve bool
+}
+
+type CibaNotification struct {
+	RealmName      string
+	ClientName     string
+	User           repos.User
+	BindingMessage string
+	DecisionUrl    string
+}
+
+// CibaNotifier delivers a backchannel authentication request to the device of the user.
+type CibaNotifier interface {
+	Notify(ctx context.Context, notification CibaNotification) error
+}
+
+type mailCibaNotifierImpl struct{}
+
+func NewMailCibaNotifier() CibaNotifier {
+	return &mailCibaNotifierImpl{}
+}
+
+func (n *mailCibaNotifierImpl) Notify(ctx context.Context, notification CibaNotification) error {
+	scope := middlewares.GetScope(ctx)
+
+	email, ok := notification.User.Email.Get()
+	if !ok {
+		return httpErrors.BadRequest().WithMessage("unknown_user_id: the user has no email address")
+	}
+
+	jobService := ioc.Get[JobService](scope)
+	jobService.QueueJob(ctx, repos.SendMailJobDetails{
+		To:      []string{email},
+		Subject: fmt.Sprintf("Sign in request from %s", notification.ClientName),
+		Body: fmt.Sprintf(`<html><body>%s wants you to sign in.<br/>Make sure the following code matches the one shown to you:<br/><b>%s</b><br/><a href="%s">Review the request</a></body></html>`,
+			html.EscapeString(notification.ClientName),
+			html.EscapeString(notification.BindingMessage),
+			html.EscapeString(notification.DecisionUrl)),
+	})
+
+	return nil
+}
+
+type CibaService interface {
+	BackchannelAuthenticate(ctx context.Context, request BackchannelAuthenticationRequest) (*BackchannelAuthenticationResponse, error)
+	GetDecision(ctx context.Context, realmName string, token string) (*CibaDecisionResponse, error)
+	Decide(ctx context.Context, request CibaDecisionRequest) error
+}
+
+type cibaServiceImpl struct{}
+
+func NewCibaService() CibaService {
+	return &cibaServiceImpl{}
+}
+
+func (c *cibaServiceImpl) BackchannelAuthenticate(ctx context.Context, request BackchannelAuthenticationRequest) (*BackchannelAuthenticationResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if !slices.Contains(request.Scopes, "openid") {
+		return nil, httpErrors.BadRequest().WithMessage("invalid_scope: the openid scope is mandatory")
+	}
+	if request.LoginHint == "" {
+		return nil, httpErrors.BadRequest().WithMessage("invalid_request: login_hint is required")
+	}
+	if utf8.RuneCountInString(request.BindingMessage) > maxBindingMessageLength {
+		return nil, httpErrors.BadRequest().WithMessage("invalid_binding_message: the binding message is too long")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(request.RealmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	clientService := ioc.Get[ClientService](scope)
+	clientResult := clientService.Authenticate(ctx, AuthenticateClientRequest{
+		ClientId:     request.ClientId,
+		ClientSecret: request.ClientSecret,
+	})
+	if clientResult.IsErr() {
+		return nil, clientResult.UnwrapErr()
+	}
+	client := clientResult.Unwrap()
+
+	if client.RealmId != realm.Id {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid_client")
+	}
+	if client.Protocol != constants.ClientProtocolOidc {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid_client: the client is not an OpenID Connect client")
+	}
+	if client.ClientSecret.IsNone() {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid_client: only confidential clients may use backchannel authentication")
+	}
+	if err := checkGrantTypeAllowed(client, constants.TokenGrantTypeCiba); err != nil {
+		return nil, err
+	}
+
+	user, ok := findUserByLoginHint(ctx, realm.Id, request.LoginHint).Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("unknown_user_id")
+	}
+
+	expiry := config.C.Ciba.RequestExpiry
+	if requestedExpiry, ok := request.RequestedExpiry.Get(); ok {
+		requested := time.Duration(requestedExpiry) * time.Second
+		if requested <= 0 {
+			return nil, httpErrors.BadRequest().WithMessage("invalid_request: requested_expiry must be positive")
+		}
+		expiry = min(expiry, requested)
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	interval := int(config.C.Ciba.PollInterval / time.Second)
+
+	tokenService := ioc.Get[TokenService](scope)
+	authReqId := tokenService.StoreCibaRequest(ctx, CibaInfo{
+		RealmId:        realm.Id,
+		ClientId:       client.Id,
+		UserId:         user.Id,
+		Scopes:         applyClientScopes(client, request.Scopes),
+		BindingMessage: request.BindingMessage,
+		Status:         constants.CibaStatusPending,
+		ExpiresAt:      now.Add(expiry),
+		Interval:       interval,
+	}, expiry)
+
+	decisionToken := tokenService.StoreCibaDecision(ctx, CibaDecisionInfo{
+		RealmId:   realm.Id,
+		AuthReqId: authReqId,
+	}, expiry)
+
+	notifier := ioc.Get[CibaNotifier](scope)
+	err := notifier.Notify(ctx, CibaNotification{
+		RealmName:      realm.Name,
+		ClientName:     client.DisplayName,
+		User:           user,
+		BindingMessage: request.BindingMessage,
+		DecisionUrl:    routes.AuthCiba.Url(realm.Name) + "?token=" + url.QueryEscape(decisionToken),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackchannelAuthenticationResponse{
+		AuthReqId: authReqId,
+		ExpiresIn: int(expiry / time.Second),
+		Interval:  interval,
+	}, nil
+}
+
+// findUserByLoginHint looks up the user by username first and falls back to the email address.
+func findUserByLoginHint(ctx context.Context, realmId uuid.UUID, loginHint string) h.Opt[repos.User] {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId:  h.Some(realmId),
+		Username: h.Some(loginHint),
+	}).SingleOrNone()
+	if user.IsSome() {
+		return user
+	}
+
+	return findUserByEmail(ctx, realmId, loginHint)
+}
+
+func (c *cibaServiceImpl) findPendingRequest(ctx context.Context, realmName string, token string) (CibaDecisionInfo, CibaInfo, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	decision, ok := tokenService.PeekCibaDecision(ctx, token).Get()
+	if !ok {
+		return CibaDecisionInfo{}, CibaInfo{}, httpErrors.NotFound().WithMessage("authentication request not found")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, decision.RealmId).Unwrap()
+	if realm.Name != realmName {
+		return CibaDecisionInfo{}, CibaInfo{}, httpErrors.NotFound().WithMessage("authentication request not found")
+	}
+
+	info, ok := tokenService.PeekCibaRequest(ctx, decision.AuthReqId).Get()
+	if !ok || info.Status != constants.CibaStatusPending {
+		return CibaDecisionInfo{}, CibaInfo{}, httpErrors.NotFound().WithMessage("authentication request not found")
+	}
+
+	return decision, info, nil
+}
+
+func (c *cibaServiceImpl) GetDecision(ctx context.Context, realmName string, token string) (*CibaDecisionResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	_, info, err := c.findPendingRequest(ctx, realmName, token)
+	if err != nil {
+		return nil, err
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client := clientRepository.FindClientById(ctx, info.ClientId).Unwrap()
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, info.UserId).Unwrap()
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	scopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: info.RealmId,
+		Names:   h.Some(info.Scopes),
+	})
+
+	return &CibaDecisionResponse{
+		Client:         client,
+		User:           user,
+		Scopes:         scopes.Values(),
+		BindingMessage: info.BindingMessage,
+	}, nil
+}
+
+func (c *cibaServiceImpl) Decide(ctx context.Context, request CibaDecisionRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	decision, info, err := c.findPendingRequest(ctx, request.RealmName, request.Token)
+	if err != nil {
+		return err
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	if info.ExpiresAt.Before(now) {
+		return httpErrors.NotFound().WithMessage("authentication request not found")
+	}
+
+	// the link in the notification is not enough, the user has to be signed in to approve
+	if request.UserId != info.UserId {
+		return httpErrors.Unauthorized().WithMessage("the authentication request is for another user")
+	}
+
+	tokenService := ioc.Get[TokenService](scope)
+	tokenService.RetrieveCibaDecision(ctx, request.Token)
+
+	if request.Approve {
+		info.Status = constants.CibaStatusApproved
+
+		// approving the request on the device of the user counts as consent to the requested scopes
+		scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+		scopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+			RealmId: info.RealmId,
+			Names:   h.Some(info.Scopes),
+		})
+		scopeIds := make([]uuid.UUID, 0, len(scopes.Values()))
+		for _, dbScope := range scopes.Values() {
+			scopeIds = append(scopeIds, dbScope.Id)
+		}
+		scopeRepository.CreateGrants(ctx, info.UserId, info.ClientId, scopeIds)
+	} else {
+		info.Status = constants.CibaStatusDenied
+	}
+
+	result := tokenService.OverwriteCibaRequest(ctx, decision.AuthReqId, info, info.ExpiresAt.Sub(now))
+	if result.IsErr() {
+		return result.UnwrapErr()
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sourcegraph/conc/iter"
@@ -11,6 +12,7 @@ import (
 	"holvit/logging"
 	"holvit/middlewares"
 	"holvit/repos"
+	"slices"
 )
 
 type ClaimResponse struct {
@@ -21,6 +23,111 @@ type ClaimResponse struct {
 type GetClaimsRequest struct {
 	UserId   uuid.UUID
 	ScopeIds []uuid.UUID
+
+	Target        string
+	ClaimsRequest h.Opt[ClaimsRequest]
+}
+
+// ClaimRequest is a single entry of the OIDC claims request parameter, see
+// https://openid.net/specs/openid-connect-core-1_0.html#IndividualClaimsRequests
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// ClaimsRequest is the parsed OIDC claims request parameter.
+// A nil entry means the claim is requested in the default manner.
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IdToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+func ParseClaimsRequest(raw string) (ClaimsRequest, error) {
+	var result ClaimsRequest
+	err := json.Unmarshal([]byte(raw), &result)
+	return result, err
+}
+
+// ForTarget returns the requested claims for either the id_token or the userinfo target.
+// The second return value is false if the request does not restrict that target.
+func (r ClaimsRequest) ForTarget(target string) (map[string]*ClaimRequest, bool) {
+	switch target {
+	case constants.ClaimsTargetIdToken:
+		return r.IdToken, r.IdToken != nil
+	case constants.ClaimsTargetUserInfo:
+		return r.UserInfo, r.UserInfo != nil
+	default:
+		return nil, false
+	}
+}
+
+// EssentialClaimNames returns the names of all claims that are marked as essential in any target.
+func (r ClaimsRequest) EssentialClaimNames() []string {
+	names := make([]string, 0)
+	for _, requested := range []map[string]*ClaimRequest{r.IdToken, r.UserInfo} {
+		for name, claim := range requested {
+			if claim != nil && claim.Essential && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func (r *ClaimRequest) matches(value interface{}) bool {
+	if r == nil || (r.Value == nil && r.Values == nil) {
+		return true
+	}
+
+	actual, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+
+	// a fresh slice, appending to r.Values could write into the array of the parsed request
+	candidates := make([]interface{}, 0, len(r.Values)+1)
+	candidates = append(candidates, r.Values...)
+	if r.Value != nil {
+		candidates = append(candidates, r.Value)
+	}
+
+	for _, candidate := range candidates {
+		expected, err := json.Marshal(candidate)
+		if err != nil {
+			panic(err)
+		}
+		if string(expected) == string(actual) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func filterRequestedClaims(claims []ClaimResponse, requested map[string]*ClaimRequest) []ClaimResponse {
+	result := make([]ClaimResponse, 0, len(claims))
+	for _, claim := range claims {
+		// the subject is always returned, no matter what was requested
+		if claim.Name == "sub" {
+			result = append(result, claim)
+			continue
+		}
+
+		claimRequest, ok := requested[claim.Name]
+		if !ok {
+			continue
+		}
+
+		if !claimRequest.matches(claim.Claim) {
+			logging.Logger.Debugf("claim %s does not match the requested value(s), omitting it", claim.Name)
+			continue
+		}
+
+		result = append(result, claim)
+	}
+
+	return result
 }
 
 type ClaimsService interface {
@@ -45,6 +152,7 @@ func (c *claimsServiceImpl) GetClaims(ctx context.Context, request GetClaimsRequ
 
 	userInfoMappers := make([]interface{}, 0)
 	rolesMappers := make([]interface{}, 0)
+	groupsMappers := make([]interface{}, 0)
 
 	for _, mapper := range mappers.Values() {
 		switch mapper.Type {
@@ -52,6 +160,8 @@ func (c *claimsServiceImpl) GetClaims(ctx context.Context, request GetClaimsRequ
 			userInfoMappers = append(userInfoMappers, mapper.Details)
 		case constants.ClaimMapperRoles:
 			rolesMappers = append(rolesMappers, mapper.Details)
+		case constants.ClaimMapperGroups:
+			groupsMappers = append(groupsMappers, mapper.Details)
 		}
 	}
 
@@ -59,23 +169,14 @@ func (c *claimsServiceImpl) GetClaims(ctx context.Context, request GetClaimsRequ
 	user := userRepository.FindUserById(ctx, request.UserId).Unwrap()
 
 	if len(rolesMappers) > 0 {
-		userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
-		roleRepository := ioc.Get[repos.RoleRepository](scope)
-
-		userRoles := userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
-			UserId: request.UserId,
-		})
-
-		roleIds := iter.Map(userRoles, func(userRole *repos.UserRole) uuid.UUID {
-			return userRole.RoleId
-		})
-
-		roles := roleRepository.FindRoles(ctx, repos.RoleFilter{
+		// the roles include the ones inherited from groups and implied by other roles
+		roleService := ioc.Get[RoleService](scope)
+		roles := roleService.GetRolesForUser(ctx, GetRolesForUserRequest{
+			UserId:  request.UserId,
 			RealmId: user.RealmId,
-			RoleIds: h.Some(roleIds),
 		})
 
-		roleNames := iter.Map(roles.Values(), func(role *repos.Role) string {
+		roleNames := iter.Map(roles, func(role *repos.Role) string {
 			return role.Name
 		})
 
@@ -85,6 +186,26 @@ func (c *claimsServiceImpl) GetClaims(ctx context.Context, request GetClaimsRequ
 		})
 	}
 
+	if len(groupsMappers) > 0 {
+		groupRepository := ioc.Get[repos.GroupRepository](scope)
+		groups := groupRepository.FindGroups(ctx, repos.GroupFilter{
+			RealmId:  h.Some(user.RealmId),
+			MemberId: h.Some(request.UserId),
+		})
+
+		groupPaths := iter.Map(groups.Values(), func(group *repos.Group) string {
+			return group.Path
+		})
+
+		for _, m := range groupsMappers {
+			mapper := m.(repos.GroupsClaimMapperDetails)
+			claims = append(claims, ClaimResponse{
+				Name:  mapper.ClaimName,
+				Claim: groupPaths,
+			})
+		}
+	}
+
 	if len(userInfoMappers) > 0 {
 
 		for _, m := range userInfoMappers {
@@ -121,5 +242,11 @@ func (c *claimsServiceImpl) GetClaims(ctx context.Context, request GetClaimsRequ
 		}
 	}
 
+	if claimsRequest, ok := request.ClaimsRequest.Get(); ok {
+		if requested, ok := claimsRequest.ForTarget(request.Target); ok {
+			claims = filterRequestedClaims(claims, requested)
+		}
+	}
+
 	return claims
 }
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"github.com/stretchr/testify/assert"
+	"holvit/constants"
+	"testing"
+)
+
+func Test_ParseClaimsRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		target    string
+		restricts bool
+		essential []string
+	}{
+		{
+			name:      "essential id token claim",
+			raw:       `{"id_token":{"email":{"essential":true},"name":null}}`,
+			target:    constants.ClaimsTargetIdToken,
+			restricts: true,
+			essential: []string{"email"},
+		},
+		{
+			name:      "userinfo claim with a value",
+			raw:       `{"userinfo":{"email":{"value":"user@example.com"}}}`,
+			target:    constants.ClaimsTargetUserInfo,
+			restricts: true,
+			essential: []string{},
+		},
+		{
+			name:      "target without requested claims",
+			raw:       `{"userinfo":{"email":null}}`,
+			target:    constants.ClaimsTargetIdToken,
+			restricts: false,
+			essential: []string{},
+		},
+		{
+			name:      "unknown target",
+			raw:       `{"id_token":{"email":{"essential":true}}}`,
+			target:    "access_token",
+			restricts: false,
+			essential: []string{"email"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			claimsRequest, err := ParseClaimsRequest(test.raw)
+
+			// assert
+			assert.NoError(t, err)
+			_, restricts := claimsRequest.ForTarget(test.target)
+			assert.Equal(t, test.restricts, restricts)
+			assert.Equal(t, test.essential, claimsRequest.EssentialClaimNames())
+		})
+	}
+}
+
+func Test_ParseClaimsRequest_Invalid(t *testing.T) {
+	// act
+	_, err := ParseClaimsRequest(`{"id_token":`)
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_filterRequestedClaims(t *testing.T) {
+	claims := []ClaimResponse{
+		{Name: "sub", Claim: "user"},
+		{Name: "email", Claim: "user@example.com"},
+		{Name: "locale", Claim: "de"},
+	}
+
+	tests := []struct {
+		name     string
+		raw      string
+		expected []string
+	}{
+		{
+			name:     "default manner",
+			raw:      `{"id_token":{"email":null}}`,
+			expected: []string{"sub", "email"},
+		},
+		{
+			name:     "essential",
+			raw:      `{"id_token":{"email":{"essential":true}}}`,
+			expected: []string{"sub", "email"},
+		},
+		{
+			name:     "matching value",
+			raw:      `{"id_token":{"email":{"value":"user@example.com"}}}`,
+			expected: []string{"sub", "email"},
+		},
+		{
+			name:     "other value",
+			raw:      `{"id_token":{"email":{"value":"other@example.com"}}}`,
+			expected: []string{"sub"},
+		},
+		{
+			name:     "matching values",
+			raw:      `{"id_token":{"locale":{"values":["en","de"]}}}`,
+			expected: []string{"sub", "locale"},
+		},
+		{
+			name:     "value and values",
+			raw:      `{"id_token":{"locale":{"value":"de","values":["en"]}}}`,
+			expected: []string{"sub", "locale"},
+		},
+		{
+			name:     "nothing requested",
+			raw:      `{"id_token":{}}`,
+			expected: []string{"sub"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			claimsRequest, err := ParseClaimsRequest(test.raw)
+			assert.NoError(t, err)
+			requested, _ := claimsRequest.ForTarget(constants.ClaimsTargetIdToken)
+
+			// act
+			filtered := filterRequestedClaims(claims, requested)
+
+			// assert
+			names := make([]string, 0, len(filtered))
+			for _, claim := range filtered {
+				names = append(names, claim.Name)
+			}
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
+
+func Test_ClaimRequest_MatchesDoesNotModifyValues(t *testing.T) {
+	// arrange
+	values := make([]interface{}, 1, 2)
+	values[0] = "en"
+	claimRequest := &ClaimRequest{
+		Value:  "de",
+		Values: values,
+	}
+
+	// act
+	matches := claimRequest.matches("de")
+
+	// assert
+	assert.True(t, matches)
+	assert.Equal(t, []interface{}{"en"}, claimRequest.Values)
+	assert.Equal(t, []interface{}{"en", nil}, values[:2])
+}
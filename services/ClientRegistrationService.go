@@ -0,0 +1,427 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/utils"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ClientMetadata is the client metadata as defined in https://datatracker.ietf.org/doc/html/rfc7591#section-2
+type ClientMetadata struct {
+	RedirectUris            []string        `json:"redirect_uris"`
+	GrantTypes              []string        `json:"grant_types"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method"`
+	ClientName              string          `json:"client_name,omitempty"`
+	Jwks                    json.RawMessage `json:"jwks,omitempty"`
+}
+
+type ClientInformationResponse struct {
+	ClientMetadata
+
+	ClientId              string  `json:"client_id"`
+	ClientSecret          *string `json:"client_secret,omitempty"`
+	ClientIdIssuedAt      int64   `json:"client_id_issued_at"`
+	ClientSecretExpiresAt *int64  `json:"client_secret_expires_at,omitempty"`
+
+	// RegistrationAccessToken is only returned when a new one is issued, reading a client keeps the current one.
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientUri   string `json:"registration_client_uri"`
+}
+
+type RegisterClientRequest struct {
+	RealmName string
+	Bearer    string
+	Metadata  ClientMetadata
+}
+
+type ManageClientRequest struct {
+	RealmName string
+	ClientId  string
+	Bearer    string
+}
+
+type CreateInitialAccessTokenRequest struct {
+	RealmId     uuid.UUID
+	Description string
+	ExpiresAt   h.Opt[time.Time]
+	// MaxUses defaults to a single use for tokens that do not expire.
+	MaxUses h.Opt[int]
+}
+
+type ClientRegistrationService interface {
+	RegisterClient(ctx context.Context, request RegisterClientRequest) (*ClientInformationResponse, error)
+	ReadClient(ctx context.Context, request ManageClientRequest) (*ClientInformationResponse, error)
+	UpdateClient(ctx context.Context, request ManageClientRequest, metadata ClientMetadata) (*ClientInformationResponse, error)
+	DeleteClient(ctx context.Context, request ManageClientRequest) error
+	CreateInitialAccessToken(ctx context.Context, request CreateInitialAccessTokenRequest) string
+}
+
+type clientRegistrationServiceImpl struct{}
+
+func NewClientRegistrationService() ClientRegistrationService {
+	return &clientRegistrationServiceImpl{}
+}
+
+var supportedRegistrationGrantTypes = []string{
+	constants.TokenGrantTypeAuthorizationCode,
+	constants.TokenGrantTypeRefreshToken,
+	constants.TokenGrantTypeCiba,
+	constants.TokenGrantTypeClientCredentials,
+}
+
+// registeredClientDefaultScopes and registeredClientOptionalScopes are the built-in scopes of every realm.
+// Registered clients get the ones that still exist in the realm, so they can not request scopes an admin added for other clients.
+var registeredClientDefaultScopes = []string{"openid"}
+var registeredClientOptionalScopes = []string{"profile", "email", "roles"}
+
+var supportedTokenEndpointAuthMethods = []string{
+	constants.TokenEndpointAuthMethodNone,
+	constants.TokenEndpointAuthMethodClientSecretBasic,
+	constants.TokenEndpointAuthMethodClientSecretPost,
+}
+
+func invalidClientMetadata(msg string) error {
+	return httpErrors.BadRequest().WithMessage("invalid_client_metadata: " + msg)
+}
+
+func validateClientMetadata(metadata *ClientMetadata) error {
+	if len(metadata.GrantTypes) == 0 {
+		metadata.GrantTypes = []string{constants.TokenGrantTypeAuthorizationCode}
+	}
+	for _, grantType := range metadata.GrantTypes {
+		if !slices.Contains(supportedRegistrationGrantTypes, grantType) {
+			return invalidClientMetadata(fmt.Sprintf("unsupported grant type '%s'", grantType))
+		}
+	}
+
+	if metadata.TokenEndpointAuthMethod == "" {
+		metadata.TokenEndpointAuthMethod = constants.TokenEndpointAuthMethodClientSecretBasic
+	}
+	if !slices.Contains(supportedTokenEndpointAuthMethods, metadata.TokenEndpointAuthMethod) {
+		return invalidClientMetadata(fmt.Sprintf("unsupported token endpoint auth method '%s'", metadata.TokenEndpointAuthMethod))
+	}
+
+	if slices.Contains(metadata.GrantTypes, constants.TokenGrantTypeAuthorizationCode) && len(metadata.RedirectUris) == 0 {
+		return httpErrors.BadRequest().WithMessage("invalid_redirect_uri: at least one redirect uri is required")
+	}
+	for _, redirectUri := range metadata.RedirectUris {
+		if !isAllowedRedirectUri(redirectUri) {
+			return httpErrors.BadRequest().WithMessage(fmt.Sprintf("invalid_redirect_uri: '%s' must be an https uri, "+
+				"an http uri on a loopback address or use a reverse domain name scheme, without fragment", redirectUri))
+		}
+	}
+
+	if len(metadata.Jwks) != 0 {
+		var jwks struct {
+			Keys []json.RawMessage `json:"keys"`
+		}
+		if err := json.Unmarshal(metadata.Jwks, &jwks); err != nil || jwks.Keys == nil {
+			return invalidClientMetadata("jwks must be a json web key set")
+		}
+	}
+
+	return nil
+}
+
+// isAllowedRedirectUri only allows redirect uris that can not be used to run scripts or to send codes in plain text
+// over the network, see https://datatracker.ietf.org/doc/html/rfc8252#section-7 for the native app schemes.
+func isAllowedRedirectUri(redirectUri string) bool {
+	parsed, err := url.Parse(redirectUri)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.Contains(redirectUri, "#") {
+		return false
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return parsed.Host != ""
+	case "http":
+		hostname := parsed.Hostname()
+		if hostname == "localhost" {
+			return true
+		}
+		ip, err := netip.ParseAddr(hostname)
+		return err == nil && ip.IsLoopback()
+	default:
+		// private-use schemes of native apps have to be a reverse domain name like com.example.app
+		return strings.Contains(parsed.Scheme, ".")
+	}
+}
+
+func registrationClientUri(realmName string, clientId string) string {
+	return routes.OidcRegister.Url(realmName) + "/" + url.PathEscape(clientId)
+}
+
+func (c *clientRegistrationServiceImpl) getRealm(ctx context.Context, realmName string) (repos.Realm, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	return realm, nil
+}
+
+func (c *clientRegistrationServiceImpl) RegisterClient(ctx context.Context, request RegisterClientRequest) (*ClientInformationResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	realm, err := c.getRealm(ctx, request.RealmName)
+	if err != nil {
+		return nil, err
+	}
+
+	bearer, ok := strings.CutPrefix(request.Bearer, "Bearer ")
+	if !ok {
+		return nil, httpErrors.Unauthorized().WithMessage("missing initial access token")
+	}
+
+	initialAccessTokenRepository := ioc.Get[repos.InitialAccessTokenRepository](scope)
+	if initialAccessTokenRepository.UseInitialAccessToken(ctx, realm.Id, utils.CheapHash(bearer), now).IsNone() {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid, expired or used up initial access token")
+	}
+
+	metadata := request.Metadata
+	if err := validateClientMetadata(&metadata); err != nil {
+		return nil, err
+	}
+
+	clientId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := metadata.ClientName
+	if displayName == "" {
+		displayName = clientId.String()
+	}
+
+	jwks := h.None[string]()
+	if len(metadata.Jwks) != 0 {
+		jwks = h.Some(string(metadata.Jwks))
+	}
+
+	clientService := ioc.Get[ClientService](scope)
+	createdClient := clientService.CreateClient(ctx, CreateClientRequest{
+		RealmId:                 realm.Id,
+		ClientId:                h.Some(clientId.String()),
+		DisplayName:             displayName,
+		WithSecret:              metadata.TokenEndpointAuthMethod != constants.TokenEndpointAuthMethodNone,
+		RedirectUrls:            metadata.RedirectUris,
+		GrantTypes:              metadata.GrantTypes,
+		TokenEndpointAuthMethod: h.Some(metadata.TokenEndpointAuthMethod),
+		Jwks:                    jwks,
+		DefaultScopes:           c.existingScopes(ctx, realm.Id, registeredClientDefaultScopes),
+		OptionalScopes:          c.existingScopes(ctx, realm.Id, registeredClientOptionalScopes),
+	})
+
+	registrationAccessToken := c.rotateRegistrationAccessToken(ctx, createdClient.Id)
+
+	var clientSecretExpiresAt *int64
+	if createdClient.ClientSecret.IsSome() {
+		clientSecretExpiresAt = utils.Ptr(int64(0))
+	}
+
+	return &ClientInformationResponse{
+		ClientMetadata:          metadata,
+		ClientId:                createdClient.ClientId,
+		ClientSecret:            createdClient.ClientSecret.ToNillablePtr(),
+		ClientIdIssuedAt:        now.Unix(),
+		ClientSecretExpiresAt:   clientSecretExpiresAt,
+		RegistrationAccessToken: registrationAccessToken,
+		RegistrationClientUri:   registrationClientUri(realm.Name, createdClient.ClientId),
+	}, nil
+}
+
+func (c *clientRegistrationServiceImpl) existingScopes(ctx context.Context, realmId uuid.UUID, names []string) []string {
+	scope := middlewares.GetScope(ctx)
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	scopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: realmId,
+		Names:   h.Some(names),
+	})
+
+	result := make([]string, 0, len(names))
+	for _, existing := range scopes.Values() {
+		result = append(result, existing.Name)
+	}
+	return result
+}
+
+func (c *clientRegistrationServiceImpl) rotateRegistrationAccessToken(ctx context.Context, clientId uuid.UUID) string {
+	scope := middlewares.GetScope(ctx)
+
+	registrationAccessToken := utils.GenerateRandomStringBase64(32)
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	clientRepository.UpdateClient(ctx, clientId, repos.ClientUpdate{
+		HashedRegistrationAccessToken: h.Some(utils.CheapHash(registrationAccessToken)),
+	}).Unwrap()
+
+	return registrationAccessToken
+}
+
+func (c *clientRegistrationServiceImpl) authenticateManagementRequest(ctx context.Context, request ManageClientRequest) (repos.Realm, repos.Client, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realm, err := c.getRealm(ctx, request.RealmName)
+	if err != nil {
+		return repos.Realm{}, repos.Client{}, err
+	}
+
+	bearer, ok := strings.CutPrefix(request.Bearer, "Bearer ")
+	if !ok {
+		return repos.Realm{}, repos.Client{}, httpErrors.Unauthorized().WithMessage("missing registration access token")
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(request.ClientId),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, repos.Client{}, httpErrors.Unauthorized().WithMessage("invalid registration access token")
+	}
+
+	hashedToken, ok := client.HashedRegistrationAccessToken.Get()
+	if !ok || !utils.Sha256Compare(hashedToken, utils.CheapHash(bearer)) {
+		return repos.Realm{}, repos.Client{}, httpErrors.Unauthorized().WithMessage("invalid registration access token")
+	}
+
+	return realm, client, nil
+}
+
+func (c *clientRegistrationServiceImpl) mapClientInformation(realm repos.Realm, client repos.Client, registrationAccessToken string) *ClientInformationResponse {
+	var jwks json.RawMessage
+	if rawJwks, ok := client.Jwks.Get(); ok {
+		jwks = json.RawMessage(rawJwks)
+	}
+
+	var clientSecretExpiresAt *int64
+	if client.ClientSecret.IsSome() {
+		clientSecretExpiresAt = utils.Ptr(int64(0))
+	}
+
+	return &ClientInformationResponse{
+		ClientMetadata: ClientMetadata{
+			RedirectUris:            client.RedirectUris,
+			GrantTypes:              client.GrantTypes,
+			TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+			ClientName:              client.DisplayName,
+			Jwks:                    jwks,
+		},
+		ClientId:                client.ClientId,
+		ClientIdIssuedAt:        client.AuditCreatedAt.Unix(),
+		ClientSecretExpiresAt:   clientSecretExpiresAt,
+		RegistrationAccessToken: registrationAccessToken,
+		RegistrationClientUri:   registrationClientUri(realm.Name, client.ClientId),
+	}
+}
+
+func (c *clientRegistrationServiceImpl) ReadClient(ctx context.Context, request ManageClientRequest) (*ClientInformationResponse, error) {
+	realm, client, err := c.authenticateManagementRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// reading a client must not invalidate the token the client already has, it is only rotated on updates
+	return c.mapClientInformation(realm, client, ""), nil
+}
+
+func (c *clientRegistrationServiceImpl) UpdateClient(ctx context.Context, request ManageClientRequest, metadata ClientMetadata) (*ClientInformationResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realm, client, err := c.authenticateManagementRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateClientMetadata(&metadata); err != nil {
+		return nil, err
+	}
+
+	isPublic := metadata.TokenEndpointAuthMethod == constants.TokenEndpointAuthMethodNone
+	if isPublic != client.ClientSecret.IsNone() {
+		return nil, invalidClientMetadata("switching between public and confidential clients is not supported")
+	}
+
+	jwks := h.None[string]()
+	if len(metadata.Jwks) != 0 {
+		jwks = h.Some(string(metadata.Jwks))
+	}
+
+	update := repos.ClientUpdate{
+		RedirectUris:            h.Some(metadata.RedirectUris),
+		GrantTypes:              h.Some(metadata.GrantTypes),
+		TokenEndpointAuthMethod: h.Some(metadata.TokenEndpointAuthMethod),
+		Jwks:                    h.Some(jwks),
+	}
+	if metadata.ClientName != "" {
+		update.DisplayName = h.Some(metadata.ClientName)
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	clientRepository.UpdateClient(ctx, client.Id, update).Unwrap()
+
+	client = clientRepository.FindClientById(ctx, client.Id).Unwrap()
+
+	registrationAccessToken := c.rotateRegistrationAccessToken(ctx, client.Id)
+
+	return c.mapClientInformation(realm, client, registrationAccessToken), nil
+}
+
+func (c *clientRegistrationServiceImpl) DeleteClient(ctx context.Context, request ManageClientRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	_, client, err := c.authenticateManagementRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	clientRepository.DeleteClient(ctx, client.Id)
+
+	return nil
+}
+
+func (c *clientRegistrationServiceImpl) CreateInitialAccessToken(ctx context.Context, request CreateInitialAccessTokenRequest) string {
+	scope := middlewares.GetScope(ctx)
+
+	token := utils.GenerateRandomStringBase64(32)
+
+	maxUses := request.MaxUses
+	if maxUses.IsNone() && request.ExpiresAt.IsNone() {
+		maxUses = h.Some(1)
+	}
+
+	initialAccessTokenRepository := ioc.Get[repos.InitialAccessTokenRepository](scope)
+	initialAccessTokenRepository.CreateInitialAccessToken(ctx, repos.InitialAccessToken{
+		RealmId:     request.RealmId,
+		HashedToken: utils.CheapHash(token),
+		Description: request.Description,
+		ExpiresAt:   request.ExpiresAt,
+		MaxUses:     maxUses,
+	})
+
+	return token
+}
@@ -2,23 +2,48 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"holvit/config"
+	"holvit/constants"
 	"holvit/h"
 	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
 	"holvit/repos"
 	"holvit/utils"
+	"net/url"
+	"slices"
 	"strings"
+	"time"
 )
 
 type CreateClientRequest struct {
 	RealmId      uuid.UUID
 	ClientId     h.Opt[string]
 	DisplayName  string
+	Protocol     string
 	WithSecret   bool
 	RedirectUrls []string
+
+	GrantTypes              []string
+	TokenEndpointAuthMethod h.Opt[string]
+	Jwks                    h.Opt[string]
+
+	ResponseTypes  []string
+	DefaultScopes  []string
+	OptionalScopes []string
+
+	PkceRequired    bool
+	ConsentRequired *bool
+
+	WebOrigins []string
+
+	SamlNameIdFormat       h.Opt[string]
+	SamlSignatureAlgorithm h.Opt[string]
+
+	SamlRequireSignedRequests bool
+	SamlSigningCertificate    h.Opt[string]
 }
 
 type CreateClientResponse struct {
@@ -35,6 +60,9 @@ type AuthenticateClientRequest struct {
 type ClientService interface {
 	CreateClient(ctx context.Context, request CreateClientRequest) CreateClientResponse
 	Authenticate(ctx context.Context, request AuthenticateClientRequest) h.Result[repos.Client]
+	// IsWebOriginAllowed reports whether any client of the realm accepts browser requests from the origin.
+	// CORS preflight requests do not say which client they are for, so they can only be checked against all of them.
+	IsWebOriginAllowed(ctx context.Context, realmName string, origin string) bool
 }
 
 type clientServiceImpl struct{}
@@ -64,7 +92,7 @@ func (c *clientServiceImpl) Authenticate(ctx context.Context, request Authentica
 				if result.NeedsRehash {
 					reHashed := config.C.GetHasher().Hash(requestClientSecret)
 					clientRepository.UpdateClient(ctx, client.Id, repos.ClientUpdate{
-						ClientSecret: h.Some(reHashed),
+						ClientSecret: h.Some(h.Some(reHashed)),
 					}).Unwrap()
 				}
 				return h.Ok(client)
@@ -100,12 +128,52 @@ func (c *clientServiceImpl) CreateClient(ctx context.Context, request CreateClie
 	hashAlgorithm := config.C.GetHasher()
 	hashedClientSecret := clientSecret.Map(hashAlgorithm.Hash)
 
+	protocol := request.Protocol
+	if protocol == "" {
+		protocol = constants.ClientProtocolOidc
+	}
+
+	grantTypes := request.GrantTypes
+	responseTypes := request.ResponseTypes
+
+	// service providers do not use any of the oidc flows
+	if protocol == constants.ClientProtocolOidc {
+		if len(grantTypes) == 0 {
+			grantTypes = []string{constants.TokenGrantTypeAuthorizationCode, constants.TokenGrantTypeRefreshToken}
+		}
+
+		if len(responseTypes) == 0 {
+			responseTypes = []string{constants.AuthorizationResponseTypeCode}
+		}
+	}
+
+	tokenEndpointAuthMethod := request.TokenEndpointAuthMethod.UnwrapOrElse(func() string {
+		if request.WithSecret {
+			return constants.TokenEndpointAuthMethodClientSecretBasic
+		}
+		return constants.TokenEndpointAuthMethodNone
+	})
+
 	clientDbId := clientRepository.CreateClient(ctx, repos.Client{
-		RealmId:      request.RealmId,
-		DisplayName:  request.DisplayName,
-		ClientId:     clientId,
-		ClientSecret: hashedClientSecret,
-		RedirectUris: request.RedirectUrls,
+		RealmId:                   request.RealmId,
+		DisplayName:               request.DisplayName,
+		Protocol:                  protocol,
+		ClientId:                  clientId,
+		ClientSecret:              hashedClientSecret,
+		RedirectUris:              utils.NonNilSlice(request.RedirectUrls),
+		GrantTypes:                utils.NonNilSlice(grantTypes),
+		TokenEndpointAuthMethod:   tokenEndpointAuthMethod,
+		Jwks:                      request.Jwks,
+		ResponseTypes:             utils.NonNilSlice(responseTypes),
+		DefaultScopes:             utils.NonNilSlice(request.DefaultScopes),
+		OptionalScopes:            utils.NonNilSlice(request.OptionalScopes),
+		PkceRequired:              request.PkceRequired,
+		ConsentRequired:           utils.GetOrDefault(request.ConsentRequired, true),
+		WebOrigins:                utils.NonNilSlice(request.WebOrigins),
+		SamlNameIdFormat:          request.SamlNameIdFormat,
+		SamlSignatureAlgorithm:    request.SamlSignatureAlgorithm,
+		SamlRequireSignedRequests: request.SamlRequireSignedRequests,
+		SamlSigningCertificate:    request.SamlSigningCertificate,
 	}).Unwrap()
 
 	return CreateClientResponse{
@@ -114,3 +182,73 @@ func (c *clientServiceImpl) CreateClient(ctx context.Context, request CreateClie
 		ClientSecret: clientSecret.Map(func(secret string) string { return "secret_" + secret }),
 	}
 }
+
+func checkGrantTypeAllowed(client repos.Client, grantType string) error {
+	if !slices.Contains(client.GrantTypes, grantType) {
+		return httpErrors.BadRequest().WithMessage(fmt.Sprintf("grant type '%s' is not allowed for this client", grantType))
+	}
+	return nil
+}
+
+func clientTokenLifetime(lifetimeSeconds h.Opt[int], fallback time.Duration) time.Duration {
+	if seconds, ok := lifetimeSeconds.Get(); ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+func (c *clientServiceImpl) IsWebOriginAllowed(ctx context.Context, realmName string, origin string) bool {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return false
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	clients := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		Protocol: h.Some(constants.ClientProtocolOidc),
+	})
+
+	return slices.ContainsFunc(clients.Values(), func(client repos.Client) bool {
+		return checkWebOrigin(client, h.Some(origin)) == nil
+	})
+}
+
+// checkWebOrigin verifies that browser requests only come from the web origins of a client.
+// A "+" allows the origins of all redirect uris, which is also the default when no web origins are configured.
+func checkWebOrigin(client repos.Client, origin h.Opt[string]) error {
+	requestOrigin, ok := origin.Get()
+	if !ok {
+		return nil
+	}
+
+	webOrigins := client.WebOrigins
+	if len(webOrigins) == 0 {
+		webOrigins = []string{"+"}
+	}
+
+	for _, webOrigin := range webOrigins {
+		switch webOrigin {
+		case "*":
+			return nil
+		case "+":
+			for _, redirectUri := range client.RedirectUris {
+				parsed, err := url.Parse(redirectUri)
+				if err == nil && parsed.Scheme+"://"+parsed.Host == requestOrigin {
+					return nil
+				}
+			}
+		default:
+			if webOrigin == requestOrigin {
+				return nil
+			}
+		}
+	}
+
+	return httpErrors.Forbidden().WithMessage("origin not allowed")
+}
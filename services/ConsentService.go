@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/utils"
+	"time"
+)
+
+type ConsentScope struct {
+	Id          uuid.UUID
+	Name        string
+	DisplayName string
+	GrantedAt   time.Time
+}
+
+type Consent struct {
+	Client repos.Client
+	Scopes []ConsentScope
+}
+
+type ConsentService interface {
+	FindConsents(ctx context.Context, realm repos.Realm, userId uuid.UUID) []Consent
+	RevokeConsent(ctx context.Context, userId uuid.UUID, clientId uuid.UUID)
+	ConsentValidSince(ctx context.Context, realm repos.Realm) h.Opt[time.Time]
+}
+
+type consentServiceImpl struct{}
+
+func NewConsentService() ConsentService {
+	return &consentServiceImpl{}
+}
+
+func (c *consentServiceImpl) ConsentValidSince(ctx context.Context, realm repos.Realm) h.Opt[time.Time] {
+	scope := middlewares.GetScope(ctx)
+
+	expirySeconds, ok := realm.ConsentExpirySeconds.Get()
+	if !ok {
+		return h.None[time.Time]()
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	return h.Some(now.Add(-time.Duration(expirySeconds) * time.Second))
+}
+
+func (c *consentServiceImpl) FindConsents(ctx context.Context, realm repos.Realm, userId uuid.UUID) []Consent {
+	scope := middlewares.GetScope(ctx)
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	grantedScopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId:       realm.Id,
+		IncludeGrants: true,
+		OnlyGranted:   true,
+		UserId:        h.Some(userId),
+		GrantedAfter:  c.ConsentValidSince(ctx, realm),
+	})
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+
+	consents := make([]Consent, 0)
+	consentIndices := make(map[uuid.UUID]int)
+	for _, grantedScope := range grantedScopes.Values() {
+		grant := grantedScope.Grant.Unwrap()
+
+		index, ok := consentIndices[grant.ClientId]
+		if !ok {
+			client, ok := clientRepository.FindClientById(ctx, grant.ClientId).Get()
+			if !ok {
+				continue
+			}
+
+			index = len(consents)
+			consentIndices[grant.ClientId] = index
+			consents = append(consents, Consent{
+				Client: client,
+				Scopes: make([]ConsentScope, 0),
+			})
+		}
+
+		consents[index].Scopes = append(consents[index].Scopes, ConsentScope{
+			Id:          grantedScope.Id,
+			Name:        grantedScope.Name,
+			DisplayName: grantedScope.DisplayName,
+			GrantedAt:   grant.GrantedAt,
+		})
+	}
+
+	return consents
+}
+
+func (c *consentServiceImpl) RevokeConsent(ctx context.Context, userId uuid.UUID, clientId uuid.UUID) {
+	scope := middlewares.GetScope(ctx)
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	scopeRepository.DeleteGrants(ctx, userId, clientId)
+
+	// without the consent the client must not be able to get new tokens for the user
+	refreshTokenRepository := ioc.Get[repos.RefreshTokenRepository](scope)
+	refreshTokenRepository.DeleteRefreshTokens(ctx, userId, clientId)
+}
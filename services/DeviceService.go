@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/mssola/user_agent"
+	"holvit/config"
+	"holvit/constants"
 	"holvit/h"
+	"holvit/httpErrors"
 	"holvit/ioc"
 	"holvit/middlewares"
 	"holvit/repos"
 	"holvit/utils"
+	"html"
 )
 
 type IsKnownDeviceRequest struct {
@@ -29,7 +33,22 @@ type SendVerificationRequest struct {
 }
 
 type SendVerificationResponse struct {
-	Code string
+	// Token references the code that was sent, the code itself is only known to the user.
+	Token string
+}
+
+type ResendVerificationRequest struct {
+	Token     string
+	UserAgent string
+}
+
+type VerifyDeviceCodeRequest struct {
+	Token    string
+	RealmId  uuid.UUID
+	UserId   uuid.UUID
+	DeviceId string
+	Code     string
+	Ip       string
 }
 
 type AddDeviceRequest struct {
@@ -37,11 +56,18 @@ type AddDeviceRequest struct {
 	DeviceId  string
 	UserAgent string
 	Ip        string
+	// DisplayName is derived from the user agent if it is not set.
+	DisplayName h.Opt[string]
 }
 
 type DeviceService interface {
 	IsKnownUserDevice(ctx context.Context, request IsKnownDeviceRequest) IsKnownDeviceResponse
-	SendVerificationEmail(ctx context.Context, request SendVerificationRequest) SendVerificationResponse
+	// SendVerificationEmail sends a code to the verified email of the user that confirms a login from an unknown device.
+	SendVerificationEmail(ctx context.Context, request SendVerificationRequest) (*SendVerificationResponse, error)
+	// ResendVerificationEmail replaces a code with a new one, at most once per configured interval.
+	ResendVerificationEmail(ctx context.Context, request ResendVerificationRequest) (*SendVerificationResponse, error)
+	// VerifyCode checks a code, the code is discarded after too many wrong attempts.
+	VerifyCode(ctx context.Context, request VerifyDeviceCodeRequest) error
 	AddKnownDevice(ctx context.Context, request AddDeviceRequest) uuid.UUID
 }
 
@@ -63,9 +89,9 @@ func (d *deviceServiceImpl) AddKnownDevice(ctx context.Context, request AddDevic
 		return d.Id
 	}
 
-	ua := user_agent.New(request.UserAgent)
-	browser, browserVersion := ua.Browser()
-	displayName := fmt.Sprintf("%s %s", browser, browserVersion)
+	displayName := request.DisplayName.OrElseDefault(func() string {
+		return deviceDisplayName(request.UserAgent)
+	})
 
 	clockService := ioc.Get[utils.ClockService](scope)
 	now := clockService.Now()
@@ -82,24 +108,116 @@ func (d *deviceServiceImpl) AddKnownDevice(ctx context.Context, request AddDevic
 	return id
 }
 
-func (d *deviceServiceImpl) SendVerificationEmail(ctx context.Context, request SendVerificationRequest) SendVerificationResponse {
+func (d *deviceServiceImpl) SendVerificationEmail(ctx context.Context, request SendVerificationRequest) (*SendVerificationResponse, error) {
 	scope := middlewares.GetScope(ctx)
-	jobService := ioc.Get[JobService](scope)
 
-	num := utils.GenerateRandomNumber(999_999)
-	code := fmt.Sprintf("%d", num)
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, request.UserId).Unwrap()
 
-	//TODO: save the code in redis
+	email, ok := user.Email.Get()
+	if !ok || !user.EmailVerified {
+		return nil, httpErrors.Forbidden().WithMessage("a verified email is required to sign in from a new device")
+	}
 
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+
+	code := utils.GenerateNumericCode(constants.DeviceVerificationCodeLength)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	tokenService := ioc.Get[TokenService](scope)
+	token := tokenService.StoreDeviceVerification(ctx, DeviceVerificationInfo{
+		UserId:     user.Id,
+		DeviceId:   request.DeviceId,
+		HashedCode: utils.Sign(code, config.C.GetSymmetricEncryptionKey()),
+		SentAt:     now,
+		ExpiresAt:  now.Add(config.C.DeviceVerification.Expiry),
+	}, config.C.DeviceVerification.Expiry)
+
+	device := "a new device"
+	if request.UserAgent != "" {
+		device = deviceDisplayName(request.UserAgent)
+	}
+
+	jobService := ioc.Get[JobService](scope)
 	jobService.QueueJob(ctx, repos.SendMailJobDetails{
-		To:      nil,
-		Subject: "Device Verification Code",
-		Body:    fmt.Sprintf(`<html><body>Enter the following code:<br/>%v</body></html>`, code),
+		To:      []string{email},
+		Subject: fmt.Sprintf("New sign in to %s", realm.DisplayName),
+		Body: fmt.Sprintf(`<html><body>Someone is signing in to your account <b>%s</b> from %s.<br/>Enter the following code to confirm the new device:<br/><b>%s</b><br/>The code expires in %s. If this was not you, change your password.</body></html>`,
+			html.EscapeString(user.Username),
+			html.EscapeString(device),
+			html.EscapeString(code),
+			config.C.DeviceVerification.Expiry),
 	})
 
-	return SendVerificationResponse{
-		Code: code,
+	return &SendVerificationResponse{
+		Token: token,
+	}, nil
+}
+
+func (d *deviceServiceImpl) ResendVerificationEmail(ctx context.Context, request ResendVerificationRequest) (*SendVerificationResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	info, ok := tokenService.PeekDeviceVerification(ctx, request.Token).Get()
+	if ok {
+		clockService := ioc.Get[utils.ClockService](scope)
+		if clockService.Now().Before(info.SentAt.Add(config.C.DeviceVerification.ResendInterval)) {
+			return nil, httpErrors.TooManyRequests().WithMessage("the code was sent recently, please wait before requesting another one")
+		}
+	}
+
+	if _, ok := tokenService.RetrieveDeviceVerification(ctx, request.Token).Get(); !ok {
+		return nil, httpErrors.BadRequest().WithMessage("the code expired, please sign in again")
+	}
+
+	return d.SendVerificationEmail(ctx, SendVerificationRequest{
+		UserId:    info.UserId,
+		DeviceId:  info.DeviceId,
+		UserAgent: request.UserAgent,
+	})
+}
+
+func (d *deviceServiceImpl) VerifyCode(ctx context.Context, request VerifyDeviceCodeRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	info, ok := tokenService.PeekDeviceVerification(ctx, request.Token).Get()
+	if !ok || info.UserId != request.UserId || info.DeviceId != request.DeviceId {
+		return httpErrors.Unauthorized().WithMessage("the code expired, please request a new one")
+	}
+
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: request.RealmId,
+		UserId:  request.UserId,
+		Ip:      request.Ip,
 	}
+	err := bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		return err
+	}
+
+	if !utils.VerifySignature(request.Code, info.HashedCode, config.C.GetSymmetricEncryptionKey()) {
+		bruteForceService.RecordFailure(ctx, attempt)
+		info.Attempts++
+		if info.Attempts >= config.C.DeviceVerification.MaxAttempts {
+			// too many wrong guesses, the user has to request a new code
+			tokenService.RetrieveDeviceVerification(ctx, request.Token)
+		} else {
+			clockService := ioc.Get[utils.ClockService](scope)
+			tokenService.OverwriteDeviceVerification(ctx, request.Token, info, info.ExpiresAt.Sub(clockService.Now()))
+		}
+		return httpErrors.Unauthorized().WithMessage("invalid code")
+	}
+
+	if _, ok := tokenService.RetrieveDeviceVerification(ctx, request.Token).Get(); !ok {
+		return httpErrors.Unauthorized().WithMessage("the code expired, please request a new one")
+	}
+
+	return nil
 }
 
 func (d *deviceServiceImpl) IsKnownUserDevice(ctx context.Context, request IsKnownDeviceRequest) IsKnownDeviceResponse {
@@ -128,3 +246,18 @@ func (d *deviceServiceImpl) IsKnownUserDevice(ctx context.Context, request IsKno
 		Id:                   h.None[uuid.UUID](),
 	}
 }
+
+// deviceDisplayName describes a device by its browser and operating system, e.g. "Firefox 128.0 on Linux".
+func deviceDisplayName(userAgent string) string {
+	ua := user_agent.New(userAgent)
+	browser, browserVersion := ua.Browser()
+	if browser == "" {
+		return "Unknown device"
+	}
+
+	name := fmt.Sprintf("%s %s", browser, browserVersion)
+	if os := ua.OSInfo().Name; os != "" {
+		name += " on " + os
+	}
+	return name
+}
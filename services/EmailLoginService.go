@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/utils"
+	"html"
+	"net/url"
+	"strings"
+)
+
+type StartEmailLoginRequest struct {
+	LoginToken string
+	Email      string
+	RememberMe bool
+}
+
+type VerifyEmailLoginCodeRequest struct {
+	LoginToken string
+	Code       string
+	Ip         string
+}
+
+type VerifyMagicLinkRequest struct {
+	RealmName string
+	Token     string
+	Signature string
+	Ip        string
+}
+
+type EmailLoginResult struct {
+	LoginToken string
+	UserId     uuid.UUID
+}
+
+// EmailLoginService implements the passwordless login of a realm, the user receives either a short code
+// or a single-use magic link by email depending on the EmailLoginMode of the realm.
+type EmailLoginService interface {
+	// StartLogin sends the code or magic link and moves the login to the verify_email_login step.
+	// It behaves the same whether the email belongs to a user or not. Sending again replaces the previous code,
+	// but only after the resend interval and without resetting the wrong attempts of the login.
+	StartLogin(ctx context.Context, request StartEmailLoginRequest) error
+	VerifyCode(ctx context.Context, request VerifyEmailLoginCodeRequest) (*EmailLoginResult, error)
+	VerifyMagicLink(ctx context.Context, request VerifyMagicLinkRequest) (*EmailLoginResult, error)
+}
+
+type emailLoginServiceImpl struct{}
+
+func NewEmailLoginService() EmailLoginService {
+	return &emailLoginServiceImpl{}
+}
+
+func (s *emailLoginServiceImpl) StartLogin(ctx context.Context, request StartEmailLoginRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, request.LoginToken).Get()
+	if !ok {
+		return httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	err := loginInfo.ExpectStep(constants.AuthenticateStepVerifyEmailLogin)
+	if err != nil {
+		return err
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, loginInfo.RealmId).Unwrap()
+
+	if realm.EmailLoginMode == constants.EmailLoginModeDisabled {
+		return httpErrors.BadRequest().WithMessage("realm does not allow email login")
+	}
+	if request.RememberMe && !realm.EnableRememberMe {
+		return httpErrors.BadRequest().WithMessage("realm does not allow remember me")
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	attempts := 0
+	if previous, ok := tokenService.PeekEmailLogin(ctx, loginInfo.EmailLoginToken).Get(); ok && loginInfo.EmailLoginToken != "" {
+		if previous.Attempts >= config.C.EmailLogin.MaxAttempts {
+			return httpErrors.Unauthorized().WithMessage("too many wrong codes, please sign in again")
+		}
+		if now.Before(previous.SentAt.Add(config.C.EmailLogin.ResendInterval)) {
+			return httpErrors.TooManyRequests().WithMessage("the email was sent recently, please wait before requesting another one")
+		}
+		attempts = previous.Attempts
+	}
+
+	// throttled per email as well, a new login must not be a way around the interval
+	if !s.reserveEmail(ctx, realm.Id, request.Email) {
+		return httpErrors.TooManyRequests().WithMessage("the email was sent recently, please wait before requesting another one")
+	}
+
+	// the previous code or link can no longer be used
+	if loginInfo.EmailLoginToken != "" {
+		tokenService.RetrieveEmailLogin(ctx, loginInfo.EmailLoginToken)
+	}
+
+	user, userFound := findUserByEmail(ctx, realm.Id, request.Email).Get()
+	userFound = userFound && user.Enabled
+	// once the login knows the user, the email login can only be used to verify their own email
+	if loginInfo.UserId != uuid.Nil {
+		userFound = userFound && user.Id == loginInfo.UserId
+	}
+
+	key := config.C.GetSymmetricEncryptionKey()
+
+	info := EmailLoginInfo{
+		RealmId:    realm.Id,
+		LoginToken: request.LoginToken,
+		Attempts:   attempts,
+		SentAt:     now,
+		ExpiresAt:  now.Add(config.C.EmailLogin.Expiry),
+	}
+	if userFound {
+		info.UserId = user.Id
+	}
+
+	var code string
+	if realm.EmailLoginMode == constants.EmailLoginModeCode {
+		code = utils.GenerateNumericCode(constants.EmailLoginCodeLength)
+		info.HashedCode = utils.Sign(code, key)
+	}
+
+	token := tokenService.StoreEmailLogin(ctx, info, config.C.EmailLogin.Expiry)
+
+	if userFound {
+		var body string
+		switch realm.EmailLoginMode {
+		case constants.EmailLoginModeCode:
+			body = fmt.Sprintf(`<html><body>Your sign in code for %s is:<br/><b>%s</b><br/>The code expires in %s.</body></html>`,
+				html.EscapeString(realm.DisplayName),
+				html.EscapeString(code),
+				config.C.EmailLogin.Expiry)
+		case constants.EmailLoginModeMagicLink:
+			link := routes.AuthMagicLink.Url(realm.Name) + "?" + url.Values{
+				"token":     {token},
+				"signature": {utils.Sign(token, key)},
+			}.Encode()
+			body = fmt.Sprintf(`<html><body><a href="%s">Sign in to %s</a><br/>The link can only be used once and expires in %s.</body></html>`,
+				html.EscapeString(link),
+				html.EscapeString(realm.DisplayName),
+				config.C.EmailLogin.Expiry)
+		}
+
+		jobService := ioc.Get[JobService](scope)
+		jobService.QueueJob(ctx, repos.SendMailJobDetails{
+			To:      []string{user.Email.Unwrap()},
+			Subject: fmt.Sprintf("Sign in to %s", realm.DisplayName),
+			Body:    body,
+		})
+	} else {
+		logging.Logger.Debugf("email login requested for unknown email in realm %s", realm.Name)
+	}
+
+	currentUser := ioc.Get[CurrentSessionService](scope)
+
+	loginInfo.DeviceId = currentUser.DeviceIdString()
+	loginInfo.RememberMe = request.RememberMe
+	loginInfo.EmailLoginToken = token
+	loginInfo.NextStep = constants.AuthenticateStepVerifyEmailLogin
+
+	result := tokenService.OverwriteLoginCode(ctx, request.LoginToken, loginInfo)
+	if result.IsErr() {
+		return result.UnwrapErr()
+	}
+
+	return nil
+}
+
+func (s *emailLoginServiceImpl) VerifyCode(ctx context.Context, request VerifyEmailLoginCodeRequest) (*EmailLoginResult, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	loginInfo, err := s.getPendingLogin(ctx, request.LoginToken)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := tokenService.PeekEmailLogin(ctx, loginInfo.EmailLoginToken).Get()
+	if !ok || info.LoginToken != request.LoginToken {
+		return nil, httpErrors.Unauthorized().WithMessage("the code expired, please request a new one")
+	}
+	if info.HashedCode == "" {
+		return nil, httpErrors.BadRequest().WithMessage("the login has to be completed with the magic link")
+	}
+	if info.Attempts >= config.C.EmailLogin.MaxAttempts {
+		return nil, httpErrors.Unauthorized().WithMessage("too many wrong codes, please sign in again")
+	}
+
+	// only the ip address is tracked for unknown emails
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: info.RealmId,
+		UserId:  info.UserId,
+		Ip:      request.Ip,
+	}
+	err = bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := config.C.GetSymmetricEncryptionKey()
+	if info.UserId == uuid.Nil || !utils.VerifySignature(request.Code, info.HashedCode, key) {
+		bruteForceService.RecordFailure(ctx, attempt)
+		// the email login is kept after too many wrong guesses, so that sending a new code does not reset them
+		info.Attempts++
+		clockService := ioc.Get[utils.ClockService](scope)
+		tokenService.OverwriteEmailLogin(ctx, loginInfo.EmailLoginToken, info, info.ExpiresAt.Sub(clockService.Now()))
+		return nil, httpErrors.Unauthorized().WithMessage("invalid code")
+	}
+
+	if _, ok := tokenService.RetrieveEmailLogin(ctx, loginInfo.EmailLoginToken).Get(); !ok {
+		return nil, httpErrors.Unauthorized().WithMessage("the code expired, please request a new one")
+	}
+
+	return &EmailLoginResult{
+		LoginToken: request.LoginToken,
+		UserId:     info.UserId,
+	}, nil
+}
+
+func (s *emailLoginServiceImpl) VerifyMagicLink(ctx context.Context, request VerifyMagicLinkRequest) (*EmailLoginResult, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(request.RealmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("invalid link")
+	}
+
+	// the user is not known before the link is checked, so only the ip address is tracked
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: realm.Id,
+		Ip:      request.Ip,
+	}
+	err := bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := config.C.GetSymmetricEncryptionKey()
+	if !utils.VerifySignature(request.Token, request.Signature, key) {
+		bruteForceService.RecordFailure(ctx, attempt)
+		return nil, httpErrors.BadRequest().WithMessage("invalid link")
+	}
+
+	tokenService := ioc.Get[TokenService](scope)
+	info, ok := tokenService.PeekEmailLogin(ctx, request.Token).Get()
+	if !ok || info.HashedCode != "" || info.UserId == uuid.Nil || info.RealmId != realm.Id {
+		return nil, httpErrors.BadRequest().WithMessage("the link expired or was already used")
+	}
+
+	loginInfo, err := s.getPendingLogin(ctx, info.LoginToken)
+	if err != nil {
+		return nil, err
+	}
+	if loginInfo.EmailLoginToken != request.Token {
+		return nil, httpErrors.BadRequest().WithMessage("the link expired or was already used")
+	}
+
+	// the link can only be used once
+	if _, ok := tokenService.RetrieveEmailLogin(ctx, request.Token).Get(); !ok {
+		return nil, httpErrors.BadRequest().WithMessage("the link expired or was already used")
+	}
+
+	return &EmailLoginResult{
+		LoginToken: info.LoginToken,
+		UserId:     info.UserId,
+	}, nil
+}
+
+// reserveEmail reports whether a code or link can be sent to the email, at most one is sent per resend interval.
+// Unknown emails are throttled the same way so that the responses do not reveal which emails are known.
+func (s *emailLoginServiceImpl) reserveEmail(ctx context.Context, realmId uuid.UUID, email string) bool {
+	scope := middlewares.GetScope(ctx)
+	redisClient := ioc.Get[*redis.Client](scope)
+
+	key := "emailLoginSent:" + realmId.String() + ":" + strings.ToLower(strings.TrimSpace(email))
+	logging.Logger.Debugf("storing redis: %s", key)
+
+	reserved, err := redisClient.SetNX(ctx, key, "", config.C.EmailLogin.ResendInterval).Result()
+	if err != nil {
+		panic(err)
+	}
+
+	return reserved
+}
+
+// getPendingLogin returns the login waiting for the email login, it has to continue on the device it was started on.
+func (s *emailLoginServiceImpl) getPendingLogin(ctx context.Context, loginToken string) (*LoginInfo, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, loginToken).Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	currentUser := ioc.Get[CurrentSessionService](scope)
+	if currentUser.DeviceIdString() != loginInfo.DeviceId {
+		return nil, httpErrors.Unauthorized().WithMessage("the login has to be completed in the browser it was started in")
+	}
+
+	if loginInfo.NextStep != constants.AuthenticateStepVerifyEmailLogin {
+		return nil, httpErrors.Unauthorized().WithMessage(
+			fmt.Sprintf("wrong login step '%s', expected '%s'", loginInfo.NextStep, constants.AuthenticateStepVerifyEmailLogin))
+	}
+
+	return &loginInfo, nil
+}
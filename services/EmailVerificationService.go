@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/utils"
+	"html"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type VerifyEmailRequest struct {
+	RealmName string
+	UserId    string
+	Expires   string
+	Signature string
+}
+
+// EmailVerificationService verifies that users own their email address with a signed link.
+// The link is bound to the address it was sent to, so it stops working once the email of the user changes.
+type EmailVerificationService interface {
+	SendVerificationEmail(ctx context.Context, userId uuid.UUID) error
+	// VerifyEmail checks a verification link and marks the email of the user as verified.
+	VerifyEmail(ctx context.Context, request VerifyEmailRequest) (*repos.User, error)
+}
+
+type emailVerificationServiceImpl struct{}
+
+func NewEmailVerificationService() EmailVerificationService {
+	return &emailVerificationServiceImpl{}
+}
+
+func (s *emailVerificationServiceImpl) SendVerificationEmail(ctx context.Context, userId uuid.UUID) error {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok {
+		return httpErrors.NotFound().WithMessage("user not found")
+	}
+
+	email, ok := user.Email.Get()
+	if !ok {
+		return httpErrors.BadRequest().WithMessage("the user does not have an email")
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	expires := strconv.FormatInt(clockService.Now().Add(config.C.EmailVerification.LinkExpiry).Unix(), 10)
+
+	link := routes.AuthVerifyEmail.Url(realm.Name) + "?" + url.Values{
+		"user":      {user.Id.String()},
+		"expires":   {expires},
+		"signature": {utils.Sign(verificationPayload(user.Id.String(), email, expires), config.C.GetSymmetricEncryptionKey())},
+	}.Encode()
+
+	jobService := ioc.Get[JobService](scope)
+	jobService.QueueJob(ctx, repos.SendMailJobDetails{
+		To:      []string{email},
+		Subject: fmt.Sprintf("Verify your email for %s", realm.DisplayName),
+		Body: fmt.Sprintf(`<html><body>Please confirm that <b>%s</b> is the email of your account <b>%s</b>.<br/><a href="%s">Verify email</a><br/>The link expires in %s.</body></html>`,
+			html.EscapeString(email),
+			html.EscapeString(user.Username),
+			html.EscapeString(link),
+			config.C.EmailVerification.LinkExpiry),
+	})
+
+	return nil
+}
+
+func (s *emailVerificationServiceImpl) VerifyEmail(ctx context.Context, request VerifyEmailRequest) (*repos.User, error) {
+	scope := middlewares.GetScope(ctx)
+
+	invalidErr := httpErrors.BadRequest().WithMessage("the link is invalid or expired")
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(request.RealmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	userId, err := uuid.Parse(request.UserId)
+	if err != nil {
+		return nil, invalidErr
+	}
+
+	expires, err := strconv.ParseInt(request.Expires, 10, 64)
+	if err != nil {
+		return nil, invalidErr
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	if !clockService.Now().Before(time.Unix(expires, 0)) {
+		return nil, invalidErr
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || user.RealmId != realm.Id {
+		return nil, invalidErr
+	}
+
+	email, ok := user.Email.Get()
+	if !ok {
+		return nil, invalidErr
+	}
+
+	if !utils.VerifySignature(verificationPayload(request.UserId, email, request.Expires), request.Signature, config.C.GetSymmetricEncryptionKey()) {
+		return nil, invalidErr
+	}
+
+	if !user.EmailVerified {
+		result := userRepository.UpdateUser(ctx, user.Id, repos.UserUpdate{
+			EmailVerified: h.Some(true),
+		})
+		if result.IsErr() {
+			return nil, result.UnwrapErr()
+		}
+		user.EmailVerified = true
+	}
+
+	return &user, nil
+}
+
+func verificationPayload(userId string, email string, expires string) string {
+	return userId + "|" + email + "|" + expires
+}
@@ -121,18 +121,55 @@ type AuthFrontendDataAuthorize struct {
 	GrantUrl   string              `json:"grantUrl"`
 }
 
+type AuthFrontendIdentityProvider struct {
+	Alias       string `json:"alias"`
+	DisplayName string `json:"displayName"`
+	LoginUrl    string `json:"loginUrl"`
+}
+
 type AuthFrontendDataAuthenticate struct {
-	ClientName       string `json:"clientName"`
-	Token            string `json:"token"`
-	UseRememberMe    bool   `json:"useRememberMe"`
-	RegisterUrl      string `json:"registerUrl"`
-	LoginCompleteUrl string `json:"loginCompleteUrl"`
+	ClientName        string                         `json:"clientName"`
+	Token             string                         `json:"token"`
+	UseRememberMe     bool                           `json:"useRememberMe"`
+	LoginCompleteUrl  string                         `json:"loginCompleteUrl"`
+	IdentityProviders []AuthFrontendIdentityProvider `json:"identityProviders"`
+	EmailLoginMode    string                         `json:"emailLoginMode"`
+	// RegisterUrl is empty if the realm does not allow registration.
+	RegisterUrl       string `json:"registerUrl"`
+	RequireUsername   bool   `json:"requireUsername"`
+	RequireEmail      bool   `json:"requireEmail"`
+	ForgotPasswordUrl string `json:"forgotPasswordUrl"`
+	// NextStep is set when the frontend resumes a login that is already past the first step.
+	NextStep string `json:"nextStep,omitempty"`
+	// AllowedSteps are the other steps the authentication flow lets the user continue with instead of NextStep.
+	AllowedSteps []string `json:"allowedSteps,omitempty"`
+}
+
+type AuthFrontendDataCiba struct {
+	ClientName     string              `json:"clientName"`
+	User           AuthFrontendUser    `json:"user"`
+	BindingMessage string              `json:"bindingMessage"`
+	Scopes         []AuthFrontendScope `json:"scopes"`
+	Token          string              `json:"token"`
+	DecisionUrl    string              `json:"decisionUrl"`
+}
+
+type AuthFrontendDataResetPassword struct {
+	Token    string `json:"token"`
+	ResetUrl string `json:"resetUrl"`
+}
+
+type AuthFrontendDataEmailVerified struct {
+	Email string `json:"email"`
 }
 
 type AuthFrontendData struct {
-	Mode         string                        `json:"mode"`
-	Authorize    *AuthFrontendDataAuthorize    `json:"authorize"`
-	Authenticate *AuthFrontendDataAuthenticate `json:"authenticate"`
+	Mode          string                         `json:"mode"`
+	Authorize     *AuthFrontendDataAuthorize     `json:"authorize"`
+	Authenticate  *AuthFrontendDataAuthenticate  `json:"authenticate"`
+	Ciba          *AuthFrontendDataCiba          `json:"ciba"`
+	ResetPassword *AuthFrontendDataResetPassword `json:"resetPassword"`
+	EmailVerified *AuthFrontendDataEmailVerified `json:"emailVerified"`
 }
 
 type Script struct {
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"slices"
+	"strings"
+)
+
+type CreateGroupRequest struct {
+	RealmId     uuid.UUID
+	ParentId    h.Opt[uuid.UUID]
+	Name        string
+	DisplayName h.Opt[string]
+	Description h.Opt[string]
+}
+
+type UpdateGroupRequest struct {
+	RealmId uuid.UUID
+	GroupId uuid.UUID
+	// ParentId moves the group, None moves it to the top level.
+	ParentId    h.Opt[h.Opt[uuid.UUID]]
+	Name        h.Opt[string]
+	DisplayName h.Opt[string]
+	Description h.Opt[string]
+}
+
+type SetGroupRolesRequest struct {
+	RealmId uuid.UUID
+	GroupId uuid.UUID
+	RoleIds []uuid.UUID
+}
+
+type InvalidGroupNameError struct{}
+
+func (e InvalidGroupNameError) Error() string {
+	return "Group names must not be empty or contain '/'"
+}
+
+type ParentGroupNotFoundError struct{}
+
+func (e ParentGroupNotFoundError) Error() string {
+	return "Parent group not found"
+}
+
+type CircularGroupError struct{}
+
+func (e CircularGroupError) Error() string {
+	return "A group can not be moved below itself"
+}
+
+type GroupService interface {
+	CreateGroup(ctx context.Context, request CreateGroupRequest) h.Result[uuid.UUID]
+	// UpdateGroup renames and moves a group, the paths of its descendants change with it.
+	UpdateGroup(ctx context.Context, request UpdateGroupRequest) h.UResult
+	// SetGroupRoles replaces the roles of a group, members and child groups inherit them.
+	SetGroupRoles(ctx context.Context, request SetGroupRolesRequest) h.UResult
+}
+
+func NewGroupService() GroupService {
+	return &groupServiceImpl{}
+}
+
+type groupServiceImpl struct{}
+
+func (s *groupServiceImpl) CreateGroup(ctx context.Context, request CreateGroupRequest) h.Result[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+
+	if !isValidGroupName(request.Name) {
+		return h.Err[uuid.UUID](InvalidGroupNameError{})
+	}
+
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+
+	parentPath := ""
+	var rolesCache []uuid.UUID
+	if parentId, ok := request.ParentId.Get(); ok {
+		parent, ok := groupRepository.FindGroupById(ctx, parentId).Get()
+		if !ok || parent.RealmId != request.RealmId {
+			return h.Err[uuid.UUID](ParentGroupNotFoundError{})
+		}
+		parentPath = parent.Path
+		// a new group has no roles of its own, it only inherits the ones of its parent
+		rolesCache = parent.RolesCache
+	}
+
+	return groupRepository.CreateGroup(ctx, repos.Group{
+		RealmId:     request.RealmId,
+		ParentId:    request.ParentId,
+		Name:        request.Name,
+		DisplayName: request.DisplayName.OrDefault(request.Name),
+		Description: request.Description.OrDefault(""),
+		Path:        parentPath + "/" + request.Name,
+		RolesCache:  rolesCache,
+	})
+}
+
+func (s *groupServiceImpl) UpdateGroup(ctx context.Context, request UpdateGroupRequest) h.UResult {
+	scope := middlewares.GetScope(ctx)
+
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+	group := groupRepository.FindGroupById(ctx, request.GroupId).Unwrap()
+
+	name := request.Name.OrDefault(group.Name)
+	if !isValidGroupName(name) {
+		return h.UErr(InvalidGroupNameError{})
+	}
+
+	parentId := group.ParentId
+	moved := false
+	request.ParentId.IfSome(func(x h.Opt[uuid.UUID]) {
+		moved = x.UnwrapOrEmpty() != group.ParentId.UnwrapOrEmpty() || x.IsSome() != group.ParentId.IsSome()
+		parentId = x
+	})
+
+	parentPath := group.Path[:strings.LastIndex(group.Path, "/")]
+	if moved {
+		parentPath = ""
+		if newParentId, ok := parentId.Get(); ok {
+			parent, ok := groupRepository.FindGroupById(ctx, newParentId).Get()
+			if !ok || parent.RealmId != request.RealmId {
+				return h.UErr(ParentGroupNotFoundError{})
+			}
+			if parent.Path == group.Path || strings.HasPrefix(parent.Path, group.Path+"/") {
+				return h.UErr(CircularGroupError{})
+			}
+			parentPath = parent.Path
+		}
+	}
+
+	if path := parentPath + "/" + name; path != group.Path {
+		result := groupRepository.MoveGroupPaths(ctx, request.RealmId, group.Path, path)
+		if result.IsErr() {
+			return result
+		}
+	}
+
+	upd := repos.GroupUpdate{
+		Name:        request.Name,
+		DisplayName: request.DisplayName,
+		Description: request.Description,
+	}
+	if moved {
+		upd.ParentId = h.Some(parentId)
+	}
+	groupRepository.UpdateGroup(ctx, group.Id, upd).Unwrap()
+
+	// the group and its descendants inherit the roles of the new parent
+	if moved {
+		roleService := ioc.Get[RoleService](scope)
+		roleService.RecalculateCache(ctx, request.RealmId)
+	}
+
+	return h.UOk()
+}
+
+func (s *groupServiceImpl) SetGroupRoles(ctx context.Context, request SetGroupRolesRequest) h.UResult {
+	scope := middlewares.GetScope(ctx)
+
+	request.RoleIds = slices.Clone(request.RoleIds)
+	slices.SortFunc(request.RoleIds, func(a uuid.UUID, b uuid.UUID) int {
+		return slices.Compare(a[:], b[:])
+	})
+	request.RoleIds = slices.Compact(request.RoleIds)
+
+	rolesRepository := ioc.Get[repos.RoleRepository](scope)
+	roles := rolesRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: request.RealmId,
+		RoleIds: h.Some(request.RoleIds),
+	})
+	if len(roles.Values()) != len(request.RoleIds) {
+		return h.UErr(WrongRealmRoleError{})
+	}
+
+	groupRoleRepository := ioc.Get[repos.GroupRoleRepository](scope)
+	existing := groupRoleRepository.FindGroupRoles(ctx, repos.GroupRoleFilter{
+		GroupId: h.Some(request.GroupId),
+	})
+
+	for _, groupRole := range existing {
+		if !slices.Contains(request.RoleIds, groupRole.RoleId) {
+			groupRoleRepository.DeleteGroupRole(ctx, groupRole.Id)
+		}
+	}
+
+	groupRoles := make([]repos.GroupRole, 0, len(request.RoleIds))
+	for _, roleId := range request.RoleIds {
+		groupRoles = append(groupRoles, repos.GroupRole{
+			GroupId: request.GroupId,
+			RoleId:  roleId,
+		})
+	}
+	if len(groupRoles) > 0 {
+		groupRoleRepository.CreateGroupRoles(ctx, groupRoles)
+	}
+
+	roleService := ioc.Get[RoleService](scope)
+	roleService.RecalculateCache(ctx, request.RealmId)
+
+	return h.UOk()
+}
+
+func isValidGroupName(name string) bool {
+	return name != "" && !strings.Contains(name, "/")
+}
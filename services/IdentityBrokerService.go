@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/broker"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/utils"
+	"html"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+type CreateIdentityProviderRequest struct {
+	RealmId       uuid.UUID
+	Alias         string
+	DisplayName   string
+	Issuer        string
+	ClientId      string
+	ClientSecret  string
+	Scopes        []string
+	ClaimMappings map[string]string
+	TrustEmail    bool
+	Enabled       bool
+}
+
+type StartBrokerLoginRequest struct {
+	RealmName  string
+	Alias      string
+	LoginToken string
+}
+
+type CompleteBrokerLoginRequest struct {
+	RealmName string
+	Alias     string
+	State     string
+	Code      string
+	Error     string
+}
+
+type BrokerLoginResult struct {
+	LoginToken string
+	UserId     uuid.UUID
+}
+
+type IdentityBrokerService interface {
+	CreateIdentityProvider(ctx context.Context, request CreateIdentityProviderRequest) h.Result[uuid.UUID]
+	LoginOptions(ctx context.Context, realm repos.Realm, loginToken string) []AuthFrontendIdentityProvider
+
+	// StartLogin returns the url the user is sent to for signing in at the upstream identity provider.
+	// A login that already knows which user signs in can only link the upstream identity to that user once its
+	// authentication flow is complete.
+	StartLogin(ctx context.Context, request StartBrokerLoginRequest) (string, error)
+	// CompleteLogin finds, links or provisions the user of the upstream identity.
+	// The login continues with the steps of its authentication flow that come after the broker login.
+	CompleteLogin(ctx context.Context, request CompleteBrokerLoginRequest) (BrokerLoginResult, error)
+}
+
+type identityBrokerServiceImpl struct{}
+
+func NewIdentityBrokerService() IdentityBrokerService {
+	return &identityBrokerServiceImpl{}
+}
+
+func brokerHttpClient() *http.Client {
+	return &http.Client{
+		Timeout: config.C.Broker.RequestTimeout,
+	}
+}
+
+func (i *identityBrokerServiceImpl) CreateIdentityProvider(ctx context.Context, request CreateIdentityProviderRequest) h.Result[uuid.UUID] {
+	scope := middlewares.GetScope(ctx)
+
+	scopes := request.Scopes
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	key := config.C.GetSymmetricEncryptionKey()
+	encryptedClientSecret := utils.EncryptSymmetric([]byte(request.ClientSecret), key)
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	return identityProviderRepository.CreateIdentityProvider(ctx, repos.IdentityProvider{
+		RealmId:               request.RealmId,
+		Alias:                 request.Alias,
+		DisplayName:           request.DisplayName,
+		Issuer:                request.Issuer,
+		ClientId:              request.ClientId,
+		EncryptedClientSecret: encryptedClientSecret,
+		Scopes:                scopes,
+		ClaimMappings:         request.ClaimMappings,
+		TrustEmail:            request.TrustEmail,
+		Enabled:               request.Enabled,
+	})
+}
+
+func (i *identityBrokerServiceImpl) LoginOptions(ctx context.Context, realm repos.Realm, loginToken string) []AuthFrontendIdentityProvider {
+	scope := middlewares.GetScope(ctx)
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	identityProviders := identityProviderRepository.FindIdentityProviders(ctx, repos.IdentityProviderFilter{
+		RealmId: h.Some(realm.Id),
+		Enabled: h.Some(true),
+	})
+
+	options := make([]AuthFrontendIdentityProvider, 0, len(identityProviders.Values()))
+	for _, identityProvider := range identityProviders.Values() {
+		options = append(options, AuthFrontendIdentityProvider{
+			Alias:       identityProvider.Alias,
+			DisplayName: identityProvider.DisplayName,
+			LoginUrl:    routes.AuthBrokerLogin.Url(realm.Name, identityProvider.Alias) + "?token=" + url.QueryEscape(loginToken),
+		})
+	}
+
+	return options
+}
+
+func (i *identityBrokerServiceImpl) findIdentityProvider(ctx context.Context, realmName string, alias string) (repos.Realm, repos.IdentityProvider, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, repos.IdentityProvider{}, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	identityProviderRepository := ioc.Get[repos.IdentityProviderRepository](scope)
+	identityProvider, ok := identityProviderRepository.FindIdentityProviders(ctx, repos.IdentityProviderFilter{
+		RealmId: h.Some(realm.Id),
+		Alias:   h.Some(alias),
+		Enabled: h.Some(true),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, repos.IdentityProvider{}, httpErrors.NotFound().WithMessage("identity provider not found")
+	}
+
+	return realm, identityProvider, nil
+}
+
+func (i *identityBrokerServiceImpl) StartLogin(ctx context.Context, request StartBrokerLoginRequest) (string, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realm, identityProvider, err := i.findIdentityProvider(ctx, request.RealmName, request.Alias)
+	if err != nil {
+		return "", err
+	}
+
+	tokenService := ioc.Get[TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, request.LoginToken).Get()
+	if !ok || loginInfo.RealmId != realm.Id {
+		return "", httpErrors.BadRequest().WithMessage("token not found")
+	}
+	// a user that completed the authentication flow proved that they own the account, so they can link the upstream identity to it
+	if !canLinkIdentity(loginInfo) {
+		err = loginInfo.ExpectStep(constants.AuthenticateStepBrokerLogin)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	metadata, err := broker.Discover(ctx, brokerHttpClient(), identityProvider.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := utils.GenerateRandomStringBase64(32)
+	codeVerifier := broker.NewCodeVerifier()
+
+	state := tokenService.StoreBrokerState(ctx, BrokerStateInfo{
+		RealmId:            realm.Id,
+		IdentityProviderId: identityProvider.Id,
+		LoginToken:         request.LoginToken,
+		Nonce:              nonce,
+		CodeVerifier:       codeVerifier,
+	})
+
+	return broker.AuthorizationUrl(metadata, broker.AuthorizationParams{
+		ClientId:     identityProvider.ClientId,
+		RedirectUri:  routes.AuthBrokerCallback.Url(realm.Name, identityProvider.Alias),
+		Scopes:       identityProvider.Scopes,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+	})
+}
+
+func (i *identityBrokerServiceImpl) CompleteLogin(ctx context.Context, request CompleteBrokerLoginRequest) (BrokerLoginResult, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realm, identityProvider, err := i.findIdentityProvider(ctx, request.RealmName, request.Alias)
+	if err != nil {
+		return BrokerLoginResult{}, err
+	}
+
+	tokenService := ioc.Get[TokenService](scope)
+	state, ok := tokenService.RetrieveBrokerState(ctx, request.State).Get()
+	if !ok || state.RealmId != realm.Id || state.IdentityProviderId != identityProvider.Id {
+		return BrokerLoginResult{}, httpErrors.BadRequest().WithMessage("invalid state")
+	}
+
+	if request.Error != "" {
+		return BrokerLoginResult{}, httpErrors.Unauthorized().WithMessage(fmt.Sprintf("login at %s failed: %s", identityProvider.DisplayName, request.Error))
+	}
+
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, state.LoginToken).Get()
+	if !ok {
+		return BrokerLoginResult{}, httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	claims, err := i.fetchClaims(ctx, realm, identityProvider, state, request.Code)
+	if err != nil {
+		logging.Logger.Warnf("login at identity provider %s failed: %s", identityProvider.Alias, err)
+		return BrokerLoginResult{}, httpErrors.Unauthorized().WithMessage(fmt.Sprintf("login at %s failed", identityProvider.DisplayName))
+	}
+
+	attributes := broker.MapClaims(identityProvider.ClaimMappings, claims)
+
+	userId, err := i.findOrProvisionUser(ctx, realm, identityProvider, attributes, loginInfo.UserId, canLinkIdentity(loginInfo))
+	if err != nil {
+		return BrokerLoginResult{}, err
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	if user, ok := userRepository.FindUserById(ctx, userId).Get(); !ok || !user.Enabled {
+		return BrokerLoginResult{}, httpErrors.Unauthorized().WithMessage("the user is disabled")
+	}
+
+	currentUser := ioc.Get[CurrentSessionService](scope)
+	loginInfo.DeviceId = currentUser.DeviceIdString()
+
+	result := tokenService.OverwriteLoginCode(ctx, state.LoginToken, loginInfo)
+	if result.IsErr() {
+		return BrokerLoginResult{}, result.UnwrapErr()
+	}
+
+	return BrokerLoginResult{
+		LoginToken: state.LoginToken,
+		UserId:     userId,
+	}, nil
+}
+
+func (i *identityBrokerServiceImpl) fetchClaims(ctx context.Context, realm repos.Realm, identityProvider repos.IdentityProvider, state BrokerStateInfo, code string) (broker.Claims, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if code == "" {
+		return nil, errors.New("missing code")
+	}
+
+	client := brokerHttpClient()
+
+	metadata, err := broker.Discover(ctx, client, identityProvider.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	key := config.C.GetSymmetricEncryptionKey()
+	clientSecret := utils.DecryptSymmetric(identityProvider.EncryptedClientSecret, key)
+
+	tokenResponse, err := broker.ExchangeCode(ctx, client, metadata, broker.TokenRequest{
+		ClientId:     identityProvider.ClientId,
+		ClientSecret: string(clientSecret),
+		Code:         code,
+		RedirectUri:  routes.AuthBrokerCallback.Url(realm.Name, identityProvider.Alias),
+		CodeVerifier: state.CodeVerifier,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jwks, err := broker.FetchJwks(ctx, client, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	claims, err := broker.VerifyIdToken(tokenResponse.IdToken, jwks, broker.IdTokenExpectations{
+		Issuer:   identityProvider.Issuer,
+		ClientId: identityProvider.ClientId,
+		Nonce:    state.Nonce,
+		Now:      clockService.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.UserInfoEndpoint == "" || tokenResponse.AccessToken == "" {
+		return claims, nil
+	}
+
+	userInfo, err := broker.FetchUserInfo(ctx, client, metadata, tokenResponse.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// the userinfo response has to be about the same user as the id token
+	if userInfo.String("sub") != claims.String("sub") {
+		return nil, errors.New("userinfo subject does not match the id token")
+	}
+
+	return claims.Merge(userInfo), nil
+}
+
+// canLinkIdentity only allows linking once the user passed every step of the authentication flow,
+// a password alone does not prove enough to add another way of signing in.
+func canLinkIdentity(loginInfo LoginInfo) bool {
+	return loginInfo.UserId != uuid.Nil && loginInfo.IsStepAllowed(constants.AuthenticateStepSubmit)
+}
+
+// findOrProvisionUser returns the user linked to the upstream identity.
+// Unknown identities are linked to the user the login already identified if link is set, otherwise a new user is created.
+// They are never linked to an existing user by email, the user has to sign in to that account first.
+func (i *identityBrokerServiceImpl) findOrProvisionUser(ctx context.Context, realm repos.Realm, identityProvider repos.IdentityProvider, attributes broker.Attributes, identifiedUserId uuid.UUID, link bool) (uuid.UUID, error) {
+	scope := middlewares.GetScope(ctx)
+
+	federatedIdentityRepository := ioc.Get[repos.FederatedIdentityRepository](scope)
+	federatedIdentity, ok := federatedIdentityRepository.FindFederatedIdentities(ctx, repos.FederatedIdentityFilter{
+		IdentityProviderId: h.Some(identityProvider.Id),
+		Subject:            h.Some(attributes.Subject),
+	}).SingleOrNone().Get()
+	if ok {
+		if identifiedUserId != uuid.Nil && identifiedUserId != federatedIdentity.UserId {
+			return uuid.UUID{}, httpErrors.Conflict().WithMessage(
+				fmt.Sprintf("the %s account is already linked to another user", identityProvider.DisplayName))
+		}
+		return federatedIdentity.UserId, nil
+	}
+
+	if identifiedUserId != uuid.Nil && !link {
+		return uuid.UUID{}, httpErrors.Unauthorized().WithMessage(
+			fmt.Sprintf("the %s account is not linked to this user", identityProvider.DisplayName))
+	}
+
+	emailVerified := identityProvider.TrustEmail && attributes.EmailVerified
+
+	userId := identifiedUserId
+	if userId == uuid.Nil && attributes.Email != "" {
+		userRepository := ioc.Get[repos.UserRepository](scope)
+		exists := userRepository.FindUsers(ctx, repos.UserFilter{
+			RealmId: h.Some(realm.Id),
+			Email:   h.Some(attributes.Email),
+		}).Any()
+		if exists {
+			return uuid.UUID{}, httpErrors.Conflict().WithMessage(
+				fmt.Sprintf("a user with this email address already exists, sign in to link it to %s", identityProvider.DisplayName))
+		}
+	}
+
+	if userId == uuid.Nil {
+		email := h.None[string]()
+		if attributes.Email != "" {
+			email = h.Some(attributes.Email)
+		}
+
+		userService := ioc.Get[UserService](scope)
+		result := userService.CreateUser(ctx, CreateUserRequest{
+			RealmId:       realm.Id,
+			Username:      attributes.Username,
+			Email:         email,
+			EmailVerified: emailVerified,
+		})
+		if result.IsErr() {
+			if errors.Is(result.UnwrapErr(), repos.DuplicateUsernameError{}) {
+				return uuid.UUID{}, httpErrors.Conflict().WithMessage("a user with this username already exists")
+			}
+			return uuid.UUID{}, result.UnwrapErr()
+		}
+		userId = result.Unwrap()
+	}
+
+	federatedIdentityRepository.CreateFederatedIdentity(ctx, repos.FederatedIdentity{
+		UserId:             userId,
+		IdentityProviderId: identityProvider.Id,
+		Subject:            attributes.Subject,
+	})
+
+	if identifiedUserId != uuid.Nil {
+		i.notifyIdentityLinked(ctx, identifiedUserId, identityProvider)
+	}
+
+	return userId, nil
+}
+
+// notifyIdentityLinked tells the user that another way of signing in to their account was added.
+func (i *identityBrokerServiceImpl) notifyIdentityLinked(ctx context.Context, userId uuid.UUID, identityProvider repos.IdentityProvider) {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, userId).Unwrap()
+
+	email, ok := user.Email.Get()
+	if !ok {
+		return
+	}
+
+	jobService := ioc.Get[JobService](scope)
+	jobService.QueueJob(ctx, repos.SendMailJobDetails{
+		To:      []string{email},
+		Subject: fmt.Sprintf("Your %s account was linked", identityProvider.DisplayName),
+		Body: fmt.Sprintf("<p>Your %s account was just linked to your account, it can now be used to sign in.</p>"+
+			"<p>If this was not you, please contact your administrator immediately.</p>", html.EscapeString(identityProvider.DisplayName)),
+	})
+}
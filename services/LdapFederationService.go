@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/federation"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/utils"
+	"time"
+)
+
+type CreateLdapProviderRequest struct {
+	RealmId uuid.UUID
+
+	DisplayName  string
+	Url          string
+	StartTls     bool
+	BindDn       h.Opt[string]
+	BindPassword h.Opt[string]
+
+	UserBaseDn        string
+	UserFilter        string
+	UserDnTemplate    string
+	UsernameAttribute string
+	EmailAttribute    string
+
+	GroupBaseDn          h.Opt[string]
+	GroupFilter          string
+	GroupNameAttribute   string
+	GroupMemberAttribute string
+
+	Enabled bool
+}
+
+type LdapFederationService interface {
+	CreateLdapProvider(ctx context.Context, request CreateLdapProviderRequest) uuid.UUID
+	EncryptBindPassword(password string) []byte
+
+	// Authenticate verifies the password of a federated user by binding as the user against its directory.
+	Authenticate(ctx context.Context, user repos.User, password string) bool
+
+	// SyncProvider imports or updates all users of the directory and maps their groups to realm roles of the same name.
+	SyncProvider(ctx context.Context, ldapProvider repos.LdapProvider) error
+	SyncAll(ctx context.Context)
+}
+
+type ldapFederationServiceImpl struct{}
+
+func NewLdapFederationService() LdapFederationService {
+	return &ldapFederationServiceImpl{}
+}
+
+func (l *ldapFederationServiceImpl) EncryptBindPassword(password string) []byte {
+	key := config.C.GetSymmetricEncryptionKey()
+	return utils.EncryptSymmetric([]byte(password), key)
+}
+
+func ldapConfigOf(ldapProvider repos.LdapProvider) federation.LdapConfig {
+	var bindPassword string
+	if encrypted, ok := ldapProvider.EncryptedBindPassword.Get(); ok {
+		key := config.C.GetSymmetricEncryptionKey()
+		bindPassword = string(utils.DecryptSymmetric(encrypted, key))
+	}
+
+	return federation.LdapConfig{
+		Url:                  ldapProvider.Url,
+		StartTls:             ldapProvider.StartTls,
+		Timeout:              config.C.Ldap.Timeout,
+		BindDn:               ldapProvider.BindDn.OrDefault(""),
+		BindPassword:         bindPassword,
+		UserBaseDn:           ldapProvider.UserBaseDn,
+		UserFilter:           ldapProvider.UserFilter,
+		UserDnTemplate:       ldapProvider.UserDnTemplate,
+		UsernameAttribute:    ldapProvider.UsernameAttribute,
+		EmailAttribute:       ldapProvider.EmailAttribute,
+		GroupBaseDn:          ldapProvider.GroupBaseDn.OrDefault(""),
+		GroupFilter:          ldapProvider.GroupFilter,
+		GroupNameAttribute:   ldapProvider.GroupNameAttribute,
+		GroupMemberAttribute: ldapProvider.GroupMemberAttribute,
+	}
+}
+
+func (l *ldapFederationServiceImpl) CreateLdapProvider(ctx context.Context, request CreateLdapProviderRequest) uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+
+	var encryptedBindPassword h.Opt[[]byte]
+	request.BindPassword.IfSome(func(x string) {
+		encryptedBindPassword = h.Some(l.EncryptBindPassword(x))
+	})
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	return ldapProviderRepository.CreateLdapProvider(ctx, repos.LdapProvider{
+		RealmId:               request.RealmId,
+		DisplayName:           request.DisplayName,
+		Url:                   request.Url,
+		StartTls:              request.StartTls,
+		BindDn:                request.BindDn,
+		EncryptedBindPassword: encryptedBindPassword,
+		UserBaseDn:            request.UserBaseDn,
+		UserFilter:            request.UserFilter,
+		UserDnTemplate:        request.UserDnTemplate,
+		UsernameAttribute:     request.UsernameAttribute,
+		EmailAttribute:        request.EmailAttribute,
+		GroupBaseDn:           request.GroupBaseDn,
+		GroupFilter:           request.GroupFilter,
+		GroupNameAttribute:    request.GroupNameAttribute,
+		GroupMemberAttribute:  request.GroupMemberAttribute,
+		Enabled:               request.Enabled,
+	})
+}
+
+func (l *ldapFederationServiceImpl) Authenticate(ctx context.Context, user repos.User, password string) bool {
+	scope := middlewares.GetScope(ctx)
+
+	ldapProviderId, ok := user.LdapProviderId.Get()
+	if !ok {
+		return false
+	}
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProvider, ok := ldapProviderRepository.FindLdapProviderById(ctx, ldapProviderId).Get()
+	if !ok || !ldapProvider.Enabled {
+		return false
+	}
+
+	err := ldapConfigOf(ldapProvider).Authenticate(user.Username, password)
+	if err != nil {
+		if !errors.Is(err, federation.ErrInvalidCredentials) {
+			logging.Logger.Errorf("could not authenticate user %s against ldap provider %s: %v", user.Id, ldapProvider.Id, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+func (l *ldapFederationServiceImpl) SyncAll(ctx context.Context) {
+	scope := middlewares.GetScope(ctx)
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProviders := ldapProviderRepository.FindLdapProviders(ctx, repos.LdapProviderFilter{
+		Enabled: h.Some(true),
+	})
+
+	for _, ldapProvider := range ldapProviders.Values() {
+		err := l.SyncProvider(ctx, ldapProvider)
+		if err != nil {
+			logging.Logger.Errorf("could not sync ldap provider %s: %v", ldapProvider.Id, err)
+		}
+	}
+}
+
+func (l *ldapFederationServiceImpl) SyncProvider(ctx context.Context, ldapProvider repos.LdapProvider) error {
+	scope := middlewares.GetScope(ctx)
+
+	ldapConfig := ldapConfigOf(ldapProvider)
+
+	ldapUsers, err := ldapConfig.FindUsers()
+	if err != nil {
+		return err
+	}
+
+	ldapGroups, err := ldapConfig.FindGroups()
+	if err != nil {
+		return err
+	}
+
+	groupRoleIds := l.ensureGroupRoles(ctx, ldapProvider, ldapGroups)
+
+	// only roles that the sync created are managed by it, manually granted roles are kept
+	managedRoleIds := make(map[uuid.UUID]bool)
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	for _, role := range roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId:        ldapProvider.RealmId,
+		LdapProviderId: h.Some(ldapProvider.Id),
+	}).Values() {
+		managedRoleIds[role.Id] = true
+	}
+
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+
+	for _, ldapUser := range ldapUsers {
+		userId, err := l.importUser(ctx, ldapProvider, ldapUser)
+		if err != nil {
+			logging.Logger.Warnf("could not import ldap user %s: %v", ldapUser.Dn, err)
+			continue
+		}
+
+		memberOf := make(map[uuid.UUID]bool)
+		var userRoles []repos.UserRole
+		for _, groupName := range federation.GroupsOfUser(ldapGroups, ldapUser.Dn) {
+			roleId, ok := groupRoleIds[groupName]
+			if !ok {
+				continue
+			}
+			memberOf[roleId] = true
+			userRoles = append(userRoles, repos.UserRole{
+				UserId: userId,
+				RoleId: roleId,
+			})
+		}
+
+		if len(userRoles) > 0 {
+			userRoleRepository.CreateUserRoles(ctx, userRoles)
+		}
+
+		for _, userRole := range userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+			UserId: h.Some(userId),
+		}) {
+			if managedRoleIds[userRole.RoleId] && !memberOf[userRole.RoleId] {
+				userRoleRepository.DeleteUserRole(ctx, userRole.Id)
+			}
+		}
+	}
+
+	ldapProviderRepository := ioc.Get[repos.LdapProviderRepository](scope)
+	ldapProviderRepository.UpdateLdapProvider(ctx, ldapProvider.Id, repos.LdapProviderUpdate{
+		LastSyncedAt: h.Some(time.Now()),
+	})
+
+	return nil
+}
+
+// ensureGroupRoles returns the ids of the roles that the provider created for the directory groups, missing roles are created.
+// A group is skipped if a role with its name exists that the provider did not create, e.g. a group named "admin" must
+// not grant the admin role of the realm.
+func (l *ldapFederationServiceImpl) ensureGroupRoles(ctx context.Context, ldapProvider repos.LdapProvider, ldapGroups []federation.LdapGroup) map[string]uuid.UUID {
+	scope := middlewares.GetScope(ctx)
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+
+	roleIds := make(map[string]uuid.UUID)
+	for _, ldapGroup := range ldapGroups {
+		if _, ok := roleIds[ldapGroup.Name]; ok {
+			continue
+		}
+
+		role, ok := roleRepository.FindRoles(ctx, repos.RoleFilter{
+			RealmId: ldapProvider.RealmId,
+			Name:    h.Some(ldapGroup.Name),
+		}).FirstOrNone().Get()
+		if ok {
+			if providerId, ok := role.LdapProviderId.Get(); !ok || providerId != ldapProvider.Id {
+				logging.Logger.Warnf("skipping ldap group %s, the role %s was not created by the ldap provider %s", ldapGroup.Dn, role.Name, ldapProvider.Id)
+				continue
+			}
+			roleIds[ldapGroup.Name] = role.Id
+			continue
+		}
+
+		roleIds[ldapGroup.Name] = roleRepository.CreateRole(ctx, repos.Role{
+			RealmId:        ldapProvider.RealmId,
+			DisplayName:    ldapGroup.Name,
+			Name:           ldapGroup.Name,
+			Description:    fmt.Sprintf("Members of the ldap group %s", ldapGroup.Dn),
+			LdapProviderId: h.Some(ldapProvider.Id),
+		}).Unwrap()
+	}
+
+	return roleIds
+}
+
+// importUser creates the user of a directory entry or updates the user that already exists with the same username.
+func (l *ldapFederationServiceImpl) importUser(ctx context.Context, ldapProvider repos.LdapProvider, ldapUser federation.LdapUser) (uuid.UUID, error) {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+
+	email := h.None[string]()
+	if ldapUser.Email != "" {
+		email = h.Some(ldapUser.Email)
+	}
+
+	user, ok := userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId:  h.Some(ldapProvider.RealmId),
+		Username: h.Some(ldapUser.Username),
+	}).SingleOrNone().Get()
+	if !ok {
+		result := userRepository.CreateUser(ctx, repos.User{
+			RealmId:        ldapProvider.RealmId,
+			Username:       ldapUser.Username,
+			Email:          email,
+			EmailVerified:  email.IsSome(),
+			Enabled:        true,
+			LdapProviderId: h.Some(ldapProvider.Id),
+			LdapDn:         h.Some(ldapUser.Dn),
+		})
+		if result.IsErr() {
+			return uuid.UUID{}, result.UnwrapErr()
+		}
+		return result.Unwrap(), nil
+	}
+
+	// local users and users of another directory are never taken over
+	if ldapProviderId, ok := user.LdapProviderId.Get(); !ok || ldapProviderId != ldapProvider.Id {
+		return uuid.UUID{}, fmt.Errorf("username %s is already taken by a user that is not federated from this provider", ldapUser.Username)
+	}
+
+	result := userRepository.UpdateUser(ctx, user.Id, repos.UserUpdate{
+		Email:         h.Some(email),
+		EmailVerified: h.Some(email.IsSome()),
+		LdapDn:        h.Some(h.Some(ldapUser.Dn)),
+	})
+	if result.IsErr() {
+		return uuid.UUID{}, result.UnwrapErr()
+	}
+
+	return user.Id, nil
+}
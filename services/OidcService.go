@@ -3,10 +3,12 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"holvit/cache"
+	"holvit/config"
 	"holvit/constants"
 	"holvit/h"
 	"holvit/httpErrors"
@@ -33,6 +35,8 @@ type AuthorizationRequest struct {
 	ResponseMode        string   `json:"responseMode"`
 	PKCEChallenge       string   `json:"pkceChallenge"`
 	PKCEChallengeMethod string   `json:"pkceChallengeMethod"`
+
+	ClaimsRequest *ClaimsRequest `json:"claimsRequest"`
 }
 
 type AuthorizationResponse interface {
@@ -40,6 +44,7 @@ type AuthorizationResponse interface {
 }
 
 type ScopeConsentResponse struct {
+	RealmName      string
 	RequiredGrants []repos.Scope
 	Client         *repos.Client
 	User           *repos.User
@@ -64,7 +69,7 @@ func (c *ScopeConsentResponse) HandleHttp(w http.ResponseWriter, r *http.Request
 		})
 	}
 
-	realmName := "admin" // TODO: get from where?
+	realmName := c.RealmName
 
 	frontendData := AuthFrontendData{
 		Mode: constants.FrontendModeAuthorize,
@@ -135,6 +140,7 @@ type AuthorizationCodeTokenRequest struct {
 	ClientId     string
 	ClientSecret h.Opt[string]
 	PKCEVerifier h.Opt[string]
+	Origin       h.Opt[string]
 }
 
 type RefreshTokenRequest struct {
@@ -142,14 +148,34 @@ type RefreshTokenRequest struct {
 	ClientId     string
 	ClientSecret h.Opt[string]
 	ScopeNames   []string
+	Origin       h.Opt[string]
+}
+
+type CibaTokenRequest struct {
+	AuthReqId    string
+	ClientId     string
+	ClientSecret h.Opt[string]
+	Origin       h.Opt[string]
+}
+
+type ClientCredentialsTokenRequest struct {
+	ClientId     string
+	ClientSecret h.Opt[string]
+	ScopeNames   []string
+	Origin       h.Opt[string]
+}
+
+type UserInfoRequest struct {
+	RealmName string
+	Bearer    string
 }
 
 type TokenResponse struct {
 	TokenType string `json:"token_type"`
 
-	IdToken      string `json:"id_token"`
+	IdToken      string `json:"id_token,omitempty"`
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 
 	Scope *string `json:"scope"`
 
@@ -161,7 +187,9 @@ type OidcService interface {
 	Grant(ctx context.Context, grantRequest GrantRequest) (AuthorizationResponse, error)
 	HandleAuthorizationCode(ctx context.Context, request AuthorizationCodeTokenRequest) (*TokenResponse, error)
 	HandleRefreshToken(ctx context.Context, request RefreshTokenRequest) (*TokenResponse, error)
-	UserInfo(bearer string) map[string]interface{}
+	HandleCiba(ctx context.Context, request CibaTokenRequest) (*TokenResponse, error)
+	HandleClientCredentials(ctx context.Context, request ClientCredentialsTokenRequest) (*TokenResponse, error)
+	UserInfo(ctx context.Context, request UserInfoRequest) (map[string]interface{}, error)
 }
 
 type oidcServiceImpl struct{}
@@ -193,29 +221,39 @@ func (o *oidcServiceImpl) HandleAuthorizationCode(ctx context.Context, request A
 		return nil, httpErrors.Unauthorized().WithMessage("wrong client id")
 	}
 
-	if client.ClientSecret.IsNone() {
-		if codeInfo.PKCEChallenge == "" {
-			panic(httpErrors.Unauthorized().WithMessage("PKCE required"))
-		}
+	if err := checkGrantTypeAllowed(client, constants.TokenGrantTypeAuthorizationCode); err != nil {
+		return nil, err
+	}
+
+	if err := checkWebOrigin(client, request.Origin); err != nil {
+		return nil, err
+	}
+
+	if codeInfo.PKCEChallenge != "" {
 		codeVerifier := request.PKCEVerifier.UnwrapErr(httpErrors.Unauthorized().WithMessage("PKCE required"))
 		hashedVerifier := base64.URLEncoding.EncodeToString(utils.Sha256(codeVerifier))
 
-		if utils.Sha256Compare(codeVerifier, hashedVerifier) {
+		if !utils.Sha256Compare(hashedVerifier, codeInfo.PKCEChallenge) {
 			return nil, httpErrors.Unauthorized().WithMessage("wrong PKCE code verifier")
 		}
+	} else if client.ClientSecret.IsNone() || client.PkceRequired {
+		return nil, httpErrors.Unauthorized().WithMessage("PKCE required")
 	}
 
+	return issueTokens(ctx, client, codeInfo.UserId, codeInfo.GrantedScopes, codeInfo.GrantedScopeIds, codeInfo.ClaimsRequest, now)
+}
+
+// issueTokens creates the id, access and refresh token for a user that authenticated and authorized a client.
+func issueTokens(ctx context.Context, client repos.Client, userId uuid.UUID, grantedScopes []string, grantedScopeIds []uuid.UUID, claimsRequest *ClaimsRequest, now time.Time) (*TokenResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
 	issuer := "http://localhost:8080/oidc" //TODO: this needs to be in the config (external url)
 
-	idToken := makeIdToken(ctx, codeInfo.UserId, codeInfo.GrantedScopeIds, codeInfo.UserId.String(), issuer, client.ClientId, now)
+	idTokenValidTime := clientTokenLifetime(client.IdTokenLifetimeSeconds, config.C.Tokens.IdTokenLifetime)
+	idToken := makeIdToken(ctx, userId, grantedScopeIds, claimsRequest, userId.String(), issuer, client.ClientId, now, idTokenValidTime)
 
-	accessTokenValidTime := time.Hour * 1 //TODO: add this to realm and maybe to scopes
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
-		"sub":    codeInfo.UserId,
-		"scopes": codeInfo.GrantedScopes,
-		"iat":    now.Unix(),
-		"exp":    now.Add(accessTokenValidTime).Unix(),
-	})
+	accessTokenValidTime := clientTokenLifetime(client.AccessTokenLifetimeSeconds, config.C.Tokens.AccessTokenLifetime)
+	accessToken := makeAccessToken(userId, grantedScopes, claimsRequest, now, accessTokenValidTime)
 
 	keyCache := ioc.Get[cache.KeyCache](scope)
 	key, ok := keyCache.Get(client.RealmId)
@@ -233,18 +271,24 @@ func (o *oidcServiceImpl) HandleAuthorizationCode(ctx context.Context, request A
 		return nil, err
 	}
 
-	refreshTokenService := ioc.Get[RefreshTokenService](scope)
-	refreshTokenString, _ := refreshTokenService.CreateRefreshToken(ctx, CreateRefreshTokenRequest{
-		ClientId: client.Id,
-		UserId:   codeInfo.UserId,
-		RealmId:  client.RealmId,
-		Issuer:   issuer,
-		Subject:  codeInfo.UserId.String(),
-		Audience: client.ClientId,
-		Scopes:   codeInfo.GrantedScopes,
-	})
+	refreshTokenString := ""
+	if slices.Contains(client.GrantTypes, constants.TokenGrantTypeRefreshToken) {
+		refreshTokenService := ioc.Get[RefreshTokenService](scope)
+		refreshTokenString, _ = refreshTokenService.CreateRefreshToken(ctx, CreateRefreshTokenRequest{
+			ClientId:  client.Id,
+			UserId:    userId,
+			RealmId:   client.RealmId,
+			Issuer:    issuer,
+			Subject:   userId.String(),
+			Audience:  client.ClientId,
+			Scopes:    grantedScopes,
+			ValidTime: clientTokenLifetime(client.RefreshTokenLifetimeSeconds, config.C.Tokens.RefreshTokenLifetime),
+
+			ClaimsRequest: claimsRequest,
+		})
+	}
 
-	scopeString := strings.Join(codeInfo.GrantedScopes, " ")
+	scopeString := strings.Join(grantedScopes, " ")
 	return &TokenResponse{
 		TokenType:    "Bearer",
 		IdToken:      idTokenString,
@@ -255,6 +299,150 @@ func (o *oidcServiceImpl) HandleAuthorizationCode(ctx context.Context, request A
 	}, nil
 }
 
+func (o *oidcServiceImpl) HandleCiba(ctx context.Context, request CibaTokenRequest) (*TokenResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	clientService := ioc.Get[ClientService](scope)
+	clientResult := clientService.Authenticate(ctx, AuthenticateClientRequest{
+		ClientId:     request.ClientId,
+		ClientSecret: request.ClientSecret,
+	})
+	if clientResult.IsErr() {
+		return nil, clientResult.UnwrapErr()
+	}
+	client := clientResult.Unwrap()
+
+	if err := checkGrantTypeAllowed(client, constants.TokenGrantTypeCiba); err != nil {
+		return nil, err
+	}
+
+	if err := checkWebOrigin(client, request.Origin); err != nil {
+		return nil, err
+	}
+
+	tokenService := ioc.Get[TokenService](scope)
+	info, ok := tokenService.PeekCibaRequest(ctx, request.AuthReqId).Get()
+	if !ok || info.ClientId != client.Id {
+		return nil, httpErrors.OAuthBadRequest("invalid_grant")
+	}
+
+	if info.ExpiresAt.Before(now) {
+		tokenService.RetrieveCibaRequest(ctx, request.AuthReqId)
+		return nil, httpErrors.OAuthBadRequest("expired_token")
+	}
+
+	switch info.Status {
+	case constants.CibaStatusDenied:
+		tokenService.RetrieveCibaRequest(ctx, request.AuthReqId)
+		return nil, httpErrors.OAuthBadRequest("access_denied")
+	case constants.CibaStatusPending:
+		// clients polling faster than the interval have to slow down, the interval grows by 5 seconds each time
+		pollError := "authorization_pending"
+		interval := info.Interval
+		if !info.LastPolledAt.IsZero() && now.Before(info.LastPolledAt.Add(time.Duration(info.Interval)*time.Second)) {
+			interval += 5
+			pollError = "slow_down"
+		}
+
+		if !tokenService.RecordCibaPoll(ctx, request.AuthReqId, interval, now) {
+			return nil, httpErrors.OAuthBadRequest("invalid_grant")
+		}
+		return nil, httpErrors.OAuthBadRequest(pollError)
+	}
+
+	// the request is removed before issuing tokens, so that every auth_req_id can only be redeemed once
+	if tokenService.RetrieveCibaRequest(ctx, request.AuthReqId).IsNone() {
+		return nil, httpErrors.OAuthBadRequest("invalid_grant")
+	}
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	scopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: info.RealmId,
+		Names:   h.Some(info.Scopes),
+	})
+
+	grantedScopes := make([]string, 0, len(scopes.Values()))
+	grantedScopeIds := make([]uuid.UUID, 0, len(scopes.Values()))
+	for _, dbScope := range scopes.Values() {
+		grantedScopes = append(grantedScopes, dbScope.Name)
+		grantedScopeIds = append(grantedScopeIds, dbScope.Id)
+	}
+
+	return issueTokens(ctx, client, info.UserId, grantedScopes, grantedScopeIds, nil, now)
+}
+
+// HandleClientCredentials issues an access token for the client itself, there is no user, id token or refresh token involved.
+func (o *oidcServiceImpl) HandleClientCredentials(ctx context.Context, request ClientCredentialsTokenRequest) (*TokenResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	clientService := ioc.Get[ClientService](scope)
+	clientResult := clientService.Authenticate(ctx, AuthenticateClientRequest{
+		ClientId:     request.ClientId,
+		ClientSecret: request.ClientSecret,
+	})
+	if clientResult.IsErr() {
+		return nil, clientResult.UnwrapErr()
+	}
+	client := clientResult.Unwrap()
+
+	if client.ClientSecret.IsNone() {
+		return nil, httpErrors.Unauthorized().WithMessage("the client credentials grant requires a confidential client")
+	}
+
+	if err := checkGrantTypeAllowed(client, constants.TokenGrantTypeClientCredentials); err != nil {
+		return nil, err
+	}
+
+	if err := checkWebOrigin(client, request.Origin); err != nil {
+		return nil, err
+	}
+
+	grantedScopes := client.DefaultScopes
+	if len(request.ScopeNames) > 0 {
+		for _, scopeName := range request.ScopeNames {
+			if !slices.Contains(client.DefaultScopes, scopeName) && !slices.Contains(client.OptionalScopes, scopeName) {
+				return nil, httpErrors.BadRequest().WithMessage(fmt.Sprintf("invalid_scope: the scope '%s' is not allowed for this client", scopeName))
+			}
+		}
+		grantedScopes = request.ScopeNames
+	}
+
+	accessTokenValidTime := clientTokenLifetime(client.AccessTokenLifetimeSeconds, config.C.Tokens.AccessTokenLifetime)
+	accessToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"sub":       client.ClientId,
+		"client_id": client.ClientId,
+		"scopes":    grantedScopes,
+		"iat":       now.Unix(),
+		"exp":       now.Add(accessTokenValidTime).Unix(),
+	})
+	accessToken.Header["typ"] = constants.ClientAccessTokenType
+
+	keyCache := ioc.Get[cache.KeyCache](scope)
+	key, ok := keyCache.Get(client.RealmId)
+	if !ok {
+		return nil, httpErrors.Unauthorized().WithMessage("could not get realm key")
+	}
+
+	accessTokenString, err := accessToken.SignedString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	scopeString := strings.Join(grantedScopes, " ")
+	return &TokenResponse{
+		TokenType:   "Bearer",
+		AccessToken: accessTokenString,
+		Scope:       &scopeString,
+		ExpiresIn:   int(accessTokenValidTime / time.Second),
+	}, nil
+}
+
 func (o *oidcServiceImpl) HandleRefreshToken(ctx context.Context, request RefreshTokenRequest) (*TokenResponse, error) {
 	scope := middlewares.GetScope(ctx)
 
@@ -267,8 +455,16 @@ func (o *oidcServiceImpl) HandleRefreshToken(ctx context.Context, request Refres
 		ClientSecret: request.ClientSecret,
 	}).Unwrap() // TODO: handle 404
 
+	if err := checkGrantTypeAllowed(client, constants.TokenGrantTypeRefreshToken); err != nil {
+		return nil, err
+	}
+
+	if err := checkWebOrigin(client, request.Origin); err != nil {
+		return nil, err
+	}
+
 	refreshTokenService := ioc.Get[RefreshTokenService](scope)
-	refreshTokenString, refreshToken := refreshTokenService.ValidateAndRefresh(ctx, request.RefreshToken, client.Id).Unwrap().Values() //TODO: handle unauthorized?
+	refreshTokenString, refreshToken := refreshTokenService.ValidateAndRefresh(ctx, request.RefreshToken, client).Unwrap().Values() //TODO: handle unauthorized?
 
 	if !utils.IsSliceSubset(refreshToken.Scopes, request.ScopeNames) {
 		return nil, httpErrors.Unauthorized().WithMessage("too many scopes")
@@ -285,15 +481,13 @@ func (o *oidcServiceImpl) HandleRefreshToken(ctx context.Context, request Refres
 		grantedScopeIds = append(grantedScopeIds, dbScope.Id)
 	}
 
-	idToken := makeIdToken(ctx, refreshToken.UserId, grantedScopeIds, refreshToken.Subject, refreshToken.Issuer, refreshToken.Audience, now)
+	claimsRequest := storedClaimsRequest(refreshToken)
 
-	accessTokenValidTime := time.Hour * 1 //TODO: add this to realm and maybe to scopes
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
-		"sub":    refreshToken.UserId,
-		"scopes": request.ScopeNames,
-		"iat":    now.Unix(),
-		"exp":    now.Add(accessTokenValidTime).Unix(),
-	})
+	idTokenValidTime := clientTokenLifetime(client.IdTokenLifetimeSeconds, config.C.Tokens.IdTokenLifetime)
+	idToken := makeIdToken(ctx, refreshToken.UserId, grantedScopeIds, claimsRequest, refreshToken.Subject, refreshToken.Issuer, refreshToken.Audience, now, idTokenValidTime)
+
+	accessTokenValidTime := clientTokenLifetime(client.AccessTokenLifetimeSeconds, config.C.Tokens.AccessTokenLifetime)
+	accessToken := makeAccessToken(refreshToken.UserId, request.ScopeNames, claimsRequest, now, accessTokenValidTime)
 
 	keyCache := ioc.Get[cache.KeyCache](scope)
 	key, ok := keyCache.Get(client.RealmId)
@@ -320,17 +514,33 @@ func (o *oidcServiceImpl) HandleRefreshToken(ctx context.Context, request Refres
 	}, nil
 }
 
-func makeIdToken(ctx context.Context, userId uuid.UUID, scopeIds []uuid.UUID, subject, issuer, audience string, now time.Time) *jwt.Token {
+func makeAccessToken(userId uuid.UUID, scopeNames []string, claimsRequest *ClaimsRequest, now time.Time, validTime time.Duration) *jwt.Token {
+	accessTokenClaims := jwt.MapClaims{
+		"sub":    userId,
+		"scopes": scopeNames,
+		"iat":    now.Unix(),
+		"exp":    now.Add(validTime).Unix(),
+	}
+
+	// the userinfo endpoint only gets the access token, so the requested userinfo claims have to travel with it
+	if claimsRequest != nil && claimsRequest.UserInfo != nil {
+		accessTokenClaims["userinfo_claims"] = claimsRequest.UserInfo
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodEdDSA, accessTokenClaims)
+}
+
+func makeIdToken(ctx context.Context, userId uuid.UUID, scopeIds []uuid.UUID, claimsRequest *ClaimsRequest, subject, issuer, audience string, now time.Time, idTokenValidTime time.Duration) *jwt.Token {
 	scope := middlewares.GetScope(ctx)
 
 	claimsService := ioc.Get[ClaimsService](scope)
 	claims := claimsService.GetClaims(ctx, GetClaimsRequest{
-		UserId:   userId,
-		ScopeIds: scopeIds,
+		UserId:        userId,
+		ScopeIds:      scopeIds,
+		Target:        constants.ClaimsTargetIdToken,
+		ClaimsRequest: h.FromPtr(claimsRequest),
 	})
 
-	idTokenValidTime := time.Hour * 1 //TODO: add this to realm and maybe to scopes
-
 	idTokenClaims := jwt.MapClaims{
 		"sub": subject,
 		"iss": issuer,
@@ -359,17 +569,26 @@ func (o *oidcServiceImpl) Grant(ctx context.Context, grantRequest GrantRequest)
 
 	scopeIds := make([]uuid.UUID, 0)
 	for _, scope := range scopes.Values() {
-		scopeIds = append(scopeIds, scope.Id)
+		// only scopes that have actually been requested can be granted
+		if slices.Contains(grantRequest.AuthorizationRequest.Scopes, scope.Name) {
+			scopeIds = append(scopeIds, scope.Id)
+		}
 	}
 
 	userId := currentUserService.UserId()
 
 	scopeRepository.CreateGrants(ctx, userId, grantRequest.ClientId, scopeIds)
 
-	return o.Authorize(ctx, grantRequest.AuthorizationRequest)
+	return o.authorize(ctx, grantRequest.AuthorizationRequest, true)
 }
 
 func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest AuthorizationRequest) (AuthorizationResponse, error) {
+	return o.authorize(ctx, authorizationRequest, false)
+}
+
+// authorize issues an authorization code for the granted scopes.
+// The user is only asked for consent once, scopes the user refused on the consent page are left out.
+func (o *oidcServiceImpl) authorize(ctx context.Context, authorizationRequest AuthorizationRequest, afterConsent bool) (AuthorizationResponse, error) {
 	if !(len(authorizationRequest.ResponseTypes) == 1 && authorizationRequest.ResponseTypes[0] == constants.AuthorizationResponseTypeCode) {
 		return nil, httpErrors.BadRequest().WithMessage("Unsupported authorization flow, only supporting 'code'")
 	}
@@ -399,17 +618,34 @@ func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest Au
 		ClientId: h.Some(authorizationRequest.ClientId),
 	}).Single()
 
-	pkceChallenge := ""
-	if client.ClientSecret.IsSome() && authorizationRequest.PKCEChallenge != "" {
-		return nil, httpErrors.BadRequest().WithMessage("clients with a secret cannot use PKCE")
-	} else if client.ClientSecret.IsNone() {
-		if authorizationRequest.PKCEChallenge == "" {
-			return nil, httpErrors.BadRequest().WithMessage("clients without a secret must use PKCE")
+	if client.Protocol != constants.ClientProtocolOidc {
+		return nil, httpErrors.BadRequest().WithMessage("the client is not an OpenID Connect client")
+	}
+
+	if !slices.Contains(client.RedirectUris, authorizationRequest.RedirectUri) {
+		return nil, httpErrors.BadRequest().WithMessage("invalid redirect uri")
+	}
+
+	for _, responseType := range authorizationRequest.ResponseTypes {
+		if !slices.Contains(client.ResponseTypes, responseType) {
+			return nil, httpErrors.BadRequest().WithMessage(fmt.Sprintf("response type '%s' is not allowed for this client", responseType))
 		}
+	}
+
+	if err := checkGrantTypeAllowed(client, constants.TokenGrantTypeAuthorizationCode); err != nil {
+		return nil, err
+	}
+
+	pkceChallenge := ""
+	if authorizationRequest.PKCEChallenge != "" {
 		if authorizationRequest.PKCEChallengeMethod != constants.CodeChallengeMethodS256 {
 			return nil, httpErrors.BadRequest().WithMessage(fmt.Sprintf("Unsupported PKCE code challenge method '%v'", authorizationRequest.PKCEChallengeMethod))
 		}
 		pkceChallenge = authorizationRequest.PKCEChallenge
+	} else if client.ClientSecret.IsNone() {
+		return nil, httpErrors.BadRequest().WithMessage("clients without a secret must use PKCE")
+	} else if client.PkceRequired {
+		return nil, httpErrors.BadRequest().WithMessage("this client must use PKCE")
 	}
 
 	currentUser := ioc.Get[CurrentSessionService](scope)
@@ -417,23 +653,42 @@ func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest Au
 	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
 	userid := currentUser.UserId()
 
+	if claimsRequest := authorizationRequest.ClaimsRequest; claimsRequest != nil {
+		// essential claims need the consent of the user, so the scopes providing them are requested as well
+		essentialClaims := claimsRequest.EssentialClaimNames()
+		if len(essentialClaims) > 0 {
+			providingScopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+				RealmId:    realm.Id,
+				ClaimNames: h.Some(essentialClaims),
+			})
+			for _, providingScope := range providingScopes.Values() {
+				if !slices.Contains(authorizationRequest.Scopes, providingScope.Name) {
+					authorizationRequest.Scopes = append(authorizationRequest.Scopes, providingScope.Name)
+				}
+			}
+		}
+	}
+
+	authorizationRequest.Scopes = applyClientScopes(client, authorizationRequest.Scopes)
+
+	consentService := ioc.Get[ConsentService](scope)
 	scopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
 		Names:         h.Some(authorizationRequest.Scopes),
 		UserId:        h.Some(userid),
 		ClientId:      h.Some(client.Id),
+		GrantedAfter:  consentService.ConsentValidSince(ctx, realm),
 		RealmId:       realm.Id,
 		IncludeGrants: true,
 	})
 
 	missingGrants := make([]repos.Scope, 0)
 	for _, oidcScope := range scopes.Values() {
-		if oidcScope.Grant.IsNone() {
+		if oidcScope.Grant.IsNone() && client.ConsentRequired {
 			missingGrants = append(missingGrants, oidcScope)
 		}
 	}
 
-	//TODO: only on first round
-	if len(missingGrants) > 0 {
+	if len(missingGrants) > 0 && !afterConsent {
 		tokenService := ioc.Get[TokenService](scope)
 		token := tokenService.StoreGrantInfo(ctx, GrantInfo{
 			RealmId:              realm.Id,
@@ -444,6 +699,7 @@ func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest Au
 		user := currentUser.User(ctx)
 
 		return &ScopeConsentResponse{
+			RealmName:      realm.Name,
 			RequiredGrants: missingGrants,
 			Token:          token,
 			Client:         &client,
@@ -455,7 +711,7 @@ func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest Au
 	grantedScopes := make([]string, 0)
 	grantedScopeIds := make([]uuid.UUID, 0)
 	for _, oidcScope := range scopes.Values() {
-		if oidcScope.Grant.IsSome() {
+		if oidcScope.Grant.IsSome() || !client.ConsentRequired {
 			grantedScopes = append(grantedScopes, oidcScope.Name)
 			grantedScopeIds = append(grantedScopeIds, oidcScope.Id)
 		}
@@ -470,6 +726,7 @@ func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest Au
 		GrantedScopes:   grantedScopes,
 		GrantedScopeIds: grantedScopeIds,
 		PKCEChallenge:   pkceChallenge,
+		ClaimsRequest:   authorizationRequest.ClaimsRequest,
 	})
 
 	return &CodeAuthorizationResponse{
@@ -479,6 +736,29 @@ func (o *oidcServiceImpl) Authorize(ctx context.Context, authorizationRequest Au
 	}, nil
 }
 
+// applyClientScopes restricts the requested scopes to the default and optional scopes of the client.
+// Default scopes are always included, optional scopes only when requested.
+// Clients without any configured scopes may request every scope of the realm.
+func applyClientScopes(client repos.Client, requestedScopes []string) []string {
+	if len(client.DefaultScopes) == 0 && len(client.OptionalScopes) == 0 {
+		return requestedScopes
+	}
+
+	result := []string{"openid"}
+	for _, defaultScope := range client.DefaultScopes {
+		if !slices.Contains(result, defaultScope) {
+			result = append(result, defaultScope)
+		}
+	}
+	for _, requestedScope := range requestedScopes {
+		if slices.Contains(client.OptionalScopes, requestedScope) && !slices.Contains(result, requestedScope) {
+			result = append(result, requestedScope)
+		}
+	}
+
+	return result
+}
+
 func validateResponseMode(responseMode string) error {
 	if responseMode == constants.AuthorizationResponseModeQuery {
 		return nil
@@ -489,7 +769,96 @@ func validateResponseMode(responseMode string) error {
 	return httpErrors.BadRequest().WithMessage(fmt.Sprintf("Unsupported response mode %v", responseMode))
 }
 
-func (o *oidcServiceImpl) UserInfo(bearer string) map[string]interface{} {
+func (o *oidcServiceImpl) UserInfo(ctx context.Context, request UserInfoRequest) (map[string]interface{}, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenString, ok := strings.CutPrefix(request.Bearer, "Bearer ")
+	if !ok {
+		return nil, httpErrors.Unauthorized().WithMessage("missing bearer token")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(request.RealmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	keyCache := ioc.Get[cache.KeyCache](scope)
+	key, ok := keyCache.Get(realm.Id)
+	if !ok {
+		return nil, httpErrors.Unauthorized().WithMessage("could not get realm key")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid access token")
+	}
+
+	tokenClaims := token.Claims.(jwt.MapClaims)
+
+	subject, err := tokenClaims.GetSubject()
+	if err != nil {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid access token")
+	}
+	userId, err := uuid.Parse(subject)
+	if err != nil {
+		return nil, httpErrors.Unauthorized().WithMessage("invalid access token")
+	}
+
+	scopeNames := make([]string, 0)
+	if rawScopes, ok := tokenClaims["scopes"].([]interface{}); ok {
+		for _, rawScope := range rawScopes {
+			if scopeName, ok := rawScope.(string); ok {
+				scopeNames = append(scopeNames, scopeName)
+			}
+		}
+	}
+
+	claimsRequest := h.None[ClaimsRequest]()
+	if rawUserInfoClaims, ok := tokenClaims["userinfo_claims"]; ok {
+		raw, err := json.Marshal(rawUserInfoClaims)
+		if err != nil {
+			return nil, err
+		}
+		var userInfoClaims map[string]*ClaimRequest
+		err = json.Unmarshal(raw, &userInfoClaims)
+		if err != nil {
+			return nil, httpErrors.Unauthorized().WithMessage("invalid access token")
+		}
+		claimsRequest = h.Some(ClaimsRequest{
+			UserInfo: userInfoClaims,
+		})
+	}
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	scopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: realm.Id,
+		Names:   h.Some(scopeNames),
+	})
+
+	scopeIds := make([]uuid.UUID, 0, len(scopes.Values()))
+	for _, dbScope := range scopes.Values() {
+		scopeIds = append(scopeIds, dbScope.Id)
+	}
+
+	claimsService := ioc.Get[ClaimsService](scope)
+	claims := claimsService.GetClaims(ctx, GetClaimsRequest{
+		UserId:        userId,
+		ScopeIds:      scopeIds,
+		Target:        constants.ClaimsTargetUserInfo,
+		ClaimsRequest: claimsRequest,
+	})
+
+	response := map[string]interface{}{
+		"sub": subject,
+	}
+	for _, claim := range claims {
+		response[claim.Name] = claim.Claim
+	}
 
-	return nil
+	return response, nil
 }
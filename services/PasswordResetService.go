@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"holvit/config"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/utils"
+	"html"
+	"net/url"
+	"strings"
+)
+
+type RequestPasswordResetRequest struct {
+	RealmName string
+	// Identifier is the username or email the user entered.
+	Identifier string
+}
+
+type CompletePasswordResetRequest struct {
+	RealmName   string
+	Token       string
+	NewPassword string
+	// RevokeSessions signs the user out everywhere, in case someone else knew the old password.
+	RevokeSessions bool
+}
+
+// PasswordResetService lets users that forgot their password set a new one with a link that is sent by email.
+type PasswordResetService interface {
+	// RequestReset sends a reset link to the user, it does not reveal whether the user exists.
+	RequestReset(ctx context.Context, request RequestPasswordResetRequest) error
+	// IsValidToken checks the token of a reset link before the reset page is shown.
+	IsValidToken(ctx context.Context, realmName string, token string) bool
+	CompleteReset(ctx context.Context, request CompletePasswordResetRequest) error
+}
+
+type passwordResetServiceImpl struct{}
+
+func NewPasswordResetService() PasswordResetService {
+	return &passwordResetServiceImpl{}
+}
+
+func (s *passwordResetServiceImpl) RequestReset(ctx context.Context, request RequestPasswordResetRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	realm, err := s.findRealm(ctx, request.RealmName)
+	if err != nil {
+		return err
+	}
+
+	identifier := strings.TrimSpace(request.Identifier)
+	if identifier == "" {
+		return httpErrors.BadRequest().WithMessage("username or email is required")
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := findUserByEmail(ctx, realm.Id, identifier).Get()
+	if !ok {
+		user, ok = userRepository.FindUsers(ctx, repos.UserFilter{
+			RealmId:  h.Some(realm.Id),
+			Username: h.Some(identifier),
+		}).SingleOrNone().Get()
+	}
+
+	// passwords of federated users are managed by their directory
+	if !ok || !user.Enabled || user.Email.IsNone() || user.LdapProviderId.IsSome() {
+		logging.Logger.Debugf("password reset requested for an unknown user in realm %s", realm.Name)
+		return nil
+	}
+
+	token := utils.GenerateRandomStringBase64(32)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+
+	passwordResetTokenRepository := ioc.Get[repos.PasswordResetTokenRepository](scope)
+	passwordResetTokenRepository.DeletePasswordResetTokensOfUser(ctx, user.Id)
+	passwordResetTokenRepository.CreatePasswordResetToken(ctx, repos.PasswordResetToken{
+		UserId:      user.Id,
+		HashedToken: utils.CheapHash(token),
+		ValidUntil:  clockService.Now().Add(config.C.PasswordReset.Expiry),
+	})
+
+	link := routes.AuthResetPassword.Url(realm.Name) + "?" + url.Values{
+		"token": {token},
+	}.Encode()
+
+	jobService := ioc.Get[JobService](scope)
+	jobService.QueueJob(ctx, repos.SendMailJobDetails{
+		To:      []string{user.Email.Unwrap()},
+		Subject: fmt.Sprintf("Reset your %s password", realm.DisplayName),
+		Body: fmt.Sprintf(`<html><body>Someone asked to reset the password of your account <b>%s</b>.<br/><a href="%s">Choose a new password</a><br/>The link can only be used once and expires in %s. If this was not you, you can ignore this email.</body></html>`,
+			html.EscapeString(user.Username),
+			html.EscapeString(link),
+			config.C.PasswordReset.Expiry),
+	})
+
+	return nil
+}
+
+func (s *passwordResetServiceImpl) IsValidToken(ctx context.Context, realmName string, token string) bool {
+	_, err := s.findUser(ctx, realmName, token)
+	return err == nil
+}
+
+func (s *passwordResetServiceImpl) CompleteReset(ctx context.Context, request CompletePasswordResetRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	user, err := s.findUser(ctx, request.RealmName, request.Token)
+	if err != nil {
+		return err
+	}
+
+	userService := ioc.Get[UserService](scope)
+	result := userService.SetPassword(ctx, SetPasswordRequest{
+		UserId:    user.Id,
+		Password:  request.NewPassword,
+		Temporary: false,
+	}, PasswordResetTokenAuthStrategy{
+		Token: request.Token,
+	})
+	if result.IsErr() {
+		return result.UnwrapErr()
+	}
+
+	if request.RevokeSessions {
+		sessionRepository := ioc.Get[repos.SessionRepository](scope)
+		sessionRepository.DeleteSessionsOfUser(ctx, user.Id)
+
+		refreshTokenRepository := ioc.Get[repos.RefreshTokenRepository](scope)
+		refreshTokenRepository.DeleteRefreshTokensOfUser(ctx, user.Id)
+	}
+
+	return nil
+}
+
+func (s *passwordResetServiceImpl) findRealm(ctx context.Context, realmName string) (*repos.Realm, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	return &realm, nil
+}
+
+// findUser returns the user of a reset token that is still valid.
+func (s *passwordResetServiceImpl) findUser(ctx context.Context, realmName string, token string) (*repos.User, error) {
+	scope := middlewares.GetScope(ctx)
+
+	invalidErr := httpErrors.BadRequest().WithMessage("the link expired or was already used")
+
+	realm, err := s.findRealm(ctx, realmName)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordResetTokenRepository := ioc.Get[repos.PasswordResetTokenRepository](scope)
+	resetToken, ok := passwordResetTokenRepository.FindPasswordResetTokens(ctx, repos.PasswordResetTokenFilter{
+		HashedToken: h.Some(utils.CheapHash(token)),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, invalidErr
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	if !clockService.Now().Before(resetToken.ValidUntil) {
+		return nil, invalidErr
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, resetToken.UserId).Get()
+	if !ok || user.RealmId != realm.Id || !user.Enabled {
+		return nil, invalidErr
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/realmconfig"
+	"holvit/realmexport"
+	"holvit/repos"
+	"holvit/routes"
+	"slices"
+	"strings"
+)
+
+type ReconcileRealmsRequest struct {
+	Realms []realmexport.Document
+	// DryRun only returns the changes without applying them.
+	DryRun bool
+}
+
+type GeneratedClientSecret struct {
+	Realm    string
+	ClientId string
+	Secret   string
+}
+
+type ReconcileRealmsResponse struct {
+	Changes []realmconfig.Change
+	// ClientSecrets are the secrets of the confidential clients that were created, they can not be retrieved later.
+	ClientSecrets []GeneratedClientSecret
+}
+
+type RealmConfigService interface {
+	// LoadDeclaredRealms reads the realms declared at the configured path, there are none if no path is configured.
+	LoadDeclaredRealms() h.Result[[]realmexport.Document]
+	// ReconcileRealms changes the declared realms to match their declarations in the transaction of the request.
+	// Realms that are not declared are left unchanged.
+	ReconcileRealms(ctx context.Context, request ReconcileRealmsRequest) h.Result[ReconcileRealmsResponse]
+}
+
+type realmConfigServiceImpl struct{}
+
+func NewRealmConfigService() RealmConfigService {
+	return &realmConfigServiceImpl{}
+}
+
+func (s *realmConfigServiceImpl) LoadDeclaredRealms() h.Result[[]realmexport.Document] {
+	if config.C.Realms.ConfigPath == "" {
+		return h.Ok[[]realmexport.Document](nil)
+	}
+
+	documents, err := realmconfig.Load(config.C.Realms.ConfigPath)
+	if err != nil {
+		return h.Err[[]realmexport.Document](err)
+	}
+
+	return h.Ok(documents)
+}
+
+func (s *realmConfigServiceImpl) ReconcileRealms(ctx context.Context, request ReconcileRealmsRequest) h.Result[ReconcileRealmsResponse] {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realmExportService := ioc.Get[RealmExportService](scope)
+
+	response := ReconcileRealmsResponse{
+		Changes:       make([]realmconfig.Change, 0),
+		ClientSecrets: make([]GeneratedClientSecret, 0),
+	}
+
+	for _, desired := range request.Realms {
+		if desired.Realm.Name == constants.MasterRealmName {
+			desired = withAdminClient(desired)
+		}
+
+		// users are only exported to be compared if the declaration has users
+		exportUsers := len(desired.Users) > 0
+
+		var current *realmexport.Document
+		realm := realmRepository.FindRealms(ctx, repos.RealmFilter{
+			Name: h.Some(desired.Realm.Name),
+		}).FirstOrNone()
+		if existing, ok := realm.Get(); ok {
+			document := realmExportService.ExportRealm(ctx, existing.Id, exportUsers)
+			current = &document
+		}
+
+		changes := realmconfig.Diff(current, desired)
+		response.Changes = append(response.Changes, changes...)
+		if request.DryRun || len(changes) == 0 {
+			continue
+		}
+
+		result := realmExportService.ImportRealm(ctx, ImportRealmRequest{
+			Document: withoutExistingPasswords(desired, current),
+			Policy:   realmexport.PolicyOverwrite,
+		})
+		if result.IsErr() {
+			return h.Err[ReconcileRealmsResponse](result.UnwrapErr())
+		}
+		imported := result.Unwrap()
+
+		for clientId, secret := range imported.ClientSecrets {
+			response.ClientSecrets = append(response.ClientSecrets, GeneratedClientSecret{
+				Realm:    desired.Realm.Name,
+				ClientId: clientId,
+				Secret:   secret,
+			})
+		}
+
+		// the deletes are taken from the imported realm, new realms come with scopes that might not be declared
+		reconciled := realmExportService.ExportRealm(ctx, imported.RealmId, exportUsers)
+		s.deleteObjects(ctx, imported.RealmId, realmconfig.Diff(&reconciled, desired))
+	}
+
+	return h.Ok(response)
+}
+
+// withAdminClient adds the client of the admin frontend to the declaration of the master realm, it can not be removed.
+func withAdminClient(document realmexport.Document) realmexport.Document {
+	hasAdminClient := slices.ContainsFunc(document.Clients, func(client realmexport.Client) bool {
+		return client.ClientId == constants.AdminClientId
+	})
+	if hasAdminClient {
+		return document
+	}
+
+	document.Clients = append(slices.Clone(document.Clients), realmexport.Client{
+		ClientId:                constants.AdminClientId,
+		DisplayName:             "Holvit Admin",
+		Protocol:                constants.ClientProtocolOidc,
+		RedirectUris:            []string{routes.AdminFrontend.Url()},
+		GrantTypes:              []string{constants.TokenGrantTypeAuthorizationCode, constants.TokenGrantTypeRefreshToken},
+		TokenEndpointAuthMethod: constants.TokenEndpointAuthMethodNone,
+		ResponseTypes:           []string{constants.AuthorizationResponseTypeCode},
+		ConsentRequired:         true,
+	})
+	return document
+}
+
+// withoutExistingPasswords removes the password hashes of users that already exist, declared passwords are only initial passwords.
+func withoutExistingPasswords(desired realmexport.Document, current *realmexport.Document) realmexport.Document {
+	if current == nil || len(desired.Users) == 0 {
+		return desired
+	}
+
+	existingUsernames := make(map[string]bool, len(current.Users))
+	for _, user := range current.Users {
+		existingUsernames[strings.ToLower(user.Username)] = true
+	}
+
+	users := make([]realmexport.User, 0, len(desired.Users))
+	for _, user := range desired.Users {
+		if existingUsernames[strings.ToLower(user.Username)] {
+			user.PasswordHash = ""
+			user.PasswordTemporary = false
+		}
+		users = append(users, user)
+	}
+
+	desired.Users = users
+	return desired
+}
+
+func (s *realmConfigServiceImpl) deleteObjects(ctx context.Context, realmId uuid.UUID, changes []realmconfig.Change) {
+	scope := middlewares.GetScope(ctx)
+
+	var roleIds []uuid.UUID
+	var claimMapperIds []uuid.UUID
+	var scopeIds []uuid.UUID
+	var clientIds []uuid.UUID
+
+	for _, change := range changes {
+		if change.Action != realmconfig.ActionDelete {
+			continue
+		}
+
+		switch change.Kind {
+		case realmconfig.KindRole:
+			roleRepository := ioc.Get[repos.RoleRepository](scope)
+			roleRepository.FindRoles(ctx, repos.RoleFilter{
+				RealmId: realmId,
+				Name:    h.Some(change.Name),
+			}).FirstOrNone().IfSome(func(x repos.Role) {
+				roleIds = append(roleIds, x.Id)
+			})
+		case realmconfig.KindClaimMapper:
+			claimMapperType, claimName, _ := strings.Cut(change.Name, ":")
+			claimMapperRepository := ioc.Get[repos.ClaimMapperRepository](scope)
+			for _, claimMapper := range claimMapperRepository.FindClaimMappers(ctx, repos.ClaimMapperFilter{
+				RealmId:    h.Some(realmId),
+				ClaimNames: h.Some([]string{claimName}),
+			}).Values() {
+				if claimMapper.Type == claimMapperType {
+					claimMapperIds = append(claimMapperIds, claimMapper.Id)
+				}
+			}
+		case realmconfig.KindScope:
+			scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+			for _, realmScope := range scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+				RealmId: realmId,
+				Names:   h.Some([]string{change.Name}),
+			}).Values() {
+				scopeIds = append(scopeIds, realmScope.Id)
+			}
+		case realmconfig.KindClient:
+			clientRepository := ioc.Get[repos.ClientRepository](scope)
+			clientRepository.FindClients(ctx, repos.ClientFilter{
+				RealmId:  h.Some(realmId),
+				ClientId: h.Some(change.Name),
+			}).FirstOrNone().IfSome(func(x repos.Client) {
+				clientIds = append(clientIds, x.Id)
+			})
+		}
+	}
+
+	if len(roleIds) > 0 {
+		roleService := ioc.Get[RoleService](scope)
+		roleService.DeleteRoles(ctx, DeleteRoleRequest{
+			RealmId: realmId,
+			RoleIds: roleIds,
+		})
+	}
+
+	claimMapperRepository := ioc.Get[repos.ClaimMapperRepository](scope)
+	for _, claimMapperId := range claimMapperIds {
+		claimMapperRepository.DeleteClaimMapper(ctx, claimMapperId)
+	}
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	for _, scopeId := range scopeIds {
+		scopeRepository.DeleteScope(ctx, scopeId)
+	}
+
+	// the roles of deleted clients are deleted with them
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	for _, clientId := range clientIds {
+		clientRepository.DeleteClient(ctx, clientId)
+	}
+}
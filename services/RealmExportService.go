@@ -0,0 +1,828 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/passwordpolicy"
+	"holvit/realmexport"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/utils"
+	"slices"
+	"strings"
+)
+
+type ImportRealmRequest struct {
+	Document realmexport.Document
+	// Policy is one of the realmexport.Policies.
+	Policy string
+}
+
+type ImportRealmResponse struct {
+	RealmId uuid.UUID
+	// ClientSecrets are the secrets generated for imported confidential clients by their client id, they can not be retrieved later.
+	ClientSecrets map[string]string
+}
+
+type RealmExportService interface {
+	ExportRealm(ctx context.Context, realmId uuid.UUID, includeUsers bool) realmexport.Document
+	// ImportRealm creates or updates the realm of the document in the transaction of the request.
+	// If an error is returned the transaction is marked as failed, none of the changes are committed.
+	ImportRealm(ctx context.Context, request ImportRealmRequest) h.Result[ImportRealmResponse]
+}
+
+type realmExportServiceImpl struct{}
+
+func NewRealmExportService() RealmExportService {
+	return &realmExportServiceImpl{}
+}
+
+func (s *realmExportServiceImpl) ExportRealm(ctx context.Context, realmId uuid.UUID, includeUsers bool) realmexport.Document {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, realmId).Unwrap()
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	clients := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId: h.Some(realmId),
+	}).Values()
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	roles := roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: realmId,
+	}).Values()
+
+	roleNames := make(map[uuid.UUID]string, len(roles))
+	for _, role := range roles {
+		roleNames[role.Id] = role.Name
+	}
+
+	document := realmexport.Document{
+		Version:      realmexport.Version,
+		Realm:        exportRealmSettings(realm, roleNames),
+		Roles:        make([]realmexport.Role, 0, len(roles)),
+		Scopes:       make([]realmexport.Scope, 0),
+		ClaimMappers: make([]realmexport.ClaimMapper, 0),
+		Clients:      make([]realmexport.Client, 0, len(clients)),
+	}
+
+	clientIds := make(map[uuid.UUID]string, len(clients))
+	for _, client := range clients {
+		clientIds[client.Id] = client.ClientId
+		document.Clients = append(document.Clients, exportClient(client))
+	}
+
+	roleImplicationRepository := ioc.Get[repos.RoleImplicationRepository](scope)
+	implications := make(map[uuid.UUID][]string)
+	for _, implication := range roleImplicationRepository.FindRoleImplications(ctx, repos.RoleImplicationFilter{
+		RealmId: realmId,
+	}) {
+		implications[implication.RoleId] = append(implications[implication.RoleId], roleNames[implication.ImpliedRoleId])
+	}
+
+	for _, role := range roles {
+		// internal roles are created with every realm
+		if role.Internal {
+			continue
+		}
+
+		var client *string
+		if clientId, ok := role.ClientId.Get(); ok {
+			client = h.Some(clientIds[clientId]).ToNillablePtr()
+		}
+
+		document.Roles = append(document.Roles, realmexport.Role{
+			Name:        role.Name,
+			DisplayName: role.DisplayName,
+			Description: role.Description,
+			Client:      client,
+			Implies:     utils.NonNilSlice(implications[role.Id]),
+		})
+	}
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	claimMapperRepository := ioc.Get[repos.ClaimMapperRepository](scope)
+
+	claimMapperScopes := make(map[uuid.UUID][]string)
+	for _, realmScope := range scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: realmId,
+	}).Values() {
+		document.Scopes = append(document.Scopes, realmexport.Scope{
+			Name:        realmScope.Name,
+			DisplayName: realmScope.DisplayName,
+			Description: realmScope.Description,
+			SortIndex:   realmScope.SortIndex,
+		})
+
+		for _, claimMapper := range claimMapperRepository.FindClaimMappers(ctx, repos.ClaimMapperFilter{
+			RealmId:  h.Some(realmId),
+			ScopeIds: h.Some([]uuid.UUID{realmScope.Id}),
+		}).Values() {
+			claimMapperScopes[claimMapper.Id] = append(claimMapperScopes[claimMapper.Id], realmScope.Name)
+		}
+	}
+
+	for _, claimMapper := range claimMapperRepository.FindClaimMappers(ctx, repos.ClaimMapperFilter{
+		RealmId: h.Some(realmId),
+	}).Values() {
+		exported := realmexport.ClaimMapper{
+			DisplayName: claimMapper.DisplayName,
+			Description: claimMapper.Description,
+			Type:        claimMapper.Type,
+			Scopes:      utils.NonNilSlice(claimMapperScopes[claimMapper.Id]),
+		}
+
+		switch details := claimMapper.Details.(type) {
+		case repos.RolesClaimMapperDetails:
+			exported.ClaimName = details.ClaimName
+		case repos.GroupsClaimMapperDetails:
+			exported.ClaimName = details.ClaimName
+		case repos.UserInfoClaimMapperDetails:
+			exported.ClaimName = details.ClaimName
+			exported.Property = details.Property
+		}
+
+		document.ClaimMappers = append(document.ClaimMappers, exported)
+	}
+
+	if includeUsers {
+		document.Users = s.exportUsers(ctx, realmId, roleNames)
+	}
+
+	return document
+}
+
+func exportRealmSettings(realm repos.Realm, roleNames map[uuid.UUID]string) realmexport.Realm {
+	defaultRoles := make([]string, 0, len(realm.DefaultRoleIds))
+	for _, roleId := range realm.DefaultRoleIds {
+		if name, ok := roleNames[roleId]; ok {
+			defaultRoles = append(defaultRoles, name)
+		}
+	}
+
+	return realmexport.Realm{
+		Name:                            realm.Name,
+		DisplayName:                     realm.DisplayName,
+		RequireUsername:                 realm.RequireUsername,
+		RequireEmail:                    realm.RequireEmail,
+		RequireDeviceVerification:       realm.RequireDeviceVerification,
+		RequireTotp:                     realm.RequireTotp,
+		RequireWebauthn:                 realm.RequireWebauthn,
+		EnableRememberMe:                realm.EnableRememberMe,
+		RequireEmailVerification:        realm.RequireEmailVerification,
+		EmailLoginMode:                  realm.EmailLoginMode,
+		PasswordHistoryLength:           realm.PasswordHistoryLength,
+		PasswordPolicy:                  passwordpolicy.Policy(realm.PasswordPolicy),
+		EnableRegistration:              realm.EnableRegistration,
+		RegistrationRequiresApproval:    realm.RegistrationRequiresApproval,
+		DefaultRoles:                    defaultRoles,
+		ConsentExpirySeconds:            realm.ConsentExpirySeconds.ToNillablePtr(),
+		BruteForceProtection:            realm.BruteForceProtection,
+		BruteForceMaxFailures:           realm.BruteForceMaxFailures,
+		BruteForceIpMaxFailures:         realm.BruteForceIpMaxFailures,
+		BruteForceLockoutSeconds:        realm.BruteForceLockoutSeconds,
+		BruteForceMaxDelaySeconds:       realm.BruteForceMaxDelaySeconds,
+		BruteForcePermanentLockoutAfter: realm.BruteForcePermanentLockoutAfter.ToNillablePtr(),
+	}
+}
+
+func exportClient(client repos.Client) realmexport.Client {
+	return realmexport.Client{
+		ClientId:                    client.ClientId,
+		DisplayName:                 client.DisplayName,
+		Protocol:                    client.Protocol,
+		HasSecret:                   client.ClientSecret.IsSome(),
+		RedirectUris:                utils.NonNilSlice(client.RedirectUris),
+		GrantTypes:                  utils.NonNilSlice(client.GrantTypes),
+		TokenEndpointAuthMethod:     client.TokenEndpointAuthMethod,
+		Jwks:                        client.Jwks.ToNillablePtr(),
+		ResponseTypes:               utils.NonNilSlice(client.ResponseTypes),
+		DefaultScopes:               utils.NonNilSlice(client.DefaultScopes),
+		OptionalScopes:              utils.NonNilSlice(client.OptionalScopes),
+		PkceRequired:                client.PkceRequired,
+		ConsentRequired:             client.ConsentRequired,
+		AccessTokenLifetimeSeconds:  client.AccessTokenLifetimeSeconds.ToNillablePtr(),
+		IdTokenLifetimeSeconds:      client.IdTokenLifetimeSeconds.ToNillablePtr(),
+		RefreshTokenLifetimeSeconds: client.RefreshTokenLifetimeSeconds.ToNillablePtr(),
+		FrontChannelLogoutUri:       client.FrontChannelLogoutUri.ToNillablePtr(),
+		BackChannelLogoutUri:        client.BackChannelLogoutUri.ToNillablePtr(),
+		WebOrigins:                  utils.NonNilSlice(client.WebOrigins),
+		SamlNameIdFormat:            client.SamlNameIdFormat.ToNillablePtr(),
+		SamlSignatureAlgorithm:      client.SamlSignatureAlgorithm.ToNillablePtr(),
+		SamlRequireSignedRequests:   client.SamlRequireSignedRequests,
+		SamlSigningCertificate:      client.SamlSigningCertificate.ToNillablePtr(),
+	}
+}
+
+func (s *realmExportServiceImpl) exportUsers(ctx context.Context, realmId uuid.UUID, roleNames map[uuid.UUID]string) []realmexport.User {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+
+	users := userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId: h.Some(realmId),
+	}).Values()
+
+	result := make([]realmexport.User, 0, len(users))
+	for _, user := range users {
+		exported := realmexport.User{
+			Username:      user.Username,
+			Email:         user.Email.ToNillablePtr(),
+			EmailVerified: user.EmailVerified,
+			Enabled:       user.Enabled,
+			Roles:         make([]string, 0),
+		}
+
+		credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+			UserId: h.Some(user.Id),
+			Type:   h.Some(constants.CredentialTypePassword),
+		}).FirstOrNone().IfSome(func(x repos.Credential) {
+			details := x.Details.(repos.CredentialPasswordDetails)
+			exported.PasswordHash = details.HashedPassword
+			exported.PasswordTemporary = details.Temporary
+		})
+
+		for _, userRole := range userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+			UserId: h.Some(user.Id),
+		}) {
+			exported.Roles = append(exported.Roles, roleNames[userRole.RoleId])
+		}
+
+		result = append(result, exported)
+	}
+
+	return result
+}
+
+// realmImport holds the state of an import, objects of the document are looked up by their names.
+type realmImport struct {
+	realmId uuid.UUID
+	// overwrite is set if existing objects are updated, which is always the case for a realm that was just created.
+	overwrite bool
+
+	roleIds   map[string]uuid.UUID
+	scopeIds  map[string]uuid.UUID
+	clientIds map[string]uuid.UUID
+
+	clientSecrets map[string]string
+}
+
+func (s *realmExportServiceImpl) ImportRealm(ctx context.Context, request ImportRealmRequest) h.Result[ImportRealmResponse] {
+	scope := middlewares.GetScope(ctx)
+	rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+	response, err := s.importRealm(ctx, request)
+	if err != nil {
+		rcs.Error(err)
+		return h.Err[ImportRealmResponse](err)
+	}
+
+	return h.Ok(response)
+}
+
+func (s *realmExportServiceImpl) importRealm(ctx context.Context, request ImportRealmRequest) (ImportRealmResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if !slices.Contains(realmexport.Policies, request.Policy) {
+		return ImportRealmResponse{}, httpErrors.BadRequest().WithMessage(fmt.Sprintf("unsupported import policy '%s'", request.Policy))
+	}
+
+	document := request.Document
+	if err := realmexport.Validate(document); err != nil {
+		return ImportRealmResponse{}, httpErrors.BadRequest().WithMessage(err.Error())
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	existingRealm := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(document.Realm.Name),
+	}).FirstOrNone()
+
+	state := realmImport{
+		overwrite:     request.Policy == realmexport.PolicyOverwrite,
+		roleIds:       make(map[string]uuid.UUID),
+		scopeIds:      make(map[string]uuid.UUID),
+		clientIds:     make(map[string]uuid.UUID),
+		clientSecrets: make(map[string]string),
+	}
+
+	if realm, ok := existingRealm.Get(); ok {
+		if request.Policy == realmexport.PolicyCreate {
+			return ImportRealmResponse{}, httpErrors.Conflict().WithMessage(fmt.Sprintf("realm '%s' already exists", realm.Name))
+		}
+		state.realmId = realm.Id
+	} else {
+		realmService := ioc.Get[RealmService](scope)
+		state.realmId = realmService.CreateRealm(ctx, CreateRealmRequest{
+			Name:        document.Realm.Name,
+			DisplayName: document.Realm.DisplayName,
+		}).Id
+		// the realm comes with default scopes and claim mappers, the document decides how they look
+		state.overwrite = true
+	}
+
+	if err := s.importScopes(ctx, &state, document.Scopes); err != nil {
+		return ImportRealmResponse{}, err
+	}
+
+	if err := s.importClaimMappers(ctx, &state, document.ClaimMappers); err != nil {
+		return ImportRealmResponse{}, err
+	}
+
+	if err := s.importClients(ctx, &state, document.Clients); err != nil {
+		return ImportRealmResponse{}, err
+	}
+
+	if err := s.importRoles(ctx, &state, document.Roles); err != nil {
+		return ImportRealmResponse{}, err
+	}
+
+	if state.overwrite {
+		if err := s.importRealmSettings(ctx, &state, document.Realm); err != nil {
+			return ImportRealmResponse{}, err
+		}
+	}
+
+	if err := s.importUsers(ctx, &state, document.Users); err != nil {
+		return ImportRealmResponse{}, err
+	}
+
+	return ImportRealmResponse{
+		RealmId:       state.realmId,
+		ClientSecrets: state.clientSecrets,
+	}, nil
+}
+
+func (s *realmExportServiceImpl) importRealmSettings(ctx context.Context, state *realmImport, realm realmexport.Realm) error {
+	scope := middlewares.GetScope(ctx)
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	realmRoles := make(map[string]uuid.UUID)
+	for _, role := range roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId:      state.realmId,
+		IsClientRole: h.Some(false),
+	}).Values() {
+		realmRoles[role.Name] = role.Id
+	}
+
+	// default roles have to be realm roles of this realm
+	defaultRoleIds := make([]uuid.UUID, 0, len(realm.DefaultRoles))
+	for _, name := range realm.DefaultRoles {
+		roleId, ok := realmRoles[name]
+		if !ok {
+			return httpErrors.BadRequest().WithMessage(fmt.Sprintf("the default role '%s' is not a realm role", name))
+		}
+		defaultRoleIds = append(defaultRoleIds, roleId)
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realmRepository.UpdateRealm(ctx, state.realmId, repos.RealmUpdate{
+		DisplayName:                     h.Some(realm.DisplayName),
+		RequireUsername:                 h.Some(realm.RequireUsername),
+		RequireEmail:                    h.Some(realm.RequireEmail),
+		RequireDeviceVerification:       h.Some(realm.RequireDeviceVerification),
+		RequireTotp:                     h.Some(realm.RequireTotp),
+		RequireWebauthn:                 h.Some(realm.RequireWebauthn),
+		EnableRememberMe:                h.Some(realm.EnableRememberMe),
+		RequireEmailVerification:        h.Some(realm.RequireEmailVerification),
+		EmailLoginMode:                  h.Some(realm.EmailLoginMode),
+		PasswordHistoryLength:           h.Some(realm.PasswordHistoryLength),
+		PasswordPolicy:                  h.Some(repos.PasswordPolicy(realm.PasswordPolicy)),
+		EnableRegistration:              h.Some(realm.EnableRegistration),
+		RegistrationRequiresApproval:    h.Some(realm.RegistrationRequiresApproval),
+		DefaultRoleIds:                  h.Some(defaultRoleIds),
+		ConsentExpirySeconds:            h.Some(h.FromPtr(realm.ConsentExpirySeconds)),
+		BruteForceProtection:            h.Some(realm.BruteForceProtection),
+		BruteForceMaxFailures:           h.Some(realm.BruteForceMaxFailures),
+		BruteForceIpMaxFailures:         h.Some(realm.BruteForceIpMaxFailures),
+		BruteForceLockoutSeconds:        h.Some(realm.BruteForceLockoutSeconds),
+		BruteForceMaxDelaySeconds:       h.Some(realm.BruteForceMaxDelaySeconds),
+		BruteForcePermanentLockoutAfter: h.Some(h.FromPtr(realm.BruteForcePermanentLockoutAfter)),
+	}).Unwrap()
+
+	return nil
+}
+
+func (s *realmExportServiceImpl) importScopes(ctx context.Context, state *realmImport, scopes []realmexport.Scope) error {
+	scope := middlewares.GetScope(ctx)
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	for _, existing := range scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: state.realmId,
+	}).Values() {
+		state.scopeIds[existing.Name] = existing.Id
+	}
+
+	for _, importedScope := range scopes {
+		scopeId, ok := state.scopeIds[importedScope.Name]
+		if !ok {
+			state.scopeIds[importedScope.Name] = scopeRepository.CreateScope(ctx, repos.Scope{
+				RealmId:     state.realmId,
+				Name:        importedScope.Name,
+				DisplayName: importedScope.DisplayName,
+				Description: importedScope.Description,
+				SortIndex:   importedScope.SortIndex,
+			}).Unwrap()
+			continue
+		}
+
+		if state.overwrite {
+			scopeRepository.UpdateScope(ctx, scopeId, repos.ScopeUpdate{
+				DisplayName: h.Some(importedScope.DisplayName),
+				Description: h.Some(importedScope.Description),
+				SortIndex:   h.Some(importedScope.SortIndex),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (s *realmExportServiceImpl) importClaimMappers(ctx context.Context, state *realmImport, claimMappers []realmexport.ClaimMapper) error {
+	scope := middlewares.GetScope(ctx)
+
+	claimMapperRepository := ioc.Get[repos.ClaimMapperRepository](scope)
+
+	type claimMapperKey struct {
+		Type      string
+		ClaimName string
+	}
+
+	existingClaimMappers := make(map[claimMapperKey]uuid.UUID)
+	for _, claimMapper := range claimMapperRepository.FindClaimMappers(ctx, repos.ClaimMapperFilter{
+		RealmId: h.Some(state.realmId),
+	}).Values() {
+		switch details := claimMapper.Details.(type) {
+		case repos.RolesClaimMapperDetails:
+			existingClaimMappers[claimMapperKey{claimMapper.Type, details.ClaimName}] = claimMapper.Id
+		case repos.GroupsClaimMapperDetails:
+			existingClaimMappers[claimMapperKey{claimMapper.Type, details.ClaimName}] = claimMapper.Id
+		case repos.UserInfoClaimMapperDetails:
+			existingClaimMappers[claimMapperKey{claimMapper.Type, details.ClaimName}] = claimMapper.Id
+		}
+	}
+
+	// the scopes each claim mapper currently belongs to
+	claimMapperScopes := make(map[uuid.UUID][]uuid.UUID)
+	for _, scopeId := range state.scopeIds {
+		for _, claimMapper := range claimMapperRepository.FindClaimMappers(ctx, repos.ClaimMapperFilter{
+			RealmId:  h.Some(state.realmId),
+			ScopeIds: h.Some([]uuid.UUID{scopeId}),
+		}).Values() {
+			claimMapperScopes[claimMapper.Id] = append(claimMapperScopes[claimMapper.Id], scopeId)
+		}
+	}
+
+	for _, claimMapper := range claimMappers {
+		var details interface{}
+		switch claimMapper.Type {
+		case constants.ClaimMapperRoles:
+			details = repos.RolesClaimMapperDetails{
+				ClaimName: claimMapper.ClaimName,
+			}
+		case constants.ClaimMapperGroups:
+			details = repos.GroupsClaimMapperDetails{
+				ClaimName: claimMapper.ClaimName,
+			}
+		case constants.ClaimMapperUserInfo:
+			details = repos.UserInfoClaimMapperDetails{
+				ClaimName: claimMapper.ClaimName,
+				Property:  claimMapper.Property,
+			}
+		}
+
+		claimMapperId, ok := existingClaimMappers[claimMapperKey{claimMapper.Type, claimMapper.ClaimName}]
+		if !ok {
+			claimMapperId = claimMapperRepository.CreateClaimMapper(ctx, repos.ClaimMapper{
+				RealmId:     state.realmId,
+				DisplayName: claimMapper.DisplayName,
+				Description: claimMapper.Description,
+				Type:        claimMapper.Type,
+				Details:     details,
+			})
+		} else if state.overwrite {
+			claimMapperRepository.UpdateClaimMapper(ctx, claimMapperId, repos.ClaimMapperUpdate{
+				DisplayName: h.Some(claimMapper.DisplayName),
+				Description: h.Some(claimMapper.Description),
+				Details:     h.Some(details),
+			})
+		} else {
+			continue
+		}
+
+		scopeIds := make([]uuid.UUID, 0, len(claimMapper.Scopes))
+		for _, scopeName := range claimMapper.Scopes {
+			scopeIds = append(scopeIds, state.scopeIds[scopeName])
+		}
+
+		for _, scopeId := range scopeIds {
+			if !slices.Contains(claimMapperScopes[claimMapperId], scopeId) {
+				claimMapperRepository.AssociateClaimMapper(ctx, repos.AssociateScopeClaimRequest{
+					ClaimMapperId: claimMapperId,
+					ScopeId:       scopeId,
+				})
+			}
+		}
+
+		for _, scopeId := range claimMapperScopes[claimMapperId] {
+			if !slices.Contains(scopeIds, scopeId) {
+				claimMapperRepository.DisassociateClaimMapper(ctx, repos.AssociateScopeClaimRequest{
+					ClaimMapperId: claimMapperId,
+					ScopeId:       scopeId,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *realmExportServiceImpl) importClients(ctx context.Context, state *realmImport, clients []realmexport.Client) error {
+	scope := middlewares.GetScope(ctx)
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	existingClients := make(map[string]repos.Client)
+	for _, client := range clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId: h.Some(state.realmId),
+	}).Values() {
+		existingClients[client.ClientId] = client
+		state.clientIds[client.ClientId] = client.Id
+	}
+
+	for _, client := range clients {
+		existing, ok := existingClients[client.ClientId]
+		if ok && !state.overwrite {
+			continue
+		}
+
+		if ok && existing.Protocol != client.Protocol {
+			return httpErrors.Conflict().WithMessage(fmt.Sprintf("client '%s' already exists with the protocol '%s'", client.ClientId, existing.Protocol))
+		}
+
+		clientSecret := h.None[h.Opt[string]]()
+		if client.HasSecret && !existing.ClientSecret.IsSome() {
+			secret := utils.GenerateRandomStringBase64(33)
+			clientSecret = h.Some(h.Some(config.C.GetHasher().Hash(secret)))
+			state.clientSecrets[client.ClientId] = "secret_" + secret
+		} else if !client.HasSecret && existing.ClientSecret.IsSome() {
+			clientSecret = h.Some(h.None[string]())
+		}
+
+		if !ok {
+			state.clientIds[client.ClientId] = clientRepository.CreateClient(ctx, repos.Client{
+				RealmId:                     state.realmId,
+				DisplayName:                 client.DisplayName,
+				Protocol:                    client.Protocol,
+				ClientId:                    client.ClientId,
+				ClientSecret:                clientSecret.UnwrapOrEmpty(),
+				RedirectUris:                utils.NonNilSlice(client.RedirectUris),
+				GrantTypes:                  utils.NonNilSlice(client.GrantTypes),
+				TokenEndpointAuthMethod:     client.TokenEndpointAuthMethod,
+				Jwks:                        h.FromPtr(client.Jwks),
+				ResponseTypes:               utils.NonNilSlice(client.ResponseTypes),
+				DefaultScopes:               utils.NonNilSlice(client.DefaultScopes),
+				OptionalScopes:              utils.NonNilSlice(client.OptionalScopes),
+				PkceRequired:                client.PkceRequired,
+				ConsentRequired:             client.ConsentRequired,
+				AccessTokenLifetimeSeconds:  h.FromPtr(client.AccessTokenLifetimeSeconds),
+				IdTokenLifetimeSeconds:      h.FromPtr(client.IdTokenLifetimeSeconds),
+				RefreshTokenLifetimeSeconds: h.FromPtr(client.RefreshTokenLifetimeSeconds),
+				FrontChannelLogoutUri:       h.FromPtr(client.FrontChannelLogoutUri),
+				BackChannelLogoutUri:        h.FromPtr(client.BackChannelLogoutUri),
+				WebOrigins:                  utils.NonNilSlice(client.WebOrigins),
+				SamlNameIdFormat:            h.FromPtr(client.SamlNameIdFormat),
+				SamlSignatureAlgorithm:      h.FromPtr(client.SamlSignatureAlgorithm),
+				SamlRequireSignedRequests:   client.SamlRequireSignedRequests,
+				SamlSigningCertificate:      h.FromPtr(client.SamlSigningCertificate),
+			}).Unwrap()
+			continue
+		}
+
+		clientRepository.UpdateClient(ctx, existing.Id, repos.ClientUpdate{
+			DisplayName:                 h.Some(client.DisplayName),
+			RedirectUris:                h.Some(utils.NonNilSlice(client.RedirectUris)),
+			ClientSecret:                clientSecret,
+			GrantTypes:                  h.Some(utils.NonNilSlice(client.GrantTypes)),
+			TokenEndpointAuthMethod:     h.Some(client.TokenEndpointAuthMethod),
+			Jwks:                        h.Some(h.FromPtr(client.Jwks)),
+			ResponseTypes:               h.Some(utils.NonNilSlice(client.ResponseTypes)),
+			DefaultScopes:               h.Some(utils.NonNilSlice(client.DefaultScopes)),
+			OptionalScopes:              h.Some(utils.NonNilSlice(client.OptionalScopes)),
+			PkceRequired:                h.Some(client.PkceRequired),
+			ConsentRequired:             h.Some(client.ConsentRequired),
+			AccessTokenLifetimeSeconds:  h.Some(h.FromPtr(client.AccessTokenLifetimeSeconds)),
+			IdTokenLifetimeSeconds:      h.Some(h.FromPtr(client.IdTokenLifetimeSeconds)),
+			RefreshTokenLifetimeSeconds: h.Some(h.FromPtr(client.RefreshTokenLifetimeSeconds)),
+			FrontChannelLogoutUri:       h.Some(h.FromPtr(client.FrontChannelLogoutUri)),
+			BackChannelLogoutUri:        h.Some(h.FromPtr(client.BackChannelLogoutUri)),
+			WebOrigins:                  h.Some(utils.NonNilSlice(client.WebOrigins)),
+			SamlNameIdFormat:            h.Some(h.FromPtr(client.SamlNameIdFormat)),
+			SamlSignatureAlgorithm:      h.Some(h.FromPtr(client.SamlSignatureAlgorithm)),
+			SamlRequireSignedRequests:   h.Some(client.SamlRequireSignedRequests),
+			SamlSigningCertificate:      h.Some(h.FromPtr(client.SamlSigningCertificate)),
+		}).Unwrap()
+	}
+
+	return nil
+}
+
+func (s *realmExportServiceImpl) importRoles(ctx context.Context, state *realmImport, roles []realmexport.Role) error {
+	scope := middlewares.GetScope(ctx)
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	existingRoles := make(map[string]repos.Role)
+	for _, role := range roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: state.realmId,
+	}).Values() {
+		existingRoles[role.Name] = role
+		state.roleIds[role.Name] = role.Id
+	}
+
+	// the implications are set after all roles exist, roles can imply roles that come later in the document
+	var updatedRoles []realmexport.Role
+	for _, role := range roles {
+		clientId := h.None[uuid.UUID]()
+		if role.Client != nil {
+			clientId = h.Some(state.clientIds[*role.Client])
+		}
+
+		existing, ok := existingRoles[role.Name]
+		if !ok {
+			state.roleIds[role.Name] = roleRepository.CreateRole(ctx, repos.Role{
+				RealmId:     state.realmId,
+				ClientId:    clientId,
+				DisplayName: role.DisplayName,
+				Name:        role.Name,
+				Description: role.Description,
+			}).Unwrap()
+			updatedRoles = append(updatedRoles, role)
+			continue
+		}
+
+		if !state.overwrite {
+			continue
+		}
+
+		if existing.Internal {
+			return httpErrors.Conflict().WithMessage(fmt.Sprintf("role '%s' is an internal role", role.Name))
+		}
+
+		if existing.ClientId.UnwrapOrEmpty() != clientId.UnwrapOrEmpty() || existing.ClientId.IsSome() != clientId.IsSome() {
+			return httpErrors.Conflict().WithMessage(fmt.Sprintf("role '%s' already exists for another client", role.Name))
+		}
+
+		roleRepository.UpdateRole(ctx, existing.Id, repos.RoleUpdate{
+			DisplayName: h.Some(role.DisplayName),
+			Description: h.Some(role.Description),
+		})
+		updatedRoles = append(updatedRoles, role)
+	}
+
+	roleService := ioc.Get[RoleService](scope)
+	for _, role := range updatedRoles {
+		impliedRoleIds := make([]uuid.UUID, 0, len(role.Implies))
+		for _, name := range role.Implies {
+			roleId, ok := state.roleIds[name]
+			if !ok {
+				return httpErrors.BadRequest().WithMessage(fmt.Sprintf("role '%s' implies the unknown role '%s'", role.Name, name))
+			}
+			impliedRoleIds = append(impliedRoleIds, roleId)
+		}
+
+		result := roleService.SetImplications(ctx, SetImplicationRequest{
+			RealmId: state.realmId,
+			RoleId:  state.roleIds[role.Name],
+			RoleIds: impliedRoleIds,
+		})
+		if result.IsErr() {
+			return httpErrors.BadRequest().WithMessage(fmt.Sprintf("the implications of role '%s' can not be set: %s", role.Name, result.UnwrapErr().Error()))
+		}
+	}
+
+	return nil
+}
+
+func (s *realmExportServiceImpl) importUsers(ctx context.Context, state *realmImport, users []realmexport.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+
+	existingUsers := make(map[string]repos.User)
+	for _, user := range userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId:   h.Some(state.realmId),
+		Usernames: h.Some(usernames),
+	}).Values() {
+		existingUsers[strings.ToLower(user.Username)] = user
+	}
+
+	var userRoles []repos.UserRole
+	for _, user := range users {
+		roleIds := make([]uuid.UUID, 0, len(user.Roles))
+		for _, name := range user.Roles {
+			roleId, ok := state.roleIds[name]
+			if !ok {
+				return httpErrors.BadRequest().WithMessage(fmt.Sprintf("user '%s' has the unknown role '%s'", user.Username, name))
+			}
+			roleIds = append(roleIds, roleId)
+		}
+
+		if user.PasswordHash != "" && !utils.IsSupportedHash(user.PasswordHash) {
+			return httpErrors.BadRequest().WithMessage(fmt.Sprintf("the password hash of user '%s' is not in a supported format", user.Username))
+		}
+
+		existing, ok := existingUsers[strings.ToLower(user.Username)]
+		if ok && !state.overwrite {
+			continue
+		}
+
+		var userId uuid.UUID
+		if !ok {
+			userId = userRepository.CreateUser(ctx, repos.User{
+				RealmId:       state.realmId,
+				Username:      user.Username,
+				Email:         h.FromPtr(user.Email),
+				EmailVerified: user.EmailVerified,
+				Enabled:       user.Enabled,
+			}).Unwrap()
+		} else {
+			userId = existing.Id
+			userRepository.UpdateUser(ctx, userId, repos.UserUpdate{
+				Email:         h.Some(h.FromPtr(user.Email)),
+				EmailVerified: h.Some(user.EmailVerified),
+				Enabled:       h.Some(user.Enabled),
+			}).Unwrap()
+		}
+
+		if user.PasswordHash != "" {
+			details := repos.CredentialPasswordDetails{
+				HashedPassword: user.PasswordHash,
+				Temporary:      user.PasswordTemporary,
+			}
+
+			password := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+				UserId: h.Some(userId),
+				Type:   h.Some(constants.CredentialTypePassword),
+			}).FirstOrNone()
+			if credential, ok := password.Get(); ok {
+				credentialRepository.UpdateCredential(ctx, credential.Id, repos.CredentialUpdate{
+					Details: h.Some[interface{}](details),
+				})
+			} else {
+				credentialRepository.CreateCredential(ctx, repos.Credential{
+					UserId:  userId,
+					Type:    constants.CredentialTypePassword,
+					Details: details,
+				}).Unwrap()
+			}
+		}
+
+		// the roles of overwritten users are replaced by the roles of the document
+		assignedRoleIds := make([]uuid.UUID, 0)
+		if ok {
+			for _, userRole := range userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+				UserId: h.Some(userId),
+			}) {
+				if slices.Contains(roleIds, userRole.RoleId) {
+					assignedRoleIds = append(assignedRoleIds, userRole.RoleId)
+				} else {
+					userRoleRepository.DeleteUserRole(ctx, userRole.Id)
+				}
+			}
+		}
+
+		for _, roleId := range roleIds {
+			if !slices.Contains(assignedRoleIds, roleId) {
+				userRoles = append(userRoles, repos.UserRole{
+					UserId: userId,
+					RoleId: roleId,
+				})
+			}
+		}
+	}
+
+	if len(userRoles) > 0 {
+		userRoleRepository.CreateUserRoles(ctx, userRoles)
+	}
+
+	return nil
+}
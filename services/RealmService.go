@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"github.com/google/uuid"
 	"holvit/cache"
@@ -22,7 +23,13 @@ type CreateRealmRequest struct {
 	RequireEmail              *bool
 	RequireDeviceVerification *bool
 	RequireTotp               *bool
+	RequireWebauthn           *bool
 	EnableRememberMe          *bool
+	EmailLoginMode            *string
+	RequireEmailVerification  *bool
+
+	EnableRegistration           *bool
+	RegistrationRequiresApproval *bool
 
 	PasswordHistoryLength *int
 }
@@ -49,18 +56,27 @@ func (s *realmServiceImpl) CreateRealm(ctx context.Context, request CreateRealmR
 	privateKey, _ := utils.GenerateKeyPair()
 	privateKeyBytes := utils.ExportPrivateKey(privateKey)
 	encryptedPrivateKeyBytes := utils.EncryptSymmetric(privateKeyBytes, key)
+	rsaPrivateKey := utils.GenerateRsaKey()
+	encryptedRsaPrivateKeyBytes := utils.EncryptSymmetric(utils.ExportRsaPrivateKey(rsaPrivateKey), key)
 
 	realmRepository := ioc.Get[repos.RealmRepository](scope)
 	realmId := realmRepository.CreateRealm(ctx, repos.Realm{
-		Name:                      request.Name,
-		DisplayName:               request.DisplayName,
-		EncryptedPrivateKey:       encryptedPrivateKeyBytes,
-		RequireUsername:           utils.GetOrDefault(request.RequireUsername, true),
-		RequireEmail:              utils.GetOrDefault(request.RequireUsername, false),
-		RequireDeviceVerification: utils.GetOrDefault(request.RequireDeviceVerification, false),
-		RequireTotp:               utils.GetOrDefault(request.RequireTotp, false),
-		EnableRememberMe:          utils.GetOrDefault(request.EnableRememberMe, false),
-		PasswordHistoryLength:     utils.GetOrDefault(request.PasswordHistoryLength, 3),
+		Name:                         request.Name,
+		DisplayName:                  request.DisplayName,
+		EncryptedPrivateKey:          encryptedPrivateKeyBytes,
+		EncryptedRsaPrivateKey:       h.Some(encryptedRsaPrivateKeyBytes),
+		RequireUsername:              utils.GetOrDefault(request.RequireUsername, true),
+		RequireEmail:                 utils.GetOrDefault(request.RequireEmail, false),
+		RequireDeviceVerification:    utils.GetOrDefault(request.RequireDeviceVerification, false),
+		RequireTotp:                  utils.GetOrDefault(request.RequireTotp, false),
+		RequireWebauthn:              utils.GetOrDefault(request.RequireWebauthn, false),
+		EnableRememberMe:             utils.GetOrDefault(request.EnableRememberMe, false),
+		RequireEmailVerification:     utils.GetOrDefault(request.RequireEmailVerification, false),
+		PasswordHistoryLength:        utils.GetOrDefault(request.PasswordHistoryLength, 3),
+		EmailLoginMode:               utils.GetOrDefault(request.EmailLoginMode, constants.EmailLoginModeDisabled),
+		EnableRegistration:           utils.GetOrDefault(request.EnableRegistration, false),
+		RegistrationRequiresApproval: utils.GetOrDefault(request.RegistrationRequiresApproval, false),
+		DefaultRoleIds:               []uuid.UUID{},
 	}).Unwrap() //TODO: handle duplicate name error
 
 	s.createOpenIdScope(ctx, realmId)
@@ -69,6 +85,7 @@ func (s *realmServiceImpl) CreateRealm(ctx context.Context, request CreateRealmR
 
 	keyCache := ioc.Get[cache.KeyCache](scope)
 	keyCache.Set(realmId, privateKeyBytes)
+	keyCache.SetRsa(realmId, rsaPrivateKey)
 
 	roleRepository := ioc.Get[repos.RoleRepository](scope)
 	if request.Name != constants.MasterRealmName {
@@ -98,6 +115,16 @@ func (s *realmServiceImpl) CreateRealm(ctx context.Context, request CreateRealmR
 		}).Unwrap()
 	}
 
+	roleRepository.CreateRole(ctx, repos.Role{
+		RealmId:      realmId,
+		ClientId:     h.None[uuid.UUID](),
+		DisplayName:  "SCIM Provisioning",
+		Name:         constants.ScimRoleName,
+		Description:  "Allows clients to provision users and groups via SCIM",
+		ImpliesCache: nil,
+		Internal:     true,
+	}).Unwrap()
+
 	return CreateRealmResponse{
 		Id: realmId,
 	}
@@ -261,5 +288,17 @@ func (s *realmServiceImpl) InitializeRealmKeys(ctx context.Context) {
 		privateKey, _ := utils.ImportPrivateKey(decryptedPrivateKeyBytes)
 
 		keyCache.Set(realm.Id, privateKey)
+
+		var rsaPrivateKey *rsa.PrivateKey
+		if encryptedRsaPrivateKey, ok := realm.EncryptedRsaPrivateKey.Get(); ok {
+			rsaPrivateKey = utils.ImportRsaPrivateKey(utils.DecryptSymmetric(encryptedRsaPrivateKey, key))
+		} else {
+			rsaPrivateKey = utils.GenerateRsaKey()
+			realmRepository.UpdateRealm(ctx, realm.Id, repos.RealmUpdate{
+				EncryptedRsaPrivateKey: h.Some(utils.EncryptSymmetric(utils.ExportRsaPrivateKey(rsaPrivateKey), key)),
+			}).Unwrap()
+		}
+
+		keyCache.SetRsa(realm.Id, rsaPrivateKey)
 	}
 }
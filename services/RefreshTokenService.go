@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/google/uuid"
+	"holvit/config"
 	"holvit/h"
 	"holvit/httpErrors"
 	"holvit/ioc"
@@ -21,10 +23,14 @@ type CreateRefreshTokenRequest struct {
 	Subject  string
 	Audience string
 	Scopes   []string
+
+	ValidTime time.Duration
+
+	ClaimsRequest *ClaimsRequest
 }
 
 type RefreshTokenService interface {
-	ValidateAndRefresh(ctx context.Context, token string, clientId uuid.UUID) h.Result[h.T2[string, repos.RefreshToken]]
+	ValidateAndRefresh(ctx context.Context, token string, client repos.Client) h.Result[h.T2[string, repos.RefreshToken]]
 	CreateRefreshToken(ctx context.Context, request CreateRefreshTokenRequest) (string, repos.RefreshToken)
 }
 
@@ -34,7 +40,7 @@ func NewRefreshTokenService() RefreshTokenService {
 
 type refreshTokenServiceImpl struct{}
 
-func (r *refreshTokenServiceImpl) ValidateAndRefresh(ctx context.Context, token string, clientId uuid.UUID) h.Result[h.T2[string, repos.RefreshToken]] {
+func (r *refreshTokenServiceImpl) ValidateAndRefresh(ctx context.Context, token string, client repos.Client) h.Result[h.T2[string, repos.RefreshToken]] {
 	scope := middlewares.GetScope(ctx)
 
 	hashedToken := utils.CheapHash(token)
@@ -47,23 +53,40 @@ func (r *refreshTokenServiceImpl) ValidateAndRefresh(ctx context.Context, token
 		HashedToken: h.Some(hashedToken),
 	}).Single()
 
+	if refreshToken.ClientId != client.Id {
+		return h.Err[h.T2[string, repos.RefreshToken]](httpErrors.Unauthorized().WithMessage("token not valid"))
+	}
+
 	if refreshToken.ValidUntil.Compare(now) < 0 {
 		return h.Err[h.T2[string, repos.RefreshToken]](httpErrors.Unauthorized().WithMessage("token not valid"))
 	}
 
 	refreshTokenRepository.DeleteRefreshToken(ctx, refreshToken.Id)
 
+	claimsRequest := storedClaimsRequest(refreshToken)
+
 	return h.Ok(h.NewT2(r.CreateRefreshToken(ctx, CreateRefreshTokenRequest{
-		ClientId: clientId,
-		UserId:   refreshToken.UserId,
-		RealmId:  refreshToken.RealmId,
-		Issuer:   refreshToken.Issuer,
-		Subject:  refreshToken.Subject,
-		Audience: refreshToken.Audience,
-		Scopes:   refreshToken.Scopes,
+		ClientId:  client.Id,
+		UserId:    refreshToken.UserId,
+		RealmId:   refreshToken.RealmId,
+		Issuer:    refreshToken.Issuer,
+		Subject:   refreshToken.Subject,
+		Audience:  refreshToken.Audience,
+		Scopes:    refreshToken.Scopes,
+		ValidTime: clientTokenLifetime(client.RefreshTokenLifetimeSeconds, config.C.Tokens.RefreshTokenLifetime),
+
+		ClaimsRequest: claimsRequest,
 	})))
 }
 
+func storedClaimsRequest(refreshToken repos.RefreshToken) *ClaimsRequest {
+	raw, ok := refreshToken.ClaimsRequest.Get()
+	if !ok {
+		return nil
+	}
+	return utils.Ptr(utils.FromRawMessage[ClaimsRequest](json.RawMessage(raw)).Unwrap())
+}
+
 func (r *refreshTokenServiceImpl) CreateRefreshToken(ctx context.Context, request CreateRefreshTokenRequest) (string, repos.RefreshToken) {
 	scope := middlewares.GetScope(ctx)
 
@@ -73,17 +96,28 @@ func (r *refreshTokenServiceImpl) CreateRefreshToken(ctx context.Context, reques
 	token := utils.GenerateRandomStringBase64(32) // TODO: constant
 	hashedToken := utils.CheapHash(token)
 
+	claimsRequest := h.None[string]()
+	if request.ClaimsRequest != nil {
+		raw, err := json.Marshal(request.ClaimsRequest)
+		if err != nil {
+			panic(err)
+		}
+		claimsRequest = h.Some(string(raw))
+	}
+
 	refreshTokenRepository := ioc.Get[repos.RefreshTokenRepository](scope)
 	refreshToken := repos.RefreshToken{
 		UserId:      request.UserId,
 		ClientId:    request.ClientId,
 		RealmId:     request.RealmId,
 		HashedToken: hashedToken,
-		ValidUntil:  now.Add(time.Hour), //TODO: make configurable
+		ValidUntil:  now.Add(request.ValidTime),
 		Issuer:      request.Issuer,
 		Subject:     request.Subject,
 		Audience:    request.Audience,
 		Scopes:      request.Scopes,
+
+		ClaimsRequest: claimsRequest,
 	}
 	tokenId := refreshTokenRepository.CreateRefreshToken(ctx, refreshToken)
 
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/utils"
+	"html"
+	"strings"
+)
+
+type RegisterRequest struct {
+	LoginToken string
+	Username   string
+	Email      string
+	Password   string
+}
+
+type VerifyRegistrationRequest struct {
+	LoginToken string
+	Code       string
+	Ip         string
+}
+
+type RegistrationResult struct {
+	// UserId is set once the account was created and the login can continue as the new user.
+	UserId h.Opt[uuid.UUID]
+	// NextStep is the step the frontend has to show if the login cannot continue yet.
+	NextStep string
+}
+
+// RegistrationService implements the self-registration of users from the login page.
+type RegistrationService interface {
+	// Register validates the new account. If an email was given, a code is sent to it and the account is only
+	// created once the code was entered with VerifyRegistration, otherwise the account is created right away.
+	Register(ctx context.Context, request RegisterRequest) (*RegistrationResult, error)
+	VerifyRegistration(ctx context.Context, request VerifyRegistrationRequest) (*RegistrationResult, error)
+}
+
+type registrationServiceImpl struct{}
+
+func NewRegistrationService() RegistrationService {
+	return &registrationServiceImpl{}
+}
+
+func (s *registrationServiceImpl) Register(ctx context.Context, request RegisterRequest) (*RegistrationResult, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, request.LoginToken).Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	err := loginInfo.ExpectStep(constants.AuthenticateStepVerifyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, loginInfo.RealmId).Unwrap()
+
+	if !realm.EnableRegistration {
+		return nil, httpErrors.BadRequest().WithMessage("realm does not allow registration")
+	}
+
+	username := strings.TrimSpace(request.Username)
+	email := strings.TrimSpace(request.Email)
+
+	if realm.RequireUsername && username == "" {
+		return nil, httpErrors.BadRequest().WithMessage("username is required")
+	}
+	if realm.RequireEmail && email == "" {
+		return nil, httpErrors.BadRequest().WithMessage("email is required")
+	}
+	if username == "" {
+		// realms without usernames use the email to sign in
+		username = email
+	}
+	if username == "" {
+		return nil, httpErrors.BadRequest().WithMessage("username or email is required")
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	if userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId:  h.Some(realm.Id),
+		Username: h.Some(username),
+	}).Any() {
+		return nil, httpErrors.BadRequest().WithMessage("username is already taken")
+	}
+	if email != "" && userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId: h.Some(realm.Id),
+		Email:   h.Some(email),
+	}).Any() {
+		return nil, httpErrors.BadRequest().WithMessage("email is already registered")
+	}
+
+	userService := ioc.Get[UserService](scope)
+	err = userService.CheckPasswordPolicy(ctx, CheckPasswordPolicyRequest{
+		RealmId:  realm.Id,
+		Username: username,
+		Email:    h.SomeIf(email != "", email),
+		Password: request.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := RegistrationInfo{
+		RealmId:        realm.Id,
+		LoginToken:     request.LoginToken,
+		Username:       username,
+		Email:          email,
+		HashedPassword: config.C.GetHasher().Hash(request.Password),
+	}
+
+	currentUser := ioc.Get[CurrentSessionService](scope)
+	loginInfo.DeviceId = currentUser.DeviceIdString()
+
+	if email == "" {
+		return s.createAccount(ctx, realm, &loginInfo, info, false)
+	}
+
+	// the account is only created once the user proved that they own the email
+	clockService := ioc.Get[utils.ClockService](scope)
+	key := config.C.GetSymmetricEncryptionKey()
+
+	code := utils.GenerateNumericCode(constants.EmailLoginCodeLength)
+	info.HashedCode = utils.Sign(code, key)
+	info.ExpiresAt = clockService.Now().Add(config.C.Registration.Expiry)
+
+	token := tokenService.StoreRegistration(ctx, info, config.C.Registration.Expiry)
+
+	jobService := ioc.Get[JobService](scope)
+	jobService.QueueJob(ctx, repos.SendMailJobDetails{
+		To:      []string{email},
+		Subject: fmt.Sprintf("Verify your email for %s", realm.DisplayName),
+		Body: fmt.Sprintf(`<html><body>Enter the following code to finish your registration at %s:<br/><b>%s</b><br/>The code expires in %s.</body></html>`,
+			html.EscapeString(realm.DisplayName),
+			html.EscapeString(code),
+			config.C.Registration.Expiry),
+	})
+
+	loginInfo.RegistrationToken = token
+	loginInfo.NextStep = constants.AuthenticateStepVerifyRegistration
+
+	result := tokenService.OverwriteLoginCode(ctx, request.LoginToken, loginInfo)
+	if result.IsErr() {
+		return nil, result.UnwrapErr()
+	}
+
+	return &RegistrationResult{
+		NextStep: constants.AuthenticateStepVerifyRegistration,
+	}, nil
+}
+
+func (s *registrationServiceImpl) VerifyRegistration(ctx context.Context, request VerifyRegistrationRequest) (*RegistrationResult, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenService := ioc.Get[TokenService](scope)
+	loginInfo, ok := tokenService.PeekLoginCode(ctx, request.LoginToken).Get()
+	if !ok {
+		return nil, httpErrors.BadRequest().WithMessage("token not found")
+	}
+
+	currentUser := ioc.Get[CurrentSessionService](scope)
+	if currentUser.DeviceIdString() != loginInfo.DeviceId {
+		return nil, httpErrors.Unauthorized().WithMessage("wrong device id")
+	}
+
+	if loginInfo.NextStep != constants.AuthenticateStepVerifyRegistration {
+		return nil, httpErrors.Unauthorized().WithMessage(
+			fmt.Sprintf("wrong login step '%s', expected '%s'", loginInfo.NextStep, constants.AuthenticateStepVerifyRegistration))
+	}
+
+	info, ok := tokenService.PeekRegistration(ctx, loginInfo.RegistrationToken).Get()
+	if !ok || info.LoginToken != request.LoginToken {
+		return nil, httpErrors.Unauthorized().WithMessage("the code expired, please register again")
+	}
+
+	// the account does not exist yet, so only the ip address is tracked
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: info.RealmId,
+		Ip:      request.Ip,
+	}
+	err := bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := config.C.GetSymmetricEncryptionKey()
+	if !utils.VerifySignature(request.Code, info.HashedCode, key) {
+		bruteForceService.RecordFailure(ctx, attempt)
+		info.Attempts++
+		if info.Attempts >= config.C.Registration.MaxAttempts {
+			tokenService.RetrieveRegistration(ctx, loginInfo.RegistrationToken)
+		} else {
+			clockService := ioc.Get[utils.ClockService](scope)
+			tokenService.OverwriteRegistration(ctx, loginInfo.RegistrationToken, info, info.ExpiresAt.Sub(clockService.Now()))
+		}
+		return nil, httpErrors.Unauthorized().WithMessage("invalid code")
+	}
+
+	if _, ok := tokenService.RetrieveRegistration(ctx, loginInfo.RegistrationToken).Get(); !ok {
+		return nil, httpErrors.Unauthorized().WithMessage("the code expired, please register again")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, info.RealmId).Unwrap()
+
+	loginInfo.RegistrationToken = ""
+	return s.createAccount(ctx, realm, &loginInfo, info, true)
+}
+
+// createAccount creates the user with their password and the default roles of the realm.
+func (s *registrationServiceImpl) createAccount(ctx context.Context, realm repos.Realm, loginInfo *LoginInfo, info RegistrationInfo, emailVerified bool) (*RegistrationResult, error) {
+	scope := middlewares.GetScope(ctx)
+
+	userService := ioc.Get[UserService](scope)
+	userResult := userService.CreateUser(ctx, CreateUserRequest{
+		RealmId:         realm.Id,
+		Username:        info.Username,
+		Email:           h.SomeIf(info.Email != "", info.Email),
+		EmailVerified:   emailVerified,
+		ApprovalPending: realm.RegistrationRequiresApproval,
+	})
+	if userResult.IsErr() {
+		if _, ok := userResult.UnwrapErr().(repos.DuplicateUsernameError); ok {
+			return nil, httpErrors.BadRequest().WithMessage("username is already taken")
+		}
+		return nil, userResult.UnwrapErr()
+	}
+	userId := userResult.Unwrap()
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	credentialRepository.CreateCredential(ctx, repos.Credential{
+		UserId: userId,
+		Type:   constants.CredentialTypePassword,
+		Details: repos.CredentialPasswordDetails{
+			HashedPassword: info.HashedPassword,
+			Temporary:      false,
+		},
+	}).Unwrap()
+
+	if len(realm.DefaultRoleIds) > 0 {
+		// roles that were deleted since they were made default are skipped
+		roleRepository := ioc.Get[repos.RoleRepository](scope)
+		roles := roleRepository.FindRoles(ctx, repos.RoleFilter{
+			RealmId: realm.Id,
+			RoleIds: h.Some(realm.DefaultRoleIds),
+		})
+
+		roleIds := make([]uuid.UUID, 0, roles.Count())
+		for _, role := range roles.Values() {
+			roleIds = append(roleIds, role.Id)
+		}
+
+		roleService := ioc.Get[RoleService](scope)
+		roleService.AssignRolesToUser(ctx, AssignRolesToUserRequest{
+			RealmId: realm.Id,
+			UserId:  userId,
+			RoleIds: roleIds,
+		})
+	}
+
+	tokenService := ioc.Get[TokenService](scope)
+
+	if realm.RegistrationRequiresApproval {
+		// the user cannot sign in before an admin approved the account
+		tokenService.RetrieveLoginCode(ctx, info.LoginToken)
+		return &RegistrationResult{
+			NextStep: constants.AuthenticateStepApprovalPending,
+		}, nil
+	}
+
+	result := tokenService.OverwriteLoginCode(ctx, info.LoginToken, *loginInfo)
+	if result.IsErr() {
+		return nil, result.UnwrapErr()
+	}
+
+	return &RegistrationResult{
+		UserId: h.Some(userId),
+	}, nil
+}
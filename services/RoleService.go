@@ -58,6 +58,10 @@ type RoleService interface {
 	SetImplications(ctx context.Context, request SetImplicationRequest) h.Result[h.Unit]
 
 	AssignRolesToUser(ctx context.Context, request AssignRolesToUserRequest)
+	// GetRolesForUser returns the roles of the user, the roles of the groups the user is a member of and the roles they imply.
+	GetRolesForUser(ctx context.Context, request GetRolesForUserRequest) []repos.Role
+	// RecalculateCache updates the implied roles of all roles and groups of the realm.
+	RecalculateCache(ctx context.Context, realmId uuid.UUID)
 }
 
 func NewRoleService() RoleService {
@@ -84,10 +88,10 @@ func (s *roleServiceImpl) DeleteRoles(ctx context.Context, request DeleteRoleReq
 
 	rolesRepository := ioc.Get[repos.RoleRepository](scope)
 	rolesRepository.DeleteRoles(ctx, request.RealmId, request.RoleIds)
-	s.recalculateCache(ctx, request.RealmId)
+	s.RecalculateCache(ctx, request.RealmId)
 }
 
-func (s *roleServiceImpl) recalculateCache(ctx context.Context, realmId uuid.UUID) {
+func (s *roleServiceImpl) RecalculateCache(ctx context.Context, realmId uuid.UUID) {
 	scope := middlewares.GetScope(ctx)
 
 	rolesRepository := ioc.Get[repos.RoleRepository](scope)
@@ -132,6 +136,41 @@ func (s *roleServiceImpl) recalculateCache(ctx context.Context, realmId uuid.UUI
 			ImpliesCache: h.Some(impliedRoles),
 		})
 	}
+
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+	groupRoleRepository := ioc.Get[repos.GroupRoleRepository](scope)
+
+	groupRoles := make(map[uuid.UUID][]uuid.UUID)
+	for _, groupRole := range groupRoleRepository.FindGroupRoles(ctx, repos.GroupRoleFilter{
+		RealmId: h.Some(realmId),
+	}) {
+		groupRoles[groupRole.GroupId] = append(groupRoles[groupRole.GroupId], groupRole.RoleId)
+	}
+
+	// groups are ordered by their path, so parents come before their children
+	groupCache := make(map[uuid.UUID][]uuid.UUID)
+	for _, group := range groupRepository.FindGroups(ctx, repos.GroupFilter{
+		RealmId: h.Some(realmId),
+	}).Values() {
+		var rolesCache []uuid.UUID
+		if parentId, ok := group.ParentId.Get(); ok {
+			rolesCache = slices.Clone(groupCache[parentId])
+		}
+		for _, roleId := range groupRoles[group.Id] {
+			rolesCache = append(rolesCache, roleId)
+			rolesCache = append(rolesCache, findImplications(roleId)...)
+		}
+
+		slices.SortFunc(rolesCache, func(a uuid.UUID, b uuid.UUID) int {
+			return slices.Compare(a[:], b[:])
+		})
+		rolesCache = slices.Compact(rolesCache)
+
+		groupCache[group.Id] = rolesCache
+		groupRepository.UpdateGroup(ctx, group.Id, repos.GroupUpdate{
+			RolesCache: h.Some(rolesCache),
+		}).Unwrap()
+	}
 }
 
 func (s *roleServiceImpl) SetImplications(ctx context.Context, request SetImplicationRequest) h.Result[h.Unit] {
@@ -141,6 +180,7 @@ func (s *roleServiceImpl) SetImplications(ctx context.Context, request SetImplic
 	roleImplicationRepository := ioc.Get[repos.RoleImplicationRepository](scope)
 
 	impliedRoles := rolesRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: request.RealmId,
 		RoleIds: h.Some(request.RoleIds),
 	})
 
@@ -166,7 +206,7 @@ func (s *roleServiceImpl) SetImplications(ctx context.Context, request SetImplic
 		ImpliesCache: h.Some(request.RoleIds),
 	})
 
-	s.recalculateCache(ctx, request.RealmId)
+	s.RecalculateCache(ctx, request.RealmId)
 
 	return h.UOk()
 }
@@ -185,3 +225,37 @@ func (s *roleServiceImpl) AssignRolesToUser(ctx context.Context, request AssignR
 	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
 	userRoleRepository.CreateUserRoles(ctx, userRoles)
 }
+
+func (s *roleServiceImpl) GetRolesForUser(ctx context.Context, request GetRolesForUserRequest) []repos.Role {
+	scope := middlewares.GetScope(ctx)
+
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+	rolesRepository := ioc.Get[repos.RoleRepository](scope)
+	groupRepository := ioc.Get[repos.GroupRepository](scope)
+
+	roleIds := make([]uuid.UUID, 0)
+	for _, userRole := range userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+		UserId: h.Some(request.UserId),
+	}) {
+		roleIds = append(roleIds, userRole.RoleId)
+	}
+
+	for _, role := range rolesRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: request.RealmId,
+		RoleIds: h.Some(roleIds),
+	}).Values() {
+		roleIds = append(roleIds, role.ImpliesCache...)
+	}
+
+	for _, group := range groupRepository.FindGroups(ctx, repos.GroupFilter{
+		RealmId:  h.Some(request.RealmId),
+		MemberId: h.Some(request.UserId),
+	}).Values() {
+		roleIds = append(roleIds, group.RolesCache...)
+	}
+
+	return rolesRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: request.RealmId,
+		RoleIds: h.Some(roleIds),
+	}).Values()
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/cache"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/saml"
+	"holvit/utils"
+	"html/template"
+	"net/http"
+	"reflect"
+	"slices"
+)
+
+type SamlSingleSignOnRequest struct {
+	RealmName    string
+	AuthnRequest saml.AuthnRequest
+	RelayState   string
+
+	// Message is the decoded AuthnRequest, which carries the signature with the HTTP-POST binding.
+	Message []byte
+	// RawQuery is the query of a request with the HTTP-Redirect binding, which carries the signature with this binding.
+	RawQuery string
+}
+
+// SamlPostResponse sends the response to the service provider using the HTTP-POST binding.
+type SamlPostResponse struct {
+	AssertionConsumerServiceUrl string
+	SamlResponse                string
+	RelayState                  string
+}
+
+var samlPostTemplate = template.Must(template.New("samlPost").Parse(`<!doctype html>
+<html><body onload="document.forms[0].submit()">
+<form method="post" action="{{.AssertionConsumerServiceUrl}}">
+<input type="hidden" name="SAMLResponse" value="{{.SamlResponse}}"/>
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}"/>{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body></html>`))
+
+func (s *SamlPostResponse) HandleHttp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	err := samlPostTemplate.Execute(w, s)
+	if err != nil {
+		panic(err)
+	}
+}
+
+type SamlService interface {
+	Metadata(ctx context.Context, realmName string) ([]byte, error)
+	// VerifyRequest checks the signature, issue instant and destination of the request if the service provider
+	// requires signed requests, it is checked before the user is asked to sign in.
+	VerifyRequest(ctx context.Context, request SamlSingleSignOnRequest) error
+	SingleSignOn(ctx context.Context, request SamlSingleSignOnRequest) (*SamlPostResponse, error)
+}
+
+type samlServiceImpl struct{}
+
+func NewSamlService() SamlService {
+	return &samlServiceImpl{}
+}
+
+func samlEntityId(realmName string) string {
+	return routes.SamlMetadata.Url(realmName)
+}
+
+func (s *samlServiceImpl) Metadata(ctx context.Context, realmName string) ([]byte, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return nil, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	keyCache := ioc.Get[cache.KeyCache](scope)
+	key, ok := keyCache.Get(realm.Id)
+	if !ok {
+		return nil, fmt.Errorf("could not get key of realm %s", realm.Name)
+	}
+	rsaKey, ok := keyCache.GetRsa(realm.Id)
+	if !ok {
+		return nil, fmt.Errorf("could not get rsa key of realm %s", realm.Name)
+	}
+
+	// the rsa certificate comes first, service providers that only read one certificate take the first
+	return saml.BuildMetadata(saml.MetadataParams{
+		EntityId:        samlEntityId(realm.Name),
+		SingleSignOnUrl: routes.SamlSingleSignOn.Url(realm.Name),
+		Certificates: [][]byte{
+			utils.SelfSignedCertificate(rsaKey, realm.Name),
+			utils.SelfSignedCertificate(key, realm.Name),
+		},
+	})
+}
+
+func (s *samlServiceImpl) findServiceProvider(ctx context.Context, request SamlSingleSignOnRequest) (repos.Realm, repos.Client, error) {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(request.RealmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, repos.Client{}, httpErrors.NotFound().WithMessage("realm not found")
+	}
+
+	// the entity id of a service provider is its client id
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(request.AuthnRequest.Issuer),
+		Protocol: h.Some(constants.ClientProtocolSaml),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, repos.Client{}, httpErrors.BadRequest().WithMessage(fmt.Sprintf("unknown service provider '%s'", request.AuthnRequest.Issuer))
+	}
+
+	return realm, client, nil
+}
+
+func (s *samlServiceImpl) VerifyRequest(ctx context.Context, request SamlSingleSignOnRequest) error {
+	realm, client, err := s.findServiceProvider(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return verifySamlRequest(ctx, realm, client, request)
+}
+
+// verifySamlRequest makes sure a signed request was meant for this realm and is recent, a signature alone does not
+// keep a captured request from being replayed.
+func verifySamlRequest(ctx context.Context, realm repos.Realm, client repos.Client, request SamlSingleSignOnRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	if !client.SamlRequireSignedRequests {
+		return nil
+	}
+
+	err := verifySamlRequestSignature(request, client)
+	if err != nil {
+		return httpErrors.BadRequest().WithMessage("invalid signature of the SAMLRequest: " + err.Error())
+	}
+
+	if request.AuthnRequest.Destination != routes.SamlSingleSignOn.Url(realm.Name) {
+		return httpErrors.BadRequest().WithMessage("invalid destination of the SAMLRequest")
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	err = saml.ValidateIssueInstant(request.AuthnRequest.IssueInstant, clockService.Now(), config.C.Saml.RequestMaxAge)
+	if err != nil {
+		return httpErrors.BadRequest().WithMessage("invalid SAMLRequest: " + err.Error())
+	}
+
+	return nil
+}
+
+func (s *samlServiceImpl) SingleSignOn(ctx context.Context, request SamlSingleSignOnRequest) (*SamlPostResponse, error) {
+	scope := middlewares.GetScope(ctx)
+
+	authnRequest := request.AuthnRequest
+	if authnRequest.ProtocolBinding != "" && authnRequest.ProtocolBinding != saml.BindingHttpPost {
+		return nil, httpErrors.BadRequest().WithMessage(fmt.Sprintf("unsupported protocol binding '%s'", authnRequest.ProtocolBinding))
+	}
+
+	realm, client, err := s.findServiceProvider(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifySamlRequest(ctx, realm, client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// the assertion consumer service urls of a service provider are its redirect uris
+	acsUrl := authnRequest.AssertionConsumerServiceUrl
+	if acsUrl == "" {
+		if len(client.RedirectUris) == 0 {
+			return nil, httpErrors.BadRequest().WithMessage("the service provider has no assertion consumer service url")
+		}
+		acsUrl = client.RedirectUris[0]
+	} else if !slices.Contains(client.RedirectUris, acsUrl) {
+		return nil, httpErrors.BadRequest().WithMessage("invalid assertion consumer service url")
+	}
+
+	currentUser := ioc.Get[CurrentSessionService](scope)
+	userId := currentUser.UserId()
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, userId).Unwrap()
+
+	nameIdFormat := client.SamlNameIdFormat.OrDefault(saml.NameIdFormatUnspecified)
+	nameId, err := samlNameId(user, nameIdFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := samlSigningKey(ctx, realm, client)
+	if err != nil {
+		return nil, err
+	}
+
+	clockService := ioc.Get[utils.ClockService](scope)
+	now := clockService.Now()
+
+	response := saml.BuildResponse(saml.ResponseParams{
+		ResponseId:   saml.NewId(),
+		AssertionId:  saml.NewId(),
+		Issuer:       samlEntityId(realm.Name),
+		Destination:  acsUrl,
+		Audience:     client.ClientId,
+		InResponseTo: authnRequest.Id,
+		NameId:       nameId,
+		NameIdFormat: nameIdFormat,
+		IssueInstant: now,
+		ValidFor:     config.C.Saml.AssertionLifetime,
+		Attributes:   samlAttributes(ctx, realm, client, userId),
+	}, key, utils.SelfSignedCertificate(key, realm.Name))
+
+	return &SamlPostResponse{
+		AssertionConsumerServiceUrl: acsUrl,
+		SamlResponse:                base64.StdEncoding.EncodeToString(response),
+		RelayState:                  request.RelayState,
+	}, nil
+}
+
+func verifySamlRequestSignature(request SamlSingleSignOnRequest, client repos.Client) error {
+	certificate, err := saml.ParseCertificate(client.SamlSigningCertificate.Unwrap())
+	if err != nil {
+		return err
+	}
+
+	if saml.IsRedirectSigned(request.RawQuery) {
+		return saml.VerifyRedirectSignature(request.RawQuery, certificate.PublicKey)
+	}
+	return saml.VerifyEnvelopedSignature(request.Message, certificate.PublicKey)
+}
+
+// samlSigningKey returns the realm key matching the signature algorithm of the service provider, RSA-SHA256 by default.
+func samlSigningKey(ctx context.Context, realm repos.Realm, client repos.Client) (crypto.Signer, error) {
+	scope := middlewares.GetScope(ctx)
+	keyCache := ioc.Get[cache.KeyCache](scope)
+
+	switch algorithm := client.SamlSignatureAlgorithm.OrDefault(saml.SignatureRsaSha256); algorithm {
+	case saml.SignatureRsaSha256:
+		key, ok := keyCache.GetRsa(realm.Id)
+		if !ok {
+			return nil, fmt.Errorf("could not get rsa key of realm %s", realm.Name)
+		}
+		return key, nil
+	case saml.SignatureEd25519:
+		key, ok := keyCache.Get(realm.Id)
+		if !ok {
+			return nil, fmt.Errorf("could not get key of realm %s", realm.Name)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm '%s'", algorithm)
+	}
+}
+
+func samlNameId(user repos.User, nameIdFormat string) (string, error) {
+	switch nameIdFormat {
+	case saml.NameIdFormatUnspecified:
+		return user.Username, nil
+	case saml.NameIdFormatEmailAddress:
+		email, ok := user.Email.Get()
+		if !ok {
+			return "", httpErrors.BadRequest().WithMessage("the user has no email address")
+		}
+		return email, nil
+	case saml.NameIdFormatPersistent:
+		return user.Id.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported name id format '%s'", nameIdFormat)
+	}
+}
+
+// samlAttributes maps the claims of the scopes the service provider gets to SAML attributes.
+// Service providers do not request scopes, so they get their default scopes or every scope of the realm.
+func samlAttributes(ctx context.Context, realm repos.Realm, client repos.Client, userId uuid.UUID) []saml.Attribute {
+	scope := middlewares.GetScope(ctx)
+
+	scopeRepository := ioc.Get[repos.ScopeRepository](scope)
+	realmScopes := scopeRepository.FindScopes(ctx, repos.ScopeFilter{
+		RealmId: realm.Id,
+	})
+
+	realmScopeNames := make([]string, 0, len(realmScopes.Values()))
+	for _, realmScope := range realmScopes.Values() {
+		realmScopeNames = append(realmScopeNames, realmScope.Name)
+	}
+	scopeNames := applyClientScopes(client, realmScopeNames)
+
+	scopeIds := make([]uuid.UUID, 0, len(scopeNames))
+	for _, realmScope := range realmScopes.Values() {
+		if slices.Contains(scopeNames, realmScope.Name) {
+			scopeIds = append(scopeIds, realmScope.Id)
+		}
+	}
+
+	claimsService := ioc.Get[ClaimsService](scope)
+	claims := claimsService.GetClaims(ctx, GetClaimsRequest{
+		UserId:   userId,
+		ScopeIds: scopeIds,
+		Target:   constants.ClaimsTargetSaml,
+	})
+
+	attributes := make([]saml.Attribute, 0, len(claims))
+	for _, claim := range claims {
+		attributes = append(attributes, saml.Attribute{
+			Name:   claim.Name,
+			Values: samlAttributeValues(claim.Claim),
+		})
+	}
+
+	return attributes
+}
+
+// samlAttributeValues emits one attribute value per element of multi-valued claims like roles or groups.
+func samlAttributeValues(claim interface{}) []string {
+	if claim == nil {
+		return []string{}
+	}
+
+	value := reflect.ValueOf(claim)
+	if (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) && value.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			if element := value.Index(i).Interface(); element != nil {
+				values = append(values, samlAttributeValue(element))
+			}
+		}
+		return values
+	}
+
+	return []string{samlAttributeValue(claim)}
+}
+
+func samlAttributeValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case fmt.Stringer:
+		return value.String()
+	case map[string]interface{}:
+		// structured claims have no representation in SAML other than their json
+		data, err := json.Marshal(value)
+		if err != nil {
+			panic(err)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,766 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"holvit/cache"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/routes"
+	"holvit/scim"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ScimMaxResults is the largest page size that is returned by the scim list endpoints.
+const ScimMaxResults = 1000
+
+type ScimListRequest struct {
+	Filter     h.Opt[string]
+	StartIndex int
+	Count      h.Opt[int]
+}
+
+type ScimService interface {
+	// Authenticate checks that the bearer token was issued to a client of the realm via the client credentials grant
+	// and that the client holds the scim role of the realm.
+	Authenticate(ctx context.Context, realmName string, authorization string) (repos.Realm, error)
+
+	FindUsers(ctx context.Context, realm repos.Realm, request ScimListRequest) (scim.ListResponse[scim.User], error)
+	GetUser(ctx context.Context, realm repos.Realm, id string) (scim.User, error)
+	CreateUser(ctx context.Context, realm repos.Realm, user scim.User) (scim.User, error)
+	ReplaceUser(ctx context.Context, realm repos.Realm, id string, user scim.User, ifMatch string) (scim.User, error)
+	PatchUser(ctx context.Context, realm repos.Realm, id string, request scim.PatchRequest, ifMatch string) (scim.User, error)
+	DeleteUser(ctx context.Context, realm repos.Realm, id string, ifMatch string) error
+
+	FindGroups(ctx context.Context, realm repos.Realm, request ScimListRequest) (scim.ListResponse[scim.Group], error)
+	GetGroup(ctx context.Context, realm repos.Realm, id string) (scim.Group, error)
+	CreateGroup(ctx context.Context, realm repos.Realm, group scim.Group) (scim.Group, error)
+	ReplaceGroup(ctx context.Context, realm repos.Realm, id string, group scim.Group, ifMatch string) (scim.Group, error)
+	PatchGroup(ctx context.Context, realm repos.Realm, id string, request scim.PatchRequest, ifMatch string) (scim.Group, error)
+	DeleteGroup(ctx context.Context, realm repos.Realm, id string, ifMatch string) error
+}
+
+type scimServiceImpl struct{}
+
+func NewScimService() ScimService {
+	return &scimServiceImpl{}
+}
+
+func scimNotFound(resourceType string, id string) error {
+	return scim.NewError(http.StatusNotFound, "", fmt.Sprintf("%s %s not found", resourceType, id))
+}
+
+func scimPreconditionFailed() error {
+	return scim.NewError(http.StatusPreconditionFailed, "", "the resource has been modified")
+}
+
+func (s *scimServiceImpl) Authenticate(ctx context.Context, realmName string, authorization string) (repos.Realm, error) {
+	scope := middlewares.GetScope(ctx)
+
+	tokenString, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return repos.Realm{}, scim.NewError(http.StatusUnauthorized, "", "missing bearer token")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm, ok := realmRepository.FindRealms(ctx, repos.RealmFilter{
+		Name: h.Some(realmName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, scim.NewError(http.StatusNotFound, "", "realm not found")
+	}
+
+	keyCache := ioc.Get[cache.KeyCache](scope)
+	key, ok := keyCache.Get(realm.Id)
+	if !ok {
+		return repos.Realm{}, scim.NewError(http.StatusUnauthorized, "", "could not get realm key")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		return repos.Realm{}, scim.NewError(http.StatusUnauthorized, "", "invalid access token")
+	}
+
+	// only access tokens of the client credentials grant are accepted, other tokens of the realm can carry
+	// a client_id claim from a claim mapper
+	if token.Header["typ"] != constants.ClientAccessTokenType {
+		return repos.Realm{}, scim.NewError(http.StatusUnauthorized, "", "the access token was not issued to a client")
+	}
+
+	tokenClaims := token.Claims.(jwt.MapClaims)
+	clientId, ok := tokenClaims["client_id"].(string)
+	if _, hasAudience := tokenClaims["aud"]; !ok || tokenClaims["sub"] != clientId || hasAudience {
+		return repos.Realm{}, scim.NewError(http.StatusUnauthorized, "", "the access token was not issued to a client")
+	}
+
+	clientRepository := ioc.Get[repos.ClientRepository](scope)
+	client, ok := clientRepository.FindClients(ctx, repos.ClientFilter{
+		RealmId:  h.Some(realm.Id),
+		ClientId: h.Some(clientId),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, scim.NewError(http.StatusUnauthorized, "", "invalid access token")
+	}
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	scimRole, ok := roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: realm.Id,
+		Name:    h.Some(constants.ScimRoleName),
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Realm{}, scim.NewError(http.StatusForbidden, "", "the client is not allowed to use scim")
+	}
+
+	clientRoleRepository := ioc.Get[repos.ClientRoleRepository](scope)
+	clientRoles := clientRoleRepository.FindClientRoles(ctx, repos.ClientRoleFilter{
+		ClientId: h.Some(client.Id),
+		RoleId:   h.Some(scimRole.Id),
+	})
+	if len(clientRoles) == 0 {
+		return repos.Realm{}, scim.NewError(http.StatusForbidden, "", "the client is not allowed to use scim")
+	}
+
+	return realm, nil
+}
+
+// scimPaging maps the 1-based startIndex and count of scim onto the paging of the repositories.
+// A count of 0 only asks for the total number of results, so a single row is queried to get it.
+func scimPaging(request ScimListRequest) (repos.PagingInfo, int, int) {
+	startIndex := max(request.StartIndex, 1)
+	count := min(max(request.Count.OrDefault(ScimMaxResults), 0), ScimMaxResults)
+
+	return repos.PagingInfo{
+		PageSize:   max(count, 1),
+		PageNumber: 1,
+		Offset:     startIndex - 1,
+	}, startIndex, count
+}
+
+func scimEqualities(request ScimListRequest) (map[string]any, error) {
+	rawFilter, ok := request.Filter.Get()
+	if !ok {
+		return map[string]any{}, nil
+	}
+
+	filter, err := scim.ParseFilter(rawFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	equalities, ok := scim.Equalities(filter)
+	if !ok {
+		return nil, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidFilter, "only eq comparisons joined by and are supported")
+	}
+
+	return equalities, nil
+}
+
+func scimFilterString(equalities map[string]any, attribute string) (string, error) {
+	value, ok := equalities[attribute].(string)
+	if !ok {
+		return "", scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidFilter, fmt.Sprintf("%s has to be compared with a string", attribute))
+	}
+	return value, nil
+}
+
+// scimFilterId parses an id of a filter, ids that are not uuids match no resources.
+func scimFilterId(equalities map[string]any) (uuid.UUID, bool, error) {
+	value, err := scimFilterString(equalities, "id")
+	if err != nil {
+		return uuid.UUID{}, false, err
+	}
+	id, err := uuid.Parse(value)
+	return id, err == nil, nil
+}
+
+func unsupportedScimFilter(attribute string) error {
+	return scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidFilter, fmt.Sprintf("filtering by %s is not supported", attribute))
+}
+
+func scimVersioned[T any](resource T, meta *scim.Meta) T {
+	meta.Version = ""
+	meta.Version = scim.Version(resource)
+	return resource
+}
+
+func (s *scimServiceImpl) findGroupRoles(ctx context.Context, realmId uuid.UUID, filter repos.RoleFilter) repos.FilterResult[repos.Role] {
+	scope := middlewares.GetScope(ctx)
+
+	filter.RealmId = realmId
+	filter.Internal = h.Some(false)
+	filter.IsClientRole = h.Some(false)
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	return roleRepository.FindRoles(ctx, filter)
+}
+
+func (s *scimServiceImpl) toScimUser(ctx context.Context, realm repos.Realm, user repos.User) scim.User {
+	scope := middlewares.GetScope(ctx)
+
+	active := user.Enabled
+	result := scim.User{
+		Schemas:  []string{scim.SchemaUser},
+		Id:       user.Id.String(),
+		UserName: user.Username,
+		Active:   &active,
+		Meta: &scim.Meta{
+			ResourceType: scim.ResourceTypeUser,
+			Created:      user.AuditCreatedAt,
+			LastModified: user.AuditUpdatedAt,
+			Location:     routes.ScimUsers.Url(realm.Name) + "/" + user.Id.String(),
+		},
+	}
+
+	user.Email.IfSome(func(x string) {
+		result.Emails = []scim.Email{{Value: x, Primary: true}}
+	})
+
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+	userRoles := userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+		UserId: h.Some(user.Id),
+	})
+	if len(userRoles) > 0 {
+		roleIds := make([]uuid.UUID, 0, len(userRoles))
+		for _, userRole := range userRoles {
+			roleIds = append(roleIds, userRole.RoleId)
+		}
+
+		roles := s.findGroupRoles(ctx, realm.Id, repos.RoleFilter{
+			RoleIds: h.Some(roleIds),
+		})
+		for _, role := range roles.Values() {
+			result.Groups = append(result.Groups, scim.GroupReference{
+				Value:   role.Id.String(),
+				Display: role.Name,
+				Ref:     routes.ScimGroups.Url(realm.Name) + "/" + role.Id.String(),
+			})
+		}
+	}
+
+	return scimVersioned(result, result.Meta)
+}
+
+func (s *scimServiceImpl) findUser(ctx context.Context, realm repos.Realm, id string) (repos.User, error) {
+	scope := middlewares.GetScope(ctx)
+
+	userId, err := uuid.Parse(id)
+	if err != nil {
+		return repos.User{}, scimNotFound(scim.ResourceTypeUser, id)
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || user.RealmId != realm.Id {
+		return repos.User{}, scimNotFound(scim.ResourceTypeUser, id)
+	}
+
+	return user, nil
+}
+
+func (s *scimServiceImpl) FindUsers(ctx context.Context, realm repos.Realm, request ScimListRequest) (scim.ListResponse[scim.User], error) {
+	scope := middlewares.GetScope(ctx)
+
+	equalities, err := scimEqualities(request)
+	if err != nil {
+		return scim.ListResponse[scim.User]{}, err
+	}
+
+	pagingInfo, startIndex, count := scimPaging(request)
+	filter := repos.UserFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: h.Some(pagingInfo),
+			SortInfo: h.Some(repos.SortInfo{
+				Field:     "username",
+				Ascending: true,
+			}),
+		},
+		RealmId: h.Some(realm.Id),
+	}
+
+	for attribute := range equalities {
+		switch attribute {
+		case "id":
+			id, ok, err := scimFilterId(equalities)
+			if err != nil {
+				return scim.ListResponse[scim.User]{}, err
+			}
+			if !ok {
+				return scim.NewListResponse[scim.User](nil, 0, startIndex), nil
+			}
+			filter.Id = h.Some(id)
+		case "username":
+			username, err := scimFilterString(equalities, attribute)
+			if err != nil {
+				return scim.ListResponse[scim.User]{}, err
+			}
+			filter.Username = h.Some(username)
+		case "emails", "emails.value":
+			email, err := scimFilterString(equalities, attribute)
+			if err != nil {
+				return scim.ListResponse[scim.User]{}, err
+			}
+			filter.Email = h.Some(email)
+		default:
+			return scim.ListResponse[scim.User]{}, unsupportedScimFilter(attribute)
+		}
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	users := userRepository.FindUsers(ctx, filter)
+
+	resources := make([]scim.User, 0, len(users.Values()))
+	if count > 0 {
+		for _, user := range users.Values() {
+			resources = append(resources, s.toScimUser(ctx, realm, user))
+		}
+	}
+
+	return scim.NewListResponse(resources, users.Count(), startIndex), nil
+}
+
+func (s *scimServiceImpl) GetUser(ctx context.Context, realm repos.Realm, id string) (scim.User, error) {
+	user, err := s.findUser(ctx, realm, id)
+	if err != nil {
+		return scim.User{}, err
+	}
+
+	return s.toScimUser(ctx, realm, user), nil
+}
+
+func (s *scimServiceImpl) CreateUser(ctx context.Context, realm repos.Realm, user scim.User) (scim.User, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if user.UserName == "" {
+		return scim.User{}, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, "userName is required")
+	}
+
+	email := h.None[string]()
+	if value, ok := user.PrimaryEmail(); ok {
+		email = h.Some(value)
+	}
+
+	userService := ioc.Get[UserService](scope)
+	result := userService.CreateUser(ctx, CreateUserRequest{
+		RealmId:  realm.Id,
+		Username: user.UserName,
+		Email:    email,
+		Disabled: !user.IsActive(),
+	})
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), repos.DuplicateUsernameError{}) {
+			return scim.User{}, scim.NewError(http.StatusConflict, scim.ErrorTypeUniqueness, "the userName is already taken")
+		}
+		return scim.User{}, result.UnwrapErr()
+	}
+
+	return s.GetUser(ctx, realm, result.Unwrap().String())
+}
+
+// updateUser writes the changed attributes of a scim user.
+// Changed emails are not verified since the provisioning client may not have verified them.
+func (s *scimServiceImpl) updateUser(ctx context.Context, realm repos.Realm, existing repos.User, user scim.User) (scim.User, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if user.UserName == "" {
+		return scim.User{}, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, "userName is required")
+	}
+
+	update := repos.UserUpdate{}
+
+	if user.UserName != existing.Username {
+		update.Username = h.Some(user.UserName)
+	}
+
+	if user.IsActive() != existing.Enabled {
+		update.Enabled = h.Some(user.IsActive())
+	}
+
+	email := h.None[string]()
+	if value, ok := user.PrimaryEmail(); ok {
+		email = h.Some(value)
+	}
+	if email.IsSome() != existing.Email.IsSome() || email.OrDefault("") != existing.Email.OrDefault("") {
+		update.Email = h.Some(email)
+		update.EmailVerified = h.Some(false)
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	result := userRepository.UpdateUser(ctx, existing.Id, update)
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), repos.DuplicateUsernameError{}) {
+			return scim.User{}, scim.NewError(http.StatusConflict, scim.ErrorTypeUniqueness, "the userName is already taken")
+		}
+		return scim.User{}, result.UnwrapErr()
+	}
+
+	return s.GetUser(ctx, realm, existing.Id.String())
+}
+
+func (s *scimServiceImpl) findUserMatching(ctx context.Context, realm repos.Realm, id string, ifMatch string) (repos.User, scim.User, error) {
+	existing, err := s.findUser(ctx, realm, id)
+	if err != nil {
+		return repos.User{}, scim.User{}, err
+	}
+
+	current := s.toScimUser(ctx, realm, existing)
+	if ifMatch != "" && !scim.MatchesETag(ifMatch, current.Meta.Version) {
+		return repos.User{}, scim.User{}, scimPreconditionFailed()
+	}
+
+	return existing, current, nil
+}
+
+func (s *scimServiceImpl) ReplaceUser(ctx context.Context, realm repos.Realm, id string, user scim.User, ifMatch string) (scim.User, error) {
+	existing, _, err := s.findUserMatching(ctx, realm, id, ifMatch)
+	if err != nil {
+		return scim.User{}, err
+	}
+
+	return s.updateUser(ctx, realm, existing, user)
+}
+
+func (s *scimServiceImpl) PatchUser(ctx context.Context, realm repos.Realm, id string, request scim.PatchRequest, ifMatch string) (scim.User, error) {
+	if err := request.Validate(); err != nil {
+		return scim.User{}, err
+	}
+
+	existing, current, err := s.findUserMatching(ctx, realm, id, ifMatch)
+	if err != nil {
+		return scim.User{}, err
+	}
+
+	if err := scim.ApplyUserPatch(&current, request.Operations); err != nil {
+		return scim.User{}, err
+	}
+
+	return s.updateUser(ctx, realm, existing, current)
+}
+
+func (s *scimServiceImpl) DeleteUser(ctx context.Context, realm repos.Realm, id string, ifMatch string) error {
+	scope := middlewares.GetScope(ctx)
+
+	existing, _, err := s.findUserMatching(ctx, realm, id, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	userRepository.DeleteUser(ctx, existing.Id)
+	return nil
+}
+
+func (s *scimServiceImpl) toScimGroup(ctx context.Context, realm repos.Realm, role repos.Role) scim.Group {
+	scope := middlewares.GetScope(ctx)
+
+	result := scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		Id:          role.Id.String(),
+		DisplayName: role.Name,
+		Members:     make([]scim.Member, 0),
+		Meta: &scim.Meta{
+			ResourceType: scim.ResourceTypeGroup,
+			Created:      role.AuditCreatedAt,
+			LastModified: role.AuditUpdatedAt,
+			Location:     routes.ScimGroups.Url(realm.Name) + "/" + role.Id.String(),
+		},
+	}
+
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+	userRoles := userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+		RoleId: h.Some(role.Id),
+	})
+	if len(userRoles) > 0 {
+		userIds := make([]uuid.UUID, 0, len(userRoles))
+		for _, userRole := range userRoles {
+			userIds = append(userIds, userRole.UserId)
+		}
+
+		userRepository := ioc.Get[repos.UserRepository](scope)
+		users := userRepository.FindUsers(ctx, repos.UserFilter{
+			BaseFilter: repos.BaseFilter{
+				SortInfo: h.Some(repos.SortInfo{
+					Field:     "username",
+					Ascending: true,
+				}),
+			},
+			RealmId: h.Some(realm.Id),
+			UserIds: h.Some(userIds),
+		})
+		for _, user := range users.Values() {
+			result.Members = append(result.Members, scim.Member{
+				Value:   user.Id.String(),
+				Display: user.Username,
+				Ref:     routes.ScimUsers.Url(realm.Name) + "/" + user.Id.String(),
+			})
+		}
+	}
+
+	return scimVersioned(result, result.Meta)
+}
+
+func (s *scimServiceImpl) findGroup(ctx context.Context, realm repos.Realm, id string) (repos.Role, error) {
+	roleId, err := uuid.Parse(id)
+	if err != nil {
+		return repos.Role{}, scimNotFound(scim.ResourceTypeGroup, id)
+	}
+
+	role, ok := s.findGroupRoles(ctx, realm.Id, repos.RoleFilter{
+		BaseFilter: repos.BaseFilter{
+			Id: h.Some(roleId),
+		},
+	}).SingleOrNone().Get()
+	if !ok {
+		return repos.Role{}, scimNotFound(scim.ResourceTypeGroup, id)
+	}
+
+	return role, nil
+}
+
+func (s *scimServiceImpl) FindGroups(ctx context.Context, realm repos.Realm, request ScimListRequest) (scim.ListResponse[scim.Group], error) {
+	equalities, err := scimEqualities(request)
+	if err != nil {
+		return scim.ListResponse[scim.Group]{}, err
+	}
+
+	pagingInfo, startIndex, count := scimPaging(request)
+	filter := repos.RoleFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: h.Some(pagingInfo),
+			SortInfo: h.Some(repos.SortInfo{
+				Field:     "name",
+				Ascending: true,
+			}),
+		},
+	}
+
+	for attribute := range equalities {
+		switch attribute {
+		case "id":
+			id, ok, err := scimFilterId(equalities)
+			if err != nil {
+				return scim.ListResponse[scim.Group]{}, err
+			}
+			if !ok {
+				return scim.NewListResponse[scim.Group](nil, 0, startIndex), nil
+			}
+			filter.Id = h.Some(id)
+		case "displayname":
+			displayName, err := scimFilterString(equalities, attribute)
+			if err != nil {
+				return scim.ListResponse[scim.Group]{}, err
+			}
+			filter.Name = h.Some(displayName)
+		default:
+			return scim.ListResponse[scim.Group]{}, unsupportedScimFilter(attribute)
+		}
+	}
+
+	roles := s.findGroupRoles(ctx, realm.Id, filter)
+
+	resources := make([]scim.Group, 0, len(roles.Values()))
+	if count > 0 {
+		for _, role := range roles.Values() {
+			resources = append(resources, s.toScimGroup(ctx, realm, role))
+		}
+	}
+
+	return scim.NewListResponse(resources, roles.Count(), startIndex), nil
+}
+
+func (s *scimServiceImpl) GetGroup(ctx context.Context, realm repos.Realm, id string) (scim.Group, error) {
+	role, err := s.findGroup(ctx, realm, id)
+	if err != nil {
+		return scim.Group{}, err
+	}
+
+	return s.toScimGroup(ctx, realm, role), nil
+}
+
+// memberIds resolves the members of a group to users of the realm.
+func (s *scimServiceImpl) memberIds(ctx context.Context, realm repos.Realm, members []scim.Member) ([]uuid.UUID, error) {
+	scope := middlewares.GetScope(ctx)
+
+	userIds := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		userId, err := uuid.Parse(member.Value)
+		if err != nil {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, fmt.Sprintf("member %s not found", member.Value))
+		}
+		if !slices.Contains(userIds, userId) {
+			userIds = append(userIds, userId)
+		}
+	}
+	if len(userIds) == 0 {
+		return userIds, nil
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	users := userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId: h.Some(realm.Id),
+		UserIds: h.Some(userIds),
+	})
+	for _, userId := range userIds {
+		if !slices.ContainsFunc(users.Values(), func(u repos.User) bool { return u.Id == userId }) {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, fmt.Sprintf("member %s not found", userId))
+		}
+	}
+
+	return userIds, nil
+}
+
+// setMembers adds and removes user roles so that exactly the given users have the role.
+func (s *scimServiceImpl) setMembers(ctx context.Context, realm repos.Realm, roleId uuid.UUID, members []scim.Member) error {
+	scope := middlewares.GetScope(ctx)
+
+	userIds, err := s.memberIds(ctx, realm, members)
+	if err != nil {
+		return err
+	}
+
+	userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+	existing := userRoleRepository.FindUserRoles(ctx, repos.UserRoleFilter{
+		RoleId: h.Some(roleId),
+	})
+
+	for _, userRole := range existing {
+		if !slices.Contains(userIds, userRole.UserId) {
+			userRoleRepository.DeleteUserRole(ctx, userRole.Id)
+		}
+	}
+
+	added := make([]repos.UserRole, 0)
+	for _, userId := range userIds {
+		if !slices.ContainsFunc(existing, func(ur repos.UserRole) bool { return ur.UserId == userId }) {
+			added = append(added, repos.UserRole{
+				UserId: userId,
+				RoleId: roleId,
+			})
+		}
+	}
+	if len(added) > 0 {
+		userRoleRepository.CreateUserRoles(ctx, added)
+	}
+
+	return nil
+}
+
+func (s *scimServiceImpl) CreateGroup(ctx context.Context, realm repos.Realm, group scim.Group) (scim.Group, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if group.DisplayName == "" {
+		return scim.Group{}, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, "displayName is required")
+	}
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	result := roleRepository.CreateRole(ctx, repos.Role{
+		RealmId:     realm.Id,
+		DisplayName: group.DisplayName,
+		Name:        group.DisplayName,
+	})
+	if result.IsErr() {
+		if errors.Is(result.UnwrapErr(), repos.DuplicateRoleError{}) {
+			return scim.Group{}, scim.NewError(http.StatusConflict, scim.ErrorTypeUniqueness, "the displayName is already taken")
+		}
+		return scim.Group{}, result.UnwrapErr()
+	}
+	roleId := result.Unwrap()
+
+	if err := s.setMembers(ctx, realm, roleId, group.Members); err != nil {
+		return scim.Group{}, err
+	}
+
+	return s.GetGroup(ctx, realm, roleId.String())
+}
+
+func (s *scimServiceImpl) updateGroup(ctx context.Context, realm repos.Realm, existing repos.Role, group scim.Group) (scim.Group, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if group.DisplayName == "" {
+		return scim.Group{}, scim.NewError(http.StatusBadRequest, scim.ErrorTypeInvalidValue, "displayName is required")
+	}
+
+	if group.DisplayName != existing.Name {
+		roleRepository := ioc.Get[repos.RoleRepository](scope)
+		duplicate := roleRepository.FindRoles(ctx, repos.RoleFilter{
+			RealmId: realm.Id,
+			Name:    h.Some(group.DisplayName),
+		}).Any()
+		if duplicate {
+			return scim.Group{}, scim.NewError(http.StatusConflict, scim.ErrorTypeUniqueness, "the displayName is already taken")
+		}
+
+		roleRepository.UpdateRole(ctx, existing.Id, repos.RoleUpdate{
+			DisplayName: h.Some(group.DisplayName),
+			Name:        h.Some(group.DisplayName),
+		})
+	}
+
+	if err := s.setMembers(ctx, realm, existing.Id, group.Members); err != nil {
+		return scim.Group{}, err
+	}
+
+	return s.GetGroup(ctx, realm, existing.Id.String())
+}
+
+func (s *scimServiceImpl) findGroupMatching(ctx context.Context, realm repos.Realm, id string, ifMatch string) (repos.Role, scim.Group, error) {
+	existing, err := s.findGroup(ctx, realm, id)
+	if err != nil {
+		return repos.Role{}, scim.Group{}, err
+	}
+
+	current := s.toScimGroup(ctx, realm, existing)
+	if ifMatch != "" && !scim.MatchesETag(ifMatch, current.Meta.Version) {
+		return repos.Role{}, scim.Group{}, scimPreconditionFailed()
+	}
+
+	return existing, current, nil
+}
+
+func (s *scimServiceImpl) ReplaceGroup(ctx context.Context, realm repos.Realm, id string, group scim.Group, ifMatch string) (scim.Group, error) {
+	existing, _, err := s.findGroupMatching(ctx, realm, id, ifMatch)
+	if err != nil {
+		return scim.Group{}, err
+	}
+
+	return s.updateGroup(ctx, realm, existing, group)
+}
+
+func (s *scimServiceImpl) PatchGroup(ctx context.Context, realm repos.Realm, id string, request scim.PatchRequest, ifMatch string) (scim.Group, error) {
+	if err := request.Validate(); err != nil {
+		return scim.Group{}, err
+	}
+
+	existing, current, err := s.findGroupMatching(ctx, realm, id, ifMatch)
+	if err != nil {
+		return scim.Group{}, err
+	}
+
+	if err := scim.ApplyGroupPatch(&current, request.Operations); err != nil {
+		return scim.Group{}, err
+	}
+
+	return s.updateGroup(ctx, realm, existing, current)
+}
+
+func (s *scimServiceImpl) DeleteGroup(ctx context.Context, realm repos.Realm, id string, ifMatch string) error {
+	scope := middlewares.GetScope(ctx)
+
+	existing, _, err := s.findGroupMatching(ctx, realm, id, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	roleRepository.DeleteRoles(ctx, realm.Id, []uuid.UUID{existing.Id})
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"holvit/config"
@@ -15,6 +16,7 @@ import (
 	"holvit/logging"
 	"holvit/middlewares"
 	"holvit/utils"
+	"slices"
 	"time"
 )
 
@@ -32,6 +34,8 @@ type CodeInfo struct {
 	GrantedScopes   []string    `json:"grantedScopes"`
 	GrantedScopeIds []uuid.UUID `json:"grantedScopeIds"`
 	PKCEChallenge   string      `json:"pkceChallenge"`
+
+	ClaimsRequest *ClaimsRequest `json:"claimsRequest"`
 }
 
 type LoginInfo struct {
@@ -42,6 +46,105 @@ type LoginInfo struct {
 	RememberMe                          bool      `json:"rememberMe"`
 	EncryptedTotpOnboardingSecretBase64 string    `json:"totpSecret"`
 	OriginalUrl                         string    `json:"originalUrl"`
+
+	// AuthenticationFlowId is the flow of the login, uuid.Nil stands for the DefaultAuthenticationFlow.
+	AuthenticationFlowId uuid.UUID `json:"authenticationFlowId"`
+	CompletedSteps       []string  `json:"completedSteps,omitempty"`
+	// AllowedSteps are the steps the user can continue with besides NextStep, e.g. the other alternatives of the flow.
+	AllowedSteps []string `json:"allowedSteps,omitempty"`
+
+	// EmailLoginToken references the pending email login, see EmailLoginInfo.
+	EmailLoginToken string `json:"emailLoginToken,omitempty"`
+
+	// RegistrationToken references the pending self-registration, see RegistrationInfo.
+	RegistrationToken string `json:"registrationToken,omitempty"`
+
+	// DeviceVerificationToken references the pending device verification code, see DeviceVerificationInfo.
+	DeviceVerificationToken string `json:"deviceVerificationToken,omitempty"`
+
+	// EmailVerificationSentAt is used to throttle resending the verification email during the login.
+	EmailVerificationSentAt time.Time `json:"emailVerificationSentAt"`
+
+	// WebauthnSession is the pending registration or assertion ceremony of the login.
+	WebauthnSession *webauthn.SessionData `json:"webauthnSession,omitempty"`
+	// WebauthnVerified is set once the user proved possession of a webauthn credential during the login.
+	WebauthnVerified bool `json:"webauthnVerified"`
+}
+
+// IsStepAllowed reports whether the user can continue the login with the step.
+func (l *LoginInfo) IsStepAllowed(step string) bool {
+	return l.NextStep == step || slices.Contains(l.AllowedSteps, step)
+}
+
+// ExpectStep fails if the user cannot continue the login with the step.
+func (l *LoginInfo) ExpectStep(step string) error {
+	if !l.IsStepAllowed(step) {
+		return httpErrors.Unauthorized().WithMessage(
+			fmt.Sprintf("wrong login step '%s', expected '%s'", l.NextStep, step))
+	}
+	return nil
+}
+
+type CibaInfo struct {
+	RealmId        uuid.UUID `json:"realmId"`
+	ClientId       uuid.UUID `json:"clientId"`
+	UserId         uuid.UUID `json:"userId"`
+	Scopes         []string  `json:"scopes"`
+	BindingMessage string    `json:"bindingMessage"`
+	Status         string    `json:"status"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	Interval       int       `json:"interval"`
+	LastPolledAt   time.Time `json:"lastPolledAt"`
+}
+
+type CibaDecisionInfo struct {
+	RealmId   uuid.UUID `json:"realmId"`
+	AuthReqId string    `json:"authReqId"`
+}
+
+// BrokerStateInfo remembers a login that continues at an upstream identity provider.
+type BrokerStateInfo struct {
+	RealmId            uuid.UUID `json:"realmId"`
+	IdentityProviderId uuid.UUID `json:"identityProviderId"`
+	LoginToken         string    `json:"loginToken"`
+	Nonce              string    `json:"nonce"`
+	CodeVerifier       string    `json:"codeVerifier"`
+}
+
+// EmailLoginInfo is a pending passwordless login by email code or magic link.
+type EmailLoginInfo struct {
+	RealmId    uuid.UUID `json:"realmId"`
+	LoginToken string    `json:"loginToken"`
+	// UserId is uuid.Nil if no user has the email, so that the response does not reveal which emails are known.
+	UserId uuid.UUID `json:"userId"`
+	// HashedCode is the signature of the code that was sent, it is empty for magic links.
+	HashedCode string `json:"hashedCode"`
+	// Attempts are the wrong codes entered during the login, they carry over to codes that are sent again.
+	Attempts  int       `json:"attempts"`
+	SentAt    time.Time `json:"sentAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RegistrationInfo is a self-registration waiting for the user to verify their email.
+type RegistrationInfo struct {
+	RealmId        uuid.UUID `json:"realmId"`
+	LoginToken     string    `json:"loginToken"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashedPassword"`
+	HashedCode     string    `json:"hashedCode"`
+	Attempts       int       `json:"attempts"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// DeviceVerificationInfo is a code that was sent to confirm a login from an unknown device.
+type DeviceVerificationInfo struct {
+	UserId     uuid.UUID `json:"userId"`
+	DeviceId   string    `json:"deviceId"`
+	HashedCode string    `json:"hashedCode"`
+	Attempts   int       `json:"attempts"`
+	SentAt     time.Time `json:"sentAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
 }
 
 type TokenService interface {
@@ -55,6 +158,35 @@ type TokenService interface {
 	OverwriteLoginCode(ctx context.Context, token string, info LoginInfo) h.Result[h.Unit]
 	PeekLoginCode(ctx context.Context, token string) h.Opt[LoginInfo]
 	RetrieveLoginCode(ctx context.Context, token string) h.Opt[LoginInfo]
+
+	StoreCibaRequest(ctx context.Context, info CibaInfo, expiration time.Duration) string
+	OverwriteCibaRequest(ctx context.Context, token string, info CibaInfo, expiration time.Duration) h.Result[h.Unit]
+	PeekCibaRequest(ctx context.Context, token string) h.Opt[CibaInfo]
+	// RecordCibaPoll only updates the polling state of a ciba request, so that a decision made in the meantime is kept.
+	RecordCibaPoll(ctx context.Context, token string, interval int, polledAt time.Time) bool
+	RetrieveCibaRequest(ctx context.Context, token string) h.Opt[CibaInfo]
+
+	StoreCibaDecision(ctx context.Context, info CibaDecisionInfo, expiration time.Duration) string
+	PeekCibaDecision(ctx context.Context, token string) h.Opt[CibaDecisionInfo]
+	RetrieveCibaDecision(ctx context.Context, token string) h.Opt[CibaDecisionInfo]
+
+	StoreBrokerState(ctx context.Context, info BrokerStateInfo) string
+	RetrieveBrokerState(ctx context.Context, token string) h.Opt[BrokerStateInfo]
+
+	StoreEmailLogin(ctx context.Context, info EmailLoginInfo, expiration time.Duration) string
+	OverwriteEmailLogin(ctx context.Context, token string, info EmailLoginInfo, expiration time.Duration) h.Result[h.Unit]
+	PeekEmailLogin(ctx context.Context, token string) h.Opt[EmailLoginInfo]
+	RetrieveEmailLogin(ctx context.Context, token string) h.Opt[EmailLoginInfo]
+
+	StoreRegistration(ctx context.Context, info RegistrationInfo, expiration time.Duration) string
+	OverwriteRegistration(ctx context.Context, token string, info RegistrationInfo, expiration time.Duration) h.Result[h.Unit]
+	PeekRegistration(ctx context.Context, token string) h.Opt[RegistrationInfo]
+	RetrieveRegistration(ctx context.Context, token string) h.Opt[RegistrationInfo]
+
+	StoreDeviceVerification(ctx context.Context, info DeviceVerificationInfo, expiration time.Duration) string
+	OverwriteDeviceVerification(ctx context.Context, token string, info DeviceVerificationInfo, expiration time.Duration) h.Result[h.Unit]
+	PeekDeviceVerification(ctx context.Context, token string) h.Opt[DeviceVerificationInfo]
+	RetrieveDeviceVerification(ctx context.Context, token string) h.Opt[DeviceVerificationInfo]
 }
 
 func NewTokenService() TokenService {
@@ -107,6 +239,181 @@ func (s *tokenServiceImpl) RetrieveGrantInfo(ctx context.Context, token string)
 	return h.SomeIf(found, result)
 }
 
+func (s *tokenServiceImpl) StoreCibaRequest(ctx context.Context, info CibaInfo, expiration time.Duration) string {
+	return s.storeInfo(ctx, info, "cibaRequest", expiration)
+}
+
+func (s *tokenServiceImpl) OverwriteCibaRequest(ctx context.Context, token string, info CibaInfo, expiration time.Duration) h.Result[h.Unit] {
+	found := s.overwriteInfo(ctx, info, "cibaRequest", token, expiration)
+	if !found {
+		return h.UErr(httpErrors.NotFound().WithMessage(fmt.Sprintf("ciba request %s not found", token)))
+	}
+	return h.UOk()
+}
+
+func (s *tokenServiceImpl) PeekCibaRequest(ctx context.Context, token string) h.Opt[CibaInfo] {
+	var result CibaInfo
+	found := s.peekInfo(ctx, "cibaRequest", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) RecordCibaPoll(ctx context.Context, token string, interval int, polledAt time.Time) bool {
+	scope := middlewares.GetScope(ctx)
+	redisClient := ioc.Get[*redis.Client](scope)
+
+	key := "cibaRequest:" + token
+	logging.Logger.Debugf("recording ciba poll in redis: %s", key)
+
+	// the transaction fails if the request was changed after it was read, e.g. by the decision of the user, and is retried
+	for i := 0; i < 10; i++ {
+		found := true
+		err := redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			val, err := tx.Get(ctx, key).Result()
+			if errors.Is(err, redis.Nil) {
+				found = false
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			var info CibaInfo
+			err = json.Unmarshal([]byte(val), &info)
+			if err != nil {
+				return err
+			}
+
+			info.Interval = interval
+			info.LastPolledAt = polledAt
+
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, string(data), redis.KeepTTL)
+				return nil
+			})
+			return err
+		}, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		return found
+	}
+
+	panic(redis.TxFailedErr)
+}
+
+func (s *tokenServiceImpl) RetrieveCibaRequest(ctx context.Context, token string) h.Opt[CibaInfo] {
+	var result CibaInfo
+	found := s.retrieveInfo(ctx, "cibaRequest", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) StoreCibaDecision(ctx context.Context, info CibaDecisionInfo, expiration time.Duration) string {
+	return s.storeInfo(ctx, info, "cibaDecision", expiration)
+}
+
+func (s *tokenServiceImpl) PeekCibaDecision(ctx context.Context, token string) h.Opt[CibaDecisionInfo] {
+	var result CibaDecisionInfo
+	found := s.peekInfo(ctx, "cibaDecision", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) RetrieveCibaDecision(ctx context.Context, token string) h.Opt[CibaDecisionInfo] {
+	var result CibaDecisionInfo
+	found := s.retrieveInfo(ctx, "cibaDecision", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) StoreBrokerState(ctx context.Context, info BrokerStateInfo) string {
+	return s.storeInfo(ctx, info, "brokerState", time.Minute*10)
+}
+
+func (s *tokenServiceImpl) RetrieveBrokerState(ctx context.Context, token string) h.Opt[BrokerStateInfo] {
+	var result BrokerStateInfo
+	found := s.retrieveInfo(ctx, "brokerState", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) StoreEmailLogin(ctx context.Context, info EmailLoginInfo, expiration time.Duration) string {
+	return s.storeInfo(ctx, info, "emailLogin", expiration)
+}
+
+func (s *tokenServiceImpl) OverwriteEmailLogin(ctx context.Context, token string, info EmailLoginInfo, expiration time.Duration) h.Result[h.Unit] {
+	found := s.overwriteInfo(ctx, info, "emailLogin", token, expiration)
+	if !found {
+		return h.UErr(httpErrors.NotFound().WithMessage(fmt.Sprintf("email login %s not found", token)))
+	}
+	return h.UOk()
+}
+
+func (s *tokenServiceImpl) PeekEmailLogin(ctx context.Context, token string) h.Opt[EmailLoginInfo] {
+	var result EmailLoginInfo
+	found := s.peekInfo(ctx, "emailLogin", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) RetrieveEmailLogin(ctx context.Context, token string) h.Opt[EmailLoginInfo] {
+	var result EmailLoginInfo
+	found := s.retrieveInfo(ctx, "emailLogin", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) StoreRegistration(ctx context.Context, info RegistrationInfo, expiration time.Duration) string {
+	return s.storeInfo(ctx, info, "registration", expiration)
+}
+
+func (s *tokenServiceImpl) OverwriteRegistration(ctx context.Context, token string, info RegistrationInfo, expiration time.Duration) h.Result[h.Unit] {
+	found := s.overwriteInfo(ctx, info, "registration", token, expiration)
+	if !found {
+		return h.UErr(httpErrors.NotFound().WithMessage(fmt.Sprintf("registration %s not found", token)))
+	}
+	return h.UOk()
+}
+
+func (s *tokenServiceImpl) PeekRegistration(ctx context.Context, token string) h.Opt[RegistrationInfo] {
+	var result RegistrationInfo
+	found := s.peekInfo(ctx, "registration", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) RetrieveRegistration(ctx context.Context, token string) h.Opt[RegistrationInfo] {
+	var result RegistrationInfo
+	found := s.retrieveInfo(ctx, "registration", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) StoreDeviceVerification(ctx context.Context, info DeviceVerificationInfo, expiration time.Duration) string {
+	return s.storeInfo(ctx, info, "deviceVerification", expiration)
+}
+
+func (s *tokenServiceImpl) OverwriteDeviceVerification(ctx context.Context, token string, info DeviceVerificationInfo, expiration time.Duration) h.Result[h.Unit] {
+	found := s.overwriteInfo(ctx, info, "deviceVerification", token, expiration)
+	if !found {
+		return h.UErr(httpErrors.NotFound().WithMessage(fmt.Sprintf("device verification %s not found", token)))
+	}
+	return h.UOk()
+}
+
+func (s *tokenServiceImpl) PeekDeviceVerification(ctx context.Context, token string) h.Opt[DeviceVerificationInfo] {
+	var result DeviceVerificationInfo
+	found := s.peekInfo(ctx, "deviceVerification", token, &result)
+	return h.SomeIf(found, result)
+}
+
+func (s *tokenServiceImpl) RetrieveDeviceVerification(ctx context.Context, token string) h.Opt[DeviceVerificationInfo] {
+	var result DeviceVerificationInfo
+	found := s.retrieveInfo(ctx, "deviceVerification", token, &result)
+	return h.SomeIf(found, result)
+}
+
 func (s *tokenServiceImpl) storeInfo(ctx context.Context, info interface{}, name string, expiration time.Duration) string {
 	scope := middlewares.GetScope(ctx)
 	redisClient := ioc.Get[*redis.Client](scope)
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"holvit/requestContext"
+	"holvit/userimport"
+	"holvit/utils"
+	"io"
+	"strings"
+)
+
+const userImportBatchSize = 500
+
+type ImportUsersRequest struct {
+	RealmId uuid.UUID
+	Reader  userimport.Reader
+}
+
+type ImportUsersError struct {
+	Row      int
+	Username string
+	Message  string
+}
+
+type ImportUsersResponse struct {
+	Created int
+	// Skipped counts the users that already existed, running an import again skips all users it already created.
+	Skipped int
+	Failed  int
+	Errors  []ImportUsersError
+}
+
+type UserImportService interface {
+	// ImportUsers creates the users read from the import, existing users are skipped.
+	// The users are created in batches that are committed in their own transactions, the import can not be rolled back as a whole.
+	// The error is only set if the import could not be read to the end, the response holds the result of the rows before.
+	ImportUsers(ctx context.Context, request ImportUsersRequest) (ImportUsersResponse, error)
+}
+
+type userImportServiceImpl struct {
+}
+
+func NewUserImportService() UserImportService {
+	return &userImportServiceImpl{}
+}
+
+type importedUser struct {
+	row            int
+	record         userimport.Record
+	hashedPassword h.Opt[string]
+	totpSecret     h.Opt[string]
+}
+
+func (s *userImportServiceImpl) ImportUsers(ctx context.Context, request ImportUsersRequest) (ImportUsersResponse, error) {
+	response := ImportUsersResponse{}
+	batch := make([]importedUser, 0, userImportBatchSize)
+
+	for {
+		row, err := request.Reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.importBatch(ctx, request.RealmId, batch, &response)
+			return response, err
+		}
+
+		user, err := prepareImportedUser(row)
+		if err != nil {
+			response.fail(row.Number, row.Record.Username, err.Error())
+			continue
+		}
+
+		batch = append(batch, user)
+		if len(batch) == userImportBatchSize {
+			s.importBatch(ctx, request.RealmId, batch, &response)
+			batch = batch[:0]
+		}
+	}
+
+	s.importBatch(ctx, request.RealmId, batch, &response)
+	return response, nil
+}
+
+func (r *ImportUsersResponse) fail(row int, username string, message string) {
+	r.Failed++
+	r.Errors = append(r.Errors, ImportUsersError{
+		Row:      row,
+		Username: username,
+		Message:  message,
+	})
+}
+
+// prepareImportedUser validates the row and brings the password hash and totp secret into the stored format.
+func prepareImportedUser(row userimport.Row) (importedUser, error) {
+	if row.Err != nil {
+		return importedUser{}, row.Err
+	}
+
+	record := row.Record
+	if err := userimport.Validate(record); err != nil {
+		return importedUser{}, err
+	}
+
+	user := importedUser{
+		row:    row.Number,
+		record: record,
+	}
+
+	if record.PasswordHash != "" {
+		if !utils.IsSupportedHash(record.PasswordHash) {
+			return importedUser{}, errors.New("the password hash is not in a supported format")
+		}
+		user.hashedPassword = h.Some(record.PasswordHash)
+	}
+
+	if credential := record.KeycloakCredential; credential != nil {
+		hashedPassword, err := utils.ConvertKeycloakPasswordHash(credential.SecretData, credential.CredentialData)
+		if err != nil {
+			return importedUser{}, err
+		}
+		user.hashedPassword = h.Some(hashedPassword)
+	}
+
+	if record.TotpSecret != "" {
+		user.totpSecret = h.Some(userimport.NormalizeTotpSecret(record.TotpSecret))
+	}
+
+	return user, nil
+}
+
+func (s *userImportServiceImpl) importBatch(ctx context.Context, realmId uuid.UUID, users []importedUser, response *ImportUsersResponse) {
+	if len(users) == 0 {
+		return
+	}
+
+	requestContext.RunWithScope(ioc.RootScope, ctx, func(ctx context.Context) {
+		scope := middlewares.GetScope(ctx)
+		rcs := ioc.Get[requestContext.RequestContextService](scope)
+
+		batchResponse := ImportUsersResponse{}
+		defer func() {
+			if err := recover(); err != nil {
+				// the transaction of the batch is rolled back, none of its users were created
+				rcs.Error(fmt.Errorf("%v", err))
+				logging.Logger.Errorf("failed to import a batch of users: %v", err)
+
+				for _, user := range users {
+					response.fail(user.row, user.record.Username, fmt.Sprintf("the batch of the user could not be imported: %v", err))
+				}
+				return
+			}
+
+			response.Created += batchResponse.Created
+			response.Skipped += batchResponse.Skipped
+			response.Failed += batchResponse.Failed
+			response.Errors = append(response.Errors, batchResponse.Errors...)
+		}()
+
+		s.createUsers(ctx, realmId, users, &batchResponse)
+	})
+}
+
+func (s *userImportServiceImpl) createUsers(ctx context.Context, realmId uuid.UUID, users []importedUser, response *ImportUsersResponse) {
+	scope := middlewares.GetScope(ctx)
+
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.record.Username)
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	existingUsernames := make(map[string]bool)
+	for _, user := range userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId:   h.Some(realmId),
+		Usernames: h.Some(usernames),
+	}).Values() {
+		existingUsernames[strings.ToLower(user.Username)] = true
+	}
+
+	roleRepository := ioc.Get[repos.RoleRepository](scope)
+	roleIds := make(map[string]uuid.UUID)
+	for _, role := range roleRepository.FindRoles(ctx, repos.RoleFilter{
+		RealmId: realmId,
+	}).Values() {
+		roleIds[role.Name] = role.Id
+	}
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	userService := ioc.Get[UserService](scope)
+
+	var userRoles []repos.UserRole
+	for _, user := range users {
+		username := strings.ToLower(user.record.Username)
+		if existingUsernames[username] {
+			response.Skipped++
+			continue
+		}
+
+		var missingRoles []string
+		for _, role := range user.record.Roles {
+			if _, ok := roleIds[role]; !ok {
+				missingRoles = append(missingRoles, role)
+			}
+		}
+		if len(missingRoles) > 0 {
+			response.fail(user.row, user.record.Username, fmt.Sprintf("unknown roles: %s", strings.Join(missingRoles, ", ")))
+			continue
+		}
+
+		userId := userRepository.CreateUser(ctx, repos.User{
+			RealmId:       realmId,
+			Username:      user.record.Username,
+			Email:         h.SomeIf(user.record.Email != "", user.record.Email),
+			EmailVerified: user.record.EmailVerified,
+			Enabled:       !user.record.Disabled,
+		}).Unwrap()
+		existingUsernames[username] = true
+
+		if hashedPassword, ok := user.hashedPassword.Get(); ok {
+			credentialRepository.CreateCredential(ctx, repos.Credential{
+				UserId: userId,
+				Type:   constants.CredentialTypePassword,
+				Details: repos.CredentialPasswordDetails{
+					HashedPassword: hashedPassword,
+					Temporary:      user.record.PasswordTemporary,
+				},
+			}).Unwrap()
+		}
+
+		if totpSecret, ok := user.totpSecret.Get(); ok {
+			userService.AddTotp(ctx, AddTotpRequest{
+				UserId: userId,
+				Secret: []byte(totpSecret),
+			}, DangerousNoAuthStrategy{})
+		}
+
+		for _, role := range user.record.Roles {
+			userRoles = append(userRoles, repos.UserRole{
+				UserId: userId,
+				RoleId: roleIds[role],
+			})
+		}
+
+		response.Created++
+	}
+
+	if len(userRoles) > 0 {
+		userRoleRepository := ioc.Get[repos.UserRoleRepository](scope)
+		userRoleRepository.CreateUserRoles(ctx, userRoles)
+	}
+}
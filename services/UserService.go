@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
@@ -11,9 +12,12 @@ import (
 	"holvit/h"
 	"holvit/httpErrors"
 	"holvit/ioc"
+	"holvit/logging"
 	"holvit/middlewares"
+	"holvit/passwordpolicy"
 	"holvit/repos"
 	"holvit/utils"
+	"html"
 )
 
 type AuthStrategy interface {
@@ -83,6 +87,17 @@ type PasswordAuthStrategy struct {
 func (s PasswordAuthStrategy) Authorize(ctx context.Context, userId uuid.UUID) bool {
 	scope := middlewares.GetScope(ctx)
 
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || !user.Enabled {
+		return false
+	}
+
+	if user.LdapProviderId.IsSome() {
+		ldapFederationService := ioc.Get[LdapFederationService](scope)
+		return ldapFederationService.Authenticate(ctx, user, s.Password)
+	}
+
 	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
 
 	credential := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
@@ -94,33 +109,79 @@ func (s PasswordAuthStrategy) Authorize(ctx context.Context, userId uuid.UUID) b
 	if credential, ok := credential.Get(); ok {
 		details := credential.Details.(repos.CredentialPasswordDetails)
 
-		result := utils.ValidateHash(s.Password, details.HashedPassword, config.C.GetHasher())
+		hasher := config.C.GetHasher()
+		result := utils.ValidateHash(s.Password, details.HashedPassword, hasher)
 		if result.IsValid && result.NeedsRehash {
-			// TODO: rehash password!
+			// the hash was made with an old algorithm or old settings, the credential keeps its age and is not added to the history
+			details.HashedPassword = hasher.Hash(s.Password)
+			credentialRepository.UpdateCredential(ctx, credential.Id, repos.CredentialUpdate{
+				Details: h.Some[interface{}](details),
+			})
 		}
 		return result.IsValid
 	}
 	return false
 }
 
+// PasswordResetTokenAuthStrategy authorizes with a reset link that was sent by email.
+// Using a token invalidates all reset links of the user.
+type PasswordResetTokenAuthStrategy struct {
+	Token string
+}
+
+func (s PasswordResetTokenAuthStrategy) Authorize(ctx context.Context, userId uuid.UUID) bool {
+	scope := middlewares.GetScope(ctx)
+
+	clockService := ioc.Get[utils.ClockService](scope)
+
+	// the token is deleted by the same statement that finds it, so concurrent requests can not both use it
+	passwordResetTokenRepository := ioc.Get[repos.PasswordResetTokenRepository](scope)
+	tokenUserId, ok := passwordResetTokenRepository.ConsumePasswordResetToken(ctx, utils.CheapHash(s.Token), clockService.Now()).Get()
+	if !ok || tokenUserId != userId {
+		return false
+	}
+
+	passwordResetTokenRepository.DeletePasswordResetTokensOfUser(ctx, userId)
+
+	return true
+}
+
 type CreateUserRequest struct {
 	RealmId uuid.UUID
 
+	Username      string
+	Email         h.Opt[string]
+	EmailVerified bool
+	// Disabled users cannot sign in, users are enabled unless stated otherwise.
+	Disabled bool
+	// ApprovalPending users are disabled until an admin approves them.
+	ApprovalPending bool
+}
+
+type CheckPasswordPolicyRequest struct {
+	RealmId uuid.UUID
+	// UserId is set for existing users, the password history is only checked for them.
+	UserId   h.Opt[uuid.UUID]
 	Username string
 	Email    h.Opt[string]
+	Password string
 }
 
 type SetPasswordRequest struct {
 	UserId    uuid.UUID
 	Password  string
 	Temporary bool
+	// IgnorePolicy is only meant for passwords set by the system itself, e.g. of seeded users.
+	IgnorePolicy bool
 }
 
 type VerifyLoginRequest struct {
 	Username string
+	// UserId is uuid.Nil if no user has the username, the attempt still counts as failure of the ip address.
 	UserId   uuid.UUID
 	Password string
 	RealmId  uuid.UUID
+	Ip       string
 }
 
 type VerifyLoginResponse struct {
@@ -128,8 +189,17 @@ type VerifyLoginResponse struct {
 }
 
 type VerifyTotpRequest struct {
-	UserId uuid.UUID
-	Code   string
+	RealmId uuid.UUID
+	UserId  uuid.UUID
+	Code    string
+	Ip      string
+}
+
+type VerifyRecoveryCodeRequest struct {
+	RealmId uuid.UUID
+	UserId  uuid.UUID
+	Code    string
+	Ip      string
 }
 
 type AddTotpRequest struct {
@@ -140,9 +210,17 @@ type AddTotpRequest struct {
 
 type UserService interface {
 	CreateUser(ctx context.Context, request CreateUserRequest) h.Result[uuid.UUID]
+	// ApproveUser enables a self-registered user that is waiting for approval and notifies them by email.
+	ApproveUser(ctx context.Context, userId uuid.UUID) error
+
+	// CheckPasswordPolicy returns a passwordpolicy.Error listing every rule of the realm the password violates.
+	CheckPasswordPolicy(ctx context.Context, request CheckPasswordPolicyRequest) error
 
-	SetPassword(ctx context.Context, request SetPasswordRequest, strategy AuthStrategy)
+	// SetPassword replaces the password of the user after checking it against the password policy of the realm.
+	SetPassword(ctx context.Context, request SetPasswordRequest, strategy AuthStrategy) h.UResult
 	IsPasswordTemporary(ctx context.Context, userId uuid.UUID) bool
+	// IsPasswordExpired reports whether the password is older than the maximum age of the password policy.
+	IsPasswordExpired(ctx context.Context, userId uuid.UUID) bool
 
 	AddTotp(ctx context.Context, request AddTotpRequest, strategy AuthStrategy)
 	RequiresTotpOnboarding(ctx context.Context, userId uuid.UUID) bool
@@ -150,6 +228,14 @@ type UserService interface {
 
 	VerifyLogin(ctx context.Context, request VerifyLoginRequest) VerifyLoginResponse
 	VerifyTotp(ctx context.Context, request VerifyTotpRequest)
+
+	// GenerateRecoveryCodes replaces all recovery codes of the user and returns the new codes in plain text.
+	// This is the only time the plain codes are available, only their hashes are stored.
+	GenerateRecoveryCodes(ctx context.Context, userId uuid.UUID) []string
+	HasRecoveryCodes(ctx context.Context, userId uuid.UUID) bool
+	// VerifyRecoveryCode checks the code against the unused recovery codes of the user.
+	// A matching code is invalidated and the user is notified by email.
+	VerifyRecoveryCode(ctx context.Context, request VerifyRecoveryCodeRequest)
 }
 
 type userServiceImpl struct {
@@ -165,21 +251,140 @@ func (u *userServiceImpl) CreateUser(ctx context.Context, request CreateUserRequ
 	userRepository := ioc.Get[repos.UserRepository](scope)
 
 	return userRepository.CreateUser(ctx, repos.User{
-		RealmId:  request.RealmId,
+		RealmId:         request.RealmId,
+		Username:        request.Username,
+		Email:           request.Email,
+		EmailVerified:   request.EmailVerified,
+		Enabled:         !request.Disabled && !request.ApprovalPending,
+		ApprovalPending: request.ApprovalPending,
+	})
+}
+
+func (u *userServiceImpl) ApproveUser(ctx context.Context, userId uuid.UUID) error {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok {
+		return httpErrors.NotFound().WithMessage("user not found")
+	}
+	if !user.ApprovalPending {
+		return httpErrors.BadRequest().WithMessage("the user is not waiting for approval")
+	}
+
+	result := userRepository.UpdateUser(ctx, userId, repos.UserUpdate{
+		Enabled:         h.Some(true),
+		ApprovalPending: h.Some(false),
+	})
+	if result.IsErr() {
+		return result.UnwrapErr()
+	}
+
+	if email, ok := user.Email.Get(); ok {
+		realmRepository := ioc.Get[repos.RealmRepository](scope)
+		realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+
+		jobService := ioc.Get[JobService](scope)
+		jobService.QueueJob(ctx, repos.SendMailJobDetails{
+			To:      []string{email},
+			Subject: fmt.Sprintf("Your %s account was approved", realm.DisplayName),
+			Body: fmt.Sprintf(`<html><body>Your account <b>%s</b> was approved, you can sign in now.</body></html>`,
+				html.EscapeString(user.Username)),
+		})
+	}
+
+	return nil
+}
+
+func (u *userServiceImpl) CheckPasswordPolicy(ctx context.Context, request CheckPasswordPolicyRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, request.RealmId).Unwrap()
+
+	violations := passwordpolicy.Check(passwordpolicy.Policy(realm.PasswordPolicy), request.Password, passwordpolicy.Subject{
 		Username: request.Username,
-		Email:    request.Email,
+		Email:    request.Email.UnwrapOrEmpty(),
 	})
+
+	if realm.PasswordPolicy.ForbidBreached {
+		breachedPasswordService := ioc.Get[BreachedPasswordService](scope)
+		if breachCount, ok := breachedPasswordService.GetBreachCount(request.Password).Get(); ok {
+			violations = append(violations, passwordpolicy.CheckBreachCount(passwordpolicy.Policy(realm.PasswordPolicy), breachCount)...)
+		}
+	}
+
+	if userId, ok := request.UserId.Get(); ok && realm.PasswordHistoryLength > 0 {
+		if u.isInPasswordHistory(ctx, userId, request.Password, realm.PasswordHistoryLength) {
+			violations = append(violations, passwordpolicy.Violation{
+				Code:    passwordpolicy.ViolationHistory,
+				Message: fmt.Sprintf("the password must not match any of the last %d passwords", realm.PasswordHistoryLength),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return passwordpolicy.Error{Violations: violations}
+	}
+	return nil
 }
 
-func (u *userServiceImpl) SetPassword(ctx context.Context, request SetPasswordRequest, strategy AuthStrategy) {
-	if !strategy.Authorize(ctx, request.UserId) {
-		//TODO: panic or return error
+// isInPasswordHistory compares the password with the current password and the previous passwords of the user.
+func (u *userServiceImpl) isInPasswordHistory(ctx context.Context, userId uuid.UUID, password string, historyLength int) bool {
+	scope := middlewares.GetScope(ctx)
+	hasher := config.C.GetHasher()
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	credential, ok := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		UserId: h.Some(userId),
+		Type:   h.Some(constants.CredentialTypePassword),
+	}).SingleOrNone().Get()
+	if ok && utils.ValidateHash(password, credential.Details.(repos.CredentialPasswordDetails).HashedPassword, hasher).IsValid {
+		return true
 	}
 
-	//TODO: check password history
+	passwordHistoryRepository := ioc.Get[repos.PasswordHistoryRepository](scope)
+	history := passwordHistoryRepository.GetHistory(ctx, repos.PasswordHistoryFilter{
+		UserId: userId,
+	})
+	for i, entry := range history {
+		if i >= historyLength-1 {
+			break
+		}
+		if utils.ValidateHash(password, entry.HashedPassword, hasher).IsValid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *userServiceImpl) SetPassword(ctx context.Context, request SetPasswordRequest, strategy AuthStrategy) h.UResult {
+	if !strategy.Authorize(ctx, request.UserId) {
+		panic(httpErrors.Unauthorized().WithMessage("not allowed to set the password"))
+	}
 
 	scope := middlewares.GetScope(ctx)
 
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, request.UserId).Unwrap()
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+
+	if !request.IgnorePolicy {
+		err := u.CheckPasswordPolicy(ctx, CheckPasswordPolicyRequest{
+			RealmId:  user.RealmId,
+			UserId:   h.Some(user.Id),
+			Username: user.Username,
+			Email:    user.Email,
+			Password: request.Password,
+		})
+		if err != nil {
+			return h.UErr(err)
+		}
+	}
+
 	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
 
 	credential := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
@@ -190,6 +395,7 @@ func (u *userServiceImpl) SetPassword(ctx context.Context, request SetPasswordRe
 
 	if existingCredential, ok := credential.Get(); ok {
 		credentialRepository.DeleteCredential(ctx, existingCredential.Id)
+		u.addToPasswordHistory(ctx, request.UserId, existingCredential.Details.(repos.CredentialPasswordDetails).HashedPassword, realm.PasswordHistoryLength)
 	}
 
 	hashAlgorithm := config.C.GetHasher()
@@ -203,20 +409,92 @@ func (u *userServiceImpl) SetPassword(ctx context.Context, request SetPasswordRe
 			Temporary:      request.Temporary,
 		},
 	}).Unwrap()
+
+	return h.UOk()
+}
+
+// addToPasswordHistory keeps the replaced password, the history only holds the previous passwords as the current one is a credential.
+func (u *userServiceImpl) addToPasswordHistory(ctx context.Context, userId uuid.UUID, hashedPassword string, historyLength int) {
+	scope := middlewares.GetScope(ctx)
+
+	passwordHistoryRepository := ioc.Get[repos.PasswordHistoryRepository](scope)
+
+	if historyLength > 1 {
+		clockService := ioc.Get[utils.ClockService](scope)
+		passwordHistoryRepository.CreateEntry(ctx, repos.PasswordHistoryEntry{
+			UserId:         userId,
+			HashedPassword: hashedPassword,
+			CreatedAt:      clockService.Now(),
+		})
+	}
+
+	history := passwordHistoryRepository.GetHistory(ctx, repos.PasswordHistoryFilter{
+		UserId: userId,
+	})
+
+	keep := max(historyLength-1, 0)
+	if len(history) > keep {
+		var ids []uuid.UUID
+		for _, entry := range history[keep:] {
+			ids = append(ids, entry.Id)
+		}
+		passwordHistoryRepository.DeleteEntries(ctx, ids)
+	}
 }
 
 func (u *userServiceImpl) IsPasswordTemporary(ctx context.Context, userId uuid.UUID) bool {
 	scope := middlewares.GetScope(ctx)
 
+	// passwords of federated users are managed by their directory
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	if user, ok := userRepository.FindUserById(ctx, userId).Get(); ok && user.LdapProviderId.IsSome() {
+		return false
+	}
+
 	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
 
 	credential := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
 		BaseFilter: repos.BaseFilter{},
 		UserId:     h.Some(userId),
 		Type:       h.Some(constants.CredentialTypePassword),
-	}).Single()
+	}).SingleOrNone()
+
+	// users that only sign in without a password have no password to reset
+	if credential, ok := credential.Get(); ok {
+		return credential.Details.(repos.CredentialPasswordDetails).Temporary
+	}
+	return false
+}
+
+func (u *userServiceImpl) IsPasswordExpired(ctx context.Context, userId uuid.UUID) bool {
+	scope := middlewares.GetScope(ctx)
+
+	// passwords of federated users are managed by their directory
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || user.LdapProviderId.IsSome() {
+		return false
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+	if realm.PasswordPolicy.MaxAgeDays == 0 {
+		return false
+	}
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	credential, ok := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		UserId: h.Some(userId),
+		Type:   h.Some(constants.CredentialTypePassword),
+	}).SingleOrNone().Get()
+	if !ok {
+		return false
+	}
 
-	return credential.Details.(repos.CredentialPasswordDetails).Temporary
+	// the credential is replaced whenever the password changes, so it was created when the password was set
+	clockService := ioc.Get[utils.ClockService](scope)
+	expiresAt := credential.AuditCreatedAt.AddDate(0, 0, realm.PasswordPolicy.MaxAgeDays)
+	return !clockService.Now().Before(expiresAt)
 }
 
 func (u *userServiceImpl) AddTotp(ctx context.Context, request AddTotpRequest, strategy AuthStrategy) {
@@ -280,11 +558,25 @@ func (u *userServiceImpl) HasTotpConfigured(ctx context.Context, userId uuid.UUI
 
 // TODO: refactor looking up user by name and verifying password
 func (u *userServiceImpl) VerifyLogin(ctx context.Context, request VerifyLoginRequest) VerifyLoginResponse {
+	scope := middlewares.GetScope(ctx)
+
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: request.RealmId,
+		UserId:  request.UserId,
+		Ip:      request.Ip,
+	}
+	err := bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		panic(err)
+	}
+
 	isValid := PasswordAuthStrategy{
 		Password: request.Password,
 	}.Authorize(ctx, request.UserId)
 
 	if !isValid {
+		bruteForceService.RecordFailure(ctx, attempt)
 		// TODO: also do this for all other authroize things
 		panic(httpErrors.Unauthorized().WithMessage("invalid username or password"))
 	}
@@ -296,10 +588,146 @@ func (u *userServiceImpl) VerifyLogin(ctx context.Context, request VerifyLoginRe
 
 // TODO: refactor this away(just use the totp auth strategy where needed)
 func (u *userServiceImpl) VerifyTotp(ctx context.Context, request VerifyTotpRequest) {
+	scope := middlewares.GetScope(ctx)
+
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: request.RealmId,
+		UserId:  request.UserId,
+		Ip:      request.Ip,
+	}
+	err := bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		panic(err)
+	}
+
 	isValid := TotpAuthStrategy{
 		Code: request.Code,
 	}.Authorize(ctx, request.UserId)
 	if !isValid {
+		bruteForceService.RecordFailure(ctx, attempt)
 		panic(httpErrors.Unauthorized().WithMessage("invalid totp code"))
 	}
 }
+
+func (u *userServiceImpl) GenerateRecoveryCodes(ctx context.Context, userId uuid.UUID) []string {
+	scope := middlewares.GetScope(ctx)
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+
+	existing := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		UserId: h.Some(userId),
+		Type:   h.Some(constants.CredentialTypeRecoveryCodes),
+	})
+	for _, credential := range existing.Values() {
+		credentialRepository.DeleteCredential(ctx, credential.Id)
+	}
+
+	codes := make([]string, 0, constants.RecoveryCodeCount)
+	hashedCodes := make([]string, 0, constants.RecoveryCodeCount)
+	for i := 0; i < constants.RecoveryCodeCount; i++ {
+		code := utils.GenerateRecoveryCode()
+		codes = append(codes, code)
+		hashedCodes = append(hashedCodes, config.C.GetHasher().Hash(utils.NormalizeRecoveryCode(code)))
+	}
+
+	_ = credentialRepository.CreateCredential(ctx, repos.Credential{
+		UserId: userId,
+		Type:   constants.CredentialTypeRecoveryCodes,
+		Details: repos.CredentialRecoveryCodesDetails{
+			HashedCodes: hashedCodes,
+		},
+	}).Unwrap()
+
+	return codes
+}
+
+func (u *userServiceImpl) HasRecoveryCodes(ctx context.Context, userId uuid.UUID) bool {
+	scope := middlewares.GetScope(ctx)
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+
+	return credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		BaseFilter: repos.BaseFilter{
+			PagingInfo: h.Some(repos.NewPagingInfo(1, 1)),
+		},
+		UserId: h.Some(userId),
+		Type:   h.Some(constants.CredentialTypeRecoveryCodes),
+	}).Any()
+}
+
+func (u *userServiceImpl) VerifyRecoveryCode(ctx context.Context, request VerifyRecoveryCodeRequest) {
+	scope := middlewares.GetScope(ctx)
+
+	bruteForceService := ioc.Get[BruteForceService](scope)
+	attempt := LoginAttempt{
+		RealmId: request.RealmId,
+		UserId:  request.UserId,
+		Ip:      request.Ip,
+	}
+	err := bruteForceService.CheckAttempt(ctx, attempt)
+	if err != nil {
+		panic(err)
+	}
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+
+	// the row lock makes concurrent attempts wait for this transaction, so that every code can only be used once
+	credential, ok := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		UserId:        h.Some(request.UserId),
+		Type:          h.Some(constants.CredentialTypeRecoveryCodes),
+		LockForUpdate: true,
+	}).FirstOrNone().Get()
+	if !ok {
+		bruteForceService.RecordFailure(ctx, attempt)
+		panic(httpErrors.Unauthorized().WithMessage("invalid recovery code"))
+	}
+
+	details := credential.Details.(repos.CredentialRecoveryCodesDetails)
+	remaining, consumed := utils.ConsumeRecoveryCode(details.HashedCodes, request.Code, config.C.GetHasher())
+	if !consumed {
+		bruteForceService.RecordFailure(ctx, attempt)
+		panic(httpErrors.Unauthorized().WithMessage("invalid recovery code"))
+	}
+
+	if len(remaining) == 0 {
+		credentialRepository.DeleteCredential(ctx, credential.Id)
+	} else {
+		details.HashedCodes = remaining
+		credentialRepository.UpdateCredential(ctx, credential.Id, repos.CredentialUpdate{
+			Details: h.Some[interface{}](details),
+		})
+	}
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, request.UserId).Unwrap()
+
+	if email, ok := user.Email.Get(); ok {
+		jobService := ioc.Get[JobService](scope)
+		jobService.QueueJob(ctx, repos.SendMailJobDetails{
+			To:      []string{email},
+			Subject: "A recovery code was used to sign in",
+			Body: fmt.Sprintf("<p>A recovery code was just used to sign in to your account. You have %d recovery codes left.</p>"+
+				"<p>If this was not you, please contact your administrator immediately.</p>", len(remaining)),
+		})
+	}
+}
+
+// findUserByEmail returns the user with the email, emails are not unique so none is returned if several users share it.
+func findUserByEmail(ctx context.Context, realmId uuid.UUID, email string) h.Opt[repos.User] {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	users := userRepository.FindUsers(ctx, repos.UserFilter{
+		RealmId: h.Some(realmId),
+		Email:   h.Some(email),
+	}).Values()
+	if len(users) > 1 {
+		logging.Logger.Warnf("%d users in realm %s share an email address, it can not be used to find a user", len(users), realmId)
+	}
+	if len(users) != 1 {
+		return h.None[repos.User]()
+	}
+
+	return h.Some(users[0])
+}
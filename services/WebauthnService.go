@@ -0,0 +1,360 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"holvit/config"
+	"holvit/constants"
+	"holvit/h"
+	"holvit/httpErrors"
+	"holvit/ioc"
+	"holvit/logging"
+	"holvit/middlewares"
+	"holvit/repos"
+	"net/url"
+)
+
+type FinishWebauthnRegistrationRequest struct {
+	UserId      uuid.UUID
+	DisplayName h.Opt[string]
+	Session     webauthn.SessionData
+	Response    []byte
+}
+
+type FinishWebauthnLoginRequest struct {
+	RealmId uuid.UUID
+	// UserId is empty for passwordless logins, the user is then identified by the user handle of a discoverable credential.
+	UserId   h.Opt[uuid.UUID]
+	Session  webauthn.SessionData
+	Response []byte
+}
+
+type WebauthnService interface {
+	BeginRegistration(ctx context.Context, userId uuid.UUID) (*protocol.CredentialCreation, *webauthn.SessionData, error)
+	FinishRegistration(ctx context.Context, request FinishWebauthnRegistrationRequest) error
+
+	// BeginLogin starts an assertion for the credentials of the user, or for any discoverable credential if no user is given.
+	BeginLogin(ctx context.Context, realmId uuid.UUID, userId h.Opt[uuid.UUID]) (*protocol.CredentialAssertion, *webauthn.SessionData, error)
+	// FinishLogin verifies the assertion, updates the sign counter of the credential and returns the id of the user.
+	FinishLogin(ctx context.Context, request FinishWebauthnLoginRequest) (uuid.UUID, error)
+
+	HasWebauthnCredentials(ctx context.Context, userId uuid.UUID) bool
+	RequiresWebauthnOnboarding(ctx context.Context, userId uuid.UUID) bool
+}
+
+type webauthnServiceImpl struct{}
+
+func NewWebauthnService() WebauthnService {
+	return &webauthnServiceImpl{}
+}
+
+// webauthnUser adapts a user and its webauthn credentials to the user of the webauthn library.
+type webauthnUser struct {
+	user        repos.User
+	credentials []repos.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return u.user.Id[:]
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, credential := range u.credentials {
+		details := credential.Details.(repos.CredentialWebauthnDetails)
+
+		credentialId, err := base64.RawURLEncoding.DecodeString(details.CredentialId)
+		if err != nil {
+			logging.Logger.Errorf("invalid webauthn credential id in credential %s", credential.Id)
+			continue
+		}
+
+		transports := make([]protocol.AuthenticatorTransport, 0, len(details.Transports))
+		for _, transport := range details.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credentialId,
+			PublicKey:       details.PublicKey,
+			AttestationType: details.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   details.UserVerified,
+				BackupEligible: details.BackupEligible,
+				BackupState:    details.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    details.Aaguid,
+				SignCount: details.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+// findCredential returns the stored credential of a credential that was used in an assertion.
+func (u *webauthnUser) findCredential(credentialId []byte) (repos.Credential, repos.CredentialWebauthnDetails, bool) {
+	encoded := base64.RawURLEncoding.EncodeToString(credentialId)
+	for _, credential := range u.credentials {
+		details := credential.Details.(repos.CredentialWebauthnDetails)
+		if details.CredentialId == encoded {
+			return credential, details, true
+		}
+	}
+	return repos.Credential{}, repos.CredentialWebauthnDetails{}, false
+}
+
+func (s *webauthnServiceImpl) newWebauthn(realm repos.Realm) (*webauthn.WebAuthn, error) {
+	baseUrl, err := url.Parse(config.C.BaseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    config.C.Webauthn.Timeout,
+		TimeoutUVD: config.C.Webauthn.Timeout,
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          baseUrl.Hostname(),
+		RPDisplayName: realm.DisplayName,
+		RPOrigins:     []string{baseUrl.Scheme + "://" + baseUrl.Host},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
+
+func (s *webauthnServiceImpl) loadUser(ctx context.Context, userId uuid.UUID) (repos.Realm, *webauthnUser, error) {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user, ok := userRepository.FindUserById(ctx, userId).Get()
+	if !ok || !user.Enabled {
+		return repos.Realm{}, nil, httpErrors.Unauthorized().WithMessage("user not found")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	credentials := credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		UserId: h.Some(user.Id),
+		Type:   h.Some(constants.CredentialTypeWebauthn),
+	})
+
+	return realm, &webauthnUser{
+		user:        user,
+		credentials: credentials.Values(),
+	}, nil
+}
+
+func (s *webauthnServiceImpl) BeginRegistration(ctx context.Context, userId uuid.UUID) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	realm, user, err := s.loadUser(ctx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w, err := s.newWebauthn(realm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0)
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	// resident keys are preferred so that the credential can be used as a passkey for passwordless logins
+	return w.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+}
+
+func (s *webauthnServiceImpl) FinishRegistration(ctx context.Context, request FinishWebauthnRegistrationRequest) error {
+	scope := middlewares.GetScope(ctx)
+
+	realm, user, err := s.loadUser(ctx, request.UserId)
+	if err != nil {
+		return err
+	}
+
+	w, err := s.newWebauthn(realm)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(request.Response))
+	if err != nil {
+		return httpErrors.BadRequest().WithMessage("invalid webauthn credential")
+	}
+
+	credential, err := w.CreateCredential(user, request.Session, parsed)
+	if err != nil {
+		logging.Logger.Infof("webauthn registration of user %s failed: %v", user.user.Id, err)
+		return httpErrors.Unauthorized().WithMessage("invalid webauthn credential")
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	credentialRepository.CreateCredential(ctx, repos.Credential{
+		UserId: user.user.Id,
+		Type:   constants.CredentialTypeWebauthn,
+		Details: repos.CredentialWebauthnDetails{
+			DisplayName:     request.DisplayName.OrDefault("New Security Key"),
+			CredentialId:    base64.RawURLEncoding.EncodeToString(credential.ID),
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transports:      transports,
+			Aaguid:          credential.Authenticator.AAGUID,
+			SignCount:       credential.Authenticator.SignCount,
+			UserVerified:    credential.Flags.UserVerified,
+			BackupEligible:  credential.Flags.BackupEligible,
+			BackupState:     credential.Flags.BackupState,
+		},
+	}).Unwrap()
+
+	return nil
+}
+
+func (s *webauthnServiceImpl) BeginLogin(ctx context.Context, realmId uuid.UUID, userId h.Opt[uuid.UUID]) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	scope := middlewares.GetScope(ctx)
+
+	if id, ok := userId.Get(); ok {
+		realm, user, err := s.loadUser(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(user.credentials) == 0 {
+			return nil, nil, httpErrors.BadRequest().WithMessage("the user has no webauthn credentials")
+		}
+
+		w, err := s.newWebauthn(realm)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return w.BeginLogin(user)
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, realmId).Unwrap()
+
+	w, err := s.newWebauthn(realm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// without a password the authenticator has to verify the user itself
+	return w.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+func (s *webauthnServiceImpl) FinishLogin(ctx context.Context, request FinishWebauthnLoginRequest) (uuid.UUID, error) {
+	scope := middlewares.GetScope(ctx)
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(request.Response))
+	if err != nil {
+		return uuid.UUID{}, httpErrors.BadRequest().WithMessage("invalid webauthn credential")
+	}
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, request.RealmId).Unwrap()
+
+	w, err := s.newWebauthn(realm)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	var user *webauthnUser
+	var credential *webauthn.Credential
+	if userId, ok := request.UserId.Get(); ok {
+		_, user, err = s.loadUser(ctx, userId)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		credential, err = w.ValidateLogin(user, request.Session, parsed)
+	} else {
+		credential, err = w.ValidateDiscoverableLogin(func(rawId, userHandle []byte) (webauthn.User, error) {
+			userId, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, errors.New("invalid user handle")
+			}
+			_, user, err = s.loadUser(ctx, userId)
+			if err != nil {
+				return nil, err
+			}
+			if user.user.RealmId != realm.Id {
+				return nil, errors.New("the user belongs to another realm")
+			}
+			return user, nil
+		}, request.Session, parsed)
+	}
+	if err != nil {
+		logging.Logger.Infof("webauthn login failed: %v", err)
+		return uuid.UUID{}, httpErrors.Unauthorized().WithMessage("invalid webauthn credential")
+	}
+
+	if credential.Authenticator.CloneWarning {
+		logging.Logger.Warnf("possibly cloned webauthn credential used by user %s", user.user.Id)
+		return uuid.UUID{}, httpErrors.Unauthorized().WithMessage("invalid webauthn credential")
+	}
+
+	stored, details, ok := user.findCredential(credential.ID)
+	if !ok {
+		return uuid.UUID{}, httpErrors.Unauthorized().WithMessage("invalid webauthn credential")
+	}
+
+	details.SignCount = credential.Authenticator.SignCount
+	details.UserVerified = credential.Flags.UserVerified
+	details.BackupState = credential.Flags.BackupState
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	credentialRepository.UpdateCredential(ctx, stored.Id, repos.CredentialUpdate{
+		Details: h.Some[interface{}](details),
+	})
+
+	return user.user.Id, nil
+}
+
+func (s *webauthnServiceImpl) HasWebauthnCredentials(ctx context.Context, userId uuid.UUID) bool {
+	scope := middlewares.GetScope(ctx)
+
+	credentialRepository := ioc.Get[repos.CredentialRepository](scope)
+	return credentialRepository.FindCredentials(ctx, repos.CredentialFilter{
+		UserId: h.Some(userId),
+		Type:   h.Some(constants.CredentialTypeWebauthn),
+	}).Any()
+}
+
+func (s *webauthnServiceImpl) RequiresWebauthnOnboarding(ctx context.Context, userId uuid.UUID) bool {
+	scope := middlewares.GetScope(ctx)
+
+	userRepository := ioc.Get[repos.UserRepository](scope)
+	user := userRepository.FindUserById(ctx, userId).Unwrap()
+
+	realmRepository := ioc.Get[repos.RealmRepository](scope)
+	realm := realmRepository.FindRealmById(ctx, user.RealmId).Unwrap()
+
+	return realm.RequireWebauthn && !s.HasWebauthnCredentials(ctx, userId)
+}
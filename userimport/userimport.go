@@ -0,0 +1,237 @@
+package userimport
+
+import (
+	"bufio"
+	"encoding/base32"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatJsonLines = "jsonl"
+	FormatCsv       = "csv"
+)
+
+// Record is a user of the import.
+type Record struct {
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	Disabled      bool   `json:"disabled"`
+	// PasswordHash is a hash in the modular crypt format, e.g. $2a$ for bcrypt, $pbkdf2-sha256$ or $argon2id$.
+	PasswordHash      string `json:"passwordHash"`
+	PasswordTemporary bool   `json:"passwordTemporary"`
+	// KeycloakCredential can be used instead of PasswordHash for users exported from keycloak.
+	KeycloakCredential *KeycloakCredential `json:"keycloakCredential"`
+	// TotpSecret is the base32 encoded secret of the authenticator app of the user.
+	TotpSecret string   `json:"totpSecret"`
+	Roles      []string `json:"roles"`
+}
+
+// KeycloakCredential is a password credential as it is found in keycloak realm exports.
+type KeycloakCredential struct {
+	SecretData     string `json:"secretData"`
+	CredentialData string `json:"credentialData"`
+}
+
+// Row is a line of the import, Err is set if the line could not be parsed.
+type Row struct {
+	Number int
+	Record Record
+	Err    error
+}
+
+// Reader reads the rows of an import one by one, it returns io.EOF after the last row.
+type Reader interface {
+	Read() (Row, error)
+}
+
+// NewReader returns a reader for the format, it is one of FormatJsonLines and FormatCsv.
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatJsonLines:
+		return NewJsonLinesReader(r), nil
+	case FormatCsv:
+		return NewCsvReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format '%s'", format)
+	}
+}
+
+type jsonLinesReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJsonLinesReader reads one json encoded Record per line, empty lines are skipped.
+func NewJsonLinesReader(r io.Reader) Reader {
+	scanner := bufio.NewScanner(r)
+	// keycloak credentials make lines longer than the default limit of the scanner
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	return &jsonLinesReader{
+		scanner: scanner,
+	}
+}
+
+func (r *jsonLinesReader) Read() (Row, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		row := Row{Number: r.line}
+		if err := json.Unmarshal([]byte(line), &row.Record); err != nil {
+			row.Err = fmt.Errorf("invalid json: %w", err)
+		}
+		return row, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Row{}, err
+	}
+	return Row{}, io.EOF
+}
+
+var csvColumns = []string{"username", "email", "emailVerified", "disabled", "passwordHash", "passwordTemporary", "totpSecret", "roles"}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// NewCsvReader reads records from csv with a header row naming the columns.
+// Unknown columns are not allowed, missing columns are left empty. Roles are separated by spaces.
+func NewCsvReader(r io.Reader) (Reader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing csv header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !isCsvColumn(name) {
+			return nil, fmt.Errorf("unknown csv column '%s'", name)
+		}
+		columns[name] = i
+	}
+
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("the csv header has no username column")
+	}
+
+	return &csvReader{
+		reader:  reader,
+		columns: columns,
+	}, nil
+}
+
+func isCsvColumn(name string) bool {
+	for _, column := range csvColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *csvReader) Read() (Row, error) {
+	fields, err := r.reader.Read()
+
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return Row{Number: parseError.StartLine, Err: parseError.Err}, nil
+	}
+	if err != nil {
+		return Row{}, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	row := Row{Number: line}
+	value := func(name string) string {
+		if i, ok := r.columns[name]; ok {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+	flag := func(name string) bool {
+		if row.Err != nil {
+			return false
+		}
+		text := value(name)
+		if text == "" {
+			return false
+		}
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			row.Err = fmt.Errorf("invalid value '%s' for column %s", text, name)
+		}
+		return b
+	}
+
+	row.Record = Record{
+		Username:          value("username"),
+		Email:             value("email"),
+		EmailVerified:     flag("emailVerified"),
+		Disabled:          flag("disabled"),
+		PasswordHash:      value("passwordHash"),
+		PasswordTemporary: flag("passwordTemporary"),
+		TotpSecret:        value("totpSecret"),
+		Roles:             strings.Fields(value("roles")),
+	}
+
+	return row, nil
+}
+
+// NormalizeTotpSecret returns the secret in upper case without spaces and padding, the way authenticator apps show it.
+func NormalizeTotpSecret(secret string) string {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	return strings.TrimRight(secret, "=")
+}
+
+// Validate checks the fields of the record that can be checked without knowing the realm.
+// The password hash is checked by the caller, it depends on the supported hash algorithms.
+func Validate(record Record) error {
+	if strings.TrimSpace(record.Username) == "" {
+		return errors.New("the username is required")
+	}
+
+	if record.Email != "" && !strings.Contains(record.Email, "@") {
+		return fmt.Errorf("'%s' is not an email address", record.Email)
+	}
+
+	if record.PasswordHash != "" && record.KeycloakCredential != nil {
+		return errors.New("only one of passwordHash and keycloakCredential can be set")
+	}
+
+	if record.PasswordTemporary && record.PasswordHash == "" && record.KeycloakCredential == nil {
+		return errors.New("passwordTemporary requires a password")
+	}
+
+	if record.TotpSecret != "" {
+		secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(NormalizeTotpSecret(record.TotpSecret))
+		if err != nil || len(secret) == 0 {
+			return errors.New("the totp secret is not base32 encoded")
+		}
+	}
+
+	for _, role := range record.Roles {
+		if strings.TrimSpace(role) == "" {
+			return errors.New("role names must not be empty")
+		}
+	}
+
+	return nil
+}
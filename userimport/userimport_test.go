@@ -0,0 +1,112 @@
+package userimport
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, reader Reader) []Row {
+	var rows []Row
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows
+		}
+		assert.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestJsonLinesReader_ReadsRecordsAndReportsInvalidLines(t *testing.T) {
+	// arrange
+	input := `{"username": "alice", "email": "alice@example.com", "emailVerified": true, "roles": ["admin"]}
+
+not json
+{"username": "bob", "passwordHash": "$2a$10$abc"}`
+
+	// act
+	rows := readAll(t, NewJsonLinesReader(strings.NewReader(input)))
+
+	// assert
+	assert.Len(t, rows, 3)
+	assert.Equal(t, 1, rows[0].Number)
+	assert.Equal(t, Record{Username: "alice", Email: "alice@example.com", EmailVerified: true, Roles: []string{"admin"}}, rows[0].Record)
+	assert.Equal(t, 3, rows[1].Number)
+	assert.Error(t, rows[1].Err)
+	assert.Equal(t, 4, rows[2].Number)
+	assert.Equal(t, "$2a$10$abc", rows[2].Record.PasswordHash)
+}
+
+func TestCsvReader_ReadsColumnsByName(t *testing.T) {
+	// arrange
+	input := "roles,username,emailVerified,email\n" +
+		"admin user,alice,true,alice@example.com\n" +
+		",bob,maybe,bob@example.com\n"
+
+	// act
+	reader, err := NewCsvReader(strings.NewReader(input))
+	assert.NoError(t, err)
+	rows := readAll(t, reader)
+
+	// assert
+	assert.Len(t, rows, 2)
+	assert.Equal(t, 2, rows[0].Number)
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, Record{Username: "alice", Email: "alice@example.com", EmailVerified: true, Roles: []string{"admin", "user"}}, rows[0].Record)
+	assert.Equal(t, 3, rows[1].Number)
+	assert.ErrorContains(t, rows[1].Err, "emailVerified")
+}
+
+func TestCsvReader_ReportsRowsWithWrongFieldCount(t *testing.T) {
+	// arrange
+	input := "username,email\nalice\nbob,bob@example.com\n"
+
+	// act
+	reader, err := NewCsvReader(strings.NewReader(input))
+	assert.NoError(t, err)
+	rows := readAll(t, reader)
+
+	// assert
+	assert.Len(t, rows, 2)
+	assert.Equal(t, 2, rows[0].Number)
+	assert.Error(t, rows[0].Err)
+	assert.Equal(t, "bob", rows[1].Record.Username)
+}
+
+func TestNewCsvReader_RejectsUnknownColumns(t *testing.T) {
+	// act
+	_, unknown := NewCsvReader(strings.NewReader("username,password\n"))
+	_, noUsername := NewCsvReader(strings.NewReader("email\n"))
+
+	// assert
+	assert.ErrorContains(t, unknown, "password")
+	assert.Error(t, noUsername)
+}
+
+func TestValidate(t *testing.T) {
+	// act
+	valid := Validate(Record{Username: "alice", Email: "alice@example.com", PasswordHash: "$2a$10$abc", TotpSecret: "jbsw y3dp ehpk 3pxp", Roles: []string{"admin"}})
+	noUsername := Validate(Record{Email: "alice@example.com"})
+	invalidEmail := Validate(Record{Username: "alice", Email: "alice"})
+	twoPasswords := Validate(Record{Username: "alice", PasswordHash: "$2a$10$abc", KeycloakCredential: &KeycloakCredential{}})
+	temporaryWithoutPassword := Validate(Record{Username: "alice", PasswordTemporary: true})
+	invalidTotp := Validate(Record{Username: "alice", TotpSecret: "not base32!"})
+
+	// assert
+	assert.NoError(t, valid)
+	assert.Error(t, noUsername)
+	assert.Error(t, invalidEmail)
+	assert.Error(t, twoPasswords)
+	assert.Error(t, temporaryWithoutPassword)
+	assert.Error(t, invalidTotp)
+}
+
+func TestNormalizeTotpSecret(t *testing.T) {
+	// act
+	normalized := NormalizeTotpSecret("jbsw y3dp ehpk 3pxp====")
+
+	// assert
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", normalized)
+}
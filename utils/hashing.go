@@ -7,7 +7,9 @@ import (
 	"github.com/gwenya/go-crypt/algorithm"
 	"github.com/gwenya/go-crypt/algorithm/argon2"
 	"github.com/gwenya/go-crypt/algorithm/bcrypt"
+	"github.com/gwenya/go-crypt/algorithm/pbkdf2"
 	"github.com/gwenya/go-crypt/algorithm/scrypt"
+	"github.com/gwenya/go-crypt/algorithm/shacrypt"
 	"strings"
 )
 
@@ -114,7 +116,7 @@ func (h *BcryptHasher) Hash(plain string) string {
 func (h *BcryptHasher) CompareSettings(settings HashSettings) bool {
 	s, ok := settings.(*BcryptHashSettings)
 	if !ok {
-		panic(fmt.Errorf("expected settings to be *BcryptHashSettings, got %T", settings))
+		return false
 	}
 	return *s == *h.settings
 }
@@ -126,7 +128,7 @@ func (h *ScryptHasher) Hash(plain string) string {
 func (h *ScryptHasher) CompareSettings(settings HashSettings) bool {
 	s, ok := settings.(*ScryptHashSettings)
 	if !ok {
-		panic(fmt.Errorf("expected settings to be *ScryptHashSettings, got %T", settings))
+		return false
 	}
 	return *s == *h.settings
 }
@@ -138,18 +140,21 @@ func (h *Argon2idHasher) Hash(plain string) string {
 func (h *Argon2idHasher) CompareSettings(settings HashSettings) bool {
 	s, ok := settings.(*Argon2idHashSettings)
 	if !ok {
-		panic(fmt.Errorf("expected settings to be *Argon2idHashSettings, got %T", settings))
+		return false
 	}
-	return *s == *h.settings // TODO: try out what happens if we rename s to settings
+	return *s == *h.settings
 }
 
+// checkIfRehashNeeded reports whether the digest was made with another algorithm or other settings than the hasher uses.
+// Digests of algorithms that can only be verified, like pbkdf2, always need a rehash.
 func checkIfRehashNeeded(digest algorithm.Digest, hasher Hasher) bool {
 	var settings HashSettings
-	if d, ok := digest.(*bcrypt.Digest); ok {
+	switch d := digest.(type) {
+	case *bcrypt.Digest:
 		settings = &BcryptHashSettings{
 			Cost: d.Iterations(),
 		}
-	} else if d, ok := digest.(*scrypt.Digest); ok {
+	case *scrypt.Digest:
 		settings = &ScryptHashSettings{
 			R:            d.R(),
 			Parallelism:  d.P(),
@@ -157,7 +162,10 @@ func checkIfRehashNeeded(digest algorithm.Digest, hasher Hasher) bool {
 			SaltLength:   len(d.Salt()),
 			OutputLength: len(d.Key()),
 		}
-	} else if d, ok := digest.(*argon2.Digest); ok {
+	case *argon2.Digest:
+		if d.Variant() != argon2.VariantID {
+			return true
+		}
 		settings = &Argon2idHashSettings{
 			MemoryCost:   d.M(),
 			OpsCost:      d.T(),
@@ -165,10 +173,10 @@ func checkIfRehashNeeded(digest algorithm.Digest, hasher Hasher) bool {
 			OutputLength: len(d.Key()),
 			SaltLength:   len(d.Salt()),
 		}
-	} else {
-		panic(fmt.Errorf("unsupported digest type: %T", d))
+	default:
+		return true
 	}
-	return hasher.CompareSettings(settings)
+	return !hasher.CompareSettings(settings)
 }
 
 var decoder *crypt.Decoder
@@ -185,12 +193,29 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	err = argon2.RegisterDecoderArgon2id(decoder)
+	err = argon2.RegisterDecoder(decoder)
+	if err != nil {
+		panic(err)
+	}
+
+	// legacy algorithms are only verified, matching passwords are rehashed with the configured algorithm
+	err = pbkdf2.RegisterDecoder(decoder)
+	if err != nil {
+		panic(err)
+	}
+
+	err = shacrypt.RegisterDecoder(decoder)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// IsSupportedHash reports whether the hash is in a format ValidateHash can verify.
+func IsSupportedHash(hash string) bool {
+	_, err := decoder.Decode(hash)
+	return err == nil
+}
+
 func ValidateHash(plain string, hash string, hasher Hasher) HashValidationResult {
 	digest, err := decoder.Decode(hash)
 	if err != nil {
@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
 	"testing"
 )
 
@@ -50,3 +55,131 @@ func Fuzz_BCryptAlgorithm(f *testing.F) {
 		assert.True(t, res2.IsValid)
 	})
 }
+
+func testArgon2idHasher() Hasher {
+	settings := Argon2idHashSettings{
+		MemoryCost:   1024,
+		OpsCost:      1,
+		Parallelism:  1,
+		OutputLength: 32,
+		SaltLength:   16,
+	}
+	return settings.MakeHasher()
+}
+
+func TestValidateHash_DoesNotRehashWithSameSettings(t *testing.T) {
+	// arrange
+	hasher := testArgon2idHasher()
+	hashed := hasher.Hash("password")
+
+	// act
+	result := ValidateHash("password", hashed, hasher)
+
+	// assert
+	assert.True(t, result.IsValid)
+	assert.False(t, result.NeedsRehash)
+}
+
+func TestValidateHash_RehashesWithChangedSettings(t *testing.T) {
+	// arrange
+	oldSettings := BcryptHashSettings{Cost: 10}
+	newSettings := BcryptHashSettings{Cost: 11}
+	hashed := oldSettings.MakeHasher().Hash("password")
+
+	// act
+	result := ValidateHash("password", hashed, newSettings.MakeHasher())
+
+	// assert
+	assert.True(t, result.IsValid)
+	assert.True(t, result.NeedsRehash)
+}
+
+func TestValidateHash_RehashesWithChangedAlgorithm(t *testing.T) {
+	// arrange
+	bcryptSettings := BcryptHashSettings{Cost: 10}
+	hashed := bcryptSettings.MakeHasher().Hash("password")
+
+	// act
+	result := ValidateHash("password", hashed, testArgon2idHasher())
+
+	// assert
+	assert.True(t, result.IsValid)
+	assert.True(t, result.NeedsRehash)
+}
+
+func TestValidateHash_VerifiesLegacyPbkdf2Hashes(t *testing.T) {
+	// arrange
+	salt := []byte("0123456789abcdef")
+	key := pbkdf2.Key([]byte("password"), salt, 1000, 32, sha256.New)
+	hashed := formatPbkdf2Hash("pbkdf2-sha256", 1000, salt, key)
+
+	// act
+	valid := ValidateHash("password", hashed, testArgon2idHasher())
+	invalid := ValidateHash("wrong", hashed, testArgon2idHasher())
+
+	// assert
+	assert.True(t, valid.IsValid)
+	assert.True(t, valid.NeedsRehash)
+	assert.False(t, invalid.IsValid)
+}
+
+func TestConvertKeycloakPasswordHash_Pbkdf2(t *testing.T) {
+	// arrange
+	salt := []byte("0123456789abcdef")
+	key := pbkdf2.Key([]byte("password"), salt, 27500, 64, sha256.New)
+	secretData := fmt.Sprintf(`{"value":"%s","salt":"%s","additionalParameters":{}}`,
+		base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(salt))
+	credentialData := `{"hashIterations":27500,"algorithm":"pbkdf2-sha256","additionalParameters":{}}`
+
+	// act
+	hashed, err := ConvertKeycloakPasswordHash(secretData, credentialData)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, ValidateHash("password", hashed, testArgon2idHasher()).IsValid)
+	assert.False(t, ValidateHash("wrong", hashed, testArgon2idHasher()).IsValid)
+}
+
+func TestConvertKeycloakPasswordHash_Argon2(t *testing.T) {
+	// arrange
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("password"), salt, 3, 7168, 1, 32)
+	secretData := fmt.Sprintf(`{"value":"%s","salt":"%s","additionalParameters":{}}`,
+		base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(salt))
+	credentialData := `{"hashIterations":3,"algorithm":"argon2","additionalParameters":{"hashLength":["32"],"memory":["7168"],"type":["id"],"version":["1.3"],"parallelism":["1"]}}`
+
+	// act
+	hashed, err := ConvertKeycloakPasswordHash(secretData, credentialData)
+
+	// assert
+	assert.NoError(t, err)
+	result := ValidateHash("password", hashed, testArgon2idHasher())
+	assert.True(t, result.IsValid)
+	assert.True(t, result.NeedsRehash)
+}
+
+func TestConvertKeycloakPasswordHash_RejectsUnknownAlgorithms(t *testing.T) {
+	// arrange
+	secretData := `{"value":"aGFzaA==","salt":"c2FsdA=="}`
+	credentialData := `{"hashIterations":1,"algorithm":"md5"}`
+
+	// act
+	_, err := ConvertKeycloakPasswordHash(secretData, credentialData)
+
+	// assert
+	assert.ErrorContains(t, err, "md5")
+}
+
+func TestIsSupportedHash(t *testing.T) {
+	// arrange
+	bcryptSettings := BcryptHashSettings{Cost: 10}
+	hashed := bcryptSettings.MakeHasher().Hash("password")
+
+	// act
+	supported := IsSupportedHash(hashed)
+	unsupported := IsSupportedHash("5f4dcc3b5aa765d61d8327deb882cf99")
+
+	// assert
+	assert.True(t, supported)
+	assert.False(t, unsupported)
+}
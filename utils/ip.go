@@ -2,26 +2,61 @@ package utils
 
 import (
 	"github.com/jackc/pgtype"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
-func GetRequestIp(r *http.Request) string {
+// GetRequestIp returns the address of the client without the port.
+// The X-Real-Ip and X-Forwarded-For headers are only used if the request comes from one of the trusted proxies,
+// otherwise clients could choose their address freely.
+func GetRequestIp(r *http.Request, trustedProxies []netip.Prefix) string {
 	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
 
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		ip = strings.Split(forwarded, ",")[0]
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
 	}
 
-	realIP := r.Header.Get("X-Real-Ip")
+	realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip"))
 	if realIP != "" {
-		ip = realIP
+		return realIP
+	}
+
+	// every proxy appends the address it received the request from, so the client is the last untrusted address
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		ip = address
+		if !isTrustedProxy(address, trustedProxies) {
+			break
+		}
 	}
 
 	return ip
 }
 
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func InetFromString(address string) pgtype.Inet {
 	inet := pgtype.Inet{}
 
@@ -3,9 +3,15 @@ package utils
 import (
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/netip"
 	"testing"
 )
 
+var testTrustedProxies = []netip.Prefix{
+	netip.MustParsePrefix("1.1.1.1/32"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+}
+
 func Test_GetRequestIp_NoHeaders(t *testing.T) {
 	// arrange
 	expected := "127.0.0.1"
@@ -15,12 +21,26 @@ func Test_GetRequestIp_NoHeaders(t *testing.T) {
 	}
 
 	// act
-	ip := GetRequestIp(&r)
+	ip := GetRequestIp(&r, testTrustedProxies)
 
 	// assert
 	assert.Equal(t, expected, ip)
 }
 
+func Test_GetRequestIp_StripsPort(t *testing.T) {
+	// arrange
+	r := http.Request{
+		RemoteAddr: "[::1]:54321",
+		Header:     http.Header{},
+	}
+
+	// act
+	ip := GetRequestIp(&r, testTrustedProxies)
+
+	// assert
+	assert.Equal(t, "::1", ip)
+}
+
 func Test_GetRequestIp_Forwarded(t *testing.T) {
 	// arrange
 	expected := "127.0.0.1"
@@ -32,7 +52,24 @@ func Test_GetRequestIp_Forwarded(t *testing.T) {
 	}
 
 	// act
-	ip := GetRequestIp(&r)
+	ip := GetRequestIp(&r, testTrustedProxies)
+
+	// assert
+	assert.Equal(t, expected, ip)
+}
+
+func Test_GetRequestIp_ForwardedChainSkipsTrustedProxies(t *testing.T) {
+	// arrange
+	expected := "127.0.0.1"
+	r := http.Request{
+		RemoteAddr: "1.1.1.1:443",
+		Header: http.Header{
+			"X-Forwarded-For": []string{"3.3.3.3, " + expected + ", 10.1.2.3"},
+		},
+	}
+
+	// act
+	ip := GetRequestIp(&r, testTrustedProxies)
 
 	// assert
 	assert.Equal(t, expected, ip)
@@ -49,7 +86,7 @@ func Test_GetRequestIp_XRealIp(t *testing.T) {
 	}
 
 	// act
-	ip := GetRequestIp(&r)
+	ip := GetRequestIp(&r, testTrustedProxies)
 
 	// assert
 	assert.Equal(t, expected, ip)
@@ -67,7 +104,25 @@ func Test_GetRequestIp_ForwarededAndXRealIp(t *testing.T) {
 	}
 
 	// act
-	ip := GetRequestIp(&r)
+	ip := GetRequestIp(&r, testTrustedProxies)
+
+	// assert
+	assert.Equal(t, expected, ip)
+}
+
+func Test_GetRequestIp_IgnoresHeadersOfUntrustedClients(t *testing.T) {
+	// arrange
+	expected := "2.2.2.2"
+	r := http.Request{
+		RemoteAddr: expected + ":1234",
+		Header: http.Header{
+			"X-Forwarded-For": []string{"127.0.0.1"},
+			"X-Real-Ip":       []string{"127.0.0.1"},
+		},
+	}
+
+	// act
+	ip := GetRequestIp(&r, testTrustedProxies)
 
 	// assert
 	assert.Equal(t, expected, ip)
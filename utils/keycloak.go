@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// adaptedBase64 is the base64 variant of the modular crypt format used for pbkdf2 hashes.
+var adaptedBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789./").WithPadding(base64.NoPadding)
+
+type keycloakSecretData struct {
+	Value string `json:"value"`
+	Salt  string `json:"salt"`
+}
+
+type keycloakCredentialData struct {
+	HashIterations       int                 `json:"hashIterations"`
+	Algorithm            string              `json:"algorithm"`
+	AdditionalParameters map[string][]string `json:"additionalParameters"`
+}
+
+// ConvertKeycloakPasswordHash converts the secretData and credentialData of a keycloak password credential
+// into a hash that ValidateHash can verify.
+func ConvertKeycloakPasswordHash(secretData string, credentialData string) (string, error) {
+	var secret keycloakSecretData
+	if err := json.Unmarshal([]byte(secretData), &secret); err != nil {
+		return "", fmt.Errorf("invalid secret data: %w", err)
+	}
+
+	var credential keycloakCredentialData
+	if err := json.Unmarshal([]byte(credentialData), &credential); err != nil {
+		return "", fmt.Errorf("invalid credential data: %w", err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(secret.Value)
+	if err != nil {
+		return "", fmt.Errorf("invalid hash value: %w", err)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(secret.Salt)
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %w", err)
+	}
+
+	if len(value) == 0 || len(salt) == 0 {
+		return "", fmt.Errorf("the hash value and salt must not be empty")
+	}
+
+	if credential.HashIterations < 1 {
+		return "", fmt.Errorf("invalid hash iterations: %d", credential.HashIterations)
+	}
+
+	switch credential.Algorithm {
+	case "pbkdf2":
+		return formatPbkdf2Hash("pbkdf2", credential.HashIterations, salt, value), nil
+	case "pbkdf2-sha256":
+		return formatPbkdf2Hash("pbkdf2-sha256", credential.HashIterations, salt, value), nil
+	case "pbkdf2-sha512":
+		return formatPbkdf2Hash("pbkdf2-sha512", credential.HashIterations, salt, value), nil
+	case "argon2":
+		return formatKeycloakArgon2Hash(credential, salt, value)
+	default:
+		return "", fmt.Errorf("unsupported keycloak hash algorithm '%s'", credential.Algorithm)
+	}
+}
+
+func formatPbkdf2Hash(identifier string, iterations int, salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$%d$%s$%s", identifier, iterations, adaptedBase64.EncodeToString(salt), adaptedBase64.EncodeToString(key))
+}
+
+func formatKeycloakArgon2Hash(credential keycloakCredentialData, salt []byte, key []byte) (string, error) {
+	parameter := func(name string, defaultValue string) string {
+		if values := credential.AdditionalParameters[name]; len(values) > 0 {
+			return values[0]
+		}
+		return defaultValue
+	}
+
+	var identifier string
+	switch parameter("type", "id") {
+	case "id":
+		identifier = "argon2id"
+	case "i":
+		identifier = "argon2i"
+	case "d":
+		identifier = "argon2d"
+	default:
+		return "", fmt.Errorf("unsupported argon2 type '%s'", parameter("type", ""))
+	}
+
+	var version int
+	switch parameter("version", "1.3") {
+	case "1.3":
+		version = 19
+	case "1.0":
+		version = 16
+	default:
+		return "", fmt.Errorf("unsupported argon2 version '%s'", parameter("version", ""))
+	}
+
+	memory, err := strconv.Atoi(parameter("memory", "7168"))
+	if err != nil {
+		return "", fmt.Errorf("invalid argon2 memory: %w", err)
+	}
+
+	parallelism, err := strconv.Atoi(parameter("parallelism", "1"))
+	if err != nil {
+		return "", fmt.Errorf("invalid argon2 parallelism: %w", err)
+	}
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		identifier, version, memory, credential.HashIterations, parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
@@ -1,15 +1,23 @@
 package utils
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
+	"time"
+	"unicode"
 )
 
 func GenerateRandomBytes(length int) ([]byte, error) {
@@ -39,6 +47,66 @@ func GenerateRandomStringBase64(length int) string {
 	return base64.URLEncoding.EncodeToString(bytes)
 }
 
+// GenerateNumericCode generates a code of the given length that only contains digits.
+func GenerateNumericCode(length int) string {
+	var builder strings.Builder
+	for i := 0; i < length; i++ {
+		builder.WriteByte(byte('0' + GenerateRandomNumber(10)))
+	}
+	return builder.String()
+}
+
+// Sign creates a url safe HMAC-SHA256 signature of the data.
+func Sign(data string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature created by Sign in constant time.
+func VerifySignature(data string, signature string, key []byte) bool {
+	return hmac.Equal([]byte(Sign(data, key)), []byte(signature))
+}
+
+// recoveryCodeAlphabet leaves out characters that are easily confused like 0/o and 1/l.
+const recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+const recoveryCodeGroupLength = 5
+
+// GenerateRecoveryCode generates a one-time code in the form xxxxx-xxxxx.
+func GenerateRecoveryCode() string {
+	var builder strings.Builder
+	for i := 0; i < 2*recoveryCodeGroupLength; i++ {
+		if i == recoveryCodeGroupLength {
+			builder.WriteByte('-')
+		}
+		builder.WriteByte(recoveryCodeAlphabet[GenerateRandomNumber(int64(len(recoveryCodeAlphabet)))])
+	}
+	return builder.String()
+}
+
+// NormalizeRecoveryCode removes separators and whitespace from user input so that codes can be typed without the dash.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, code)
+}
+
+// ConsumeRecoveryCode returns the hashed codes without the one that matches the code, so that it can not be used again.
+func ConsumeRecoveryCode(hashedCodes []string, code string, hasher Hasher) ([]string, bool) {
+	normalized := NormalizeRecoveryCode(code)
+	for i, hashedCode := range hashedCodes {
+		if ValidateHash(normalized, hashedCode, hasher).IsValid {
+			remaining := make([]string, 0, len(hashedCodes)-1)
+			remaining = append(remaining, hashedCodes[:i]...)
+			return append(remaining, hashedCodes[i+1:]...), true
+		}
+	}
+	return hashedCodes, false
+}
+
 func GenerateKeyPair() (ed25519.PrivateKey, ed25519.PublicKey) {
 	publicKey, privateKey, err := ed25519.GenerateKey(nil)
 	if err != nil {
@@ -62,6 +130,65 @@ func ImportPrivateKey(privateKeyBytes []byte) (ed25519.PrivateKey, ed25519.Publi
 	return privateKey, publicKey
 }
 
+// rsaKeySize is the size of the realm RSA keys, 2048 bits is what service providers expect at minimum.
+const rsaKeySize = 2048
+
+func GenerateRsaKey() *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		panic(fmt.Errorf("failed to generate RSA key: %v", err))
+	}
+	return privateKey
+}
+
+func ExportRsaPrivateKey(privateKey *rsa.PrivateKey) []byte {
+	return x509.MarshalPKCS1PrivateKey(privateKey)
+}
+
+func ImportRsaPrivateKey(privateKeyBytes []byte) *rsa.PrivateKey {
+	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyBytes)
+	if err != nil {
+		panic(fmt.Errorf("invalid RSA private key: %v", err))
+	}
+	return privateKey
+}
+
+// SelfSignedCertificate creates a DER encoded certificate for an ed25519 or RSA key.
+// The certificate is deterministic for a key, so it does not change between requests and does not need to be stored.
+func SelfSignedCertificate(privateKey crypto.Signer, commonName string) []byte {
+	publicKey := privateKey.Public()
+
+	var serial [sha256.Size]byte
+	if ed25519PublicKey, ok := publicKey.(ed25519.PublicKey); ok {
+		serial = sha256.Sum256(ed25519PublicKey)
+	} else {
+		publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			panic(err)
+		}
+		serial = sha256.Sum256(publicKeyBytes)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(serial[:16]),
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		NotBefore:             time.Unix(0, 0).UTC(),
+		NotAfter:              time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	// RSA PKCS #1 v1.5 signatures are deterministic as well, so the certificate stays the same
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, publicKey, privateKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return certificate
+}
+
 func GenerateSymmetricKeyFromText(aesKeyStr string) []byte {
 	hashedKey := sha256.Sum256([]byte(aesKeyStr))
 	return hashedKey[:32]
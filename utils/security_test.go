@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_SelfSignedCertificate_IsDeterministic(t *testing.T) {
+	// arrange
+	privateKey, _ := GenerateKeyPair()
+
+	// act
+	first := SelfSignedCertificate(privateKey, "test")
+	second := SelfSignedCertificate(privateKey, "test")
+
+	// assert
+	assert.Equal(t, first, second)
+}
+
+func Test_SelfSignedCertificate_ContainsPublicKey(t *testing.T) {
+	// arrange
+	privateKey, publicKey := GenerateKeyPair()
+
+	// act
+	certificate, err := x509.ParseCertificate(SelfSignedCertificate(privateKey, "test"))
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "test", certificate.Subject.CommonName)
+	assert.Equal(t, publicKey, certificate.PublicKey)
+}
+
+func Test_SelfSignedCertificate_Rsa(t *testing.T) {
+	// arrange
+	privateKey := GenerateRsaKey()
+
+	// act
+	first := SelfSignedCertificate(privateKey, "test")
+	second := SelfSignedCertificate(privateKey, "test")
+	certificate, err := x509.ParseCertificate(first)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, &privateKey.PublicKey, certificate.PublicKey)
+}
+
+func Test_ImportRsaPrivateKey(t *testing.T) {
+	// arrange
+	privateKey := GenerateRsaKey()
+
+	// act
+	imported := ImportRsaPrivateKey(ExportRsaPrivateKey(privateKey))
+
+	// assert
+	assert.True(t, privateKey.Equal(imported))
+}
+
+func Test_GenerateRecoveryCode(t *testing.T) {
+	// act
+	code := GenerateRecoveryCode()
+
+	// assert
+	assert.Regexp(t, `^[2-9a-z]{5}-[2-9a-z]{5}$`, code)
+	assert.NotEqual(t, code, GenerateRecoveryCode())
+}
+
+func Test_NormalizeRecoveryCode(t *testing.T) {
+	// act
+	normalized := NormalizeRecoveryCode(" AB3DE-fg4hk ")
+
+	// assert
+	assert.Equal(t, "ab3defg4hk", normalized)
+}
+
+func Test_ConsumeRecoveryCode_OnlyOnce(t *testing.T) {
+	// arrange
+	settings := BcryptHashSettings{Cost: 10}
+	hasher := settings.MakeHasher()
+	hashedCodes := []string{
+		hasher.Hash(NormalizeRecoveryCode("ab3de-fg4hk")),
+		hasher.Hash(NormalizeRecoveryCode("mn5pq-rs6tu")),
+	}
+
+	// act
+	remaining, consumed := ConsumeRecoveryCode(hashedCodes, "AB3DE-FG4HK", hasher)
+	_, consumedAgain := ConsumeRecoveryCode(remaining, "ab3de-fg4hk", hasher)
+
+	// assert
+	assert.True(t, consumed)
+	assert.Equal(t, []string{hashedCodes[1]}, remaining)
+	assert.Len(t, hashedCodes, 2)
+	assert.False(t, consumedAgain)
+}
+
+func Test_GenerateNumericCode(t *testing.T) {
+	// act
+	code := GenerateNumericCode(6)
+
+	// assert
+	assert.Regexp(t, `^[0-9]{6}$`, code)
+}
+
+func Test_VerifySignature(t *testing.T) {
+	// arrange
+	key := GenerateSymmetricKeyFromText("secret")
+	signature := Sign("data", key)
+
+	// act
+	valid := VerifySignature("data", signature, key)
+	tampered := VerifySignature("other data", signature, key)
+	wrongKey := VerifySignature("data", signature, GenerateSymmetricKeyFromText("other secret"))
+
+	// assert
+	assert.True(t, valid)
+	assert.False(t, tampered)
+	assert.False(t, wrongKey)
+}
@@ -33,3 +33,10 @@ func RemoveFirst[T any](slice []T, fn func(T) bool) []T {
 	// Remove the entry at the found index
 	return append(slice[:index], slice[index+1:]...)
 }
+
+func NonNilSlice[T any](slice []T) []T {
+	if slice == nil {
+		return make([]T, 0)
+	}
+	return slice
+}
@@ -112,3 +112,26 @@ func Test_IsSliceSubset_EmptySet(t *testing.T) {
 	// arrange
 	assert.False(t, result)
 }
+
+func Test_NonNilSlice_Nil(t *testing.T) {
+	// arrange
+	var s []int
+
+	// act
+	result := NonNilSlice(s)
+
+	// assert
+	assert.NotNil(t, result)
+	assert.Empty(t, result)
+}
+
+func Test_NonNilSlice_NotNil(t *testing.T) {
+	// arrange
+	s := []int{1, 2}
+
+	// act
+	result := NonNilSlice(s)
+
+	// assert
+	assert.Equal(t, []int{1, 2}, result)
+}